@@ -9,8 +9,12 @@ package agent
 import (
 	"fmt"
 	"io"
+	"math"
 	"net"
+	"net/url"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -100,6 +104,48 @@ func convertServerConfig(agentConfig *Config, logOutput io.Writer) (*uconf.Serve
 	if len(agentConfig.Server.EnabledSchedulers) != 0 {
 		conf.EnabledSchedulers = agentConfig.Server.EnabledSchedulers
 	}
+	if agentConfig.Server.RPCCompression {
+		conf.RPCCompression = true
+	}
+	if agentConfig.Server.RPCCompressionThreshold > 0 {
+		conf.RPCCompressionThreshold = agentConfig.Server.RPCCompressionThreshold
+	}
+	if agentConfig.Server.RPCMaxStreamWindow > 0 {
+		conf.RPCMaxStreamWindow = agentConfig.Server.RPCMaxStreamWindow
+	}
+	if agentConfig.Server.RPCMaxConns > 0 {
+		conf.RPCMaxConns = agentConfig.Server.RPCMaxConns
+	}
+	if agentConfig.Server.RPCMaxConnsPerIP > 0 {
+		conf.RPCMaxConnsPerIP = agentConfig.Server.RPCMaxConnsPerIP
+	}
+	if agentConfig.Server.RPCWeight > 0 {
+		conf.RPCWeight = agentConfig.Server.RPCWeight
+	}
+	if agentConfig.Server.NonVotingServer {
+		conf.NonVoter = true
+	}
+	if agentConfig.Server.RPCFrameChecksums {
+		conf.RPCFrameChecksums = true
+	}
+	if agentConfig.Server.MaxRaftEntrySize > 0 {
+		conf.MaxRaftEntrySize = agentConfig.Server.MaxRaftEntrySize
+	}
+	if agentConfig.Server.RPCOverloadThreshold > 0 {
+		conf.RPCOverloadThreshold = agentConfig.Server.RPCOverloadThreshold
+	}
+	if agentConfig.Server.MaxBlockingQueries > 0 {
+		conf.MaxBlockingQueries = agentConfig.Server.MaxBlockingQueries
+	}
+	if agentConfig.Server.JobEventsRetention > 0 {
+		conf.JobEventsRetention = agentConfig.Server.JobEventsRetention
+	}
+	if agentConfig.Server.RPCMaxConcurrent > 0 {
+		conf.RPCMaxConcurrent = agentConfig.Server.RPCMaxConcurrent
+	}
+	if agentConfig.Server.RPCDispatchQueue > 0 {
+		conf.RPCDispatchQueue = agentConfig.Server.RPCDispatchQueue
+	}
 
 	switch agentConfig.Profile {
 	case "wan":
@@ -123,6 +169,19 @@ func convertServerConfig(agentConfig *Config, logOutput io.Writer) (*uconf.Serve
 	conf.RPCAddr.IP = rpcAddr.IP
 	conf.SerfConfig.MemberlistConfig.BindPort = serfAddr.Port
 	conf.SerfConfig.MemberlistConfig.BindAddr = serfAddr.IP.String()
+	for _, raw := range agentConfig.Server.RPCExtraAddrs {
+		addr, err := net.ResolveTCPAddr("tcp", raw)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse extra RPC address %q: %v", raw, err)
+		}
+		conf.RPCExtraAddrs = append(conf.RPCExtraAddrs, addr)
+	}
+	if conf.RPCAllowedMethods, err = listenerMethods(agentConfig.Server.RPCAllowedMethods); err != nil {
+		return nil, err
+	}
+	if conf.RPCDeniedMethods, err = listenerMethods(agentConfig.Server.RPCDeniedMethods); err != nil {
+		return nil, err
+	}
 
 	// Set up the advertise addresses
 	rpcAddr, err = net.ResolveTCPAddr("tcp", agentConfig.AdvertiseAddrs.RPC)
@@ -145,6 +204,117 @@ func convertServerConfig(agentConfig *Config, logOutput io.Writer) (*uconf.Serve
 		conf.HeartbeatGrace = dur
 	}
 
+	if agentConfig.Server.LeaderTransferMaxLag > 0 {
+		conf.LeaderTransferMaxLag = agentConfig.Server.LeaderTransferMaxLag
+	}
+	if transferTimeout := agentConfig.Server.LeaderTransferTimeout; transferTimeout != "" {
+		dur, err := time.ParseDuration(transferTimeout)
+		if err != nil {
+			return nil, err
+		}
+		conf.LeaderTransferTimeout = dur
+	}
+
+	if drainTimeout := agentConfig.Server.RPCDrainTimeout; drainTimeout != "" {
+		dur, err := time.ParseDuration(drainTimeout)
+		if err != nil {
+			return nil, err
+		}
+		conf.RPCDrainTimeout = dur
+	}
+
+	if idleTimeout := agentConfig.Server.RPCIdleTimeout; idleTimeout != "" {
+		dur, err := time.ParseDuration(idleTimeout)
+		if err != nil {
+			return nil, err
+		}
+		conf.RPCIdleTimeout = dur
+	}
+
+	if pingInterval := agentConfig.Server.RPCPingInterval; pingInterval != "" {
+		dur, err := time.ParseDuration(pingInterval)
+		if err != nil {
+			return nil, err
+		}
+		conf.RPCPingInterval = dur
+	}
+	if agentConfig.Server.RPCMaxMissedPings > 0 {
+		conf.RPCMaxMissedPings = agentConfig.Server.RPCMaxMissedPings
+	}
+	if agentConfig.Server.RPCCircuitFailureThreshold > 0 {
+		conf.RPCCircuitFailureThreshold = agentConfig.Server.RPCCircuitFailureThreshold
+	}
+	if window := agentConfig.Server.RPCCircuitFailureWindow; window != "" {
+		dur, err := time.ParseDuration(window)
+		if err != nil {
+			return nil, err
+		}
+		conf.RPCCircuitFailureWindow = dur
+	}
+	if cooldown := agentConfig.Server.RPCCircuitCooldown; cooldown != "" {
+		dur, err := time.ParseDuration(cooldown)
+		if err != nil {
+			return nil, err
+		}
+		conf.RPCCircuitCooldown = dur
+	}
+	if healthInterval := agentConfig.Server.LeaderHealthInterval; healthInterval != "" {
+		dur, err := time.ParseDuration(healthInterval)
+		if err != nil {
+			return nil, err
+		}
+		conf.LeaderHealthInterval = dur
+	}
+	if agentConfig.Server.LeaderMaxApplyFailures > 0 {
+		conf.LeaderMaxApplyFailures = agentConfig.Server.LeaderMaxApplyFailures
+	}
+	if agentConfig.Server.LeaderMinFreeDisk > 0 {
+		conf.LeaderMinFreeDisk = agentConfig.Server.LeaderMinFreeDisk
+	}
+	if warmInterval := agentConfig.Server.WarmStandbyInterval; warmInterval != "" {
+		dur, err := time.ParseDuration(warmInterval)
+		if err != nil {
+			return nil, err
+		}
+		conf.WarmStandbyInterval = dur
+	}
+	if orphanInterval := agentConfig.Server.OrphanReconcileInterval; orphanInterval != "" {
+		dur, err := time.ParseDuration(orphanInterval)
+		if err != nil {
+			return nil, err
+		}
+		conf.OrphanReconcileInterval = dur
+	}
+	for _, raw := range agentConfig.Server.Webhooks {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid webhook %q: it must be an http or https URL", raw)
+		}
+	}
+	conf.Webhooks = agentConfig.Server.Webhooks
+
+	if len(agentConfig.Server.RPCRateLimits) != 0 {
+		conf.RPCRateLimits = make(map[string]uconf.RateLimit, len(agentConfig.Server.RPCRateLimits))
+		for method, raw := range agentConfig.Server.RPCRateLimits {
+			limit, err := parseRateLimit(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rpc_rate_limits entry for %q: %v", method, err)
+			}
+			conf.RPCRateLimits[method] = limit
+		}
+	}
+	conf.RPCRateLimitPerClient = agentConfig.Server.RPCRateLimitPerClient
+
+	if len(agentConfig.Server.RPCRegionTimeouts) != 0 {
+		conf.RPCRegionTimeouts = make(map[string]time.Duration, len(agentConfig.Server.RPCRegionTimeouts))
+		for region, raw := range agentConfig.Server.RPCRegionTimeouts {
+			dur, err := time.ParseDuration(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rpc_region_timeouts entry for %q: %v", region, err)
+			}
+			conf.RPCRegionTimeouts[region] = dur
+		}
+	}
+
 	if *agentConfig.Consul.AutoAdvertise && agentConfig.Consul.ServerServiceName == "" {
 		return nil, fmt.Errorf("server_service_name must be set when auto_advertise is enabled")
 	}
@@ -152,9 +322,37 @@ func convertServerConfig(agentConfig *Config, logOutput io.Writer) (*uconf.Serve
 	// Add the Consul config
 	conf.ConsulConfig = agentConfig.Consul
 
+	// Add the TLS config
+	conf.TLSConfig = agentConfig.TLSConfig
+
+	if conf.SecretsKeyring, err = loadSecretsKeyring(agentConfig); err != nil {
+		return nil, err
+	}
+
 	return conf, nil
 }
 
+// parseRateLimit parses a rate limit given as "rate" or "rate/burst". The
+// burst defaults to the rate rounded up.
+func parseRateLimit(raw string) (uconf.RateLimit, error) {
+	var limit uconf.RateLimit
+	parts := strings.SplitN(raw, "/", 2)
+	rate, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || rate <= 0 {
+		return limit, fmt.Errorf("rate must be a positive number, got %q", parts[0])
+	}
+	limit.Rate = rate
+	limit.Burst = int(math.Ceil(rate))
+	if len(parts) == 2 {
+		burst, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || burst <= 0 {
+			return limit, fmt.Errorf("burst must be a positive integer, got %q", parts[1])
+		}
+		limit.Burst = burst
+	}
+	return limit, nil
+}
+
 // serverConfig is used to generate a new server configuration struct
 // for initializing a server server.
 func (a *Agent) serverConfig() (*uconf.ServerConfig, error) {
@@ -199,6 +397,7 @@ func (a *Agent) clientConfig() (*uconf.ClientConfig, error) {
 	}
 
 	conf.ConsulConfig = a.config.Consul
+	conf.TLSConfig = a.config.TLSConfig
 	conf.NatsAddr = a.config.AdvertiseAddrs.Nats
 	conf.MaxPayload = a.config.Network.MaxPayload
 	conf.StatsCollectionInterval = a.config.Metric.collectionInterval
@@ -207,9 +406,24 @@ func (a *Agent) clientConfig() (*uconf.ClientConfig, error) {
 
 	conf.NoHostUUID = a.config.Client.NoHostUUID
 
+	keyring, err := loadSecretsKeyring(a.config)
+	if err != nil {
+		return nil, err
+	}
+	conf.SecretsKeyring = keyring
+
 	return conf, nil
 }
 
+// loadSecretsKeyring loads the keyring of secrets_key_file, nil if it's
+// not set
+func loadSecretsKeyring(agentConfig *Config) (*uconf.Keyring, error) {
+	if agentConfig.SecretsKeyFile == "" {
+		return nil, nil
+	}
+	return uconf.LoadKeyring(agentConfig.SecretsKeyFile)
+}
+
 // setupServer is used to setup the server if enabled
 func (a *Agent) setupServer() error {
 	if !a.config.Server.Enabled {
@@ -333,3 +547,20 @@ func (a *Agent) Stats() map[string]map[string]string {
 	}
 	return stats
 }
+
+// listenerMethods keys the RPC method lists by the normalized form of
+// their listener addresses so they match the ones the server listens on
+func listenerMethods(raw map[string][]string) (map[string][]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	methods := make(map[string][]string, len(raw))
+	for rawAddr, list := range raw {
+		addr, err := net.ResolveTCPAddr("tcp", rawAddr)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse RPC listener address %q: %v", rawAddr, err)
+		}
+		methods[addr.String()] = append(methods[addr.String()], list...)
+	}
+	return methods, nil
+}
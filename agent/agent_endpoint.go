@@ -13,6 +13,7 @@ import (
 	"github.com/hashicorp/serf/serf"
 
 	umodel "github.com/actiontech/dtle/internal/models"
+	usrv "github.com/actiontech/dtle/internal/server"
 )
 
 type Member struct {
@@ -123,6 +124,53 @@ func (s *HTTPServer) AgentForceLeaveRequest(resp http.ResponseWriter, req *http.
 	return nil, err
 }
 
+// AgentLogLevelRequest changes the level the agent logs at until it
+// restarts, to ?level, for the entries of ?component or ?job only if one
+// is set. An empty level logs those at the level of the others again. With
+// ?all the servers of the region change theirs too, but not the other
+// client-only agents, which have to be called one by one.
+func (s *HTTPServer) AgentLogLevelRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	query := req.URL.Query()
+	args := umodel.LogLevelRequest{
+		Level:     query.Get("level"),
+		Component: query.Get("component"),
+		JobID:     query.Get("job"),
+	}
+	_, args.AllServers = query["all"]
+	s.parseRegion(req, &args.Region)
+
+	// A server changes the level of the agent itself
+	if s.agent.Server() != nil {
+		var reply umodel.LogLevelResponse
+		if err := s.agent.RPC("Operator.SetLogLevel", &args, &reply); err != nil {
+			return nil, err
+		}
+		return reply, nil
+	}
+
+	change, err := s.agent.logger.ChangeLevel(args.Level, args.Component, args.JobID)
+	if err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	s.agent.logger.Printf("Logging %s", change)
+	reply := umodel.LogLevelResponse{Agents: map[string]*umodel.AgentLogLevels{
+		s.agent.config.NodeName: {Levels: usrv.LogLevels(s.agent.logger)},
+	}}
+	if args.AllServers {
+		var servers umodel.LogLevelResponse
+		if err := s.agent.RPC("Operator.SetLogLevel", &args, &servers); err != nil {
+			return nil, err
+		}
+		for name, levels := range servers.Agents {
+			reply.Agents[name] = levels
+		}
+	}
+	return reply, nil
+}
+
 // AgentServersRequest is used to query the list of servers used by the Udup
 // Client for RPCs.  This endpoint can also be used to update the list of
 // servers for a given agent.
@@ -7,13 +7,14 @@
 package agent
 
 import (
-	"log"
 	"net"
 	"net/http"
 	"reflect"
 	"testing"
 
 	"github.com/hashicorp/serf/serf"
+
+	log "github.com/actiontech/dtle/internal/logger"
 )
 
 func Test_udupMember(t *testing.T) {
@@ -10,7 +10,6 @@ import (
 	"bytes"
 	"io"
 	"reflect"
-	"sync"
 	"testing"
 	ucli "github.com/actiontech/dtle/internal/client"
 	uconf "github.com/actiontech/dtle/internal/config"
@@ -90,7 +89,6 @@ func TestAgent_serverConfig(t *testing.T) {
 		server       *usrv.Server
 		shutdown     bool
 		shutdownCh   chan struct{}
-		shutdownLock sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -110,7 +108,6 @@ func TestAgent_serverConfig(t *testing.T) {
 				server:       tt.fields.server,
 				shutdown:     tt.fields.shutdown,
 				shutdownCh:   tt.fields.shutdownCh,
-				shutdownLock: tt.fields.shutdownLock,
 			}
 			got, err := a.serverConfig()
 			if (err != nil) != tt.wantErr {
@@ -133,7 +130,6 @@ func TestAgent_clientConfig(t *testing.T) {
 		server       *usrv.Server
 		shutdown     bool
 		shutdownCh   chan struct{}
-		shutdownLock sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -153,7 +149,6 @@ func TestAgent_clientConfig(t *testing.T) {
 				server:       tt.fields.server,
 				shutdown:     tt.fields.shutdown,
 				shutdownCh:   tt.fields.shutdownCh,
-				shutdownLock: tt.fields.shutdownLock,
 			}
 			got, err := a.clientConfig()
 			if (err != nil) != tt.wantErr {
@@ -176,7 +171,6 @@ func TestAgent_setupServer(t *testing.T) {
 		server       *usrv.Server
 		shutdown     bool
 		shutdownCh   chan struct{}
-		shutdownLock sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -195,7 +189,6 @@ func TestAgent_setupServer(t *testing.T) {
 				server:       tt.fields.server,
 				shutdown:     tt.fields.shutdown,
 				shutdownCh:   tt.fields.shutdownCh,
-				shutdownLock: tt.fields.shutdownLock,
 			}
 			if err := a.setupServer(); (err != nil) != tt.wantErr {
 				t.Errorf("Agent.setupServer() error = %v, wantErr %v", err, tt.wantErr)
@@ -213,7 +206,6 @@ func TestAgent_setupClient(t *testing.T) {
 		server       *usrv.Server
 		shutdown     bool
 		shutdownCh   chan struct{}
-		shutdownLock sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -232,7 +224,6 @@ func TestAgent_setupClient(t *testing.T) {
 				server:       tt.fields.server,
 				shutdown:     tt.fields.shutdown,
 				shutdownCh:   tt.fields.shutdownCh,
-				shutdownLock: tt.fields.shutdownLock,
 			}
 			if err := a.setupClient(); (err != nil) != tt.wantErr {
 				t.Errorf("Agent.setupClient() error = %v, wantErr %v", err, tt.wantErr)
@@ -250,7 +241,6 @@ func TestAgent_Leave(t *testing.T) {
 		server       *usrv.Server
 		shutdown     bool
 		shutdownCh   chan struct{}
-		shutdownLock sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -269,7 +259,6 @@ func TestAgent_Leave(t *testing.T) {
 				server:       tt.fields.server,
 				shutdown:     tt.fields.shutdown,
 				shutdownCh:   tt.fields.shutdownCh,
-				shutdownLock: tt.fields.shutdownLock,
 			}
 			if err := a.Leave(); (err != nil) != tt.wantErr {
 				t.Errorf("Agent.Leave() error = %v, wantErr %v", err, tt.wantErr)
@@ -287,7 +276,6 @@ func TestAgent_Shutdown(t *testing.T) {
 		server       *usrv.Server
 		shutdown     bool
 		shutdownCh   chan struct{}
-		shutdownLock sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -306,7 +294,6 @@ func TestAgent_Shutdown(t *testing.T) {
 				server:       tt.fields.server,
 				shutdown:     tt.fields.shutdown,
 				shutdownCh:   tt.fields.shutdownCh,
-				shutdownLock: tt.fields.shutdownLock,
 			}
 			if err := a.Shutdown(); (err != nil) != tt.wantErr {
 				t.Errorf("Agent.Shutdown() error = %v, wantErr %v", err, tt.wantErr)
@@ -324,7 +311,6 @@ func TestAgent_RPC(t *testing.T) {
 		server       *usrv.Server
 		shutdown     bool
 		shutdownCh   chan struct{}
-		shutdownLock sync.Mutex
 	}
 	type args struct {
 		method string
@@ -349,7 +335,6 @@ func TestAgent_RPC(t *testing.T) {
 				server:       tt.fields.server,
 				shutdown:     tt.fields.shutdown,
 				shutdownCh:   tt.fields.shutdownCh,
-				shutdownLock: tt.fields.shutdownLock,
 			}
 			if err := a.RPC(tt.args.method, tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Agent.RPC() error = %v, wantErr %v", err, tt.wantErr)
@@ -367,7 +352,6 @@ func TestAgent_Client(t *testing.T) {
 		server       *usrv.Server
 		shutdown     bool
 		shutdownCh   chan struct{}
-		shutdownLock sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -386,7 +370,6 @@ func TestAgent_Client(t *testing.T) {
 				server:       tt.fields.server,
 				shutdown:     tt.fields.shutdown,
 				shutdownCh:   tt.fields.shutdownCh,
-				shutdownLock: tt.fields.shutdownLock,
 			}
 			if got := a.Client(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Agent.Client() = %v, want %v", got, tt.want)
@@ -404,7 +387,6 @@ func TestAgent_Server(t *testing.T) {
 		server       *usrv.Server
 		shutdown     bool
 		shutdownCh   chan struct{}
-		shutdownLock sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -423,7 +405,6 @@ func TestAgent_Server(t *testing.T) {
 				server:       tt.fields.server,
 				shutdown:     tt.fields.shutdown,
 				shutdownCh:   tt.fields.shutdownCh,
-				shutdownLock: tt.fields.shutdownLock,
 			}
 			if got := a.Server(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Agent.Server() = %v, want %v", got, tt.want)
@@ -441,7 +422,6 @@ func TestAgent_Stats(t *testing.T) {
 		server       *usrv.Server
 		shutdown     bool
 		shutdownCh   chan struct{}
-		shutdownLock sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -460,7 +440,6 @@ func TestAgent_Stats(t *testing.T) {
 				server:       tt.fields.server,
 				shutdown:     tt.fields.shutdown,
 				shutdownCh:   tt.fields.shutdownCh,
-				shutdownLock: tt.fields.shutdownLock,
 			}
 			if got := a.Stats(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Agent.Stats() = %v, want %v", got, tt.want)
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/actiontech/dtle/api"
 	umodel "github.com/actiontech/dtle/internal/models"
 )
 
@@ -94,6 +95,8 @@ func (s *HTTPServer) ClientAllocRequest(resp http.ResponseWriter, req *http.Requ
 	switch tokens[1] {
 	case "stats":
 		return s.allocStats(allocID, resp, req)
+	case "throttle":
+		return s.allocThrottle(allocID, resp, req)
 	}
 
 	return nil, CodedError(404, resourceNotFoundErr)
@@ -109,3 +112,68 @@ func (s *HTTPServer) allocStats(allocID string, resp http.ResponseWriter, req *h
 	task := req.URL.Query().Get("task")
 	return aStats.LatestAllocStats(task)
 }
+
+func (s *HTTPServer) allocThrottle(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if !(req.Method == "PUT" || req.Method == "POST") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	var args api.ThrottleRequest
+	if err := decodeBody(req, &args); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	if err := s.agent.client.SetAllocThrottle(allocID, args.BytesPerSecond, args.RowsPerSecond); err != nil {
+		return nil, err
+	}
+	// Saved with the job, the throttle outlives restarts of the task
+	if err := s.saveAllocThrottle(allocID, &args); err != nil {
+		return nil, CodedError(500, fmt.Sprintf("throttle set on the running task but not saved with the job: %v", err))
+	}
+	return nil, nil
+}
+
+// saveAllocThrottle writes the rates of args to the configuration of the
+// task of the alloc, with Job.Update as the running tasks reload it
+func (s *HTTPServer) saveAllocThrottle(allocID string, args *api.ThrottleRequest) error {
+	alloc, err := s.agent.client.GetClientAlloc(allocID)
+	if err != nil {
+		return err
+	}
+	jobArgs := umodel.JobSpecificRequest{
+		JobID: alloc.JobID,
+	}
+	jobArgs.Region = s.agent.config.Region
+	var out umodel.SingleJobResponse
+	if err := s.agent.RPC("Job.GetJob", &jobArgs, &out); err != nil {
+		return err
+	}
+	if out.Job == nil {
+		return fmt.Errorf("job %q not found", alloc.JobID)
+	}
+
+	update := throttleUpdate(out.Job, alloc.Task, args)
+	update.Region = jobArgs.Region
+	var updateOut umodel.JobConfigUpdateResponse
+	return s.agent.RPC("Job.Update", update, &updateOut)
+}
+
+// throttleUpdate returns the update of the configuration of the tasks of
+// job setting the rates of args on the task of type taskType
+func throttleUpdate(job *umodel.Job, taskType string, args *api.ThrottleRequest) *umodel.JobConfigUpdateRequest {
+	update := &umodel.JobConfigUpdateRequest{
+		JobID: job.ID,
+	}
+	for _, t := range job.Tasks {
+		task := *t
+		if task.Type == taskType {
+			// The config of the job is left as it is
+			task.Config = make(map[string]interface{}, len(t.Config)+2)
+			for k, v := range t.Config {
+				task.Config[k] = v
+			}
+			task.Config["ThrottleBytesPerSecond"] = args.BytesPerSecond
+			task.Config["ThrottleRowsPerSecond"] = args.RowsPerSecond
+		}
+		update.Tasks = append(update.Tasks, &task)
+	}
+	return update
+}
@@ -7,11 +7,14 @@
 package agent
 
 import (
-	"log"
 	"net"
 	"net/http"
 	"reflect"
 	"testing"
+
+	"github.com/actiontech/dtle/api"
+	log "github.com/actiontech/dtle/internal/logger"
+	umodel "github.com/actiontech/dtle/internal/models"
 )
 
 func TestHTTPServer_AllocsRequest(t *testing.T) {
@@ -182,3 +185,31 @@ func TestHTTPServer_allocStats(t *testing.T) {
 		})
 	}
 }
+
+func TestThrottleUpdate(t *testing.T) {
+	job := &umodel.Job{
+		ID: "job1",
+		Tasks: []*umodel.Task{
+			{Type: umodel.TaskTypeSrc, Config: map[string]interface{}{"Gtid": "uuid:1-10"}},
+			{Type: umodel.TaskTypeDest, Config: map[string]interface{}{"ParallelWorkers": 4, "ThrottleRowsPerSecond": 100}},
+		},
+	}
+	update := throttleUpdate(job, umodel.TaskTypeDest, &api.ThrottleRequest{BytesPerSecond: 1 << 20})
+	if update.JobID != "job1" || len(update.Tasks) != 2 {
+		t.Fatalf("throttleUpdate() = %+v", update)
+	}
+	if !reflect.DeepEqual(update.Tasks[0].Config, job.Tasks[0].Config) {
+		t.Errorf("config of task %s = %v, want it unchanged", umodel.TaskTypeSrc, update.Tasks[0].Config)
+	}
+	want := map[string]interface{}{"ParallelWorkers": 4, "ThrottleBytesPerSecond": int64(1 << 20), "ThrottleRowsPerSecond": int64(0)}
+	if !reflect.DeepEqual(update.Tasks[1].Config, want) {
+		t.Errorf("config of task %s = %v, want %v", umodel.TaskTypeDest, update.Tasks[1].Config, want)
+	}
+	if job.Tasks[1].Config["ThrottleRowsPerSecond"] != 100 {
+		t.Errorf("throttleUpdate() changed the config of the job to %v", job.Tasks[1].Config)
+	}
+	changed, err := umodel.ConfigChanges(umodel.TaskTypeDest, job.Tasks[1].Config, update.Tasks[1].Config)
+	if err != nil || !reflect.DeepEqual(changed, []string{"ThrottleBytesPerSecond", "ThrottleRowsPerSecond"}) {
+		t.Errorf("ConfigChanges() of the update = %v, %v", changed, err)
+	}
+}
@@ -44,6 +44,7 @@ type Command struct {
 	args           []string
 	agent          *Agent
 	httpServer     *HTTPServer
+	metricsServer  *MetricsServer
 	logger         *ulog.Logger
 	logOutput      io.Writer
 	retryJoinErrCh chan struct{}
@@ -219,10 +220,19 @@ func (c *Command) setupLoggers(config *Config) (io.Writer, error) {
 		oFile = os.Stderr
 	}
 
-	c.logOutput = oFile
 	c.logger = ulog.New(oFile, ulog.ParseLevel(config.LogLevel))
-	log.SetOutput(oFile)
-	return oFile, nil
+	switch config.LogFormat {
+	case "", "text":
+		c.logOutput = oFile
+	case "json":
+		c.logger.Formatter = &ulog.JSONFormatter{}
+		// The lines of the loggers of the libraries become messages too
+		c.logOutput = c.logger.Writer()
+	default:
+		return nil, fmt.Errorf("Invalid log_format %q, must be \"text\" or \"json\"", config.LogFormat)
+	}
+	log.SetOutput(c.logOutput)
+	return c.logOutput, nil
 }
 
 // setupAgent is used to start the agent and various interfaces
@@ -234,6 +244,9 @@ func (c *Command) setupAgent(config *Config, logOutput io.Writer) error {
 		return err
 	}
 	c.agent = agent
+	if formatter, ok := c.logger.Formatter.(*ulog.JSONFormatter); ok {
+		formatter.SetField(ulog.FieldNodeID, agent.nodeID())
+	}
 
 	// Setup the HTTP server
 	http, err := NewHTTPServer(agent, config, logOutput)
@@ -244,6 +257,18 @@ func (c *Command) setupAgent(config *Config, logOutput io.Writer) error {
 	}
 	c.httpServer = http
 
+	// Setup the metrics server
+	if config.Metric != nil && config.Metric.PrometheusBindAddr != "" {
+		metricsServer, err := NewMetricsServer(agent, config.Metric.PrometheusBindAddr)
+		if err != nil {
+			http.Shutdown()
+			agent.Shutdown()
+			c.logger.Errorf("Error starting metrics server: %s", err)
+			return err
+		}
+		c.metricsServer = metricsServer
+	}
+
 	return nil
 }
 
@@ -288,6 +313,9 @@ func (c *Command) Run(args []string) int {
 		if c.httpServer != nil {
 			c.httpServer.Shutdown()
 		}
+		if c.metricsServer != nil {
+			c.metricsServer.Shutdown()
+		}
 	}()
 
 	// Join startup nodes if specified
@@ -316,11 +344,11 @@ func (c *Command) Run(args []string) int {
 	padding := 18
 	c.logger.Printf("Dtle server configuration:\n")
 	for _, k := range infoKeys {
-		c.logger.Printf(fmt.Sprintf(
+		c.logger.Printf(
 			" %s%s: %s",
 			strings.Repeat(" ", padding-len(k)),
 			strings.Title(k),
-			info[k]))
+			info[k])
 	}
 	// Output the header that the server has started
 	c.logger.Printf("Dtle server started! Log data will stream in below:\n")
@@ -409,9 +437,11 @@ func (c *Command) handleReload(config *Config) *Config {
 	}
 
 	if s := c.agent.Server(); s != nil {
-		_, err := convertServerConfig(newConf, c.logOutput)
+		sconf, err := convertServerConfig(newConf, c.logOutput)
 		if err != nil {
 			c.logger.Errorf("server: failed to convert server config: %v", err)
+		} else if err := s.Reload(sconf); err != nil {
+			c.logger.Errorf("server: failed to reload server config: %v", err)
 		}
 	}
 
@@ -135,7 +135,7 @@ func TestCommand_setupLoggers(t *testing.T) {
 				t.Errorf("Command.setupLoggers() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got := in0.String(); got != tt.want {
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Command.setupLoggers() = %v, want %v", got, tt.want)
 			}
 		})
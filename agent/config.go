@@ -45,6 +45,10 @@ type Config struct {
 
 	LogToStdout bool `mapstructure:"log_to_stdout"`
 
+	// LogFormat is the format of the logs, "text" or "json" for a JSON
+	// object per line. Defaults to text.
+	LogFormat string `mapstructure:"log_format"`
+
 	// file to write our pid to
 	PidFile string `mapstructure:"pid_file"`
 
@@ -93,6 +97,14 @@ type Config struct {
 	// discover the current Udup servers.
 	Consul *uconf.ConsulConfig `mapstructure:"consul"`
 
+	// TLSConfig provides TLS related configuration for the RPC layer
+	TLSConfig *uconf.TLSConfig `mapstructure:"tls"`
+
+	// SecretsKeyFile is a file of base64 AES keys, one per line, sealing
+	// the passwords of the jobs the servers store. The first key seals,
+	// all of them open. The agent doesn't start if it can't load them.
+	SecretsKeyFile string `mapstructure:"secrets_key_file"`
+
 	// UdupConfig is used to override the default config.
 	// This is largly used for testing purposes.
 	UdupConfig *uconf.ServerConfig `mapstructure:"-" json:"-"`
@@ -167,6 +179,14 @@ type ServerConfig struct {
 	// processing delays and clock skew before marking a node as "down".
 	HeartbeatGrace string `mapstructure:"heartbeat_grace"`
 
+	// LeaderTransferMaxLag is how many Raft entries a voter may be behind
+	// the leader to be handed the leadership on request.
+	LeaderTransferMaxLag uint64 `mapstructure:"leader_transfer_max_lag"`
+
+	// LeaderTransferTimeout is how long a leadership transfer waits for
+	// the voter to catch up and then to win, as a duration string.
+	LeaderTransferTimeout string `mapstructure:"leader_transfer_timeout"`
+
 	// StartJoin is a list of addresses to attempt to join when the
 	// agent starts. If Serf is unable to communicate with any of these
 	// addresses, then the agent will error and exit.
@@ -182,6 +202,131 @@ type ServerConfig struct {
 	// the default is 30s.
 	RetryInterval string        `mapstructure:"retry_interval"`
 	retryInterval time.Duration `mapstructure:"-"`
+
+	// RPCCompression enables compression of RPCs forwarded to other
+	// regions when the remote server supports it.
+	RPCCompression bool `mapstructure:"rpc_compression"`
+
+	// RPCCompressionThreshold is the minimum payload size in bytes that
+	// is compressed when RPCCompression is enabled.
+	RPCCompressionThreshold int `mapstructure:"rpc_compression_threshold"`
+
+	// RPCMaxStreamWindow is the maximum flow control window in bytes of
+	// the multiplexed RPC streams. Larger windows speed up large transfers
+	// over high latency links at the cost of memory per stream.
+	RPCMaxStreamWindow int `mapstructure:"rpc_max_stream_window"`
+
+	// RPCMaxConns limits the number of concurrent RPC connections. Zero
+	// means unlimited.
+	RPCMaxConns int `mapstructure:"rpc_max_conns"`
+
+	// RPCMaxConnsPerIP limits the number of concurrent RPC connections
+	// from a single IP. Zero means unlimited.
+	RPCMaxConnsPerIP int `mapstructure:"rpc_max_conns_per_ip"`
+
+	// RPCDrainTimeout is how long shutdown waits for in-flight RPCs to
+	// complete, as a duration string.
+	RPCDrainTimeout string `mapstructure:"rpc_drain_timeout"`
+
+	// MaxRaftEntrySize is the size in bytes above which commands are
+	// refused instead of being replicated.
+	MaxRaftEntrySize int `mapstructure:"max_raft_entry_size"`
+
+	// RPCWeight is the preference other regions give this server when
+	// forwarding RPCs. Servers closer to them should get a higher weight.
+	RPCWeight int `mapstructure:"rpc_weight"`
+
+	// NonVotingServer makes the server a read replica: it replicates the
+	// state and serves stale reads but never votes in elections.
+	NonVotingServer bool `mapstructure:"non_voting_server"`
+
+	// RPCRateLimits maps RPC method names, or "*" for any other method, to
+	// their rate limit as "rate" or "rate/burst" in requests per second.
+	// They are applied again when the configuration is reloaded.
+	RPCRateLimits map[string]string `mapstructure:"rpc_rate_limits"`
+
+	// RPCRateLimitPerClient limits the rate of every client IP separately
+	RPCRateLimitPerClient bool `mapstructure:"rpc_rate_limit_per_client"`
+
+	// RPCRegionTimeouts maps region names to how long an RPC forwarded
+	// there may take, as duration strings. They are applied again when
+	// the configuration is reloaded.
+	RPCRegionTimeouts map[string]string `mapstructure:"rpc_region_timeouts"`
+
+	// RPCFrameChecksums checks the RPCs forwarded to other regions against
+	// a CRC32 of every frame
+	RPCFrameChecksums bool `mapstructure:"rpc_frame_checksums"`
+
+	// RPCOverloadThreshold is the number of RPCs in flight above which
+	// clients are told to back off
+	RPCOverloadThreshold int `mapstructure:"rpc_overload_threshold"`
+
+	// MaxBlockingQueries is the number of blocking queries served at once,
+	// the others are answered without waiting for a change
+	MaxBlockingQueries int `mapstructure:"max_blocking_queries"`
+
+	// JobEventsRetention is the number of task events kept for each job
+	JobEventsRetention int `mapstructure:"job_events_retention"`
+
+	// RPCMaxConcurrent is the number of RPCs served at once and
+	// RPCDispatchQueue the number that may wait, by priority, for a slot
+	RPCMaxConcurrent int `mapstructure:"rpc_max_concurrent"`
+	RPCDispatchQueue int `mapstructure:"rpc_dispatch_queue"`
+
+	// RPCExtraAddrs are "ip:port" addresses the RPC server listens on in
+	// addition to addresses.rpc
+	RPCExtraAddrs []string `mapstructure:"rpc_extra_addrs"`
+
+	// RPCAllowedMethods and RPCDeniedMethods map RPC listener addresses to
+	// the methods that may or may not be called on them, such as
+	// "Status.Ping" or "Status.*"
+	RPCAllowedMethods map[string][]string `mapstructure:"rpc_allowed_methods"`
+	RPCDeniedMethods  map[string][]string `mapstructure:"rpc_denied_methods"`
+
+	// RPCIdleTimeout closes the RPC streams that didn't send a request for
+	// that long, as a duration string. Empty keeps them open.
+	RPCIdleTimeout string `mapstructure:"rpc_idle_timeout"`
+
+	// RPCPingInterval is how often the connections to other servers are
+	// pinged, as a duration string.
+	RPCPingInterval string `mapstructure:"rpc_ping_interval"`
+
+	// RPCMaxMissedPings is how many pings in a row a connection to another
+	// server may miss before it is closed as dead.
+	RPCMaxMissedPings int `mapstructure:"rpc_max_missed_pings"`
+
+	// RPCCircuitFailureThreshold is how many failed RPCs to another server
+	// within RPCCircuitFailureWindow, a duration string, stop the RPCs to
+	// it for RPCCircuitCooldown, a duration string too.
+	RPCCircuitFailureThreshold int    `mapstructure:"rpc_circuit_failure_threshold"`
+	RPCCircuitFailureWindow    string `mapstructure:"rpc_circuit_failure_window"`
+	RPCCircuitCooldown         string `mapstructure:"rpc_circuit_cooldown"`
+
+	// LeaderHealthInterval is how often the leader checks it can still
+	// make progress, as a duration string. The checks are off unless it
+	// is set, "0" turns them off again.
+	LeaderHealthInterval string `mapstructure:"leader_health_interval"`
+
+	// LeaderMaxApplyFailures is the number of Raft applies that may fail
+	// in a row before the leader steps down.
+	LeaderMaxApplyFailures int `mapstructure:"leader_max_apply_failures"`
+
+	// LeaderMinFreeDisk is the free disk space in bytes below which the
+	// leader steps down.
+	LeaderMinFreeDisk uint64 `mapstructure:"leader_min_free_disk"`
+
+	// OrphanReconcileInterval is how often the leader reschedules the jobs
+	// no worker runs, as a duration string. "0" disables it.
+	OrphanReconcileInterval string `mapstructure:"orphan_reconcile_interval"`
+
+	// WarmStandbyInterval is how often followers pull the connections
+	// pooled by the leader to open them if they take over, as a duration
+	// string. "0" disables it.
+	WarmStandbyInterval string `mapstructure:"warm_standby_interval"`
+
+	// Webhooks are the URLs the server POSTs a JSON notification to when
+	// a job changes status or its leadership changes
+	Webhooks []string `mapstructure:"webhooks"`
 }
 
 type Network struct {
@@ -197,6 +342,10 @@ type Metric struct {
 	collectionInterval       time.Duration `mapstructure:"-"`
 	PublishAllocationMetrics bool          `mapstructure:"publish_allocation_metrics"`
 	PublishNodeMetrics       bool          `mapstructure:"publish_node_metrics"`
+
+	// PrometheusBindAddr is the address the /metrics endpoint exposing the
+	// metrics to Prometheus binds to. It is disabled if empty.
+	PrometheusBindAddr string `mapstructure:"prometheus_bind_addr"`
 }
 
 // Ports encapsulates the various ports we bind to for network services. If any
@@ -263,7 +412,8 @@ func DefaultConfig() *Config {
 		AdvertiseAddrs: &AdvertiseAddrs{
 			Nats: DefaultAddr,
 		},
-		Consul: uconf.DefaultConsulConfig(),
+		Consul:    uconf.DefaultConsulConfig(),
+		TLSConfig: &uconf.TLSConfig{},
 		Client: &ClientConfig{
 			Enabled:    false,
 			NoHostUUID: true,
@@ -342,6 +492,9 @@ func (c *Config) Merge(b *Config) *Config {
 	if b.LogToStdout {
 		result.LogToStdout = b.LogToStdout
 	}
+	if b.LogFormat != "" {
+		result.LogFormat = b.LogFormat
+	}
 	if b.PidFile != "" {
 		result.PidFile = b.PidFile
 	}
@@ -421,6 +574,13 @@ func (c *Config) Merge(b *Config) *Config {
 		result.Consul = result.Consul.Merge(b.Consul)
 	}
 
+	// Apply the TLS Config
+	if result.TLSConfig == nil && b.TLSConfig != nil {
+		result.TLSConfig = b.TLSConfig.Copy()
+	} else if b.TLSConfig != nil {
+		result.TLSConfig = result.TLSConfig.Merge(b.TLSConfig)
+	}
+
 	// Merge config files lists
 	result.Files = append(result.Files, b.Files...)
 
@@ -435,6 +595,9 @@ func (c *Config) Merge(b *Config) *Config {
 	if b.DtleSchemaName != "" {
 		result.DtleSchemaName = b.DtleSchemaName
 	}
+	if b.SecretsKeyFile != "" {
+		result.SecretsKeyFile = b.SecretsKeyFile
+	}
 
 	return &result
 }
@@ -586,6 +749,12 @@ func (a *ServerConfig) Merge(b *ServerConfig) *ServerConfig {
 	if b.HeartbeatGrace != "" {
 		result.HeartbeatGrace = b.HeartbeatGrace
 	}
+	if b.LeaderTransferMaxLag != 0 {
+		result.LeaderTransferMaxLag = b.LeaderTransferMaxLag
+	}
+	if b.LeaderTransferTimeout != "" {
+		result.LeaderTransferTimeout = b.LeaderTransferTimeout
+	}
 	if b.RetryMaxAttempts != 0 {
 		result.RetryMaxAttempts = b.RetryMaxAttempts
 	}
@@ -593,6 +762,117 @@ func (a *ServerConfig) Merge(b *ServerConfig) *ServerConfig {
 		result.RetryInterval = b.RetryInterval
 		result.retryInterval = b.retryInterval
 	}
+	if b.RPCCompression {
+		result.RPCCompression = true
+	}
+	if b.RPCCompressionThreshold != 0 {
+		result.RPCCompressionThreshold = b.RPCCompressionThreshold
+	}
+	if b.RPCMaxStreamWindow != 0 {
+		result.RPCMaxStreamWindow = b.RPCMaxStreamWindow
+	}
+	if b.RPCMaxConns != 0 {
+		result.RPCMaxConns = b.RPCMaxConns
+	}
+	if b.RPCMaxConnsPerIP != 0 {
+		result.RPCMaxConnsPerIP = b.RPCMaxConnsPerIP
+	}
+	if b.RPCWeight != 0 {
+		result.RPCWeight = b.RPCWeight
+	}
+	if b.NonVotingServer {
+		result.NonVotingServer = true
+	}
+	if b.MaxRaftEntrySize != 0 {
+		result.MaxRaftEntrySize = b.MaxRaftEntrySize
+	}
+	if b.RPCDrainTimeout != "" {
+		result.RPCDrainTimeout = b.RPCDrainTimeout
+	}
+	if len(b.RPCRateLimits) != 0 {
+		result.RPCRateLimits = make(map[string]string, len(a.RPCRateLimits)+len(b.RPCRateLimits))
+		for method, limit := range a.RPCRateLimits {
+			result.RPCRateLimits[method] = limit
+		}
+		for method, limit := range b.RPCRateLimits {
+			result.RPCRateLimits[method] = limit
+		}
+	}
+	if b.RPCRateLimitPerClient {
+		result.RPCRateLimitPerClient = true
+	}
+	if b.RPCFrameChecksums {
+		result.RPCFrameChecksums = true
+	}
+	if len(b.RPCRegionTimeouts) != 0 {
+		result.RPCRegionTimeouts = make(map[string]string, len(a.RPCRegionTimeouts)+len(b.RPCRegionTimeouts))
+		for region, timeout := range a.RPCRegionTimeouts {
+			result.RPCRegionTimeouts[region] = timeout
+		}
+		for region, timeout := range b.RPCRegionTimeouts {
+			result.RPCRegionTimeouts[region] = timeout
+		}
+	}
+	if b.RPCOverloadThreshold != 0 {
+		result.RPCOverloadThreshold = b.RPCOverloadThreshold
+	}
+	if b.MaxBlockingQueries != 0 {
+		result.MaxBlockingQueries = b.MaxBlockingQueries
+	}
+	if b.JobEventsRetention != 0 {
+		result.JobEventsRetention = b.JobEventsRetention
+	}
+	if b.RPCMaxConcurrent != 0 {
+		result.RPCMaxConcurrent = b.RPCMaxConcurrent
+	}
+	if b.RPCDispatchQueue != 0 {
+		result.RPCDispatchQueue = b.RPCDispatchQueue
+	}
+	if len(b.RPCExtraAddrs) != 0 {
+		result.RPCExtraAddrs = b.RPCExtraAddrs
+	}
+	if len(b.RPCAllowedMethods) != 0 {
+		result.RPCAllowedMethods = b.RPCAllowedMethods
+	}
+	if len(b.RPCDeniedMethods) != 0 {
+		result.RPCDeniedMethods = b.RPCDeniedMethods
+	}
+	if b.RPCIdleTimeout != "" {
+		result.RPCIdleTimeout = b.RPCIdleTimeout
+	}
+	if b.RPCPingInterval != "" {
+		result.RPCPingInterval = b.RPCPingInterval
+	}
+	if b.RPCMaxMissedPings != 0 {
+		result.RPCMaxMissedPings = b.RPCMaxMissedPings
+	}
+	if b.RPCCircuitFailureThreshold != 0 {
+		result.RPCCircuitFailureThreshold = b.RPCCircuitFailureThreshold
+	}
+	if b.RPCCircuitFailureWindow != "" {
+		result.RPCCircuitFailureWindow = b.RPCCircuitFailureWindow
+	}
+	if b.RPCCircuitCooldown != "" {
+		result.RPCCircuitCooldown = b.RPCCircuitCooldown
+	}
+	if b.LeaderHealthInterval != "" {
+		result.LeaderHealthInterval = b.LeaderHealthInterval
+	}
+	if b.LeaderMaxApplyFailures != 0 {
+		result.LeaderMaxApplyFailures = b.LeaderMaxApplyFailures
+	}
+	if b.LeaderMinFreeDisk != 0 {
+		result.LeaderMinFreeDisk = b.LeaderMinFreeDisk
+	}
+	if b.WarmStandbyInterval != "" {
+		result.WarmStandbyInterval = b.WarmStandbyInterval
+	}
+	if b.OrphanReconcileInterval != "" {
+		result.OrphanReconcileInterval = b.OrphanReconcileInterval
+	}
+	if len(b.Webhooks) != 0 {
+		result.Webhooks = b.Webhooks
+	}
 	// Add the schedulers
 	result.EnabledSchedulers = append(result.EnabledSchedulers, b.EnabledSchedulers...)
 
@@ -658,6 +938,9 @@ func (a *Metric) Merge(b *Metric) *Metric {
 	if b.PublishAllocationMetrics {
 		result.PublishAllocationMetrics = true
 	}
+	if b.PrometheusBindAddr != "" {
+		result.PrometheusBindAddr = b.PrometheusBindAddr
+	}
 	return &result
 }
 
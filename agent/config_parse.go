@@ -86,6 +86,7 @@ func parseConfig(result *Config, list *ast.ObjectList) error {
 		"ui_dir",
 		"log_level",
 		"log_to_stdout",
+		"log_format",
 		"log_file",
 		"pid_file",
 		"bind_addr",
@@ -100,8 +101,10 @@ func parseConfig(result *Config, list *ast.ObjectList) error {
 		"leave_on_interrupt",
 		"leave_on_terminate",
 		"consul",
+		"tls",
 		"http_api_response_headers",
 		"dtle_schema_name",
+		"secrets_key_file",
 	}
 	if err := checkHCLKeys(list, valid); err != nil {
 		return multierror.Prefix(err, "config:")
@@ -120,6 +123,7 @@ func parseConfig(result *Config, list *ast.ObjectList) error {
 	delete(m, "metric")
 	delete(m, "network")
 	delete(m, "consul")
+	delete(m, "tls")
 	delete(m, "http_api_response_headers")
 
 	// Decode the rest
@@ -182,6 +186,13 @@ func parseConfig(result *Config, list *ast.ObjectList) error {
 		}
 	}
 
+	// Parse the TLS config
+	if o := list.Filter("tls"); len(o.Items) > 0 {
+		if err := parseTLSConfig(&result.TLSConfig, o); err != nil {
+			return multierror.Prefix(err, "tls ->")
+		}
+	}
+
 	// Parse out http_api_response_headers fields. These are in HCL as a list so
 	// we need to iterate over them and merge them.
 	if headersO := list.Filter("http_api_response_headers"); len(headersO.Items) > 0 {
@@ -377,9 +388,44 @@ func parseServer(result **ServerConfig, list *ast.ObjectList) error {
 		"num_schedulers",
 		"enabled_schedulers",
 		"heartbeat_grace",
+		"leader_transfer_max_lag",
+		"leader_transfer_timeout",
 		"join",
 		"retry_max",
 		"retry_interval",
+		"rpc_compression",
+		"rpc_compression_threshold",
+		"rpc_max_stream_window",
+		"rpc_max_conns",
+		"rpc_max_conns_per_ip",
+		"rpc_weight",
+		"non_voting_server",
+		"max_raft_entry_size",
+		"rpc_drain_timeout",
+		"rpc_rate_limits",
+		"rpc_rate_limit_per_client",
+		"rpc_overload_threshold",
+		"max_blocking_queries",
+		"job_events_retention",
+		"rpc_max_concurrent",
+		"rpc_dispatch_queue",
+		"rpc_extra_addrs",
+		"rpc_idle_timeout",
+		"rpc_ping_interval",
+		"rpc_max_missed_pings",
+		"rpc_circuit_failure_threshold",
+		"rpc_circuit_failure_window",
+		"rpc_circuit_cooldown",
+		"leader_health_interval",
+		"leader_max_apply_failures",
+		"leader_min_free_disk",
+		"warm_standby_interval",
+		"orphan_reconcile_interval",
+		"rpc_region_timeouts",
+		"rpc_frame_checksums",
+		"rpc_allowed_methods",
+		"rpc_denied_methods",
+		"webhooks",
 	}
 	if err := checkHCLKeys(listVal, valid); err != nil {
 		return err
@@ -389,12 +435,61 @@ func parseServer(result **ServerConfig, list *ast.ObjectList) error {
 	if err := hcl.DecodeObject(&m, listVal); err != nil {
 		return err
 	}
+	delete(m, "rpc_rate_limits")
+	delete(m, "rpc_region_timeouts")
+	delete(m, "rpc_allowed_methods")
+	delete(m, "rpc_denied_methods")
 
 	var config ServerConfig
 	if err := mapstructure.WeakDecode(m, &config); err != nil {
 		return err
 	}
 
+	// Parse out rpc_rate_limits. The methods contain dots so they are
+	// decoded from the object as quoted keys.
+	if limitsO := listVal.Filter("rpc_rate_limits"); len(limitsO.Items) > 0 {
+		for _, o := range limitsO.Elem().Items {
+			var m map[string]interface{}
+			if err := hcl.DecodeObject(&m, o.Val); err != nil {
+				return err
+			}
+			if err := mapstructure.WeakDecode(m, &config.RPCRateLimits); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Parse out rpc_region_timeouts the same way
+	if timeoutsO := listVal.Filter("rpc_region_timeouts"); len(timeoutsO.Items) > 0 {
+		for _, o := range timeoutsO.Elem().Items {
+			var m map[string]interface{}
+			if err := hcl.DecodeObject(&m, o.Val); err != nil {
+				return err
+			}
+			if err := mapstructure.WeakDecode(m, &config.RPCRegionTimeouts); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Parse out the method lists, keyed by listener addresses
+	for key, methods := range map[string]*map[string][]string{
+		"rpc_allowed_methods": &config.RPCAllowedMethods,
+		"rpc_denied_methods":  &config.RPCDeniedMethods,
+	} {
+		if methodsO := listVal.Filter(key); len(methodsO.Items) > 0 {
+			for _, o := range methodsO.Elem().Items {
+				var m map[string]interface{}
+				if err := hcl.DecodeObject(&m, o.Val); err != nil {
+					return err
+				}
+				if err := mapstructure.WeakDecode(m, methods); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
 	*result = &config
 	return nil
 }
@@ -416,6 +511,7 @@ func parseMetric(result **Metric, list *ast.ObjectList) error {
 		"collection_interval",
 		"publish_allocation_metrics",
 		"publish_node_metrics",
+		"prometheus_bind_addr",
 	}
 	if err := checkHCLKeys(listVal, valid); err != nil {
 		return err
@@ -525,6 +621,42 @@ func parseConsulConfig(result **config.ConsulConfig, list *ast.ObjectList) error
 	return nil
 }
 
+func parseTLSConfig(result **config.TLSConfig, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'tls' block allowed")
+	}
+
+	// Get the TLS object
+	listVal := list.Items[0].Val
+
+	// Check for invalid keys
+	valid := []string{
+		"rpc",
+		"verify_server_hostname",
+		"server_name",
+		"ca_file",
+		"cert_file",
+		"key_file",
+	}
+	if err := checkHCLKeys(listVal, valid); err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, listVal); err != nil {
+		return err
+	}
+
+	var tlsConfig config.TLSConfig
+	if err := mapstructure.WeakDecode(m, &tlsConfig); err != nil {
+		return err
+	}
+
+	*result = &tlsConfig
+	return nil
+}
+
 func checkHCLKeys(node ast.Node, valid []string) error {
 	var list *ast.ObjectList
 	switch n := node.(type) {
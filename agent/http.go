@@ -20,7 +20,6 @@ import (
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/ugorji/go/codec"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"strings"
 	log "github.com/actiontech/dtle/internal/logger"
@@ -30,6 +29,10 @@ import (
 const (
 	// ErrInvalidMethod is used if the HTTP method is not supported
 	ErrInvalidMethod = "Invalid method"
+
+	// httpQueryTimeout is how long the queries of the HTTP API may take,
+	// on top of the wait of a blocking query, unless ?timeout is set
+	httpQueryTimeout = time.Minute
 )
 
 var (
@@ -168,6 +171,7 @@ func (s *HTTPServer) registerHandlers() {
 	s.mux.HandleFunc("/v1/self", s.wrap(s.AgentSelfRequest))
 	s.mux.HandleFunc("/v1/join", s.wrap(s.AgentJoinRequest))
 	s.mux.HandleFunc("/v1/agent/force-leave", s.wrap(s.AgentForceLeaveRequest))
+	s.mux.HandleFunc("/v1/agent/log-level", s.wrap(s.AgentLogLevelRequest))
 	s.mux.HandleFunc("/v1/members", s.wrap(s.AgentMembersRequest))
 	s.mux.HandleFunc("/v1/managers", s.wrap(s.AgentServersRequest))
 
@@ -192,7 +196,7 @@ func (s *HTTPServer) registerHandlers() {
 		s.mux.Handle("/", http.StripPrefix("/", http.FileServer(assetFS())))
 	}
 
-	s.mux.Handle("/metrics", promhttp.Handler())
+	s.mux.Handle("/metrics", s.agent.metricsHandler())
 }
 
 // HTTPCodedError is used to provide the HTTP error code
@@ -304,6 +308,17 @@ func setMeta(resp http.ResponseWriter, m *umodel.QueryMeta) {
 	setIndex(resp, m.Index)
 	setLastContact(resp, m.LastContact)
 	setKnownLeader(resp, m.KnownLeader)
+	if m.NextToken != "" {
+		resp.Header().Set("X-Udup-NextToken", m.NextToken)
+	}
+	resp.Header().Set("X-Udup-ServerLoad", strconv.Itoa(m.ServerLoad))
+	if m.RetryAfter > 0 {
+		retryMsec := uint64(m.RetryAfter / time.Millisecond)
+		resp.Header().Set("X-Udup-RetryAfter", strconv.FormatUint(retryMsec, 10))
+	}
+	if m.BlockingLimited {
+		resp.Header().Set("X-Udup-BlockingLimited", "true")
+	}
 }
 
 // setHeaders is used to set canonical response header fields
@@ -338,12 +353,53 @@ func parseWait(resp http.ResponseWriter, req *http.Request, b *umodel.QueryOptio
 	return false
 }
 
-// parseConsistency is used to parse the ?stale query params.
+// parseTimeout is used to parse the ?timeout query param, how long the
+// caller waits for the reply on top of the ?wait of a blocking query. It
+// sets the deadline of the query, defaulting to httpQueryTimeout.
+// Returns true on error
+func parseTimeout(resp http.ResponseWriter, req *http.Request, b *umodel.QueryOptions) bool {
+	timeout := httpQueryTimeout
+	if t := req.URL.Query().Get("timeout"); t != "" {
+		dur, err := time.ParseDuration(t)
+		if err != nil {
+			resp.WriteHeader(400)
+			resp.Write([]byte("Invalid timeout"))
+			return true
+		}
+		timeout = dur
+	}
+	b.SetTimeout(timeout)
+	return false
+}
+
+// parseConsistency is used to parse the ?stale, ?consistent and
+// ?no_leader_wait query params.
 func parseConsistency(req *http.Request, b *umodel.QueryOptions) {
 	query := req.URL.Query()
 	if _, ok := query["stale"]; ok {
 		b.AllowStale = true
 	}
+	if _, ok := query["consistent"]; ok {
+		b.ReadConsistency = umodel.ReadConsistent
+	}
+	if _, ok := query["no_leader_wait"]; ok {
+		b.NoLeaderWait = true
+	}
+}
+
+// parseMaxStale is used to parse the ?max_stale query param
+// Returns true on error
+func parseMaxStale(resp http.ResponseWriter, req *http.Request, b *umodel.QueryOptions) bool {
+	if maxStale := req.URL.Query().Get("max_stale"); maxStale != "" {
+		dur, err := time.ParseDuration(maxStale)
+		if err != nil {
+			resp.WriteHeader(400)
+			resp.Write([]byte("Invalid max stale time"))
+			return true
+		}
+		b.MaxStaleness = dur
+	}
+	return false
 }
 
 // parsePrefix is used to parse the ?prefix query param
@@ -354,6 +410,25 @@ func parsePrefix(req *http.Request, b *umodel.QueryOptions) {
 	}
 }
 
+// parsePagination is used to parse the ?per_page and ?next_token query params
+// Returns true on error
+func parsePagination(resp http.ResponseWriter, req *http.Request, b *umodel.QueryOptions) bool {
+	query := req.URL.Query()
+	if perPage := query.Get("per_page"); perPage != "" {
+		n, err := strconv.ParseInt(perPage, 10, 32)
+		if err != nil || n < 0 {
+			resp.WriteHeader(400)
+			resp.Write([]byte("Invalid per_page"))
+			return true
+		}
+		b.PerPage = int32(n)
+	}
+	if token := query.Get("next_token"); token != "" {
+		b.NextToken = token
+	}
+	return false
+}
+
 // parseRegion is used to parse the ?region query param
 func (s *HTTPServer) parseRegion(req *http.Request, r *string) {
 	if other := req.URL.Query().Get("region"); other != "" {
@@ -367,6 +442,15 @@ func (s *HTTPServer) parseRegion(req *http.Request, r *string) {
 func (s *HTTPServer) parse(resp http.ResponseWriter, req *http.Request, r *string, b *umodel.QueryOptions) bool {
 	s.parseRegion(req, r)
 	parseConsistency(req, b)
+	if parseMaxStale(resp, req, b) {
+		return true
+	}
 	parsePrefix(req, b)
-	return parseWait(resp, req, b)
+	if parsePagination(resp, req, b) {
+		return true
+	}
+	if parseWait(resp, req, b) {
+		return true
+	}
+	return parseTimeout(resp, req, b)
 }
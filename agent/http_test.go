@@ -235,7 +235,7 @@ func TestHTTPServer_wrap(t *testing.T) {
 				addr:     tt.fields.addr,
 			}
 			if got := s.wrap(tt.args.handler); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("HTTPServer.wrap() = %v, want %v", got, tt.want)
+				t.Errorf("HTTPServer.wrap() = %p, want %p", got, tt.want)
 			}
 		})
 	}
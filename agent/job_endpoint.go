@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 
@@ -78,6 +79,9 @@ func (s *HTTPServer) jobInfoRequest(resp http.ResponseWriter, req *http.Request)
 			if "" == driverConfig.ConnectionConfig.Charset {
 				driverConfig.ConnectionConfig.Charset = "utf8"
 			}
+			if err := driverConfig.ConnectionConfig.RegisterTLSConfig(); err != nil {
+				return nil, CodedError(400, err.Error())
+			}
 			uri := driverConfig.ConnectionConfig.GetDBUri()
 			db, err := sql.CreateDB(uri)
 			defer db.Close()
@@ -149,12 +153,27 @@ func (s *HTTPServer) JobSpecificRequest(resp http.ResponseWriter, req *http.Requ
 	case strings.HasSuffix(path, "/pause"):
 		jobName := strings.TrimSuffix(path, "/pause")
 		return s.jobPauseRequest(resp, req, jobName)
+	case strings.HasSuffix(path, "/config"):
+		jobName := strings.TrimSuffix(path, "/config")
+		return s.jobConfigRequest(resp, req, jobName)
+	case strings.HasSuffix(path, "/verify"):
+		jobName := strings.TrimSuffix(path, "/verify")
+		return s.jobVerifyRequest(resp, req, jobName)
+	case strings.HasSuffix(path, "/replay"):
+		jobName := strings.TrimSuffix(path, "/replay")
+		return s.jobReplayRequest(resp, req, jobName)
+	case strings.HasSuffix(path, "/cancel"):
+		jobName := strings.TrimSuffix(path, "/cancel")
+		return s.jobCancelRequest(resp, req, jobName)
 	case strings.HasSuffix(path, "/allocations"):
 		jobName := strings.TrimSuffix(path, "/allocations")
 		return s.jobAllocations(resp, req, jobName)
 	case strings.HasSuffix(path, "/evaluations"):
 		jobName := strings.TrimSuffix(path, "/evaluations")
 		return s.jobEvaluations(resp, req, jobName)
+	case strings.HasSuffix(path, "/events"):
+		jobName := strings.TrimSuffix(path, "/events")
+		return s.jobEvents(resp, req, jobName)
 	default:
 		return s.jobCRUD(resp, req, path)
 	}
@@ -217,6 +236,54 @@ func (s *HTTPServer) jobEvaluations(resp http.ResponseWriter, req *http.Request,
 	return out.Evaluations, nil
 }
 
+// jobEvents returns the last events of the tasks of the job, filtered by
+// the severity, type, since and until query parameters, the times being
+// RFC 3339 ones
+func (s *HTTPServer) jobEvents(resp http.ResponseWriter, req *http.Request,
+	jobName string) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	query := req.URL.Query()
+	args := models.JobEventsRequest{
+		JobID:    jobName,
+		Severity: query.Get("severity"),
+	}
+	for _, types := range query["type"] {
+		for _, tp := range strings.Split(types, ",") {
+			if tp = strings.TrimSpace(tp); tp != "" {
+				args.Types = append(args.Types, tp)
+			}
+		}
+	}
+	for param, t := range map[string]*time.Time{"since": &args.Since, "until": &args.Until} {
+		if raw := query.Get(param); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, CodedError(400, fmt.Sprintf("invalid %s: %v", param, err))
+			}
+			*t = parsed
+		}
+	}
+	if args.Region == "" {
+		args.Region = s.agent.config.Region
+	}
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil
+	}
+
+	var out models.JobEventsResponse
+	if err := s.agent.RPC("Job.Events", &args, &out); err != nil {
+		return nil, err
+	}
+
+	setMeta(resp, &out.QueryMeta)
+	if out.Events == nil {
+		out.Events = make([]*models.JobEvent, 0)
+	}
+	return out.Events, nil
+}
+
 func (s *HTTPServer) jobCRUD(resp http.ResponseWriter, req *http.Request,
 	jobName string) (interface{}, error) {
 	switch req.Method {
@@ -374,14 +441,13 @@ func (s *HTTPServer) jobDelete(resp http.ResponseWriter, req *http.Request,
 }
 
 func (s *HTTPServer) jobResumeRequest(resp http.ResponseWriter, req *http.Request, name string) (interface{}, error) {
-	args := models.JobUpdateStatusRequest{
-		JobID:  name,
-		Status: models.JobStatusRunning,
+	args := models.JobPauseRequest{
+		JobID: name,
 	}
 	s.parseRegion(req, &args.Region)
 
 	var out models.JobResponse
-	if err := s.agent.RPC("Job.UpdateStatus", &args, &out); err != nil {
+	if err := s.agent.RPC("Job.Resume", &args, &out); err != nil {
 		return nil, err
 	}
 	setIndex(resp, out.Index)
@@ -389,14 +455,121 @@ func (s *HTTPServer) jobResumeRequest(resp http.ResponseWriter, req *http.Reques
 }
 
 func (s *HTTPServer) jobPauseRequest(resp http.ResponseWriter, req *http.Request, name string) (interface{}, error) {
-	args := models.JobUpdateStatusRequest{
-		JobID:  name,
-		Status: models.JobStatusPause,
+	args := models.JobPauseRequest{
+		JobID: name,
 	}
 	s.parseRegion(req, &args.Region)
 
 	var out models.JobResponse
-	if err := s.agent.RPC("Job.UpdateStatus", &args, &out); err != nil {
+	if err := s.agent.RPC("Job.Pause", &args, &out); err != nil {
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	return out, nil
+}
+
+func (s *HTTPServer) jobConfigRequest(resp http.ResponseWriter, req *http.Request, name string) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	var job *api.Job
+	if err := decodeBody(req, &job); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	if job == nil || len(job.Tasks) == 0 {
+		return nil, CodedError(400, "Tasks haven't been provided")
+	}
+
+	args := models.JobConfigUpdateRequest{
+		JobID: name,
+	}
+	for _, task := range job.Tasks {
+		t := models.NewTask()
+		ApiTaskToStructsTask(task, t)
+		args.Tasks = append(args.Tasks, t)
+	}
+	s.parseRegion(req, &args.Region)
+
+	var out models.JobConfigUpdateResponse
+	if err := s.agent.RPC("Job.Update", &args, &out); err != nil {
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	if out.Changed == nil {
+		out.Changed = make(map[string][]string)
+	}
+	return out, nil
+}
+
+func (s *HTTPServer) jobVerifyRequest(resp http.ResponseWriter, req *http.Request, name string) (interface{}, error) {
+	var out models.JobVerifyResponse
+	switch req.Method {
+	case "GET":
+		args := models.JobVerifyStatusRequest{
+			JobID: name,
+		}
+		if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+			return nil, nil
+		}
+		if err := s.agent.RPC("Job.VerifyStatus", &args, &out); err != nil {
+			return nil, err
+		}
+	case "POST", "PUT":
+		args := models.JobVerifyRequest{
+			JobID: name,
+		}
+		if chunkSize := req.URL.Query().Get("chunk_size"); chunkSize != "" {
+			var err error
+			if args.ChunkSize, err = strconv.Atoi(chunkSize); err != nil {
+				return nil, CodedError(400, fmt.Sprintf("invalid chunk_size: %v", err))
+			}
+		}
+		s.parseRegion(req, &args.Region)
+		if err := s.agent.RPC("Job.Verify", &args, &out); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	if out.Verification.Tables == nil {
+		out.Verification.Tables = make([]*models.TableVerification, 0)
+	}
+	return out.Verification, nil
+}
+
+func (s *HTTPServer) jobReplayRequest(resp http.ResponseWriter, req *http.Request, name string) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	var args models.JobReplayRequest
+	if err := decodeBody(req, &args); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+	if args.GtidStart == "" || args.GtidStop == "" {
+		return nil, CodedError(400, "GtidStart and GtidStop must be provided")
+	}
+	args.JobID = name
+	s.parseRegion(req, &args.Region)
+
+	var out models.JobReplayResponse
+	if err := s.agent.RPC("Job.Replay", &args, &out); err != nil {
+		return nil, err
+	}
+	setIndex(resp, out.Index)
+	return out, nil
+}
+
+func (s *HTTPServer) jobCancelRequest(resp http.ResponseWriter, req *http.Request, name string) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	args := models.JobCancelRequest{
+		JobID: name,
+	}
+	s.parseRegion(req, &args.Region)
+
+	var out models.JobResponse
+	if err := s.agent.RPC("Job.Cancel", &args, &out); err != nil {
 		return nil, err
 	}
 	setIndex(resp, out.Index)
@@ -450,6 +623,16 @@ func ApiJobToStructJob(job *api.Job, trafficLimit int) *models.Job {
 		JobModifyIndex:    *job.JobModifyIndex,
 	}
 
+	if job.RestartPolicy != nil {
+		j.RestartPolicy = ApiRestartPolicyToStructs(job.RestartPolicy)
+	}
+	if job.CircuitBreaker != nil {
+		j.CircuitBreaker = &models.CircuitBreaker{
+			Errors:        job.CircuitBreaker.Errors,
+			WindowSeconds: job.CircuitBreaker.WindowSeconds,
+		}
+	}
+
 	j.Tasks = make([]*models.Task, len(job.Tasks))
 	cfg := ""
 	for _, task := range job.Tasks {
@@ -477,6 +660,28 @@ func ApiJobToStructJob(job *api.Job, trafficLimit int) *models.Job {
 	return j
 }
 
+// ApiRestartPolicyToStructs returns the restart policy of the API, the
+// values it doesn't set being those of the default policy
+func ApiRestartPolicyToStructs(policy *api.RestartPolicy) *models.RestartPolicy {
+	p := models.NewDefaultRestartPolicy()
+	if policy.Attempts != nil {
+		p.Attempts = *policy.Attempts
+	}
+	if policy.IntervalSeconds != nil {
+		p.IntervalSeconds = *policy.IntervalSeconds
+	}
+	if policy.DelaySeconds != nil {
+		p.DelaySeconds = *policy.DelaySeconds
+	}
+	if policy.MaxDelaySeconds != nil {
+		p.MaxDelaySeconds = *policy.MaxDelaySeconds
+	}
+	if policy.Mode != nil {
+		p.Mode = *policy.Mode
+	}
+	return p
+}
+
 func ApiTaskToStructsTask(apiTask *api.Task, structsTask *models.Task) {
 	structsTask.Type = apiTask.Type
 	structsTask.NodeID = apiTask.NodeID
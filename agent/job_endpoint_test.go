@@ -7,12 +7,12 @@
 package agent
 
 import (
-	"log"
 	"net"
 	"net/http"
 	"reflect"
 	"testing"
 	"github.com/actiontech/dtle/api"
+	log "github.com/actiontech/dtle/internal/logger"
 	"github.com/actiontech/dtle/internal/models"
 )
 
@@ -488,7 +488,8 @@ func TestHTTPServer_jobPauseRequest(t *testing.T) {
 
 func TestApiJobToStructJob(t *testing.T) {
 	type args struct {
-		job *api.Job
+		job          *api.Job
+		trafficLimit int
 	}
 	tests := []struct {
 		name string
@@ -499,7 +500,7 @@ func TestApiJobToStructJob(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := ApiJobToStructJob(tt.args.job); !reflect.DeepEqual(got, tt.want) {
+			if got := ApiJobToStructJob(tt.args.job, tt.args.trafficLimit); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("ApiJobToStructJob() = %v, want %v", got, tt.want)
 			}
 		})
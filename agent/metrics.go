@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+const (
+	// nodeIDLabel and regionLabel are the labels of the node every metric
+	// the agent exposes to Prometheus has
+	nodeIDLabel = "node_id"
+	regionLabel = "region"
+)
+
+// MetricsServer exposes the metrics of the agent to Prometheus, on a
+// listener of its own
+type MetricsServer struct {
+	listener net.Listener
+	logger   *log.Logger
+	addr     string
+}
+
+// NewMetricsServer starts serving the metrics of agent in the Prometheus
+// format on /metrics of addr
+func NewMetricsServer(agent *Agent, addr string) (*MetricsServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start metrics listener: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", agent.metricsHandler())
+
+	srv := &MetricsServer{
+		listener: ln,
+		logger:   agent.logger,
+		addr:     ln.Addr().String(),
+	}
+	go http.Serve(ln, mux)
+	return srv, nil
+}
+
+// Shutdown is used to shutdown the metrics server
+func (s *MetricsServer) Shutdown() {
+	if s != nil {
+		s.logger.Debugf("http: Shutting down metrics server")
+		s.listener.Close()
+	}
+}
+
+// metricsHandler returns the handler of the metrics the Prometheus sink of
+// go-metrics collected, labelled with the node ID and the region of the
+// agent so that a scrape of the whole cluster can aggregate them
+func (a *Agent) metricsHandler() http.Handler {
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := prometheus.DefaultGatherer.Gather()
+		labelMetricFamilies(families, []*dto.LabelPair{
+			{Name: proto.String(nodeIDLabel), Value: proto.String(a.nodeID())},
+			{Name: proto.String(regionLabel), Value: proto.String(a.config.Region)},
+		})
+		return families, err
+	})
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
+
+// nodeID returns the ID of the node of the client of the agent, or the name
+// of the agent if it runs no client
+func (a *Agent) nodeID() string {
+	if a.client != nil {
+		if node := a.client.Node(); node != nil {
+			return node.ID
+		}
+	}
+	return a.config.NodeName
+}
+
+// labelMetricFamilies adds labels to every metric of families that doesn't
+// have a label of the same name yet, keeping the labels sorted by name as
+// the Prometheus format wants them
+func labelMetricFamilies(families []*dto.MetricFamily, labels []*dto.LabelPair) {
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			names := make(map[string]bool, len(metric.Label))
+			for _, label := range metric.Label {
+				names[label.GetName()] = true
+			}
+			for _, label := range labels {
+				if !names[label.GetName()] {
+					metric.Label = append(metric.Label, label)
+				}
+			}
+			sort.Slice(metric.Label, func(i, j int) bool {
+				return metric.Label[i].GetName() < metric.Label[j].GetName()
+			})
+		}
+	}
+}
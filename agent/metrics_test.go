@@ -0,0 +1,40 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLabelMetricFamilies(t *testing.T) {
+	label := func(name, value string) *dto.LabelPair {
+		return &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)}
+	}
+	families := []*dto.MetricFamily{{
+		Name: proto.String("udup_server_rpc_request"),
+		Metric: []*dto.Metric{
+			{},
+			{Label: []*dto.LabelPair{label("job", "job1"), label("region", "east")}},
+		},
+	}}
+
+	labelMetricFamilies(families, []*dto.LabelPair{label("node_id", "node1"), label("region", "global")})
+
+	want := [][]*dto.LabelPair{
+		{label("node_id", "node1"), label("region", "global")},
+		{label("job", "job1"), label("node_id", "node1"), label("region", "east")},
+	}
+	for i, metric := range families[0].Metric {
+		if !reflect.DeepEqual(metric.Label, want[i]) {
+			t.Errorf("labelMetricFamilies() metric %d labels = %v, want %v", i, metric.Label, want[i])
+		}
+	}
+}
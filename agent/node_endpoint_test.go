@@ -7,11 +7,12 @@
 package agent
 
 import (
-	"log"
 	"net"
 	"net/http"
 	"reflect"
 	"testing"
+
+	log "github.com/actiontech/dtle/internal/logger"
 )
 
 func TestHTTPServer_NodesRequest(t *testing.T) {
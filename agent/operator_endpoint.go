@@ -9,20 +9,36 @@ package agent
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/hashicorp/go-msgpack/codec"
 	"github.com/hashicorp/raft"
 
 	"github.com/actiontech/dtle/internal/models"
 )
 
 func (s *HTTPServer) OperatorRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	switch req.URL.Path {
+	case "/v1/operator/webhook/test":
+		return s.OperatorWebhookTest(resp, req)
+	case "/v1/operator/state/export":
+		return s.OperatorStateExport(resp, req)
+	case "/v1/operator/state/import":
+		return s.OperatorStateImport(resp, req)
+	case "/v1/operator/maintenance":
+		return s.OperatorMaintenance(resp, req)
+	}
 	path := strings.TrimPrefix(req.URL.Path, "/v1/operator/raft/")
 	switch {
 	case strings.HasPrefix(path, "configuration"):
 		return s.OperatorRaftConfiguration(resp, req)
 	case strings.HasPrefix(path, "peer"):
 		return s.OperatorRaftPeer(resp, req)
+	case strings.HasPrefix(path, "snapshot"):
+		return s.OperatorRaftSnapshot(resp, req)
+	case strings.HasPrefix(path, "transfer-leader"):
+		return s.OperatorRaftTransferLeader(resp, req)
 	default:
 		return nil, CodedError(404, ErrInvalidMethod)
 	}
@@ -110,14 +126,141 @@ func (s *HTTPServer) OperatorRaftPeer(resp http.ResponseWriter, req *http.Reques
 		return nil, nil
 	}
 
-	var reply struct{}
-	method := "Operator.RaftRemovePeerByID"
 	if hasAddress {
-		method = "Operator.RaftRemovePeerByAddress"
+		var reply struct{}
+		if err := s.agent.RPC("Operator.RaftRemovePeerByAddress", &args, &reply); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	var reply models.RaftRemovePeerResponse
+	if err := s.agent.RPC("Operator.RaftRemovePeerByID", &args, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// OperatorRaftSnapshot is used to force the leader to take a Raft snapshot.
+func (s *HTTPServer) OperatorRaftSnapshot(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, nil
 	}
-	if err := s.agent.RPC(method, &args, &reply); err != nil {
+
+	var args models.RaftSnapshotRequest
+	s.parseRegion(req, &args.Region)
+
+	var reply models.RaftSnapshotResponse
+	if err := s.agent.RPC("Operator.Snapshot", &args, &reply); err != nil {
 		return nil, err
 	}
+	return reply, nil
+}
 
+// OperatorRaftTransferLeader is used to hand the leadership to the voter of
+// ?id, or to the one the least behind if it isn't set.
+func (s *HTTPServer) OperatorRaftTransferLeader(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, nil
+	}
+
+	params := req.URL.Query()
+	args := models.LeadershipTransferRequest{
+		ID:     raft.ServerID(params.Get("id")),
+		Reason: params.Get("reason"),
+	}
+	s.parseRegion(req, &args.Region)
+
+	var reply models.LeadershipTransferResponse
+	if err := s.agent.RPC("Operator.LeadershipTransfer", &args, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// OperatorWebhookTest sends a test notification to the webhooks of the
+// leader
+func (s *HTTPServer) OperatorWebhookTest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, nil
+	}
+
+	var args models.WebhookTestRequest
+	s.parseRegion(req, &args.Region)
+
+	var reply models.WebhookTestResponse
+	if err := s.agent.RPC("Operator.TestWebhook", &args, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// OperatorStateExport streams a state export of the server of the agent,
+// in the format of Operator.StateExport. A failure once the export started
+// ends it with a frame carrying the error.
+func (s *HTTPServer) OperatorStateExport(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	srv := s.agent.Server()
+	if srv == nil {
+		return nil, CodedError(501, ErrInvalidMethod)
+	}
+
+	var args models.StateExportRequest
+	if s.parse(resp, req, &args.Region, &args.QueryOptions) {
+		return nil, nil
+	}
+	resp.Header().Set("Content-Type", "application/octet-stream")
+	if err := srv.StateExport(req.Context(), &args, resp); err != nil {
+		s.logger.Errorf("http: state export failed: %v", err)
+		codec.NewEncoder(resp, models.HashiMsgpackHandle).Encode(&models.StateExportFrame{Error: err.Error()})
+	}
 	return nil, nil
 }
+
+// OperatorStateImport restores the jobs and orders of the state export in
+// the body of the request into the cluster, which must have none
+func (s *HTTPServer) OperatorStateImport(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	export, err := models.ReadStateExport(req.Body)
+	if err != nil {
+		return nil, CodedError(400, fmt.Sprintf("invalid state export: %v", err))
+	}
+	args := models.StateImportRequest{Jobs: export.Jobs, Orders: export.Orders}
+	s.parseRegion(req, &args.Region)
+
+	var reply models.StateImportResponse
+	if err := s.agent.RPC("Operator.StateImport", &args, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// OperatorMaintenance enters the maintenance mode of the cluster with
+// ?enable=true, with an optional ?reason, or leaves it with ?enable=false
+func (s *HTTPServer) OperatorMaintenance(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	params := req.URL.Query()
+	enable, err := strconv.ParseBool(params.Get("enable"))
+	if err != nil {
+		return nil, CodedError(400, "Must specify ?enable=true or ?enable=false")
+	}
+	args := models.MaintenanceModeRequest{Enabled: enable, Reason: params.Get("reason")}
+	s.parseRegion(req, &args.Region)
+
+	var reply models.MaintenanceModeResponse
+	if err := s.agent.RPC("Operator.MaintenanceMode", &args, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
@@ -73,6 +73,32 @@ func (a *Allocations) Stats(alloc *Allocation, q *QueryOptions) (*AllocStatistic
 	return &resp, err
 }
 
+// Throttle changes the rates the tasks of the running alloc write at
+func (a *Allocations) Throttle(alloc *Allocation, req *ThrottleRequest, q *WriteOptions) error {
+	node, _, err := a.client.Nodes().Info(alloc.NodeID, nil)
+	if err != nil {
+		return err
+	}
+	if node.Status == "down" {
+		return NodeDownErr
+	}
+	if node.HTTPAddr == "" {
+		return fmt.Errorf("http addr of the node where alloc %q is running is not advertised", alloc.ID)
+	}
+	client, err := NewClient(a.client.config.CopyConfig(node.HTTPAddr))
+	if err != nil {
+		return err
+	}
+	_, err = client.write("/v1/agent/allocation/"+alloc.ID+"/throttle", req, nil, q)
+	return err
+}
+
+// ThrottleRequest holds the rates a task writes at, 0 not to limit them
+type ThrottleRequest struct {
+	BytesPerSecond int64
+	RowsPerSecond  int64
+}
+
 func (a *Allocations) GC(alloc *Allocation, q *QueryOptions) error {
 	node, _, err := a.client.Nodes().Info(alloc.NodeID, q)
 	if err != nil {
@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/actiontech/dtle/internal"
 	"github.com/actiontech/dtle/internal/models"
@@ -132,6 +133,48 @@ func (j *Jobs) Evaluations(jobID string, q *QueryOptions) ([]*Evaluation, *Query
 	return resp, qm, nil
 }
 
+// JobEventsFilter filters the events of a job: the lowest severity, the
+// types and the times of the events, each unless empty
+type JobEventsFilter struct {
+	Severity string
+	Types    []string
+	Since    time.Time
+	Until    time.Time
+}
+
+// Events is used to query the last events of the tasks of the given job
+// ID, the oldest first. With q.WaitIndex it waits for new events.
+func (j *Jobs) Events(jobID string, filter *JobEventsFilter, q *QueryOptions) ([]*models.JobEvent, *QueryMeta, error) {
+	var resp []*models.JobEvent
+	u, err := url.Parse("/v1/job/" + jobID + "/events")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if filter != nil {
+		v := u.Query()
+		if filter.Severity != "" {
+			v.Add("severity", filter.Severity)
+		}
+		for _, tp := range filter.Types {
+			v.Add("type", tp)
+		}
+		if !filter.Since.IsZero() {
+			v.Add("since", filter.Since.Format(time.RFC3339))
+		}
+		if !filter.Until.IsZero() {
+			v.Add("until", filter.Until.Format(time.RFC3339))
+		}
+		u.RawQuery = v.Encode()
+	}
+
+	qm, err := j.client.query(u.String(), &resp, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, qm, nil
+}
+
 // Deregister is used to remove an existing job.
 func (j *Jobs) Deregister(jobID string, q *WriteOptions) (string, *WriteMeta, error) {
 	var resp deregisterJobResponse
@@ -189,6 +232,8 @@ type Job struct {
 	Type              *string
 	Datacenters       []string
 	Tasks             []*Task
+	RestartPolicy     *RestartPolicy
+	CircuitBreaker    *CircuitBreaker
 	Status            *string
 	StatusDescription *string
 	EnforceIndex      bool
@@ -197,6 +242,23 @@ type Job struct {
 	JobModifyIndex    *uint64
 }
 
+// RestartPolicy decides how the tasks of a job are restarted when they fail.
+// The values not set are those of the default policy.
+type RestartPolicy struct {
+	Attempts        *int
+	IntervalSeconds *int
+	DelaySeconds    *int
+	MaxDelaySeconds *int
+	Mode            *string
+}
+
+// CircuitBreaker pauses a job whose tasks failed Errors times within
+// WindowSeconds, until it is resumed.
+type CircuitBreaker struct {
+	Errors        int
+	WindowSeconds int
+}
+
 func (j *Job) Canonicalize() {
 	if j.ID == nil {
 		j.ID = internal.StringToPtr(models.GenerateUUID())
@@ -291,10 +353,30 @@ type JobValidateResponse struct {
 	// ValidationErrors is a list of validation errors
 	ValidationErrors []string
 
+	// ValidationTasks is the report of the checks run for each task
+	ValidationTasks []*TaskValidateResponse
+
+	// Valid is true if every check of every task passed
+	Valid bool
+
 	// Error is a string version of any error that may have occured
 	Error string
 }
 
+// TaskValidateResponse is the report of the checks run for a task
+type TaskValidateResponse struct {
+	Type   string
+	Checks []*ValidateCheck
+}
+
+// ValidateCheck is the outcome of a check run before a task starts
+type ValidateCheck struct {
+	Name     string
+	Success  bool
+	Detail   string
+	Warnings []string
+}
+
 // JobUpdateRequest is used to update a job
 type JobRegisterRequest struct {
 	Job *Job
@@ -6,6 +6,12 @@
 
 package api
 
+import (
+	"strconv"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
 // Operator can be used to perform low-level operator tasks for Nomad.
 type Operator struct {
 	c *Client
@@ -38,6 +44,13 @@ type RaftServer struct {
 	// it's a non-voting server, which will be added in a future release of
 	// Nomad.
 	Voter bool
+
+	// Suffrage is the voting status of the server: "voter", "nonvoter"
+	// or "staging".
+	Suffrage string
+
+	// Datacenter is the datacenter of the server, if it is known.
+	Datacenter string
 }
 
 // RaftConfigration is returned when querying for the current Raft configuration.
@@ -111,3 +124,96 @@ func (op *Operator) RaftRemovePeerByID(id string, q *WriteOptions) error {
 	resp.Body.Close()
 	return nil
 }
+
+// RaftSnapshot is returned once the leader took a Raft snapshot.
+type RaftSnapshot struct {
+	// Index is the last Raft index included in the snapshot.
+	Index uint64
+}
+
+// RaftSnapshot is used to force the leader to take a Raft snapshot, which
+// compacts the Raft log.
+func (op *Operator) RaftSnapshot(q *WriteOptions) (*RaftSnapshot, error) {
+	r, err := op.c.newRequest("PUT", "/v1/operator/raft/snapshot")
+	if err != nil {
+		return nil, err
+	}
+	r.setWriteOptions(q)
+
+	_, resp, err := requireOK(op.c.doRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out RaftSnapshot
+	if err := decodeBody(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LeadershipTransfer is returned once another voter won the leadership.
+type LeadershipTransfer struct {
+	// OldLeader and NewLeader are the Raft addresses of the leader before
+	// and after the transfer.
+	OldLeader string
+	NewLeader string
+}
+
+// RaftTransferLeader is used to hand the leadership to the voter of the
+// given ID, or to the one the least behind the leader if it is empty, so
+// the leader can be stopped without waiting for an election.
+func (op *Operator) RaftTransferLeader(id, reason string, q *WriteOptions) (*LeadershipTransfer, error) {
+	r, err := op.c.newRequest("PUT", "/v1/operator/raft/transfer-leader")
+	if err != nil {
+		return nil, err
+	}
+	r.setWriteOptions(q)
+
+	if id != "" {
+		r.params.Set("id", id)
+	}
+	if reason != "" {
+		r.params.Set("reason", reason)
+	}
+
+	_, resp, err := requireOK(op.c.doRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out LeadershipTransfer
+	if err := decodeBody(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MaintenanceMode enters the maintenance mode of the cluster, pausing its
+// jobs until it is left, or leaves it, resuming them.
+func (op *Operator) MaintenanceMode(enable bool, reason string, q *WriteOptions) (*models.MaintenanceModeResponse, error) {
+	r, err := op.c.newRequest("PUT", "/v1/operator/maintenance")
+	if err != nil {
+		return nil, err
+	}
+	r.setWriteOptions(q)
+
+	r.params.Set("enable", strconv.FormatBool(enable))
+	if reason != "" {
+		r.params.Set("reason", reason)
+	}
+
+	_, resp, err := requireOK(op.c.doRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out models.MaintenanceModeResponse
+	if err := decodeBody(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -32,6 +32,14 @@ type QueryOptions struct {
 	// a read. This allows for lower latency and higher throughput
 	AllowStale bool
 
+	// MaxStaleness makes a follower serving an AllowStale read forward it
+	// to the leader if it didn't hear from the leader for longer
+	MaxStaleness time.Duration
+
+	// RequireConsistent lets a follower serve the read once it caught up
+	// with the leader, so the result is as fresh as a read on the leader.
+	RequireConsistent bool
+
 	// WaitIndex is used to enable a blocking query. Waits
 	// until the timeout or the next index is reached
 	WaitIndex uint64
@@ -43,6 +51,18 @@ type QueryOptions struct {
 	// If set, used as prefix for resource list searches
 	Prefix string
 
+	// NoLeaderWait makes the query fail right away when there is no
+	// cluster leader instead of waiting for one to be elected.
+	NoLeaderWait bool
+
+	// PerPage is the number of entries to be returned in a list query.
+	// Zero returns all entries.
+	PerPage int32
+
+	// NextToken is the token returned by a previous list query to fetch
+	// the following page.
+	NextToken string
+
 	// Token is used to provide a per-request ACL token
 	// which overrides the agent's default token.
 	Token string
@@ -73,6 +93,22 @@ type QueryMeta struct {
 
 	// How long did the request take
 	RequestTime time.Duration
+
+	// NextToken is used to fetch the next page of a paginated list query.
+	// It is empty when there are no more entries.
+	NextToken string
+
+	// ServerLoad is the number of requests the server was busy with
+	ServerLoad int
+
+	// RetryAfter is set when the server is overloaded to how long the
+	// client should wait before sending its next request
+	RetryAfter time.Duration
+
+	// BlockingLimited is set if the server had too many blocking queries
+	// to wait for a change, the query returned right away and should be
+	// retried
+	BlockingLimited bool
 }
 
 // WriteMeta is used to return meta data about a write
@@ -210,6 +246,12 @@ func (r *request) setQueryOptions(q *QueryOptions) {
 	if q.AllowStale {
 		r.params.Set("stale", "")
 	}
+	if q.MaxStaleness != 0 {
+		r.params.Set("max_stale", durToMsec(q.MaxStaleness))
+	}
+	if q.RequireConsistent {
+		r.params.Set("consistent", "")
+	}
 	if q.WaitIndex != 0 {
 		r.params.Set("index", strconv.FormatUint(q.WaitIndex, 10))
 	}
@@ -219,6 +261,15 @@ func (r *request) setQueryOptions(q *QueryOptions) {
 	if q.Prefix != "" {
 		r.params.Set("prefix", q.Prefix)
 	}
+	if q.NoLeaderWait {
+		r.params.Set("no_leader_wait", "")
+	}
+	if q.PerPage != 0 {
+		r.params.Set("per_page", strconv.Itoa(int(q.PerPage)))
+	}
+	if q.NextToken != "" {
+		r.params.Set("next_token", q.NextToken)
+	}
 	if q.Token != "" {
 		r.params.Set("X-Udup-Token", q.Token)
 	}
@@ -486,6 +537,29 @@ func parseQueryMeta(resp *http.Response, q *QueryMeta) error {
 	default:
 		q.KnownLeader = false
 	}
+
+	// Parse the X-Udup-NextToken
+	q.NextToken = header.Get("X-Udup-NextToken")
+
+	// Parse the X-Udup-ServerLoad and X-Udup-RetryAfter, older servers
+	// don't send them
+	if raw := header.Get("X-Udup-ServerLoad"); raw != "" {
+		load, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("Failed to parse X-Udup-ServerLoad: %v", err)
+		}
+		q.ServerLoad = load
+	}
+	if raw := header.Get("X-Udup-RetryAfter"); raw != "" {
+		retry, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Failed to parse X-Udup-RetryAfter: %v", err)
+		}
+		q.RetryAfter = time.Duration(retry) * time.Millisecond
+	}
+
+	// Parse the X-Udup-BlockingLimited
+	q.BlockingLimited = header.Get("X-Udup-BlockingLimited") == "true"
 	return nil
 }
 
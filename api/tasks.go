@@ -67,8 +67,10 @@ type TableStats struct {
 }
 
 type DelayCount struct {
-	Num  uint64
-	Time uint64
+	Num              uint64
+	Time             uint64
+	LagSeconds       float64
+	ThrottledSeconds float64
 }
 
 type ThroughputStat struct {
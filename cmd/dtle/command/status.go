@@ -257,7 +257,7 @@ func (c *StatusCommand) outputJobSummary(client *api.Client, job *api.Job) error
 
 	for idx, task := range summary.Tasks {
 		summaries[idx+1] = fmt.Sprintf("%s|%s",
-			task, task.Status,
+			task.Type, task.Status,
 		)
 	}
 	c.Ui.Output(formatList(summaries))
@@ -427,6 +427,7 @@ func (r *Allocator) Run() {
 	// taskDestroyEvent contains an event that caused the destroyment of a task
 	// in the allocation.
 	var taskDestroyEvent *models.TaskEvent
+	paused := false
 
 OUTER:
 	// Wait for updates
@@ -435,9 +436,26 @@ OUTER:
 		case update := <-r.updateCh:
 			// Store the updated allocation.
 			r.allocLock.Lock()
+			prev := r.alloc
 			r.alloc = update
 			r.allocLock.Unlock()
 
+			r.reload(prev, update)
+
+			// A paused allocation keeps its tasks, they stop their work
+			// until resumed
+			if update.DesiredStatus == models.AllocDesiredStatusPause {
+				if !paused {
+					r.setPaused(true)
+					paused = true
+				}
+				continue
+			}
+			if paused && update.DesiredStatus == models.AllocDesiredStatusRun {
+				r.setPaused(false)
+				paused = false
+			}
+
 			// Check if we're in a terminal status
 			if update.ClientTerminalStatus() {
 				taskDestroyEvent = models.NewTaskEvent(models.TaskKilled)
@@ -507,6 +525,108 @@ func (r *Allocator) StatsReporter() AllocStatsReporter {
 	return r
 }
 
+// SetThrottle changes the rates the tasks of the allocation that can be
+// throttled write at
+func (r *Allocator) SetThrottle(bytesPerSecond, rowsPerSecond int64) error {
+	throttled := false
+	for _, tr := range r.getWorkers() {
+		ok, err := tr.SetThrottle(bytesPerSecond, rowsPerSecond)
+		if err != nil {
+			return err
+		}
+		throttled = throttled || ok
+	}
+	if !throttled {
+		return fmt.Errorf("alloc '%s' runs no task that can be throttled", r.Alloc().ID)
+	}
+	return nil
+}
+
+// Reloads tells whether the tasks of the allocation reload the job of
+// update as they run, its configuration differing only in fields they
+// reload
+func (r *Allocator) Reloads(update *models.Allocation) bool {
+	changes, err := configChanges(r.Alloc(), update)
+	if err != nil {
+		return false
+	}
+	for _, fields := range changes {
+		if len(fields) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// reload has the tasks of the allocation reload the fields of their
+// configuration the job of update changed
+func (r *Allocator) reload(prev, update *models.Allocation) {
+	changes, err := configChanges(prev, update)
+	if err != nil {
+		// The tasks are restarted with the new job
+		r.logger.Debugf("agent: Alloc '%s' can't reload its job: %v", update.ID, err)
+		return
+	}
+	for _, tr := range r.getWorkers() {
+		fields := changes[tr.task.Type]
+		if len(fields) == 0 {
+			continue
+		}
+		if err := tr.Reload(update.Job.LookupTask(tr.task.Type), fields); err != nil {
+			r.logger.Errorf("agent: Failed to reload task %q of alloc '%s': %v",
+				tr.task.Type, update.ID, err)
+		}
+	}
+}
+
+// configChanges returns the fields of the configuration of the tasks, by
+// type, the job of update changed from the one of prev
+func configChanges(prev, update *models.Allocation) (map[string][]string, error) {
+	if prev.Job == nil || update.Job == nil || prev.Job.JobModifyIndex == update.Job.JobModifyIndex {
+		return nil, nil
+	}
+	changes := make(map[string][]string)
+	for _, t := range update.Job.Tasks {
+		from := prev.Job.LookupTask(t.Type)
+		if from == nil {
+			return nil, fmt.Errorf("task %q was added", t.Type)
+		}
+		fields, err := models.ConfigChanges(t.Type, from.Config, t.Config)
+		if err != nil {
+			return nil, err
+		}
+		changes[t.Type] = fields
+	}
+	return changes, nil
+}
+
+// Paused tells whether the allocation should be paused
+func (r *Allocator) Paused() bool {
+	r.allocLock.Lock()
+	defer r.allocLock.Unlock()
+	return r.alloc.DesiredStatus == models.AllocDesiredStatusPause
+}
+
+// setPaused pauses or resumes the tasks of the allocation that can be
+// paused. The others go on, held back by the paused ones.
+func (r *Allocator) setPaused(paused bool) {
+	for _, tr := range r.getWorkers() {
+		if _, err := tr.SetPaused(paused); err != nil {
+			r.logger.Errorf("agent: Failed to pause or resume task %q of alloc '%s': %v",
+				tr.task.Type, r.alloc.ID, err)
+		}
+	}
+}
+
+// TaskMetrics returns the metrics of the tasks of the allocation
+func (r *Allocator) TaskMetrics() []*models.TaskMetrics {
+	var metrics []*models.TaskMetrics
+	for _, tr := range r.getWorkers() {
+		metrics = append(metrics, tr.TaskMetrics())
+	}
+	return metrics
+}
+
 // getWorkers is a helper that returns a copy of the task runners list using
 // the taskLock.
 func (r *Allocator) getWorkers() []*Worker {
@@ -575,6 +695,13 @@ func (r *Allocator) Destroy() {
 	close(r.destroyCh)
 }
 
+// Destroyed returns whether the allocation context was destroyed
+func (r *Allocator) Destroyed() bool {
+	r.destroyLock.Lock()
+	defer r.destroyLock.Unlock()
+	return r.destroy
+}
+
 // WaitCh returns a channel to wait for termination
 func (r *Allocator) WaitCh() <-chan struct{} {
 	return r.waitCh
@@ -0,0 +1,102 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// maxBreakerMessage is how much of an error the pattern of a tripped
+// circuit breaker tells
+const maxBreakerMessage = 200
+
+// circuitBreaker counts the failures of a task within the window of the
+// circuit breaker of its job, and trips when there are too many of them
+type circuitBreaker struct {
+	policy   *models.CircuitBreaker
+	failures []breakerFailure
+	lock     sync.Mutex
+}
+
+// breakerFailure is a failure of the task, at the time it happened
+type breakerFailure struct {
+	at  time.Time
+	err string
+}
+
+// newCircuitBreaker returns the circuit breaker of policy, nil never
+// tripping if policy is nil
+func newCircuitBreaker(policy *models.CircuitBreaker) *circuitBreaker {
+	if policy == nil {
+		return nil
+	}
+	return &circuitBreaker{policy: policy}
+}
+
+// fail records the failure err of the task at now. It returns whether the
+// breaker tripped and, if it did, the pattern of the failures of the window,
+// which are then forgotten.
+func (b *circuitBreaker) fail(now time.Time, err string) (bool, string) {
+	if b == nil {
+		return false, ""
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	window := time.Duration(b.policy.WindowSeconds) * time.Second
+	kept := b.failures[:0]
+	for _, f := range b.failures {
+		if now.Sub(f.at) < window {
+			kept = append(kept, f)
+		}
+	}
+	b.failures = append(kept, breakerFailure{at: now, err: err})
+	if len(b.failures) < b.policy.Errors {
+		return false, ""
+	}
+
+	pattern := b.pattern(window)
+	b.failures = nil
+	return true, pattern
+}
+
+// reset forgets the failures, as the job was resumed
+func (b *circuitBreaker) reset() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failures = nil
+}
+
+// pattern tells the failures of the window: how many there were, and how
+// many times each error occurred, in the order they first did
+func (b *circuitBreaker) pattern(window time.Duration) string {
+	var errs []string
+	counts := make(map[string]int)
+	for _, f := range b.failures {
+		err := f.err
+		if len(err) > maxBreakerMessage {
+			err = err[:maxBreakerMessage] + "..."
+		}
+		if counts[err] == 0 {
+			errs = append(errs, err)
+		}
+		counts[err]++
+	}
+	parts := make([]string, len(errs))
+	for i, err := range errs {
+		parts[i] = fmt.Sprintf("%d x %q", counts[err], err)
+	}
+	return fmt.Sprintf("%d errors within %v: %s", len(b.failures), window, strings.Join(parts, "; "))
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestCircuitBreaker_fail(t *testing.T) {
+	if tripped, _ := newCircuitBreaker(nil).fail(time.Now(), "Error 1213: Deadlock found"); tripped {
+		t.Fatalf("newCircuitBreaker(nil).fail() tripped")
+	}
+
+	b := newCircuitBreaker(&models.CircuitBreaker{Errors: 3, WindowSeconds: 60})
+	start := time.Now()
+	fail := func(after time.Duration, err string) (bool, string) {
+		return b.fail(start.Add(after), err)
+	}
+
+	// The first failure is out of the window once the third one happens
+	for i, after := range []time.Duration{0, 30 * time.Second, 61 * time.Second} {
+		if tripped, _ := fail(after, "Error 1213: Deadlock found"); tripped {
+			t.Fatalf("circuitBreaker.fail() %d tripped out of the window", i+1)
+		}
+	}
+	tripped, pattern := fail(62*time.Second, "Error 1205: Lock wait timeout exceeded")
+	if !tripped {
+		t.Fatalf("circuitBreaker.fail() didn't trip on 3 errors within 60s")
+	}
+	want := `3 errors within 1m0s: 2 x "Error 1213: Deadlock found"; 1 x "Error 1205: Lock wait timeout exceeded"`
+	if pattern != want {
+		t.Errorf("circuitBreaker.fail() pattern = %q, want %q", pattern, want)
+	}
+
+	// The failures start over once it tripped, or was reset
+	fail(63*time.Second, "Error 1213: Deadlock found")
+	fail(64*time.Second, "Error 1213: Deadlock found")
+	b.reset()
+	if tripped, _ := fail(65*time.Second, "Error 1213: Deadlock found"); tripped {
+		t.Errorf("circuitBreaker.fail() tripped on failures before a reset")
+	}
+}
@@ -45,6 +45,11 @@ const (
 	// open to a server
 	clientMaxStreams = 2
 
+	// clientRPCTimeout is how long the client waits for the reply of an
+	// RPC, across the servers it tries, on top of the time a blocking query
+	// may wait. The servers give up on the RPCs past it.
+	clientRPCTimeout = 2 * time.Minute
+
 	// registerRetryIntv is minimum interval on which we retry
 	// registration. We pick a value between this and 2x this.
 	registerRetryIntv = 15 * time.Second
@@ -74,6 +79,14 @@ const (
 	// allocSyncRetryIntv is the interval on which we retry updating
 	// the status of the allocation
 	allocSyncRetryIntv = 5 * time.Second
+
+	// metricsSyncIntv is how often the metrics of the tasks are reported
+	// to the servers
+	metricsSyncIntv = 10 * time.Second
+
+	// cancelReconcileIntv is how often the client looks for the allocations
+	// it still runs of jobs which were cancelled
+	cancelReconcileIntv = 30 * time.Second
 )
 
 // ClientStatsReporter exposes all the APIs related to resource usage of a Udup
@@ -176,11 +189,17 @@ var (
 
 // NewClient is used to create a new client from the given configuration
 func NewClient(cfg *config.ClientConfig, logger *ulog.Logger) (*Client, error) {
+	// Configure TLS for connections to the servers
+	tlsWrap, err := cfg.TLSConfig.OutgoingTLSWrapper()
+	if err != nil {
+		return nil, err
+	}
+
 	// Create the client
 	c := &Client{
 		config:              cfg,
 		start:               time.Now(),
-		connPool:            server.NewPool(cfg.LogOutput, clientRPCCache, clientMaxStreams),
+		connPool:            server.NewPool(cfg.LogOutput, clientRPCCache, clientMaxStreams, tlsWrap),
 		logger:              logger,
 		allocs:              make(map[string]*Allocator),
 		blockedAllocations:  make(map[string]*models.Allocation),
@@ -236,6 +255,12 @@ func NewClient(cfg *config.ClientConfig, logger *ulog.Logger) (*Client, error) {
 	// Begin syncing allocations to the server
 	go c.allocSync()
 
+	// Begin reporting the metrics of the tasks to the servers
+	go c.metricsSync()
+
+	// Begin killing the allocations of cancelled jobs left running
+	go c.cancelReconcile()
+
 	// Start the client!
 	go c.run()
 
@@ -318,6 +343,7 @@ func (c *Client) RPC(method string, args interface{}, reply interface{}) error {
 	if len(servers) == 0 {
 		return noServersErr
 	}
+	models.SetRequestTimeout(args, clientRPCTimeout)
 
 	var mErr multierror.Error
 	for _, s := range servers {
@@ -381,6 +407,17 @@ func (c *Client) GetAllocStats(allocID string) (AllocStatsReporter, error) {
 	return ar.StatsReporter(), nil
 }
 
+// SetAllocThrottle changes the rates the tasks of the alloc write at
+func (c *Client) SetAllocThrottle(allocID string, bytesPerSecond, rowsPerSecond int64) error {
+	c.allocLock.RLock()
+	ar, ok := c.allocs[allocID]
+	c.allocLock.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown allocation ID %q", allocID)
+	}
+	return ar.SetThrottle(bytesPerSecond, rowsPerSecond)
+}
+
 // GetClientAlloc returns the allocation from the client
 func (c *Client) GetClientAlloc(allocID string) (*models.Allocation, error) {
 	all := c.allAllocs()
@@ -552,7 +589,7 @@ func (c *Client) setupNatsServer() error {
 // setupDrivers is used to find the available drivers
 func (c *Client) setupDrivers() error {
 	var avail []string
-	driverCtx := driver.NewDriverContext("", "", c.config, c.config.Node, c.logger)
+	driverCtx := driver.NewDriverContext("", "", c.config, c.config.Node, c.logger, nil)
 	for name := range driver.BuiltinDrivers {
 		_, err := driver.NewDriver(name, driverCtx)
 		if err != nil {
@@ -838,6 +875,14 @@ func (c *Client) allocSync() {
 			aUpdates[alloc.ID] = alloc
 
 		case update := <-c.workUpdates:
+			if prev, ok := jUpdates[update.JobID]; ok && update.Gtid == "" && update.DumpCheckpoint == nil {
+				// Keep the progress the other task of the job sent
+				update.Gtid, update.DumpCheckpoint = prev.Gtid, prev.DumpCheckpoint
+			}
+			if prev, ok := jUpdates[update.JobID]; ok && prev.Pause {
+				// Keep the request of a tripped circuit breaker
+				update.Pause = true
+			}
 			jUpdates[update.JobID] = update
 
 		case <-syncTicker.C:
@@ -902,6 +947,89 @@ func (c *Client) allocSync() {
 	}
 }
 
+// metricsSync is a long lived function that reports the metrics of the
+// tasks of the allocations to the servers
+func (c *Client) metricsSync() {
+	ticker := time.NewTicker(metricsSyncIntv)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.shutdownCh:
+			return
+		case <-ticker.C:
+			var sync []*models.TaskMetrics
+			for _, ar := range c.getAllocRunners() {
+				if ar.Alloc().TerminalStatus() {
+					continue
+				}
+				sync = append(sync, ar.TaskMetrics()...)
+			}
+			if len(sync) == 0 {
+				continue
+			}
+
+			args := models.MetricsUpdateRequest{
+				Metrics:      sync,
+				WriteRequest: models.WriteRequest{Region: c.Region()},
+			}
+			var resp models.GenericResponse
+			if err := c.RPC("Node.UpdateMetrics", &args, &resp); err != nil {
+				c.logger.Warnf("agent: Failed to report the metrics of the tasks: %v", err)
+			}
+		}
+	}
+}
+
+// cancelReconcile is a long lived function that kills the allocations of
+// jobs cancelled by the servers the client missed the stop of
+func (c *Client) cancelReconcile() {
+	ticker := time.NewTicker(cancelReconcileIntv)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.shutdownCh:
+			return
+		case <-ticker.C:
+			c.killCancelled()
+		}
+	}
+}
+
+// killCancelled destroys the allocations still running of the jobs the
+// servers marked cancelled
+func (c *Client) killCancelled() {
+	jobs := make(map[string][]*Allocator)
+	for _, ar := range c.getAllocRunners() {
+		alloc := ar.Alloc()
+		if alloc.TerminalStatus() || ar.Destroyed() {
+			continue
+		}
+		jobs[alloc.JobID] = append(jobs[alloc.JobID], ar)
+	}
+
+	for jobID, runners := range jobs {
+		args := models.JobSpecificRequest{
+			JobID: jobID,
+			QueryOptions: models.QueryOptions{
+				Region:     c.Region(),
+				AllowStale: true,
+			},
+		}
+		var resp models.SingleJobResponse
+		if err := c.RPC("Job.GetJob", &args, &resp); err != nil {
+			c.logger.Warnf("agent: Failed to look for cancelled jobs: %v", err)
+			return
+		}
+		if resp.Job == nil || resp.Job.Status != models.JobStatusCancelled {
+			continue
+		}
+		for _, ar := range runners {
+			c.logger.Warnf("agent: Killing alloc '%s' of cancelled job '%s'", ar.Alloc().ID, jobID)
+			ar.Destroy()
+		}
+	}
+}
+
 type jobUpdates struct {
 	pulled map[string]string
 }
@@ -1390,6 +1518,18 @@ func (c *Client) updateAlloc(exist, update *models.Allocation) error {
 func (c *Client) resumeAlloc(alloc *models.Allocation) error {
 	c.allocLock.Lock()
 	ar, ok := c.allocs[alloc.ID]
+	// A paused allocation goes on with its tasks from where they stopped
+	if ok && ar.Paused() {
+		c.allocLock.Unlock()
+		ar.Update(alloc)
+		return nil
+	}
+	// A running allocation reloads the configuration of its job
+	if ok && ar.Reloads(alloc) {
+		c.allocLock.Unlock()
+		ar.Update(alloc)
+		return nil
+	}
 	for _, tr := range ar.tasks {
 		tr.killTask(nil)
 	}
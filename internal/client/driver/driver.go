@@ -60,13 +60,17 @@ type Driver interface {
 // node attributes into a Driver without having to change the Driver interface
 // each time we do it. Used in conjection with Factory, above.
 type DriverContext struct {
-	taskName string
-	allocID  string
-	config   *uconf.ClientConfig
-	logger   *log.Logger
-	node     *models.Node
+	taskName  string
+	allocID   string
+	config    *uconf.ClientConfig
+	logger    *log.Logger
+	node      *models.Node
+	emitEvent LogEventFn
 }
 
+// LogEventFn is a callback which allows Drivers to emit task events.
+type LogEventFn func(message string, args ...interface{})
+
 // NewEmptyDriverContext returns a DriverContext with all fields set to their
 // zero value.
 func NewEmptyDriverContext() *DriverContext {
@@ -78,13 +82,14 @@ func NewEmptyDriverContext() *DriverContext {
 // private to the driver. If we want to change this later we can gorename all of
 // the fields in DriverContext.
 func NewDriverContext(taskName, allocID string, config *uconf.ClientConfig, node *models.Node,
-	logger *log.Logger) *DriverContext {
+	logger *log.Logger, eventEmitter LogEventFn) *DriverContext {
 	return &DriverContext{
-		taskName: taskName,
-		allocID:  allocID,
-		config:   config,
-		node:     node,
-		logger:   logger,
+		taskName:  taskName,
+		allocID:   allocID,
+		config:    config,
+		node:      node,
+		logger:    logger,
+		emitEvent: eventEmitter,
 	}
 }
 
@@ -104,10 +109,39 @@ type DriverHandle interface {
 	Stats() (*models.TaskStatistics, error)
 }
 
+// Throttler is implemented by the handles of tasks whose writes can be
+// throttled while they run
+type Throttler interface {
+	// SetThrottle changes the rates the task writes at, in bytes and rows
+	// per second, 0 not to limit them
+	SetThrottle(bytesPerSecond, rowsPerSecond int64) error
+}
+
+// Pauser is implemented by the handles of tasks that can stop their work
+// while they run, and go on with it from where they stopped
+type Pauser interface {
+	// Pause stops the work of the task, once what it began is done
+	Pause() error
+
+	// Resume goes on with the work of the paused task
+	Resume() error
+}
+
+// Reloader is implemented by the handles of tasks that reload fields of
+// their configuration while they run
+type Reloader interface {
+	// Reload applies the fields of config, which changed, to the task
+	Reload(config map[string]interface{}, fields []string) error
+}
+
 type ExecContext struct {
 	Subject    string
 	Tp         string
 	MaxPayload int
+
+	// Source is the source task of the job, for the destination task to
+	// read the source, nil for the source task
+	Source *models.Task
 }
 
 // NewExecContext is used to create a new execution context
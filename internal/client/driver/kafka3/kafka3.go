@@ -50,7 +50,7 @@ type KafkaRunner struct {
 
 func NewKafkaRunner(subject, tp string, maxPayload int, cfg *KafkaConfig, logger *log.Logger) *KafkaRunner {
 	entry := log.NewEntry(logger).WithFields(log.Fields{
-		"job": subject,
+		log.FieldJobID: subject,
 	})
 	return &KafkaRunner{
 		subject:     subject,
@@ -115,6 +115,7 @@ func (kr *KafkaRunner) initNatSubClient() (err error) {
 	return nil
 }
 func (kr *KafkaRunner) Run() {
+	defer kr.recoverPanic()
 	kr.logger.Debugf("kafka. broker: %v", kr.kafkaConfig.Brokers)
 
 	var err error
@@ -165,6 +166,7 @@ func (kr *KafkaRunner) initiateStreaming() error {
 	var err error
 
 	_, err = kr.natsConn.Subscribe(fmt.Sprintf("%s_full", kr.subject), func(m *gonats.Msg) {
+		defer kr.recoverPanic()
 		kr.logger.Debugf("kafka: recv a msg")
 		dumpData := &mysqlDriver.DumpEntry{}
 		if err := Decode(m.Data, dumpData); err != nil {
@@ -200,12 +202,14 @@ func (kr *KafkaRunner) initiateStreaming() error {
 	}
 
 	_, err = kr.natsConn.Subscribe(fmt.Sprintf("%s_full_complete", kr.subject), func(m *gonats.Msg) {
+		defer kr.recoverPanic()
 		if err := kr.natsConn.Publish(m.Reply, nil); err != nil {
 			kr.onError(TaskStateDead, err)
 		}
 	})
 
 	_, err = kr.natsConn.Subscribe(fmt.Sprintf("%s_incr_hete", kr.subject), func(m *gonats.Msg) {
+		defer kr.recoverPanic()
 		var binlogEntries binlog.BinlogEntries
 		if err := Decode(m.Data, &binlogEntries); err != nil {
 			kr.onError(TaskStateDead, err)
@@ -237,6 +241,16 @@ func Decode(data []byte, vPtr interface{}) (err error) {
 	return gob.NewDecoder(bytes.NewBuffer(msg)).Decode(vPtr)
 }
 
+// recoverPanic, deferred by the goroutines of the runner, fails the task
+// rather than the whole process when they panic
+func (kr *KafkaRunner) recoverPanic() {
+	if r := recover(); r != nil {
+		err := models.NewPanicError(r)
+		kr.logger.Errorf("kafka: %v", err)
+		kr.onError(TaskStateRestart, err)
+	}
+}
+
 func (kr *KafkaRunner) onError(state int, err error) {
 	if kr.shutdown {
 		return
@@ -7,8 +7,11 @@
 package driver
 
 import (
+	gosql "database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/mitchellh/mapstructure"
 
@@ -16,6 +19,7 @@ import (
 	ubase "github.com/actiontech/dtle/internal/client/driver/mysql/base"
 	usql "github.com/actiontech/dtle/internal/client/driver/mysql/sql"
 	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
 	"github.com/actiontech/dtle/internal/models"
 
 	"github.com/actiontech/dtle/internal/g"
@@ -32,25 +36,22 @@ func NewMySQLDriver(ctx *DriverContext) Driver {
 
 // Validate is used to validate the driver configuration
 func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse, error) {
-	var driverConfig config.MySQLDriverConfig
 	reply := &models.TaskValidateResponse{}
-	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
-		return reply, err
-	}
-	uri := driverConfig.ConnectionConfig.GetDBUri()
-	db, err := usql.CreateDB(uri)
+	driverConfig, err := decodeDriverConfig(task, m.keyring())
 	if err != nil {
 		return reply, err
 	}
-
-	query := `select @@global.version`
-	var mysqlVersion string
-	if err := db.QueryRow(query).Scan(&mysqlVersion); err != nil {
+	db, err := openValidateDB(driverConfig)
+	if err != nil {
+		// Nothing else can be checked
 		reply.Connection.Success = false
 		reply.Connection.Error = err.Error()
-	} else {
-		reply.Connection.Success = true
+		reply.AddCheck("connection", err)
+		return reply, nil
 	}
+	defer db.Close()
+	reply.Connection.Success = true
+	reply.AddCheck("connection", nil)
 
 	if task.Type == models.TaskTypeSrc {
 		var query string
@@ -119,7 +120,8 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 			reply.Binlog.Error = fmt.Sprintf("%s:%d must have binary logs enabled", driverConfig.ConnectionConfig.Host, driverConfig.ConnectionConfig.Port)
 		} else if driverConfig.RequiresBinlogFormatChange() {
 			reply.Binlog.Success = false
-			reply.Binlog.Error = fmt.Sprintf("You must be using ROW binlog format. I can switch it for you, provided --switch-to-rbr and that %s:%d doesn't have replicas", driverConfig.ConnectionConfig.Host, driverConfig.ConnectionConfig.Port)
+			reply.Binlog.Error = fmt.Sprintf("%s:%d has binlog_format %s, which logs no rows to replicate: set binlog_format = ROW on the source, with SET GLOBAL and in its configuration file",
+				driverConfig.ConnectionConfig.Host, driverConfig.ConnectionConfig.Port, driverConfig.BinlogFormat)
 		} else {
 			reply.Binlog.Success = true
 		}
@@ -212,6 +214,14 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 			reply.Privileges.Success = false
 			reply.Privileges.Error = fmt.Sprintf("user has insufficient privileges for applier. Needed: SUPER|ALL on *.*")
 		}
+
+		err = mysql.ValidateColumnFilters(db, driverConfig.ReplicateDoDb, usql.NewNameMapping(driverConfig.ReplicateDoDb))
+		if err != nil {
+			reply.ColumnFilters.Success = false
+			reply.ColumnFilters.Error = err.Error()
+		} else {
+			reply.ColumnFilters.Success = true
+		}
 	}
 	if task.Config["ExpandSyntaxSupport"] == true {
 		if _, err := db.Query("use mysql"); err != nil {
@@ -219,12 +229,208 @@ func (m *MySQLDriver) Validate(task *models.Task) (*models.TaskValidateResponse,
 			reply.Privileges.Error = err.Error()
 		}
 	}
+
+	if task.Type == models.TaskTypeSrc {
+		reply.AddCheck("gtid_mode", validateError(reply.GtidMode.Success, reply.GtidMode.Error))
+		reply.AddCheck("server_id", validateError(reply.ServerID.Success, reply.ServerID.Error))
+		reply.AddCheck("binlog", validateError(reply.Binlog.Success, reply.Binlog.Error))
+		reply.AddCheck("privileges", validateError(reply.Privileges.Success, reply.Privileges.Error))
+		reply.AddCheck("tables", mysql.ValidateTables(db, driverConfig, m.logger))
+	} else {
+		reply.AddCheck("privileges", validateError(reply.Privileges.Success, reply.Privileges.Error))
+		reply.AddCheck("column_filters", validateError(reply.ColumnFilters.Success, reply.ColumnFilters.Error))
+		reply.AddCheck("routing", mysql.ValidateRouting(db, driverConfig.ReplicateDoDb, usql.NewNameMapping(driverConfig.ReplicateDoDb)))
+		warnings, err := mysql.ValidateOperations(driverConfig.ReplicateDoDb)
+		reply.AddCheck("operations", err).Warnings = warnings
+	}
 	return reply, nil
 }
 
-func (m *MySQLDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle, error) {
+// keyring returns the keyring opening the secrets of the tasks, nil
+// without one
+func (m *MySQLDriver) keyring() *config.Keyring {
+	if m.config == nil {
+		return nil
+	}
+	return m.config.SecretsKeyring
+}
+
+// decodeDriverConfig decodes the config of the MySQL task, with its secrets
+// opened by keyring if they are sealed
+func decodeDriverConfig(task *models.Task, keyring *config.Keyring) (*config.MySQLDriverConfig, error) {
+	cfg, err := keyring.OpenTaskConfig(task.Config)
+	if err != nil {
+		return nil, err
+	}
 	var driverConfig config.MySQLDriverConfig
-	if err := mapstructure.WeakDecode(task.Config, &driverConfig); err != nil {
+	if err := mapstructure.WeakDecode(cfg, &driverConfig); err != nil {
+		return nil, err
+	}
+	return &driverConfig, nil
+}
+
+// openValidateDB connects to the server of cfg, and makes sure the
+// connection works
+func openValidateDB(cfg *config.MySQLDriverConfig) (*gosql.DB, error) {
+	if err := cfg.ConnectionConfig.RegisterTLSConfig(); err != nil {
+		return nil, err
+	}
+	db, err := usql.CreateDB(cfg.ConnectionConfig.GetDBUri())
+	if err != nil {
+		return nil, err
+	}
+	var mysqlVersion string
+	if err := db.QueryRow(`select @@global.version`).Scan(&mysqlVersion); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func validateError(success bool, detail string) error {
+	if success {
+		return nil
+	}
+	return errors.New(detail)
+}
+
+// ValidateSchemas checks the tables the MySQL task src replicates against
+// the target of the MySQL task dest, keyring opening their passwords
+func ValidateSchemas(src, dest *models.Task, keyring *config.Keyring) error {
+	srcConfig, err := decodeDriverConfig(src, keyring)
+	if err != nil {
+		return err
+	}
+	destConfig, err := decodeDriverConfig(dest, keyring)
+	if err != nil {
+		return err
+	}
+	srcDB, err := openValidateDB(srcConfig)
+	if err != nil {
+		return fmt.Errorf("source: %v", err)
+	}
+	defer srcDB.Close()
+	destDB, err := openValidateDB(destConfig)
+	if err != nil {
+		return fmt.Errorf("target: %v", err)
+	}
+	defer destDB.Close()
+	return mysql.ValidateSchemas(srcDB, destDB, srcConfig, destConfig)
+}
+
+// createTables creates the tables of the target of the applier of destCfg
+// that the MySQL task src replicates and that don't exist yet
+func createTables(src *models.Task, destCfg *config.MySQLDriverConfig, keyring *config.Keyring, logger *log.Logger) error {
+	srcConfig, err := decodeDriverConfig(src, keyring)
+	if err != nil {
+		return err
+	}
+	srcDB, err := openValidateDB(srcConfig)
+	if err != nil {
+		return fmt.Errorf("source: %v", err)
+	}
+	defer srcDB.Close()
+	destDB, err := openValidateDB(destCfg)
+	if err != nil {
+		return fmt.Errorf("target: %v", err)
+	}
+	defer destDB.Close()
+	return mysql.CreateTables(srcDB, destDB, srcConfig, destCfg, logger)
+}
+
+// VerifyTables compares the rows of the tables the MySQL task src
+// replicates with those of the target of the MySQL task dest, by chunks of
+// chunkSize rows, keyring opening their passwords
+func VerifyTables(src, dest *models.Task, chunkSize int, keyring *config.Keyring) ([]*models.TableVerification, error) {
+	srcConfig, err := decodeDriverConfig(src, keyring)
+	if err != nil {
+		return nil, err
+	}
+	destConfig, err := decodeDriverConfig(dest, keyring)
+	if err != nil {
+		return nil, err
+	}
+	srcDB, err := openValidateDB(srcConfig)
+	if err != nil {
+		return nil, fmt.Errorf("source: %v", err)
+	}
+	defer srcDB.Close()
+	destDB, err := openValidateDB(destConfig)
+	if err != nil {
+		return nil, fmt.Errorf("target: %v", err)
+	}
+	defer destDB.Close()
+	return mysql.VerifyTables(srcDB, destDB, srcConfig, destConfig, chunkSize)
+}
+
+// ReplayJob returns a job applying again the transactions of the MySQL job
+// from gtidStart to gtidStop, to its target or to the one of target if it
+// isn't nil. It writes the rows of the source over those of the target,
+// unless the job has a ConflictPolicy, and completes after gtidStop.
+func ReplayJob(job *models.Job, gtidStart, gtidStop string, target map[string]interface{}) (*models.Job, error) {
+	if err := mysql.ValidateReplayRange(gtidStart, gtidStop); err != nil {
+		return nil, err
+	}
+	replay := job.Copy()
+	replay.ID = models.GenerateUUID()
+	replay.Name = fmt.Sprintf("%s-replay-%s", job.Name, replay.ID[:8])
+	replay.Orders = nil
+	replay.Failover = false
+	replay.Status = ""
+	replay.StatusDescription = ""
+	replay.EnforceIndex = false
+	replay.CreateIndex, replay.ModifyIndex, replay.JobModifyIndex = 0, 0, 0
+	for _, t := range replay.Tasks {
+		cfg := make(map[string]interface{}, len(t.Config))
+		for k, v := range t.Config {
+			cfg[k] = v
+		}
+		t.Config = cfg
+		t.ConfigLock = &sync.RWMutex{}
+
+		var driverConfig config.MySQLDriverConfig
+		if err := mapstructure.WeakDecode(cfg, &driverConfig); err != nil {
+			return nil, err
+		}
+		if !driverConfig.ApproveHeterogeneous {
+			return nil, fmt.Errorf("a replay requires ApproveHeterogeneous")
+		}
+		for _, k := range []string{"Gtid", "AutoGtid", "DumpCheckpoint", "HeartbeatIntervalSeconds"} {
+			deleteConfig(cfg, k)
+		}
+		setConfig(cfg, "GtidStart", gtidStart)
+		setConfig(cfg, "GtidStop", gtidStop)
+		if t.Type == models.TaskTypeDest {
+			if driverConfig.ConflictPolicy == "" {
+				setConfig(cfg, "ConflictPolicy", config.ConflictPolicySource)
+			}
+			if target != nil {
+				setConfig(cfg, "ConnectionConfig", target)
+			}
+		}
+	}
+	return replay, nil
+}
+
+// setConfig sets key in the task config cfg, whatever the case of the key
+// it already has
+func setConfig(cfg map[string]interface{}, key string, value interface{}) {
+	deleteConfig(cfg, key)
+	cfg[key] = value
+}
+
+func deleteConfig(cfg map[string]interface{}, key string) {
+	for k := range cfg {
+		if strings.EqualFold(k, key) {
+			delete(cfg, k)
+		}
+	}
+}
+
+func (m *MySQLDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle, error) {
+	// The password is only opened in memory, for the task to connect
+	driverConfig, err := decodeDriverConfig(task, m.keyring())
+	if err != nil {
 		return nil, err
 	}
 
@@ -233,17 +439,25 @@ func (m *MySQLDriver) Start(ctx *ExecContext, task *models.Task) (DriverHandle,
 		{
 			m.logger.Debugf("NewExtractor ReplicateDoDb: %v", driverConfig.ReplicateDoDb)
 			// Create the extractor
-			e, err := mysql.NewExtractor(ctx.Subject, ctx.Tp, ctx.MaxPayload, &driverConfig, m.logger)
+			e, err := mysql.NewExtractor(ctx.Subject, ctx.Tp, ctx.MaxPayload, driverConfig, m.logger)
 			if err != nil {
 				return nil, err
 			}
+			if m.node != nil {
+				e.SetLocalNatsAddr(m.node.NatsAddr)
+			}
 			go e.Run()
 			return e, nil
 		}
 	case models.TaskTypeDest:
 		{
 			m.logger.Debugf("NewApplier ReplicateDoDb: %v", driverConfig.ReplicateDoDb)
-			a, err := mysql.NewApplier(ctx.Subject, ctx.Tp, &driverConfig, m.logger)
+			if driverConfig.CreateTables && ctx.Source != nil {
+				if err := createTables(ctx.Source, driverConfig, m.keyring(), m.logger); err != nil {
+					return nil, fmt.Errorf("failed to create the tables of the target: %v", err)
+				}
+			}
+			a, err := mysql.NewApplier(ctx.Subject, ctx.Tp, driverConfig, m.logger, m.emitEvent)
 			if err != nil {
 				return nil, err
 			}
@@ -9,6 +9,7 @@ package mysql
 import (
 	gosql "database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/actiontech/dtle/internal/g"
 
@@ -75,6 +76,27 @@ type applierTableItem struct {
 	psInsert []*gosql.Stmt
 	psDelete []*gosql.Stmt
 	psUpdate []*gosql.Stmt
+	// psBatch are the statements of batches of rows of each worker, by
+	// query
+	psBatch []map[string]*gosql.Stmt
+
+	// rowKeyOrdinals locates the primary key in row images when rows are
+	// tracked by the dependencyTracker, nil to track the whole table
+	rowKeyOrdinals []int
+
+	// routed are the items of the target tables the rows of a routed table
+	// go to, by name, and routeOrdinal locates the key in row images
+	routed       map[string]*applierTableItem
+	routeOrdinal int
+	// targetTable is the table of the target the item writes to, if not
+	// the one named like the source table
+	targetTable string
+
+	// converters convert the values of columns to the types of the target
+	converters []*columnConverter
+	// transcoders transcode the text of columns to the charsets of the
+	// target
+	transcoders []*columnTranscoder
 }
 
 func newApplierTableItem(parallelWorkers int) *applierTableItem {
@@ -83,6 +105,7 @@ func newApplierTableItem(parallelWorkers int) *applierTableItem {
 		psInsert: make([]*gosql.Stmt, parallelWorkers),
 		psDelete: make([]*gosql.Stmt, parallelWorkers),
 		psUpdate: make([]*gosql.Stmt, parallelWorkers),
+		psBatch:  make([]map[string]*gosql.Stmt, parallelWorkers),
 	}
 }
 func (ait *applierTableItem) Reset() {
@@ -98,8 +121,16 @@ func (ait *applierTableItem) Reset() {
 	closeStmts(ait.psInsert)
 	closeStmts(ait.psDelete)
 	closeStmts(ait.psUpdate)
+	ait.resetBatchStmts(len(ait.psBatch))
 
 	ait.columns = nil
+	ait.rowKeyOrdinals = nil
+	ait.converters = nil
+	ait.transcoders = nil
+	for _, item := range ait.routed {
+		item.Reset()
+	}
+	ait.routed = nil
 }
 
 type mapSchemaTableItems map[string](map[string](*applierTableItem))
@@ -209,9 +240,17 @@ type Applier struct {
 	dbs                []*sql.Conn
 	db                 *gosql.DB
 	gtidExecuted       base.GtidSet
+	// gtidCommitted holds the transactions the target committed, including
+	// those before the job started. The job resumes from it.
+	gtidCommitted      *gomysql.MysqlGTIDSet
+	gtidCommittedMutex sync.Mutex
 	currentCoordinates *models.CurrentCoordinates
 	tableItems         mapSchemaTableItems
 
+	// nameMapping renames schemas and tables on the target, nil if the job
+	// doesn't rename any
+	nameMapping *sql.NameMapping
+
 	rowCopyComplete     chan bool
 	rowCopyCompleteFlag int64
 	// copyRowsQueue should not be buffered; if buffered some non-damaging but
@@ -235,18 +274,130 @@ type Applier struct {
 	mtsManager     *MtsManager
 	printTps       bool
 	txLastNSeconds uint32
+
+	// dependencies orders transactions by what they write, nil to follow
+	// the logical clock of the source
+	dependencies *dependencyTracker
+
+	// lagSeconds is the time between the commit of the last applied
+	// transaction on the source and on the target
+	lagSeconds int64
+	// lastHeartbeat is the time in unix nanoseconds of the last heartbeat
+	// applied, 0 if none was
+	lastHeartbeat int64
+	// rowsApplied and bytesApplied count what was written to the target
+	rowsApplied  int64
+	bytesApplied int64
+	// batchStatements counts the statements writing batches of rows, and
+	// batchedRows the rows they wrote
+	batchStatements int64
+	batchedRows     int64
+	// droppedRows counts the row events of operations the tables don't
+	// replicate
+	droppedRows int64
+	// lastAppliedGtid is the GTID of the last transaction committed,
+	// guarded by gtidCommittedMutex
+	lastAppliedGtid string
+
+	// throttle paces the writes to the target
+	throttle *throttle
+	// pauser holds the applier back while the job is paused
+	pauser *pauser
+	// workersCh receives the number of workers to apply with. Closing
+	// workersStopCh stops the workers.
+	workersCh     chan int
+	workersStopCh chan struct{}
+	workersWg     sync.WaitGroup
+	// parallelWorkers is how many workers apply, and scaler adjusts their
+	// number, nil not to
+	parallelWorkers int64
+	scaler          *workerScaler
+	// connPool hands the connections of dbs out to the workers. It is
+	// replaced, under connPoolLock, when they are resized.
+	connPool     *connPool
+	connPoolLock sync.Mutex
+
+	// skipErrors are the errors of the statements skipped, nil if none are
+	skipErrors *skipErrors
+	// conflicts resolves the conflicts of rows with the target, nil not to
+	// look for them
+	conflicts *conflictResolver
+	// dumpCheckpoint records how far the copy went
+	dumpCheckpoint dumpCheckpoint
+	// ddlRules decides what to do with DDL statements, nil to apply them
+	ddlRules  *sql.DDLRules
+	emitEvent func(message string, args ...interface{})
+
+	// slowLog logs the transactions slow to apply, nil not to
+	slowLog *slowLog
+	// replay is the range of transactions the applier completes after,
+	// nil unless the job is a replay
+	replay *replayRange
+	// splits holds how far the transactions split are committed
+	splits splitProgress
+	// sourceTables are the columns of the source tables, as the extractor
+	// sends them
+	sourceTables sourceTables
 }
 
-func NewApplier(subject, tp string, cfg *config.MySQLDriverConfig, logger *log.Logger) (*Applier, error) {
+// NewApplier returns the applier of the job subject. emitEvent reports
+// what the applier does to the task events, it may be nil.
+func NewApplier(subject, tp string, cfg *config.MySQLDriverConfig, logger *log.Logger,
+	emitEvent func(message string, args ...interface{})) (*Applier, error) {
 	cfg = cfg.SetDefault()
 	entry := log.NewEntry(logger).WithFields(log.Fields{
-		"job": subject,
+		log.FieldJobID: subject,
 	})
 	subjectUUID, err := uuid.FromString(subject)
 	if err != nil {
 		logger.Errorf("job id is not a valid UUID: %v", err.Error())
 		return nil, err
 	}
+	nameMapping := sql.NewNameMapping(cfg.ReplicateDoDb)
+	if nameMapping != nil && !cfg.ApproveHeterogeneous {
+		// Transactions are then replayed from the raw binlog events
+		return nil, fmt.Errorf("schema and table renames need ApproveHeterogeneous")
+	}
+	dependencies, err := newDependencyTracker(cfg.DependencyTracking)
+	if err != nil {
+		return nil, err
+	}
+	ddlRules, err := sql.NewDDLRules(cfg.DDLRules)
+	if err != nil {
+		return nil, err
+	}
+	if ddlRules != nil && !cfg.ApproveHeterogeneous {
+		return nil, fmt.Errorf("DDLRules need ApproveHeterogeneous")
+	}
+	conflicts, err := newConflictResolver(cfg.ConflictPolicy, cfg.ConflictColumn)
+	if err != nil {
+		return nil, err
+	}
+	if conflicts != nil && !cfg.ApproveHeterogeneous {
+		return nil, fmt.Errorf("ConflictPolicy needs ApproveHeterogeneous")
+	}
+	skip, err := newSkipErrors(cfg.SkipErrors)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWorkerScaling(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.SplitTransactionRows > 0 && !cfg.ApproveHeterogeneous {
+		return nil, fmt.Errorf("SplitTransactionRows needs ApproveHeterogeneous")
+	}
+	if err := validateCharsets(cfg); err != nil {
+		return nil, err
+	}
+	var replay *replayRange
+	if cfg.GtidStop != "" {
+		if !cfg.ApproveHeterogeneous {
+			return nil, fmt.Errorf("a replay requires ApproveHeterogeneous")
+		}
+		if replay, err = parseReplayRange(cfg.GtidStart, cfg.GtidStop); err != nil {
+			return nil, err
+		}
+	}
 
 	a := &Applier{
 		logger:                  entry,
@@ -256,6 +407,14 @@ func NewApplier(subject, tp string, cfg *config.MySQLDriverConfig, logger *log.L
 		mysqlContext:            cfg,
 		currentCoordinates:      &models.CurrentCoordinates{},
 		tableItems:              make(mapSchemaTableItems),
+		nameMapping:             nameMapping,
+		dependencies:            dependencies,
+		ddlRules:                ddlRules,
+		conflicts:               conflicts,
+		skipErrors:              skip,
+		emitEvent:               emitEvent,
+		throttle:                newThrottle(cfg.ThrottleBytesPerSecond, cfg.ThrottleRowsPerSecond),
+		pauser:                  newPauser(),
 		rowCopyComplete:         make(chan bool, 1),
 		copyRowsQueue:           make(chan *DumpEntry, 24),
 		applyDataEntryQueue:     make(chan *binlog.BinlogEntry, cfg.ReplChanBufferSize*2),
@@ -264,21 +423,32 @@ func NewApplier(subject, tp string, cfg *config.MySQLDriverConfig, logger *log.L
 		applyBinlogGroupTxQueue: make(chan []*binlog.BinlogTx, cfg.ReplChanBufferSize*2),
 		waitCh:                  make(chan *models.WaitResult, 1),
 		shutdownCh:              make(chan struct{}),
+		workersCh:               make(chan int, 1),
+		scaler:                  newWorkerScaler(cfg),
+		slowLog:                 newSlowLog(cfg.SlowTransactionMilliseconds, entry),
+		replay:                  replay,
 		printTps:                os.Getenv("UDUP_PRINT_TPS") != "",
 	}
+	if cfg.Gtid == "" {
+		a.dumpCheckpoint.checkpoint = cfg.DumpCheckpoint
+	}
 	a.mtsManager = NewMtsManager(a.shutdownCh)
-	go a.mtsManager.LcUpdater()
+	go func() {
+		defer a.recoverPanic()
+		a.mtsManager.LcUpdater()
+	}()
 	return a, nil
 }
 
-func (a *Applier) MtsWorker(workerIndex int) {
+func (a *Applier) MtsWorker(workerIndex int, stopCh chan struct{}) {
+	defer a.recoverPanic()
 	keepLoop := true
 	for keepLoop {
 		select {
 		case tx := <-a.applyBinlogMtsTxQueue:
 			a.logger.Debugf("mysql.applier: a binlogEntry MTS dequeue, worker: %v. GNO: %v",
 				workerIndex, tx.Coordinates.GNO)
-			if err := a.ApplyBinlogEvent(workerIndex, tx); err != nil {
+			if err := a.applyPooled(tx); err != nil {
 				a.onError(TaskStateDead, err) // TODO coordinate with other goroutine
 				keepLoop = false
 			} else {
@@ -286,6 +456,8 @@ func (a *Applier) MtsWorker(workerIndex int) {
 			}
 			a.logger.Debugf("mysql.applier: worker: %v. after ApplyBinlogEvent. GNO: %v",
 				workerIndex, tx.Coordinates.GNO)
+		case <-stopCh:
+			keepLoop = false
 		case <-a.shutdownCh:
 			keepLoop = false
 		}
@@ -294,6 +466,7 @@ func (a *Applier) MtsWorker(workerIndex int) {
 
 // Run executes the complete apply logic.
 func (a *Applier) Run() {
+	defer a.recoverPanic()
 	if a.printTps {
 		go func() {
 			for {
@@ -306,6 +479,10 @@ func (a *Applier) Run() {
 
 	a.logger.Printf("mysql.applier: Apply binlog events to %s.%d", a.mysqlContext.ConnectionConfig.Host, a.mysqlContext.ConnectionConfig.Port)
 	a.mysqlContext.StartTime = time.Now()
+	if err := a.mysqlContext.ConnectionConfig.RegisterTLSConfig(); err != nil {
+		a.onError(TaskStateDead, err)
+		return
+	}
 	if err := a.initDBConnections(); err != nil {
 		a.onError(TaskStateDead, err)
 		return
@@ -320,8 +497,12 @@ func (a *Applier) Run() {
 		return
 	}
 
-	for i := 0; i < a.mysqlContext.ParallelWorkers; i++ {
-		go a.MtsWorker(i)
+	a.startMtsWorkers()
+	if a.slowLog != nil {
+		go a.slowLog.run(a.shutdownCh)
+	}
+	if a.scaler != nil {
+		go a.scaleWorkers(a.scaler)
 	}
 
 	go a.executeWriteFuncs()
@@ -385,8 +566,10 @@ func (a *Applier) onApplyTxStructWithSuper(dbApplier *sql.Conn, binlogTx *binlog
 // This is where the ghost table gets the data. The function fills the data single-threaded.
 // Both event backlog and rowcopy events are polled; the backlog events have precedence.
 func (a *Applier) executeWriteFuncs() {
+	defer a.recoverPanic()
 	if a.mysqlContext.Gtid == "" {
 		go func() {
+			defer a.recoverPanic()
 			var stopLoop = false
 			for !stopLoop {
 				select {
@@ -396,6 +579,13 @@ func (a *Applier) executeWriteFuncs() {
 							a.onError(TaskStateDead, err)
 						}
 					}
+				case <-a.pauser.paused():
+					// The binlog loop reports the pause
+					select {
+					case <-a.pauser.resumed():
+					case <-a.shutdownCh:
+						stopLoop = true
+					}
 				case <-a.rowCopyComplete:
 					stopLoop = true
 				case <-a.shutdownCh:
@@ -437,8 +627,9 @@ func (a *Applier) executeWriteFuncs() {
 				continue
 			}
 			for idx, binlogTx := range groupTx {
-				dbApplier = a.dbs[idx%a.mysqlContext.ParallelWorkers]
+				dbApplier = a.dbs[idx%len(a.dbs)]
 				go func(tx *binlog.BinlogTx) {
+					defer a.recoverPanic()
 					a.wg.Add(1)
 					if err := a.onApplyTxStructWithSuper(dbApplier, tx); err != nil {
 						a.onError(TaskStateDead, err)
@@ -481,18 +672,24 @@ func Decode(data []byte, vPtr interface{}) (err error) {
 }
 
 func (a *Applier) setTableItemForBinlogEntry(binlogEntry *binlog.BinlogEntry) error {
-	var err error
+	a.dropOperations(binlogEntry)
+	if err := a.routeBinlogEntry(binlogEntry); err != nil {
+		return err
+	}
 	for i := range binlogEntry.Events {
 		dmlEvent := &binlogEntry.Events[i]
 		switch dmlEvent.DML {
 		case binlog.NotDML:
 			// do nothing
 		default:
+			if dmlEvent.TableItem != nil {
+				// routed
+				continue
+			}
 			tableItem := a.getTableItem(dmlEvent.DatabaseName, dmlEvent.TableName)
 			if tableItem.columns == nil {
-				a.logger.Debugf("mysql.applier: get tableColumns %v.%v", dmlEvent.DatabaseName, dmlEvent.TableName)
-				tableItem.columns, err = base.GetTableColumns(a.db, dmlEvent.DatabaseName, dmlEvent.TableName)
-				if err != nil {
+				schema, table := a.nameMapping.Table(dmlEvent.DatabaseName, dmlEvent.TableName)
+				if err := a.loadTableItem(tableItem, dmlEvent.DatabaseName, dmlEvent.TableName, schema, table); err != nil {
 					return err
 				}
 			} else {
@@ -504,21 +701,67 @@ func (a *Applier) setTableItemForBinlogEntry(binlogEntry *binlog.BinlogEntry) er
 	return  nil
 }
 
+// loadTableItem reads the columns of the target table schema.table the rows
+// of the source table sourceSchema.sourceTable are written to. Their
+// ordinals are those of the source columns, which the rows follow.
+func (a *Applier) loadTableItem(tableItem *applierTableItem, sourceSchema, sourceTable, schema, table string) (err error) {
+	a.logger.Debugf("mysql.applier: get tableColumns %v.%v", schema, table)
+	columns, err := base.GetTableColumns(a.db, schema, table)
+	if err != nil {
+		return err
+	}
+	tb := a.tableConfig(sourceSchema, sourceTable)
+	if tb != nil {
+		if columns, err = tb.ReplicatedColumns(columns); err != nil {
+			return err
+		}
+	}
+	columns, err = sourceOrdinals(columns, a.sourceTables.columns(sourceSchema, sourceTable))
+	if err != nil {
+		return fmt.Errorf("%s.%s: %v", schema, table, err)
+	}
+	tableItem.columns = columns
+	if tb != nil {
+		tableItem.converters, err = newColumnConverters(tb, tableItem.columns)
+		if err != nil {
+			return err
+		}
+	}
+	tableItem.transcoders, err = a.newColumnTranscoders(tb, tableItem.columns, sourceSchema, sourceTable, schema, table)
+	if err != nil {
+		return err
+	}
+	if a.dependencies != nil && a.dependencies.byRow {
+		otherUniqueKeys, err := hasOtherUniqueKeys(a.db, schema, table)
+		if err != nil {
+			return err
+		}
+		tableItem.rowKeyOrdinals = rowKeyOrdinals(tableItem.columns, otherUniqueKeys)
+	}
+	return nil
+}
+
 // initiateStreaming begins treaming of binary log events and registers listeners for such events
 func (a *Applier) initiateStreaming() error {
 	if a.mysqlContext.Gtid == "" {
 		a.mysqlContext.MarkRowCopyStartTime()
 		a.logger.Debugf("mysql.applier: nats subscribe")
 		_, err := a.natsConn.Subscribe(fmt.Sprintf("%s_full", a.subject), func(m *gonats.Msg) {
+			defer a.recoverPanic()
 			a.logger.Debugf("mysql.applier: recv a msg")
 			dumpData := &DumpEntry{}
-			if err := Decode(m.Data, dumpData); err != nil {
+			if err := decodeDumpMsg(m.Data, dumpData); err != nil {
 				a.onError(TaskStateDead, err)
 			}
+			if a.pauser.get() {
+				// Not acked, the extractor sends it again
+				a.logger.Debugf("mysql.applier: paused. discarding a msg")
+				return
+			}
 			a.copyRowsQueue <- dumpData
 			a.logger.Debugf("mysql.applier: copyRowsQueue: %v", len(a.copyRowsQueue))
 			a.mysqlContext.Stage = models.StageSlaveWaitingForWorkersToProcessQueue
-			if err := a.natsConn.Publish(m.Reply, nil); err != nil {
+			if err := a.natsConn.Publish(m.Reply, dumpFrames); err != nil {
 				a.onError(TaskStateDead, err)
 			}
 			a.logger.Debugf("mysql.applier: after publish nats reply")
@@ -529,11 +772,17 @@ func (a *Applier) initiateStreaming() error {
 		}*/
 
 		_, err = a.natsConn.Subscribe(fmt.Sprintf("%s_full_complete", a.subject), func(m *gonats.Msg) {
+			defer a.recoverPanic()
 			dumpData := &dumpStatResult{}
 			if err := Decode(m.Data, dumpData); err != nil {
 				a.onError(TaskStateDead, err)
 			}
 			a.currentCoordinates.RetrievedGtidSet = dumpData.Gtid
+			if dumpData.ResumedGtid != "" {
+				if err := a.dumpCheckpoint.setResumedGtid(dumpData.ResumedGtid); err != nil {
+					a.onError(TaskStateDead, err)
+				}
+			}
 			a.mysqlContext.Stage = models.StageSlaveWaitingForWorkersToProcessQueue
 			if err := a.natsConn.Publish(m.Reply, nil); err != nil {
 				a.onError(TaskStateDead, err)
@@ -548,6 +797,7 @@ func (a *Applier) initiateStreaming() error {
 
 	if a.mysqlContext.ApproveHeterogeneous {
 		_, err := a.natsConn.Subscribe(fmt.Sprintf("%s_incr_hete", a.subject), func(m *gonats.Msg) {
+			defer a.recoverPanic()
 			var binlogEntries binlog.BinlogEntries
 			if err := Decode(m.Data, &binlogEntries); err != nil {
 				a.onError(TaskStateDead, err)
@@ -555,13 +805,16 @@ func (a *Applier) initiateStreaming() error {
 
 			a.logger.Debugf("applier. incr. recv. nEntries: %v, len(applyDataEntryQueue): %v",
 				len(binlogEntries.Entries), len(a.applyDataEntryQueue))
-			if cap(a.applyDataEntryQueue)-len(a.applyDataEntryQueue) < len(binlogEntries.Entries) {
+			if a.pauser.get() || cap(a.applyDataEntryQueue)-len(a.applyDataEntryQueue) < len(binlogEntries.Entries) {
 				// discard these entries
 				a.logger.Debugf("applier. incr. discarding entries")
 				a.mysqlContext.Stage = models.StageWaitingForMasterToSendEvent
 			} else {
 				for _, binlogEntry := range binlogEntries.Entries {
 					a.applyDataEntryQueue <- binlogEntry
+					if binlogEntry.IsHeartbeat() {
+						continue
+					}
 					a.currentCoordinates.RetrievedGtidSet = binlogEntry.Coordinates.GetGtidForThisTx()
 					atomic.AddInt64(&a.mysqlContext.DeltaEstimate, 1)
 				}
@@ -578,19 +831,64 @@ func (a *Applier) initiateStreaming() error {
 		}
 
 		go func() {
+			defer a.recoverPanic()
 			stopSomeLoop := false
 			prevDDL := false
 			for !stopSomeLoop {
 				select {
+				case <-a.pauser.paused():
+					if !a.mtsManager.WaitForAllCommitted() || !a.waitResumed() {
+						return // shutdown
+					}
+				case n := <-a.workersCh:
+					if !a.mtsManager.WaitForAllCommitted() {
+						return // shutdown
+					}
+					if err := a.resizeWorkers(n); err != nil {
+						a.onError(TaskStateDead, err)
+						return
+					}
 				case binlogEntry := <-a.applyDataEntryQueue:
 					if nil == binlogEntry {
 						continue
 					}
+					// The entry is held, not applied, while paused
+					if a.pauser.get() && (!a.mtsManager.WaitForAllCommitted() || !a.waitResumed()) {
+						return // shutdown
+					}
 
 					a.logger.Debugf("mysql.applier: a binlogEntry. remaining: %v. gno: %v, lc: %v, seq: %v",
 						len(a.applyDataEntryQueue), binlogEntry.Coordinates.GNO,
 						binlogEntry.Coordinates.LastCommitted, binlogEntry.Coordinates.SeqenceNumber)
 
+					if binlogEntry.Final && a.replay != nil {
+						// Sent by the extractor of a replay, after its last
+						// transaction
+						if !a.mtsManager.WaitForAllCommitted() {
+							return // shutdown
+						}
+						a.completeReplay()
+						return
+					}
+					if binlogEntry.IsHeartbeat() {
+						// Sent by the extractor of a replica, after the
+						// transactions before it, some maybe still committing
+						atomic.StoreInt64(&a.lastHeartbeat, binlogEntry.Heartbeat)
+						continue
+					}
+					if a.replay != nil {
+						if message, ok := a.replay.progress(&binlogEntry.Coordinates); ok {
+							a.logger.Infof("mysql.applier: %s", message)
+							a.emit(message)
+						}
+					}
+
+					// Sent with the first rows of the tables, which may be
+					// skipped, and again once their definition changed
+					if !a.resetTableItems(a.sourceTables.learn(binlogEntry)) {
+						return // shutdown
+					}
+
 					if binlogEntry.Coordinates.OSID == a.mysqlContext.MySQLServerUuid {
 						a.logger.Debugf("mysql.applier: skipping a dtle tx. osid: %v", binlogEntry.Coordinates.OSID)
 						continue
@@ -599,8 +897,7 @@ func (a *Applier) initiateStreaming() error {
 					// region TestIfExecuted
 					if a.gtidExecuted == nil {
 						// udup crash recovery or never executed
-						a.gtidExecuted, err = base.SelectAllGtidExecuted(a.db, a.subjectUUID)
-						if err != nil {
+						if err := a.loadGtidExecuted(); err != nil {
 							a.onError(TaskStateDead, err)
 							return
 						}
@@ -683,19 +980,20 @@ func (a *Applier) initiateStreaming() error {
 					// TODO this is assigned before real execution
 					gtidSetItem.Intervals = newInterval
 
-					if binlogEntry.Coordinates.SeqenceNumber == 0 {
+					if binlogEntry.Coordinates.SeqenceNumber == 0 && a.dependencies == nil {
 						// MySQL 5.6: non mts
 						err := a.setTableItemForBinlogEntry(binlogEntry)
 						if err != nil {
 							a.onError(TaskStateDead, err)
 							return
 						}
-						if err := a.ApplyBinlogEvent(0, binlogEntry); err != nil {
+						if err := a.applyPooled(binlogEntry); err != nil {
 							a.onError(TaskStateDead, err)
 							return
 						}
 					} else {
-						if rotated {
+						// Sequence numbers of the dependencyTracker don't restart with binlogs
+						if rotated && a.dependencies == nil {
 							a.logger.Debugf("mysql.applier: binlog rotated to %v", a.currentCoordinates.File)
 							if !a.mtsManager.WaitForAllCommitted() {
 								return // shutdown
@@ -708,7 +1006,7 @@ func (a *Applier) initiateStreaming() error {
 						}
 
 						// If there are TXs skipped by udup source-side
-						for a.mtsManager.lastEnqueue+1 < binlogEntry.Coordinates.SeqenceNumber {
+						for a.dependencies == nil && a.mtsManager.lastEnqueue+1 < binlogEntry.Coordinates.SeqenceNumber {
 							a.mtsManager.lastEnqueue += 1
 							a.mtsManager.chExecuted <- a.mtsManager.lastEnqueue
 						}
@@ -740,22 +1038,24 @@ func (a *Applier) initiateStreaming() error {
 							prevDDL = false
 						}
 
-						if !a.mtsManager.WaitForExecution(binlogEntry) {
-							return // shutdown
-						}
-
-						a.logger.Debugf("mysql.applier: a binlogEntry MTS enqueue. gno: %v", binlogEntry.Coordinates.GNO)
 						err = a.setTableItemForBinlogEntry(binlogEntry)
 						if err != nil {
 							a.onError(TaskStateDead, err)
 							return
 						}
+						if a.dependencies != nil {
+							keys, serial := a.dependencies.writeset(binlogEntry)
+							binlogEntry.Coordinates.LastCommitted, binlogEntry.Coordinates.SeqenceNumber =
+								a.dependencies.track(keys, serial)
+						}
+
+						if !a.mtsManager.WaitForExecution(binlogEntry) {
+							return // shutdown
+						}
+
+						a.logger.Debugf("mysql.applier: a binlogEntry MTS enqueue. gno: %v", binlogEntry.Coordinates.GNO)
 						a.applyBinlogMtsTxQueue <- binlogEntry
 					}
-					if !a.shutdown {
-						// TODO what is this used for?
-						a.mysqlContext.Gtid = fmt.Sprintf("%s:1-%d", txSid, binlogEntry.Coordinates.GNO)
-					}
 				case <-time.After(10 * time.Second):
 					a.logger.Debugf("mysql.applier: no binlogEntry for 10s")
 				case <-a.shutdownCh:
@@ -765,6 +1065,7 @@ func (a *Applier) initiateStreaming() error {
 		}()
 	} else {
 		_, err := a.natsConn.Subscribe(fmt.Sprintf("%s_incr", a.subject), func(m *gonats.Msg) {
+			defer a.recoverPanic()
 			var binlogTx []*binlog.BinlogTx
 			if err := Decode(m.Data, &binlogTx); err != nil {
 				a.onError(TaskStateDead, err)
@@ -785,6 +1086,7 @@ func (a *Applier) initiateStreaming() error {
 	}
 
 	go func() {
+		defer a.recoverPanic()
 		var lastCommitted int64
 		var err error
 		//timeout := time.After(100 * time.Millisecond)
@@ -840,11 +1142,16 @@ func (a *Applier) initDBConnections() (err error) {
 	if a.db, err = sql.CreateDB(applierUri); err != nil {
 		return err
 	}
-	a.db.SetMaxOpenConns(10 + a.mysqlContext.ParallelWorkers)
+	if err := validateMaxConnections(a.mysqlContext); err != nil {
+		return err
+	}
+	a.db.SetMaxOpenConns(maxOpenConns(a.mysqlContext, a.mysqlContext.ParallelWorkers))
 
-	if a.dbs, err = sql.CreateConns(a.db, a.mysqlContext.ParallelWorkers); err != nil {
+	if a.dbs, err = sql.CreateConns(a.db, workerConns(a.mysqlContext, a.mysqlContext.ParallelWorkers)); err != nil {
 		return err
 	}
+	a.setConnPool(newConnPool(len(a.dbs)))
+	a.warnMaxConnections(a.mysqlContext.ParallelWorkers)
 
 	if err := a.validateConnection(a.db); err != nil {
 		return err
@@ -862,27 +1169,39 @@ func (a *Applier) initDBConnections() (err error) {
 	if err := a.validateAndReadTimeZone(); err != nil {
 		return err
 	}
+	if err := ValidateColumnFilters(a.db, a.mysqlContext.ReplicateDoDb, a.nameMapping); err != nil {
+		return err
+	}
+	if err := ValidateRouting(a.db, a.mysqlContext.ReplicateDoDb, a.nameMapping); err != nil {
+		return err
+	}
+	if err := ValidateColumnConversions(a.db, a.mysqlContext.ReplicateDoDb, a.nameMapping); err != nil {
+		return err
+	}
+	warnings, err := ValidateOperations(a.mysqlContext.ReplicateDoDb)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		a.logger.Warnf("mysql.applier: %s", warning)
+	}
 
 	if a.mysqlContext.ApproveHeterogeneous {
 		if err := a.createTableGtidExecutedV2(); err != nil {
 			return err
 		}
-
-		for i := range a.dbs {
-			a.dbs[i].PsDeleteExecutedGtid, err = a.dbs[i].Db.PrepareContext(context.Background(), fmt.Sprintf("delete from %v.%v where job_uuid = unhex('%s') and source_uuid = ?",
-				g.DtleSchemaName, g.GtidExecutedTableV2, hex.EncodeToString(a.subjectUUID.Bytes())))
-			if err != nil {
+		if a.mysqlContext.SplitTransactionRows > 0 {
+			a.logger.Warnf("mysql.applier: transactions of more than %d rows are committed in parts, the target holds them partially until they are fully applied",
+				a.mysqlContext.SplitTransactionRows)
+			if err := a.createTableSplitProgress(); err != nil {
 				return err
 			}
-			a.dbs[i].PsInsertExecutedGtid, err = a.dbs[i].Db.PrepareContext(context.Background(), fmt.Sprintf("replace into %v.%v "+
-				"(job_uuid,source_uuid,interval_gtid) "+
-				"values (unhex('%s'), ?, ?)",
-				g.DtleSchemaName, g.GtidExecutedTableV2,
-				hex.EncodeToString(a.subjectUUID.Bytes())))
-			if err != nil {
+		}
+
+		for i := range a.dbs {
+			if err := a.prepareGtidExecutedStmts(a.dbs[i]); err != nil {
 				return err
 			}
-
 		}
 	}
 	/*if err := a.readCurrentBinlogCoordinates(); err != nil {
@@ -981,6 +1300,63 @@ func (a *Applier) validateAndReadTimeZone() error {
 	return nil
 }
 
+// tableConfig returns the configuration of the source table schema.table,
+// or nil
+func (a *Applier) tableConfig(schema, table string) *config.Table {
+	for _, ds := range a.mysqlContext.ReplicateDoDb {
+		if ds.TableSchema != schema {
+			continue
+		}
+		for _, tb := range ds.Tables {
+			if tb.TableName == table {
+				return tb
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateColumnFilters checks the column filters of doDbs against the
+// target tables that already exist. Tables created later are checked once
+// rows are applied to them.
+func ValidateColumnFilters(db sql.QueryAble, doDbs []*config.DataSource, mapping *sql.NameMapping) error {
+	for _, ds := range doDbs {
+		for _, tb := range ds.Tables {
+			if !tb.HasColumnFilter() || tb.Routing != nil {
+				// ValidateRouting checks the target tables of routed tables
+				continue
+			}
+			schema, table := mapping.Table(ds.TableSchema, tb.TableName)
+			columns, err := base.GetTableColumns(db, schema, table)
+			if sql.IsNotExistsError(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if _, err := tb.ReplicatedColumns(columns); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prepareGtidExecutedStmts prepares the statements writing the checkpoint
+// of the job on conn
+func (a *Applier) prepareGtidExecutedStmts(conn *sql.Conn) (err error) {
+	conn.PsDeleteExecutedGtid, err = conn.Db.PrepareContext(context.Background(), fmt.Sprintf("delete from %v.%v where job_uuid = unhex('%s') and source_uuid = ?",
+		g.DtleSchemaName, g.GtidExecutedTableV2, hex.EncodeToString(a.subjectUUID.Bytes())))
+	if err != nil {
+		return err
+	}
+	conn.PsInsertExecutedGtid, err = conn.Db.PrepareContext(context.Background(), fmt.Sprintf("replace into %v.%v "+
+		"(job_uuid,source_uuid,interval_gtid) "+
+		"values (unhex('%s'), ?, ?)",
+		g.DtleSchemaName, g.GtidExecutedTableV2,
+		hex.EncodeToString(a.subjectUUID.Bytes())))
+	return err
+}
+
 func (a *Applier) createTableGtidExecutedV2() error {
 	if result, err := sql.QueryResultData(a.db, fmt.Sprintf("SHOW TABLES FROM %v LIKE '%v'",
 		g.DtleSchemaName, g.GtidExecutedTableV2)); nil == err && len(result) > 0 {
@@ -1007,6 +1383,29 @@ func (a *Applier) createTableGtidExecutedV2() error {
 	return nil
 }
 
+// resetTableItems resets the items of the source tables whose definition
+// changed, once the transactions using them are committed, so that their
+// columns, converters and transcoders are loaded again. It returns false
+// on shutdown.
+func (a *Applier) resetTableItems(tables []binlog.SchemaTable) bool {
+	waited := false
+	for _, t := range tables {
+		tableItem, ok := a.tableItems[t.Schema][t.Table]
+		if !ok || (tableItem.columns == nil && tableItem.routed == nil) {
+			continue
+		}
+		if !waited {
+			if !a.mtsManager.WaitForAllCommitted() {
+				return false
+			}
+			waited = true
+		}
+		a.logger.Debugf("mysql.applier: reset tableItem %v.%v, its definition changed", t.Schema, t.Table)
+		tableItem.Reset()
+	}
+	return true
+}
+
 func (a *Applier) getTableItem(schema string, table string) *applierTableItem {
 	schemaItem, ok := a.tableItems[schema]
 	if !ok {
@@ -1029,6 +1428,10 @@ func (a *Applier) buildDMLEventQuery(dmlEvent binlog.DataEvent, workerIdx int) (
 	// Large piece of code deleted here. See git annotate.
 	tableItem := dmlEvent.TableItem.(*applierTableItem)
 	var tableColumns = tableItem.columns
+	schema, table := a.nameMapping.Table(dmlEvent.DatabaseName, dmlEvent.TableName)
+	if tableItem.targetTable != "" {
+		table = tableItem.targetTable
+	}
 
 	doPrepareIfNil := func(stmts []*gosql.Stmt, query string) (*gosql.Stmt, error) {
 		var err error
@@ -1041,7 +1444,7 @@ func (a *Applier) buildDMLEventQuery(dmlEvent binlog.DataEvent, workerIdx int) (
 	switch dmlEvent.DML {
 	case binlog.DeleteDML:
 		{
-			query, uniqueKeyArgs, err := sql.BuildDMLDeleteQuery(dmlEvent.DatabaseName, dmlEvent.TableName, tableColumns, dmlEvent.WhereColumnValues.GetAbstractValues())
+			query, uniqueKeyArgs, err := sql.BuildDMLDeleteQuery(schema, table, tableColumns, dmlEvent.WhereColumnValues.GetAbstractValues())
 			if err != nil {
 				return nil, nil, -1, err
 			}
@@ -1054,7 +1457,7 @@ func (a *Applier) buildDMLEventQuery(dmlEvent binlog.DataEvent, workerIdx int) (
 	case binlog.InsertDML:
 		{
 			// TODO no need to generate query string every time
-			query, sharedArgs, err := sql.BuildDMLInsertQuery(dmlEvent.DatabaseName, dmlEvent.TableName, tableColumns, tableColumns, tableColumns, dmlEvent.NewColumnValues.GetAbstractValues())
+			query, sharedArgs, err := sql.BuildDMLInsertQuery(schema, table, tableColumns, tableColumns, tableColumns, dmlEvent.NewColumnValues.GetAbstractValues())
 			if err != nil {
 				return nil, nil, -1, err
 			}
@@ -1066,7 +1469,7 @@ func (a *Applier) buildDMLEventQuery(dmlEvent binlog.DataEvent, workerIdx int) (
 		}
 	case binlog.UpdateDML:
 		{
-			query, sharedArgs, uniqueKeyArgs, err := sql.BuildDMLUpdateQuery(dmlEvent.DatabaseName, dmlEvent.TableName, tableColumns, tableColumns, tableColumns, tableColumns, dmlEvent.NewColumnValues.GetAbstractValues(), dmlEvent.WhereColumnValues.GetAbstractValues())
+			query, sharedArgs, uniqueKeyArgs, err := sql.BuildDMLUpdateQuery(schema, table, tableColumns, tableColumns, tableColumns, tableColumns, dmlEvent.NewColumnValues.GetAbstractValues(), dmlEvent.WhereColumnValues.GetAbstractValues())
 			if err != nil {
 				return nil, nil, -1, err
 			}
@@ -1084,25 +1487,196 @@ func (a *Applier) buildDMLEventQuery(dmlEvent binlog.DataEvent, workerIdx int) (
 	return nil, args, 0, fmt.Errorf("Unknown dml event type: %+v", dmlEvent.DML)
 }
 
-// ApplyEventQueries applies multiple DML queries onto the dest table
-func (a *Applier) ApplyBinlogEvent(workerIdx int, binlogEntry *binlog.BinlogEntry) error {
+// applyRow applies the row event in the transaction of the worker, and
+// returns the change of the row count of the target
+func (a *Applier) applyRow(event binlog.DataEvent, workerIdx int) (int64, error) {
+	if changes := a.jsonChanges(event); changes != nil {
+		return a.applyPartialUpdate(event, changes, workerIdx)
+	}
+	stmt, args, rowDelta, err := a.buildDMLEventQuery(event, workerIdx)
+	if err != nil {
+		a.logger.Errorf("mysql.applier: Build dml query error: %v", err)
+		return 0, err
+	}
+
+	a.logger.Debugf("ApplyBinlogEvent. args: %v", args)
+
+	// Statements of dbApplier.Db run in the session of tx
+	if _, err := stmt.Exec(args...); err != nil {
+		return 0, err
+	}
+	return rowDelta, nil
+}
+
+// applyDDLRules returns the statement to execute for query, or "" to skip
+// it, as the DDL rules decide. Skipped and rewritten statements are
+// logged and reported in a task event, and only reported in a dry run.
+// where tells where query comes from.
+func (a *Applier) applyDDLRules(query string, where string) (string, error) {
+	d := a.ddlRules.Decide(query)
+	if d.Action == config.DDLActionApply {
+		return query, nil
+	}
+
+	var message string
+	switch d.Action {
+	case config.DDLActionSkip:
+		message = fmt.Sprintf("DDL rule %d skips %s statement in %s: %s", d.Rule, d.StatementType, where, query)
+	case config.DDLActionRewrite:
+		message = fmt.Sprintf("DDL rule %d rewrites %s statement in %s: %s => %s", d.Rule, d.StatementType, where, query, d.Query)
+	case config.DDLActionFail:
+		message = fmt.Sprintf("DDL rule %d fails on %s statement in %s: %s", d.Rule, d.StatementType, where, query)
+	}
+	if a.mysqlContext.DDLDryRun {
+		message = "dry run: " + message
+		a.logger.Warnf("mysql.applier: %s", message)
+		a.emit(message)
+		return query, nil
+	}
+	if d.Action == config.DDLActionFail {
+		return "", errors.New(message)
+	}
+	a.logger.Warnf("mysql.applier: %s", message)
+	a.emit(message)
+	if d.Action == config.DDLActionSkip {
+		return "", nil
+	}
+	return d.Query, nil
+}
+
+// completeReplay ends the task once the replay applied all of its
+// transactions
+func (a *Applier) completeReplay() {
+	message := fmt.Sprintf("replay of %v complete: %d transactions applied", a.replay, a.replay.applied)
+	a.logger.Infof("mysql.applier: %s", message)
+	a.emit(message)
+	a.onError(TaskStateComplete, nil)
+}
+
+// emit reports message in a task event
+func (a *Applier) emit(message string) {
+	if a.emitEvent != nil {
+		a.emitEvent("%s", message)
+	}
+}
+
+// loadGtidExecuted reads the transactions the job applied from the
+// checkpoint table, so that they are skipped, and adds them to the
+// committed GTID set. The parts of the transactions split are skipped too.
+func (a *Applier) loadGtidExecuted() (err error) {
+	a.gtidExecuted, err = base.SelectAllGtidExecuted(a.db, a.subjectUUID)
+	if err != nil {
+		return err
+	}
+	if err := a.loadSplitProgress(); err != nil {
+		return err
+	}
+	committed, err := gomysql.ParseMysqlGTIDSet(a.mysqlContext.Gtid)
+	if err != nil {
+		return err
+	}
+
+	a.gtidCommittedMutex.Lock()
+	defer a.gtidCommittedMutex.Unlock()
+	a.gtidCommitted = committed.(*gomysql.MysqlGTIDSet)
+	for sid, item := range a.gtidExecuted {
+		// Normalizing sorts the intervals in place
+		intervals := append(gomysql.IntervalSlice(nil), item.Intervals...)
+		a.gtidCommitted.AddSet(gomysql.NewUUIDSet(sid, intervals...))
+	}
+	a.mysqlContext.Gtid = a.gtidCommitted.String()
+	return nil
+}
+
+// addCommittedGtid adds the transaction at coordinates to the committed
+// GTID set once the target committed it
+func (a *Applier) addCommittedGtid(coordinates base.BinlogCoordinateTx) {
+	a.gtidCommittedMutex.Lock()
+	defer a.gtidCommittedMutex.Unlock()
+	if a.gtidCommitted == nil {
+		return
+	}
+	a.gtidCommitted.AddSet(gomysql.NewUUIDSet(coordinates.SID,
+		gomysql.Interval{Start: coordinates.GNO, Stop: coordinates.GNO + 1}))
+	a.mysqlContext.Gtid = a.gtidCommitted.String()
+	a.lastAppliedGtid = coordinates.GetGtidForThisTx()
+}
+
+// applyPooled applies binlogEntry with ApplyBinlogEvent on a connection of
+// the pool, once one is free
+func (a *Applier) applyPooled(binlogEntry *binlog.BinlogEntry) error {
+	pool := a.workerConnPool()
+	idx, ok := pool.get(a.shutdownCh)
+	if !ok {
+		return nil // shutdown
+	}
+	defer pool.put(idx)
+	return a.ApplyBinlogEvent(idx, binlogEntry)
+}
+
+// ApplyBinlogEvent applies a transaction onto the dest tables, together
+// with its checkpoint: either both are committed or neither is, so a
+// restart resumes right after the last committed transaction.
+func (a *Applier) ApplyBinlogEvent(workerIdx int, binlogEntry *binlog.BinlogEntry) (err error) {
 	dbApplier := a.dbs[workerIdx]
 
 	var totalDelta int64
-	var err error
 
 	txSid := binlogEntry.Coordinates.GetSid()
 
+	var rows int64
+	for _, event := range binlogEntry.Events {
+		if event.DML != binlog.NotDML {
+			rows++
+		}
+	}
+	a.throttle.wait(int64(binlogEntry.OriginalSize), rows, a.shutdownCh)
+	// The resumed copy may already hold the transaction
+	replaying := a.dumpCheckpoint.replaying(binlogEntry.Coordinates)
+
 	dbApplier.DbMutex.Lock()
+	applyStart := time.Now()
+	// The last part of a split transaction is committed as a transaction
+	from, err := a.applySplit(workerIdx, binlogEntry, replaying)
+	if err != nil {
+		a.logger.Errorf("mysql.applier: gtid: %s:%d, error: %v", txSid, binlogEntry.Coordinates.GNO, err)
+		dbApplier.DbMutex.Unlock()
+		return err
+	}
 	tx, err := dbApplier.Db.BeginTx(context.Background(), &gosql.TxOptions{})
 	if err != nil {
+		dbApplier.DbMutex.Unlock()
 		return err
 	}
 	defer func() {
-		if err := tx.Commit(); err != nil {
-			a.onError(TaskStateDead, err)
-		} else {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				a.logger.Errorf("mysql.applier: gtid: %s:%d, rollback error: %v", txSid, binlogEntry.Coordinates.GNO, rbErr)
+			}
+		} else if err = tx.Commit(); err == nil {
+			if from > 0 {
+				a.splits.set(binlogEntry.Coordinates.GetGtidForThisTx(), 0)
+			}
 			a.mtsManager.Executed(binlogEntry)
+			a.addCommittedGtid(binlogEntry.Coordinates)
+			if binlogEntry.Coordinates.Timestamp != 0 {
+				atomic.StoreInt64(&a.lagSeconds, time.Now().Unix()-int64(binlogEntry.Coordinates.Timestamp))
+			}
+			if binlogEntry.Heartbeat != 0 {
+				atomic.StoreInt64(&a.lastHeartbeat, binlogEntry.Heartbeat)
+			}
+			atomic.AddInt64(&a.rowsApplied, rows)
+			atomic.AddInt64(&a.bytesApplied, int64(binlogEntry.OriginalSize))
+			elapsed := time.Since(applyStart)
+			a.scaler.observe(elapsed)
+			if a.slowLog.slow(elapsed) {
+				a.slowLog.add(&slowTransaction{
+					gtid:     binlogEntry.Coordinates.GetGtidForThisTx(),
+					duration: elapsed,
+					rows:     rows,
+					tables:   a.entryTables(binlogEntry),
+				})
+			}
 		}
 		if a.printTps {
 			atomic.AddUint32(&a.txLastNSeconds, 1)
@@ -1111,7 +1685,36 @@ func (a *Applier) ApplyBinlogEvent(workerIdx int, binlogEntry *binlog.BinlogEntr
 		dbApplier.DbMutex.Unlock()
 	}()
 
-	for i, event := range binlogEntry.Events {
+	delta, err := a.applyEvents(tx, workerIdx, binlogEntry, from, len(binlogEntry.Events), replaying)
+	if err != nil {
+		return err
+	}
+	totalDelta += delta
+	if from > 0 {
+		if err = a.deleteSplitProgress(tx, binlogEntry.Coordinates); err != nil {
+			return err
+		}
+	}
+
+	a.logger.Debugf("ApplyBinlogEvent. insert gno: %v", binlogEntry.Coordinates.GNO)
+	_, err = dbApplier.PsInsertExecutedGtid.Exec(binlogEntry.Coordinates.SID.Bytes(), binlogEntry.Coordinates.GNO)
+	if err != nil {
+		return err
+	}
+
+	// no error
+	a.mysqlContext.Stage = models.StageWaitingForGtidToBeCommitted
+	atomic.AddInt64(&a.mysqlContext.TotalDeltaCopied, 1)
+	return nil
+}
+
+// applyEvents applies the events of binlogEntry from from to to in tx, and
+// returns the change of the row count of the target
+func (a *Applier) applyEvents(tx *gosql.Tx, workerIdx int, binlogEntry *binlog.BinlogEntry, from, to int,
+	replaying bool) (totalDelta int64, err error) {
+	txSid := binlogEntry.Coordinates.GetSid()
+	for i := from; i < to; i++ {
+		event := binlogEntry.Events[i]
 		a.logger.Debugf("mysql.applier: ApplyBinlogEvent. gno: %v, event: %v",
 			binlogEntry.Coordinates.GNO, i)
 		switch event.DML {
@@ -1119,15 +1722,28 @@ func (a *Applier) ApplyBinlogEvent(workerIdx int, binlogEntry *binlog.BinlogEntr
 			var err error
 			a.logger.Debugf("mysql.applier: ApplyBinlogEvent: not dml: %v", event.Query)
 
+			eventQuery, err := a.applyDDLRules(event.Query, fmt.Sprintf("gtid %s:%d", txSid, binlogEntry.Coordinates.GNO))
+			if err != nil {
+				return 0, err
+			}
+			if eventQuery == "" {
+				continue
+			}
+			eventQuery, _, err = a.nameMapping.RewriteQuery(eventQuery, event.CurrentSchema)
+			if err != nil {
+				a.logger.Errorf("mysql.applier: gtid: %s:%d, error: %v", txSid, binlogEntry.Coordinates.GNO, err)
+				return 0, err
+			}
+
 			if event.CurrentSchema != "" {
 				// TODO escape schema name?
-				query := fmt.Sprintf("USE %s", event.CurrentSchema)
+				query := fmt.Sprintf("USE %s", a.nameMapping.Schema(event.CurrentSchema))
 				a.logger.Debugf("mysql.applier: query: %v", query)
 				_, err = tx.Exec(query)
 				if err != nil {
 					if !sql.IgnoreError(err) {
 						a.logger.Errorf("mysql.applier: Exec sql error: %v", err)
-						return err
+						return 0, err
 					} else {
 						a.logger.Warnf("mysql.applier: Ignore error: %v", err)
 					}
@@ -1155,51 +1771,73 @@ func (a *Applier) ApplyBinlogEvent(workerIdx int, binlogEntry *binlog.BinlogEntr
 				}
 			}
 
-			_, err = tx.Exec(event.Query)
+			_, err = tx.Exec(eventQuery)
+			if err != nil && a.skipError(err, fmt.Sprintf("gtid %s:%d", txSid, binlogEntry.Coordinates.GNO), eventQuery) {
+				continue
+			}
 			if err != nil {
 				if !sql.IgnoreError(err) {
 					a.logger.Errorf("mysql.applier: Exec sql error: %v", err)
-					return err
+					return 0, err
 				} else {
 					a.logger.Warnf("mysql.applier: Ignore error: %v", err)
 				}
 			}
-			a.logger.Debugf("mysql.applier: Exec [%s]", event.Query)
+			a.logger.Debugf("mysql.applier: Exec [%s]", eventQuery)
 		default:
 			a.logger.Debugf("mysql.applier: ApplyBinlogEvent: a dml event")
-			stmt, args, rowDelta, err := a.buildDMLEventQuery(event, workerIdx)
-			if err != nil {
-				a.logger.Errorf("mysql.applier: Build dml query error: %v", err)
-				return err
+			var rowDelta int64
+			if n := a.batchLength(binlogEntry.Events[i:to], replaying); n > 1 {
+				if rowDelta, err = a.applyBatch(binlogEntry.Events[i:i+n], workerIdx); err != nil {
+					a.logger.Errorf("mysql.applier: gtid: %s:%d, error: %v", txSid, binlogEntry.Coordinates.GNO, err)
+					return 0, err
+				}
+				totalDelta += rowDelta
+				i += n - 1
+				continue
+			}
+			if event, err = a.convertEvent(event); err != nil {
+				a.logger.Errorf("mysql.applier: gtid: %s:%d, error: %v", txSid, binlogEntry.Coordinates.GNO, err)
+				return 0, err
+			}
+			if replaying {
+				rowDelta, err = a.replayRow(tx, event, workerIdx)
+			} else if a.conflicts != nil {
+				rowDelta, err = a.applyRowWithConflicts(tx, event, workerIdx)
+			} else {
+				rowDelta, err = a.applyRow(event, workerIdx)
+			}
+			if err != nil && a.skipError(err, fmt.Sprintf("gtid %s:%d", txSid, binlogEntry.Coordinates.GNO), a.rowStatement(event)) {
+				continue
 			}
-
-			a.logger.Debugf("ApplyBinlogEvent. args: %v", args)
-
-			_, err = stmt.Exec(args...)
 			if err != nil {
 				a.logger.Errorf("mysql.applier: gtid: %s:%d, error: %v", txSid, binlogEntry.Coordinates.GNO, err)
-				return err
+				return 0, err
 			}
 			totalDelta += rowDelta
 		}
 	}
+	return totalDelta, nil
+}
 
-	a.logger.Debugf("ApplyBinlogEvent. insert gno: %v", binlogEntry.Coordinates.GNO)
-	_, err = dbApplier.PsInsertExecutedGtid.Exec(binlogEntry.Coordinates.SID.Bytes(), binlogEntry.Coordinates.GNO)
-	if err != nil {
-		return err
+func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *DumpEntry) (err error) {
+	var size int64
+	for _, values := range entry.ValuesX {
+		for _, value := range values {
+			if b, ok := (*value).([]byte); ok {
+				size += int64(len(b))
+			}
+		}
 	}
+	a.throttle.wait(size, int64(len(entry.ValuesX)), a.shutdownCh)
 
-	// no error
-	a.mysqlContext.Stage = models.StageWaitingForGtidToBeCommitted
-	atomic.AddInt64(&a.mysqlContext.TotalDeltaCopied, 1)
-	return nil
-}
-
-func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *DumpEntry) error {
+	tb := a.tableConfig(entry.TableSchema, entry.TableName)
 	queries := []string{}
 	queries = append(queries, entry.SystemVariablesStatement, entry.SqlMode, entry.DbSQL)
-	queries = append(queries, entry.TbSQL...)
+	if tb == nil || tb.Routing == nil {
+		// The target tables of a routed table are not created, they must exist
+		queries = append(queries, entry.TbSQL...)
+	}
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -1207,6 +1845,12 @@ func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *DumpEntry) error {
 	defer func() {
 		if err := tx.Commit(); err != nil {
 			a.onError(TaskStateDead, err)
+		} else {
+			atomic.AddInt64(&a.rowsApplied, entry.RowsCount)
+			atomic.AddInt64(&a.bytesApplied, size)
+			if err == nil && a.mysqlContext.ApproveHeterogeneous {
+				a.dumpCheckpoint.chunkCopied(entry)
+			}
 		}
 		atomic.AddInt64(&a.mysqlContext.TotalRowsReplay, entry.RowsCount)
 	}()
@@ -1229,39 +1873,130 @@ func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *DumpEntry) error {
 		return nil
 	}
 
+	// Structure queries pick their schema with USE
+	var currentSchema string
 	for _, query := range queries {
 		if query == "" {
 			continue
 		}
+		query = rewriteCreateTable(query, tb, a.mysqlContext.SkipCreateIndexes, a.mysqlContext.SkipCreateForeignKeys)
+		query, err = a.applyDDLRules(query, fmt.Sprintf("the copy of %s.%s", entry.TableSchema, entry.TableName))
+		if err != nil {
+			return err
+		}
+		if query == "" {
+			continue
+		}
+		query, currentSchema, err = a.nameMapping.RewriteQuery(query, currentSchema)
+		if err != nil {
+			return err
+		}
 		err := execQuery(query)
 		if err != nil {
 			return err
 		}
 	}
 
+	schema, table := a.nameMapping.Table(entry.TableSchema, entry.TableName)
+	// The columns of the source, which the copied rows follow
+	var source *umconf.ColumnList
+	if entry.Table != nil {
+		source = entry.Table.OriginalTableColumns
+	}
+	if tb != nil && tb.Routing != nil && len(entry.ValuesX) > 0 {
+		columns := source
+		if columns == nil {
+			if columns, err = base.GetTableColumns(tx, schema, tb.Routing.TargetTables()[0]); err != nil {
+				return err
+			}
+		}
+		ordinal, err := routingOrdinal(columns, tb.Routing.Column)
+		if err != nil {
+			return err
+		}
+		tables, byTable, err := routeDumpRows(tb, ordinal, entry.ValuesX)
+		if err != nil {
+			return err
+		}
+		// One batch per target table
+		for _, table := range tables {
+			if err := a.copyRows(tx, execQuery, tb, source, schema, table, byTable[table]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return a.copyRows(tx, execQuery, tb, source, schema, table, entry.ValuesX)
+}
+
+// copyRows writes the copied rows to schema.table with execQuery,
+// replicating the columns tb keeps, converted as tb says. The rows follow
+// the columns of source, if the extractor sent them.
+func (a *Applier) copyRows(tx *gosql.Tx, execQuery func(string) error, tb *config.Table, source *umconf.ColumnList, schema, table string, rows [][]*interface{}) error {
+	insertStmt := fmt.Sprintf(`replace into %s.%s values (`, schema, table)
+	// ordinals of the replicated values in a row, nil for all of them
+	var ordinals []int
+	var converters []*columnConverter
+	if tb != nil && (tb.HasColumnFilter() || len(tb.ColumnConversions) > 0) && len(rows) > 0 {
+		columns, err := base.GetTableColumns(tx, schema, table)
+		if err != nil {
+			return err
+		}
+		columns, err = tb.ReplicatedColumns(columns)
+		if err != nil {
+			return err
+		}
+		if columns, err = sourceOrdinals(columns, source); err != nil {
+			return fmt.Errorf("%s.%s: %v", schema, table, err)
+		}
+		if converters, err = newColumnConverters(tb, columns); err != nil {
+			return err
+		}
+		if tb.HasColumnFilter() {
+			names := make([]string, columns.Len())
+			for i, col := range columns.ColumnList() {
+				names[i] = sql.EscapeName(col.Name)
+				ordinals = append(ordinals, columns.Ordinals[col.Name])
+			}
+			insertStmt = fmt.Sprintf(`replace into %s.%s (%s) values (`, schema, table, strings.Join(names, ","))
+		}
+	}
+
 	var buf bytes.Buffer
 	BufSizeLimit := 1 * 1024 * 1024 // 1MB. TODO parameterize it
 	BufSizeLimitDelta := 1024
 	buf.Grow(BufSizeLimit + BufSizeLimitDelta)
-	for i, _ := range entry.ValuesX {
+	for i, _ := range rows {
 		if buf.Len() == 0 {
-			buf.WriteString(fmt.Sprintf(`replace into %s.%s values (`, entry.TableSchema, entry.TableName))
+			buf.WriteString(insertStmt)
 		} else {
 			buf.WriteString(",(")
 		}
 
+		values, err := a.convertValues(converters, rows[i])
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", tb.TableSchema, tb.TableName, err)
+		}
+		if ordinals != nil {
+			row := values
+			values = make([]*interface{}, len(ordinals))
+			for k, ordinal := range ordinals {
+				values[k] = row[ordinal]
+			}
+		}
+
 		firstCol := true
-		for j := range entry.ValuesX[i] {
+		for j := range values {
 			if firstCol {
 				firstCol = false
 			} else {
 				buf.WriteByte(',')
 			}
 
-			colData := entry.ValuesX[i][j]
+			colData := values[j]
 			if *colData != nil {
 				buf.WriteByte('\'')
-				buf.WriteString(sql.EscapeValue(string((*colData).([]byte))))
+				buf.WriteString(sql.EscapeValue(valueText(*colData)))
 				buf.WriteByte('\'')
 			} else {
 				buf.WriteString("NULL")
@@ -1269,7 +2004,7 @@ func (a *Applier) ApplyEventQueries(db *gosql.DB, entry *DumpEntry) error {
 		}
 		buf.WriteByte(')')
 
-		needInsert := (i == len(entry.ValuesX)-1) || (buf.Len() >= BufSizeLimit)
+		needInsert := (i == len(rows)-1) || (buf.Len() >= BufSizeLimit)
 		// last rows or sql too large
 
 		if needInsert {
@@ -1325,6 +2060,22 @@ func (a *Applier) Stats() (*models.TaskStatistics, error) {
 		}
 	}
 
+	// Transactions received but not being applied, and the lag of the last
+	// one applied if any is left
+	delay := &models.DelayCount{
+		Num: uint64(len(a.applyDataEntryQueue) + len(a.applyBinlogMtsTxQueue)),
+	}
+	if lag := atomic.LoadInt64(&a.lagSeconds); delay.Num > 0 && lag > 0 {
+		delay.Time = uint64(lag)
+	}
+	// Time spent throttled tells whether the throttle causes the lag
+	delay.ThrottledSeconds = a.throttle.waitedSeconds()
+	// The age of the last heartbeat keeps growing when replication stalls,
+	// with or without transactions waiting
+	if heartbeat := atomic.LoadInt64(&a.lastHeartbeat); heartbeat != 0 {
+		delay.LagSeconds = time.Since(time.Unix(0, heartbeat)).Seconds()
+	}
+
 	taskResUsage := models.TaskStatistics{
 		ExecMasterRowCount: totalRowsReplay,
 		ExecMasterTxCount:  totalDeltaCopied,
@@ -1339,8 +2090,22 @@ func (a *Applier) Stats() (*models.TaskStatistics, error) {
 			ApplierTxQueueSize:      len(a.applyBinlogTxQueue),
 			ApplierGroupTxQueueSize: len(a.applyBinlogGroupTxQueue),
 		},
-		Timestamp: time.Now().UTC().UnixNano(),
-	}
+		DelayCount:   delay,
+		RowsApplied:  atomic.LoadInt64(&a.rowsApplied),
+		BytesApplied: atomic.LoadInt64(&a.bytesApplied),
+		Timestamp:    time.Now().UTC().UnixNano(),
+
+		SlowTransactions: a.slowLog.slowTransactions(),
+		BatchStatements:  atomic.LoadInt64(&a.batchStatements),
+		BatchedRows:      atomic.LoadInt64(&a.batchedRows),
+		DroppedRows:      atomic.LoadInt64(&a.droppedRows),
+		SkippedErrors:    a.skipErrors.count(),
+		Connections:      a.connectionStat(),
+		ParallelWorkers:  int(atomic.LoadInt64(&a.parallelWorkers)),
+	}
+	a.gtidCommittedMutex.Lock()
+	taskResUsage.LastAppliedGtid = a.lastAppliedGtid
+	a.gtidCommittedMutex.Unlock()
 	if a.natsConn != nil {
 		taskResUsage.MsgStat = a.natsConn.Statistics
 	}
@@ -1359,6 +2124,9 @@ func (a *Applier) ID() string {
 			ConnectionConfig:  a.mysqlContext.ConnectionConfig,
 		},
 	}
+	if a.mysqlContext.Gtid == "" {
+		id.DriverConfig.DumpCheckpoint = a.dumpCheckpoint.get()
+	}
 
 	data, err := json.Marshal(id)
 	if err != nil {
@@ -1392,10 +2160,70 @@ func (a *Applier) onError(state int, err error) {
 	a.Shutdown()
 }
 
+// recoverPanic, deferred by the goroutines of the applier, fails the task
+// rather than the whole process when they panic
+func (a *Applier) recoverPanic() {
+	if r := recover(); r != nil {
+		err := models.NewPanicError(r)
+		a.logger.Errorf("mysql.applier: %v", err)
+		a.onError(TaskStateRestart, err)
+	}
+}
+
 func (a *Applier) WaitCh() chan *models.WaitResult {
 	return a.waitCh
 }
 
+// SetThrottle changes the rates the applier writes to the target at, in
+// bytes and rows per second, 0 not to limit them
+func (a *Applier) SetThrottle(bytesPerSecond, rowsPerSecond int64) error {
+	if bytesPerSecond < 0 || rowsPerSecond < 0 {
+		return fmt.Errorf("negative throttle: %d bytes and %d rows per second", bytesPerSecond, rowsPerSecond)
+	}
+	a.throttle.set(bytesPerSecond, rowsPerSecond)
+	a.logger.Printf("mysql.applier: Throttling to %d bytes and %d rows per second", bytesPerSecond, rowsPerSecond)
+	return nil
+}
+
+// Pause stops applying, once the transactions being applied are committed
+// along with their checkpoint. The extractor then holds the events back, as
+// they are no longer acked.
+func (a *Applier) Pause() error {
+	if a.pauser.set(true) {
+		a.logger.Printf("mysql.applier: Pausing")
+	}
+	return nil
+}
+
+// Resume goes on applying from the checkpoint the applier paused at
+func (a *Applier) Resume() error {
+	if a.pauser.set(false) {
+		a.logger.Printf("mysql.applier: Resuming")
+	}
+	return nil
+}
+
+// waitResumed blocks while the applier is paused. Everything received
+// before was applied. It returns false on shutdown.
+func (a *Applier) waitResumed() bool {
+	a.gtidCommittedMutex.Lock()
+	checkpoint := a.mysqlContext.Gtid
+	a.gtidCommittedMutex.Unlock()
+	stage := a.mysqlContext.Stage
+	a.mysqlContext.Stage = models.StagePaused
+	a.logger.Printf("mysql.applier: Paused at %q", checkpoint)
+	a.emit(fmt.Sprintf("Paused at %q", checkpoint))
+
+	select {
+	case <-a.pauser.resumed():
+	case <-a.shutdownCh:
+		return false
+	}
+	a.mysqlContext.Stage = stage
+	a.logger.Printf("mysql.applier: Resumed from %q", checkpoint)
+	return true
+}
+
 func (a *Applier) Shutdown() error {
 	a.shutdownLock.Lock()
 	defer a.shutdownLock.Unlock()
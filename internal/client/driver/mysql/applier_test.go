@@ -9,15 +9,10 @@ package mysql
 import (
 	gosql "database/sql"
 	"reflect"
-	"sync"
 	"testing"
-	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
-	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
 	"github.com/actiontech/dtle/internal/config"
 	log "github.com/actiontech/dtle/internal/logger"
 	"github.com/actiontech/dtle/internal/models"
-
-	gonats "github.com/nats-io/go-nats"
 )
 
 func TestNewApplier(t *testing.T) {
@@ -36,7 +31,7 @@ func TestNewApplier(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewApplier(tt.args.subject, tt.args.tp, tt.args.cfg, tt.args.logger); !reflect.DeepEqual(got, tt.want) {
+			if got, _ := NewApplier(tt.args.subject, tt.args.tp, tt.args.cfg, tt.args.logger, nil); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewApplier() = %v, want %v", got, tt.want)
 			}
 		})
@@ -57,28 +52,6 @@ func TestApplier_Run(t *testing.T) {
 	}
 }
 
-func TestApplier_onApplyTxStruct(t *testing.T) {
-	type args struct {
-		dbApplier *sql.DB
-		binlogTx  *binlog.BinlogTx
-	}
-	tests := []struct {
-		name    string
-		a       *Applier
-		args    args
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.a.onApplyTxStruct(tt.args.dbApplier, tt.args.binlogTx); (err != nil) != tt.wantErr {
-				t.Errorf("Applier.onApplyTxStruct() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
 func TestApplier_executeWriteFuncs(t *testing.T) {
 	tests := []struct {
 		name string
@@ -165,23 +138,6 @@ func TestApplier_initDBConnections(t *testing.T) {
 	}
 }
 
-func TestApplier_validateServerUUID(t *testing.T) {
-	tests := []struct {
-		name string
-		a    *Applier
-		want string
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := tt.a.validateServerUUID(); got != tt.want {
-				t.Errorf("Applier.validateServerUUID() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func TestApplier_validateConnection(t *testing.T) {
 	type args struct {
 		db *gosql.DB
@@ -220,63 +176,6 @@ func TestApplier_validateAndReadTimeZone(t *testing.T) {
 	}
 }
 
-func TestApplier_buildDMLEventQuery(t *testing.T) {
-	type args struct {
-		dmlEvent binlog.DataEvent
-	}
-	tests := []struct {
-		name          string
-		a             *Applier
-		args          args
-		wantQuery     string
-		wantArgs      []interface{}
-		wantRowsDelta int64
-		wantErr       bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			gotQuery, gotArgs, gotRowsDelta, err := tt.a.buildDMLEventQuery(tt.args.dmlEvent)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Applier.buildDMLEventQuery() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if gotQuery != tt.wantQuery {
-				t.Errorf("Applier.buildDMLEventQuery() gotQuery = %v, want %v", gotQuery, tt.wantQuery)
-			}
-			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
-				t.Errorf("Applier.buildDMLEventQuery() gotArgs = %v, want %v", gotArgs, tt.wantArgs)
-			}
-			if gotRowsDelta != tt.wantRowsDelta {
-				t.Errorf("Applier.buildDMLEventQuery() gotRowsDelta = %v, want %v", gotRowsDelta, tt.wantRowsDelta)
-			}
-		})
-	}
-}
-
-func TestApplier_ApplyBinlogEvent(t *testing.T) {
-	type args struct {
-		db     *gosql.DB
-		events [](binlog.DataEvent)
-	}
-	tests := []struct {
-		name    string
-		a       *Applier
-		args    args
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.a.ApplyBinlogEvent(tt.args.db, tt.args.events); (err != nil) != tt.wantErr {
-				t.Errorf("Applier.ApplyBinlogEvent() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
 func TestApplier_ApplyEventQueries(t *testing.T) {
 	type args struct {
 		db    *gosql.DB
@@ -339,24 +238,6 @@ func TestApplier_ID(t *testing.T) {
 	}
 }
 
-func TestApplier_onError(t *testing.T) {
-	type args struct {
-		err error
-	}
-	tests := []struct {
-		name string
-		a    *Applier
-		args args
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.a.onError(tt.args.err)
-		})
-	}
-}
-
 func TestApplier_WaitCh(t *testing.T) {
 	tests := []struct {
 		name string
@@ -390,293 +271,3 @@ func TestApplier_Shutdown(t *testing.T) {
 		})
 	}
 }
-
-func TestApplier_onApplyTxStructWithSetGtid(t *testing.T) {
-	type fields struct {
-		logger                  *log.Entry
-		subject                 string
-		tp                      string
-		mysqlContext            *config.MySQLDriverConfig
-		dbs                     []*sql.DB
-		singletonDB             *gosql.DB
-		totalRowCount           int
-		applyRowCount           int
-		rowCopyComplete         chan bool
-		rowCopyCompleteFlag     int64
-		copyRowsQueue           chan *DumpEntry
-		applyDataEntryQueue     chan *binlog.BinlogEntry
-		applyBinlogTxQueue      chan *binlog.BinlogTx
-		applyBinlogGroupTxQueue chan []*binlog.BinlogTx
-		lastAppliedBinlogTx     *binlog.BinlogTx
-		natsConn                *gonats.Conn
-		waitCh                  chan *models.WaitResult
-		wg                      sync.WaitGroup
-		shutdown                bool
-		shutdownCh              chan struct{}
-		shutdownLock            sync.Mutex
-	}
-	type args struct {
-		dbApplier *sql.DB
-		binlogTx  *binlog.BinlogTx
-	}
-	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			a := &Applier{
-				logger:                  tt.fields.logger,
-				subject:                 tt.fields.subject,
-				tp:                      tt.fields.tp,
-				mysqlContext:            tt.fields.mysqlContext,
-				dbs:                     tt.fields.dbs,
-				singletonDB:             tt.fields.singletonDB,
-				totalRowCount:           tt.fields.totalRowCount,
-				applyRowCount:           tt.fields.applyRowCount,
-				rowCopyComplete:         tt.fields.rowCopyComplete,
-				rowCopyCompleteFlag:     tt.fields.rowCopyCompleteFlag,
-				copyRowsQueue:           tt.fields.copyRowsQueue,
-				applyDataEntryQueue:     tt.fields.applyDataEntryQueue,
-				applyBinlogTxQueue:      tt.fields.applyBinlogTxQueue,
-				applyBinlogGroupTxQueue: tt.fields.applyBinlogGroupTxQueue,
-				lastAppliedBinlogTx:     tt.fields.lastAppliedBinlogTx,
-				natsConn:                tt.fields.natsConn,
-				waitCh:                  tt.fields.waitCh,
-				wg:                      tt.fields.wg,
-				shutdown:                tt.fields.shutdown,
-				shutdownCh:              tt.fields.shutdownCh,
-				shutdownLock:            tt.fields.shutdownLock,
-			}
-			if err := a.onApplyTxStructWithSetGtid(tt.args.dbApplier, tt.args.binlogTx); (err != nil) != tt.wantErr {
-				t.Errorf("Applier.onApplyTxStructWithSetGtid() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestApplier_validateGrants(t *testing.T) {
-	type fields struct {
-		logger                  *log.Entry
-		subject                 string
-		tp                      string
-		mysqlContext            *config.MySQLDriverConfig
-		dbs                     []*sql.DB
-		singletonDB             *gosql.DB
-		totalRowCount           int
-		applyRowCount           int
-		rowCopyComplete         chan bool
-		rowCopyCompleteFlag     int64
-		copyRowsQueue           chan *DumpEntry
-		applyDataEntryQueue     chan *binlog.BinlogEntry
-		applyBinlogTxQueue      chan *binlog.BinlogTx
-		applyBinlogGroupTxQueue chan []*binlog.BinlogTx
-		lastAppliedBinlogTx     *binlog.BinlogTx
-		natsConn                *gonats.Conn
-		waitCh                  chan *models.WaitResult
-		wg                      sync.WaitGroup
-		shutdown                bool
-		shutdownCh              chan struct{}
-		shutdownLock            sync.Mutex
-	}
-	tests := []struct {
-		name    string
-		fields  fields
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			a := &Applier{
-				logger:                  tt.fields.logger,
-				subject:                 tt.fields.subject,
-				tp:                      tt.fields.tp,
-				mysqlContext:            tt.fields.mysqlContext,
-				dbs:                     tt.fields.dbs,
-				singletonDB:             tt.fields.singletonDB,
-				totalRowCount:           tt.fields.totalRowCount,
-				applyRowCount:           tt.fields.applyRowCount,
-				rowCopyComplete:         tt.fields.rowCopyComplete,
-				rowCopyCompleteFlag:     tt.fields.rowCopyCompleteFlag,
-				copyRowsQueue:           tt.fields.copyRowsQueue,
-				applyDataEntryQueue:     tt.fields.applyDataEntryQueue,
-				applyBinlogTxQueue:      tt.fields.applyBinlogTxQueue,
-				applyBinlogGroupTxQueue: tt.fields.applyBinlogGroupTxQueue,
-				lastAppliedBinlogTx:     tt.fields.lastAppliedBinlogTx,
-				natsConn:                tt.fields.natsConn,
-				waitCh:                  tt.fields.waitCh,
-				wg:                      tt.fields.wg,
-				shutdown:                tt.fields.shutdown,
-				shutdownCh:              tt.fields.shutdownCh,
-				shutdownLock:            tt.fields.shutdownLock,
-			}
-			if err := a.validateGrants(); (err != nil) != tt.wantErr {
-				t.Errorf("Applier.validateGrants() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestApplier_createTableGtidExecuted(t *testing.T) {
-	type fields struct {
-		logger                  *log.Entry
-		subject                 string
-		tp                      string
-		mysqlContext            *config.MySQLDriverConfig
-		dbs                     []*sql.DB
-		singletonDB             *gosql.DB
-		totalRowCount           int
-		applyRowCount           int
-		rowCopyComplete         chan bool
-		rowCopyCompleteFlag     int64
-		copyRowsQueue           chan *DumpEntry
-		applyDataEntryQueue     chan *binlog.BinlogEntry
-		applyBinlogTxQueue      chan *binlog.BinlogTx
-		applyBinlogGroupTxQueue chan []*binlog.BinlogTx
-		lastAppliedBinlogTx     *binlog.BinlogTx
-		natsConn                *gonats.Conn
-		waitCh                  chan *models.WaitResult
-		wg                      sync.WaitGroup
-		shutdown                bool
-		shutdownCh              chan struct{}
-		shutdownLock            sync.Mutex
-	}
-	tests := []struct {
-		name    string
-		fields  fields
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			a := &Applier{
-				logger:                  tt.fields.logger,
-				subject:                 tt.fields.subject,
-				tp:                      tt.fields.tp,
-				mysqlContext:            tt.fields.mysqlContext,
-				dbs:                     tt.fields.dbs,
-				singletonDB:             tt.fields.singletonDB,
-				totalRowCount:           tt.fields.totalRowCount,
-				applyRowCount:           tt.fields.applyRowCount,
-				rowCopyComplete:         tt.fields.rowCopyComplete,
-				rowCopyCompleteFlag:     tt.fields.rowCopyCompleteFlag,
-				copyRowsQueue:           tt.fields.copyRowsQueue,
-				applyDataEntryQueue:     tt.fields.applyDataEntryQueue,
-				applyBinlogTxQueue:      tt.fields.applyBinlogTxQueue,
-				applyBinlogGroupTxQueue: tt.fields.applyBinlogGroupTxQueue,
-				lastAppliedBinlogTx:     tt.fields.lastAppliedBinlogTx,
-				natsConn:                tt.fields.natsConn,
-				waitCh:                  tt.fields.waitCh,
-				wg:                      tt.fields.wg,
-				shutdown:                tt.fields.shutdown,
-				shutdownCh:              tt.fields.shutdownCh,
-				shutdownLock:            tt.fields.shutdownLock,
-			}
-			if err := a.createTableGtidExecuted(); (err != nil) != tt.wantErr {
-				t.Errorf("Applier.createTableGtidExecuted() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestApplier_onDone(t *testing.T) {
-	type fields struct {
-		logger                  *log.Entry
-		subject                 string
-		tp                      string
-		mysqlContext            *config.MySQLDriverConfig
-		dbs                     []*sql.DB
-		singletonDB             *gosql.DB
-		totalRowCount           int
-		applyRowCount           int
-		rowCopyComplete         chan bool
-		rowCopyCompleteFlag     int64
-		copyRowsQueue           chan *DumpEntry
-		applyDataEntryQueue     chan *binlog.BinlogEntry
-		applyBinlogTxQueue      chan *binlog.BinlogTx
-		applyBinlogGroupTxQueue chan []*binlog.BinlogTx
-		lastAppliedBinlogTx     *binlog.BinlogTx
-		natsConn                *gonats.Conn
-		waitCh                  chan *models.WaitResult
-		wg                      sync.WaitGroup
-		shutdown                bool
-		shutdownCh              chan struct{}
-		shutdownLock            sync.Mutex
-	}
-	tests := []struct {
-		name   string
-		fields fields
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			a := &Applier{
-				logger:                  tt.fields.logger,
-				subject:                 tt.fields.subject,
-				tp:                      tt.fields.tp,
-				mysqlContext:            tt.fields.mysqlContext,
-				dbs:                     tt.fields.dbs,
-				singletonDB:             tt.fields.singletonDB,
-				totalRowCount:           tt.fields.totalRowCount,
-				applyRowCount:           tt.fields.applyRowCount,
-				rowCopyComplete:         tt.fields.rowCopyComplete,
-				rowCopyCompleteFlag:     tt.fields.rowCopyCompleteFlag,
-				copyRowsQueue:           tt.fields.copyRowsQueue,
-				applyDataEntryQueue:     tt.fields.applyDataEntryQueue,
-				applyBinlogTxQueue:      tt.fields.applyBinlogTxQueue,
-				applyBinlogGroupTxQueue: tt.fields.applyBinlogGroupTxQueue,
-				lastAppliedBinlogTx:     tt.fields.lastAppliedBinlogTx,
-				natsConn:                tt.fields.natsConn,
-				waitCh:                  tt.fields.waitCh,
-				wg:                      tt.fields.wg,
-				shutdown:                tt.fields.shutdown,
-				shutdownCh:              tt.fields.shutdownCh,
-				shutdownLock:            tt.fields.shutdownLock,
-			}
-			a.onDone()
-		})
-	}
-}
-
-func TestApplier_onApplyTxStructWithSuper(t *testing.T) {
-	type args struct {
-		dbApplier *sql.DB
-		binlogTx  *binlog.BinlogTx
-	}
-	tests := []struct {
-		name    string
-		a       *Applier
-		args    args
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.a.onApplyTxStructWithSuper(tt.args.dbApplier, tt.args.binlogTx); (err != nil) != tt.wantErr {
-				t.Errorf("Applier.onApplyTxStructWithSuper() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestApplier_Test008ProvidesFlowControlToThrottleOverSending(t *testing.T) {
-	tests := []struct {
-		name string
-		a    *Applier
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.a.Test008ProvidesFlowControlToThrottleOverSending()
-		})
-	}
-}
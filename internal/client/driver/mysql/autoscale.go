@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+const (
+	// workerScaleInterval is how often the applier decides whether to
+	// adjust its number of workers
+	workerScaleInterval = 10 * time.Second
+	// workerScaleIdleRounds is how many intervals in a row the workers
+	// must be mostly idle before one is removed
+	workerScaleIdleRounds = 3
+)
+
+// workerScaler decides how many workers the applier applies with, between
+// MinParallelWorkers and MaxParallelWorkers, from the lag and how busy the
+// workers are. The workers are resized through workersCh, as when
+// ParallelWorkers is reloaded: once the transactions received are all
+// committed, so the transactions of a table keep their order.
+type workerScaler struct {
+	min, max int
+	// target is how long transactions may take to apply on average for
+	// workers to be added, 0 for no limit
+	target time.Duration
+
+	// applied counts the transactions committed since the last decision,
+	// applying how long they took in nanoseconds
+	applied  int64
+	applying int64
+
+	// lag is the lag of the last decision, idle how many decisions in a
+	// row found the workers mostly idle
+	lag  int64
+	idle int
+}
+
+// workerSample is what the applier did over an interval
+type workerSample struct {
+	workers int
+	// queued is how many transactions wait to be applied, lag the lag of
+	// the last one applied in seconds
+	queued int
+	lag    int64
+	// applied is how many transactions were committed, taking applying to
+	// apply in all
+	applied  int64
+	applying time.Duration
+	interval time.Duration
+}
+
+// validateWorkerScaling checks the bounds of the number of workers of cfg
+func validateWorkerScaling(cfg *config.MySQLDriverConfig) error {
+	if cfg.MinParallelWorkers < 0 || cfg.MaxParallelWorkers < 0 || cfg.TargetApplyMilliseconds < 0 {
+		return fmt.Errorf("MinParallelWorkers, MaxParallelWorkers and TargetApplyMilliseconds can't be negative")
+	}
+	if cfg.MaxParallelWorkers > 0 && cfg.MinParallelWorkers > cfg.MaxParallelWorkers {
+		return fmt.Errorf("MinParallelWorkers %d is more than MaxParallelWorkers %d",
+			cfg.MinParallelWorkers, cfg.MaxParallelWorkers)
+	}
+	return nil
+}
+
+// newWorkerScaler returns the scaler of the workers of cfg, nil not to
+// adjust their number if MaxParallelWorkers is 0
+func newWorkerScaler(cfg *config.MySQLDriverConfig) *workerScaler {
+	if cfg.MaxParallelWorkers == 0 {
+		return nil
+	}
+	s := &workerScaler{
+		min:    cfg.MinParallelWorkers,
+		max:    cfg.MaxParallelWorkers,
+		target: time.Duration(cfg.TargetApplyMilliseconds) * time.Millisecond,
+	}
+	if s.min == 0 {
+		s.min = 1
+	}
+	return s
+}
+
+// observe counts a transaction committed in duration
+func (s *workerScaler) observe(duration time.Duration) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.applied, 1)
+	atomic.AddInt64(&s.applying, int64(duration))
+}
+
+// take returns the transactions committed since it was last called, and
+// how long they took to apply
+func (s *workerScaler) take() (int64, time.Duration) {
+	return atomic.SwapInt64(&s.applied, 0), time.Duration(atomic.SwapInt64(&s.applying, 0))
+}
+
+// decide returns how many workers to apply with after sample, and why if
+// it's not sample.workers
+func (s *workerScaler) decide(sample workerSample) (int, string) {
+	lagGrew := sample.lag > s.lag
+	s.lag = sample.lag
+	if sample.workers < s.min {
+		s.idle = 0
+		return s.min, "fewer than MinParallelWorkers"
+	}
+	if sample.workers > s.max {
+		s.idle = 0
+		return s.max, "more than MaxParallelWorkers"
+	}
+
+	var average time.Duration
+	if sample.applied > 0 {
+		average = sample.applying / time.Duration(sample.applied)
+	}
+	if lagGrew && sample.queued > 0 {
+		s.idle = 0
+		if sample.workers == s.max || (s.target > 0 && average >= s.target) {
+			// More workers would wait on the target
+			return sample.workers, ""
+		}
+		n := sample.workers + (sample.workers+1)/2
+		if n > s.max {
+			n = s.max
+		}
+		return n, fmt.Sprintf("lag grew to %ds with %d transactions queued, applied in %v on average",
+			sample.lag, sample.queued, average)
+	}
+
+	// busy is how many workers applied a transaction on average
+	var busy float64
+	if sample.interval > 0 {
+		busy = float64(sample.applying) / float64(sample.interval)
+	}
+	if sample.queued > 0 || busy >= float64(sample.workers)/2 {
+		s.idle = 0
+		return sample.workers, ""
+	}
+	s.idle++
+	if s.idle < workerScaleIdleRounds || sample.workers == s.min {
+		return sample.workers, ""
+	}
+	s.idle = 0
+	return sample.workers - 1, fmt.Sprintf("%.1f workers busy on average over %v",
+		busy, time.Duration(workerScaleIdleRounds)*sample.interval)
+}
+
+// scaleWorkers adjusts the number of workers of the applier by s, every
+// workerScaleInterval, until the applier shuts down
+func (a *Applier) scaleWorkers(s *workerScaler) {
+	ticker := time.NewTicker(workerScaleInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-a.shutdownCh:
+			return
+		case now := <-ticker.C:
+			sample := workerSample{
+				workers:  int(atomic.LoadInt64(&a.parallelWorkers)),
+				queued:   len(a.applyDataEntryQueue) + len(a.applyBinlogMtsTxQueue),
+				lag:      atomic.LoadInt64(&a.lagSeconds),
+				interval: now.Sub(last),
+			}
+			sample.applied, sample.applying = s.take()
+			last = now
+			if a.pauser.get() {
+				continue
+			}
+			n, reason := s.decide(sample)
+			if n == sample.workers {
+				continue
+			}
+			a.logger.Infof("mysql.applier: scaling from %d to %d workers: %s", sample.workers, n, reason)
+			if err := a.setParallelWorkers(n); err != nil {
+				a.logger.Warnf("mysql.applier: stop scaling the workers: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+func TestWorkerScaler_decide(t *testing.T) {
+	if s := newWorkerScaler(&config.MySQLDriverConfig{}); s != nil {
+		t.Fatalf("newWorkerScaler() without MaxParallelWorkers = %+v", s)
+	}
+	s := newWorkerScaler(&config.MySQLDriverConfig{MaxParallelWorkers: 8, TargetApplyMilliseconds: 100})
+	interval := 10 * time.Second
+
+	if n, _ := s.decide(workerSample{workers: 4, lag: 2, queued: 10, applied: 100,
+		applying: time.Second, interval: interval}); n != 6 {
+		t.Errorf("decide() as the lag grows = %d, want 6", n)
+	}
+	if n, _ := s.decide(workerSample{workers: 6, lag: 5, queued: 10, applied: 100,
+		applying: 20 * time.Second, interval: interval}); n != 6 {
+		t.Errorf("decide() above the target latency = %d, want 6", n)
+	}
+	if n, _ := s.decide(workerSample{workers: 6, lag: 9, queued: 10, applied: 100,
+		applying: time.Second, interval: interval}); n != 8 {
+		t.Errorf("decide() up to MaxParallelWorkers = %d, want 8", n)
+	}
+	if n, _ := s.decide(workerSample{workers: 8, lag: 12, queued: 10, applied: 100,
+		applying: time.Second, interval: interval}); n != 8 {
+		t.Errorf("decide() at MaxParallelWorkers = %d, want 8", n)
+	}
+
+	idle := workerSample{workers: 8, applied: 10, applying: time.Second, interval: interval}
+	for i := 1; i < workerScaleIdleRounds; i++ {
+		if n, _ := s.decide(idle); n != 8 {
+			t.Errorf("decide() idle %d times = %d, want 8", i, n)
+		}
+	}
+	if n, reason := s.decide(idle); n != 7 || reason == "" {
+		t.Errorf("decide() idle %d times = %d, %q, want 7", workerScaleIdleRounds, n, reason)
+	}
+
+	s = newWorkerScaler(&config.MySQLDriverConfig{MinParallelWorkers: 2, MaxParallelWorkers: 4})
+	if n, _ := s.decide(workerSample{workers: 1, interval: interval}); n != 2 {
+		t.Errorf("decide() below MinParallelWorkers = %d, want 2", n)
+	}
+	if n, _ := s.decide(workerSample{workers: 16, interval: interval}); n != 4 {
+		t.Errorf("decide() above MaxParallelWorkers = %d, want 4", n)
+	}
+	for i := 0; i < 2*workerScaleIdleRounds; i++ {
+		if n, _ := s.decide(workerSample{workers: 2, interval: interval}); n != 2 {
+			t.Fatalf("decide() idle at MinParallelWorkers = %d, want 2", n)
+		}
+	}
+}
+
+func TestValidateWorkerScaling(t *testing.T) {
+	tests := []struct {
+		min, max int
+		wantErr  bool
+	}{
+		{0, 0, false},
+		{2, 8, false},
+		{8, 2, true},
+		{-1, 2, true},
+	}
+	for _, tt := range tests {
+		cfg := &config.MySQLDriverConfig{MinParallelWorkers: tt.min, MaxParallelWorkers: tt.max}
+		if err := validateWorkerScaling(cfg); (err != nil) != tt.wantErr {
+			t.Errorf("validateWorkerScaling(%d, %d) error = %v, wantErr %v", tt.min, tt.max, err, tt.wantErr)
+		}
+	}
+}
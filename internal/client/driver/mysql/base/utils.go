@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"github.com/actiontech/dtle/internal/g"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -91,11 +92,14 @@ func GetTableColumns(db usql.QueryAble, databaseName, tableName string) (*umconf
 	)
 	columns := []umconf.Column{}
 	err := usql.QueryRowsMap(db, query, func(rowMap usql.RowMap) error {
+		extra := strings.ToLower(rowMap.GetString("Extra"))
 		columns = append(columns, umconf.Column{
 			Name:       rowMap.GetString("Field"),
 			ColumnType: rowMap.GetString("Type"),
 			Key:        strings.ToUpper(rowMap.GetString("Key")),
 			Nullable:   strings.ToUpper(rowMap.GetString("Null")) == "YES",
+			HasDefault: rowMap["Default"].Valid ||
+				strings.Contains(extra, "auto_increment") || strings.Contains(extra, "generated"),
 		})
 		return nil
 	})
@@ -223,6 +227,27 @@ func StringInterval(intervals gomysql.IntervalSlice) string {
 }
 
 // applyColumnTypes
+// GetColumnCharsets returns the charsets of the text columns of
+// databaseName.tableName, by column
+func GetColumnCharsets(db usql.QueryAble, databaseName, tableName string) (map[string]string, error) {
+	query := `
+		select
+				COLUMN_NAME, CHARACTER_SET_NAME
+			from
+				information_schema.columns
+			where
+				table_schema=?
+				and table_name=?
+				and CHARACTER_SET_NAME is not null
+		`
+	charsets := make(map[string]string)
+	err := usql.QueryRowsMap(db, query, func(m usql.RowMap) error {
+		charsets[m.GetString("COLUMN_NAME")] = m.GetString("CHARACTER_SET_NAME")
+		return nil
+	}, databaseName, tableName)
+	return charsets, err
+}
+
 func ApplyColumnTypes(db usql.QueryAble, databaseName, tableName string, columnsLists ...*umconf.ColumnList) error {
 	query := `
 		select
@@ -435,3 +460,117 @@ func GtidSetDiff(set1 string, set2 string) (string, error) {
 
 	return gExecuted.String(), nil
 }
+
+// SelectGtidPurged returns the GTID set of the transactions whose binlogs
+// were purged from the server
+func SelectGtidPurged(db usql.QueryAble) (string, error) {
+	var purged string
+	if err := db.QueryRow(`select @@global.gtid_purged`).Scan(&purged); err != nil {
+		return "", err
+	}
+	return purged, nil
+}
+
+// GtidSetMissing returns the transactions of purged that none of executed
+// holds, which the server can no longer send to a replica resuming from
+// executed. It returns an empty string if no transaction is missing.
+func GtidSetMissing(purged string, executed ...string) (string, error) {
+	missingHelper, err := gomysql.ParseMysqlGTIDSet(purged)
+	if err != nil {
+		return "", err
+	}
+	missing, ok := missingHelper.(*gomysql.MysqlGTIDSet)
+	if !ok {
+		return "", fmt.Errorf("internal error: cannot cast MysqlGTIDSet")
+	}
+
+	for _, set := range executed {
+		gExecutedHelper, err := gomysql.ParseMysqlGTIDSet(set)
+		if err != nil {
+			return "", err
+		}
+		gExecuted, ok := gExecutedHelper.(*gomysql.MysqlGTIDSet)
+		if !ok {
+			return "", fmt.Errorf("internal error: cannot cast MysqlGTIDSet")
+		}
+		for sid, execSet := range gExecuted.Sets {
+			missingSet, ok := missing.Sets[sid]
+			if !ok {
+				continue
+			}
+			missingSet.Intervals = subtractIntervals(missingSet.Intervals, execSet.Intervals)
+			if len(missingSet.Intervals) == 0 {
+				delete(missing.Sets, sid)
+			}
+		}
+	}
+
+	return gtidSetString(missing), nil
+}
+
+// gtidSetString returns set with its servers sorted by SID, as
+// MysqlGTIDSet.String lists them in no particular order
+func gtidSetString(set *gomysql.MysqlGTIDSet) string {
+	sids := make([]string, 0, len(set.Sets))
+	for sid := range set.Sets {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+	sets := make([]string, len(sids))
+	for i, sid := range sids {
+		sets[i] = set.Sets[sid].String()
+	}
+	return strings.Join(sets, ",")
+}
+
+// GtidSetReplaceSid returns set with its transactions of the server sid
+// replaced by the ones of from, removed if from has none
+func GtidSetReplaceSid(set, sid, from string) (string, error) {
+	gSetHelper, err := gomysql.ParseMysqlGTIDSet(set)
+	if err != nil {
+		return "", err
+	}
+	gSet, ok := gSetHelper.(*gomysql.MysqlGTIDSet)
+	if !ok {
+		return "", fmt.Errorf("internal error: cannot cast MysqlGTIDSet")
+	}
+	gFromHelper, err := gomysql.ParseMysqlGTIDSet(from)
+	if err != nil {
+		return "", err
+	}
+	gFrom, ok := gFromHelper.(*gomysql.MysqlGTIDSet)
+	if !ok {
+		return "", fmt.Errorf("internal error: cannot cast MysqlGTIDSet")
+	}
+
+	delete(gSet.Sets, sid)
+	if fromSet, ok := gFrom.Sets[sid]; ok {
+		gSet.AddSet(fromSet)
+	}
+	return gtidSetString(gSet), nil
+}
+
+// subtractIntervals returns the parts of the normalized intervals s that
+// aren't in the normalized intervals sub
+func subtractIntervals(s, sub gomysql.IntervalSlice) gomysql.IntervalSlice {
+	var result gomysql.IntervalSlice
+	for _, in := range s {
+		start := in.Start
+		for _, o := range sub {
+			if o.Stop <= start || o.Start >= in.Stop {
+				continue
+			}
+			if o.Start > start {
+				result = append(result, gomysql.Interval{Start: start, Stop: o.Start})
+			}
+			start = o.Stop
+			if start >= in.Stop {
+				break
+			}
+		}
+		if start < in.Stop {
+			result = append(result, gomysql.Interval{Start: start, Stop: in.Stop})
+		}
+	}
+	return result
+}
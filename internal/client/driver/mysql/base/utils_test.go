@@ -60,6 +60,9 @@ func TestGetSelfBinlogCoordinates(t *testing.T) {
 	if err != nil {
 		return
 	}
+	if err := db.Ping(); err != nil {
+		t.Skipf("MySQL server unavailable: %v", err)
+	}
 	tests := []struct {
 		name                      string
 		args                      args
@@ -150,7 +153,7 @@ func TestShowCreateTable(t *testing.T) {
 	tests := []struct {
 		name                     string
 		args                     args
-		wantCreateTableStatement string
+		wantCreateTableStatement []string
 		wantErr                  bool
 	}{
 		// TODO: Add test cases.
@@ -162,7 +165,7 @@ func TestShowCreateTable(t *testing.T) {
 				t.Errorf("ShowCreateTable() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if gotCreateTableStatement != tt.wantCreateTableStatement {
+			if !reflect.DeepEqual(gotCreateTableStatement, tt.wantCreateTableStatement) {
 				t.Errorf("ShowCreateTable() = %v, want %v", gotCreateTableStatement, tt.wantCreateTableStatement)
 			}
 		})
@@ -180,7 +183,7 @@ func Test_parseInterval(t *testing.T) {
 		wantErr bool
 	}{
 		// TODO: Add test cases.
-		{"t1", args{"36671-36677"}, gomysql.Interval{}, false},
+		{"t1", args{"36671-36677"}, gomysql.Interval{Start: 36671, Stop: 36678}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -253,3 +256,67 @@ func Test_stringInterval(t *testing.T) {
 		})
 	}
 }
+
+func TestGtidSetMissing(t *testing.T) {
+	const (
+		sidA = "96fda9dc-7cbf-11e7-9340-0242ac110002"
+		sidB = "a0cd2b22-7cbf-11e7-9340-0242ac110002"
+	)
+	tests := []struct {
+		name     string
+		purged   string
+		executed []string
+		want     string
+		wantErr  bool
+	}{
+		{"nothing purged", "", []string{sidA + ":1-10"}, "", false},
+		{"purged transactions executed", sidA + ":1-100", []string{sidA + ":1-200"}, "", false},
+		{"gap at the end", sidA + ":1-100", []string{sidA + ":1-90"}, sidA + ":91-100", false},
+		{"gap in the middle", sidA + ":1-100", []string{sidA + ":1-10:20-100"}, sidA + ":11-19", false},
+		{"unknown source", sidA + ":1-10," + sidB + ":1-5", []string{sidA + ":1-10"}, sidB + ":1-5", false},
+		{"several executed sets", sidA + ":1-10," + sidB + ":1-5", []string{sidA + ":1-10", sidB + ":1-5"}, "", false},
+		{"bad purged set", "not a gtid set", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GtidSetMissing(tt.purged, tt.executed...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GtidSetMissing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GtidSetMissing() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGtidSetReplaceSid(t *testing.T) {
+	const (
+		sidA = "96fda9dc-7cbf-11e7-9340-0242ac110002"
+		sidB = "a0cd2b22-7cbf-11e7-9340-0242ac110002"
+	)
+	tests := []struct {
+		name    string
+		set     string
+		from    string
+		want    string
+		wantErr bool
+	}{
+		{"removed", sidA + ":1-10," + sidB + ":1-5", "", sidA + ":1-10", false},
+		{"replaced", sidA + ":1-10," + sidB + ":1-5", sidA + ":1-20," + sidB + ":1-8", sidA + ":1-10," + sidB + ":1-8", false},
+		{"added", sidA + ":1-10", sidB + ":1-3:5", sidA + ":1-10," + sidB + ":1-3:5", false},
+		{"no transaction of the server", sidA + ":1-10", sidA + ":1-20", sidA + ":1-10", false},
+		{"bad set", "not a gtid set", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GtidSetReplaceSid(tt.set, sidB, tt.from)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GtidSetReplaceSid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GtidSetReplaceSid() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+)
+
+// maxBatchStmts is how many statements of batches of a table each worker
+// keeps prepared. Batches of other sizes are prepared for each use.
+const maxBatchStmts = 8
+
+// batchLength returns how many of events, from the first on, the applier
+// writes in one statement: consecutive inserts, or deletes, of a table, up
+// to ApplyBatchSize. Rows are written one by one while the transaction may
+// already be on the target, or while conflicts are looked for.
+func (a *Applier) batchLength(events []binlog.DataEvent, replaying bool) int {
+	size := a.mysqlContext.ApplyBatchSize
+	if size <= 1 || replaying || a.conflicts != nil || a.skipErrors != nil {
+		return 1
+	}
+	first := events[0]
+	if first.DML != binlog.InsertDML && first.DML != binlog.DeleteDML {
+		return 1
+	}
+	n := 1
+	for n < len(events) && n < size && events[n].DML == first.DML && events[n].TableItem == first.TableItem {
+		n++
+	}
+	return n
+}
+
+// applyBatch applies the row events, inserts or deletes of a table, in one
+// statement, and returns the change of the row count of the target. If a
+// row fails the statement, the events are applied one by one for the error
+// to tell which row it is.
+func (a *Applier) applyBatch(events []binlog.DataEvent, workerIdx int) (int64, error) {
+	converted := make([]binlog.DataEvent, len(events))
+	rows := make([][]*interface{}, len(events))
+	for i, event := range events {
+		event, err := a.convertEvent(event)
+		if err != nil {
+			return 0, err
+		}
+		converted[i] = event
+		if event.DML == binlog.InsertDML {
+			rows[i] = event.NewColumnValues.GetAbstractValues()
+		} else {
+			rows[i] = event.WhereColumnValues.GetAbstractValues()
+		}
+	}
+
+	tableItem := events[0].TableItem.(*applierTableItem)
+	schema, table := a.nameMapping.Table(events[0].DatabaseName, events[0].TableName)
+	if tableItem.targetTable != "" {
+		table = tableItem.targetTable
+	}
+	var query string
+	var args []interface{}
+	var err error
+	rowDelta := int64(len(events))
+	if events[0].DML == binlog.InsertDML {
+		query, args, err = sql.BuildDMLBatchInsertQuery(schema, table, tableItem.columns, rows)
+	} else {
+		query, args, err = sql.BuildDMLBatchDeleteQuery(schema, table, tableItem.columns, rows)
+		rowDelta = -rowDelta
+	}
+	if err != nil {
+		a.logger.Errorf("mysql.applier: Build dml query error: %v", err)
+		return 0, err
+	}
+
+	err = a.execBatch(tableItem, workerIdx, query, args)
+	if err == nil {
+		atomic.AddInt64(&a.batchStatements, 1)
+		atomic.AddInt64(&a.batchedRows, int64(len(events)))
+		return rowDelta, nil
+	}
+	if !sql.IsRowError(err) {
+		return 0, err
+	}
+
+	a.logger.Warnf("mysql.applier: a row of the batch of %d rows of %s.%s failed: %v. Applying them one by one",
+		len(events), schema, table, err)
+	var total int64
+	for i, event := range converted {
+		delta, err := a.applyRow(event, workerIdx)
+		if err != nil {
+			return 0, fmt.Errorf("%s.%s: row %d of a batch of %d: %v", schema, table, i+1, len(events), err)
+		}
+		total += delta
+	}
+	return total, nil
+}
+
+// execBatch executes query, the statement of a batch of rows of the table
+// of tableItem, with args on the connection of the worker
+func (a *Applier) execBatch(tableItem *applierTableItem, workerIdx int, query string, args []interface{}) error {
+	stmts := tableItem.psBatch[workerIdx]
+	stmt, ok := stmts[query]
+	if !ok {
+		var err error
+		stmt, err = a.dbs[workerIdx].Db.PrepareContext(context.Background(), query)
+		if err != nil {
+			return err
+		}
+		if len(stmts) < maxBatchStmts {
+			if stmts == nil {
+				stmts = make(map[string]*gosql.Stmt)
+				tableItem.psBatch[workerIdx] = stmts
+			}
+			stmts[query] = stmt
+		} else {
+			defer stmt.Close()
+		}
+	}
+	// Statements of dbApplier.Db run in the session of tx
+	_, err := stmt.Exec(args...)
+	return err
+}
+
+// resetBatchStmts closes the statements of batches, and makes room for
+// those of parallelWorkers workers
+func (ait *applierTableItem) resetBatchStmts(parallelWorkers int) {
+	for _, stmts := range ait.psBatch {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}
+	ait.psBatch = make([]map[string]*gosql.Stmt, parallelWorkers)
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/satori/go.uuid"
+)
+
+// batchServer stands for a target server, recording the statements it
+// executes. Statements holding the value "bad" fail as a missing foreign
+// key would.
+type batchServer struct {
+	l     sync.Mutex
+	execs []string
+}
+
+// batchDriver opens the connections to the batchServer registered under
+// the DSN, for each test to have its own server behind the single driver
+type batchDriver struct{}
+
+var (
+	registerBatchDriver sync.Once
+	batchServers        sync.Map
+)
+
+func (batchDriver) Open(name string) (driver.Conn, error) {
+	s, ok := batchServers.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("no batch server %q", name)
+	}
+	return &batchConn{server: s.(*batchServer)}, nil
+}
+
+type batchConn struct {
+	server *batchServer
+}
+
+func (c *batchConn) Prepare(query string) (driver.Stmt, error) {
+	return &batchStmt{server: c.server, query: query}, nil
+}
+func (c *batchConn) Close() error              { return nil }
+func (c *batchConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *batchConn) Commit() error             { return nil }
+func (c *batchConn) Rollback() error           { return nil }
+
+type batchStmt struct {
+	server *batchServer
+	query  string
+}
+
+func (s *batchStmt) Close() error  { return nil }
+func (s *batchStmt) NumInput() int { return -1 }
+
+func (s *batchStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.server.l.Lock()
+	defer s.server.l.Unlock()
+	for _, arg := range args {
+		if arg == "bad" {
+			return nil, &gomysql.MySQLError{Number: sql.ErrNoReferencedRow2, Message: "foreign key"}
+		}
+	}
+	if !strings.Contains(s.query, "gtid_executed") {
+		s.server.execs = append(s.server.execs, fmt.Sprintf("%s %v", strings.Join(strings.Fields(s.query), " "), args))
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *batchStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+// newBatchApplier returns an Applier of mysqlContext applying to a new
+// batchServer through a single connection. stop shuts the Applier down.
+func newBatchApplier(t *testing.T, mysqlContext *config.MySQLDriverConfig) (a *Applier, server *batchServer, stop func()) {
+	registerBatchDriver.Do(func() {
+		gosql.Register("batch", batchDriver{})
+	})
+	server = &batchServer{}
+	dsn := uuid.NewV4().String()
+	batchServers.Store(dsn, server)
+	db, err := gosql.Open("batch", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutdownCh := make(chan struct{})
+	a = &Applier{
+		logger:       log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)),
+		subjectUUID:  uuid.NewV4(),
+		mysqlContext: mysqlContext,
+		db:           db,
+		dbs:          []*sql.Conn{{DbMutex: &sync.Mutex{}, Db: conn}},
+		shutdownCh:   shutdownCh,
+		mtsManager:   NewMtsManager(shutdownCh),
+		waitCh:       make(chan *models.WaitResult, 1),
+	}
+	go a.mtsManager.LcUpdater()
+	if err := a.prepareGtidExecutedStmts(a.dbs[0]); err != nil {
+		t.Fatal(err)
+	}
+	return a, server, func() {
+		close(shutdownCh)
+		db.Close()
+		batchServers.Delete(dsn)
+	}
+}
+
+func TestApplier_ApplyBinlogEvent_Batch(t *testing.T) {
+	a, server, stop := newBatchApplier(t, &config.MySQLDriverConfig{ApplyBatchSize: 3})
+	defer stop()
+
+	item := newApplierTableItem(1)
+	item.columns = umconf.NewColumnList([]umconf.Column{{Name: "id", Key: "PRI"}, {Name: "v"}})
+	other := newApplierTableItem(1)
+	other.columns = item.columns
+	event := func(dml binlog.EventDML, tableItem *applierTableItem, id int64, v string) binlog.DataEvent {
+		e := binlog.NewDataEvent("db1", "t1", dml, 2)
+		e.TableItem = tableItem
+		values := umconf.ToColumnValues([]interface{}{id, v})
+		if dml == binlog.InsertDML {
+			e.NewColumnValues = values
+		} else {
+			e.WhereColumnValues = values
+		}
+		return e
+	}
+	sid := uuid.NewV4()
+	entry := func(gno int64, events ...binlog.DataEvent) *binlog.BinlogEntry {
+		return &binlog.BinlogEntry{Coordinates: base.BinlogCoordinateTx{SID: sid, GNO: gno, SeqenceNumber: gno}, Events: events}
+	}
+
+	// Four inserts are two batches, the insert into the other table and
+	// the deletes are batches of their own
+	tx := entry(1,
+		event(binlog.InsertDML, item, 1, "a"), event(binlog.InsertDML, item, 2, "b"),
+		event(binlog.InsertDML, item, 3, "c"), event(binlog.InsertDML, item, 4, "d"),
+		event(binlog.InsertDML, other, 5, "e"),
+		event(binlog.DeleteDML, item, 1, "a"), event(binlog.DeleteDML, item, 2, "b"))
+	if err := a.ApplyBinlogEvent(0, tx); err != nil {
+		t.Fatalf("ApplyBinlogEvent() error = %v", err)
+	}
+	want := []string{
+		"replace into db1.t1 (id, v) values (?, ?), (?, ?), (?, ?) [1 a 2 b 3 c]",
+		"replace into db1.t1 (id, v) values (?, ?) [4 d]",
+		"replace into db1.t1 (id, v) values (?, ?) [5 e]",
+		"delete from db1.t1 where ((id = ?)) or ((id = ?)) [1 2]",
+	}
+	if got := strings.Replace(strings.Join(server.execs, "\n"), "`", "", -1); got != strings.Join(want, "\n") {
+		t.Errorf("server executed\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+	if a.batchStatements != 2 || a.batchedRows != 5 {
+		t.Errorf("Applier counted %d batches of %d rows, want 2 of 5", a.batchStatements, a.batchedRows)
+	}
+
+	// The rows of a failing batch are applied one by one
+	server.execs = nil
+	err := a.ApplyBinlogEvent(0, entry(2,
+		event(binlog.InsertDML, item, 6, "f"), event(binlog.InsertDML, item, 7, "bad")))
+	if err == nil || !strings.Contains(err.Error(), "row 2 of a batch of 2") {
+		t.Fatalf("ApplyBinlogEvent() of a bad row error = %v, want it to tell the row", err)
+	}
+	if want := []string{"replace into db1.t1 (id, v) values (?, ?) [6 f]"}; !reflect.DeepEqual(
+		strings.Split(strings.Replace(strings.Join(server.execs, "\n"), "`", "", -1), "\n"), want) {
+		t.Errorf("server executed %q, want %q", server.execs, want)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 
 	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/satori/go.uuid"
 )
 
 type BinlogEntries struct {
@@ -23,6 +24,12 @@ type BinlogEntry struct {
 
 	Events       []DataEvent
 	OriginalSize int // size of binlog entry
+	// Heartbeat is the time in unix nanoseconds the transaction wrote to
+	// the heartbeat table of the job, 0 if it wrote none
+	Heartbeat int64
+	// Final marks the entry the extractor of a replay sends, after the
+	// last transaction of the replay, as it stops
+	Final bool
 }
 
 // NewBinlogEntry creates an empty, ready to go BinlogEntry object
@@ -35,6 +42,12 @@ func NewBinlogEntryAt(coordinates base.BinlogCoordinateTx) *BinlogEntry {
 	return binlogEntry
 }
 
+// IsHeartbeat tells whether the entry stands for no transaction, only
+// carrying a heartbeat
+func (b *BinlogEntry) IsHeartbeat() bool {
+	return b.Coordinates.SID == uuid.Nil
+}
+
 // Duplicate creates and returns a new binlog entry, with some of the attributes pre-assigned
 func (b *BinlogEntry) String() string {
 	return fmt.Sprintf("[BinlogEntry at %+v]", b.Coordinates)
@@ -17,6 +17,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	//"os"
 
@@ -44,11 +45,16 @@ type BinlogReader struct {
 	logger                   *log.Entry
 	connectionConfig         *mysql.ConnectionConfig
 	db                       *gosql.DB
+	binlogSyncerConfig       replication.BinlogSyncerConfig
 	binlogSyncer             *replication.BinlogSyncer
 	binlogStreamer           *replication.BinlogStreamer
+	parser                   *eventParser
 	currentCoordinates       base.BinlogCoordinateTx
 	currentCoordinatesMutex  *sync.Mutex
 	LastAppliedRowsEventHint base.BinlogCoordinateTx
+	// the last GNO streamed from every source server
+	lastGNOs     map[uuid.UUID]int64
+	lastGNOsLock sync.Mutex
 	// raw config, whose ReplicateDoDB is same as config file (empty-is-all & no dynamically created tables)
 	mysqlContext *config.MySQLDriverConfig
 	// dynamic config, include all tables (implicitly assigned or dynamically created)
@@ -63,6 +69,37 @@ type BinlogReader struct {
 	appendB64SqlBs     []byte
 	ReMap              map[string]*regexp.Regexp
 
+	// the heartbeat table of the job, whose rows are kept from the
+	// entries, and the job_id of the rows of the job
+	heartbeatSchema string
+	heartbeatTable  string
+	heartbeatJobID  string
+
+	// buffer bounds the bytes of the entries sent and not taken yet, if set
+	buffer *EntryBuffer
+
+	// the transactions fully read, which the binlog streamer reconnects
+	// from. Only the goroutine streaming the events uses it.
+	committedGtids *gomysql.MysqlGTIDSet
+	// whether the server began the dump of the current connection
+	dumpStarted bool
+	reconnects  int64
+
+	// sources are the servers the reader may stream from, and source the
+	// one it streams from, whose server_uuid is sourceUUID. The reader
+	// fails over to another one when it can't reconnect to it.
+	sources    []*mysql.ConnectionConfig
+	source     int
+	sourceUUID string
+	failovers  int64
+	onFailover func(source *mysql.ConnectionConfig)
+
+	// whereUpdates are the tables SetWhere filters by new where
+	// predicates, which the streaming goroutine takes at the next
+	// transaction
+	whereUpdates     []*config.TableContext
+	whereUpdatesLock sync.Mutex
+
 	wg           sync.WaitGroup
 	shutdown     bool
 	shutdownCh   chan struct{}
@@ -74,6 +111,7 @@ func NewMySQLReader(cfg *config.MySQLDriverConfig, logger *log.Entry, replicateD
 		logger:                  logger,
 		currentCoordinates:      base.BinlogCoordinateTx{},
 		currentCoordinatesMutex: &sync.Mutex{},
+		lastGNOs:                make(map[uuid.UUID]int64),
 		mysqlContext:            cfg,
 		appendB64SqlBs:          make([]byte, 1024*1024),
 		ReMap:                   make(map[string]*regexp.Regexp),
@@ -84,12 +122,15 @@ func NewMySQLReader(cfg *config.MySQLDriverConfig, logger *log.Entry, replicateD
 	for _, db := range replicateDoDb {
 		tableMap := binlogReader.getDbTableMap(db.TableSchema)
 		for _, table := range db.Tables {
-			if err := binlogReader.addTableToTableMap(tableMap, table); err != nil {
+			if err := binlogReader.addTableToTableMap(tableMap, table, table.Where); err != nil {
 				return nil, err
 			}
 		}
 	}
 
+	if binlogReader.sources, err = SourceCandidates(cfg); err != nil {
+		return nil, err
+	}
 	uri := cfg.ConnectionConfig.GetDBUri()
 	if binlogReader.db, err = sql.CreateDB(uri); err != nil {
 		return nil, err
@@ -113,17 +154,28 @@ func NewMySQLReader(cfg *config.MySQLDriverConfig, logger *log.Entry, replicateD
 	// support regex
 	binlogReader.genRegexMap()
 
-	binlogSyncerConfig := replication.BinlogSyncerConfig{
+	tlsConfig, err := cfg.ConnectionConfig.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	binlogReader.binlogSyncerConfig = replication.BinlogSyncerConfig{
 		ServerID:       uint32(serverId),
 		Flavor:         "mysql",
 		Host:           cfg.ConnectionConfig.Host,
 		Port:           uint16(cfg.ConnectionConfig.Port),
 		User:           cfg.ConnectionConfig.User,
 		Password:       cfg.ConnectionConfig.Password,
-		RawModeEnabled: false,
+		RawModeEnabled: true,
 		UseDecimal:     true,
+		TLSConfig:      tlsConfig,
+		// The syncer resumes from the transaction it was reading, the
+		// reader reconnects instead. See reconnectBinlogStreamer.
+		MaxReconnectAttempts: 1,
 	}
-	binlogReader.binlogSyncer = replication.NewBinlogSyncer(binlogSyncerConfig)
+	binlogReader.binlogSyncer = replication.NewBinlogSyncer(binlogReader.binlogSyncerConfig)
+	// The syncer streams the raw events, which the reader decodes itself
+	// as it knows those of MySQL 8.0
+	binlogReader.parser = newEventParser(binlogReader.binlogSyncerConfig)
 	binlogReader.mysqlContext.Stage = models.StageRegisteringSlaveOnMaster
 
 	return binlogReader, err
@@ -137,14 +189,15 @@ func (b *BinlogReader) getDbTableMap(schemaName string) map[string]*config.Table
 	}
 	return tableMap
 }
-func (b *BinlogReader) addTableToTableMap(tableMap map[string]*config.TableContext, table *config.Table) error {
-	if table.Where == "" {
+func (b *BinlogReader) addTableToTableMap(tableMap map[string]*config.TableContext, table *config.Table, where string) error {
+	if where == "" {
 		b.logger.Warnf("UDUP_BUG: NewMySQLReader: table.Where is empty (#177 like)")
 		table.Where = "true"
+		where = table.Where
 	}
-	whereCtx, err := config.NewWhereCtx(table.Where, table)
+	whereCtx, err := config.NewWhereCtx(where, table)
 	if err != nil {
-		b.logger.Errorf("mysql.reader: Error parse where '%v'", table.Where)
+		b.logger.Errorf("mysql.reader: Error parse where '%v'", where)
 		return err
 	}
 
@@ -171,10 +224,19 @@ func (b *BinlogReader) ConnectBinlogStreamer(coordinates base.BinlogCoordinatesX
 	if err != nil {
 		b.logger.Errorf("mysql.reader: err: %v", err)
 	}
+	// The syncer adds the transactions it reads to gtidSet, keep a copy
+	b.committedGtids, err = parseMysqlGTIDSet(coordinates.GtidSet)
+	if err != nil {
+		return err
+	}
 	b.binlogStreamer, err = b.binlogSyncer.StartSyncGTID(gtidSet)
 	if err != nil {
 		b.logger.Debugf("mysql.reader: err at StartSyncGTID: %v", err)
 	}
+	// Tells a failover behind the same host from a reconnection
+	if err := b.db.QueryRow(`select @@global.server_uuid`).Scan(&b.sourceUUID); err != nil {
+		b.logger.Warnf("mysql.reader: Failed to read the server_uuid of the source: %v", err)
+	}
 	b.mysqlContext.Stage = models.StageRequestingBinlogDump
 
 	return err
@@ -187,6 +249,28 @@ func (b *BinlogReader) GetCurrentBinlogCoordinates() *base.BinlogCoordinateTx {
 	return &returnCoordinates
 }
 
+// witnessGtid records the transaction sid:gno was streamed
+func (b *BinlogReader) witnessGtid(sid uuid.UUID, gno int64) {
+	b.lastGNOsLock.Lock()
+	defer b.lastGNOsLock.Unlock()
+	if gno > b.lastGNOs[sid] {
+		b.lastGNOs[sid] = gno
+	}
+}
+
+// GetStreamedGtidSet returns the transactions streamed since the reader
+// connected. The server sends the transactions of a source in order, so
+// every GNO up to the last one streamed is included.
+func (b *BinlogReader) GetStreamedGtidSet() string {
+	b.lastGNOsLock.Lock()
+	defer b.lastGNOsLock.Unlock()
+	sets := make([]string, 0, len(b.lastGNOs))
+	for sid, gno := range b.lastGNOs {
+		sets = append(sets, fmt.Sprintf("%s:1-%d", sid.String(), gno))
+	}
+	return strings.Join(sets, ",")
+}
+
 func ToColumnValuesV2(abstractValues []interface{}, table *config.TableContext) *mysql.ColumnValues {
 	result := &mysql.ColumnValues{
 		AbstractValues: make([]*interface{}, len(abstractValues)),
@@ -261,9 +345,12 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 		u, _ := uuid.FromBytes(evt.SID)
 		b.currentCoordinates.SID = u
 		b.currentCoordinates.GNO = evt.GNO
+		b.witnessGtid(u, evt.GNO)
 		b.currentCoordinates.LastCommitted = evt.LastCommitted
 		b.currentCoordinates.SeqenceNumber = evt.SequenceNumber
+		b.currentCoordinates.Timestamp = ev.Header.Timestamp
 		b.currentBinlogEntry = NewBinlogEntryAt(b.currentCoordinates)
+		b.takeWhereUpdates()
 	case replication.QUERY_EVENT:
 		evt := ev.Event.(*replication.QueryEvent)
 		query := string(evt.Query)
@@ -304,7 +391,7 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 						NotDML,
 					)
 					b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, event)
-					entriesChannel <- b.currentBinlogEntry
+					b.sendEntry(entriesChannel, b.currentBinlogEntry)
 					b.LastAppliedRowsEventHint = b.currentCoordinates
 					return nil
 				}
@@ -350,9 +437,14 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 						}
 						table.OriginalTableColumns = columns
 						tableMap := b.getDbTableMap(realSchema)
-						err = b.addTableToTableMap(tableMap, table)
+						where := table.Where
+						if tableCtx, ok := tableMap[tableName]; ok {
+							// Keep the predicate SetWhere may have changed
+							where = tableCtx.WhereCtx.Where
+						}
+						err = b.addTableToTableMap(tableMap, table, where)
 						if err != nil {
-							b.logger.Error("failed to make table context: %v", err)
+							b.logger.Errorf("failed to make table context: %v", err)
 							return err
 						}
 					}
@@ -365,16 +457,22 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 					)
 					b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, event)
 				}
-				entriesChannel <- b.currentBinlogEntry
+				b.sendEntry(entriesChannel, b.currentBinlogEntry)
 				b.LastAppliedRowsEventHint = b.currentCoordinates
+			} else if err := b.checkStatementEvent(ev, string(evt.Schema), query); err != nil {
+				return err
 			}
 		}
 	case replication.XID_EVENT:
-		entriesChannel <- b.currentBinlogEntry
+		b.sendEntry(entriesChannel, b.currentBinlogEntry)
 		b.LastAppliedRowsEventHint = b.currentCoordinates
 	default:
 		if rowsEvent, ok := ev.Event.(*replication.RowsEvent); ok {
 			dml := ToEventDML(ev.Header.EventType)
+			if b.isHeartbeatEvent(rowsEvent) {
+				b.readHeartbeat(rowsEvent, dml)
+				return nil
+			}
 			skip, table := b.skipRowEvent(rowsEvent, dml)
 			if skip {
 				//b.logger.Debugf("mysql.reader: skip rowsEvent [%s-%s]", rowsEvent.Table.Schema, rowsEvent.Table.Table)
@@ -384,6 +482,10 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 			if dml == NotDML {
 				return fmt.Errorf("Unknown DML type: %s", ev.Header.EventType.String())
 			}
+			jsonUpdates, err := decodeRowsColumns(rowsEvent)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %v", rowsEvent.Table.Schema, rowsEvent.Table.Table, err)
+			}
 			dmlEvent := NewDataEvent(
 				string(rowsEvent.Table.Schema),
 				string(rowsEvent.Table.Table),
@@ -419,6 +521,7 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 					{
 						dmlEvent.WhereColumnValues = ToColumnValuesV2(row, table)
 						dmlEvent.NewColumnValues = ToColumnValuesV2(rowsEvent.Rows[i+1], table)
+						dmlEvent.JSONUpdates = jsonUpdates[i+1]
 					}
 				case DeleteDML:
 					{
@@ -446,11 +549,11 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 						if err != nil {
 							return err
 						}
-						if before != after {
-							return fmt.Errorf("update on 'where columns' cause inconsistency")
-							// TODO split it to delete + insert to allow such update
-						} else {
-							whereTrue = before
+						whereTrue = before || after
+						if whereTrue && before != after {
+							// The row moves into or out of the 'where'
+							b.currentBinlogEntry.Events = append(b.currentBinlogEntry.Events, whereMoveEvent(dmlEvent, after))
+							continue
 						}
 					case DeleteDML:
 						whereTrue, err = table.WhereTrue(dmlEvent.WhereColumnValues)
@@ -476,6 +579,29 @@ func (b *BinlogReader) handleEvent(ev *replication.BinlogEvent, entriesChannel c
 	return nil
 }
 
+// whereMoveEvent turns the update of a row into or out of the 'where' of
+// its table into the insert of its new image, or the delete of its old one
+func whereMoveEvent(update DataEvent, intoWhere bool) DataEvent {
+	update.JSONUpdates = nil
+	if intoWhere {
+		update.DML = InsertDML
+		update.WhereColumnValues = nil
+	} else {
+		update.DML = DeleteDML
+		update.NewColumnValues = nil
+	}
+	return update
+}
+
+// getEvent returns the next event of the streamer, decoded
+func (b *BinlogReader) getEvent() (*replication.BinlogEvent, error) {
+	ev, err := b.binlogStreamer.GetEvent(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return b.parser.parse(ev)
+}
+
 // StreamEvents
 func (b *BinlogReader) DataStreamEvents(entriesChannel chan<- *BinlogEntry) error {
 	for {
@@ -484,9 +610,15 @@ func (b *BinlogReader) DataStreamEvents(entriesChannel chan<- *BinlogEntry) erro
 			break
 		}
 
-		ev, err := b.binlogStreamer.GetEvent(context.Background())
+		ev, err := b.getEvent()
+		if err == nil && b.isSyncerReconnected(ev) {
+			err = errSyncerReconnected
+		}
 		if err != nil {
-			return err
+			if err = b.reconnectBinlogStreamer(err); err != nil {
+				return err
+			}
+			continue
 		}
 		if ev.Header.EventType == replication.HEARTBEAT_EVENT {
 			continue
@@ -498,6 +630,13 @@ func (b *BinlogReader) DataStreamEvents(entriesChannel chan<- *BinlogEntry) erro
 			defer b.currentCoordinatesMutex.Unlock()
 			b.currentCoordinates.LogPos = int64(ev.Header.LogPos)
 		}()
+		skip, err := b.checkEventType(ev)
+		if err != nil {
+			return err
+		}
+		if skip {
+			continue
+		}
 
 		if ev.Header.EventType == replication.ROTATE_EVENT {
 			if rotateEvent, ok := ev.Event.(*replication.RotateEvent); ok {
@@ -512,9 +651,13 @@ func (b *BinlogReader) DataStreamEvents(entriesChannel chan<- *BinlogEntry) erro
 				b.logger.Warnf("mysql.reader: fake rotate_event.")
 			}
 		} else {
+			endsTx := b.endsTx(ev)
 			if err := b.handleEvent(ev, entriesChannel); err != nil {
 				return err
 			}
+			if endsTx {
+				b.commitGtid()
+			}
 		}
 	}
 
@@ -528,7 +671,7 @@ func (b *BinlogReader) BinlogStreamEvents(txChannel chan<- *BinlogTx) error {
 			break
 		}
 
-		ev, err := b.binlogStreamer.GetEvent(context.Background())
+		ev, err := b.getEvent()
 		if err != nil {
 			return err
 		}
@@ -587,6 +730,13 @@ func (b *BinlogReader) BinlogStreamEvents(txChannel chan<- *BinlogTx) error {
 			defer b.currentCoordinatesMutex.Unlock()
 			b.currentCoordinates.LogPos = int64(ev.Header.LogPos)
 		}()
+		skip, err := b.checkEventType(ev)
+		if err != nil {
+			return err
+		}
+		if skip {
+			continue
+		}
 		if ev.Header.EventType == replication.ROTATE_EVENT {
 			if rotateEvent, ok := ev.Event.(*replication.RotateEvent); ok {
 				func() {
@@ -631,6 +781,7 @@ func (b *BinlogReader) handleBinlogRowsEvent(ev *replication.BinlogEvent, txChan
 
 		evt := ev.Event.(*replication.GTIDEvent)
 		u, _ := uuid.FromBytes(evt.SID)
+		b.witnessGtid(u, evt.GNO)
 
 		b.currentTx = &BinlogTx{
 			SID:           u.String(),
@@ -752,7 +903,8 @@ func (b *BinlogReader) handleBinlogRowsEvent(ev *replication.BinlogEvent, txChan
 		})
 		//tb.addCount(Insert)
 
-	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2,
+		partialUpdateRowsEvent:
 		evt := ev.Event.(*replication.RowsEvent)
 		if b.skipEvent(string(evt.Table.Schema), string(evt.Table.Table)) {
 			//b.logger.Debugf("mysql.reader: skip RowsEvent at schema: %s,table: %s", fmt.Sprintf("%s", evt.Table.Schema), fmt.Sprintf("%s", evt.Table.Table))
@@ -869,6 +1021,98 @@ func GenDDLSQL(sql string, schema string) (string, error) {
 	return fmt.Sprintf("USE %s;%s", schema, sql), nil
 }
 
+// checkStatementEvent fails on a DML statement logged in a transaction
+// that writes a replicated table: its rows are not in the binlog. Sources
+// with binlog_format MIXED log most statements this way, and so does any
+// session that sets binlog_format to STATEMENT.
+func (b *BinlogReader) checkStatementEvent(ev *replication.BinlogEvent, currentSchema string, query string) error {
+	tables, isDML, err := resolveDMLSQL(query)
+	if err != nil {
+		// Statements the parser doesn't know can't be told apart, save
+		// those that look like DML
+		isDML = isDMLKeyword(query)
+		tables = []SchemaTable{{}}
+	}
+	if !isDML {
+		return nil
+	}
+
+	for _, table := range tables {
+		schema := utils.StringElse(table.Schema, currentSchema)
+		if table.Table != "" && b.skipEvent(schema, table.Table) {
+			continue
+		}
+		name := fmt.Sprintf("%s.%s", schema, table.Table)
+		if table.Table == "" {
+			name = "a table it can't parse"
+		}
+		return fmt.Errorf("statement-based binlog event at %s:%d (gtid %s:%d) writes %s, whose rows are not in the binlog: "+
+			"set binlog_format = ROW on the source, and in the sessions writing replicated tables. query: %s",
+			b.currentCoordinates.LogFile, ev.Header.LogPos-ev.Header.EventSize,
+			b.currentCoordinates.GetSid(), b.currentCoordinates.GNO, name, query)
+	}
+	return nil
+}
+
+// resolveDMLSQL returns whether sql is a DML statement, and the tables it
+// writes
+func resolveDMLSQL(sql string) (tables []SchemaTable, isDML bool, err error) {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return nil, false, err
+	}
+
+	var target ast.Node
+	switch v := stmt.(type) {
+	case *ast.InsertStmt:
+		target = v.Table
+	case *ast.UpdateStmt:
+		target = v.TableRefs
+	case *ast.DeleteStmt:
+		// The tables of a multiple table delete may be aliases, take all
+		// the tables it joins
+		target = v.TableRefs
+	case *ast.LoadDataStmt:
+		target = v.Table
+	default:
+		return nil, false, nil
+	}
+
+	collector := &tableNameCollector{}
+	target.Accept(collector)
+	return collector.tables, true, nil
+}
+
+// isDMLKeyword returns whether sql starts like a DML statement
+func isDMLKeyword(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToLower(fields[0]) {
+	case "insert", "replace", "update", "delete", "load":
+		return true
+	default:
+		return false
+	}
+}
+
+// tableNameCollector collects the tables of the nodes it visits
+type tableNameCollector struct {
+	tables []SchemaTable
+}
+
+func (c *tableNameCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if table, ok := n.(*ast.TableName); ok {
+		c.tables = append(c.tables, SchemaTable{Schema: table.Schema.O, Table: table.Name.O})
+	}
+	return n, false
+}
+
+func (c *tableNameCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
 // resolveDDLSQL resolve to one ddl sql
 // example: drop table test.a,test2.b -> drop table test.a; drop table test2.b;
 //
@@ -1067,13 +1311,112 @@ func skipMysqlSchemaEvent(tableLower string) bool {
 	}
 }
 
+// SetWhere makes the reader filter the rows of table by where instead, from
+// the next transaction it reads on
+func (b *BinlogReader) SetWhere(table *config.Table, where string) error {
+	whereCtx, err := config.NewWhereCtx(where, table)
+	if err != nil {
+		return err
+	}
+	b.whereUpdatesLock.Lock()
+	defer b.whereUpdatesLock.Unlock()
+	b.whereUpdates = append(b.whereUpdates, config.NewTableContext(table, whereCtx))
+	return nil
+}
+
+// takeWhereUpdates filters the rows of the tables by the where predicates
+// SetWhere was given
+func (b *BinlogReader) takeWhereUpdates() {
+	b.whereUpdatesLock.Lock()
+	updates := b.whereUpdates
+	b.whereUpdates = nil
+	b.whereUpdatesLock.Unlock()
+
+	for _, update := range updates {
+		tableMap := b.getDbTableMap(update.Table.TableSchema)
+		if tableCtx, ok := tableMap[update.Table.TableName]; ok {
+			tableCtx.WhereCtx = update.WhereCtx
+		} else {
+			tableMap[update.Table.TableName] = update
+		}
+		b.logger.Printf("mysql.reader: Filtering the rows of %s.%s by %q",
+			update.Table.TableSchema, update.Table.TableName, update.WhereCtx.Where)
+	}
+}
+
+// SetHeartbeatTable makes the reader take the heartbeats of the job jobID
+// from schema.table instead of replicating its rows
+func (b *BinlogReader) SetHeartbeatTable(schema, table, jobID string) {
+	b.heartbeatSchema = schema
+	b.heartbeatTable = table
+	b.heartbeatJobID = jobID
+}
+
+// SetBuffer makes the reader pause reading the binlog while buffer is full
+func (b *BinlogReader) SetBuffer(buffer *EntryBuffer) {
+	b.buffer = buffer
+}
+
+// sendEntry sends entry to entriesChannel, once the buffer has room for it
+// and the channel too. The binlog isn't read meanwhile.
+func (b *BinlogReader) sendEntry(entriesChannel chan<- *BinlogEntry, entry *BinlogEntry) {
+	if b.buffer == nil {
+		entriesChannel <- entry
+		return
+	}
+	if !b.buffer.Reserve(entry.OriginalSize) {
+		return // shutting down
+	}
+	select {
+	case entriesChannel <- entry:
+	default:
+		start := time.Now()
+		entriesChannel <- entry
+		b.buffer.Paused(time.Since(start))
+	}
+}
+
+func (b *BinlogReader) isHeartbeatEvent(rowsEvent *replication.RowsEvent) bool {
+	return b.heartbeatTable != "" &&
+		string(rowsEvent.Table.Schema) == b.heartbeatSchema &&
+		string(rowsEvent.Table.Table) == b.heartbeatTable
+}
+
+// readHeartbeat keeps in the current entry the time the job wrote to its
+// heartbeat row. Rows are (job_id, ts), the after image of an update is
+// the second of each pair.
+func (b *BinlogReader) readHeartbeat(rowsEvent *replication.RowsEvent, dml EventDML) {
+	if dml != InsertDML && dml != UpdateDML {
+		return
+	}
+	for i, row := range rowsEvent.Rows {
+		if (dml == UpdateDML && i%2 == 0) || len(row) < 2 {
+			continue
+		}
+		var jobID string
+		switch v := row[0].(type) {
+		case string:
+			jobID = v
+		case []byte:
+			jobID = string(v)
+		}
+		if jobID != b.heartbeatJobID {
+			continue
+		}
+		if ts, ok := row[1].(int64); ok {
+			b.currentBinlogEntry.Heartbeat = ts
+		}
+	}
+}
+
 func (b *BinlogReader) skipRowEvent(rowsEvent *replication.RowsEvent, dml EventDML) (bool, *config.TableContext) {
 	tableLower := strings.ToLower(string(rowsEvent.Table.Table))
 	switch strings.ToLower(string(rowsEvent.Table.Schema)) {
 	case g.DtleSchemaName:
-		if strings.ToLower(string(rowsEvent.Table.Table)) == g.GtidExecutedTableV2 {
+		if tableLower == g.GtidExecutedTableV2 || tableLower == g.SplitProgressTableV2 {
 			// cases: 1. delete for compaction; 2. insert for compaction (gtid interval); 3. normal insert for tx (single gtid)
 			// We make no special treat for case 2. That tx has only one insert, which should be ignored.
+			// The parts of a split tx but the last insert their progress instead, source_uuid second too.
 			if dml == InsertDML {
 				if len(rowsEvent.Rows) == 1 {
 					sidValue := *mysql.ToColumnValues(rowsEvent.Rows[0]).AbstractValues[1]
@@ -9,8 +9,10 @@ package binlog
 import (
 	"bytes"
 	gosql "database/sql"
+	"io/ioutil"
 	"reflect"
 	"regexp"
+	"strings"
 	"sync"
 	"testing"
 	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
@@ -56,8 +58,9 @@ func TestParseMysqlGTIDSet(t *testing.T) {
 
 func TestNewMySQLReader(t *testing.T) {
 	type args struct {
-		cfg    *config.MySQLDriverConfig
-		logger *log.Entry
+		cfg           *config.MySQLDriverConfig
+		logger        *log.Entry
+		replicateDoDb []*config.DataSource
 	}
 	tests := []struct {
 		name             string
@@ -69,7 +72,7 @@ func TestNewMySQLReader(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotBinlogReader, err := NewMySQLReader(tt.args.cfg, tt.args.logger)
+			gotBinlogReader, err := NewMySQLReader(tt.args.cfg, tt.args.logger, tt.args.replicateDoDb)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewMySQLReader() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -100,13 +103,11 @@ func TestBinlogReader_ConnectBinlogStreamer(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
-		coordinates base.BinlogCoordinateTx
+		coordinates base.BinlogCoordinatesX
 	}
 	tests := []struct {
 		name    string
@@ -127,7 +128,7 @@ func TestBinlogReader_ConnectBinlogStreamer(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -136,10 +137,8 @@ func TestBinlogReader_ConnectBinlogStreamer(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			if err := b.ConnectBinlogStreamer(tt.args.coordinates); (err != nil) != tt.wantErr {
 				t.Errorf("BinlogReader.ConnectBinlogStreamer() error = %v, wantErr %v", err, tt.wantErr)
@@ -167,10 +166,8 @@ func TestBinlogReader_GetCurrentBinlogCoordinates(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -190,7 +187,7 @@ func TestBinlogReader_GetCurrentBinlogCoordinates(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -199,10 +196,8 @@ func TestBinlogReader_GetCurrentBinlogCoordinates(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			if got := b.GetCurrentBinlogCoordinates(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("BinlogReader.GetCurrentBinlogCoordinates() = %v, want %v", got, tt.want)
@@ -230,10 +225,8 @@ func TestBinlogReader_handleRowsEvent(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		ev             *replication.BinlogEvent
@@ -258,7 +251,7 @@ func TestBinlogReader_handleRowsEvent(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -267,10 +260,8 @@ func TestBinlogReader_handleRowsEvent(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			if err := b.handleEvent(tt.args.ev, tt.args.entriesChannel); (err != nil) != tt.wantErr {
 				t.Errorf("BinlogReader.handleRowsEvent() error = %v, wantErr %v", err, tt.wantErr)
@@ -298,10 +289,8 @@ func TestBinlogReader_DataStreamEvents(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		entriesChannel chan<- *BinlogEntry
@@ -325,7 +314,7 @@ func TestBinlogReader_DataStreamEvents(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -334,10 +323,8 @@ func TestBinlogReader_DataStreamEvents(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			if err := b.DataStreamEvents(tt.args.entriesChannel); (err != nil) != tt.wantErr {
 				t.Errorf("BinlogReader.DataStreamEvents() error = %v, wantErr %v", err, tt.wantErr)
@@ -365,10 +352,8 @@ func TestBinlogReader_BinlogStreamEvents(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		txChannel chan<- *BinlogTx
@@ -392,7 +377,7 @@ func TestBinlogReader_BinlogStreamEvents(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -401,10 +386,8 @@ func TestBinlogReader_BinlogStreamEvents(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			if err := b.BinlogStreamEvents(tt.args.txChannel); (err != nil) != tt.wantErr {
 				t.Errorf("BinlogReader.BinlogStreamEvents() error = %v, wantErr %v", err, tt.wantErr)
@@ -432,10 +415,8 @@ func TestBinlogReader_handleBinlogRowsEvent(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		ev        *replication.BinlogEvent
@@ -460,7 +441,7 @@ func TestBinlogReader_handleBinlogRowsEvent(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -469,10 +450,8 @@ func TestBinlogReader_handleBinlogRowsEvent(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			if err := b.handleBinlogRowsEvent(tt.args.ev, tt.args.txChannel); (err != nil) != tt.wantErr {
 				t.Errorf("BinlogReader.handleBinlogRowsEvent() error = %v, wantErr %v", err, tt.wantErr)
@@ -500,10 +479,8 @@ func TestBinlogReader_appendQuery(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		query string
@@ -526,7 +503,7 @@ func TestBinlogReader_appendQuery(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -535,10 +512,8 @@ func TestBinlogReader_appendQuery(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			b.appendQuery(tt.args.query)
 		})
@@ -584,10 +559,8 @@ func TestBinlogReader_clearB64Sql(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -606,7 +579,7 @@ func TestBinlogReader_clearB64Sql(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -615,10 +588,8 @@ func TestBinlogReader_clearB64Sql(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			b.clearB64Sql()
 		})
@@ -644,10 +615,8 @@ func TestBinlogReader_appendB64Sql(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		event *BinlogEvent
@@ -670,7 +639,7 @@ func TestBinlogReader_appendB64Sql(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -679,10 +648,8 @@ func TestBinlogReader_appendB64Sql(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			b.appendB64Sql(tt.args.event)
 		})
@@ -708,10 +675,8 @@ func TestBinlogReader_onCommit(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		lastEvent *BinlogEvent
@@ -735,7 +700,7 @@ func TestBinlogReader_onCommit(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -744,10 +709,8 @@ func TestBinlogReader_onCommit(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			b.onCommit(tt.args.lastEvent, tt.args.txChannel)
 		})
@@ -785,33 +748,165 @@ func Test_resolveDDLSQL(t *testing.T) {
 	type args struct {
 		sql string
 	}
+	const alter = "alter TABLE aly_test ADD COLUMN (name5 CHAR(5) ,name6 char(6));"
 	tests := []struct {
-		name     string
-		args     args
-		wantSqls []string
-		wantOk   bool
-		wantErr  bool
+		name       string
+		args       args
+		wantResult parseDDLResult
+		wantErr    bool
 	}{
-		// TODO: Add test cases.
-		{"t1", args{"alter TABLE aly_test ADD COLUMN (name5 CHAR(5) ,name6 char(6));"}, []string{}, true, false},
+		{"t1", args{alter}, parseDDLResult{isDDL: true, ddlType: DDLAlterTable,
+			tables: []SchemaTable{{Table: "aly_test"}}, sqls: []string{alter}}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotSqls, gotOk, err := resolveDDLSQL(tt.args.sql)
+			gotResult, err := resolveDDLSQL(tt.args.sql)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("resolveDDLSQL() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(gotSqls, tt.wantSqls) {
-				t.Errorf("resolveDDLSQL() gotSqls = %v, want %v", gotSqls, tt.wantSqls)
+			if !reflect.DeepEqual(gotResult, tt.wantResult) {
+				t.Errorf("resolveDDLSQL() = %+v, want %+v", gotResult, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestBinlogReader_checkStatementEvent(t *testing.T) {
+	b := &BinlogReader{
+		mysqlContext: &config.MySQLDriverConfig{
+			ReplicateDoDb: []*config.DataSource{{TableSchema: "db1", Tables: []*config.Table{{TableName: "t1"}}}},
+		},
+		currentCoordinates: base.BinlogCoordinateTx{LogFile: "mysql-bin.000003"},
+	}
+	ev := &replication.BinlogEvent{Header: &replication.EventHeader{LogPos: 500, EventSize: 100}}
+
+	tests := []struct {
+		name          string
+		currentSchema string
+		query         string
+		wantErr       bool
+	}{
+		{"insert", "db1", "insert into t1 values (1)", true},
+		{"qualified update", "", "UPDATE db1.t1 SET c = 1", true},
+		{"multi-table delete", "db2", "delete a, b from db1.t1 a join t2 b on a.id = b.id", true},
+		{"table not replicated", "db1", "insert into t2 select * from t1", false},
+		{"schema not replicated", "db2", "insert into t1 values (1)", false},
+		{"not dml", "db1", "SAVEPOINT sp", false},
+		{"unparsed dml", "db1", "insert into t1 values (", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := b.checkStatementEvent(ev, tt.currentSchema, tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BinlogReader.checkStatementEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "mysql-bin.000003:400") {
+				t.Errorf("BinlogReader.checkStatementEvent() error = %v, want the position of the event", err)
+			}
+		})
+	}
+}
+
+func TestBinlogReader_readHeartbeat(t *testing.T) {
+	b := &BinlogReader{}
+	b.SetHeartbeatTable("dtle", "heartbeat", "job1")
+	rowsEvent := func(table string, rows ...[]interface{}) *replication.RowsEvent {
+		return &replication.RowsEvent{
+			Table: &replication.TableMapEvent{Schema: []byte("dtle"), Table: []byte(table)},
+			Rows:  rows,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		event         *replication.RowsEvent
+		dml           EventDML
+		wantHeartbeat bool
+		want          int64
+	}{
+		{"insert", rowsEvent("heartbeat", []interface{}{"job1", int64(100)}), InsertDML, true, 100},
+		{"update", rowsEvent("heartbeat", []interface{}{[]byte("job1"), int64(100)}, []interface{}{[]byte("job1"), int64(200)}), UpdateDML, true, 200},
+		{"other job", rowsEvent("heartbeat", []interface{}{"job2", int64(300)}), InsertDML, true, 0},
+		{"delete", rowsEvent("heartbeat", []interface{}{"job1", int64(400)}), DeleteDML, true, 0},
+		{"other table", rowsEvent("t1", []interface{}{"job1", int64(500)}), InsertDML, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b.currentBinlogEntry = &BinlogEntry{}
+			if got := b.isHeartbeatEvent(tt.event); got != tt.wantHeartbeat {
+				t.Fatalf("BinlogReader.isHeartbeatEvent() = %v, want %v", got, tt.wantHeartbeat)
+			}
+			if !tt.wantHeartbeat {
+				return
 			}
-			if gotOk != tt.wantOk {
-				t.Errorf("resolveDDLSQL() gotOk = %v, want %v", gotOk, tt.wantOk)
+			b.readHeartbeat(tt.event, tt.dml)
+			if b.currentBinlogEntry.Heartbeat != tt.want {
+				t.Errorf("BinlogEntry.Heartbeat = %v, want %v", b.currentBinlogEntry.Heartbeat, tt.want)
 			}
 		})
 	}
 }
 
+func TestBinlogReader_handleEvent_where(t *testing.T) {
+	table := config.NewTable("db1", "t1")
+	table.Where = "region = 'us'"
+	table.OriginalTableColumns = mysql.NewColumnList([]mysql.Column{{Name: "id"}, {Name: "region"}})
+	whereCtx, err := config.NewWhereCtx(table.Where, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &BinlogReader{
+		logger:             log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)),
+		mysqlContext:       &config.MySQLDriverConfig{},
+		tables:             map[string]map[string]*config.TableContext{"db1": {"t1": config.NewTableContext(table, whereCtx)}},
+		currentCoordinates: base.BinlogCoordinateTx{LogFile: "mysql-bin.000001", LogPos: 100},
+		currentBinlogEntry: &BinlogEntry{},
+	}
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.UPDATE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Table:       &replication.TableMapEvent{Schema: []byte("db1"), Table: []byte("t1")},
+			ColumnCount: 2,
+			Rows: [][]interface{}{
+				{int64(1), "eu"}, {int64(1), "us"}, // moves in
+				{int64(2), "us"}, {int64(2), "eu"}, // moves out
+				{int64(3), "us"}, {int64(3), "us"}, // stays in
+				{int64(4), "eu"}, {int64(4), "eu"}, // stays out
+			},
+		},
+	}
+	if err := b.handleEvent(ev, nil); err != nil {
+		t.Fatalf("BinlogReader.handleEvent() error = %v", err)
+	}
+
+	want := []struct {
+		dml      EventDML
+		id       int64
+		hasWhere bool
+		hasNew   bool
+	}{
+		{InsertDML, 1, false, true},
+		{DeleteDML, 2, true, false},
+		{UpdateDML, 3, true, true},
+	}
+	events := b.currentBinlogEntry.Events
+	if len(events) != len(want) {
+		t.Fatalf("BinlogReader.handleEvent() made %d events, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		e := events[i]
+		values := e.NewColumnValues
+		if values == nil {
+			values = e.WhereColumnValues
+		}
+		if e.DML != w.dml || *values.AbstractValues[0] != w.id ||
+			(e.WhereColumnValues != nil) != w.hasWhere || (e.NewColumnValues != nil) != w.hasNew {
+			t.Errorf("event %d = %v of row %v, want %v of row %v", i, e.DML, *values.AbstractValues[0], w.dml, w.id)
+		}
+	}
+}
+
 func TestBinlogReader_skipQueryDDL(t *testing.T) {
 	type fields struct {
 		logger                   *log.Entry
@@ -831,14 +926,13 @@ func TestBinlogReader_skipQueryDDL(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
-		sql    string
-		schema string
+		sql       string
+		schema    string
+		tableName string
 	}
 	tests := []struct {
 		name   string
@@ -859,7 +953,7 @@ func TestBinlogReader_skipQueryDDL(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -868,12 +962,10 @@ func TestBinlogReader_skipQueryDDL(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
-			if got := b.skipQueryDDL(tt.args.sql, tt.args.schema); got != tt.want {
+			if got := b.skipQueryDDL(tt.args.sql, tt.args.schema, tt.args.tableName); got != tt.want {
 				t.Errorf("BinlogReader.skipQueryDDL() = %v, want %v", got, tt.want)
 			}
 		})
@@ -919,10 +1011,8 @@ func TestBinlogReader_skipRowEvent(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		schema string
@@ -947,7 +1037,7 @@ func TestBinlogReader_skipRowEvent(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -956,10 +1046,8 @@ func TestBinlogReader_skipRowEvent(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			if got := b.skipEvent(tt.args.schema, tt.args.table); got != tt.want {
 				t.Errorf("BinlogReader.skipRowEvent() = %v, want %v", got, tt.want)
@@ -987,10 +1075,8 @@ func TestBinlogReader_matchString(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		pattern string
@@ -1015,7 +1101,7 @@ func TestBinlogReader_matchString(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -1024,10 +1110,8 @@ func TestBinlogReader_matchString(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			if got := b.matchString(tt.args.pattern, tt.args.t); got != tt.want {
 				t.Errorf("BinlogReader.matchString() = %v, want %v", got, tt.want)
@@ -1055,10 +1139,8 @@ func TestBinlogReader_matchDB(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		patternDBS []*config.DataSource
@@ -1083,7 +1165,7 @@ func TestBinlogReader_matchDB(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -1092,10 +1174,8 @@ func TestBinlogReader_matchDB(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			if got := b.matchDB(tt.args.patternDBS, tt.args.a); got != tt.want {
 				t.Errorf("BinlogReader.matchDB() = %v, want %v", got, tt.want)
@@ -1123,10 +1203,8 @@ func TestBinlogReader_Close(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -1146,7 +1224,7 @@ func TestBinlogReader_Close(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -1155,10 +1233,8 @@ func TestBinlogReader_Close(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
 			if err := b.Close(); (err != nil) != tt.wantErr {
 				t.Errorf("BinlogReader.Close() error = %v, wantErr %v", err, tt.wantErr)
@@ -1186,14 +1262,13 @@ func TestBinlogReader_matchTable(t *testing.T) {
 		currentSqlB64            *bytes.Buffer
 		appendB64SqlBs           []byte
 		ReMap                    map[string]*regexp.Regexp
-		wg                       sync.WaitGroup
 		shutdown                 bool
 		shutdownCh               chan struct{}
-		shutdownLock             sync.Mutex
 	}
 	type args struct {
 		patternTBS []*config.DataSource
-		t          config.DataSource
+		schemaName string
+		tableName  string
 	}
 	tests := []struct {
 		name   string
@@ -1214,7 +1289,7 @@ func TestBinlogReader_matchTable(t *testing.T) {
 				currentCoordinates:       tt.fields.currentCoordinates,
 				currentCoordinatesMutex:  tt.fields.currentCoordinatesMutex,
 				LastAppliedRowsEventHint: tt.fields.LastAppliedRowsEventHint,
-				MysqlContext:             tt.fields.MysqlContext,
+				mysqlContext:             tt.fields.MysqlContext,
 				currentTx:                tt.fields.currentTx,
 				currentBinlogEntry:       tt.fields.currentBinlogEntry,
 				txCount:                  tt.fields.txCount,
@@ -1223,12 +1298,10 @@ func TestBinlogReader_matchTable(t *testing.T) {
 				currentSqlB64:            tt.fields.currentSqlB64,
 				appendB64SqlBs:           tt.fields.appendB64SqlBs,
 				ReMap:                    tt.fields.ReMap,
-				wg:                       tt.fields.wg,
 				shutdown:                 tt.fields.shutdown,
 				shutdownCh:               tt.fields.shutdownCh,
-				shutdownLock:             tt.fields.shutdownLock,
 			}
-			if got := b.matchTable(tt.args.patternTBS, config.Table{}); got != tt.want {
+			if got := b.matchTable(tt.args.patternTBS, tt.args.schemaName, tt.args.tableName); got != tt.want {
 				t.Errorf("BinlogReader.matchTable() = %v, want %v", got, tt.want)
 			}
 		})
@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EntryBuffer counts the bytes of the entries the reader sent and the
+// extractor didn't send to the applier yet. Once they reach the limit, the
+// reader pauses reading the binlog until the extractor takes entries, rather
+// than holding ever more transactions in memory while the applier is slow.
+type EntryBuffer struct {
+	// limit is the most bytes the buffer holds, 0 not to limit them
+	limit  int64
+	used   int64
+	closed bool
+	cond   *sync.Cond
+
+	// paused is how long the reader waited for room, in nanoseconds
+	paused int64
+}
+
+// NewEntryBuffer returns a buffer holding up to limit bytes of entries, or
+// any amount of them if limit is 0
+func NewEntryBuffer(limit int64) *EntryBuffer {
+	return &EntryBuffer{limit: limit, cond: sync.NewCond(&sync.Mutex{})}
+}
+
+// Reserve waits for room for an entry of size bytes, and returns whether
+// it got it, which it doesn't once the buffer was closed. An entry larger
+// than the limit only waits for the buffer to be empty.
+func (b *EntryBuffer) Reserve(size int) bool {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+	if b.full(size) {
+		start := time.Now()
+		for b.full(size) {
+			b.cond.Wait()
+		}
+		b.Paused(time.Since(start))
+	}
+	if b.closed {
+		return false
+	}
+	b.used += int64(size)
+	return true
+}
+
+func (b *EntryBuffer) full(size int) bool {
+	return !b.closed && b.limit > 0 && b.used > 0 && b.used+int64(size) > b.limit
+}
+
+// Release gives back the room of an entry of size bytes the extractor took
+func (b *EntryBuffer) Release(size int) {
+	if size == 0 {
+		return
+	}
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+	b.used -= int64(size)
+	if b.used < 0 {
+		b.used = 0
+	}
+	b.cond.Broadcast()
+}
+
+// Close wakes up the reader waiting for room, as the extractor shuts down
+func (b *EntryBuffer) Close() {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+	b.closed = true
+	b.cond.Broadcast()
+}
+
+// Used returns the bytes of the entries in the buffer
+func (b *EntryBuffer) Used() int64 {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+	return b.used
+}
+
+// Limit returns the most bytes the buffer holds, 0 if it doesn't limit them
+func (b *EntryBuffer) Limit() int64 {
+	return b.limit
+}
+
+// Paused adds d to the time the reader paused, as the buffer was full
+func (b *EntryBuffer) Paused(d time.Duration) {
+	atomic.AddInt64(&b.paused, int64(d))
+}
+
+// PausedSeconds returns how long the reader paused in all, as the buffer
+// was full
+func (b *EntryBuffer) PausedSeconds() float64 {
+	return time.Duration(atomic.LoadInt64(&b.paused)).Seconds()
+}
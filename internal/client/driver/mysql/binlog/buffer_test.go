@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEntryBuffer_Reserve(t *testing.T) {
+	b := NewEntryBuffer(100)
+	// An entry larger than the limit fits an empty buffer
+	if !b.Reserve(150) {
+		t.Fatalf("EntryBuffer.Reserve(150) = false on an empty buffer")
+	}
+
+	reserved := make(chan bool)
+	go func() {
+		reserved <- b.Reserve(10)
+	}()
+	select {
+	case <-reserved:
+		t.Fatalf("EntryBuffer.Reserve(10) didn't wait for room")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.Release(150)
+	if ok := <-reserved; !ok {
+		t.Fatalf("EntryBuffer.Reserve(10) = false once there was room")
+	}
+	if used := b.Used(); used != 10 {
+		t.Errorf("EntryBuffer.Used() = %d, want 10", used)
+	}
+	if b.PausedSeconds() < 0.05 {
+		t.Errorf("EntryBuffer.PausedSeconds() = %v, want at least 0.05", b.PausedSeconds())
+	}
+
+	// Closing wakes up the reader waiting for room
+	b.Reserve(90)
+	go func() {
+		reserved <- b.Reserve(10)
+	}()
+	b.Close()
+	if ok := <-reserved; ok {
+		t.Errorf("EntryBuffer.Reserve(10) = true once closed")
+	}
+}
+
+func TestEntryBuffer_Unlimited(t *testing.T) {
+	b := NewEntryBuffer(0)
+	for i := 0; i < 3; i++ {
+		if !b.Reserve(1 << 20) {
+			t.Fatalf("EntryBuffer.Reserve() = false without a limit")
+		}
+	}
+	if used := b.Used(); used != 3<<20 {
+		t.Errorf("EntryBuffer.Used() = %d, want %d", used, 3<<20)
+	}
+}
@@ -0,0 +1,491 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// Types of the events of MySQL 8.0 the parser of go-mysql doesn't know,
+// see Log_event_type in libbinlogevents/include/binlog_event.h
+const (
+	transactionContextEvent replication.EventType = replication.PREVIOUS_GTIDS_EVENT + 1 + iota
+	viewChangeEvent
+	xaPrepareLogEvent
+	partialUpdateRowsEvent
+	transactionPayloadEvent
+	heartbeatLogEventV2
+)
+
+var eventTypeNames80 = map[replication.EventType]string{
+	transactionContextEvent: "TransactionContextEvent",
+	viewChangeEvent:         "ViewChangeEvent",
+	xaPrepareLogEvent:       "XAPrepareLogEvent",
+	partialUpdateRowsEvent:  "PartialUpdateRowsEvent",
+	transactionPayloadEvent: "TransactionPayloadEvent",
+	heartbeatLogEventV2:     "HeartbeatLogEventV2",
+}
+
+// eventTypeString returns the name of the events of type tp
+func eventTypeString(tp replication.EventType) string {
+	if name, ok := eventTypeNames80[tp]; ok {
+		return name
+	}
+	return tp.String()
+}
+
+// Types of the fields of the optional metadata of a table map, see
+// Table_map_log_event::Optional_metadata_field_type
+const (
+	tableMetaSignedness byte = iota + 1
+	tableMetaDefaultCharset
+	tableMetaColumnCharset
+	tableMetaColumnName
+	tableMetaSetStrValue
+	tableMetaEnumStrValue
+	tableMetaGeometryType
+	tableMetaSimplePrimaryKey
+	tableMetaPrimaryKeyWithPrefix
+)
+
+// partialJSONUpdates is set in the options of the values of the after
+// image of a partial update when some of its JSON columns are logged as
+// their changes, see binlog_row_value_options
+const partialJSONUpdates = 0x01
+
+// jsonDiff is the value of a JSON column of the after image of a partial
+// update which is logged as the changes to its value in the before image,
+// left in their binary format, see Json_diff_vector::write_binary
+type jsonDiff []byte
+
+// tableMetadata is the optional metadata MySQL 8.0 logs in a table map
+// after its NULL bitmap, see binlog_row_metadata
+type tableMetadata struct {
+	// SignednessBitmap has a bit for each numeric column only
+	SignednessBitmap []byte
+	ColumnName       [][]byte
+	// PrimaryKey are the indexes of the columns of the primary key, and
+	// PrimaryKeyPrefix the lengths of their prefixes, 0 for the whole
+	// column
+	PrimaryKey       []uint64
+	PrimaryKeyPrefix []uint64
+}
+
+// tableMap is a table map the parser decoded, with its optional metadata
+type tableMap struct {
+	event *replication.TableMapEvent
+	meta  *tableMetadata
+}
+
+// eventParser decodes the events a syncer in raw mode streams. The parser
+// of go-mysql doesn't know the events MySQL 8.0 adds to the ones of 5.7,
+// and decodes the binary JSON into a text which loses the types of its
+// values and the order of its members, so the events are rewritten before
+// it decodes them. The optional metadata of a table map is cut, and kept
+// by the parser. Its JSON columns are typed as blobs, logged the same, so
+// their values are left in the binary format, and the JSON types are set
+// back once decoded. A partial update becomes an update, whose JSON
+// columns logged as their changes are set back to jsonDiff. The events
+// keep their own header and raw data.
+type eventParser struct {
+	parser *replication.BinlogParser
+	format *replication.FormatDescriptionEvent
+	tables map[uint64]*tableMap
+}
+
+// newEventParser returns a parser decoding the values of the rows as the
+// syncer of cfg would
+func newEventParser(cfg replication.BinlogSyncerConfig) *eventParser {
+	parser := replication.NewBinlogParser()
+	parser.SetParseTime(cfg.ParseTime)
+	parser.SetTimestampStringLocation(cfg.TimestampStringLocation)
+	parser.SetUseDecimal(cfg.UseDecimal)
+	return &eventParser{parser: parser, tables: make(map[uint64]*tableMap)}
+}
+
+// parse decodes the raw event ev
+func (p *eventParser) parse(ev *replication.BinlogEvent) (*replication.BinlogEvent, error) {
+	data := ev.RawData
+	var columnType []byte
+	var meta *tableMetadata
+	var partial map[int][]bool
+	var err error
+	switch ev.Header.EventType {
+	case replication.TABLE_MAP_EVENT:
+		if data, columnType, meta, err = p.rewriteTableMap(data); err != nil {
+			return nil, fmt.Errorf("table map at %d: %v", ev.Header.LogPos, err)
+		}
+	case partialUpdateRowsEvent:
+		if data, partial, err = p.rewritePartialUpdate(data); err != nil {
+			return nil, fmt.Errorf("partial update at %d: %v", ev.Header.LogPos, err)
+		}
+	}
+
+	parsed, err := p.parser.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	ev = &replication.BinlogEvent{RawData: ev.RawData, Header: ev.Header, Event: parsed.Event}
+	switch evt := ev.Event.(type) {
+	case *replication.FormatDescriptionEvent:
+		p.format = evt
+		p.tables = make(map[uint64]*tableMap)
+	case *replication.TableMapEvent:
+		table := *evt
+		table.ColumnType = columnType
+		ev.Event = &table
+		p.tables[evt.TableID] = &tableMap{event: &table, meta: meta}
+	case *replication.RowsEvent:
+		if table, ok := p.tables[evt.TableID]; ok {
+			evt.Table = table.event
+		}
+		for i, columns := range partial {
+			for j, isPartial := range columns {
+				if value, ok := evt.Rows[i][j].([]byte); ok && isPartial {
+					evt.Rows[i][j] = jsonDiff(value)
+				}
+			}
+		}
+		if evt.Flags&replication.RowsEventStmtEndFlag != 0 {
+			p.tables = make(map[uint64]*tableMap)
+		}
+	}
+	return ev, nil
+}
+
+// tableMetadata returns the optional metadata of the table map of the
+// table tableID, or nil
+func (p *eventParser) tableMetadata(tableID uint64) *tableMetadata {
+	if table, ok := p.tables[tableID]; ok {
+		return table.meta
+	}
+	return nil
+}
+
+// eventReader reads the body of an event, failing once it is too short
+type eventReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *eventReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data)-r.pos < n {
+		r.err = fmt.Errorf("%d bytes needed at %d, %d left", n, r.pos, len(r.data)-r.pos)
+		return nil
+	}
+	r.pos += n
+	return r.data[r.pos-n : r.pos]
+}
+
+func (r *eventReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *eventReader) lengthEncodedInt() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.err = fmt.Errorf("length encoded integer needed at %d", r.pos)
+		return 0
+	}
+	v, _, n := gomysql.LengthEncodedInt(r.data[r.pos:])
+	r.next(n)
+	return v
+}
+
+// split returns the header and the body of the event data, without its
+// checksum
+func (p *eventParser) split(data []byte) ([]byte, []byte, error) {
+	end := len(data)
+	if p.format != nil && p.format.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+		end -= replication.BinlogChecksumLength
+	}
+	if end < replication.EventHeaderSize {
+		return nil, nil, fmt.Errorf("event of %d bytes", len(data))
+	}
+	return data[:replication.EventHeaderSize], data[replication.EventHeaderSize:end], nil
+}
+
+// join returns the event of type tp made of header and body, with its
+// size and checksum set
+func (p *eventParser) join(header []byte, tp replication.EventType, body []byte) []byte {
+	crc := p.format != nil && p.format.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32
+	data := make([]byte, 0, len(header)+len(body)+replication.BinlogChecksumLength)
+	data = append(append(data, header...), body...)
+	data[4] = byte(tp)
+	size := len(data)
+	if crc {
+		size += replication.BinlogChecksumLength
+	}
+	binary.LittleEndian.PutUint32(data[9:], uint32(size))
+	if crc {
+		checksum := make([]byte, replication.BinlogChecksumLength)
+		binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(data))
+		data = append(data, checksum...)
+	}
+	return data
+}
+
+// tableIDSize returns the size of the table ID of the events of type tp
+func (p *eventParser) tableIDSize(tp replication.EventType) int {
+	if p.format != nil && int(tp) <= len(p.format.EventTypeHeaderLengths) &&
+		p.format.EventTypeHeaderLengths[tp-1] == 6 {
+		return 4
+	}
+	return 6
+}
+
+// rewriteTableMap cuts the optional metadata of the table map of data,
+// and types its JSON columns as blobs. It returns the types of the columns
+// and the metadata decoded.
+func (p *eventParser) rewriteTableMap(data []byte) ([]byte, []byte, *tableMetadata, error) {
+	header, body, err := p.split(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r := &eventReader{data: body}
+	r.next(p.tableIDSize(replication.TABLE_MAP_EVENT) + 2)
+	// The schema and the table, each ended by a 0
+	r.next(int(r.byte()) + 1)
+	r.next(int(r.byte()) + 1)
+	columnCount := r.lengthEncodedInt()
+	typesPos := r.pos
+	columnType := append([]byte(nil), r.next(int(columnCount))...)
+	r.next(int(r.lengthEncodedInt()))
+	r.next(int(columnCount+7) / 8)
+	if r.err != nil {
+		return nil, nil, nil, r.err
+	}
+
+	var meta *tableMetadata
+	if r.pos < len(body) {
+		if meta, err = decodeTableMetadata(body[r.pos:]); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	rewritten := append([]byte(nil), body[:r.pos]...)
+	for i, tp := range columnType {
+		if tp == gomysql.MYSQL_TYPE_JSON {
+			rewritten[typesPos+i] = gomysql.MYSQL_TYPE_BLOB
+		}
+	}
+	return p.join(header, replication.TABLE_MAP_EVENT, rewritten), columnType, meta, nil
+}
+
+// decodeTableMetadata decodes the fields of the optional metadata of a
+// table map, each its type, its length and its value. The fields of types
+// it doesn't know are skipped.
+func decodeTableMetadata(data []byte) (*tableMetadata, error) {
+	meta := &tableMetadata{}
+	r := &eventReader{data: data}
+	for r.err == nil && r.pos < len(data) {
+		tp := r.byte()
+		v := &eventReader{data: r.next(int(r.lengthEncodedInt()))}
+		if r.err != nil {
+			break
+		}
+		switch tp {
+		case tableMetaSignedness:
+			meta.SignednessBitmap = v.data
+		case tableMetaColumnName:
+			for v.err == nil && v.pos < len(v.data) {
+				meta.ColumnName = append(meta.ColumnName, v.next(int(v.lengthEncodedInt())))
+			}
+		case tableMetaSimplePrimaryKey, tableMetaPrimaryKeyWithPrefix:
+			for v.err == nil && v.pos < len(v.data) {
+				meta.PrimaryKey = append(meta.PrimaryKey, v.lengthEncodedInt())
+				prefix := uint64(0)
+				if tp == tableMetaPrimaryKeyWithPrefix {
+					prefix = v.lengthEncodedInt()
+				}
+				meta.PrimaryKeyPrefix = append(meta.PrimaryKeyPrefix, prefix)
+			}
+		}
+		if v.err != nil {
+			return nil, fmt.Errorf("optional metadata of type %d: %v", tp, v.err)
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("optional metadata: %v", r.err)
+	}
+	return meta, nil
+}
+
+// rewritePartialUpdate rewrites the partial update of data into an update,
+// cutting the options of the values of its after images. It returns which
+// columns of the after images are logged as their changes, by row.
+// refer: Rows_log_event::print_verbose_one_row() of mysql 8.0
+func (p *eventParser) rewritePartialUpdate(data []byte) ([]byte, map[int][]bool, error) {
+	header, body, err := p.split(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &eventReader{data: body}
+	tableID := gomysql.FixedLengthInt(r.next(p.tableIDSize(partialUpdateRowsEvent)))
+	r.next(2)
+	// The extra data, whose length counts its own 2 bytes
+	if extra := r.next(2); extra != nil {
+		r.next(int(binary.LittleEndian.Uint16(extra)) - 2)
+	}
+	columnCount := int(r.lengthEncodedInt())
+	bitmap1 := r.next((columnCount + 7) / 8)
+	bitmap2 := r.next((columnCount + 7) / 8)
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	table, ok := p.tables[tableID]
+	if !ok {
+		return nil, nil, fmt.Errorf("no table map of table %d", tableID)
+	}
+	if len(table.event.ColumnType) != columnCount {
+		return nil, nil, fmt.Errorf("%d columns, the table map has %d", columnCount, len(table.event.ColumnType))
+	}
+	jsonCount := 0
+	for _, tp := range table.event.ColumnType {
+		if tp == gomysql.MYSQL_TYPE_JSON {
+			jsonCount++
+		}
+	}
+
+	rewritten := append([]byte(nil), body[:r.pos]...)
+	partial := make(map[int][]bool)
+	for row := 0; r.err == nil && r.pos < len(body); row += 2 {
+		start := r.pos
+		skipRowImage(r, table.event, bitmap1)
+		rewritten = append(rewritten, body[start:r.pos]...)
+
+		var partialBitmap []byte
+		if r.lengthEncodedInt()&partialJSONUpdates != 0 {
+			partialBitmap = r.next((jsonCount + 7) / 8)
+		}
+		start = r.pos
+		skipRowImage(r, table.event, bitmap2)
+		rewritten = append(rewritten, body[start:r.pos]...)
+		if partialBitmap == nil {
+			continue
+		}
+		columns := make([]bool, columnCount)
+		jsonIndex := 0
+		for i, tp := range table.event.ColumnType {
+			if tp == gomysql.MYSQL_TYPE_JSON {
+				columns[i] = isBitSet(partialBitmap, jsonIndex)
+				jsonIndex++
+			}
+		}
+		partial[row+1] = columns
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	return p.join(header, replication.UPDATE_ROWS_EVENTv2, rewritten), partial, nil
+}
+
+func isBitSet(bitmap []byte, i int) bool {
+	return bitmap[i>>3]&(1<<(uint(i)&7)) > 0
+}
+
+// skipRowImage reads the image of a row, whose columns are those of bitmap
+func skipRowImage(r *eventReader, table *replication.TableMapEvent, bitmap []byte) {
+	var columns []int
+	for i := range table.ColumnType {
+		if isBitSet(bitmap, i) {
+			columns = append(columns, i)
+		}
+	}
+	nullBitmap := r.next((len(columns) + 7) / 8)
+	for j, i := range columns {
+		if r.err != nil || isBitSet(nullBitmap, j) {
+			continue
+		}
+		n, err := columnValueLength(r.data[r.pos:], table.ColumnType[i], table.ColumnMeta[i])
+		if err != nil {
+			r.err = fmt.Errorf("column %d: %v", i+1, err)
+			return
+		}
+		r.next(n)
+	}
+}
+
+// columnValueLength returns the length of the value of a column of type tp
+// and meta at the start of data
+// refer: RowsEvent.decodeValue() of go-mysql
+func columnValueLength(data []byte, tp byte, meta uint16) (int, error) {
+	if tp == gomysql.MYSQL_TYPE_STRING && meta >= 256 {
+		b0, b1 := uint8(meta>>8), uint8(meta&0xFF)
+		if b0&0x30 != 0x30 {
+			meta = uint16(b1) | uint16((b0&0x30)^0x30)<<4
+			tp = b0 | 0x30
+		} else {
+			meta = uint16(b1)
+			tp = b0
+		}
+	}
+
+	switch tp {
+	case gomysql.MYSQL_TYPE_NULL:
+		return 0, nil
+	case gomysql.MYSQL_TYPE_TINY, gomysql.MYSQL_TYPE_YEAR:
+		return 1, nil
+	case gomysql.MYSQL_TYPE_SHORT:
+		return 2, nil
+	case gomysql.MYSQL_TYPE_INT24, gomysql.MYSQL_TYPE_TIME, gomysql.MYSQL_TYPE_DATE:
+		return 3, nil
+	case gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_FLOAT, gomysql.MYSQL_TYPE_TIMESTAMP:
+		return 4, nil
+	case gomysql.MYSQL_TYPE_LONGLONG, gomysql.MYSQL_TYPE_DOUBLE, gomysql.MYSQL_TYPE_DATETIME:
+		return 8, nil
+	case gomysql.MYSQL_TYPE_TIMESTAMP2:
+		return 4 + int(meta+1)/2, nil
+	case gomysql.MYSQL_TYPE_DATETIME2:
+		return 5 + int(meta+1)/2, nil
+	case gomysql.MYSQL_TYPE_TIME2:
+		return 3 + int(meta+1)/2, nil
+	case gomysql.MYSQL_TYPE_NEWDECIMAL:
+		precision, scale := int(meta>>8), int(meta&0xFF)
+		if scale > precision {
+			return 0, fmt.Errorf("decimal(%d,%d)", precision, scale)
+		}
+		integral := precision - scale
+		return integral/9*4 + digitsBytes[integral%9] + scale/9*4 + digitsBytes[scale%9], nil
+	case gomysql.MYSQL_TYPE_BIT:
+		nbits := int(meta>>8)*8 + int(meta&0xFF)
+		return (nbits + 7) / 8, nil
+	case gomysql.MYSQL_TYPE_ENUM, gomysql.MYSQL_TYPE_SET:
+		return int(meta & 0xFF), nil
+	case gomysql.MYSQL_TYPE_VARCHAR, gomysql.MYSQL_TYPE_VAR_STRING, gomysql.MYSQL_TYPE_STRING:
+		if meta < 256 {
+			if len(data) < 1 {
+				return 0, fmt.Errorf("string length needed")
+			}
+			return 1 + int(data[0]), nil
+		}
+		if len(data) < 2 {
+			return 0, fmt.Errorf("string length needed")
+		}
+		return 2 + int(binary.LittleEndian.Uint16(data)), nil
+	case gomysql.MYSQL_TYPE_BLOB, gomysql.MYSQL_TYPE_GEOMETRY, gomysql.MYSQL_TYPE_JSON:
+		if meta < 1 || meta > 4 || len(data) < int(meta) {
+			return 0, fmt.Errorf("blob of %d bytes of length", meta)
+		}
+		return int(meta) + int(gomysql.FixedLengthInt(data[:meta])), nil
+	default:
+		return 0, fmt.Errorf("unsupported type %d", tp)
+	}
+}
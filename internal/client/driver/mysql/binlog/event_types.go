@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"fmt"
+
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// knownEventType tells whether the events of type tp are of MySQL, up to
+// 8.0, or of MariaDB, which the parser knows
+func knownEventType(tp replication.EventType) bool {
+	return tp <= heartbeatLogEventV2 ||
+		(tp >= replication.MARIADB_ANNOTATE_ROWS_EVENT && tp <= replication.MARIADB_GTID_LIST_EVENT)
+}
+
+// checkEventType returns whether to skip ev: an event of MySQL 8.0 with
+// nothing to replicate, or of a type unknown to the reader the source
+// marked as ignorable. It fails on an event changing data which can't be
+// replicated, and on one of an unknown type the source doesn't allow to
+// ignore: skipping it could lose the changes of a transaction.
+func (b *BinlogReader) checkEventType(ev *replication.BinlogEvent) (bool, error) {
+	tp := ev.Header.EventType
+	where := fmt.Sprintf("%s:%d", b.currentCoordinates.LogFile, ev.Header.LogPos-ev.Header.EventSize)
+	switch tp {
+	case transactionContextEvent, viewChangeEvent:
+		// Of the certification of group replication
+		b.logger.Debugf("mysql.reader: skip %s at %s", eventTypeString(tp), where)
+		return true, nil
+	case replication.HEARTBEAT_EVENT, heartbeatLogEventV2:
+		return true, nil
+	case transactionPayloadEvent:
+		return false, fmt.Errorf("compressed transaction at %s: the transactions compressed by binlog_transaction_compression can't be replicated, set it OFF on the source", where)
+	case xaPrepareLogEvent:
+		return false, fmt.Errorf("XA PREPARE at %s: XA transactions can't be replicated", where)
+	}
+	if knownEventType(tp) {
+		return false, nil
+	}
+	if ev.Header.Flags&replication.LOG_EVENT_IGNORABLE_F != 0 {
+		b.logger.Warnf("mysql.reader: skip the ignorable event of unknown type %d at %s", tp, where)
+		return true, nil
+	}
+	return false, fmt.Errorf("event of unknown type %d at %s, which the source doesn't allow to ignore: the source may be of a version of MySQL the reader doesn't support", tp, where)
+}
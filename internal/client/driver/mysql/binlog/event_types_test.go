@@ -0,0 +1,220 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/actiontech/dtle/internal/logger"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// binlogEvent80 returns the event of type tp ending at logPos with body, as
+// a MySQL 8.0 source logs it, with its CRC32 checksum if crc is set
+func binlogEvent80(tp replication.EventType, logPos uint32, body []byte, crc bool) []byte {
+	size := replication.EventHeaderSize + len(body)
+	if crc {
+		size += replication.BinlogChecksumLength
+	}
+	data := make([]byte, replication.EventHeaderSize, size)
+	data[4] = byte(tp)
+	binary.LittleEndian.PutUint32(data[5:], 1)
+	binary.LittleEndian.PutUint32(data[9:], uint32(size))
+	binary.LittleEndian.PutUint32(data[13:], logPos)
+	data = append(data, body...)
+	if crc {
+		checksum := make([]byte, replication.BinlogChecksumLength)
+		binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(data))
+		data = append(data, checksum...)
+	}
+	return data
+}
+
+// formatDescription80 returns the body of the FORMAT_DESCRIPTION_EVENT of
+// MySQL 8.0.21, with binlog_checksum CRC32 if crc is set, else NONE
+func formatDescription80(crc bool) []byte {
+	body := []byte{4, 0}
+	version := make([]byte, 50)
+	copy(version, "8.0.21")
+	body = append(body, version...)
+	body = append(body, 0, 0, 0, 0, replication.EventHeaderSize)
+	// The lengths of the post headers of the 41 types of events
+	body = append(body, 56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 95, 0, 4, 26, 8, 0, 0, 0, 8, 8, 8,
+		2, 0, 0, 0, 10, 10, 10, 42, 42, 0, 18, 52, 0, 10, 40, 0)
+	alg := replication.BINLOG_CHECKSUM_ALG_OFF
+	if crc {
+		alg = replication.BINLOG_CHECKSUM_ALG_CRC32
+	}
+	// The algorithm, and the checksum of the event itself
+	return append(body, alg, 0, 0, 0, 0)
+}
+
+func TestEventParser_MySQL80(t *testing.T) {
+	// The stream of an update of JSON_SET(j, '$.a', 2, '$.c', 'x') and
+	// JSON_REMOVE of '$.b[0]' in a table of MySQL 8.0 with
+	// binlog_row_metadata FULL and binlog_row_value_options PARTIAL_JSON
+	tableMap := mustHex(t, "6e0000000000 0100"+
+		// db1.t1 (id int primary key, j json)
+		"03 646231 00 02 7431 00 02 03f5 01 04 02"+
+		// Optional metadata: signedness, column names, primary key, and
+		// the visibility of the columns of 8.0.23
+		"01 01 00 04 05 026964 016a 08 01 00 0c 01 00")
+	update := mustHex(t, "6e0000000000 0100 0200 02 03 03"+
+		// Before image: 1, {"a": 1, "b": [1, 2]}
+		"00 01000000 1f000000"+
+		"00 0200 1e00 1200 0100 1300 0100 05 0100 02 1400 61 62 0200 0a00 05 0100 05 0200"+
+		// After image: partial JSON updates, of j
+		"01 01 00 01000000 1a000000"+
+		"00 03 242e61 03 05 0200"+
+		"01 03 242e63 03 0c 01 78"+
+		"02 06 242e625b305d")
+
+	for _, crc := range []bool{false, true} {
+		stream := [][]byte{
+			binlogEvent80(replication.FORMAT_DESCRIPTION_EVENT, 124, formatDescription80(crc), false),
+			binlogEvent80(replication.TABLE_MAP_EVENT, 200, tableMap, crc),
+			binlogEvent80(partialUpdateRowsEvent, 300, update, crc),
+		}
+
+		p := newEventParser(replication.BinlogSyncerConfig{})
+		var events []*replication.BinlogEvent
+		for _, data := range stream {
+			header := &replication.EventHeader{}
+			if err := header.Decode(data); err != nil {
+				t.Fatalf("EventHeader.Decode() error = %v", err)
+			}
+			ev, err := p.parse(&replication.BinlogEvent{RawData: data, Header: header})
+			if err != nil {
+				t.Fatalf("crc %v: eventParser.parse() of %s error = %v", crc, eventTypeString(header.EventType), err)
+			}
+			if !reflect.DeepEqual(ev.RawData, data) || ev.Header != header {
+				t.Errorf("crc %v: eventParser.parse() changed the raw %s", crc, eventTypeString(header.EventType))
+			}
+			events = append(events, ev)
+
+			// The table maps are forgotten at the end of the statement
+			if header.EventType == replication.TABLE_MAP_EVENT {
+				meta := p.tableMetadata(0x6e)
+				if meta == nil || !reflect.DeepEqual(meta.ColumnName, [][]byte{[]byte("id"), []byte("j")}) ||
+					!reflect.DeepEqual(meta.PrimaryKey, []uint64{0}) || !reflect.DeepEqual(meta.SignednessBitmap, []byte{0}) {
+					t.Errorf("crc %v: optional metadata of the table map = %+v", crc, meta)
+				}
+			}
+		}
+
+		// The JSON columns keep their type, though decoded as blobs
+		table := events[1].Event.(*replication.TableMapEvent)
+		if want := []byte{gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_JSON}; !reflect.DeepEqual(table.ColumnType, want) {
+			t.Errorf("crc %v: column types of the table map = %v, want %v", crc, table.ColumnType, want)
+		}
+		if rows := events[2].Event.(*replication.RowsEvent); rows.Table != table {
+			t.Errorf("crc %v: table of the rows = %+v, want the table map", crc, rows.Table)
+		}
+
+		if dml := ToEventDML(events[2].Header.EventType); dml != UpdateDML {
+			t.Errorf("ToEventDML() = %v, want an update", dml)
+		}
+		rows := events[2].Event.(*replication.RowsEvent)
+		jsonUpdates, err := decodeRowsColumns(rows)
+		if err != nil {
+			t.Fatalf("crc %v: decodeRowsColumns() error = %v", crc, err)
+		}
+		if len(rows.Rows) != 2 {
+			t.Fatalf("crc %v: rows = %v, want the before and the after image", crc, rows.Rows)
+		}
+		want := [][]interface{}{
+			{int32(1), []byte(`{"a": 1, "b": [1, 2]}`)},
+			{int32(1), []byte(`{"a": 2, "b": [2], "c": "x"}`)},
+		}
+		for i := range want {
+			if !reflect.DeepEqual(rows.Rows[i], want[i]) {
+				t.Errorf("crc %v: row %d = %q, want %q", crc, i, rows.Rows[i], want[i])
+			}
+		}
+		wantUpdates := map[int][]JSONUpdate{1: {
+			{Column: 1, Op: JSONReplace, Path: "$.a", Value: "2"},
+			{Column: 1, Op: JSONInsert, Path: "$.c", Value: `"x"`},
+			{Column: 1, Op: JSONRemove, Path: "$.b[0]", Cell: true},
+		}}
+		if !reflect.DeepEqual(jsonUpdates, wantUpdates) {
+			t.Errorf("crc %v: decodeRowsColumns() = %v, want %v", crc, jsonUpdates, wantUpdates)
+		}
+	}
+}
+
+func Test_columnValueLength(t *testing.T) {
+	tests := []struct {
+		name string
+		tp   byte
+		meta uint16
+		data string
+		want int
+	}{
+		{"int", gomysql.MYSQL_TYPE_LONG, 0, "", 4},
+		{"decimal(10,2)", gomysql.MYSQL_TYPE_NEWDECIMAL, 10<<8 | 2, "", 5},
+		{"datetime(3)", gomysql.MYSQL_TYPE_DATETIME2, 3, "", 7},
+		{"bit(10)", gomysql.MYSQL_TYPE_BIT, 1<<8 | 2, "", 2},
+		{"varchar(10)", gomysql.MYSQL_TYPE_VARCHAR, 10, "03", 4},
+		{"varchar(300)", gomysql.MYSQL_TYPE_VARCHAR, 300, "0301", 261},
+		{"char(10)", gomysql.MYSQL_TYPE_STRING, uint16(gomysql.MYSQL_TYPE_STRING)<<8 | 40, "02", 3},
+		{"enum", gomysql.MYSQL_TYPE_STRING, uint16(gomysql.MYSQL_TYPE_ENUM)<<8 | 2, "", 2},
+		{"json", gomysql.MYSQL_TYPE_JSON, 4, "10000000", 20},
+		{"blob", gomysql.MYSQL_TYPE_BLOB, 2, "0300", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := columnValueLength(mustHex(t, tt.data), tt.tp, tt.meta)
+			if err != nil || got != tt.want {
+				t.Errorf("columnValueLength() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+	if _, err := columnValueLength(nil, gomysql.MYSQL_TYPE_BLOB, 2); err == nil {
+		t.Errorf("columnValueLength() of a truncated blob error = nil")
+	}
+}
+
+func TestBinlogReader_checkEventType(t *testing.T) {
+	b := &BinlogReader{logger: log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel))}
+	b.currentCoordinates.LogFile = "binlog.000001"
+	tests := []struct {
+		name     string
+		tp       replication.EventType
+		flags    uint16
+		wantSkip bool
+		wantErr  string
+	}{
+		{"rows", replication.WRITE_ROWS_EVENTv2, 0, false, ""},
+		{"partial update", partialUpdateRowsEvent, 0, false, ""},
+		{"group replication", transactionContextEvent, 0, true, ""},
+		{"heartbeat", heartbeatLogEventV2, 0, true, ""},
+		{"compressed", transactionPayloadEvent, 0, false, "binlog_transaction_compression"},
+		{"xa", xaPrepareLogEvent, 0, false, "XA"},
+		{"unknown ignorable", 42, replication.LOG_EVENT_IGNORABLE_F, true, ""},
+		{"unknown", 42, 0, false, "binlog.000001:4"},
+		{"mariadb", replication.MARIADB_GTID_EVENT, 0, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The event of 3 bytes at 4
+			ev := &replication.BinlogEvent{Header: &replication.EventHeader{
+				EventType: tt.tp, Flags: tt.flags, LogPos: 26, EventSize: 22}}
+			skip, err := b.checkEventType(ev)
+			if skip != tt.wantSkip || (err == nil) != (tt.wantErr == "") ||
+				(err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkEventType() = %v, %v, want %v, %q", skip, err, tt.wantSkip, tt.wantErr)
+			}
+		})
+	}
+}
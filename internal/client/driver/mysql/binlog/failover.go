@@ -0,0 +1,163 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// SourceCandidates returns the connections to the servers the extractor of
+// cfg may stream the binlog from: ConnectionConfig, then one for each of
+// FailoverHosts, with the user, password and TLS of ConnectionConfig
+func SourceCandidates(cfg *config.MySQLDriverConfig) ([]*umconf.ConnectionConfig, error) {
+	if cfg.ConnectionConfig == nil {
+		return nil, nil
+	}
+	first := *cfg.ConnectionConfig
+	candidates := []*umconf.ConnectionConfig{&first}
+	for _, hostPort := range cfg.FailoverHosts {
+		key, err := umconf.ParseRawInstanceKeyLoose(hostPort)
+		if err != nil {
+			return nil, fmt.Errorf("FailoverHosts: %v", err)
+		}
+		candidate := *cfg.ConnectionConfig
+		candidate.Host, candidate.Port = key.Host, key.Port
+		candidates = append(candidates, &candidate)
+	}
+	return candidates, nil
+}
+
+// SetFailoverHandler makes the reader call handler with the server it
+// streams from after failing over to it
+func (b *BinlogReader) SetFailoverHandler(handler func(source *umconf.ConnectionConfig)) {
+	b.onFailover = handler
+}
+
+// Failovers returns how many times the reader failed over to another
+// server
+func (b *BinlogReader) Failovers() int64 {
+	return atomic.LoadInt64(&b.failovers)
+}
+
+// resumeStream connects the binlog streamer again at gtidSet, to the
+// server it streamed from or, if that can't be reached, to the first of
+// the other candidates which can and has the transactions of gtidSet. It
+// returns the error of the server it streamed from if none would do.
+func (b *BinlogReader) resumeStream(gtidSet string) error {
+	if len(b.sources) == 0 {
+		return b.restartSync(gtidSet)
+	}
+	var firstErr error
+	for i := 0; i < len(b.sources); i++ {
+		idx := (b.source + i) % len(b.sources)
+		err := b.resumeStreamFrom(idx, gtidSet)
+		if err == nil {
+			return nil
+		}
+		if b.shutdown {
+			return err
+		}
+		if i == 0 {
+			firstErr = err
+			if !isConnectionError(err) {
+				// The server is up but can't be streamed from
+				return err
+			}
+		} else {
+			b.logger.Warnf("mysql.reader: Can't fail over to %s:%d: %v",
+				b.sources[idx].Host, b.sources[idx].Port, err)
+		}
+	}
+	return firstErr
+}
+
+// resumeStreamFrom connects the binlog streamer again at gtidSet to the
+// candidate idx, once it checked the server has the transactions
+func (b *BinlogReader) resumeStreamFrom(idx int, gtidSet string) error {
+	source := b.sources[idx]
+	if err := source.RegisterTLSConfig(); err != nil {
+		return err
+	}
+	db, err := sql.CreateDB(source.GetDBUri())
+	if err != nil {
+		return err
+	}
+	serverUUID, executed, purged, err := selectSourceGtids(db)
+	if err != nil {
+		sql.CloseDB(db)
+		return err
+	}
+	if err := verifySourceGtids(executed, purged, gtidSet); err != nil {
+		sql.CloseDB(db)
+		return fmt.Errorf("%s:%d: %v", source.Host, source.Port, err)
+	}
+
+	tlsConfig, err := source.TLSConfig()
+	if err != nil {
+		sql.CloseDB(db)
+		return err
+	}
+	b.binlogSyncerConfig.Host = source.Host
+	b.binlogSyncerConfig.Port = uint16(source.Port)
+	b.binlogSyncerConfig.TLSConfig = tlsConfig
+	if err := b.restartSync(gtidSet); err != nil {
+		sql.CloseDB(db)
+		return err
+	}
+
+	previous := b.sources[b.source]
+	if idx == b.source && (b.sourceUUID == "" || b.sourceUUID == serverUUID) {
+		b.sourceUUID = serverUUID
+		sql.CloseDB(db)
+		return nil
+	}
+	b.logger.Warnf("mysql.reader: Failed over from %s:%d (server_uuid %s) to %s:%d (server_uuid %s), resuming at %v",
+		previous.Host, previous.Port, b.sourceUUID, source.Host, source.Port, serverUUID, gtidSet)
+	atomic.AddInt64(&b.failovers, 1)
+	b.source, b.sourceUUID = idx, serverUUID
+	old := b.db
+	b.db = db
+	sql.CloseDB(old)
+	if b.onFailover != nil {
+		b.onFailover(source)
+	}
+	return nil
+}
+
+// selectSourceGtids returns the server_uuid, gtid_executed and gtid_purged
+// of the server of db
+func selectSourceGtids(db sql.QueryAble) (serverUUID, executed, purged string, err error) {
+	err = db.QueryRow(`select @@global.server_uuid, @@global.gtid_executed, @@global.gtid_purged`).Scan(
+		&serverUUID, &executed, &purged)
+	return serverUUID, executed, purged, err
+}
+
+// verifySourceGtids checks that a server with gtid_executed executed and
+// gtid_purged purged can resume a stream which read committed
+func verifySourceGtids(executed, purged, committed string) error {
+	lacking, err := base.GtidSetMissing(committed, executed)
+	if err != nil {
+		return err
+	}
+	if lacking != "" {
+		return fmt.Errorf("the server lacks transactions %s read from the previous source, streaming from it would diverge", lacking)
+	}
+	missing, err := base.GtidSetMissing(purged, committed)
+	if err != nil {
+		return err
+	}
+	if missing != "" {
+		return fmt.Errorf("binlogs of transactions %s needed by the job were purged, see gtid_purged", missing)
+	}
+	return nil
+}
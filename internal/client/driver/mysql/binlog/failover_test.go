@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func TestSourceCandidates(t *testing.T) {
+	cfg := &config.MySQLDriverConfig{
+		ConnectionConfig: &umconf.ConnectionConfig{Host: "10.0.0.1", Port: 3307, User: "dtle", Password: "p"},
+		FailoverHosts:    []string{"10.0.0.2:3308", "10.0.0.3"},
+	}
+	candidates, err := SourceCandidates(cfg)
+	if err != nil {
+		t.Fatalf("SourceCandidates() error = %v", err)
+	}
+	want := []string{"10.0.0.1:3307", "10.0.0.2:3308", "10.0.0.3:3306"}
+	if len(candidates) != len(want) {
+		t.Fatalf("SourceCandidates() = %d candidates, want %d", len(candidates), len(want))
+	}
+	for i, c := range candidates {
+		if got := (umconf.InstanceKey{Host: c.Host, Port: c.Port}).String(); got != want[i] || c.User != "dtle" || c.Password != "p" {
+			t.Errorf("SourceCandidates()[%d] = %s as %s, want %s as dtle", i, got, c.User, want[i])
+		}
+	}
+	if candidates[0] == cfg.ConnectionConfig {
+		t.Errorf("SourceCandidates()[0] is ConnectionConfig, want a copy")
+	}
+
+	cfg.FailoverHosts = []string{"10.0.0.2:port"}
+	if _, err := SourceCandidates(cfg); err == nil {
+		t.Errorf("SourceCandidates() of a bad port error = nil")
+	}
+}
+
+func TestVerifySourceGtids(t *testing.T) {
+	const sid = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	tests := []struct {
+		name                        string
+		executed, purged, committed string
+		wantErr                     string
+	}{
+		{"caught up", sid + ":1-100", sid + ":1-50", sid + ":1-80", ""},
+		{"behind", sid + ":1-70", "", sid + ":1-80", "would diverge"},
+		{"purged", sid + ":1-100", sid + ":1-90", sid + ":1-80", "purged"},
+	}
+	for _, tt := range tests {
+		err := verifySourceGtids(tt.executed, tt.purged, tt.committed)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: verifySourceGtids() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+)
+
+// Types of the values of the binary JSON format of MySQL, see
+// sql/json_binary.h
+const (
+	jsonbSmallObject byte = 0x00
+	jsonbLargeObject byte = 0x01
+	jsonbSmallArray  byte = 0x02
+	jsonbLargeArray  byte = 0x03
+	jsonbLiteral     byte = 0x04
+	jsonbInt16       byte = 0x05
+	jsonbUint16      byte = 0x06
+	jsonbInt32       byte = 0x07
+	jsonbUint32      byte = 0x08
+	jsonbInt64       byte = 0x09
+	jsonbUint64      byte = 0x0a
+	jsonbDouble      byte = 0x0b
+	jsonbString      byte = 0x0c
+	jsonbOpaque      byte = 0x0f
+
+	jsonbNullLiteral  byte = 0x00
+	jsonbTrueLiteral  byte = 0x01
+	jsonbFalseLiteral byte = 0x02
+)
+
+// decodeJSONBinary returns the JSON text of a document of a JSON column in
+// the binary format MySQL writes it to the binlog, as MySQL prints it: the
+// members in the order MySQL keeps them, the numbers with their type and
+// the decimals exactly
+func decodeJSONBinary(data []byte) ([]byte, error) {
+	// An empty value is the JSON null
+	if len(data) == 0 {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	if err := writeJSONValue(&buf, data[0], data[1:]); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSONValue writes the value of type tp encoded in data
+func writeJSONValue(buf *bytes.Buffer, tp byte, data []byte) error {
+	switch tp {
+	case jsonbSmallObject:
+		return writeJSONContainer(buf, data, true, true)
+	case jsonbLargeObject:
+		return writeJSONContainer(buf, data, false, true)
+	case jsonbSmallArray:
+		return writeJSONContainer(buf, data, true, false)
+	case jsonbLargeArray:
+		return writeJSONContainer(buf, data, false, false)
+	case jsonbLiteral:
+		if len(data) < 1 {
+			return errJSONShort(1, data)
+		}
+		switch data[0] {
+		case jsonbNullLiteral:
+			buf.WriteString("null")
+		case jsonbTrueLiteral:
+			buf.WriteString("true")
+		case jsonbFalseLiteral:
+			buf.WriteString("false")
+		default:
+			return fmt.Errorf("invalid JSON literal %d", data[0])
+		}
+	case jsonbInt16, jsonbUint16:
+		if len(data) < 2 {
+			return errJSONShort(2, data)
+		}
+		v := binary.LittleEndian.Uint16(data)
+		if tp == jsonbInt16 {
+			buf.WriteString(strconv.FormatInt(int64(int16(v)), 10))
+		} else {
+			buf.WriteString(strconv.FormatUint(uint64(v), 10))
+		}
+	case jsonbInt32, jsonbUint32:
+		if len(data) < 4 {
+			return errJSONShort(4, data)
+		}
+		v := binary.LittleEndian.Uint32(data)
+		if tp == jsonbInt32 {
+			buf.WriteString(strconv.FormatInt(int64(int32(v)), 10))
+		} else {
+			buf.WriteString(strconv.FormatUint(uint64(v), 10))
+		}
+	case jsonbInt64, jsonbUint64:
+		if len(data) < 8 {
+			return errJSONShort(8, data)
+		}
+		v := binary.LittleEndian.Uint64(data)
+		if tp == jsonbInt64 {
+			buf.WriteString(strconv.FormatInt(int64(v), 10))
+		} else {
+			buf.WriteString(strconv.FormatUint(v, 10))
+		}
+	case jsonbDouble:
+		if len(data) < 8 {
+			return errJSONShort(8, data)
+		}
+		buf.WriteString(formatJSONDouble(math.Float64frombits(binary.LittleEndian.Uint64(data))))
+	case jsonbString:
+		s, err := readJSONVariable(data)
+		if err != nil {
+			return err
+		}
+		writeJSONString(buf, string(s))
+	case jsonbOpaque:
+		if len(data) < 1 {
+			return errJSONShort(1, data)
+		}
+		s, err := readJSONVariable(data[1:])
+		if err != nil {
+			return err
+		}
+		return writeJSONOpaque(buf, data[0], s)
+	default:
+		return fmt.Errorf("invalid JSON value type %d", tp)
+	}
+	return nil
+}
+
+// writeJSONContainer writes the object, or the array, encoded in data,
+// whose counts and offsets take 2 bytes if small, 4 otherwise
+func writeJSONContainer(buf *bytes.Buffer, data []byte, small, object bool) error {
+	offsetSize := 4
+	if small {
+		offsetSize = 2
+	}
+	readOffset := func(b []byte) int {
+		if small {
+			return int(binary.LittleEndian.Uint16(b))
+		}
+		return int(binary.LittleEndian.Uint32(b))
+	}
+	if len(data) < 2*offsetSize {
+		return errJSONShort(2*offsetSize, data)
+	}
+	count, size := readOffset(data), readOffset(data[offsetSize:])
+	if len(data) < size {
+		return errJSONShort(size, data)
+	}
+	data = data[:size]
+
+	keyEntrySize, valueEntrySize := offsetSize+2, offsetSize+1
+	keyEntries := 2 * offsetSize
+	valueEntries := keyEntries
+	if object {
+		valueEntries += count * keyEntrySize
+	}
+	if valueEntries+count*valueEntrySize > size {
+		return fmt.Errorf("JSON header of %d entries larger than the %d bytes of the value", count, size)
+	}
+
+	begin, end := byte('['), byte(']')
+	if object {
+		begin, end = '{', '}'
+	}
+	buf.WriteByte(begin)
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if object {
+			entry := data[keyEntries+i*keyEntrySize:]
+			offset, length := readOffset(entry), int(binary.LittleEndian.Uint16(entry[offsetSize:]))
+			if offset+length > size {
+				return fmt.Errorf("JSON key at %d past the %d bytes of the object", offset, size)
+			}
+			writeJSONString(buf, string(data[offset:offset+length]))
+			buf.WriteString(": ")
+		}
+
+		entry := data[valueEntries+i*valueEntrySize:]
+		tp := entry[0]
+		if jsonInlined(tp, small) {
+			if err := writeJSONValue(buf, tp, entry[1:valueEntrySize]); err != nil {
+				return err
+			}
+			continue
+		}
+		offset := readOffset(entry[1:])
+		if offset >= size {
+			return fmt.Errorf("JSON value at %d past the %d bytes of the container", offset, size)
+		}
+		if err := writeJSONValue(buf, tp, data[offset:]); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(end)
+	return nil
+}
+
+// jsonInlined tells whether a value of type tp is stored in its entry in a
+// container rather than after the entries
+func jsonInlined(tp byte, small bool) bool {
+	switch tp {
+	case jsonbLiteral, jsonbInt16, jsonbUint16:
+		return true
+	case jsonbInt32, jsonbUint32:
+		return !small
+	}
+	return false
+}
+
+// readJSONVariable returns the bytes of data after their length, stored
+// in 1 to 5 bytes of 7 bits
+func readJSONVariable(data []byte) ([]byte, error) {
+	length := 0
+	for i := 0; i < 5 && i < len(data); i++ {
+		length |= int(data[i]&0x7f) << uint(7*i)
+		if data[i]&0x80 == 0 {
+			if len(data) < i+1+length {
+				return nil, errJSONShort(i+1+length, data)
+			}
+			return data[i+1 : i+1+length], nil
+		}
+	}
+	return nil, fmt.Errorf("invalid JSON variable length")
+}
+
+// writeJSONOpaque writes a value of the MySQL type tp, which JSON has no
+// type for, as MySQL prints it
+func writeJSONOpaque(buf *bytes.Buffer, tp byte, data []byte) error {
+	switch tp {
+	case gomysql.MYSQL_TYPE_NEWDECIMAL:
+		if len(data) < 2 {
+			return errJSONShort(2, data)
+		}
+		s, err := decodeJSONDecimal(int(data[0]), int(data[1]), data[2:])
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case gomysql.MYSQL_TYPE_DATE, gomysql.MYSQL_TYPE_DATETIME, gomysql.MYSQL_TYPE_TIMESTAMP, gomysql.MYSQL_TYPE_TIME:
+		if len(data) < 8 {
+			return errJSONShort(8, data)
+		}
+		writeJSONString(buf, formatJSONTemporal(tp, int64(binary.LittleEndian.Uint64(data))))
+	default:
+		writeJSONString(buf, fmt.Sprintf("base64:type%d:%s", tp, base64.StdEncoding.EncodeToString(data)))
+	}
+	return nil
+}
+
+// formatJSONTemporal formats the packed temporal value v of the MySQL type
+// tp, see my_time.h
+func formatJSONTemporal(tp byte, v int64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	frac := v % (1 << 24)
+	packed := v >> 24
+	if tp == gomysql.MYSQL_TYPE_TIME {
+		hour := (packed >> 12) % (1 << 10)
+		minute := (packed >> 6) % (1 << 6)
+		second := packed % (1 << 6)
+		return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, hour, minute, second, frac)
+	}
+	ymd, hms := packed>>17, packed%(1<<17)
+	ym := ymd >> 5
+	date := fmt.Sprintf("%04d-%02d-%02d", ym/13, ym%13, ymd%(1<<5))
+	if tp == gomysql.MYSQL_TYPE_DATE {
+		return date
+	}
+	return fmt.Sprintf("%s %02d:%02d:%02d.%06d", date, hms>>12, (hms>>6)%(1<<6), hms%(1<<6), frac)
+}
+
+// formatJSONDouble formats f as MySQL does, keeping a double which is an
+// integer a double
+func formatJSONDouble(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// digitsBytes is the bytes of a group of less than 9 digits of a binary
+// decimal, by the number of digits
+var digitsBytes = []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// decodeJSONDecimal returns the text of the binary decimal of precision
+// and scale in data, see decimal2bin in strings/decimal.c
+func decodeJSONDecimal(precision, scale int, data []byte) (string, error) {
+	integral := precision - scale
+	intFull, intPartial := integral/9, integral%9
+	fracFull, fracPartial := scale/9, scale%9
+	size := intFull*4 + digitsBytes[intPartial] + fracFull*4 + digitsBytes[fracPartial]
+	if precision > 65 || scale > precision || len(data) < size {
+		return "", fmt.Errorf("invalid JSON decimal(%d,%d) of %d bytes", precision, scale, len(data))
+	}
+
+	b := make([]byte, size)
+	copy(b, data)
+	negative := b[0]&0x80 == 0
+	b[0] ^= 0x80
+	if negative {
+		for i := range b {
+			b[i] ^= 0xff
+		}
+	}
+	group := func(n int) uint32 {
+		var v uint32
+		for _, c := range b[:n] {
+			v = v<<8 | uint32(c)
+		}
+		b = b[n:]
+		return v
+	}
+
+	var s strings.Builder
+	if negative {
+		s.WriteByte('-')
+	}
+	var digits strings.Builder
+	if intPartial > 0 {
+		digits.WriteString(strconv.FormatUint(uint64(group(digitsBytes[intPartial])), 10))
+	}
+	for i := 0; i < intFull; i++ {
+		fmt.Fprintf(&digits, "%09d", group(4))
+	}
+	if intDigits := strings.TrimLeft(digits.String(), "0"); intDigits != "" {
+		s.WriteString(intDigits)
+	} else {
+		s.WriteByte('0')
+	}
+	if scale > 0 {
+		s.WriteByte('.')
+		for i := 0; i < fracFull; i++ {
+			fmt.Fprintf(&s, "%09d", group(4))
+		}
+		if fracPartial > 0 {
+			fmt.Fprintf(&s, "%0*d", fracPartial, group(digitsBytes[fracPartial]))
+		}
+	}
+	return s.String(), nil
+}
+
+// writeJSONString writes s as a JSON string, escaped as MySQL does
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+func errJSONShort(expected int, data []byte) error {
+	return fmt.Errorf("JSON value of %d bytes, expected %d", len(data), expected)
+}
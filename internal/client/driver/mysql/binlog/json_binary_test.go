@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeJSONBinary(t *testing.T) {
+	// 2015-01-15 23:24:25 packed as MySQL stores temporal values
+	ymd := int64((2015*13+1)<<5 | 15)
+	hms := int64(23<<12 | 24<<6 | 25)
+	datetime := make([]byte, 8)
+	binary.LittleEndian.PutUint64(datetime, uint64((ymd<<17|hms)<<24))
+
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"null", "", "null"},
+		{"scalar", "0c 03 61 62 63", `"abc"`},
+		{"object", "00 01 00 0c 00 0b 00 01 00 05 01 00 61", `{"a": 1}`},
+		{"nested", "00 01 00 35 00 0b 00 01 00 02 0c 00 6b" +
+			"05 00 29 00 05 01 00 0c 13 00 04 00 00 0b 15 00 00 1d 00" +
+			"01 78 00 00 00 00 00 00 04 40 01 00 0c 00 0b 00 01 00 04 01 00 64",
+			`{"k": [1, "x", null, 2.5, {"d": true}]}`},
+		{"large object", "01 01 00 00 00 14 00 00 00 13 00 00 00 01 00 07 70 11 01 00 61", `{"a": 70000}`},
+		{"decimal", "0f f6 04 04 02 8c 32", "12.50"},
+		{"negative decimal", "0f f6 04 04 02 73 cd", "-12.50"},
+		{"datetime", "0f 0c 08" + hex.EncodeToString(datetime), `"2015-01-15 23:24:25.000000"`},
+		{"blob", "0f fc 02 01 02", `"base64:type252:AQI="`},
+		{"integral double", "0b 00 00 00 00 00 00 f0 3f", "1.0"},
+		{"escaped", "0c 05 22 5c 0a 01 2f", `"\"\\\n\u0001/"`},
+	}
+	for _, tt := range tests {
+		got, err := decodeJSONBinary(mustHex(t, tt.payload))
+		if err != nil || string(got) != tt.want {
+			t.Errorf("%s: decodeJSONBinary() = %s, %v, want %s", tt.name, got, err, tt.want)
+		}
+	}
+
+	if _, err := decodeJSONBinary(mustHex(t, "00 01 00 35 00 0b 00")); err == nil {
+		t.Errorf("decodeJSONBinary() of a truncated object error = nil")
+	}
+}
+
+func TestDecodeJSONBinary_Depth(t *testing.T) {
+	// "deep" in arrays in arrays, each a small array of an entry holding
+	// the offset of the value after it
+	value := mustHex(t, "04 64 65 65 70")
+	tp := byte(jsonbString)
+	want := `"deep"`
+	for depth := 1; depth <= 50; depth++ {
+		array := make([]byte, 7, 7+len(value))
+		binary.LittleEndian.PutUint16(array[0:], 1)
+		binary.LittleEndian.PutUint16(array[2:], uint16(7+len(value)))
+		array[4] = tp
+		binary.LittleEndian.PutUint16(array[5:], 7)
+		value, tp = append(array, value...), jsonbSmallArray
+		want = "[" + want + "]"
+
+		got, err := decodeJSONBinary(append([]byte{tp}, value...))
+		if err != nil || string(got) != want {
+			t.Fatalf("depth %d: decodeJSONBinary() = %s, %v, want %s", depth, got, err, want)
+		}
+	}
+}
+
+func TestDecodeRowsColumns(t *testing.T) {
+	point := mustHex(t, "00000000 01 01000000 000000000000f03f 0000000000000040")
+	evt := &replication.RowsEvent{
+		Table: &replication.TableMapEvent{ColumnType: []byte{
+			gomysql.MYSQL_TYPE_LONG, gomysql.MYSQL_TYPE_JSON, gomysql.MYSQL_TYPE_GEOMETRY}},
+		Rows: [][]interface{}{
+			{int32(1), mustHex(t, "00 01 00 0c 00 0b 00 01 00 05 01 00 61"), point},
+			{int32(2), nil, nil},
+		},
+	}
+	if _, err := decodeRowsColumns(evt); err != nil {
+		t.Fatalf("decodeRowsColumns() error = %v", err)
+	}
+	if got := string(evt.Rows[0][1].([]byte)); got != `{"a": 1}` {
+		t.Errorf("decoded JSON = %s", got)
+	}
+	if evt.Rows[1][1] != nil || string(evt.Rows[0][2].([]byte)) != string(point) {
+		t.Errorf("decodeRowsColumns() changed %v", evt.Rows)
+	}
+
+	evt.Rows = [][]interface{}{{int32(3), nil, point[:12]}}
+	if _, err := decodeRowsColumns(evt); err == nil || !strings.Contains(err.Error(), "geometry") {
+		t.Errorf("decodeRowsColumns() of a truncated point error = %v", err)
+	}
+}
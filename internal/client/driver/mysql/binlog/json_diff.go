@@ -0,0 +1,357 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+)
+
+// JSONOp is the operation of a change to a JSON document MySQL 8.0 logs for
+// a partial update, see enum_json_diff_operation
+type JSONOp byte
+
+const (
+	JSONReplace JSONOp = 0
+	JSONInsert  JSONOp = 1
+	JSONRemove  JSONOp = 2
+)
+
+// JSONUpdate is a change to the document of a JSON column of a row a
+// partial update logged
+type JSONUpdate struct {
+	// Column is the ordinal of the column in the row
+	Column int
+	Op     JSONOp
+	Path   string
+	// Value is the JSON text of the value replaced or inserted
+	Value string
+	// Cell tells the path ends with a cell of an array, Relative that it
+	// has cells counted from the last one
+	Cell     bool
+	Relative bool
+}
+
+// applyJSONDiff returns the JSON text of before, as decodeJSONBinary wrote
+// it, with the changes of a partial update in diff applied, and these
+// changes. diff is a series of an operation, a path and, but for a remove,
+// a value in the binary JSON format, see Json_diff_vector::read_binary.
+func applyJSONDiff(before []byte, diff []byte) ([]byte, []JSONUpdate, error) {
+	doc, err := parseJSONText(before)
+	if err != nil {
+		return nil, nil, fmt.Errorf("before image: %v", err)
+	}
+	var updates []JSONUpdate
+	for len(diff) > 0 {
+		update := JSONUpdate{Op: JSONOp(diff[0])}
+		var path, value []byte
+		if path, diff, err = readJSONDiffField(diff[1:]); err != nil {
+			return nil, nil, err
+		}
+		update.Path = string(path)
+		legs, err := parseJSONPath(update.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, leg := range legs {
+			update.Relative = update.Relative || leg.last
+		}
+		update.Cell = len(legs) > 0 && legs[len(legs)-1].array
+		var node *jsonNode
+		switch update.Op {
+		case JSONReplace, JSONInsert:
+			if value, diff, err = readJSONDiffField(diff); err != nil {
+				return nil, nil, err
+			}
+			text, err := decodeJSONBinary(value)
+			if err != nil {
+				return nil, nil, err
+			}
+			if node, err = parseJSONText(text); err != nil {
+				return nil, nil, err
+			}
+			update.Value = string(text)
+		case JSONRemove:
+		default:
+			return nil, nil, fmt.Errorf("invalid JSON diff operation %d", update.Op)
+		}
+		if doc, err = doc.apply(update.Op, legs, node); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		updates = append(updates, update)
+	}
+	var buf bytes.Buffer
+	doc.write(&buf)
+	return buf.Bytes(), updates, nil
+}
+
+// readJSONDiffField returns the bytes of data after their packed length,
+// and the bytes after them
+func readJSONDiffField(data []byte) ([]byte, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("truncated JSON diff")
+	}
+	length, _, n := gomysql.LengthEncodedInt(data)
+	if uint64(len(data)-n) < length {
+		return nil, nil, errJSONShort(n+int(length), data)
+	}
+	return data[n : n+int(length)], data[n+int(length):], nil
+}
+
+// jsonNode is a JSON value keeping the text of its scalars as MySQL prints
+// them and the order of the members of its objects
+type jsonNode struct {
+	object, array bool
+	keys          []string
+	values        []*jsonNode
+	// text is the text of a scalar
+	text string
+}
+
+// parseJSONText returns the document of the JSON text
+func parseJSONText(text []byte) (*jsonNode, error) {
+	d := json.NewDecoder(bytes.NewReader(text))
+	d.UseNumber()
+	n, err := readJSONNode(d)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, fmt.Errorf("JSON text past its value")
+	}
+	return n, nil
+}
+
+func readJSONNode(d *json.Decoder) (*jsonNode, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := t.(type) {
+	case json.Delim:
+		n := &jsonNode{object: t == '{', array: t == '['}
+		if !n.object && !n.array {
+			return nil, fmt.Errorf("unexpected %v in JSON text", t)
+		}
+		for d.More() {
+			if n.object {
+				key, err := d.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			value, err := readJSONNode(d)
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, value)
+		}
+		// The end of the container
+		if _, err := d.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case string:
+		var buf bytes.Buffer
+		writeJSONString(&buf, t)
+		return &jsonNode{text: buf.String()}, nil
+	case json.Number:
+		return &jsonNode{text: string(t)}, nil
+	case bool:
+		return &jsonNode{text: strconv.FormatBool(t)}, nil
+	default:
+		return &jsonNode{text: "null"}, nil
+	}
+}
+
+// write writes the JSON text of n as decodeJSONBinary does
+func (n *jsonNode) write(buf *bytes.Buffer) {
+	if !n.object && !n.array {
+		buf.WriteString(n.text)
+		return
+	}
+	begin, end := byte('['), byte(']')
+	if n.object {
+		begin, end = '{', '}'
+	}
+	buf.WriteByte(begin)
+	for i, value := range n.values {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if n.object {
+			writeJSONString(buf, n.keys[i])
+			buf.WriteString(": ")
+		}
+		value.write(buf)
+	}
+	buf.WriteByte(end)
+}
+
+// jsonPathLeg is a member, or a cell, of a JSON path
+type jsonPathLeg struct {
+	key   string
+	array bool
+	// index counts from the last cell if last
+	index int
+	last  bool
+}
+
+// parseJSONPath returns the legs of path, as MySQL prints it: $ and then
+// members, quoted if not identifiers, and cells, [last] for the last one
+func parseJSONPath(path string) ([]jsonPathLeg, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("invalid JSON path %q", path)
+	}
+	var legs []jsonPathLeg
+	for s := path[1:]; len(s) > 0; {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			if strings.HasPrefix(s, `"`) {
+				end := 1
+				for ; end < len(s) && s[end] != '"'; end++ {
+					if s[end] == '\\' {
+						end++
+					}
+				}
+				if end >= len(s) {
+					return nil, fmt.Errorf("invalid JSON path %q", path)
+				}
+				var key string
+				if err := json.Unmarshal([]byte(s[:end+1]), &key); err != nil {
+					return nil, fmt.Errorf("invalid JSON path %q: %v", path, err)
+				}
+				legs = append(legs, jsonPathLeg{key: key})
+				s = s[end+1:]
+				continue
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 || s[:end] == "*" {
+				return nil, fmt.Errorf("unsupported JSON path %q", path)
+			}
+			legs = append(legs, jsonPathLeg{key: s[:end]})
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q", path)
+			}
+			leg := jsonPathLeg{array: true}
+			cell := strings.Replace(s[1:end], " ", "", -1)
+			if strings.HasPrefix(cell, "last") {
+				leg.last = true
+				cell = strings.TrimPrefix(strings.TrimPrefix(cell, "last"), "-")
+				if cell == "" {
+					cell = "0"
+				}
+			}
+			index, err := strconv.Atoi(cell)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("unsupported JSON path %q", path)
+			}
+			leg.index = index
+			legs = append(legs, leg)
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("unsupported JSON path %q", path)
+		}
+	}
+	return legs, nil
+}
+
+// find returns the position of the member, or the cell, of leg in n, -1 if
+// n doesn't have it
+func (n *jsonNode) find(leg jsonPathLeg) int {
+	if leg.array {
+		if !n.array {
+			return -1
+		}
+		i := leg.index
+		if leg.last {
+			i = len(n.values) - 1 - leg.index
+		}
+		if i < 0 || i >= len(n.values) {
+			return -1
+		}
+		return i
+	}
+	if n.object {
+		for i, key := range n.keys {
+			if key == leg.key {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// apply applies the operation op at the path of legs to n, with value for
+// a replace or an insert, and returns the document it makes
+func (n *jsonNode) apply(op JSONOp, legs []jsonPathLeg, value *jsonNode) (*jsonNode, error) {
+	if len(legs) == 0 {
+		if op != JSONReplace {
+			return nil, fmt.Errorf("can't insert or remove the document")
+		}
+		return value, nil
+	}
+	parent := n
+	for _, leg := range legs[:len(legs)-1] {
+		i := parent.find(leg)
+		if i < 0 {
+			return nil, fmt.Errorf("no such path in the before image")
+		}
+		parent = parent.values[i]
+	}
+	leg := legs[len(legs)-1]
+	if leg.array != parent.array || (!leg.array && !parent.object) {
+		return nil, fmt.Errorf("path through a value of another type in the before image")
+	}
+	i := parent.find(leg)
+	switch op {
+	case JSONReplace:
+		if i < 0 {
+			return nil, fmt.Errorf("no such path in the before image")
+		}
+		parent.values[i] = value
+	case JSONInsert:
+		switch {
+		case i >= 0 && parent.object:
+			parent.values[i] = value
+		case parent.object:
+			parent.keys = append(parent.keys, leg.key)
+			parent.values = append(parent.values, value)
+		default:
+			// Past the last cell, the value is appended
+			if i < 0 {
+				i = len(parent.values)
+			}
+			parent.values = append(parent.values, nil)
+			copy(parent.values[i+1:], parent.values[i:])
+			parent.values[i] = value
+		}
+	case JSONRemove:
+		if i < 0 {
+			return nil, fmt.Errorf("no such path in the before image")
+		}
+		if parent.object {
+			parent.keys = append(parent.keys[:i], parent.keys[i+1:]...)
+		}
+		parent.values = append(parent.values[:i], parent.values[i+1:]...)
+	}
+	return n, nil
+}
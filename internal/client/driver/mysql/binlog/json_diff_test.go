@@ -0,0 +1,53 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"testing"
+)
+
+func TestApplyJSONDiff(t *testing.T) {
+	before := `{"a": 1, "a b": "\"x\"", "b": [1, 2.50, {"c": null}]}`
+	tests := []struct {
+		name    string
+		diff    string
+		want    string
+		wantErr bool
+	}{
+		{"replace member", "00 03 242e61 03 0c 01 79",
+			`{"a": "y", "a b": "\"x\"", "b": [1, 2.50, {"c": null}]}`, false},
+		{"insert member", "01 03 242e64 02 04 01",
+			`{"a": 1, "a b": "\"x\"", "b": [1, 2.50, {"c": null}], "d": true}`, false},
+		{"quoted member", "02 07 242e22612062 22", `{"a": 1, "b": [1, 2.50, {"c": null}]}`, false},
+		{"insert cell", "01 06 242e625b315d 03 05 0300",
+			`{"a": 1, "a b": "\"x\"", "b": [1, 3, 2.50, {"c": null}]}`, false},
+		{"append cell", "01 06 242e625b395d 03 05 0300",
+			`{"a": 1, "a b": "\"x\"", "b": [1, 2.50, {"c": null}, 3]}`, false},
+		{"last cell", "00 0b 242e625b6c6173745d2e63 03 05 0300",
+			`{"a": 1, "a b": "\"x\"", "b": [1, 2.50, {"c": 3}]}`, false},
+		{"several", "02 03 242e61 02 06 242e625b305d",
+			`{"a b": "\"x\"", "b": [2.50, {"c": null}]}`, false},
+		{"document", "00 01 24 02 04 00", "null", false},
+		{"no member", "00 03 242e7a 03 05 0300", "", true},
+		{"not an array", "00 06 242e615b305d 03 05 0300", "", true},
+		{"remove document", "02 01 24", "", true},
+		{"wildcard", "02 03 242e2a", "", true},
+		{"invalid operation", "07 03 242e61", "", true},
+		{"truncated", "00 03 242e61 09 05", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := applyJSONDiff([]byte(before), mustHex(t, tt.diff))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyJSONDiff() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("applyJSONDiff() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	juju "github.com/juju/errors"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// maxReconnectBackoff is the longest wait between two attempts to
+// reconnect the binlog streamer
+const maxReconnectBackoff = 30 * time.Second
+
+// errSyncerReconnected is the binlog syncer having reconnected to the
+// source on its own. It resumes from the transaction it was reading,
+// whose events read before the connection broke would be lost.
+var errSyncerReconnected = errors.New("binlog syncer reconnected from the transaction being read")
+
+// isConnectionError tells whether err is the connection to the source
+// breaking, rather than the source refusing to stream or the events
+// failing to parse
+func isConnectionError(err error) bool {
+	if err == errSyncerReconnected {
+		return true
+	}
+	cause := juju.Cause(err)
+	if _, ok := cause.(net.Error); ok {
+		return true
+	}
+	if myErr, ok := cause.(*gomysql.MyError); ok {
+		return myErr.Code == gomysql.ER_SERVER_SHUTDOWN || myErr.Code == gomysql.ER_CON_COUNT_ERROR
+	}
+	return cause == io.EOF || cause == io.ErrUnexpectedEOF || cause == gomysql.ErrBadConn
+}
+
+// isSyncerReconnected tells whether ev shows the binlog syncer reconnected
+// on its own. The server begins every dump with an artificial rotate event.
+func (b *BinlogReader) isSyncerReconnected(ev *replication.BinlogEvent) bool {
+	if ev.Header.EventType != replication.ROTATE_EVENT || ev.Header.Timestamp != 0 {
+		return false
+	}
+	if b.dumpStarted {
+		return true
+	}
+	b.dumpStarted = true
+	return false
+}
+
+// endsTx tells whether ev is the last event of the transaction being read
+func (b *BinlogReader) endsTx(ev *replication.BinlogEvent) bool {
+	switch ev.Header.EventType {
+	case replication.XID_EVENT:
+		return true
+	case replication.QUERY_EVENT:
+		query := strings.ToUpper(string(ev.Event.(*replication.QueryEvent).Query))
+		if query == "BEGIN" {
+			return false
+		}
+		return query == "COMMIT" || b.currentBinlogEntry == nil || !b.currentBinlogEntry.hasBeginQuery
+	default:
+		return false
+	}
+}
+
+// commitGtid records the transaction being read was fully read
+func (b *BinlogReader) commitGtid() {
+	if b.currentBinlogEntry == nil {
+		return
+	}
+	sid, gno := b.currentCoordinates.SID, b.currentCoordinates.GNO
+	b.committedGtids.AddSet(gomysql.NewUUIDSet(sid, gomysql.Interval{Start: gno, Stop: gno + 1}))
+}
+
+// reconnectBinlogStreamer connects the binlog streamer again after the
+// connection to the source broke with cause, or fails over to another of
+// the sources, see resumeStream. It resumes from the
+// transactions fully read, so that none is skipped and the one being read
+// is read again from its start, and waits longer after each failed
+// attempt. It returns cause when it can't reconnect.
+func (b *BinlogReader) reconnectBinlogStreamer(cause error) error {
+	maxRetries := b.mysqlContext.BinlogReconnectMaxRetries
+	if b.shutdown || maxRetries <= 0 || !isConnectionError(cause) {
+		return cause
+	}
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		atomic.AddInt64(&b.reconnects, 1)
+		gtidSet := b.committedGtids.String()
+		b.logger.Warnf("mysql.reader: binlog connection broke: %v. Reconnecting at %v in %v, attempt %d/%d",
+			cause, gtidSet, backoff, attempt, maxRetries)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-b.shutdownCh:
+			timer.Stop()
+			return cause
+		}
+
+		err := b.resumeStream(gtidSet)
+		if err == nil {
+			b.logger.Printf("mysql.reader: Reconnected binlog streamer at %v", gtidSet)
+			return nil
+		}
+		if b.shutdown {
+			return cause
+		}
+		if attempt >= maxRetries || !isConnectionError(err) {
+			return fmt.Errorf("binlog connection broke: %v. Failed to reconnect %d times: %v", cause, attempt, err)
+		}
+		cause = err
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// restartSync replaces the binlog syncer with one streaming the
+// transactions not in gtidSet
+func (b *BinlogReader) restartSync(gtidSet string) error {
+	b.shutdownLock.Lock()
+	defer b.shutdownLock.Unlock()
+	if b.shutdown {
+		return replication.ErrSyncClosed
+	}
+
+	set, err := gomysql.ParseMysqlGTIDSet(gtidSet)
+	if err != nil {
+		return err
+	}
+	b.binlogSyncer.Close()
+	b.binlogSyncer = replication.NewBinlogSyncer(b.binlogSyncerConfig)
+	streamer, err := b.binlogSyncer.StartSyncGTID(set)
+	if err != nil {
+		return err
+	}
+	b.binlogStreamer = streamer
+	b.currentBinlogEntry = nil
+	b.dumpStarted = false
+	return nil
+}
+
+// Reconnects returns how many times the binlog streamer tried to reconnect
+func (b *BinlogReader) Reconnects() int64 {
+	return atomic.LoadInt64(&b.reconnects)
+}
+
+func parseMysqlGTIDSet(gtidSet string) (*gomysql.MysqlGTIDSet, error) {
+	set, err := gomysql.ParseMysqlGTIDSet(gtidSet)
+	if err != nil {
+		return nil, err
+	}
+	return set.(*gomysql.MysqlGTIDSet), nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	juju "github.com/juju/errors"
+	"github.com/satori/go.uuid"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"eof", juju.Trace(io.EOF), true},
+		{"bad conn", juju.Trace(juju.Trace(gomysql.ErrBadConn)), true},
+		{"network", juju.Trace(&net.OpError{Op: "dial", Err: errors.New("connection refused")}), true},
+		{"shutdown", &gomysql.MyError{Code: gomysql.ER_SERVER_SHUTDOWN}, true},
+		{"syncer reconnected", errSyncerReconnected, true},
+		{"purged gtids", &gomysql.MyError{Code: gomysql.ER_MASTER_FATAL_ERROR_READING_BINLOG}, false},
+		{"closed", replication.ErrSyncClosed, false},
+		{"parse", errors.New("invalid event"), false},
+	}
+	for _, tt := range tests {
+		if got := isConnectionError(tt.err); got != tt.want {
+			t.Errorf("%s: isConnectionError() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBinlogReader_commitGtid(t *testing.T) {
+	sid := uuid.NewV4()
+	committed, err := parseMysqlGTIDSet(sid.String() + ":1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &BinlogReader{committedGtids: committed}
+
+	event := func(eventType replication.EventType, e replication.Event) *replication.BinlogEvent {
+		return &replication.BinlogEvent{Header: &replication.EventHeader{EventType: eventType}, Event: e}
+	}
+	query := func(q string) *replication.BinlogEvent {
+		return event(replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte(q)})
+	}
+	read := func(gno int64, events ...*replication.BinlogEvent) {
+		b.currentCoordinates.SID, b.currentCoordinates.GNO = sid, gno
+		b.currentBinlogEntry = &BinlogEntry{}
+		for _, ev := range events {
+			if b.endsTx(ev) {
+				b.commitGtid()
+			}
+			if ev.Header.EventType == replication.QUERY_EVENT && strings.ToUpper(string(ev.Event.(*replication.QueryEvent).Query)) == "BEGIN" {
+				b.currentBinlogEntry.hasBeginQuery = true
+			}
+		}
+	}
+
+	read(6, query("BEGIN"), event(replication.WRITE_ROWS_EVENTv2, &replication.RowsEvent{}), event(replication.XID_EVENT, &replication.XIDEvent{}))
+	read(7, query("create table t1 (id int)"))
+	read(8, query("BEGIN"), event(replication.WRITE_ROWS_EVENTv2, &replication.RowsEvent{}))
+
+	// The streamer reconnects before the transaction being read
+	if got, want := b.committedGtids.String(), sid.String()+":1-7"; got != want {
+		t.Errorf("committed GTIDs = %v, want %v", got, want)
+	}
+}
+
+func TestBinlogReader_reconnectBinlogStreamer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing listens on the port anymore
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	committed, err := parseMysqlGTIDSet("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncerConfig := replication.BinlogSyncerConfig{ServerID: 100, Flavor: "mysql", Host: "127.0.0.1", Port: uint16(port)}
+	b := &BinlogReader{
+		logger:             log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)),
+		mysqlContext:       &config.MySQLDriverConfig{BinlogReconnectMaxRetries: 1},
+		binlogSyncerConfig: syncerConfig,
+		binlogSyncer:       replication.NewBinlogSyncer(syncerConfig),
+		committedGtids:     committed,
+		shutdownCh:         make(chan struct{}),
+	}
+
+	notConnection := errors.New("invalid event")
+	if err := b.reconnectBinlogStreamer(notConnection); err != notConnection {
+		t.Errorf("reconnectBinlogStreamer() = %v, want the error kept", err)
+	}
+	if err := b.reconnectBinlogStreamer(io.EOF); err == nil || !strings.Contains(err.Error(), "Failed to reconnect 1 times") {
+		t.Errorf("reconnectBinlogStreamer() = %v, want giving up after 1 attempt", err)
+	}
+	if got := b.Reconnects(); got != 1 {
+		t.Errorf("Reconnects() = %v, want 1", got)
+	}
+
+	b.mysqlContext.BinlogReconnectMaxRetries = -1
+	if err := b.reconnectBinlogStreamer(io.EOF); err != io.EOF {
+		t.Errorf("reconnectBinlogStreamer() without retries = %v, want io.EOF", err)
+	}
+	b.binlogSyncer.Close()
+}
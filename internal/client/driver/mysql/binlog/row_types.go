@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// decodeRowsColumns replaces in the rows of evt the values of the columns
+// the parser leaves in their binlog format: a JSON document becomes its
+// text, and the changes a partial update of MySQL 8.0 logs for it the text
+// of the document they make. It returns these changes, by row. It fails on
+// a geometry which isn't the SRID and WKB MySQL stores, rather than writing
+// something else to the target.
+func decodeRowsColumns(evt *replication.RowsEvent) (map[int][]JSONUpdate, error) {
+	var jsonUpdates map[int][]JSONUpdate
+	for i, tp := range evt.Table.ColumnType {
+		switch tp {
+		case gomysql.MYSQL_TYPE_JSON, gomysql.MYSQL_TYPE_GEOMETRY:
+		default:
+			continue
+		}
+		for j, row := range evt.Rows {
+			if i >= len(row) {
+				continue
+			}
+			if diff, ok := row[i].(jsonDiff); ok {
+				// The after image of an update follows its before image,
+				// whose document is already decoded
+				var before []byte
+				if j > 0 {
+					before, _ = evt.Rows[j-1][i].([]byte)
+				}
+				if before == nil {
+					return nil, fmt.Errorf("column %d: partial JSON update of a document not in the before image, binlog_row_image must be FULL", i+1)
+				}
+				text, updates, err := applyJSONDiff(before, diff)
+				if err != nil {
+					return nil, fmt.Errorf("column %d: unappliable partial JSON update: %v", i+1, err)
+				}
+				row[i] = text
+				if jsonUpdates == nil {
+					jsonUpdates = make(map[int][]JSONUpdate)
+				}
+				for _, update := range updates {
+					update.Column = i
+					jsonUpdates[j] = append(jsonUpdates[j], update)
+				}
+				continue
+			}
+			data, ok := row[i].([]byte)
+			if !ok {
+				continue
+			}
+			if tp == gomysql.MYSQL_TYPE_GEOMETRY {
+				if err := checkGeometry(data); err != nil {
+					return nil, fmt.Errorf("column %d: unsupported geometry: %v", i+1, err)
+				}
+				continue
+			}
+			text, err := decodeJSONBinary(data)
+			if err != nil {
+				return nil, fmt.Errorf("column %d: undecodable JSON: %v", i+1, err)
+			}
+			row[i] = text
+		}
+	}
+	return jsonUpdates, nil
+}
+
+// Types of the geometries of WKB
+const (
+	wkbPoint              = 1
+	wkbGeometryCollection = 7
+)
+
+// checkGeometry checks that data is a geometry as MySQL stores it: a 4
+// bytes SRID and its WKB, which is written to the target as is
+func checkGeometry(data []byte) error {
+	// SRID, byte order and type
+	if len(data) < 9 {
+		return fmt.Errorf("%d bytes", len(data))
+	}
+	var order binary.ByteOrder
+	switch data[4] {
+	case 0:
+		order = binary.BigEndian
+	case 1:
+		order = binary.LittleEndian
+	default:
+		return fmt.Errorf("invalid WKB byte order %d", data[4])
+	}
+	tp := order.Uint32(data[5:])
+	if tp < wkbPoint || tp > wkbGeometryCollection {
+		return fmt.Errorf("WKB type %d", tp)
+	}
+	// A point is its two coordinates
+	if tp == wkbPoint && len(data) != 9+16 {
+		return fmt.Errorf("point of %d bytes", len(data))
+	}
+	return nil
+}
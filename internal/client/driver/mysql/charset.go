@@ -0,0 +1,251 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// latin1Controls are the bytes MySQL latin1 maps to the C1 controls, where
+// Windows-1252 has no character
+var latin1Controls = map[byte]bool{0x81: true, 0x8D: true, 0x8F: true, 0x90: true, 0x9D: true}
+
+// knownCharset returns whether the applier can transcode from and to the
+// MySQL charset
+func knownCharset(charset string) bool {
+	return umconf.IsUTF8Charset(charset) || umconf.CharsetEncoding(charset) != nil
+}
+
+// utf8Connection returns whether the applier writes text in UTF-8 through
+// connections of charset
+func utf8Connection(charset string) bool {
+	return umconf.IsUTF8Charset(charset) && !strings.EqualFold(charset, "ascii")
+}
+
+// decodeText decodes the text b of charset to UTF-8. Invalid bytes are
+// decoded to U+FFFD, and ok is false.
+func decodeText(charset string, b []byte) (text string, ok bool) {
+	if strings.EqualFold(charset, "latin1") {
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			if latin1Controls[c] {
+				runes[i] = rune(c)
+			} else {
+				runes[i] = charmap.Windows1252.DecodeByte(c)
+			}
+		}
+		return string(runes), true
+	}
+	decoded, _, err := transform.Bytes(umconf.CharsetEncoding(charset).NewDecoder(), b)
+	if err != nil {
+		return strings.ToValidUTF8(string(b), string(utf8.RuneError)), false
+	}
+	// The decoders replace the invalid bytes, and no charset decoded here
+	// holds U+FFFD itself
+	text = string(decoded)
+	return text, !strings.ContainsRune(text, utf8.RuneError)
+}
+
+// encodable returns whether charset holds r
+func encodable(charset string, r rune) bool {
+	if strings.EqualFold(charset, "latin1") {
+		if r >= 0x80 && r <= 0xFF && latin1Controls[byte(r)] {
+			return true
+		}
+		_, ok := charmap.Windows1252.EncodeRune(r)
+		return ok
+	}
+	_, _, err := transform.String(umconf.CharsetEncoding(charset).NewEncoder(), string(r))
+	return err == nil
+}
+
+// columnTranscoder transcodes the text of a column of the row images from
+// the charset of the source column to UTF-8, the charset the applier writes
+// in, and checks the column of the target holds its characters
+type columnTranscoder struct {
+	column string
+	// ordinal locates the column in row images
+	ordinal int
+	// source and target are the charsets of the columns
+	source, target string
+	// replace replaces the invalid bytes and the characters the target
+	// can't hold, instead of failing
+	replace bool
+}
+
+// transcode returns the UTF-8 text of value. replaced is whether invalid
+// bytes or characters were replaced.
+func (t *columnTranscoder) transcode(value interface{}) (result interface{}, replaced bool, err error) {
+	var raw []byte
+	switch v := value.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return value, false, nil
+	}
+
+	var text string
+	var ok bool
+	if umconf.IsUTF8Charset(t.source) {
+		text, ok = string(raw), utf8.Valid(raw)
+		if !ok {
+			text = strings.ToValidUTF8(text, string(utf8.RuneError))
+		}
+	} else {
+		text, ok = decodeText(t.source, raw)
+	}
+	if !ok {
+		if !t.replace {
+			return nil, false, fmt.Errorf("%v holds bytes invalid in %v", valueText(value), t.source)
+		}
+		replaced = true
+	}
+
+	if !umconf.IsUTF8Charset(t.target) && umconf.CharsetEncoding(t.target) != nil {
+		var b strings.Builder
+		for _, r := range text {
+			if encodable(t.target, r) {
+				b.WriteRune(r)
+				continue
+			}
+			if !t.replace {
+				return nil, false, fmt.Errorf("%q can't be written in %v", r, t.target)
+			}
+			b.WriteByte('?')
+			replaced = true
+		}
+		text = b.String()
+	}
+	return text, replaced, nil
+}
+
+// validateCharsets checks the charsets cfg sets for the source
+func validateCharsets(cfg *config.MySQLDriverConfig) error {
+	switch cfg.InvalidCharacters {
+	case "", config.InvalidCharactersFail, config.InvalidCharactersReplace:
+	default:
+		return fmt.Errorf("InvalidCharacters %q is not one of %q, %q",
+			cfg.InvalidCharacters, config.InvalidCharactersFail, config.InvalidCharactersReplace)
+	}
+	overridden := false
+	check := func(charset string) error {
+		if charset == "" {
+			return nil
+		}
+		overridden = true
+		if !knownCharset(charset) {
+			return fmt.Errorf("can't transcode charset %v", charset)
+		}
+		return nil
+	}
+	if err := check(cfg.SourceCharset); err != nil {
+		return fmt.Errorf("SourceCharset: %v", err)
+	}
+	for _, ds := range cfg.ReplicateDoDb {
+		for _, tb := range ds.Tables {
+			for column, charset := range tb.SourceCharsets {
+				if err := check(charset); err != nil {
+					return fmt.Errorf("%s.%s: column %v: %v", tb.TableSchema, tb.TableName, column, err)
+				}
+			}
+		}
+	}
+	if overridden && !utf8Connection(cfg.ConnectionConfig.Charset) {
+		return fmt.Errorf("transcoding needs the charset of the connection to be utf8mb4, not %v", cfg.ConnectionConfig.Charset)
+	}
+	return nil
+}
+
+// newColumnTranscoders returns the transcoders of the columns of the target
+// table schema.table the rows of sourceSchema.sourceTable are written to,
+// whose text is not written as it is: the charset of the source column
+// differs from UTF-8, or the one of the target column does. Nothing is
+// transcoded if the charset of the connection is not UTF-8.
+func (a *Applier) newColumnTranscoders(tb *config.Table, columns *umconf.ColumnList, sourceSchema, sourceTable, schema, table string) ([]*columnTranscoder, error) {
+	if !utf8Connection(a.mysqlContext.ConnectionConfig.Charset) {
+		return nil, nil
+	}
+	detected := a.sourceTables.charsets(sourceSchema, sourceTable)
+	sourceCharset := func(column string) string {
+		if tb != nil {
+			for name, charset := range tb.SourceCharsets {
+				if strings.EqualFold(name, column) {
+					return charset
+				}
+			}
+		}
+		if a.mysqlContext.SourceCharset != "" {
+			return a.mysqlContext.SourceCharset
+		}
+		return detected[column]
+	}
+
+	var targetCharsets map[string]string
+	var transcoders []*columnTranscoder
+	for _, column := range columns.Columns {
+		source := sourceCharset(column.Name)
+		if source == "" || !knownCharset(source) {
+			continue
+		}
+		if targetCharsets == nil {
+			var err error
+			if targetCharsets, err = base.GetColumnCharsets(a.db, schema, table); err != nil {
+				return nil, err
+			}
+		}
+		target, ok := targetCharsets[column.Name]
+		if !ok {
+			// Not a text column
+			continue
+		}
+		if umconf.IsUTF8Charset(source) && (umconf.IsUTF8Charset(target) || umconf.CharsetEncoding(target) == nil) {
+			continue
+		}
+		transcoders = append(transcoders, &columnTranscoder{
+			column:  column.Name,
+			ordinal: columns.Ordinals[column.Name],
+			source:  source,
+			target:  target,
+			replace: a.mysqlContext.InvalidCharacters == config.InvalidCharactersReplace,
+		})
+	}
+	return transcoders, nil
+}
+
+// transcodeValues returns a copy of the row image values with the text of
+// the columns of transcoders in UTF-8, values itself without transcoders
+func (a *Applier) transcodeValues(transcoders []*columnTranscoder, values []*interface{}) ([]*interface{}, error) {
+	if len(transcoders) == 0 || values == nil {
+		return values, nil
+	}
+	transcoded := make([]*interface{}, len(values))
+	copy(transcoded, values)
+	for _, t := range transcoders {
+		value := *values[t.ordinal]
+		result, replaced, err := t.transcode(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: %v", t.column, err)
+		}
+		if replaced {
+			a.logger.Warnf("mysql.applier: column %v: %v is not valid from %v to %v, writing %v",
+				t.column, valueText(value), t.source, t.target, result)
+		}
+		transcoded[t.ordinal] = &result
+	}
+	return transcoded, nil
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestColumnTranscoder(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       string
+		target       string
+		replace      bool
+		value        interface{}
+		want         interface{}
+		wantReplaced bool
+		wantErr      bool
+	}{
+		{"latin1", "latin1", "utf8mb4", false, []byte("caf\xe9 \x80"), "café €", false, false},
+		{"latin1 controls", "latin1", "utf8mb4", false, []byte("\x81\x9d"), "\u0081\u009d", false, false},
+		{"gbk", "gbk", "utf8mb4", false, []byte("\xd6\xd0\xce\xc4"), "中文", false, false},
+		{"gbk string", "GBK", "utf8", false, "\xd6\xd0\xce\xc4abc", "中文abc", false, false},
+		{"gbk invalid", "gbk", "utf8mb4", false, []byte("a\x81\x20b"), nil, false, true},
+		{"gbk invalid replaced", "gbk", "utf8mb4", true, []byte("\xd6\xd0\x81"), "中�", true, false},
+		{"big5", "big5", "utf8mb4", false, []byte("\xa4\xa4\xa4\xe5"), "中文", false, false},
+		{"utf8 invalid", "utf8mb4", "latin1", false, []byte("a\xffb"), nil, false, true},
+		{"utf8 invalid replaced", "utf8mb4", "latin1", true, []byte("a\xffb"), "a?b", true, false},
+		{"to latin1", "utf8mb4", "latin1", false, "café", "café", false, false},
+		{"emoji to latin1", "utf8mb4", "latin1", false, "a😀", nil, false, true},
+		{"emoji to latin1 replaced", "utf8mb4", "latin1", true, "a😀", "a?", true, false},
+		{"gbk to latin1", "gbk", "latin1", true, []byte("\xd6\xd0e"), "?e", true, false},
+		{"null", "gbk", "utf8mb4", false, nil, nil, false, false},
+		{"not text", "gbk", "utf8mb4", false, int64(1), int64(1), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &columnTranscoder{column: "c", source: tt.source, target: tt.target, replace: tt.replace}
+			got, replaced, err := c.transcode(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("transcode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || replaced != tt.wantReplaced {
+				t.Errorf("transcode() = %q, %v, want %q, %v", got, replaced, tt.want, tt.wantReplaced)
+			}
+		})
+	}
+}
+
+func TestApplier_transcodeValues(t *testing.T) {
+	a := &Applier{logger: log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel))}
+	a.sourceTables.learn(&binlog.BinlogEntry{Events: []binlog.DataEvent{{
+		DatabaseName: "db1",
+		TableName:    "t1",
+		Table: &config.Table{OriginalTableColumns: umconf.NewColumnList([]umconf.Column{
+			{Name: "id"},
+			{Name: "name", Charset: "gbk"},
+		})},
+	}}})
+	if got := a.sourceTables.charsets("db1", "t1"); len(got) != 1 || got["name"] != "gbk" {
+		t.Fatalf("sourceTables.charsets() = %v, want name in gbk", got)
+	}
+
+	transcoders := []*columnTranscoder{{column: "name", ordinal: 1, source: "gbk", target: "utf8mb4"}}
+	id, name := interface{}(int64(1)), interface{}([]byte("\xd6\xd0\xce\xc4"))
+	values := []*interface{}{&id, &name}
+	got, err := a.transcodeValues(transcoders, values)
+	if err != nil {
+		t.Fatalf("transcodeValues() error = %v", err)
+	}
+	if *got[0] != int64(1) || *got[1] != "中文" {
+		t.Errorf("transcodeValues() = %v, %v", *got[0], *got[1])
+	}
+	if _, ok := (*values[1]).([]byte); !ok {
+		t.Errorf("transcodeValues() changed the row image")
+	}
+
+	invalid := interface{}([]byte("\x81"))
+	if _, err := a.transcodeValues(transcoders, []*interface{}{&id, &invalid}); err == nil {
+		t.Errorf("transcodeValues() of invalid gbk = nil error")
+	}
+}
+
+func Test_validateCharsets(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *config.MySQLDriverConfig
+		wantErr bool
+	}{
+		{"none", &config.MySQLDriverConfig{}, false},
+		{"source charset", &config.MySQLDriverConfig{SourceCharset: "gbk", InvalidCharacters: config.InvalidCharactersReplace}, false},
+		{"unknown invalid characters", &config.MySQLDriverConfig{InvalidCharacters: "drop"}, true},
+		{"unknown source charset", &config.MySQLDriverConfig{SourceCharset: "ucs2"}, true},
+		{"unknown column charset", &config.MySQLDriverConfig{ReplicateDoDb: []*config.DataSource{{
+			TableSchema: "db1",
+			Tables:      []*config.Table{{TableSchema: "db1", TableName: "t1", SourceCharsets: map[string]string{"name": "utf32"}}},
+		}}}, true},
+		{"connection not utf8", &config.MySQLDriverConfig{SourceCharset: "latin1",
+			ConnectionConfig: &umconf.ConnectionConfig{Charset: "latin1"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cfg.ConnectionConfig == nil {
+				tt.cfg.ConnectionConfig = &umconf.ConnectionConfig{}
+			}
+			if err := validateCharsets(tt.cfg.SetDefault()); (err != nil) != tt.wantErr {
+				t.Errorf("validateCharsets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
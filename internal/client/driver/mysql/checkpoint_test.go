@@ -0,0 +1,336 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/internal/g"
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+
+	"github.com/satori/go.uuid"
+)
+
+// checkpointServer stands for a target server. Statements run in a
+// transaction are kept only once it commits.
+type checkpointServer struct {
+	l sync.Mutex
+
+	// committed holds the statements the server committed, and
+	// checkpoints the source_uuid and interval_gtid rows of the checkpoint
+	// table
+	committed   []string
+	checkpoints [][2]interface{}
+	// splits holds the rows of the split progress table
+	splits [][3]driver.Value
+
+	// failOn makes statements containing it fail, as if the applier was
+	// killed there
+	failOn string
+}
+
+func (s *checkpointServer) Open(name string) (driver.Conn, error) {
+	return &checkpointConn{server: s}, nil
+}
+
+type checkpointConn struct {
+	server *checkpointServer
+
+	// tx is set in a transaction
+	tx          *checkpointConn
+	pending     []string
+	checkpoints [][2]interface{}
+	splitOps    []func(s *checkpointServer)
+}
+
+func (c *checkpointConn) Prepare(query string) (driver.Stmt, error) {
+	return &checkpointStmt{conn: c, query: query}, nil
+}
+
+func (c *checkpointConn) Close() error { return nil }
+
+func (c *checkpointConn) Begin() (driver.Tx, error) {
+	c.tx = c
+	return c, nil
+}
+
+func (c *checkpointConn) Commit() error {
+	c.server.l.Lock()
+	defer c.server.l.Unlock()
+	c.server.committed = append(c.server.committed, c.pending...)
+	c.server.checkpoints = append(c.server.checkpoints, c.checkpoints...)
+	for _, op := range c.splitOps {
+		op(c.server)
+	}
+	return c.Rollback()
+}
+
+func (c *checkpointConn) Rollback() error {
+	c.tx, c.pending, c.checkpoints, c.splitOps = nil, nil, nil, nil
+	return nil
+}
+
+type checkpointStmt struct {
+	conn  *checkpointConn
+	query string
+}
+
+func (s *checkpointStmt) Close() error  { return nil }
+func (s *checkpointStmt) NumInput() int { return -1 }
+
+func (s *checkpointStmt) Exec(args []driver.Value) (driver.Result, error) {
+	c := s.conn
+	c.server.l.Lock()
+	defer c.server.l.Unlock()
+	query := s.query
+	if len(args) > 0 && !strings.Contains(query, g.DtleSchemaName) {
+		query = fmt.Sprint(query, " ", args)
+	}
+	if c.server.failOn != "" && strings.Contains(query, c.server.failOn) {
+		return nil, errors.New("connection killed")
+	}
+
+	if strings.Contains(s.query, g.SplitProgressTableV2) {
+		op := func(server *checkpointServer) {
+			if strings.HasPrefix(s.query, "insert into") {
+				server.splits = append(server.splits, [3]driver.Value{args[0], args[1], args[2]})
+				return
+			}
+			var kept [][3]driver.Value
+			for _, row := range server.splits {
+				if fmt.Sprint(row[0], row[1]) != fmt.Sprint(args[0], args[1]) {
+					kept = append(kept, row)
+				}
+			}
+			server.splits = kept
+		}
+		if c.tx == nil {
+			op(c.server)
+		} else {
+			c.splitOps = append(c.splitOps, op)
+		}
+	} else if strings.Contains(s.query, g.GtidExecutedTableV2) {
+		checkpoint := [2]interface{}{args[0], fmt.Sprint(args[1])}
+		if c.tx == nil {
+			c.server.checkpoints = append(c.server.checkpoints, checkpoint)
+		} else {
+			c.checkpoints = append(c.checkpoints, checkpoint)
+		}
+	} else if c.tx == nil {
+		c.server.committed = append(c.server.committed, query)
+	} else {
+		c.pending = append(c.pending, query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *checkpointStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.server.l.Lock()
+	defer s.conn.server.l.Unlock()
+	if strings.Contains(s.query, g.SplitProgressTableV2) {
+		// The most events committed of each transaction
+		rows := &checkpointRows{columns: []string{"source_uuid", "gno", "events"}}
+		index := make(map[string]int)
+		for _, split := range s.conn.server.splits {
+			split := split
+			key := fmt.Sprint(split[0], split[1])
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(rows.rows)
+				rows.rows = append(rows.rows, split[:])
+			} else if split[2].(int64) > rows.rows[i][2].(int64) {
+				rows.rows[i] = split[:]
+			}
+		}
+		return rows, nil
+	}
+	rows := &checkpointRows{columns: []string{"source_uuid", "interval_gtid"}}
+	for _, checkpoint := range s.conn.server.checkpoints {
+		rows.rows = append(rows.rows, []driver.Value{checkpoint[0], checkpoint[1]})
+	}
+	return rows, nil
+}
+
+type checkpointRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *checkpointRows) Columns() []string { return r.columns }
+func (r *checkpointRows) Close() error      { return nil }
+
+func (r *checkpointRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newCheckpointApplier returns an applier writing to server, as it is
+// started for a job at gtid
+func newCheckpointApplier(t *testing.T, server *checkpointServer, jobUUID uuid.UUID, gtid string) *Applier {
+	// A driver per server
+	name := fmt.Sprintf("checkpoint-%p", server)
+	registered := false
+	for _, driver := range gosql.Drivers() {
+		registered = registered || driver == name
+	}
+	if !registered {
+		gosql.Register(name, server)
+	}
+	db, err := gosql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxIdleConns(0)
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shutdownCh := make(chan struct{})
+	a := &Applier{
+		logger:       log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)),
+		subjectUUID:  jobUUID,
+		mysqlContext: &config.MySQLDriverConfig{Gtid: gtid},
+		db:           db,
+		dbs:          []*sql.Conn{{DbMutex: &sync.Mutex{}, Db: conn}},
+		shutdownCh:   shutdownCh,
+		mtsManager:   NewMtsManager(shutdownCh),
+		waitCh:       make(chan *models.WaitResult, 1),
+	}
+	go a.mtsManager.LcUpdater()
+	if err := a.prepareGtidExecutedStmts(a.dbs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.loadGtidExecuted(); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestApplier_ApplyBinlogEvent_Recovery(t *testing.T) {
+	server := &checkpointServer{}
+	jobUUID := uuid.NewV4()
+	sid := uuid.NewV4()
+	entry := func(gno int64, queries ...string) *binlog.BinlogEntry {
+		e := &binlog.BinlogEntry{Coordinates: base.BinlogCoordinateTx{SID: sid, GNO: gno, SeqenceNumber: gno}}
+		for _, query := range queries {
+			e.Events = append(e.Events, binlog.DataEvent{DML: binlog.NotDML, Query: query})
+		}
+		return e
+	}
+	tx1 := entry(11, "insert into t values (1)", "insert into t values (2)")
+	tx2 := entry(12, "insert into t values (3)", "insert into t values (4) killed", "insert into t values (5)")
+
+	// The job starts after the transactions up to 10
+	a := newCheckpointApplier(t, server, jobUUID, sid.String()+":1-10")
+	if err := a.ApplyBinlogEvent(0, tx1); err != nil {
+		t.Fatalf("ApplyBinlogEvent() error = %v", err)
+	}
+	server.failOn = "killed"
+	if err := a.ApplyBinlogEvent(0, tx2); err == nil {
+		t.Fatalf("ApplyBinlogEvent() of a killed transaction error = nil")
+	}
+	if want := sid.String() + ":1-11"; a.mysqlContext.Gtid != want {
+		t.Fatalf("Applier resumes from %q, want %q", a.mysqlContext.Gtid, want)
+	}
+	close(a.shutdownCh)
+
+	// The restarted applier skips what it committed and applies the rest
+	server.failOn = ""
+	a = newCheckpointApplier(t, server, jobUUID, a.mysqlContext.Gtid)
+	defer close(a.shutdownCh)
+	for _, e := range []*binlog.BinlogEntry{tx1, tx2} {
+		if base.IntervalSlicesContainOne(a.gtidExecuted[sid].Intervals, e.Coordinates.GNO) {
+			continue
+		}
+		if err := a.ApplyBinlogEvent(0, e); err != nil {
+			t.Fatalf("ApplyBinlogEvent() error = %v", err)
+		}
+	}
+
+	want := []string{
+		"insert into t values (1)", "insert into t values (2)",
+		"insert into t values (3)", "insert into t values (4) killed", "insert into t values (5)",
+	}
+	if strings.Join(server.committed, ";") != strings.Join(want, ";") {
+		t.Errorf("server committed %q, want %q", server.committed, want)
+	}
+	if want := sid.String() + ":1-12"; a.mysqlContext.Gtid != want {
+		t.Errorf("Applier resumes from %q, want %q", a.mysqlContext.Gtid, want)
+	}
+}
+
+func TestApplier_ApplyBinlogEvent_Split(t *testing.T) {
+	server := &checkpointServer{}
+	jobUUID := uuid.NewV4()
+	sid := uuid.NewV4()
+	item := newApplierTableItem(1)
+	item.columns = umconf.NewColumnList([]umconf.Column{{Name: "id", Key: "PRI"}, {Name: "v"}})
+	tx := &binlog.BinlogEntry{Coordinates: base.BinlogCoordinateTx{SID: sid, GNO: 11, SeqenceNumber: 11}}
+	for id, v := range []string{"a", "b", "c", "killed", "e"} {
+		e := binlog.NewDataEvent("db1", "t1", binlog.InsertDML, 2)
+		e.TableItem = item
+		e.NewColumnValues = umconf.ToColumnValues([]interface{}{int64(id + 1), v})
+		tx.Events = append(tx.Events, e)
+	}
+	newApplier := func() *Applier {
+		a := newCheckpointApplier(t, server, jobUUID, sid.String()+":1-10")
+		a.mysqlContext.SplitTransactionRows = 2
+		return a
+	}
+
+	// The applier is killed in the second part
+	a := newApplier()
+	server.failOn = "killed"
+	if err := a.ApplyBinlogEvent(0, tx); err == nil {
+		t.Fatalf("ApplyBinlogEvent() of a killed transaction error = nil")
+	}
+	if len(server.committed) != 2 || len(server.splits) != 1 || server.splits[0][2] != int64(2) {
+		t.Fatalf("server committed %q and the progress %v, want the first part", server.committed, server.splits)
+	}
+	close(a.shutdownCh)
+
+	// The restarted applier applies the other parts, once
+	server.failOn = ""
+	a = newApplier()
+	defer close(a.shutdownCh)
+	if err := a.ApplyBinlogEvent(0, tx); err != nil {
+		t.Fatalf("ApplyBinlogEvent() error = %v", err)
+	}
+	var ids []string
+	for _, query := range server.committed {
+		ids = append(ids, query[strings.LastIndex(query, "[")+1:strings.LastIndex(query, " ")])
+	}
+	if want := "1 2 3 4 5"; strings.Join(ids, " ") != want {
+		t.Errorf("server committed %q, want the rows %s once", server.committed, want)
+	}
+	if len(server.splits) != 0 {
+		t.Errorf("server holds the progress %v of a transaction applied", server.splits)
+	}
+	if want := sid.String() + ":1-11"; a.mysqlContext.Gtid != want {
+		t.Errorf("Applier resumes from %q, want %q", a.mysqlContext.Gtid, want)
+	}
+}
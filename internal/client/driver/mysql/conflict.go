@@ -0,0 +1,297 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// conflictResolver decides what to do with the rows conflicting with those
+// of the target, by policy
+type conflictResolver struct {
+	policy string
+	// column holds the version of rows, none if empty
+	column string
+}
+
+// newConflictResolver returns the resolver of the conflict policy, or nil
+// not to look for conflicts
+func newConflictResolver(policy, column string) (*conflictResolver, error) {
+	switch policy {
+	case "":
+		return nil, nil
+	case config.ConflictPolicyError, config.ConflictPolicySource, config.ConflictPolicyTarget:
+	case config.ConflictPolicyTimestamp:
+		if column == "" {
+			return nil, fmt.Errorf("ConflictPolicy %v needs a ConflictColumn", policy)
+		}
+	default:
+		return nil, fmt.Errorf("unknown ConflictPolicy %q", policy)
+	}
+	return &conflictResolver{policy: policy, column: column}, nil
+}
+
+// targetRow is what the target holds at the key of a row
+type targetRow struct {
+	exists bool
+	// sameVersion tells the row has the version of the before image, and
+	// notNewer that it's not newer than the row of the source
+	sameVersion bool
+	notNewer    bool
+}
+
+// sourceWins tells whether the row of the source replaces target, which
+// conflicts with it. target is nil if what the target holds is unknown.
+func (r *conflictResolver) sourceWins(target *targetRow, hasVersion bool) (bool, error) {
+	switch r.policy {
+	case config.ConflictPolicySource:
+		return true, nil
+	case config.ConflictPolicyTarget:
+		return false, nil
+	case config.ConflictPolicyTimestamp:
+		if target != nil && !target.exists {
+			return true, nil
+		}
+		if target == nil || !hasVersion {
+			return false, fmt.Errorf("no %v to compare the rows with", r.column)
+		}
+		return target.notNewer, nil
+	default:
+		return false, fmt.Errorf("ConflictPolicy is %v", r.policy)
+	}
+}
+
+// rowKey locates the primary key and the version of rows in their images
+type rowKey struct {
+	columns  []umconf.Column
+	ordinals []int
+	// version is the version column, nil if the table has none
+	version        *umconf.Column
+	versionOrdinal int
+}
+
+func newRowKey(columns *umconf.ColumnList, versionColumn string) *rowKey {
+	k := &rowKey{}
+	for _, col := range columns.ColumnList() {
+		if col.IsPk() {
+			k.columns = append(k.columns, col)
+			k.ordinals = append(k.ordinals, columns.Ordinals[col.Name])
+		}
+		if versionColumn != "" && strings.EqualFold(col.Name, versionColumn) {
+			version := col
+			k.version, k.versionOrdinal = &version, columns.Ordinals[col.Name]
+		}
+	}
+	return k
+}
+
+// where returns the condition on the key of the row values, and its args
+func (k *rowKey) where(values []*interface{}) (string, []interface{}) {
+	comparisons := make([]string, len(k.columns))
+	args := make([]interface{}, len(k.columns))
+	for i := range k.columns {
+		comparisons[i] = fmt.Sprintf("%s = ?", sql.EscapeName(k.columns[i].Name))
+		args[i] = convertArg(&k.columns[i], *values[k.ordinals[i]])
+	}
+	return strings.Join(comparisons, " and "), args
+}
+
+// format returns the key of the row values, to log
+func (k *rowKey) format(values []*interface{}) string {
+	pairs := make([]string, len(k.columns))
+	for i, col := range k.columns {
+		v := *values[k.ordinals[i]]
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		pairs[i] = fmt.Sprintf("%s=%v", col.Name, v)
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// changed tells whether the key differs in the two row images
+func (k *rowKey) changed(before, after []*interface{}) bool {
+	for _, ordinal := range k.ordinals {
+		if fmt.Sprintf("%v", *before[ordinal]) != fmt.Sprintf("%v", *after[ordinal]) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionArg returns the version of the row values as a query arg
+func (k *rowKey) versionArg(values []*interface{}) interface{} {
+	if values == nil {
+		return nil
+	}
+	return convertArg(k.version, *values[k.versionOrdinal])
+}
+
+func convertArg(col *umconf.Column, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return col.ConvertArg(v)
+}
+
+// selectTargetRow locks the row of the target at the key of values, and
+// compares its version with the ones of the before image and of the row of
+// the source. The target compares them, as it would the versions written.
+func (k *rowKey) selectTargetRow(tx *gosql.Tx, schema, table string, values, before, source []*interface{}) (*targetRow, error) {
+	where, keyArgs := k.where(values)
+	fields := "1, 1, 1"
+	var args []interface{}
+	if k.version != nil {
+		// NULL versions are older than any other
+		version := sql.EscapeName(k.version.Name)
+		fields = fmt.Sprintf("1, %s <=> ?, %s is null or %s <= ?", version, version, version)
+		args = append(args, k.versionArg(before), k.versionArg(source))
+	}
+	args = append(args, keyArgs...)
+	query := fmt.Sprintf("select %s from %s.%s where %s for update",
+		fields, sql.EscapeName(schema), sql.EscapeName(table), where)
+
+	var exists int
+	var sameVersion, notNewer gosql.NullBool
+	err := tx.QueryRow(query, args...).Scan(&exists, &sameVersion, &notNewer)
+	if err == gosql.ErrNoRows {
+		return &targetRow{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &targetRow{exists: true, sameVersion: sameVersion.Bool, notNewer: notNewer.Bool}, nil
+}
+
+// applyRowWithConflicts applies the row event of tx, unless it conflicts
+// with the row of the target and the conflict policy keeps the latter. It
+// returns the change of the row count of the target.
+func (a *Applier) applyRowWithConflicts(tx *gosql.Tx, event binlog.DataEvent, workerIdx int) (int64, error) {
+	tableItem := event.TableItem.(*applierTableItem)
+	key := newRowKey(tableItem.columns, a.conflicts.column)
+	if len(key.columns) == 0 {
+		// Rows without a primary key can't be told apart
+		return a.applyRow(event, workerIdx)
+	}
+	schema, table := a.nameMapping.Table(event.DatabaseName, event.TableName)
+	if tableItem.targetTable != "" {
+		table = tableItem.targetTable
+	}
+
+	var before, after []*interface{}
+	if event.WhereColumnValues != nil {
+		before = event.WhereColumnValues.GetAbstractValues()
+	}
+	if event.NewColumnValues != nil {
+		after = event.NewColumnValues.GetAbstractValues()
+	}
+	// source is the row of the source the one of the target is compared with
+	source := after
+	if event.DML == binlog.DeleteDML {
+		source = before
+	}
+
+	// the conflict, at the key of keyValues
+	var reason string
+	var target *targetRow
+	var err error
+	keyValues := source
+	if event.DML == binlog.InsertDML {
+		if target, err = key.selectTargetRow(tx, schema, table, after, nil, after); err != nil {
+			return 0, err
+		}
+		if target.exists {
+			reason = "duplicate key"
+		}
+	} else {
+		keyValues = before
+		if target, err = key.selectTargetRow(tx, schema, table, before, before, source); err != nil {
+			return 0, err
+		}
+		if !target.exists {
+			reason = "row missing"
+		} else if key.version != nil && !target.sameVersion {
+			reason = "version mismatch"
+		} else if event.DML == binlog.UpdateDML && key.changed(before, after) {
+			if target, err = key.selectTargetRow(tx, schema, table, after, nil, after); err != nil {
+				return 0, err
+			}
+			if target.exists {
+				reason, keyValues = "duplicate key", after
+			}
+		}
+	}
+	if reason == "" {
+		delta, err := a.applyRow(event, workerIdx)
+		if !sql.IsDupEntryError(err) {
+			return delta, err
+		}
+		// On another unique key, the row of the target is unknown
+		reason, target, keyValues = "duplicate key", nil, source
+	}
+
+	conflict := fmt.Sprintf("conflict on %s.%s (%s): %s", schema, table, key.format(keyValues), reason)
+	wins, err := a.conflicts.sourceWins(target, key.version != nil)
+	if err != nil {
+		a.logger.Errorf("mysql.applier: %s, failing the job: %v", conflict, err)
+		return 0, fmt.Errorf("%s: %v", conflict, err)
+	}
+	if !wins {
+		a.logger.Warnf("mysql.applier: %s, keeping the row of the target", conflict)
+		return 0, nil
+	}
+	a.logger.Warnf("mysql.applier: %s, writing the row of the source", conflict)
+	return a.overwriteRow(tx, event, key, tableItem.columns, schema, table, before, after)
+}
+
+// overwriteRow writes the row event of tx over the rows of the target:
+// the row at the key of the before image is deleted, and the new image
+// replaces the rows holding any of its keys. As applyRow does, only the
+// replicated columns are written: with a column filter, the rows of the
+// target keep the columns it leaves out.
+func (a *Applier) overwriteRow(tx *gosql.Tx, event binlog.DataEvent, key *rowKey, columns *umconf.ColumnList,
+	schema, table string, before, after []*interface{}) (int64, error) {
+	tb := a.tableConfig(event.DatabaseName, event.TableName)
+	filtered := tb != nil && tb.HasColumnFilter()
+	if before != nil && (after == nil || !filtered || key.changed(before, after)) {
+		where, args := key.where(before)
+		query := fmt.Sprintf("delete from %s.%s where %s", sql.EscapeName(schema), sql.EscapeName(table), where)
+		if _, err := tx.Exec(query, args...); err != nil {
+			return 0, err
+		}
+	}
+	if after != nil {
+		var query string
+		var args []interface{}
+		var err error
+		if filtered {
+			query, args, err = sql.BuildDMLUpsertQuery(schema, table, columns, after)
+		} else {
+			query, args, err = sql.BuildDMLInsertQuery(schema, table, columns, columns, columns, after)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return 0, err
+		}
+	}
+	switch event.DML {
+	case binlog.InsertDML:
+		return 1, nil
+	case binlog.DeleteDML:
+		return -1, nil
+	default:
+		return 0, nil
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func TestConflictResolver_sourceWins(t *testing.T) {
+	for _, policy := range []string{config.ConflictPolicyTimestamp, "lww"} {
+		if _, err := newConflictResolver(policy, ""); err == nil {
+			t.Errorf("newConflictResolver(%q, \"\") = nil error", policy)
+		}
+	}
+	if r, err := newConflictResolver("", ""); r != nil || err != nil {
+		t.Errorf("newConflictResolver(\"\") = %v, %v, want nil", r, err)
+	}
+
+	missing := &targetRow{}
+	newer := &targetRow{exists: true}
+	older := &targetRow{exists: true, notNewer: true}
+	tests := []struct {
+		policy     string
+		target     *targetRow
+		hasVersion bool
+		want       bool
+		wantErr    bool
+	}{
+		{config.ConflictPolicyError, missing, true, false, true},
+		{config.ConflictPolicySource, newer, true, true, false},
+		{config.ConflictPolicySource, nil, false, true, false},
+		{config.ConflictPolicyTarget, older, true, false, false},
+		{config.ConflictPolicyTimestamp, missing, false, true, false},
+		{config.ConflictPolicyTimestamp, newer, true, false, false},
+		{config.ConflictPolicyTimestamp, older, true, true, false},
+		{config.ConflictPolicyTimestamp, older, false, false, true},
+		{config.ConflictPolicyTimestamp, nil, true, false, true},
+	}
+	for i, tt := range tests {
+		r, err := newConflictResolver(tt.policy, "updated_at")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := r.sourceWins(tt.target, tt.hasVersion)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%d: %v: sourceWins() = %v, %v, want %v, error %v", i, tt.policy, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRowKey(t *testing.T) {
+	columns := umconf.NewColumnList([]umconf.Column{
+		{Name: "region", Key: "PRI"},
+		{Name: "name"},
+		{Name: "id", Key: "PRI"},
+		{Name: "Updated_At"},
+	})
+	row := func(values ...interface{}) []*interface{} {
+		row := make([]*interface{}, len(values))
+		for i := range values {
+			row[i] = &values[i]
+		}
+		return row
+	}
+	before := row([]byte("eu"), "a", int64(1), "2018-01-01 00:00:00")
+	after := row([]byte("eu"), "b", int64(1), "2018-01-02 00:00:00")
+
+	k := newRowKey(columns, "updated_at")
+	if k.version == nil || k.versionOrdinal != 3 {
+		t.Errorf("newRowKey() version = %v at %v, want Updated_At at 3", k.version, k.versionOrdinal)
+	}
+	where, args := k.where(before)
+	if want := "`region` = ? and `id` = ?"; where != want {
+		t.Errorf("rowKey.where() = %v, want %v", where, want)
+	}
+	if want := []interface{}{[]byte("eu"), int64(1)}; !reflect.DeepEqual(args, want) {
+		t.Errorf("rowKey.where() args = %v, want %v", args, want)
+	}
+	if got, want := k.format(before), "region=eu, id=1"; got != want {
+		t.Errorf("rowKey.format() = %v, want %v", got, want)
+	}
+	if k.changed(before, after) {
+		t.Errorf("rowKey.changed() = true for the same key")
+	}
+	if !k.changed(before, row([]byte("us"), "a", int64(1), nil)) {
+		t.Errorf("rowKey.changed() = false for another key")
+	}
+	if got := k.versionArg(after); got != "2018-01-02 00:00:00" {
+		t.Errorf("rowKey.versionArg() = %v", got)
+	}
+
+	if k := newRowKey(columns, ""); k.version != nil {
+		t.Errorf("newRowKey() without version column = %v", k.version)
+	}
+}
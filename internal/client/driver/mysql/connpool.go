@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// connPool hands the connections of the applier out to its workers: a
+// worker takes one, by its index in the connections of the applier, for
+// each transaction it applies, and waits while the others hold them all
+type connPool struct {
+	free chan int
+	// size is how many connections the pool holds
+	size  int
+	inUse int64
+	// waited is how long the workers waited for a connection, in
+	// nanoseconds
+	waited int64
+}
+
+func newConnPool(size int) *connPool {
+	p := &connPool{free: make(chan int, size), size: size}
+	for i := 0; i < size; i++ {
+		p.free <- i
+	}
+	return p
+}
+
+// get returns the index of a free connection, once there is one. It
+// returns false if shutdownCh was closed meanwhile.
+func (p *connPool) get(shutdownCh <-chan struct{}) (int, bool) {
+	select {
+	case idx := <-p.free:
+		atomic.AddInt64(&p.inUse, 1)
+		return idx, true
+	default:
+	}
+	start := time.Now()
+	select {
+	case idx := <-p.free:
+		atomic.AddInt64(&p.waited, int64(time.Since(start)))
+		atomic.AddInt64(&p.inUse, 1)
+		return idx, true
+	case <-shutdownCh:
+		return 0, false
+	}
+}
+
+// put gives back the connection idx
+func (p *connPool) put(idx int) {
+	atomic.AddInt64(&p.inUse, -1)
+	p.free <- idx
+}
+
+// workerConns returns how many connections the parallelWorkers workers of
+// the applier of cfg share: one each, unless MaxConnections leaves fewer
+// once one is kept for the other queries
+func workerConns(cfg *config.MySQLDriverConfig, parallelWorkers int) int {
+	if cfg.MaxConnections > 0 && cfg.MaxConnections-1 < parallelWorkers {
+		return cfg.MaxConnections - 1
+	}
+	return parallelWorkers
+}
+
+// maxOpenConns returns how many connections the applier of cfg opens to
+// the target at most, with parallelWorkers workers
+func maxOpenConns(cfg *config.MySQLDriverConfig, parallelWorkers int) int {
+	if cfg.MaxConnections > 0 {
+		return cfg.MaxConnections
+	}
+	return 10 + parallelWorkers
+}
+
+// warnMaxConnections warns when MaxConnections leaves fewer connections
+// than parallelWorkers workers, some of them then waiting for one
+func (a *Applier) warnMaxConnections(parallelWorkers int) {
+	if conns := workerConns(a.mysqlContext, parallelWorkers); conns < parallelWorkers {
+		a.logger.Warnf("mysql.applier: MaxConnections %d leaves %d connections to %d workers, the others wait for a free one",
+			a.mysqlContext.MaxConnections, conns, parallelWorkers)
+	}
+}
+
+// validateMaxConnections checks that MaxConnections leaves a connection
+// to the workers
+func validateMaxConnections(cfg *config.MySQLDriverConfig) error {
+	if cfg.MaxConnections != 0 && cfg.MaxConnections < 2 {
+		return fmt.Errorf("MaxConnections is %d, it must be at least 2 or 0", cfg.MaxConnections)
+	}
+	return nil
+}
+
+// workerConnPool returns the pool of the connections of the workers, nil
+// until they are opened
+func (a *Applier) workerConnPool() *connPool {
+	a.connPoolLock.Lock()
+	defer a.connPoolLock.Unlock()
+	return a.connPool
+}
+
+// setConnPool replaces the pool of the connections of the workers
+func (a *Applier) setConnPool(pool *connPool) {
+	a.connPoolLock.Lock()
+	defer a.connPoolLock.Unlock()
+	if a.connPool != nil {
+		// The waits on the connections the pool replaces are kept
+		pool.waited = atomic.LoadInt64(&a.connPool.waited)
+	}
+	a.connPool = pool
+}
+
+// connectionStat returns how busy the connections of the applier to the
+// target are
+func (a *Applier) connectionStat() *models.ConnectionStat {
+	pool := a.workerConnPool()
+	if pool == nil {
+		return nil
+	}
+	return &models.ConnectionStat{
+		Target:       fmt.Sprintf("%s:%d", a.mysqlContext.ConnectionConfig.Host, a.mysqlContext.ConnectionConfig.Port),
+		Open:         a.db.Stats().OpenConnections,
+		Workers:      pool.size,
+		WorkersInUse: int(atomic.LoadInt64(&pool.inUse)),
+		WaitSeconds:  time.Duration(atomic.LoadInt64(&pool.waited)).Seconds(),
+	}
+}
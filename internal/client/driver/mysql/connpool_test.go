@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+func TestConnPool_get(t *testing.T) {
+	shutdownCh := make(chan struct{})
+	p := newConnPool(2)
+	first, _ := p.get(shutdownCh)
+	second, _ := p.get(shutdownCh)
+	if first == second {
+		t.Fatalf("connPool.get() = %d twice", first)
+	}
+
+	got := make(chan int)
+	go func() {
+		idx, _ := p.get(shutdownCh)
+		got <- idx
+	}()
+	select {
+	case idx := <-got:
+		t.Fatalf("connPool.get() = %d while all connections are in use", idx)
+	case <-time.After(50 * time.Millisecond):
+	}
+	p.put(second)
+	if idx := <-got; idx != second {
+		t.Errorf("connPool.get() = %d, want %d", idx, second)
+	}
+	if p.inUse != 2 || p.waited <= 0 {
+		t.Errorf("connPool in use %d, waited %v, want 2 and more than 0", p.inUse, time.Duration(p.waited))
+	}
+
+	close(shutdownCh)
+	if _, ok := p.get(shutdownCh); ok {
+		t.Errorf("connPool.get() = true once shut down")
+	}
+}
+
+func TestWorkerConns(t *testing.T) {
+	tests := []struct {
+		maxConnections  int
+		parallelWorkers int
+		wantWorkers     int
+		wantOpen        int
+	}{
+		{0, 4, 4, 14},
+		{10, 4, 4, 10},
+		{4, 8, 3, 4},
+		{2, 8, 1, 2},
+	}
+	for _, tt := range tests {
+		cfg := &config.MySQLDriverConfig{MaxConnections: tt.maxConnections}
+		if got := workerConns(cfg, tt.parallelWorkers); got != tt.wantWorkers {
+			t.Errorf("workerConns(%d, %d) = %d, want %d", tt.maxConnections, tt.parallelWorkers, got, tt.wantWorkers)
+		}
+		if got := maxOpenConns(cfg, tt.parallelWorkers); got != tt.wantOpen {
+			t.Errorf("maxOpenConns(%d, %d) = %d, want %d", tt.maxConnections, tt.parallelWorkers, got, tt.wantOpen)
+		}
+	}
+	if err := validateMaxConnections(&config.MySQLDriverConfig{MaxConnections: 1}); err == nil {
+		t.Errorf("validateMaxConnections(1) = nil, want an error")
+	}
+}
+
+func TestApplier_setConnPool(t *testing.T) {
+	a := &Applier{}
+	if a.workerConnPool() != nil {
+		t.Fatalf("workerConnPool() of an applier without connections != nil")
+	}
+	a.setConnPool(newConnPool(2))
+	a.connPool.waited = int64(time.Second)
+
+	// The workers being resized while the stats are read
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			a.setConnPool(newConnPool(i%4 + 1))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if pool := a.workerConnPool(); pool.size != cap(pool.free) {
+			t.Fatalf("connPool size %d, holding %d connections", pool.size, cap(pool.free))
+		}
+	}
+	<-done
+	if pool := a.workerConnPool(); pool.size != 4 || pool.waited != int64(time.Second) {
+		t.Errorf("connPool size %d, waited %v, want 4 and 1s", pool.size, time.Duration(pool.waited))
+	}
+}
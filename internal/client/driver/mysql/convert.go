@@ -0,0 +1,350 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// columnConverter converts the values of a column of the row images to the
+// type of the column of the target, as its ColumnConversion says. Converted
+// values are text, which MySQL casts to the type of the column.
+type columnConverter struct {
+	conversion *config.ColumnConversion
+	// ordinal locates the column in row images
+	ordinal    int
+	columnType string
+
+	// min and max bound the values of an integer column
+	min, max *big.Int
+	// precision and scale of a decimal column, unsigned if it can't hold
+	// negative values
+	precision, scale int
+	unsigned         bool
+	// bitSize of a floating-point column, 32 for FLOAT
+	bitSize int
+	// length of a text column in characters, 0 if not bounded
+	length int
+}
+
+var integerBits = map[string]uint{
+	"tinyint":   8,
+	"smallint":  16,
+	"mediumint": 24,
+	"int":       32,
+	"integer":   32,
+	"bigint":    64,
+}
+
+// newColumnConverter returns the converter of conversion to column, whose
+// values are at ordinal in row images. It fails if the column is not of a
+// type the conversion writes.
+func newColumnConverter(conversion *config.ColumnConversion, column *umconf.Column, ordinal int) (*columnConverter, error) {
+	c := &columnConverter{
+		conversion: conversion,
+		ordinal:    ordinal,
+		columnType: column.ColumnType,
+	}
+	// e.g. "decimal(10,2) unsigned"
+	columnType := strings.ToLower(column.ColumnType)
+	name, args := columnType, []int(nil)
+	if i := strings.IndexAny(columnType, "( "); i >= 0 {
+		name = columnType[:i]
+	}
+	if i, j := strings.Index(columnType, "("), strings.Index(columnType, ")"); i >= 0 && j > i {
+		for _, arg := range strings.Split(columnType[i+1:j], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(arg))
+			if err != nil {
+				break
+			}
+			args = append(args, n)
+		}
+	}
+	unsigned := strings.Contains(columnType, "unsigned")
+
+	unmappable := fmt.Errorf("column %v of type %v can't be converted to %v", column.Name, column.ColumnType, conversion.To)
+	switch conversion.To {
+	case config.ConvertToInteger:
+		bits, ok := integerBits[name]
+		if !ok {
+			return nil, unmappable
+		}
+		if unsigned {
+			c.min = big.NewInt(0)
+			c.max = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+		} else {
+			c.min = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), bits-1))
+			c.max = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits-1), big.NewInt(1))
+		}
+	case config.ConvertToDecimal:
+		switch name {
+		case "decimal", "numeric", "dec", "fixed":
+		default:
+			return nil, unmappable
+		}
+		c.precision, c.unsigned = 10, unsigned
+		if len(args) > 0 {
+			c.precision = args[0]
+		}
+		if len(args) > 1 {
+			c.scale = args[1]
+		}
+	case config.ConvertToDouble:
+		switch name {
+		case "double", "real":
+			c.bitSize = 64
+		case "float":
+			// FLOAT(p) is a DOUBLE from 25 bits of precision on
+			c.bitSize = 32
+			if len(args) == 1 && args[0] > 24 {
+				c.bitSize = 64
+			}
+		default:
+			return nil, unmappable
+		}
+	case config.ConvertToString:
+		switch name {
+		case "char", "varchar":
+			if len(args) > 0 {
+				c.length = args[0]
+			}
+		case "tinytext":
+			c.length = 255
+		case "text", "mediumtext", "longtext":
+		default:
+			return nil, unmappable
+		}
+	default:
+		return nil, unmappable
+	}
+	return c, nil
+}
+
+// convert returns value as text of the type of the column, and whether it
+// is not value exactly: value overflows the column, or loses digits or
+// characters. NULL is kept.
+func (c *columnConverter) convert(value interface{}) (result interface{}, lost bool, err error) {
+	if value == nil {
+		return nil, false, nil
+	}
+	if c.conversion.To == config.ConvertToString {
+		text := valueText(value)
+		if c.length > 0 && utf8.RuneCountInString(text) > c.length {
+			runes := []rune(text)
+			return string(runes[:c.length]), true, nil
+		}
+		return text, false, nil
+	}
+
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(valueText(value)))
+	if !ok {
+		return nil, false, fmt.Errorf("%q is not a number", valueText(value))
+	}
+	switch c.conversion.To {
+	case config.ConvertToInteger:
+		// Quo truncates toward zero
+		n := new(big.Int).Quo(r.Num(), r.Denom())
+		lost = !r.IsInt()
+		if n.Cmp(c.min) < 0 {
+			n, lost = c.min, true
+		} else if n.Cmp(c.max) > 0 {
+			n, lost = c.max, true
+		}
+		return n.String(), lost, nil
+	case config.ConvertToDecimal:
+		return c.convertDecimal(r)
+	default: // config.ConvertToDouble
+		f, _ := r.Float64()
+		maxFloat := math.MaxFloat64
+		if c.bitSize == 32 {
+			f32, _ := r.Float32()
+			f, maxFloat = float64(f32), math.MaxFloat32
+		}
+		if math.IsInf(f, 0) {
+			return strconv.FormatFloat(math.Copysign(maxFloat, f), 'g', -1, c.bitSize), true, nil
+		}
+		text := strconv.FormatFloat(f, 'g', -1, c.bitSize)
+		exact, _ := new(big.Rat).SetString(text)
+		return text, exact.Cmp(r) != 0, nil
+	}
+}
+
+// convertDecimal rounds r half away from zero to the scale of the column,
+// and bounds it by its precision
+func (c *columnConverter) convertDecimal(r *big.Rat) (interface{}, bool, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(c.scale)))
+	n, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if new(big.Int).Lsh(new(big.Int).Abs(rem), 1).Cmp(scaled.Denom()) >= 0 {
+		n.Add(n, big.NewInt(int64(scaled.Sign())))
+	}
+	lost := !scaled.IsInt()
+
+	max := new(big.Int).Sub(pow10(c.precision), big.NewInt(1))
+	min := new(big.Int).Neg(max)
+	if c.unsigned {
+		min = big.NewInt(0)
+	}
+	if n.Cmp(min) < 0 {
+		n, lost = min, true
+	} else if n.Cmp(max) > 0 {
+		n, lost = max, true
+	}
+
+	digits := new(big.Int).Abs(n).String()
+	if c.scale > 0 {
+		if len(digits) <= c.scale {
+			digits = strings.Repeat("0", c.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-c.scale] + "." + digits[len(digits)-c.scale:]
+	}
+	if n.Sign() < 0 {
+		digits = "-" + digits
+	}
+	return digits, lost, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// valueText returns the text of a value of a row image
+func valueText(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// newColumnConverters returns the converters of the column conversions of
+// tb to columns, the replicated columns of a target table, whose ordinals
+// locate them in the rows of the source
+func newColumnConverters(tb *config.Table, columns *umconf.ColumnList) ([]*columnConverter, error) {
+	var converters []*columnConverter
+	for _, conversion := range tb.ColumnConversions {
+		if err := conversion.Validate(); err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", tb.TableSchema, tb.TableName, err)
+		}
+		var column *umconf.Column
+		for i := range columns.Columns {
+			if strings.EqualFold(columns.Columns[i].Name, conversion.Column) {
+				column = &columns.Columns[i]
+			}
+		}
+		if column == nil {
+			return nil, fmt.Errorf("%s.%s: column %v to convert does not exist or is not replicated",
+				tb.TableSchema, tb.TableName, conversion.Column)
+		}
+		c, err := newColumnConverter(conversion, column, columns.Ordinals[column.Name])
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", tb.TableSchema, tb.TableName, err)
+		}
+		converters = append(converters, c)
+	}
+	return converters, nil
+}
+
+// convertValues returns a copy of the row image values with the columns of
+// converters converted, values itself without converters. A value the
+// column can't hold exactly fails, unless its conversion truncates it.
+func (a *Applier) convertValues(converters []*columnConverter, values []*interface{}) ([]*interface{}, error) {
+	if len(converters) == 0 || values == nil {
+		return values, nil
+	}
+	converted := make([]*interface{}, len(values))
+	copy(converted, values)
+	for _, c := range converters {
+		value := *values[c.ordinal]
+		result, lost, err := c.convert(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: %v", c.conversion.Column, err)
+		}
+		if lost {
+			if c.conversion.OnLoss != config.OnLossTruncate {
+				return nil, fmt.Errorf("column %v: %v does not fit %v", c.conversion.Column, valueText(value), c.columnType)
+			}
+			a.logger.Warnf("mysql.applier: column %v: %v does not fit %v, writing %v",
+				c.conversion.Column, valueText(value), c.columnType, result)
+		}
+		converted[c.ordinal] = &result
+	}
+	return converted, nil
+}
+
+// convertEvent returns the row event with the columns of its table item
+// transcoded and converted
+func (a *Applier) convertEvent(event binlog.DataEvent) (binlog.DataEvent, error) {
+	tableItem := event.TableItem.(*applierTableItem)
+	if len(tableItem.converters) == 0 && len(tableItem.transcoders) == 0 {
+		return event, nil
+	}
+	for _, values := range []**umconf.ColumnValues{&event.WhereColumnValues, &event.NewColumnValues} {
+		if *values == nil {
+			continue
+		}
+		transcoded, err := a.transcodeValues(tableItem.transcoders, (*values).GetAbstractValues())
+		if err != nil {
+			return event, fmt.Errorf("%s.%s: %v", event.DatabaseName, event.TableName, err)
+		}
+		converted, err := a.convertValues(tableItem.converters, transcoded)
+		if err != nil {
+			return event, fmt.Errorf("%s.%s: %v", event.DatabaseName, event.TableName, err)
+		}
+		*values = &umconf.ColumnValues{AbstractValues: converted, ValuesPointers: converted}
+	}
+	return event, nil
+}
+
+// ValidateColumnConversions checks the column conversions of the tables of
+// doDbs against the target tables that already exist
+func ValidateColumnConversions(db sql.QueryAble, doDbs []*config.DataSource, mapping *sql.NameMapping) error {
+	for _, ds := range doDbs {
+		for _, tb := range ds.Tables {
+			if len(tb.ColumnConversions) == 0 {
+				continue
+			}
+			schema, table := mapping.Table(ds.TableSchema, tb.TableName)
+			tables := []string{table}
+			if tb.Routing != nil {
+				tables = tb.Routing.TargetTables()
+			}
+			for _, table := range tables {
+				columns, err := base.GetTableColumns(db, schema, table)
+				if sql.IsNotExistsError(err) {
+					continue
+				} else if err != nil {
+					return err
+				}
+				if columns, err = tb.ReplicatedColumns(columns); err != nil {
+					return err
+				}
+				if _, err := newColumnConverters(tb, columns); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestColumnConverter(t *testing.T) {
+	tests := []struct {
+		name       string
+		to         string
+		columnType string
+		value      interface{}
+		want       interface{}
+		wantLost   bool
+		wantErr    bool
+	}{
+		{"bigint to decimal", config.ConvertToDecimal, "decimal(20,2)", int64(9007199254740993), "9007199254740993.00", false, false},
+		{"decimal rounds", config.ConvertToDecimal, "decimal(5,2)", []byte("-1.005"), "-1.01", true, false},
+		{"decimal small", config.ConvertToDecimal, "decimal(5,3)", "0.05", "0.050", false, false},
+		{"decimal overflows", config.ConvertToDecimal, "decimal(5,2)", int64(123456), "999.99", true, false},
+		{"decimal unsigned", config.ConvertToDecimal, "decimal(10,0) unsigned", int64(-3), "0", true, false},
+		{"decimal default precision", config.ConvertToDecimal, "decimal", uint64(42), "42", false, false},
+		{"integer", config.ConvertToInteger, "bigint(20)", "12", "12", false, false},
+		{"integer drops the fraction", config.ConvertToInteger, "int(11)", -2.75, "-2", true, false},
+		{"integer overflows", config.ConvertToInteger, "tinyint(4)", int64(300), "127", true, false},
+		{"integer unsigned", config.ConvertToInteger, "int(10) unsigned", int64(-1), "0", true, false},
+		{"not a number", config.ConvertToInteger, "int(11)", "abc", nil, false, true},
+		{"double", config.ConvertToDouble, "double", []byte("0.1"), "0.1", false, false},
+		{"double loses digits", config.ConvertToDouble, "double", int64(9007199254740993), "9.007199254740992e+15", true, false},
+		{"float overflows", config.ConvertToDouble, "float", "1e40", "3.4028235e+38", true, false},
+		{"string", config.ConvertToString, "varchar(10)", int64(42), "42", false, false},
+		{"string truncated", config.ConvertToString, "char(3)", []byte("héllo"), "hél", true, false},
+		{"null", config.ConvertToDecimal, "decimal(5,2)", nil, nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newColumnConverter(&config.ColumnConversion{Column: "c", To: tt.to},
+				&umconf.Column{Name: "c", ColumnType: tt.columnType}, 0)
+			if err != nil {
+				t.Fatalf("newColumnConverter() error = %v", err)
+			}
+			got, lost, err := c.convert(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || lost != tt.wantLost {
+				t.Errorf("convert() = %v, %v, want %v, %v", got, lost, tt.want, tt.wantLost)
+			}
+		})
+	}
+
+	if _, err := newColumnConverter(&config.ColumnConversion{Column: "c", To: config.ConvertToDecimal},
+		&umconf.Column{Name: "c", ColumnType: "varchar(10)"}, 0); err == nil {
+		t.Errorf("newColumnConverter() to a column of another type = nil error")
+	}
+}
+
+func TestApplier_convertValues(t *testing.T) {
+	a := &Applier{logger: log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel))}
+	tb := config.NewTable("db1", "t1")
+	tb.ColumnConversions = []*config.ColumnConversion{{Column: "Amount", To: config.ConvertToDecimal}}
+	columns := umconf.NewColumnList([]umconf.Column{
+		{Name: "id", ColumnType: "int(11)"},
+		{Name: "amount", ColumnType: "decimal(5,2)"},
+	})
+	converters, err := newColumnConverters(tb, columns)
+	if err != nil {
+		t.Fatalf("newColumnConverters() error = %v", err)
+	}
+	row := func(amount interface{}) []*interface{} {
+		var id interface{} = int64(1)
+		return []*interface{}{&id, &amount}
+	}
+
+	values := row(int64(12))
+	got, err := a.convertValues(converters, values)
+	if err != nil || *got[0] != int64(1) || *got[1] != "12.00" {
+		t.Fatalf("convertValues() = %v, %v, want [1 12.00]", got, err)
+	}
+	if *values[1] != int64(12) {
+		t.Errorf("convertValues() changed the row image to %v", *values[1])
+	}
+
+	if _, err := a.convertValues(converters, row(int64(1000))); err == nil {
+		t.Errorf("convertValues() of an overflow = nil error, want the transaction failed")
+	}
+	tb.ColumnConversions[0].OnLoss = config.OnLossTruncate
+	if got, err := a.convertValues(converters, row(int64(1000))); err != nil || *got[1] != "999.99" {
+		t.Errorf("convertValues() of an overflow = %v, %v, want 999.99 truncated", got, err)
+	}
+
+	tb.ColumnConversions = []*config.ColumnConversion{{Column: "price", To: config.ConvertToDecimal}}
+	if _, err := newColumnConverters(tb, columns); err == nil {
+		t.Errorf("newColumnConverters() of an unknown column = nil error")
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+// rewriteCreateTable rewrites statement, a CREATE TABLE as SHOW CREATE TABLE
+// prints it, one definition per line, for the target: the columns tb
+// doesn't replicate are left out with the indexes and foreign keys on them,
+// columns converted to a Type get it, and the secondary indexes and the
+// foreign keys are left out if skipIndexes and skipForeignKeys are set.
+// Other statements are returned as they are.
+func rewriteCreateTable(statement string, tb *config.Table, skipIndexes, skipForeignKeys bool) string {
+	if !skipIndexes && !skipForeignKeys && !rewritesColumns(tb) {
+		return statement
+	}
+	lines := strings.Split(statement, "\n")
+	if len(lines) < 3 || !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(lines[0])), "CREATE TABLE") {
+		return statement
+	}
+	end := len(lines) - 1
+	for end > 0 && !strings.HasPrefix(lines[end], ")") {
+		end--
+	}
+	if end <= 1 {
+		return statement
+	}
+
+	dropped := make(map[string]bool)
+	var defs []string
+	for _, line := range lines[1:end] {
+		def := strings.TrimSuffix(strings.TrimSpace(line), ",")
+		upper := strings.ToUpper(def)
+		switch {
+		case strings.HasPrefix(def, "`"):
+			name, rest := splitQuotedName(def)
+			if tb != nil && !tb.ReplicatesColumn(name) {
+				dropped[strings.ToLower(name)] = true
+				continue
+			}
+			if conversion := tableConversion(tb, name); conversion != nil && conversion.Type != "" {
+				def = def[:len(def)-len(rest)] + " " + conversion.Type + skipColumnType(rest)
+			}
+		case strings.HasPrefix(upper, "PRIMARY KEY"):
+		case strings.HasPrefix(upper, "CONSTRAINT") && strings.Contains(upper, "FOREIGN KEY"):
+			if skipForeignKeys || referencesColumns(def, dropped) {
+				continue
+			}
+		case strings.HasPrefix(upper, "KEY"), strings.HasPrefix(upper, "UNIQUE KEY"),
+			strings.HasPrefix(upper, "FULLTEXT KEY"), strings.HasPrefix(upper, "SPATIAL KEY"):
+			if skipIndexes || referencesColumns(def, dropped) {
+				continue
+			}
+		}
+		defs = append(defs, "  "+def)
+	}
+
+	result := []string{lines[0], strings.Join(defs, ",\n")}
+	return strings.Join(append(result, lines[end:]...), "\n")
+}
+
+// rewritesColumns returns whether rewriteCreateTable changes the columns of
+// the table tb
+func rewritesColumns(tb *config.Table) bool {
+	if tb == nil {
+		return false
+	}
+	if tb.HasColumnFilter() {
+		return true
+	}
+	for _, conversion := range tb.ColumnConversions {
+		if conversion.Type != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func tableConversion(tb *config.Table, column string) *config.ColumnConversion {
+	if tb == nil {
+		return nil
+	}
+	return tb.ColumnConversion(column)
+}
+
+// splitQuotedName splits def into the name quoted with backticks it starts
+// with, unquoted, and the rest
+func splitQuotedName(def string) (string, string) {
+	var name strings.Builder
+	for i := 1; i < len(def); i++ {
+		if def[i] != '`' {
+			name.WriteByte(def[i])
+			continue
+		}
+		if i+1 < len(def) && def[i+1] == '`' {
+			name.WriteByte('`')
+			i++
+			continue
+		}
+		return name.String(), def[i+1:]
+	}
+	return name.String(), ""
+}
+
+// skipColumnType returns what follows the type the column definition rest,
+// after the name, starts with
+func skipColumnType(rest string) string {
+	rest = strings.TrimLeft(rest, " ")
+	depth := 0
+	var quote byte
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ' ' && depth == 0:
+			return rest[i:]
+		}
+	}
+	return ""
+}
+
+// referencesColumns returns whether the index or foreign key def is on one
+// of the columns, named in lower case
+func referencesColumns(def string, columns map[string]bool) bool {
+	if len(columns) == 0 {
+		return false
+	}
+	start := strings.Index(def, "(")
+	if start < 0 {
+		return false
+	}
+	end := strings.Index(def[start:], ")")
+	if end < 0 {
+		return false
+	}
+	for _, part := range strings.Split(def[start+1:start+end], ",") {
+		part = strings.TrimSpace(part)
+		if !strings.HasPrefix(part, "`") {
+			continue
+		}
+		name, _ := splitQuotedName(part)
+		if columns[strings.ToLower(name)] {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTables creates the tables of the target the source replicates to
+// that don't exist yet, from their definitions on the source. srcCfg is the
+// config of the extractor, destCfg the config of the applier, with its
+// renames, column filters and options of the created tables. The target
+// tables of routed tables are not created, they must exist.
+func CreateTables(src, dest *gosql.DB, srcCfg, destCfg *config.MySQLDriverConfig, logger *log.Logger) error {
+	mapping := sql.NewNameMapping(destCfg.ReplicateDoDb)
+	conn, err := dest.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, doDb := range srcCfg.ReplicateDoDb {
+		if doDb.TableSchema == "" {
+			continue
+		}
+		tables := doDb.Tables
+		if len(tables) == 0 {
+			if tables, err = sql.ShowTables(src, doDb.TableSchema, true); err != nil {
+				return err
+			}
+		}
+		for _, tb := range tables {
+			if strings.ToLower(tb.TableType) == "view" {
+				continue
+			}
+			filter := lookupTable(destCfg.ReplicateDoDb, doDb.TableSchema, tb.TableName)
+			if filter != nil && filter.Routing != nil {
+				continue
+			}
+			schema, table := mapping.Table(doDb.TableSchema, tb.TableName)
+			if _, err := base.GetTableColumns(dest, schema, table); err == nil {
+				continue
+			} else if !sql.IsNotExistsError(err) {
+				return err
+			}
+
+			statements, err := base.ShowCreateTable(src, doDb.TableSchema, tb.TableName, false)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %v", doDb.TableSchema, tb.TableName, err)
+			}
+			queries := []string{fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", sql.EscapeName(schema))}
+			var currentSchema string
+			for _, statement := range statements {
+				statement = rewriteCreateTable(statement, filter, destCfg.SkipCreateIndexes, destCfg.SkipCreateForeignKeys)
+				query, schema, err := mapping.RewriteQuery(statement, currentSchema)
+				if err != nil {
+					return fmt.Errorf("%s.%s: %v", doDb.TableSchema, tb.TableName, err)
+				}
+				currentSchema = schema
+				queries = append(queries, query)
+			}
+			for _, query := range queries {
+				if _, err := conn.ExecContext(context.Background(), query); err != nil {
+					return fmt.Errorf("creating %s.%s: %v", schema, table, err)
+				}
+			}
+			logger.Printf("mysql.applier: created %s.%s from %s.%s of the source", schema, table, doDb.TableSchema, tb.TableName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+const createOrders = "CREATE TABLE `orders` (\n" +
+	"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+	"  `customer` int(11) NOT NULL,\n" +
+	"  `amount` double DEFAULT NULL COMMENT 'in cents',\n" +
+	"  `state` enum('new','in progress') NOT NULL,\n" +
+	"  `ssn` varchar(11) DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  UNIQUE KEY `ssn` (`ssn`),\n" +
+	"  KEY `customer` (`customer`,`state`),\n" +
+	"  CONSTRAINT `orders_fk` FOREIGN KEY (`customer`) REFERENCES `customers` (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+func TestRewriteCreateTable(t *testing.T) {
+	tb := config.NewTable("db1", "orders")
+	tb.ExcludeColumns = []string{"SSN"}
+	tb.ColumnConversions = []*config.ColumnConversion{
+		{Column: "amount", To: config.ConvertToDecimal, Type: "decimal(12,2)"},
+		{Column: "state", To: config.ConvertToString, Type: "varchar(16)"},
+	}
+
+	tests := []struct {
+		name            string
+		statement       string
+		tb              *config.Table
+		skipIndexes     bool
+		skipForeignKeys bool
+		want            string
+	}{
+		{"as it is", createOrders, nil, false, false, createOrders},
+		{"not a create table", "USE db1", tb, true, true, "USE db1"},
+		{"filters and types", createOrders, tb, false, false, "CREATE TABLE `orders` (\n" +
+			"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+			"  `customer` int(11) NOT NULL,\n" +
+			"  `amount` decimal(12,2) DEFAULT NULL COMMENT 'in cents',\n" +
+			"  `state` varchar(16) NOT NULL,\n" +
+			"  PRIMARY KEY (`id`),\n" +
+			"  KEY `customer` (`customer`,`state`),\n" +
+			"  CONSTRAINT `orders_fk` FOREIGN KEY (`customer`) REFERENCES `customers` (`id`)\n" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"},
+		{"without indexes and foreign keys", createOrders, nil, true, true, "CREATE TABLE `orders` (\n" +
+			"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+			"  `customer` int(11) NOT NULL,\n" +
+			"  `amount` double DEFAULT NULL COMMENT 'in cents',\n" +
+			"  `state` enum('new','in progress') NOT NULL,\n" +
+			"  `ssn` varchar(11) DEFAULT NULL,\n" +
+			"  PRIMARY KEY (`id`)\n" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteCreateTable(tt.statement, tt.tb, tt.skipIndexes, tt.skipForeignKeys); got != tt.want {
+				t.Errorf("rewriteCreateTable() = \n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnsDiff(t *testing.T) {
+	src := umconf.NewColumnList([]umconf.Column{
+		{Name: "id", ColumnType: "int(11)"},
+		{Name: "amount", ColumnType: "double"},
+		{Name: "name", ColumnType: "varchar(10)"},
+		{Name: "ssn", ColumnType: "varchar(11)"},
+	})
+	dest := umconf.NewColumnList([]umconf.Column{
+		{Name: "ID", ColumnType: "int"},
+		{Name: "amount", ColumnType: "decimal(12,2)"},
+		{Name: "name", ColumnType: "varchar(20)"},
+		{Name: "ssn", ColumnType: "char(11)"},
+		{Name: "note", ColumnType: "text", Nullable: true},
+		{Name: "region", ColumnType: "int"},
+	})
+	tb := config.NewTable("db1", "t1")
+	tb.ExcludeColumns = []string{"ssn"}
+	tb.ColumnConversions = []*config.ColumnConversion{{Column: "amount", To: config.ConvertToDecimal}}
+
+	want := []string{
+		"name varchar(10) on the source, varchar(20) on the target",
+		"region int only on the target is NOT NULL without a default",
+	}
+	if got := columnsDiff(src, dest, tb); !reflect.DeepEqual(got, want) {
+		t.Errorf("columnsDiff() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// writesetHistorySize bounds the number of keys a dependencyTracker
+// remembers. Past it, the history starts over and the next transactions
+// depend on all the previous ones.
+const writesetHistorySize = 25000
+
+// dependencyTracker numbers the transactions the applier receives and finds
+// the last one each of them depends on, from the keys they write. It stands
+// in for the logical clock of the source, so the MtsManager applies in
+// parallel transactions that don't write the same tables or rows.
+type dependencyTracker struct {
+	// byRow is set to track rows rather than tables
+	byRow bool
+
+	// seq is the sequence number of the last transaction
+	seq int64
+
+	// floor is a sequence number all the following transactions depend on
+	floor int64
+
+	// lastWriters maps a key to the last transaction writing it
+	lastWriters map[uint64]int64
+	maxKeys     int
+}
+
+// newDependencyTracker returns the tracker of the dependency tracking mode,
+// or nil to follow the logical clock of the source.
+func newDependencyTracker(mode string) (*dependencyTracker, error) {
+	switch mode {
+	case config.DependencyTrackingCommitOrder:
+		return nil, nil
+	case config.DependencyTrackingTable, config.DependencyTrackingWriteset:
+		return &dependencyTracker{
+			byRow:       mode == config.DependencyTrackingWriteset,
+			lastWriters: make(map[uint64]int64),
+			maxKeys:     writesetHistorySize,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown DependencyTracking %q", mode)
+	}
+}
+
+// track numbers a transaction writing keys. It returns the sequence number
+// of the transaction and of the last one it depends on. A serial
+// transaction depends on all the previous ones, and all the following ones
+// depend on it.
+func (d *dependencyTracker) track(keys []uint64, serial bool) (lastCommitted, seq int64) {
+	d.seq++
+	seq = d.seq
+
+	if serial {
+		d.lastWriters = make(map[uint64]int64)
+		d.floor = seq
+		return seq - 1, seq
+	}
+
+	lastCommitted = d.floor
+	for _, key := range keys {
+		if writer, ok := d.lastWriters[key]; ok && writer > lastCommitted {
+			lastCommitted = writer
+		}
+	}
+
+	if len(d.lastWriters)+len(keys) > d.maxKeys {
+		d.lastWriters = make(map[uint64]int64)
+		d.floor = seq
+		return lastCommitted, seq
+	}
+	for _, key := range keys {
+		d.lastWriters[key] = seq
+	}
+	return lastCommitted, seq
+}
+
+// writeset returns the keys of the tables or rows entry writes, and
+// whether it must be applied alone, which DDL must. The table items of the
+// events must be set.
+func (d *dependencyTracker) writeset(entry *binlog.BinlogEntry) (keys []uint64, serial bool) {
+	for i := range entry.Events {
+		event := &entry.Events[i]
+		if event.DML == binlog.NotDML {
+			return nil, true
+		}
+
+		tableItem := event.TableItem.(*applierTableItem)
+		if !d.byRow || tableItem.rowKeyOrdinals == nil {
+			keys = append(keys, writesetKey(event.DatabaseName, event.TableName, nil, nil))
+			continue
+		}
+		// An update writes both the row it reads and the one it leaves
+		if event.WhereColumnValues != nil {
+			keys = append(keys, writesetKey(event.DatabaseName, event.TableName,
+				tableItem.rowKeyOrdinals, event.WhereColumnValues.GetAbstractValues()))
+		}
+		if event.NewColumnValues != nil {
+			keys = append(keys, writesetKey(event.DatabaseName, event.TableName,
+				tableItem.rowKeyOrdinals, event.NewColumnValues.GetAbstractValues()))
+		}
+	}
+	return keys, false
+}
+
+// writesetKey hashes a table, or a row of it if ordinals locate its
+// primary key in values
+func writesetKey(schema, table string, ordinals []int, values []*interface{}) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00", schema, table)
+	for _, ordinal := range ordinals {
+		if ordinal < len(values) && values[ordinal] != nil {
+			fmt.Fprintf(h, "%v", *values[ordinal])
+		}
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// rowKeyOrdinals returns the ordinals of the primary key columns, or nil if
+// the rows of the table can't be told apart by them: there is no primary
+// key, a string column of it may compare equal to another value, or
+// another unique key may make two rows conflict.
+func rowKeyOrdinals(columns *umconf.ColumnList, otherUniqueKeys bool) []int {
+	if otherUniqueKeys {
+		return nil
+	}
+	var ordinals []int
+	for _, col := range columns.ColumnList() {
+		if !col.IsPk() {
+			continue
+		}
+		colType := strings.ToLower(col.ColumnType)
+		for _, t := range []string{"char", "text", "enum", "set("} {
+			if strings.Contains(colType, t) {
+				return nil
+			}
+		}
+		ordinals = append(ordinals, columns.Ordinals[col.Name])
+	}
+	return ordinals
+}
+
+// hasOtherUniqueKeys returns whether schema.table has a unique key besides
+// the primary key
+func hasOtherUniqueKeys(db sql.QueryAble, schema, table string) (bool, error) {
+	query := `select count(*) from information_schema.statistics
+		where table_schema = ? and table_name = ? and non_unique = 0 and index_name <> 'PRIMARY'`
+	var n int
+	if err := db.QueryRow(query, schema, table).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
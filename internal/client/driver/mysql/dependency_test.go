@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func Test_dependencyTracker_track(t *testing.T) {
+	d, err := newDependencyTracker(config.DependencyTrackingTable)
+	if err != nil {
+		t.Fatalf("newDependencyTracker() error = %v", err)
+	}
+	d.maxKeys = 3
+
+	tests := []struct {
+		name              string
+		keys              []uint64
+		serial            bool
+		wantLastCommitted int64
+	}{
+		{"first", []uint64{1}, false, 0},
+		{"independent", []uint64{2}, false, 0},
+		{"depends on the last writer", []uint64{1, 2}, false, 2},
+		{"serial", nil, true, 3},
+		{"after serial", []uint64{1}, false, 4},
+		{"independent after serial", []uint64{2}, false, 4},
+		{"history overflow", []uint64{3, 4}, false, 4},
+		{"after overflow", []uint64{1}, false, 7},
+	}
+	for i, tt := range tests {
+		lastCommitted, seq := d.track(tt.keys, tt.serial)
+		if lastCommitted != tt.wantLastCommitted || seq != int64(i+1) {
+			t.Errorf("%s: dependencyTracker.track() = %d, %d, want %d, %d",
+				tt.name, lastCommitted, seq, tt.wantLastCommitted, i+1)
+		}
+	}
+
+	if d, err := newDependencyTracker(config.DependencyTrackingCommitOrder); d != nil || err != nil {
+		t.Errorf("newDependencyTracker(commit_order) = %v, %v, want nil", d, err)
+	}
+	if _, err := newDependencyTracker("row"); err == nil {
+		t.Errorf("newDependencyTracker(row) error = nil")
+	}
+}
+
+func Test_dependencyTracker_writeset(t *testing.T) {
+	columns := umconf.NewColumnList([]umconf.Column{
+		{Name: "id", ColumnType: "int(11)", Key: "PRI"},
+		{Name: "name", ColumnType: "varchar(20)"},
+	})
+	item := &applierTableItem{columns: columns, rowKeyOrdinals: rowKeyOrdinals(columns, false)}
+	if !reflect.DeepEqual(item.rowKeyOrdinals, []int{0}) {
+		t.Fatalf("rowKeyOrdinals() = %v, want [0]", item.rowKeyOrdinals)
+	}
+	row := func(id int, name string) *umconf.ColumnValues {
+		return umconf.ToColumnValues([]interface{}{id, name})
+	}
+	event := func(dml binlog.EventDML, where, new *umconf.ColumnValues) binlog.DataEvent {
+		return binlog.DataEvent{DatabaseName: "db", TableName: "t", DML: dml,
+			WhereColumnValues: where, NewColumnValues: new, TableItem: item}
+	}
+
+	byRow, _ := newDependencyTracker(config.DependencyTrackingWriteset)
+	byTable, _ := newDependencyTracker(config.DependencyTrackingTable)
+
+	insert := &binlog.BinlogEntry{Events: []binlog.DataEvent{event(binlog.InsertDML, nil, row(1, "a"))}}
+	update := &binlog.BinlogEntry{Events: []binlog.DataEvent{event(binlog.UpdateDML, row(1, "a"), row(2, "b"))}}
+	other := &binlog.BinlogEntry{Events: []binlog.DataEvent{event(binlog.DeleteDML, row(3, "c"), nil)}}
+
+	insertKeys, _ := byRow.writeset(insert)
+	updateKeys, _ := byRow.writeset(update)
+	otherKeys, _ := byRow.writeset(other)
+	if len(updateKeys) != 2 || updateKeys[0] != insertKeys[0] || otherKeys[0] == insertKeys[0] || otherKeys[0] == updateKeys[1] {
+		t.Errorf("dependencyTracker.writeset() by row = %v, %v, %v", insertKeys, updateKeys, otherKeys)
+	}
+
+	insertKeys, _ = byTable.writeset(insert)
+	otherKeys, _ = byTable.writeset(other)
+	if insertKeys[0] != otherKeys[0] {
+		t.Errorf("dependencyTracker.writeset() by table = %v, %v", insertKeys, otherKeys)
+	}
+
+	ddl := &binlog.BinlogEntry{Events: []binlog.DataEvent{{DML: binlog.NotDML, Query: "create table t2 (id int)"}}}
+	if _, serial := byRow.writeset(ddl); !serial {
+		t.Errorf("dependencyTracker.writeset() of DDL isn't serial")
+	}
+
+	// String keys may compare equal to other values
+	strColumns := umconf.NewColumnList([]umconf.Column{{Name: "code", ColumnType: "varchar(8)", Key: "PRI"}})
+	if got := rowKeyOrdinals(strColumns, false); got != nil {
+		t.Errorf("rowKeyOrdinals() of a string key = %v, want nil", got)
+	}
+	if got := rowKeyOrdinals(columns, true); got != nil {
+		t.Errorf("rowKeyOrdinals() with other unique keys = %v, want nil", got)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+)
+
+// A resumed copy reads the rows left at a new snapshot, but the binlog is
+// still streamed from the snapshot the copy started at, so that the rows
+// copied before miss no transaction. The transactions between the two
+// snapshots are then replayed over rows that may already hold them: the
+// applier writes their row images by primary key rather than matching the
+// rows of the target, which converges whatever the rows held.
+
+// dumpCheckpoint records how far the copy went as the target commits its
+// chunks, and tells the transactions a resumed copy may already hold
+type dumpCheckpoint struct {
+	mutex      sync.Mutex
+	checkpoint *models.DumpCheckpoint
+	// resumedGtid is the GTID set of the snapshot of a resumed copy, nil if
+	// the copy was not resumed
+	resumedGtid *gomysql.MysqlGTIDSet
+}
+
+// chunkCopied records the copy of the chunk of entry
+func (c *dumpCheckpoint) chunkCopied(entry *DumpEntry) {
+	if entry.TableName == "" {
+		// Structure entries copy no row
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.checkpoint == nil || c.checkpoint.Gtid != entry.Gtid {
+		// The copy started over
+		c.checkpoint = &models.DumpCheckpoint{Gtid: entry.Gtid}
+	}
+	tc := c.checkpoint.Table(entry.TableSchema, entry.TableName)
+	if tc == nil && entry.LastMaxVals == nil && !entry.LastChunk {
+		// A parallel copy sends rows of a table before all those before
+		// them, a resumed copy then copies the table from its start
+		return
+	}
+	if tc == nil {
+		tc = &models.TableCheckpoint{TableSchema: entry.TableSchema, TableName: entry.TableName}
+		c.checkpoint.Tables = append(c.checkpoint.Tables, tc)
+	}
+	tc.LastMaxVals = entry.LastMaxVals
+	tc.Done = entry.LastChunk
+}
+
+// get returns a copy of the checkpoint, nil if no chunk was copied
+func (c *dumpCheckpoint) get() *models.DumpCheckpoint {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.checkpoint == nil {
+		return nil
+	}
+	checkpoint := &models.DumpCheckpoint{Gtid: c.checkpoint.Gtid}
+	for _, tc := range c.checkpoint.Tables {
+		table := *tc
+		checkpoint.Tables = append(checkpoint.Tables, &table)
+	}
+	return checkpoint
+}
+
+// setResumedGtid sets the GTID set of the snapshot of the resumed copy
+func (c *dumpCheckpoint) setResumedGtid(gtid string) error {
+	set, err := gomysql.ParseMysqlGTIDSet(gtid)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.resumedGtid = set.(*gomysql.MysqlGTIDSet)
+	return nil
+}
+
+// replaying tells whether the transaction at coordinates is one the
+// resumed copy may already hold
+func (c *dumpCheckpoint) replaying(coordinates base.BinlogCoordinateTx) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.resumedGtid == nil {
+		return false
+	}
+	tx := &gomysql.MysqlGTIDSet{Sets: make(map[string]*gomysql.UUIDSet)}
+	tx.AddSet(gomysql.NewUUIDSet(coordinates.SID, gomysql.Interval{Start: coordinates.GNO, Stop: coordinates.GNO + 1}))
+	return c.resumedGtid.Contain(tx)
+}
+
+// replayRow applies the row event of tx by writing its images by primary
+// key, whatever the row of the target holds. It returns the change of the
+// row count of the target.
+func (a *Applier) replayRow(tx *gosql.Tx, event binlog.DataEvent, workerIdx int) (int64, error) {
+	// Changes made twice to a document don't make the same document
+	event.JSONUpdates = nil
+	tableItem := event.TableItem.(*applierTableItem)
+	key := newRowKey(tableItem.columns, "")
+	if len(key.columns) == 0 {
+		// The extractor only resumes copies whose tables without a primary
+		// key were copied at the first snapshot
+		return a.applyRow(event, workerIdx)
+	}
+	schema, table := a.nameMapping.Table(event.DatabaseName, event.TableName)
+	if tableItem.targetTable != "" {
+		table = tableItem.targetTable
+	}
+	var before, after []*interface{}
+	if event.WhereColumnValues != nil {
+		before = event.WhereColumnValues.GetAbstractValues()
+	}
+	if event.NewColumnValues != nil {
+		after = event.NewColumnValues.GetAbstractValues()
+	}
+	return a.overwriteRow(tx, event, key, tableItem.columns, schema, table, before, after)
+}
+
+// checkResumable returns why the copy can't resume from the checkpoint, nil
+// if it can
+func checkResumable(cfg *config.MySQLDriverConfig, doDbs []*config.DataSource, checkpoint *models.DumpCheckpoint) error {
+	if !cfg.ApproveHeterogeneous {
+		return fmt.Errorf("ApproveHeterogeneous is false")
+	}
+	for _, db := range doDbs {
+		for _, tb := range db.Tables {
+			tc := checkpoint.Table(tb.TableSchema, tb.TableName)
+			if tc != nil && tc.Done {
+				continue
+			}
+			// The transactions the rows left may already hold are replayed
+			// by primary key
+			if tb.UseUniqueKey == nil || !tb.UseUniqueKey.IsPrimary() {
+				return fmt.Errorf("%s.%s has no primary key", tb.TableSchema, tb.TableName)
+			}
+			if tc != nil && len(tc.LastMaxVals) != len(tb.UseUniqueKey.Columns.Columns) {
+				return fmt.Errorf("the primary key of %s.%s changed", tb.TableSchema, tb.TableName)
+			}
+		}
+	}
+	return nil
+}
+
+// resumeTable sets the copy of the table tb to start after the last row of
+// it the checkpoint holds. It returns whether rows of the table are left to
+// copy.
+func resumeTable(tb *config.Table, checkpoint *models.DumpCheckpoint) bool {
+	tc := checkpoint.Table(tb.TableSchema, tb.TableName)
+	if tc == nil {
+		return true
+	}
+	if tc.Done {
+		return false
+	}
+	copy(tb.UseUniqueKey.LastMaxVals, tc.LastMaxVals)
+	tb.Iteration = 1
+	return true
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/internal/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+func newDumpTable(table string, key string) *config.Table {
+	tb := &config.Table{TableSchema: "db", TableName: table, Where: "true"}
+	if key != "" {
+		columns := umconf.ParseColumnList(key)
+		tb.UseUniqueKey = &umconf.UniqueKey{
+			Name:        "PRIMARY",
+			Columns:     *columns,
+			LastMaxVals: make([]string, len(columns.Columns)),
+		}
+	}
+	return tb
+}
+
+func TestDumpCheckpoint(t *testing.T) {
+	const first = "00000000-0000-0000-0000-000000000001:1-10"
+	const resumedAt = "00000000-0000-0000-0000-000000000001:1-15"
+
+	// The job stops in the middle of the copy of t2, t3 not started
+	var c dumpCheckpoint
+	if c.get() != nil {
+		t.Fatalf("get() = %v before any chunk", c.get())
+	}
+	for _, entry := range []*DumpEntry{
+		{}, // structure
+		{TableSchema: "db", TableName: "t1", Gtid: first, LastMaxVals: []string{"10"}},
+		{TableSchema: "db", TableName: "t1", Gtid: first, LastMaxVals: []string{"20"}, LastChunk: true},
+		{TableSchema: "db", TableName: "t2", Gtid: first, LastMaxVals: []string{"'a'", "5"}},
+	} {
+		c.chunkCopied(entry)
+	}
+	checkpoint := c.get()
+	want := &models.DumpCheckpoint{
+		Gtid: first,
+		Tables: []*models.TableCheckpoint{
+			{TableSchema: "db", TableName: "t1", LastMaxVals: []string{"20"}, Done: true},
+			{TableSchema: "db", TableName: "t2", LastMaxVals: []string{"'a'", "5"}},
+		},
+	}
+	if !reflect.DeepEqual(checkpoint, want) {
+		t.Fatalf("checkpoint = %+v, want %+v", checkpoint, want)
+	}
+
+	// The restarted job resumes the copy
+	t1, t2, t3 := newDumpTable("t1", ""), newDumpTable("t2", "name,id"), newDumpTable("t3", "id")
+	doDbs := []*config.DataSource{{TableSchema: "db", Tables: []*config.Table{t1, t2, t3}}}
+	cfg := &config.MySQLDriverConfig{ApproveHeterogeneous: true}
+	if err := checkResumable(cfg, doDbs, checkpoint); err != nil {
+		t.Fatalf("checkResumable() = %v", err)
+	}
+	if resumeTable(t1, checkpoint) {
+		t.Errorf("resumeTable(t1) = true, the table was copied")
+	}
+	if !resumeTable(t2, checkpoint) || !resumeTable(t3, checkpoint) {
+		t.Errorf("resumeTable() = false, rows are left")
+	}
+	if got, want := uniqueKeyRange(t2), "((`name` > 'a')) or ((`name` = 'a') and (`id` > 5))"; got != want {
+		t.Errorf("uniqueKeyRange(t2) = %q, want %q", got, want)
+	}
+	if got := uniqueKeyRange(t3); got != "true" {
+		t.Errorf("uniqueKeyRange(t3) = %q, want true", got)
+	}
+
+	// Tables without a primary key can only be resumed once copied
+	noKey := newDumpTable("t3", "")
+	doDbs[0].Tables[2] = noKey
+	if err := checkResumable(cfg, doDbs, checkpoint); err == nil {
+		t.Errorf("checkResumable() = nil with t3 without a primary key")
+	}
+	doDbs[0].Tables[2] = t3
+	if err := checkResumable(&config.MySQLDriverConfig{}, doDbs, checkpoint); err == nil {
+		t.Errorf("checkResumable() = nil without ApproveHeterogeneous")
+	}
+
+	// The binlog is streamed from the first snapshot, and the transactions
+	// up to the one the copy resumed at replayed
+	if err := c.setResumedGtid(resumedAt); err != nil {
+		t.Fatal(err)
+	}
+	sid := uuid.FromStringOrNil("00000000-0000-0000-0000-000000000001")
+	for gno, replayed := range map[int64]bool{11: true, 15: true, 16: false} {
+		if got := c.replaying(base.BinlogCoordinateTx{SID: sid, GNO: gno}); got != replayed {
+			t.Errorf("replaying(%d) = %v, want %v", gno, got, replayed)
+		}
+	}
+
+	// A copy started over drops the checkpoint
+	c.chunkCopied(&DumpEntry{TableSchema: "db", TableName: "t1", Gtid: resumedAt, LastMaxVals: []string{"10"}})
+	if checkpoint := c.get(); checkpoint.Gtid != resumedAt || len(checkpoint.Tables) != 1 {
+		t.Errorf("checkpoint = %+v after the copy started over", checkpoint)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	// dumpFrameRaw marks a message of the copy sent as is
+	dumpFrameRaw byte = 0x00
+	// dumpFrameSnappy marks a message of the copy which is snappy
+	// compressed. Messages encoded by Encode, compressed too, begin with
+	// the length of the gob, never 0 or 1.
+	dumpFrameSnappy byte = 0x01
+
+	// dumpCompressionThreshold is the message size below which the copy
+	// doesn't bother compressing, as the RPCs between the servers
+	dumpCompressionThreshold = 1024
+)
+
+// dumpFrames is the reply of the applier to a message of the copy,
+// announcing the frames it decodes. An older applier replies nothing, and
+// only decodes messages encoded by Encode.
+var dumpFrames = []byte{dumpFrameRaw, dumpFrameSnappy}
+
+// Bits of dumpStat.peerFrames
+const (
+	// peerFramed is set once the applier announced it decodes frames
+	peerFramed int32 = 1 << iota
+	// peerSnappy is set if it decodes dumpFrameSnappy
+	peerSnappy
+)
+
+// dumpCompression decides whether the extractor compresses the rows it
+// copies, by DumpCompression
+func dumpCompression(cfg *config.MySQLDriverConfig, localNatsAddr string) (bool, error) {
+	switch cfg.DumpCompression {
+	case "", config.DumpCompressionAuto:
+		// The rows only cross the network if the applier runs on another
+		// node, whose NATS server the extractor publishes to
+		return localNatsAddr == "" || cfg.NatsAddr != localNatsAddr, nil
+	case config.DumpCompressionSnappy:
+		return true, nil
+	case config.DumpCompressionNone:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown DumpCompression %q", cfg.DumpCompression)
+	}
+}
+
+// dumpStat counts the bytes of the copy, before and after compression
+type dumpStat struct {
+	compressed bool
+	// peerFrames tells the frames the applier decodes, peerFramed and
+	// peerSnappy bits, it is accessed atomically
+	peerFrames int32
+	// start is when the copy started in unix nanoseconds, 0 before, and
+	// elapsed how long it took in nanoseconds, 0 while it runs
+	start     int64
+	elapsed   int64
+	bytes     int64
+	wireBytes int64
+}
+
+// begin records the copy starts, compressed or not
+func (s *dumpStat) begin(compressed bool) {
+	s.compressed = compressed
+	atomic.StoreInt64(&s.start, time.Now().UnixNano())
+}
+
+// encodeDumpMsg encodes v, compressed if the copy is, the applier decodes
+// it and it saves space. Until the applier announced the frames it decodes
+// v is encoded by Encode, which an older one expects.
+func (s *dumpStat) encodeDumpMsg(v interface{}) ([]byte, error) {
+	peer := atomic.LoadInt32(&s.peerFrames)
+	b := new(bytes.Buffer)
+	if peer&peerFramed != 0 {
+		b.WriteByte(dumpFrameRaw)
+	}
+	if err := gob.NewEncoder(b).Encode(v); err != nil {
+		return nil, err
+	}
+	msg := b.Bytes()
+	size := len(msg)
+	switch {
+	case peer&peerFramed == 0:
+		msg = snappy.Encode(nil, msg)
+	case s.compressed && peer&peerSnappy != 0 && size-1 >= dumpCompressionThreshold:
+		size--
+		if encoded := snappy.Encode(nil, msg[1:]); len(encoded) < size {
+			msg = append([]byte{dumpFrameSnappy}, encoded...)
+		}
+	default:
+		size--
+	}
+	atomic.AddInt64(&s.bytes, int64(size))
+	atomic.AddInt64(&s.wireBytes, int64(len(msg)))
+	return msg, nil
+}
+
+// ack records the frames the applier announced in its reply to a message
+// of the copy
+func (s *dumpStat) ack(reply []byte) {
+	if len(reply) == 0 {
+		return
+	}
+	peer := peerFramed
+	if bytes.IndexByte(reply, dumpFrameSnappy) >= 0 {
+		peer |= peerSnappy
+	}
+	atomic.StoreInt32(&s.peerFrames, peer)
+}
+
+// done records the copy is complete
+func (s *dumpStat) done() {
+	atomic.StoreInt64(&s.elapsed, time.Now().UnixNano()-atomic.LoadInt64(&s.start))
+}
+
+// stat returns the bytes of the copy so far, and how long it took
+func (s *dumpStat) stat() *models.DumpStat {
+	start := atomic.LoadInt64(&s.start)
+	if start == 0 {
+		return nil
+	}
+	elapsed := time.Duration(atomic.LoadInt64(&s.elapsed))
+	if elapsed == 0 {
+		elapsed = time.Duration(time.Now().UnixNano() - start)
+	}
+	// An older applier only decodes compressed messages
+	peer := atomic.LoadInt32(&s.peerFrames)
+	return &models.DumpStat{
+		Compressed: peer&peerFramed == 0 || s.compressed && peer&peerSnappy != 0,
+		Bytes:      atomic.LoadInt64(&s.bytes),
+		WireBytes:  atomic.LoadInt64(&s.wireBytes),
+		Seconds:    elapsed.Seconds(),
+	}
+}
+
+// decodeDumpMsg decodes a message of the copy into vPtr, whether the
+// extractor compressed it or not
+func decodeDumpMsg(data []byte, vPtr interface{}) error {
+	if len(data) == 0 {
+		return fmt.Errorf("empty message of the copy")
+	}
+	switch data[0] {
+	case dumpFrameRaw:
+		return gob.NewDecoder(bytes.NewReader(data[1:])).Decode(vPtr)
+	case dumpFrameSnappy:
+		msg, err := snappy.Decode(nil, data[1:])
+		if err != nil {
+			return err
+		}
+		return gob.NewDecoder(bytes.NewReader(msg)).Decode(vPtr)
+	default:
+		// Sent by an extractor encoding with Encode
+		return Decode(data, vPtr)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+func TestDumpCompression(t *testing.T) {
+	tests := []struct {
+		compression, natsAddr, local string
+		want, wantErr                bool
+	}{
+		{"", "10.0.0.2:8193", "10.0.0.1:8193", true, false},
+		{"auto", "10.0.0.1:8193", "10.0.0.1:8193", false, false},
+		{"auto", "10.0.0.1:8193", "", true, false},
+		{"snappy", "10.0.0.1:8193", "10.0.0.1:8193", true, false},
+		{"none", "10.0.0.2:8193", "10.0.0.1:8193", false, false},
+		{"gzip", "", "", false, true},
+	}
+	for _, tt := range tests {
+		cfg := &config.MySQLDriverConfig{DumpCompression: tt.compression, NatsAddr: tt.natsAddr}
+		got, err := dumpCompression(cfg, tt.local)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("dumpCompression(%q, %q, %q) = %v, %v, want %v", tt.compression, tt.natsAddr, tt.local, got, err, tt.want)
+		}
+	}
+}
+
+func TestDumpMsg(t *testing.T) {
+	entry := &DumpEntry{TableSchema: "db", TableName: "tb"}
+	for i := 0; i < 100; i++ {
+		var v interface{} = []byte(strings.Repeat("value", 10))
+		entry.ValuesX = append(entry.ValuesX, []*interface{}{&v})
+	}
+	tests := []struct {
+		name       string
+		compressed bool
+		reply      []byte
+		wantFrame  byte
+	}{
+		{"raw", false, dumpFrames, dumpFrameRaw},
+		{"snappy", true, dumpFrames, dumpFrameSnappy},
+		{"applier without snappy", true, []byte{dumpFrameRaw}, dumpFrameRaw},
+	}
+	for _, tt := range tests {
+		s := &dumpStat{}
+		s.begin(tt.compressed)
+		s.ack(tt.reply)
+		msg, err := s.encodeDumpMsg(entry)
+		if err != nil {
+			t.Fatalf("encodeDumpMsg() error = %v", err)
+		}
+		if msg[0] != tt.wantFrame {
+			t.Errorf("encodeDumpMsg() %s frame = %d, want %d", tt.name, msg[0], tt.wantFrame)
+		}
+		got := &DumpEntry{}
+		if err := decodeDumpMsg(msg, got); err != nil {
+			t.Fatalf("decodeDumpMsg() error = %v", err)
+		}
+		if got.TableName != "tb" || len(got.ValuesX) != 100 || string((*got.ValuesX[99][0]).([]byte)) != strings.Repeat("value", 10) {
+			t.Errorf("decodeDumpMsg() %s = %s with %d rows", tt.name, got.TableName, len(got.ValuesX))
+		}
+		s.done()
+		stat := s.stat()
+		compressed := tt.wantFrame == dumpFrameSnappy
+		if stat.Compressed != compressed || stat.WireBytes != int64(len(msg)) || compressed != (stat.WireBytes < stat.Bytes) {
+			t.Errorf("stat() %s = %+v, sent %d bytes", tt.name, stat, len(msg))
+		}
+	}
+
+	// Until the applier announced the frames, whatever the compression,
+	// the messages are those an older one decodes
+	s := &dumpStat{}
+	s.begin(false)
+	msg, err := s.encodeDumpMsg(entry)
+	if err != nil {
+		t.Fatalf("encodeDumpMsg() error = %v", err)
+	}
+	got := &DumpEntry{}
+	if err := Decode(msg, got); err != nil || len(got.ValuesX) != 100 {
+		t.Errorf("Decode() of encodeDumpMsg() before any reply = %d rows, %v", len(got.ValuesX), err)
+	}
+	if stat := s.stat(); !stat.Compressed || stat.WireBytes != int64(len(msg)) {
+		t.Errorf("stat() before any reply = %+v, sent %d bytes", stat, len(msg))
+	}
+	s.ack(nil)
+	if msg, err := s.encodeDumpMsg(entry); err != nil || Decode(msg, &DumpEntry{}) != nil {
+		t.Errorf("encodeDumpMsg() after an empty reply isn't decoded by Decode(), %v", err)
+	}
+
+	legacy, err := Encode(entry)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got = &DumpEntry{}
+	if err := decodeDumpMsg(legacy, got); err != nil || len(got.ValuesX) != 100 {
+		t.Errorf("decodeDumpMsg() of Encode() = %d rows, %v", len(got.ValuesX), err)
+	}
+}
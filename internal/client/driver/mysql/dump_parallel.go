@@ -0,0 +1,424 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	usql "github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// A parallel copy splits a table in ranges of the first column of its
+// unique key, copied by as many connections as DumpParallelism, each
+// reading from its own snapshot. The snapshots are all opened while no
+// transaction commits, so they read the same rows as the snapshot of the
+// copy. The chunks are sent as they are read rather than in the order of
+// the key: each carries as LastMaxVals the key of the last row of the
+// table up to which all the rows were sent, which a resumed copy starts
+// after, copying again the rows sent after it.
+
+const (
+	// dumpRangesPerConnection is how many ranges a table is split in for
+	// each connection copying it, so that those done first take over the
+	// rest of the copy
+	dumpRangesPerConnection = 4
+	// dumpKeySamples is how many parts of the key the rows are estimated
+	// in for each range, to balance the rows of the ranges
+	dumpKeySamples = 8
+	// maxDumpKeySamples is how many parts of the key the rows are
+	// estimated in at most
+	maxDumpKeySamples = 256
+)
+
+// beginDumpSnapshots begins n transactions with a consistent snapshot on
+// as many connections, for a parallel copy. They read the same rows as
+// the snapshot of the copy if no transaction commits meanwhile, which the
+// caller checks.
+func (e *Extractor) beginDumpSnapshots(n int) ([]*gosql.Tx, error) {
+	var txs []*gosql.Tx
+	for i := 0; i < n; i++ {
+		tx, err := e.db.Begin()
+		if err != nil {
+			rollbackDumpSnapshots(txs)
+			return nil, err
+		}
+		txs = append(txs, tx)
+		query := "START TRANSACTION WITH CONSISTENT SNAPSHOT"
+		if _, err := tx.Exec(query); err != nil {
+			rollbackDumpSnapshots(txs)
+			return nil, fmt.Errorf("exec [%s] error: %v", query, err)
+		}
+	}
+	return txs, nil
+}
+
+// rollbackDumpSnapshots ends the transactions of the snapshots of a
+// parallel copy, which only read
+func rollbackDumpSnapshots(txs []*gosql.Tx) {
+	for _, tx := range txs {
+		tx.Rollback()
+	}
+}
+
+// dumpRange is a range of the key of a table a parallel copy reads with
+// one connection, chunk after chunk
+type dumpRange struct {
+	index int
+	// dumper reads the chunks of the range, after the last row read
+	dumper *dumper
+	// failures is how many times reading a chunk of the range failed
+	failures int
+	done     bool
+	// lastMaxVals is the key of the last row of the range sent, nil if
+	// none was
+	lastMaxVals []string
+}
+
+// dumpRangeChunk is a chunk of a range read by a connection of a parallel
+// copy, or the error reading it
+type dumpRangeChunk struct {
+	r     *dumpRange
+	entry *DumpEntry
+	// last tells the range has no rows after those of entry
+	last bool
+	err  error
+	// lost tells the connection failed, with its snapshot, so it reads no
+	// more chunks
+	lost bool
+}
+
+// dumpRangeWorker reads the chunks of the ranges of queue from db, the
+// transaction of a snapshot, to chunks. It stops after failing to read a
+// chunk if db is lost.
+func dumpRangeWorker(db usql.QueryAble, queue <-chan *dumpRange, chunks chan<- *dumpRangeChunk, stop <-chan struct{}) {
+	for r := range queue {
+		r.dumper.db = db
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			chunk := &dumpRangeChunk{r: r}
+			chunk.entry, chunk.err = readDumpRangeChunk(r.dumper)
+			if chunk.err != nil {
+				var one int
+				chunk.lost = db.QueryRow("select 1").Scan(&one) != nil
+			} else {
+				chunk.last = int64(len(chunk.entry.ValuesX)) < r.dumper.chunkSize
+			}
+			select {
+			case chunks <- chunk:
+			case <-stop:
+				return
+			}
+			if chunk.err != nil {
+				if chunk.lost {
+					return
+				}
+				// Another connection may take the range over meanwhile
+				time.Sleep(time.Second)
+				break
+			}
+			if chunk.last {
+				break
+			}
+		}
+	}
+}
+
+// readDumpRangeChunk reads the next chunk of d, failing the chunk if it
+// panics
+func readDumpRangeChunk(d *dumper) (entry *DumpEntry, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = models.NewPanicError(r)
+		}
+	}()
+	return d.readChunk(&DumpEntry{})
+}
+
+// dumpKeyBounds returns the first column of the unique key of table, and
+// its lowest and highest values among the rows of where. ok is false if
+// they are not integers, or there are no rows.
+func dumpKeyBounds(db usql.QueryAble, table *config.Table, where string) (column string, min, max int64, ok bool, err error) {
+	column = usql.EscapeName(table.UseUniqueKey.Columns.Columns[0].Name)
+	query := fmt.Sprintf("select min(%s), max(%s) from %s.%s where %s", column, column,
+		usql.EscapeName(table.TableSchema), usql.EscapeName(table.TableName), where)
+	var low, high gosql.NullString
+	if err := db.QueryRow(query).Scan(&low, &high); err != nil {
+		return "", 0, 0, false, fmt.Errorf("exec [%s] error: %v", query, err)
+	}
+	if !low.Valid || !high.Valid {
+		return column, 0, 0, false, nil
+	}
+	if min, err = strconv.ParseInt(low.String, 10, 64); err != nil {
+		return column, 0, 0, false, nil
+	}
+	if max, err = strconv.ParseInt(high.String, 10, 64); err != nil {
+		return column, 0, 0, false, nil
+	}
+	return column, min, max, true, nil
+}
+
+// dumpKeyEdges splits the keys from min to max in parts of about as many
+// keys, at most parts of them, and returns the first key of each
+func dumpKeyEdges(min, max int64, parts int) []int64 {
+	// The keys may span more than an int64 holds
+	span := uint64(max) - uint64(min)
+	if span < uint64(parts) {
+		parts = int(span) + 1
+	}
+	step := span / uint64(parts)
+	if span%uint64(parts) != 0 {
+		step++
+	}
+	edges := []int64{min}
+	for i := 1; i < parts; i++ {
+		edge := int64(uint64(min) + uint64(i)*step)
+		if edge > max || edge <= edges[len(edges)-1] {
+			break
+		}
+		edges = append(edges, edge)
+	}
+	return edges
+}
+
+// sampleDumpKey returns how many rows of table the optimizer estimates
+// each part of its key starting at edges has, by column
+func sampleDumpKey(db usql.QueryAble, table *config.Table, column string, edges []int64) ([]int64, error) {
+	rows := make([]int64, len(edges))
+	for i, edge := range edges {
+		condition := fmt.Sprintf("%s >= %d", column, edge)
+		if i+1 < len(edges) {
+			condition = fmt.Sprintf("%s and %s < %d", condition, column, edges[i+1])
+		}
+		query := fmt.Sprintf("explain select * from %s.%s where %s",
+			usql.EscapeName(table.TableSchema), usql.EscapeName(table.TableName), condition)
+		err := usql.QueryRowsMap(db, query, func(m usql.RowMap) error {
+			rows[i] += m.GetInt64("rows")
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// balanceDumpKey returns the keys splitting the parts of the key starting
+// at edges, up to max, of rows rows each, in ranges ranges of about as
+// many rows. The parts are taken as even if their rows are not known.
+// There may be fewer keys than ranges-1 if the keys are too few to split.
+func balanceDumpKey(edges []int64, max int64, rows []int64, ranges int) []int64 {
+	var total int64
+	for _, n := range rows {
+		total += n
+	}
+	if total <= 0 {
+		rows = make([]int64, len(edges))
+		for i := range rows {
+			rows[i] = 1
+		}
+		total = int64(len(rows))
+	}
+
+	var boundaries []int64
+	var before int64
+	k := 1
+	for i, n := range rows {
+		for n > 0 && k < ranges {
+			target := float64(total) * float64(k) / float64(ranges)
+			if float64(before+n) < target {
+				break
+			}
+			// Interpolate within the part
+			end := max
+			if i+1 < len(edges) {
+				end = edges[i+1]
+			}
+			fraction := (target - float64(before)) / float64(n)
+			boundary := int64(uint64(edges[i]) + uint64(fraction*float64(uint64(end)-uint64(edges[i]))))
+			if boundary > edges[0] && boundary <= max &&
+				(len(boundaries) == 0 || boundary > boundaries[len(boundaries)-1]) {
+				boundaries = append(boundaries, boundary)
+			}
+			k++
+		}
+		before += n
+	}
+	return boundaries
+}
+
+// dumpRangeConditions returns the conditions on column selecting the
+// ranges the keys boundaries split it in
+func dumpRangeConditions(column string, boundaries []int64) []string {
+	conditions := make([]string, len(boundaries)+1)
+	for i := range conditions {
+		switch {
+		case i == 0:
+			conditions[i] = fmt.Sprintf("%s < %d", column, boundaries[0])
+		case i == len(boundaries):
+			conditions[i] = fmt.Sprintf("%s >= %d", column, boundaries[i-1])
+		default:
+			conditions[i] = fmt.Sprintf("%s >= %d and %s < %d", column, boundaries[i-1], column, boundaries[i])
+		}
+	}
+	return conditions
+}
+
+// splitDumpTable returns the ranges of the key of t a parallel copy of it
+// with connections connections reads, from db, nil if it is copied with
+// one connection. The rows left of t are those of where.
+func (e *Extractor) splitDumpTable(db usql.QueryAble, t *config.Table, where string, connections int) ([]*dumpRange, error) {
+	chunkSize := e.mysqlContext.ChunkSize
+	if connections < 2 || t.UseUniqueKey == nil || t.Counter <= chunkSize {
+		return nil, nil
+	}
+	ranges := connections * dumpRangesPerConnection
+	if chunks := int(math.Ceil(float64(t.Counter) / float64(chunkSize))); chunks < ranges {
+		ranges = chunks
+	}
+
+	column, min, max, ok, err := dumpKeyBounds(db, t, where)
+	if err != nil || !ok {
+		return nil, err
+	}
+	parts := ranges * dumpKeySamples
+	if parts > maxDumpKeySamples {
+		parts = maxDumpKeySamples
+	}
+	edges := dumpKeyEdges(min, max, parts)
+	rows, err := sampleDumpKey(db, t, column, edges)
+	if err != nil {
+		// The parts are taken as even
+		e.logger.Warnf("mysql.extractor: can't estimate the rows of the key of %s.%s, splitting it evenly: %v",
+			t.TableSchema, t.TableName, err)
+		rows = nil
+	}
+	boundaries := balanceDumpKey(edges, max, rows, ranges)
+	if len(boundaries) == 0 {
+		return nil, nil
+	}
+
+	template := NewDumper(db, t, t.Counter, chunkSize, e.logger)
+	if err := template.prepareColumns(); err != nil {
+		return nil, err
+	}
+	var split []*dumpRange
+	for i, condition := range dumpRangeConditions(column, boundaries) {
+		table := *t
+		uniqueKey := *t.UseUniqueKey
+		uniqueKey.LastMaxVals = make([]string, len(uniqueKey.Columns.Columns))
+		table.UseUniqueKey = &uniqueKey
+		table.Iteration = 0
+		table.Where = fmt.Sprintf("%s and (%s)", where, condition)
+		d := NewDumper(nil, &table, 0, chunkSize, e.logger)
+		d.columns = template.columns
+		split = append(split, &dumpRange{index: i, dumper: d})
+	}
+	return split, nil
+}
+
+// dumpTableParallel copies the rows of t with the connections of
+// snapshots, the first one that of the snapshot of the copy, in ranges of
+// its key. It sends the chunks with send, last for the last one of the
+// table. It returns false, copying nothing, if t is not worth splitting.
+func (e *Extractor) dumpTableParallel(t *config.Table, snapshots []usql.QueryAble, send func(entry *DumpEntry, last bool)) (bool, error) {
+	// The rows left of a resumed table are after the last one copied
+	where := fmt.Sprintf("(%s) and (%s)", t.Where, uniqueKeyRange(t))
+	ranges, err := e.splitDumpTable(snapshots[0], t, where, len(snapshots))
+	if err != nil {
+		e.logger.Warnf("mysql.extractor: can't split %s.%s, copying it with one connection: %v",
+			t.TableSchema, t.TableName, err)
+		return false, nil
+	}
+	if len(ranges) == 0 {
+		return false, nil
+	}
+	e.logger.Printf("mysql.extractor: copying %s.%s in %d ranges of %s with %d connections",
+		t.TableSchema, t.TableName, len(ranges), t.UseUniqueKey.Columns.Columns[0].Name, len(snapshots))
+	e.progress.split(t.TableSchema, t.TableName, len(ranges))
+
+	queue := make(chan *dumpRange, len(ranges))
+	for _, r := range ranges {
+		queue <- r
+	}
+	defer close(queue)
+	chunks := make(chan *dumpRangeChunk, len(snapshots))
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, db := range snapshots {
+		go dumpRangeWorker(db, queue, chunks, stop)
+	}
+
+	connections, left := len(snapshots), len(ranges)
+	// mark is the key of the last row of the table up to which all the
+	// rows were sent, and next the first range not sent in full
+	var mark []string
+	if t.Iteration > 0 {
+		mark = append([]string(nil), t.UseUniqueKey.LastMaxVals...)
+	}
+	next := 0
+	for left > 0 {
+		var chunk *dumpRangeChunk
+		select {
+		case chunk = <-chunks:
+		case <-e.shutdownCh:
+			return true, fmt.Errorf("mysql.extractor: shut down while copying %s.%s", t.TableSchema, t.TableName)
+		}
+		r := chunk.r
+		if chunk.err != nil {
+			r.failures++
+			if chunk.lost {
+				connections--
+			}
+			if r.failures >= int(e.mysqlContext.MaxRetries) || connections == 0 {
+				return true, fmt.Errorf("mysql.extractor: copy of range %d of %s.%s failed %d times: %v",
+					r.index, t.TableSchema, t.TableName, r.failures, chunk.err)
+			}
+			e.logger.Warnf("mysql.extractor: reading range %d of %s.%s failed, retrying the rest of it (%d of %d): %v",
+				r.index, t.TableSchema, t.TableName, r.failures, e.mysqlContext.MaxRetries, chunk.err)
+			queue <- r
+			continue
+		}
+
+		entry := chunk.entry
+		if len(entry.ValuesX) > 0 {
+			r.lastMaxVals = entry.LastMaxVals
+		}
+		if chunk.last {
+			r.done = true
+			left--
+			e.progress.rangeCopied(t.TableSchema, t.TableName)
+			e.logger.Debugf("mysql.extractor: copied range %d of %s.%s, %d of %d ranges left",
+				r.index, t.TableSchema, t.TableName, left, len(ranges))
+		}
+		for ; next < len(ranges) && ranges[next].done; next++ {
+			if ranges[next].lastMaxVals != nil {
+				mark = ranges[next].lastMaxVals
+			}
+		}
+		if next < len(ranges) && ranges[next].lastMaxVals != nil {
+			mark = ranges[next].lastMaxVals
+		}
+		if len(entry.ValuesX) == 0 && left > 0 {
+			continue
+		}
+		e.logger.Debugf("mysql.extractor: read %d rows of range %d of %s.%s",
+			len(entry.ValuesX), r.index, t.TableSchema, t.TableName)
+		entry.LastMaxVals = mark
+		send(entry, left == 0)
+	}
+	return true, nil
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDumpKeyEdges(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max int64
+		parts    int
+		want     []int64
+	}{
+		{"even", 1, 100, 4, []int64{1, 26, 51, 76}},
+		{"fewer keys than parts", 10, 12, 8, []int64{10, 11, 12}},
+		{"one key", 5, 5, 8, []int64{5}},
+		{"whole int64", math.MinInt64, math.MaxInt64, 2, []int64{math.MinInt64, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dumpKeyEdges(tt.min, tt.max, tt.parts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dumpKeyEdges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBalanceDumpKey(t *testing.T) {
+	edges := []int64{0, 100, 200, 300}
+	tests := []struct {
+		name   string
+		rows   []int64
+		ranges int
+		want   []int64
+	}{
+		{"even", []int64{10, 10, 10, 10}, 4, []int64{100, 200, 300}},
+		{"within parts", []int64{10, 10, 10, 10}, 8, []int64{50, 100, 150, 200, 250, 300, 349}},
+		// Most rows have low keys
+		{"skewed", []int64{90, 5, 5, 0}, 2, []int64{55}},
+		{"unknown", []int64{0, 0, 0, 0}, 2, []int64{200}},
+		{"last part", []int64{0, 0, 0, 30}, 3, []int64{333, 366}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := balanceDumpKey(edges, 399, tt.rows, tt.ranges); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("balanceDumpKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpRangeConditions(t *testing.T) {
+	want := []string{"`id` < 10", "`id` >= 10 and `id` < 20", "`id` >= 20"}
+	if got := dumpRangeConditions("`id`", []int64{10, 20}); !reflect.DeepEqual(got, want) {
+		t.Errorf("dumpRangeConditions() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// tableProgress is how far the copy of a table is
+type tableProgress struct {
+	schema, table string
+	// estimate is how many rows the table has, -1 if it is not known, as
+	// source tells
+	estimate int64
+	source   string
+	copied   int64
+	// ranges is how many ranges of its key the table is copied in, 0 if
+	// it is not split, and rangesCopied how many of them are
+	ranges, rangesCopied int
+}
+
+// dumpProgress tracks the rows copied of each table against an estimate
+// of how many rows it has: the statistics of the source when the copy
+// starts, the exact count of the table once it is counted, and the rows
+// copied once its last chunk is.
+type dumpProgress struct {
+	sync.Mutex
+	tables []*tableProgress
+	byName map[string]*tableProgress
+}
+
+func (p *dumpProgress) get(schema, table string) *tableProgress {
+	return p.byName[fmt.Sprintf("%s.%s", schema, table)]
+}
+
+// add tracks the copy of schema.table, estimate rows according to the
+// statistics of the source, -1 if they can't tell
+func (p *dumpProgress) add(schema, table string, estimate int64) {
+	p.Lock()
+	defer p.Unlock()
+	if p.byName == nil {
+		p.byName = make(map[string]*tableProgress)
+	}
+	t := &tableProgress{schema: schema, table: table, estimate: estimate, source: models.RowsEstimateStatistics}
+	if estimate < 0 {
+		t.source = ""
+	}
+	p.tables = append(p.tables, t)
+	p.byName[fmt.Sprintf("%s.%s", schema, table)] = t
+}
+
+// counted records schema.table has count rows to copy
+func (p *dumpProgress) counted(schema, table string, count int64) {
+	p.Lock()
+	defer p.Unlock()
+	if t := p.get(schema, table); t != nil {
+		t.estimate, t.source = count, models.RowsEstimateCount
+	}
+}
+
+// copy records rows of schema.table were copied, last if they end it. It
+// returns whether the rows copied exceed the estimate before the copy of
+// the table is complete, so it is wrong.
+func (p *dumpProgress) copy(schema, table string, rows int64, last bool) (overrun bool) {
+	p.Lock()
+	defer p.Unlock()
+	t := p.get(schema, table)
+	if t == nil {
+		return false
+	}
+	t.copied += rows
+	if last {
+		t.estimate, t.source = t.copied, models.RowsEstimateCopied
+		return false
+	}
+	return t.estimate >= 0 && t.copied >= t.estimate
+}
+
+// split records schema.table is copied in ranges ranges of its key
+func (p *dumpProgress) split(schema, table string, ranges int) {
+	p.Lock()
+	defer p.Unlock()
+	if t := p.get(schema, table); t != nil {
+		t.ranges, t.rangesCopied = ranges, 0
+	}
+}
+
+// rangeCopied records one more range of schema.table is copied
+func (p *dumpProgress) rangeCopied(schema, table string) {
+	p.Lock()
+	defer p.Unlock()
+	if t := p.get(schema, table); t != nil {
+		t.rangesCopied++
+	}
+}
+
+// reestimate refreshes the estimate of schema.table with one from the
+// statistics of the source, which the rows copied so far must not
+// exceed, or drops it. It returns the estimate kept, -1 if none.
+func (p *dumpProgress) reestimate(schema, table string, estimate int64) int64 {
+	p.Lock()
+	defer p.Unlock()
+	t := p.get(schema, table)
+	if t == nil {
+		return -1
+	}
+	if estimate > t.copied {
+		t.estimate, t.source = estimate, models.RowsEstimateStatistics
+	} else {
+		t.estimate, t.source = -1, ""
+	}
+	return t.estimate
+}
+
+// stat adds the progress of the tables to s
+func (p *dumpProgress) stat(s *models.DumpStat) {
+	p.Lock()
+	defer p.Unlock()
+	for _, t := range p.tables {
+		tp := &models.TableProgress{
+			TableSchema:    t.schema,
+			TableName:      t.table,
+			RowsCopied:     t.copied,
+			RowsEstimate:   t.estimate,
+			EstimateSource: t.source,
+			Ranges:         t.ranges,
+			RangesCopied:   t.rangesCopied,
+		}
+		if t.estimate > 0 {
+			tp.ProgressPct = progressPct(t.copied, t.estimate)
+		}
+		s.Tables = append(s.Tables, tp)
+		s.RowsCopied += t.copied
+		if t.estimate < 0 {
+			s.RowsEstimateUnknown = true
+		} else {
+			s.RowsEstimate += t.estimate
+		}
+	}
+	if !s.RowsEstimateUnknown && s.RowsEstimate > 0 {
+		s.ProgressPct = progressPct(s.RowsCopied, s.RowsEstimate)
+	}
+}
+
+// progressPct returns copied out of estimate in percent, at most 100
+func progressPct(copied, estimate int64) float64 {
+	if copied >= estimate {
+		return 100
+	}
+	return 100 * float64(copied) / float64(estimate)
+}
+
+// estimateTableRows returns how many rows table has according to the
+// statistics of the source, -1 if they can't tell: the table is filtered
+// by a predicate, or has no statistics
+func (e *Extractor) estimateTableRows(table *config.Table) (int64, error) {
+	if table.Where != "" && table.Where != "true" {
+		return -1, nil
+	}
+	query := `select TABLE_ROWS from information_schema.TABLES where TABLE_SCHEMA = ? and TABLE_NAME = ?`
+	var rows gosql.NullInt64
+	err := e.db.QueryRow(query, table.TableSchema, table.TableName).Scan(&rows)
+	if err == gosql.ErrNoRows || (err == nil && !rows.Valid) {
+		return -1, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return rows.Int64, nil
+}
+
+// estimateDumpRows estimates the rows of the tables of the copy, before
+// they are counted one after another
+func (e *Extractor) estimateDumpRows() {
+	for _, db := range e.replicateDoDb {
+		for _, tb := range db.Tables {
+			if tb.TableSchema != db.TableSchema {
+				continue
+			}
+			estimate := int64(-1)
+			var resumed bool
+			if e.resume != nil {
+				if tc := e.resume.Table(tb.TableSchema, tb.TableName); tc != nil {
+					if tc.Done {
+						continue
+					}
+					// The statistics don't tell how many rows are left
+					resumed = true
+				}
+			}
+			if !resumed {
+				var err error
+				if estimate, err = e.estimateTableRows(tb); err != nil {
+					e.logger.Warnf("mysql.extractor: can't estimate the rows of %s.%s: %v", tb.TableSchema, tb.TableName, err)
+					estimate = -1
+				}
+			}
+			e.progress.add(tb.TableSchema, tb.TableName, estimate)
+		}
+	}
+}
+
+// copiedRows records rows of table were copied, last if they end it, and
+// refreshes its estimate if they show it is wrong
+func (e *Extractor) copiedRows(table *config.Table, rows int64, last bool) {
+	if !e.progress.copy(table.TableSchema, table.TableName, rows, last) {
+		return
+	}
+	estimate, err := e.estimateTableRows(table)
+	if err != nil {
+		estimate = -1
+	}
+	if estimate = e.progress.reestimate(table.TableSchema, table.TableName, estimate); estimate < 0 {
+		e.logger.Warnf("mysql.extractor: more rows of %s.%s copied than estimated, the total is unknown",
+			table.TableSchema, table.TableName)
+	} else {
+		e.logger.Warnf("mysql.extractor: more rows of %s.%s copied than estimated, estimating %d rows",
+			table.TableSchema, table.TableName, estimate)
+	}
+}
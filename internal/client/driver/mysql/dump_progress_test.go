@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestDumpProgress(t *testing.T) {
+	var p dumpProgress
+	p.add("db1", "t1", 1000)
+	p.add("db1", "filtered", -1)
+
+	// The statistics estimate the table until it is counted
+	var stat models.DumpStat
+	p.stat(&stat)
+	if !stat.RowsEstimateUnknown || stat.ProgressPct != 0 || stat.RowsEstimate != 1000 {
+		t.Errorf("dumpProgress.stat() = %+v, want the total unknown", stat)
+	}
+	p.counted("db1", "t1", 400)
+	p.counted("db1", "filtered", 100)
+	if p.copy("db1", "t1", 100, false) || p.copy("db1", "filtered", 50, false) {
+		t.Fatalf("dumpProgress.copy() within the estimate overran")
+	}
+	stat = models.DumpStat{}
+	p.stat(&stat)
+	if stat.RowsEstimateUnknown || stat.RowsCopied != 150 || stat.RowsEstimate != 500 || stat.ProgressPct != 30 {
+		t.Errorf("dumpProgress.stat() = %+v, want 150 of 500 rows", stat)
+	}
+	if tp := stat.Tables[0]; tp.EstimateSource != models.RowsEstimateCount || tp.ProgressPct != 25 {
+		t.Errorf("dumpProgress.stat() of t1 = %+v, want 25%% of the count", tp)
+	}
+
+	// A table copied in parallel tells how many of its ranges are copied
+	p.split("db1", "t1", 4)
+	p.rangeCopied("db1", "t1")
+	stat = models.DumpStat{}
+	p.stat(&stat)
+	if tp := stat.Tables[0]; tp.Ranges != 4 || tp.RangesCopied != 1 || stat.Tables[1].Ranges != 0 {
+		t.Errorf("dumpProgress.stat() = %+v, want 1 of the 4 ranges of t1 copied", tp)
+	}
+
+	// Copying more rows than estimated refreshes the estimate, or drops it
+	if !p.copy("db1", "t1", 300, false) {
+		t.Fatalf("dumpProgress.copy() beyond the estimate didn't overrun")
+	}
+	if got := p.reestimate("db1", "t1", 800); got != 800 {
+		t.Errorf("dumpProgress.reestimate() = %v, want 800", got)
+	}
+	if !p.copy("db1", "t1", 500, false) {
+		t.Fatalf("dumpProgress.copy() beyond the estimate didn't overrun")
+	}
+	if got := p.reestimate("db1", "t1", 800); got != -1 {
+		t.Errorf("dumpProgress.reestimate() below the rows copied = %v, want -1", got)
+	}
+	stat = models.DumpStat{}
+	p.stat(&stat)
+	if !stat.RowsEstimateUnknown || stat.ProgressPct != 0 || stat.Tables[0].EstimateSource != "" {
+		t.Errorf("dumpProgress.stat() = %+v, want the total unknown", stat)
+	}
+
+	// The last chunk tells how many rows the table has
+	p.copy("db1", "t1", 10, true)
+	p.copy("db1", "filtered", 50, true)
+	stat = models.DumpStat{}
+	p.stat(&stat)
+	if stat.RowsEstimateUnknown || stat.RowsEstimate != 1010 || stat.ProgressPct != 100 {
+		t.Errorf("dumpProgress.stat() after the copy = %+v, want 100%% of 1010 rows", stat)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/actiontech/dtle/internal/config"
 	umconf "github.com/actiontech/dtle/internal/config/mysql"
 	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
 )
 
 type dumper struct {
@@ -61,6 +62,9 @@ func NewDumper(db usql.QueryAble, table *config.Table, total, chunkSize int64,
 type dumpStatResult struct {
 	Gtid       string
 	TotalCount int64
+	// ResumedGtid is the GTID set of the snapshot a resumed copy read the
+	// rows left at, empty if the copy was not resumed
+	ResumedGtid string
 }
 
 type DumpEntry struct {
@@ -80,6 +84,12 @@ type DumpEntry struct {
 	colBuffer                bytes.Buffer
 	err                      error
 	Table                    *config.Table
+	// Gtid is the GTID set of the snapshot the copy started at. The
+	// unique key of the last row of the chunk is LastMaxVals, nil if the
+	// table has none, and LastChunk tells it's the last of the table.
+	Gtid        string
+	LastMaxVals []string
+	LastChunk   bool
 }
 
 func (e *DumpEntry) incrementCounter() {
@@ -91,13 +101,33 @@ func (d *dumper) getDumpEntries() ([]*DumpEntry, error) {
 		return []*DumpEntry{}, nil
 	}
 
+	if err := d.prepareColumns(); err != nil {
+		return []*DumpEntry{}, err
+	}
+
+	sliceCount := int(math.Ceil(float64(d.total) / float64(d.chunkSize)))
+	if sliceCount == 0 {
+		sliceCount = 1
+	}
+	entries := make([]*DumpEntry, sliceCount)
+	for i := 0; i < sliceCount; i++ {
+		offset := uint64(i) * uint64(d.chunkSize)
+		entries[i] = &DumpEntry{
+			Offset: offset,
+		}
+	}
+	return entries, nil
+}
+
+// prepareColumns sets the columns the chunks select
+func (d *dumper) prepareColumns() error {
 	columnList, err := ubase.GetTableColumns(d.db, d.TableSchema, d.TableName)
 	if err != nil {
-		return []*DumpEntry{}, err
+		return err
 	}
 
 	if err := ubase.ApplyColumnTypes(d.db, d.TableSchema, d.TableName, columnList); err != nil {
-		return []*DumpEntry{}, err
+		return err
 	}
 
 	needPm := false
@@ -118,19 +148,7 @@ func (d *dumper) getDumpEntries() ([]*DumpEntry, error) {
 	} else {
 		d.columns = "*"
 	}
-
-	sliceCount := int(math.Ceil(float64(d.total) / float64(d.chunkSize)))
-	if sliceCount == 0 {
-		sliceCount = 1
-	}
-	entries := make([]*DumpEntry, sliceCount)
-	for i := 0; i < sliceCount; i++ {
-		offset := uint64(i) * uint64(d.chunkSize)
-		entries[i] = &DumpEntry{
-			Offset: offset,
-		}
-	}
-	return entries, nil
+	return nil
 }
 
 func (d *dumper) buildQueryOldWay(e *DumpEntry) string {
@@ -158,37 +176,12 @@ func (d *dumper) buildQueryOnUniqueKey(e *DumpEntry) string {
 		}
 	}
 
-	var rangeStr string
-
-	if d.table.Iteration == 0 {
-		rangeStr = "true"
-	} else {
-		rangeItems := make([]string, nCol)
-
-		// The form like: (A > a) or (A = a and B > b) or (A = a and B = b and C > c) or ...
-		for x := 0; x < nCol; x++ {
-			innerItems := make([]string, x+1)
-
-			for y := 0; y < x; y++ {
-				colName := usql.EscapeName(d.table.UseUniqueKey.Columns.Columns[y].Name)
-				innerItems[y] = fmt.Sprintf("(%s = %s)", colName, d.table.UseUniqueKey.LastMaxVals[y])
-			}
-
-			colName := usql.EscapeName(d.table.UseUniqueKey.Columns.Columns[x].Name)
-			innerItems[x] = fmt.Sprintf("(%s > %s)", colName, d.table.UseUniqueKey.LastMaxVals[x])
-
-			rangeItems[x] = fmt.Sprintf("(%s)", strings.Join(innerItems, " and "))
-		}
-
-		rangeStr = strings.Join(rangeItems, " or ")
-	}
-
 	return fmt.Sprintf(`SELECT %s FROM %s.%s where %s and (%s) order by %s LIMIT %d`,
 		d.columns,
 		usql.EscapeName(d.TableSchema),
 		usql.EscapeName(d.TableName),
 		// where
-		rangeStr, d.table.Where,
+		uniqueKeyRange(d.table), d.table.Where,
 		// order by
 		strings.Join(uniqueKeyColumnAscending, ", "),
 		// limit
@@ -196,17 +189,44 @@ func (d *dumper) buildQueryOnUniqueKey(e *DumpEntry) string {
 	)
 }
 
+// uniqueKeyRange returns the condition on the unique key of the table of
+// the rows after the last one copied, true before the first chunk
+func uniqueKeyRange(table *config.Table) string {
+	if table.Iteration == 0 {
+		return "true"
+	}
+	nCol := len(table.UseUniqueKey.Columns.Columns)
+	rangeItems := make([]string, nCol)
+
+	// The form like: (A > a) or (A = a and B > b) or (A = a and B = b and C > c) or ...
+	for x := 0; x < nCol; x++ {
+		innerItems := make([]string, x+1)
+
+		for y := 0; y < x; y++ {
+			colName := usql.EscapeName(table.UseUniqueKey.Columns.Columns[y].Name)
+			innerItems[y] = fmt.Sprintf("(%s = %s)", colName, table.UseUniqueKey.LastMaxVals[y])
+		}
+
+		colName := usql.EscapeName(table.UseUniqueKey.Columns.Columns[x].Name)
+		innerItems[x] = fmt.Sprintf("(%s > %s)", colName, table.UseUniqueKey.LastMaxVals[x])
+
+		rangeItems[x] = fmt.Sprintf("(%s)", strings.Join(innerItems, " and "))
+	}
+
+	return strings.Join(rangeItems, " or ")
+}
+
 // dumps a specific chunk, reading chunk info from the channel
 func (d *dumper) getChunkData(e *DumpEntry) (err error) {
-	entry := &DumpEntry{
-		TableSchema: d.TableSchema,
-		TableName:   d.TableName,
-		RowsCount:   e.RowsCount,
-		Offset:      e.Offset,
-	}
-	// TODO use PS
-	// TODO escape schema/table/column name once and save
+	var entry *DumpEntry
 	defer func() {
+		if r := recover(); r != nil {
+			// The extractor fails the task with the chunk
+			err = models.NewPanicError(r)
+		}
+		if entry == nil {
+			entry = &DumpEntry{TableSchema: d.TableSchema, TableName: d.TableName, Offset: e.Offset}
+		}
 		entry.err = err
 		keepGoing := true
 		for keepGoing {
@@ -220,6 +240,29 @@ func (d *dumper) getChunkData(e *DumpEntry) (err error) {
 		d.logger.Debugf("mysql.dumper: resultsChannel: %v", len(d.resultsChannel))
 	}()
 
+	entry, err = d.readChunk(e)
+	if err != nil {
+		return err
+	}
+	// TODO getChunkData could get 0 rows. Esp after removing 'start transaction'.
+	if len(entry.ValuesX) == 0 {
+		return fmt.Errorf("getChunkData. GetLastMaxVal: no rows found")
+	}
+	return nil
+}
+
+// readChunk reads the rows of the chunk e, after the last row read of the
+// table if it has a unique key. The chunk is the next one only once it is
+// read without error.
+func (d *dumper) readChunk(e *DumpEntry) (*DumpEntry, error) {
+	entry := &DumpEntry{
+		TableSchema: d.TableSchema,
+		TableName:   d.TableName,
+		RowsCount:   e.RowsCount,
+		Offset:      e.Offset,
+	}
+	// TODO use PS
+	// TODO escape schema/table/column name once and save
 	query := ""
 	if d.table.UseUniqueKey == nil {
 		query = d.buildQueryOldWay(e)
@@ -228,15 +271,15 @@ func (d *dumper) getChunkData(e *DumpEntry) (err error) {
 	}
 	d.logger.Debugf("getChunkData. query: %s", query)
 
-	d.table.Iteration += 1
 	rows, err := d.db.Query(query)
 	if err != nil {
-		return fmt.Errorf("exec [%s] error: %v", query, err)
+		return entry, fmt.Errorf("exec [%s] error: %v", query, err)
 	}
+	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return err
+		return entry, err
 	}
 
 	//packetLen := 0
@@ -255,7 +298,7 @@ func (d *dumper) getChunkData(e *DumpEntry) (err error) {
 
 		err = rows.Scan(scanArgs...)
 		if err != nil {
-			return err
+			return entry, err
 		}
 
 		for i := range rowValuesRaw {
@@ -268,14 +311,12 @@ func (d *dumper) getChunkData(e *DumpEntry) (err error) {
 		nRows += 1
 		entry.incrementCounter()
 	}
+	if err := rows.Err(); err != nil {
+		return entry, err
+	}
 
 	d.logger.Debugf("getChunkData. n_row: %d", nRows)
 
-	// TODO getChunkData could get 0 rows. Esp after removing 'start transaction'.
-	if nRows == 0 {
-		return fmt.Errorf("getChunkData. GetLastMaxVal: no rows found")
-	}
-
 	if nRows > 0 {
 		var lastVals []string
 
@@ -289,13 +330,15 @@ func (d *dumper) getChunkData(e *DumpEntry) (err error) {
 				// TODO save the idx
 				idx := d.table.OriginalTableColumns.Ordinals[col.Name]
 				if idx > len(lastVals) {
-					return fmt.Errorf("getChunkData. GetLastMaxVal: column index %v > n_column %v", idx, len(lastVals))
+					return entry, fmt.Errorf("getChunkData. GetLastMaxVal: column index %v > n_column %v", idx, len(lastVals))
 				} else {
 					d.table.UseUniqueKey.LastMaxVals[i] = lastVals[idx]
 				}
 			}
 			d.logger.Debugf("GetLastMaxVal: got %v", d.table.UseUniqueKey.LastMaxVals)
+			entry.LastMaxVals = append([]string(nil), d.table.UseUniqueKey.LastMaxVals...)
 		}
+		d.table.Iteration += 1
 	}
 
 	// ValuesX[i]: n-th row
@@ -303,7 +346,7 @@ func (d *dumper) getChunkData(e *DumpEntry) (err error) {
 	// Values[i]: i-th chunk of rows
 	// Values[i][j]: j-th row (in paren-wrapped string)
 
-	return nil
+	return entry, nil
 }
 
 func (d *dumper) worker() {
@@ -30,6 +30,8 @@ import (
 	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
 	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
 	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	"github.com/actiontech/dtle/internal/g"
 	log "github.com/actiontech/dtle/internal/logger"
 	"github.com/actiontech/dtle/internal/models"
 	"github.com/actiontech/dtle/utils"
@@ -39,6 +41,10 @@ const (
 	// DefaultConnectWait is the default timeout used for the connect operation
 	DefaultConnectWait            = 10 * time.Second
 	ReconnectStreamerSleepSeconds = 5
+
+	// GtidPurgedCheckInterval is how often a streaming job checks the
+	// source didn't purge binlogs it still needs
+	GtidPurgedCheckInterval = time.Minute
 )
 
 // Extractor is the main schema extract flow manager.
@@ -49,6 +55,9 @@ type Extractor struct {
 	maxPayload               int
 	mysqlContext             *config.MySQLDriverConfig
 	db                       *gosql.DB
+	// dbLock guards db, and the ConnectionConfig of mysqlContext, against
+	// a failover while streaming
+	dbLock                   sync.Mutex
 	singletonDB              *gosql.DB
 	dumpers                  []*dumper
 	// db.tb exists when creating the job, for full-copy.
@@ -56,6 +65,8 @@ type Extractor struct {
 	replicateDoDb            []*config.DataSource
 	binlogChannel            chan *binlog.BinlogTx
 	dataChannel              chan *binlog.BinlogEntry
+	// dataBuffer bounds the bytes of the entries of dataChannel
+	dataBuffer               *binlog.EntryBuffer
 	inspector                *Inspector
 	binlogReader             *binlog.BinlogReader
 	initialBinlogCoordinates *base.BinlogCoordinatesX
@@ -64,6 +75,27 @@ type Extractor struct {
 	rowCopyCompleteFlag      int64
 	tableCount               int
 
+	// resume is the checkpoint the copy resumes from, nil to copy all the
+	// tables. resumedGtid is the GTID set of the snapshot it resumes at.
+	resume      *models.DumpCheckpoint
+	resumedGtid string
+	// dump counts the bytes of the copy. localNatsAddr is the NATS address
+	// of the node of the extractor, which the applier shares if it is its
+	// NatsAddr.
+	dump          dumpStat
+	// progress is how far the copy of each table is
+	progress dumpProgress
+	localNatsAddr string
+
+	// replica is the source if it is a replica of another server, nil
+	// otherwise
+	replica *replicaSource
+	// replay is the range of transactions the extractor stops after, nil
+	// unless the job is a replay
+	replay *replayRange
+	// reloadLock guards binlogReader against Reload
+	reloadLock sync.Mutex
+
 	sendByTimeoutCounter  int
 	sendBySizeFullCounter int
 
@@ -81,7 +113,7 @@ func NewExtractor(subject, tp string, maxPayload int, cfg *config.MySQLDriverCon
 
 	cfg = cfg.SetDefault()
 	entry := log.NewEntry(logger).WithFields(log.Fields{
-		"job": subject,
+		log.FieldJobID: subject,
 	})
 	e := &Extractor{
 		logger:          entry,
@@ -91,6 +123,7 @@ func NewExtractor(subject, tp string, maxPayload int, cfg *config.MySQLDriverCon
 		mysqlContext:    cfg,
 		binlogChannel:   make(chan *binlog.BinlogTx, cfg.ReplChanBufferSize),
 		dataChannel:     make(chan *binlog.BinlogEntry, cfg.ReplChanBufferSize),
+		dataBuffer:      binlog.NewEntryBuffer(cfg.BinlogBufferBytes),
 		rowCopyComplete: make(chan bool),
 		waitCh:          make(chan *models.WaitResult, 1),
 		shutdownCh:      make(chan struct{}),
@@ -102,9 +135,29 @@ func NewExtractor(subject, tp string, maxPayload int, cfg *config.MySQLDriverCon
 		e.testStub1Delay = delay
 	}
 
+	if _, err := dumpCompression(cfg, ""); err != nil {
+		return nil, err
+	}
+	if cfg.GtidStop != "" {
+		if !cfg.ApproveHeterogeneous {
+			return nil, fmt.Errorf("a replay requires ApproveHeterogeneous")
+		}
+		replay, err := parseReplayRange(cfg.GtidStart, cfg.GtidStop)
+		if err != nil {
+			return nil, err
+		}
+		e.replay = replay
+	}
+
 	return e, nil
 }
 
+// SetLocalNatsAddr tells the extractor the NATS address of its node, to
+// decide whether the applier runs on the same one
+func (e *Extractor) SetLocalNatsAddr(addr string) {
+	e.localNatsAddr = addr
+}
+
 // sleepWhileTrue sleeps indefinitely until the given function returns 'false'
 // (or fails with error)
 func (e *Extractor) sleepWhileTrue(operation func() (bool, error)) error {
@@ -154,6 +207,7 @@ func (e *Extractor) consumeRowCopyComplete() {
 
 // Run executes the complete extract logic.
 func (e *Extractor) Run() {
+	defer e.recoverPanic()
 	e.logger.Printf("mysql.extractor: Extract binlog events from %s.%d", e.mysqlContext.ConnectionConfig.Host, e.mysqlContext.ConnectionConfig.Port)
 	e.mysqlContext.StartTime = time.Now()
 
@@ -166,6 +220,11 @@ func (e *Extractor) Run() {
 		}
 	}
 
+	if err := e.mysqlContext.ConnectionConfig.RegisterTLSConfig(); err != nil {
+		e.onError(TaskStateDead, err)
+		return
+	}
+
 	if err := e.initiateInspector(); err != nil {
 		e.onError(TaskStateDead, err)
 		return
@@ -185,8 +244,11 @@ func (e *Extractor) Run() {
 			if err != nil {
 				e.onError(TaskStateDead, err)
 			}
-			e.mysqlContext.Gtid = coord.GtidSet
-			e.logger.Debugf("mysql.extractor: use auto gtid: %v", coord.GtidSet)
+			e.mysqlContext.Gtid, err = e.replica.trackedGtidSet(coord.GtidSet)
+			if err != nil {
+				e.onError(TaskStateDead, err)
+			}
+			e.logger.Debugf("mysql.extractor: use auto gtid: %v", e.mysqlContext.Gtid)
 		}
 
 		if e.mysqlContext.GtidStart != "" {
@@ -199,16 +261,34 @@ func (e *Extractor) Run() {
 			if err != nil {
 				e.onError(TaskStateDead, err)
 			}
+			e.mysqlContext.Gtid, err = e.replica.trackedGtidSet(e.mysqlContext.Gtid)
+			if err != nil {
+				e.onError(TaskStateDead, err)
+			}
 		}
 	}
 
 	if e.mysqlContext.Gtid == "" { // still empty: full copy
+		if checkpoint := e.mysqlContext.DumpCheckpoint; checkpoint != nil {
+			if err := checkResumable(e.mysqlContext, e.replicateDoDb, checkpoint); err != nil {
+				e.logger.Warnf("mysql.extractor: can't resume the copy, copying all the tables again: %v", err)
+			} else {
+				e.resume = checkpoint
+			}
+		}
 		e.mysqlContext.MarkRowCopyStartTime()
+		compressed, _ := dumpCompression(e.mysqlContext, e.localNatsAddr)
+		e.dump.begin(compressed)
 		if err := e.mysqlDump(); err != nil {
 			e.onError(TaskStateDead, err)
 			return
 		}
-		dumpMsg, err := Encode(&dumpStatResult{Gtid: e.initialBinlogCoordinates.GtidSet, TotalCount: e.mysqlContext.RowsEstimate})
+		e.dump.done()
+		stat := e.dump.stat()
+		e.logger.Printf("mysql.extractor: sent %d bytes of rows as %d bytes in %.1fs, compressed: %v",
+			stat.Bytes, stat.WireBytes, stat.Seconds, stat.Compressed)
+		dumpMsg, err := Encode(&dumpStatResult{Gtid: e.initialBinlogCoordinates.GtidSet, TotalCount: e.mysqlContext.RowsEstimate,
+			ResumedGtid: e.resumedGtid})
 		if err != nil {
 			e.onError(TaskStateDead, err)
 		}
@@ -277,6 +357,9 @@ func (e *Extractor) inspectTables() (err error) {
 				for _, doTb := range doDb.Tables {
 					doTb.TableSchema = doDb.TableSchema
 					if err := e.inspector.ValidateOriginalTable(doDb.TableSchema, doTb.TableName, doTb); err != nil {
+						if _, ok := err.(badWhereError); ok {
+							return fmt.Errorf("%s.%s: %v", doDb.TableSchema, doTb.TableName, err)
+						}
 						e.logger.Warnf("mysql.extractor: %v", err)
 						continue
 					}
@@ -397,7 +480,17 @@ func (e *Extractor) initNatsPubClient() (err error) {
 
 // initiateStreaming begins treaming of binary log events and registers listeners for such events
 func (e *Extractor) initiateStreaming() error {
+	go e.watchGtidPurged()
+	if e.mysqlContext.HeartbeatIntervalSeconds > 0 {
+		if e.replica != nil {
+			go e.sendReplicaHeartbeats()
+		} else {
+			go e.writeHeartbeats()
+		}
+	}
+
 	go func() {
+		defer e.recoverPanic()
 		e.logger.Printf("mysql.extractor: Beginning streaming")
 		err := e.StreamEvents()
 		if err != nil {
@@ -406,7 +499,9 @@ func (e *Extractor) initiateStreaming() error {
 	}()
 
 	go func() {
+		defer e.recoverPanic()
 		_, err := e.natsConn.Subscribe(fmt.Sprintf("%s_restart", e.subject), func(m *gonats.Msg) {
+			defer e.recoverPanic()
 			e.mysqlContext.Gtid = string(m.Data)
 			e.onError(TaskStateRestart, fmt.Errorf("restart"))
 		})
@@ -415,6 +510,7 @@ func (e *Extractor) initiateStreaming() error {
 		}
 
 		_, err = e.natsConn.Subscribe(fmt.Sprintf("%s_error", e.subject), func(m *gonats.Msg) {
+			defer e.recoverPanic()
 			e.mysqlContext.Gtid = string(m.Data)
 			e.onError(TaskStateDead, fmt.Errorf("applier"))
 		})
@@ -439,6 +535,13 @@ func (e *Extractor) initDBConnections() (err error) {
 	if err := e.validateConnection(); err != nil {
 		return err
 	}
+	if e.replica, err = readReplicaSource(e.db); err != nil {
+		return err
+	}
+	if e.replica != nil {
+		e.logger.Printf("mysql.extractor: the source is a replica of %s:%d, skipping the transactions of its server_uuid %s",
+			e.replica.masterHost, e.replica.masterPort, e.replica.serverUUID)
+	}
 	if err := e.validateAndReadTimeZone(); err != nil {
 		return err
 	}
@@ -454,19 +557,216 @@ func (e *Extractor) initDBConnections() (err error) {
 
 // initBinlogReader creates and connects the reader: we hook up to a MySQL server as a replica
 func (e *Extractor) initBinlogReader(binlogCoordinates *base.BinlogCoordinatesX) error {
+	if e.replica != nil {
+		executed, err := base.GetSelfBinlogCoordinates(e.db)
+		if err != nil {
+			return err
+		}
+		coordinates := *binlogCoordinates
+		if coordinates.GtidSet, err = e.replica.streamedGtidSet(coordinates.GtidSet, executed.GtidSet); err != nil {
+			return err
+		}
+		binlogCoordinates = &coordinates
+	}
+	missing, err := e.missingGtids(binlogCoordinates.GtidSet)
+	if err != nil {
+		return err
+	}
+	if missing != "" {
+		return e.purgedGtidsError(missing)
+	}
+
 	binlogReader, err := binlog.NewMySQLReader(e.mysqlContext, e.logger, e.replicateDoDb)
 	if err != nil {
 		e.logger.Debugf("mysql.extractor: err at initBinlogReader: NewMySQLReader: %v", err.Error())
 		return err
 	}
+	if e.mysqlContext.HeartbeatIntervalSeconds > 0 && e.replica == nil {
+		schema, table := e.heartbeatTable()
+		if err := e.createHeartbeatTable(schema, table); err != nil {
+			return err
+		}
+		binlogReader.SetHeartbeatTable(schema, table, e.subject)
+	}
+	binlogReader.SetBuffer(e.dataBuffer)
+	binlogReader.SetFailoverHandler(e.onSourceFailover)
 	if err := binlogReader.ConnectBinlogStreamer(*binlogCoordinates); err != nil {
 		e.logger.Debugf("mysql.extractor: err at initBinlogReader: ConnectBinlogStreamer: %v", err.Error())
 		return err
 	}
+	e.reloadLock.Lock()
 	e.binlogReader = binlogReader
+	e.reloadLock.Unlock()
 	return nil
 }
 
+// heartbeatTable returns the schema and the name of the table the
+// heartbeats of the job are written to
+func (e *Extractor) heartbeatTable() (string, string) {
+	name := e.mysqlContext.HeartbeatTable
+	if name == "" {
+		return g.DtleSchemaName, "heartbeat"
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return g.DtleSchemaName, name
+}
+
+func (e *Extractor) createHeartbeatTable(schema, table string) error {
+	if _, err := sql.Exec(e.db, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", sql.EscapeName(schema))); err != nil {
+		return fmt.Errorf("failed to create the heartbeat table %s.%s: %v", schema, table, err)
+	}
+	query := fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s.%s (
+				job_id varchar(190) NOT NULL PRIMARY KEY COMMENT 'job writing the heartbeat',
+				ts bigint NOT NULL COMMENT 'time of the heartbeat in unix nanoseconds'
+			)
+		`, sql.EscapeName(schema), sql.EscapeName(table))
+	if _, err := sql.Exec(e.db, query); err != nil {
+		return fmt.Errorf("failed to create the heartbeat table %s.%s: %v", schema, table, err)
+	}
+	return nil
+}
+
+// writeHeartbeats writes the time to the heartbeat row of the job every
+// HeartbeatIntervalSeconds, so that the applier can tell the lag of the
+// job even when the source writes nothing else
+func (e *Extractor) writeHeartbeats() {
+	defer e.recoverPanic()
+	schema, table := e.heartbeatTable()
+	query := fmt.Sprintf("REPLACE INTO %s.%s (job_id, ts) VALUES (?, ?)",
+		sql.EscapeName(schema), sql.EscapeName(table))
+	ticker := time.NewTicker(time.Duration(e.mysqlContext.HeartbeatIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := sql.Exec(e.sourceDB(), query, e.subject, time.Now().UnixNano()); err != nil {
+			e.logger.Warnf("mysql.extractor: Failed to write heartbeat: %v", err)
+		}
+	}
+}
+
+// sendReplicaHeartbeats stands for writeHeartbeats on a replica, where the
+// heartbeats would be transactions of the replica itself. Every
+// HeartbeatIntervalSeconds it sends the applier, after the transactions
+// read so far, the time of the primary the replica caught up with: the lag
+// the applier tells adds the lag of the replica to its own.
+func (e *Extractor) sendReplicaHeartbeats() {
+	defer e.recoverPanic()
+	if !e.mysqlContext.ApproveHeterogeneous {
+		e.logger.Warnf("mysql.extractor: No heartbeat from a replica without ApproveHeterogeneous")
+		return
+	}
+	ticker := time.NewTicker(time.Duration(e.mysqlContext.HeartbeatIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+
+		// No heartbeat while the replica applies nothing, so that the lag
+		// keeps growing
+		lag, err := e.replica.lagSeconds(e.sourceDB())
+		if err != nil {
+			e.logger.Warnf("mysql.extractor: Failed to read the lag of the source: %v", err)
+			continue
+		}
+		entry := &binlog.BinlogEntry{Heartbeat: time.Now().Add(-time.Duration(lag) * time.Second).UnixNano()}
+		select {
+		case e.dataChannel <- entry:
+		case <-e.shutdownCh:
+			return
+		}
+	}
+}
+
+// missingGtids returns the transactions purged from the source that none
+// of executed holds
+func (e *Extractor) missingGtids(executed ...string) (string, error) {
+	purged, err := base.SelectGtidPurged(e.sourceDB())
+	if err != nil {
+		return "", err
+	}
+	return base.GtidSetMissing(purged, executed...)
+}
+
+// sourceDB returns the connections to the source, which move to another
+// server when the binlog reader fails over to it
+func (e *Extractor) sourceDB() *gosql.DB {
+	e.dbLock.Lock()
+	defer e.dbLock.Unlock()
+	return e.db
+}
+
+// sourceConnection returns the connection config of the source, which
+// moves to another server when the binlog reader fails over to it
+func (e *Extractor) sourceConnection() *umconf.ConnectionConfig {
+	e.dbLock.Lock()
+	defer e.dbLock.Unlock()
+	return e.mysqlContext.ConnectionConfig
+}
+
+// onSourceFailover moves the connections to the source to the server the
+// binlog reader failed over to
+func (e *Extractor) onSourceFailover(source *umconf.ConnectionConfig) {
+	db, err := sql.CreateDB(source.GetDBUri())
+	if err != nil {
+		e.logger.Warnf("mysql.extractor: Failed to connect to %s:%d after the failover: %v", source.Host, source.Port, err)
+		return
+	}
+	// The config of the reader is its own, and the one replaced may still
+	// be read by those who got it
+	connectionConfig := *source
+	e.dbLock.Lock()
+	old := e.db
+	e.db = db
+	e.mysqlContext.ConnectionConfig = &connectionConfig
+	e.dbLock.Unlock()
+	sql.CloseDB(old)
+}
+
+// purgedGtidsError describes the transactions the job needs whose binlogs
+// the source purged
+func (e *Extractor) purgedGtidsError(missing string) error {
+	source := e.sourceConnection()
+	return fmt.Errorf("binlogs of transactions %s needed by the job were purged from %s:%d, see gtid_purged",
+		missing, source.Host, source.Port)
+}
+
+// watchGtidPurged periodically checks the source didn't purge binlogs the
+// job still needs, as can happen while the reader is behind, and stops the
+// job if it did rather than letting it skip transactions
+func (e *Extractor) watchGtidPurged() {
+	defer e.recoverPanic()
+	ticker := time.NewTicker(GtidPurgedCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+
+		missing, err := e.missingGtids(e.initialBinlogCoordinates.GtidSet, e.binlogReader.GetStreamedGtidSet())
+		if err != nil {
+			e.logger.Warnf("mysql.extractor: Failed to check gtid_purged: %v", err)
+			continue
+		}
+		if missing != "" {
+			e.onError(TaskStateDead, e.purgedGtidsError(missing))
+			return
+		}
+	}
+}
+
 // validateConnection issues a simple can-connect to MySQL
 func (e *Extractor) validateConnection() error {
 	query := `select @@global.version`
@@ -530,13 +830,14 @@ func (e *Extractor) CountTableRows(table *config.Table) (int64, error) {
 	defer atomic.StoreInt64(&e.mysqlContext.CountingRowsFlag, 0)
 	//e.logger.Debugf("mysql.extractor: As instructed, I'm issuing a SELECT COUNT(*) on the table. This may take a while")
 
-	query := fmt.Sprintf(`select count(*) as rows from %s.%s where (%s)`,
-		sql.EscapeName(table.TableSchema), sql.EscapeName(table.TableName), table.Where)
+	query := fmt.Sprintf(`select count(*) as rows from %s.%s where (%s) and (%s)`,
+		sql.EscapeName(table.TableSchema), sql.EscapeName(table.TableName), table.Where, uniqueKeyRange(table))
 	var rowsEstimate int64
 	if err := e.db.QueryRow(query).Scan(&rowsEstimate); err != nil {
 		return 0, err
 	}
 	atomic.AddInt64(&e.mysqlContext.RowsEstimate, rowsEstimate)
+	e.progress.counted(table.TableSchema, table.TableName, rowsEstimate)
 
 	e.mysqlContext.Stage = models.StageSearchingRowsForUpdate
 	e.logger.Debugf("mysql.extractor: Exact number of rows(%s.%s) via COUNT: %d", table.TableSchema, table.TableName, rowsEstimate)
@@ -619,6 +920,7 @@ func Encode(v interface{}) ([]byte, error) {
 func (e *Extractor) StreamEvents() error {
 	if e.mysqlContext.ApproveHeterogeneous {
 		go func() {
+			defer e.recoverPanic()
 			defer e.logger.Debugf("extractor. StreamEvents goroutine exited")
 
 			entries := binlog.BinlogEntries{}
@@ -655,10 +957,25 @@ func (e *Extractor) StreamEvents() error {
 				var err error
 				select {
 				case binlogEntry := <-e.dataChannel:
+					e.dataBuffer.Release(binlogEntry.OriginalSize)
+					if e.replica.isLocalTx(binlogEntry.Coordinates.GetSid()) {
+						continue
+					}
+					if e.replay != nil && !e.replay.contains(&binlogEntry.Coordinates) {
+						continue
+					}
 					entries.Entries = append(entries.Entries, binlogEntry)
 					entriesSize += binlogEntry.OriginalSize
 
-					if entriesSize >= e.mysqlContext.GroupMaxSize {
+					if e.replay != nil && e.replay.reach(&binlogEntry.Coordinates) {
+						entries.Entries = append(entries.Entries, &binlog.BinlogEntry{Final: true})
+						if err = sendEntries(); err == nil {
+							e.logger.Printf("mysql.extractor: replay of %v read", e.replay)
+							e.onDone()
+							keepGoing = false
+							continue
+						}
+					} else if entriesSize >= e.mysqlContext.GroupMaxSize {
 						e.logger.Debugf("extractor. incr. send by GroupLimit: %v", e.mysqlContext.GroupMaxSize)
 						err = sendEntries()
 					}
@@ -683,6 +1000,7 @@ func (e *Extractor) StreamEvents() error {
 		subject := fmt.Sprintf("%s_incr_hete", e.subject)
 
 		go func() {
+			defer e.recoverPanic()
 		L:
 			for {
 				select {
@@ -755,12 +1073,13 @@ func (e *Extractor) StreamEvents() error {
 		subject := fmt.Sprintf("%s_incr", e.subject)
 
 		go func() {
+			defer e.recoverPanic()
 		L:
 			for {
 				select {
 				case binlogTx := <-e.binlogChannel:
 					{
-						if nil == binlogTx {
+						if nil == binlogTx || e.replica.isLocalTx(binlogTx.SID) {
 							continue
 						}
 						txArray = append(txArray, binlogTx)
@@ -830,9 +1149,15 @@ func (e *Extractor) StreamEvents() error {
 // retryOperation attempts up to `count` attempts at running given function,
 // exiting as soon as it returns with non-error.
 func (e *Extractor) publish(subject, gtid string, txMsg []byte) (err error) {
+	_, err = e.request(subject, gtid, txMsg)
+	return err
+}
+
+// request is publish, returning the reply of the applier
+func (e *Extractor) request(subject, gtid string, txMsg []byte) (reply *gonats.Msg, err error) {
 	for {
 		e.logger.Debugf("mysql.extractor: publish. gtid: %v, msg_len: %v", gtid, len(txMsg))
-		_, err = e.natsConn.Request(subject, txMsg, DefaultConnectWait)
+		reply, err = e.natsConn.Request(subject, txMsg, DefaultConnectWait)
 		if err == nil {
 			if gtid != "" {
 				e.mysqlContext.Gtid = gtid
@@ -846,10 +1171,10 @@ func (e *Extractor) publish(subject, gtid string, txMsg []byte) (err error) {
 			break
 		}
 		// there's an error. Let's try again.
-		e.logger.Debugf(fmt.Sprintf("mysql.extractor: there's an error [%v]. Let's try again", err))
+		e.logger.Debugf("mysql.extractor: there's an error [%v]. Let's try again", err)
 		time.Sleep(1 * time.Second)
 	}
-	return err
+	return reply, err
 }
 
 func (e *Extractor) testStub1() {
@@ -864,6 +1189,9 @@ func (e *Extractor) testStub1() {
 func (e *Extractor) mysqlDump() error {
 	defer e.singletonDB.Close()
 	var tx sql.QueryAble
+	// dumpSnapshots are the transactions the other connections of a
+	// parallel copy read from
+	var dumpSnapshots []*gosql.Tx
 	var err error
 	step := 0
 	// ------
@@ -945,6 +1273,13 @@ func (e *Extractor) mysqlDump() error {
 				e.logger.Printf("[ERR] mysql.extractor: exec %+v, error: %v", query, err)
 				return err
 			}
+			// The snapshots of a parallel copy are checked with it
+			if e.mysqlContext.DumpParallelism > 1 {
+				if dumpSnapshots, err = e.beginDumpSnapshots(e.mysqlContext.DumpParallelism - 1); err != nil {
+					e.logger.Errorf("mysql.extractor: can't begin the snapshots of the parallel copy: %v", err)
+					return err
+				}
+			}
 
 			e.testStub1()
 
@@ -983,12 +1318,14 @@ func (e *Extractor) mysqlDump() error {
 					}
 					step++*/
 					e.logger.Printf("mysql.extractor: Step %d: committing transaction", step)
+					rollbackDumpSnapshots(dumpSnapshots)
 					if err := realTx.Commit(); err != nil {
 						e.onError(TaskStateDead, err)
 					}
 				}()
 			} else {
 				e.logger.Warningf("Failed got a consistenct TX with GTID in %v rounds. Will retry.", gtidMatchRound)
+				rollbackDumpSnapshots(dumpSnapshots)
 				err = realTx.Rollback()
 				if err != nil {
 					return err
@@ -1009,6 +1346,16 @@ func (e *Extractor) mysqlDump() error {
 		}
 		e.logger.Debugf("mysql.extractor: got gtid")
 	}
+	if e.initialBinlogCoordinates.GtidSet, err = e.replica.trackedGtidSet(e.initialBinlogCoordinates.GtidSet); err != nil {
+		return err
+	}
+	if e.resume != nil {
+		// The rows copied before miss none of the transactions since the
+		// snapshot the copy started at
+		e.resumedGtid = e.initialBinlogCoordinates.GtidSet
+		e.initialBinlogCoordinates = &base.BinlogCoordinatesX{GtidSet: e.resume.Gtid}
+		e.logger.Printf("mysql.extractor: Step %d: resuming the copy started at %v", step, e.resume.Gtid)
+	}
 	step++
 
 	// ------
@@ -1024,17 +1371,31 @@ func (e *Extractor) mysqlDump() error {
 	if !e.mysqlContext.SkipCreateDbTable {
 		e.logger.Printf("mysql.extractor: Step %d: - generating DROP and CREATE statements to reflect current database schemas:%v", step, e.replicateDoDb)
 	}
+	// Counting the rows of the tables takes a while
+	e.estimateDumpRows()
 	for _, db := range e.replicateDoDb {
 		if len(db.Tables) > 0 {
 			for _, tb := range db.Tables {
 				if tb.TableSchema != db.TableSchema {
 					continue
 				}
+				var resumed bool
+				if e.resume != nil {
+					if !resumeTable(tb, e.resume) {
+						tb.Counter = 0
+						continue
+					}
+					resumed = e.resume.Table(tb.TableSchema, tb.TableName) != nil
+				}
 				total, err := e.CountTableRows(tb)
 				if err != nil {
 					return err
 				}
 				tb.Counter = total
+				if resumed {
+					// The table was created with the rows copied before
+					continue
+				}
 				var dbSQL string
 				var tbSQL []string
 				if !e.mysqlContext.SkipCreateDbTable {
@@ -1100,6 +1461,26 @@ func (e *Extractor) mysqlDump() error {
 	e.logger.Printf("mysql.extractor: Step %d: scanning contents of %d tables", step, e.tableCount)
 	startScan := utils.CurrentTimeMillis()
 	counter := 0
+	snapshots := []sql.QueryAble{tx}
+	for _, snapshot := range dumpSnapshots {
+		snapshots = append(snapshots, snapshot)
+	}
+	sendChunk := func(t *config.Table, entry *DumpEntry, last bool) {
+		// TODO: entry values may be empty. skip the entry after removing 'start transaction'.
+		entry.SystemVariablesStatement = setSystemVariablesStatement
+		entry.SqlMode = setSqlMode
+
+		if e.needToSendTabelDef() {
+			entry.Table = t
+		}
+		entry.Gtid = e.initialBinlogCoordinates.GtidSet
+		entry.LastChunk = last
+		if err := e.encodeDumpEntry(entry); err != nil {
+			e.onError(TaskStateRestart, err)
+		}
+		atomic.AddInt64(&e.mysqlContext.TotalRowsCopied, entry.RowsCount)
+		e.copiedRows(t, entry.RowsCount, entry.LastChunk)
+	}
 	//pool := models.NewPool(10)
 	for _, db := range e.replicateDoDb {
 		for _, t := range db.Tables {
@@ -1110,6 +1491,15 @@ func (e *Extractor) mysqlDump() error {
 			// Choose how we create statements based on the # of rows ...
 			e.logger.Printf("mysql.extractor: Step %d: - scanning table '%s.%s' (%d of %d tables)", step, t.TableSchema, t.TableName, counter, e.tableCount)
 
+			split, err := e.dumpTableParallel(t, snapshots, func(entry *DumpEntry, last bool) {
+				sendChunk(t, entry, last)
+			})
+			if err != nil {
+				return err
+			}
+			if split {
+				continue
+			}
 			d := NewDumper(tx, t, t.Counter, e.mysqlContext.ChunkSize, e.logger)
 			if err := d.Dump(1); err != nil {
 				e.onError(TaskStateDead, err)
@@ -1121,17 +1511,7 @@ func (e *Extractor) mysqlDump() error {
 				if entry.err != nil {
 					e.onError(TaskStateDead, entry.err)
 				}
-				// TODO: entry values may be empty. skip the entry after removing 'start transaction'.
-				entry.SystemVariablesStatement = setSystemVariablesStatement
-				entry.SqlMode = setSqlMode
-
-				if e.needToSendTabelDef() {
-					entry.Table = d.table
-				}
-				if err = e.encodeDumpEntry(entry); err != nil {
-					e.onError(TaskStateRestart, err)
-				}
-				atomic.AddInt64(&e.mysqlContext.TotalRowsCopied, entry.RowsCount)
+				sendChunk(t, entry, i == d.entriesCount-1)
 			}
 
 			close(d.resultsChannel)
@@ -1152,17 +1532,43 @@ func (e *Extractor) mysqlDump() error {
 	return nil
 }
 func (e *Extractor) encodeDumpEntry(entry *DumpEntry) error {
-	txMsg, err := Encode(entry)
+	txMsg, err := e.dump.encodeDumpMsg(entry)
 	if err != nil {
 		return err
 	}
-	if err := e.publish(fmt.Sprintf("%s_full", e.subject), "", txMsg); err != nil {
+	reply, err := e.request(fmt.Sprintf("%s_full", e.subject), "", txMsg)
+	if err != nil {
 		return err
 	}
+	e.dump.ack(reply.Data)
 	e.mysqlContext.Stage = models.StageSendingData
 	return nil
 }
 
+// bufferFill returns how full the buffer of the entries read from the
+// binlog and not yet sent is, in percent of the most entries or bytes it
+// holds, whichever it is closer to
+func (e *Extractor) bufferFill() float64 {
+	fill := 0.0
+	if cap(e.dataChannel) > 0 {
+		fill = 100.0 * float64(len(e.dataChannel)) / float64(cap(e.dataChannel))
+	}
+	if limit := e.dataBuffer.Limit(); limit > 0 {
+		fill = math.Max(fill, 100.0*float64(e.dataBuffer.Used())/float64(limit))
+	}
+	return math.Min(fill, 100.0)
+}
+
+// dumpStat returns what the extractor sent of the copy, and how far it
+// is, nil without one
+func (e *Extractor) dumpStat() *models.DumpStat {
+	stat := e.dump.stat()
+	if stat != nil {
+		e.progress.stat(stat)
+	}
+	return stat
+}
+
 func (e *Extractor) Stats() (*models.TaskStatistics, error) {
 	totalRowsCopied := e.mysqlContext.GetTotalRowsCopied()
 	rowsEstimate := atomic.LoadInt64(&e.mysqlContext.RowsEstimate)
@@ -1210,8 +1616,14 @@ func (e *Extractor) Stats() (*models.TaskStatistics, error) {
 			ExtractorTxQueueSize: len(e.binlogChannel),
 			SendByTimeout:        e.sendByTimeoutCounter,
 			SendBySizeFull:       e.sendBySizeFullCounter,
+
+			BinlogBufferEntries: len(e.dataChannel),
+			BinlogBufferBytes:   e.dataBuffer.Used(),
+			BinlogBufferFill:    e.bufferFill(),
+			BinlogPausedSeconds: e.dataBuffer.PausedSeconds(),
 		},
 		Timestamp: time.Now().UTC().UnixNano(),
+		Dump:      e.dumpStat(),
 	}
 	if e.natsConn != nil {
 		taskResUsage.MsgStat = e.natsConn.Statistics
@@ -1224,6 +1636,8 @@ func (e *Extractor) Stats() (*models.TaskStatistics, error) {
 	currentBinlogCoordinates := &base.BinlogCoordinateTx{}
 	if e.binlogReader != nil {
 		currentBinlogCoordinates = e.binlogReader.GetCurrentBinlogCoordinates()
+		taskResUsage.BinlogReconnects = e.binlogReader.Reconnects()
+		taskResUsage.BinlogFailovers = e.binlogReader.Failovers()
 		taskResUsage.CurrentCoordinates = &models.CurrentCoordinates{
 			File:     currentBinlogCoordinates.LogFile,
 			Position: currentBinlogCoordinates.LogPos,
@@ -1248,7 +1662,7 @@ func (e *Extractor) ID() string {
 			ReplicateIgnoreDb:     e.mysqlContext.ReplicateIgnoreDb,
 			Gtid:                  e.mysqlContext.Gtid,
 			NatsAddr:              e.mysqlContext.NatsAddr,
-			ConnectionConfig:      e.mysqlContext.ConnectionConfig,
+			ConnectionConfig:      e.sourceConnection(),
 		},
 	}
 
@@ -1268,6 +1682,15 @@ func (e *Extractor) onError(state int, err error) {
 	e.Shutdown()
 }
 
+// recoverPanic, deferred by the goroutines of the extractor, fails the task
+// rather than the whole process when they panic
+func (e *Extractor) recoverPanic() {
+	if r := recover(); r != nil {
+		err := models.NewPanicError(r)
+		e.onError(TaskStateRestart, err)
+	}
+}
+
 func (e *Extractor) onDone() {
 	if e.shutdown {
 		return
@@ -1291,6 +1714,7 @@ func (e *Extractor) Shutdown() error {
 	}
 	e.shutdown = true
 	close(e.shutdownCh)
+	e.dataBuffer.Close()
 
 	if e.natsConn != nil {
 		e.natsConn.Close()
@@ -1310,7 +1734,7 @@ func (e *Extractor) Shutdown() error {
 		}
 	}
 
-	if err := sql.CloseDB(e.db); err != nil {
+	if err := sql.CloseDB(e.sourceDB()); err != nil {
 		return err
 	}
 
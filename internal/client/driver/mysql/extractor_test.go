@@ -9,41 +9,30 @@ package mysql
 import (
 	"reflect"
 	"testing"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+
 	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
 	"github.com/actiontech/dtle/internal/config"
-	log "github.com/actiontech/dtle/internal/logger"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
 	"github.com/actiontech/dtle/internal/models"
 )
 
 func TestGtidSetDiff(t *testing.T) {
-	// TODO
-	g, err := GtidSetDiff(
+	g, err := base.GtidSetDiff(
 		"113fa2ce-c8e6-11e7-b894-67ad30e6f107:1-100:200:300-400,f2a4aa16-c8e6-11e7-9ff0-e19f7778f563:100-200:300-400,8888aa16-c8e6-11e7-9ff0-e19f7778f563:1-1000",
 		"113fa2ce-c8e6-11e7-b894-67ad30e6f107:330,f2a4aa16-c8e6-11e7-9ff0-e19f7778f563:301",
 	)
-}
-
-func TestNewExtractor(t *testing.T) {
-	type args struct {
-		subject    string
-		tp         string
-		maxPayload int
-		cfg        *config.MySQLDriverConfig
-		logger     *log.Logger
+	if err != nil {
+		t.Fatalf("GtidSetDiff() error = %v", err)
 	}
-	tests := []struct {
-		name string
-		args args
-		want *Extractor
-	}{
-		// TODO: Add test cases.
+	got, err := gomysql.ParseMysqlGTIDSet(g)
+	if err != nil {
+		t.Fatalf("ParseMysqlGTIDSet(%v) error = %v", g, err)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := NewExtractor(tt.args.subject, tt.args.tp, tt.args.maxPayload, tt.args.cfg, tt.args.logger); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("NewExtractor() = %v, want %v", got, tt.want)
-			}
-		})
+	want, _ := gomysql.ParseMysqlGTIDSet("113fa2ce-c8e6-11e7-b894-67ad30e6f107:1-100:200:300-329,f2a4aa16-c8e6-11e7-9ff0-e19f7778f563:100-200:300,8888aa16-c8e6-11e7-9ff0-e19f7778f563:1-1000")
+	if !got.Equal(want) {
+		t.Errorf("GtidSetDiff() = %v, want %v", g, want)
 	}
 }
 
@@ -186,27 +175,6 @@ func TestExtractor_initDBConnections(t *testing.T) {
 	}
 }
 
-func TestExtractor_initBinlogReader(t *testing.T) {
-	type args struct {
-		binlogCoordinates *base.BinlogCoordinateTx
-	}
-	tests := []struct {
-		name    string
-		e       *Extractor
-		args    args
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.e.initBinlogReader(tt.args.binlogCoordinates); (err != nil) != tt.wantErr {
-				t.Errorf("Extractor.initBinlogReader() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
 func TestExtractor_validateConnection(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -372,29 +340,6 @@ func TestExtractor_StreamEvents(t *testing.T) {
 	}
 }
 
-func TestExtractor_requestMsg(t *testing.T) {
-	type args struct {
-		subject string
-		gtid    string
-		txMsg   []byte
-	}
-	tests := []struct {
-		name    string
-		e       *Extractor
-		args    args
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.e.requestMsg(tt.args.subject, tt.args.gtid, tt.args.txMsg); (err != nil) != tt.wantErr {
-				t.Errorf("Extractor.requestMsg() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
 func TestExtractor_mysqlDump(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -433,22 +378,6 @@ func TestExtractor_encodeDumpEntry(t *testing.T) {
 	}
 }
 
-func Test_currentTimeMillis(t *testing.T) {
-	tests := []struct {
-		name string
-		want int64
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := currentTimeMillis(); got != tt.want {
-				t.Errorf("currentTimeMillis() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func TestExtractor_Stats(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -489,24 +418,6 @@ func TestExtractor_ID(t *testing.T) {
 	}
 }
 
-func TestExtractor_onError(t *testing.T) {
-	type args struct {
-		err error
-	}
-	tests := []struct {
-		name string
-		e    *Extractor
-		args args
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tt.e.onError(tt.args.err)
-		})
-	}
-}
-
 func TestExtractor_WaitCh(t *testing.T) {
 	tests := []struct {
 		name string
@@ -609,34 +520,6 @@ func TestExtractor_validateAndReadTimeZone(t *testing.T) {
 	}
 }
 
-func TestExtractor_CountTableRows(t *testing.T) {
-	type args struct {
-		tableSchema string
-		tableName   string
-	}
-	tests := []struct {
-		name    string
-		e       *Extractor
-		args    args
-		want    int64
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.e.CountTableRows(tt.args.tableSchema, tt.args.tableName)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Extractor.CountTableRows() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if got != tt.want {
-				t.Errorf("Extractor.CountTableRows() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func TestExtractor_onDone(t *testing.T) {
 	tests := []struct {
 		name string
@@ -650,3 +533,20 @@ func TestExtractor_onDone(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractor_onSourceFailover(t *testing.T) {
+	first := &umconf.ConnectionConfig{Host: "10.0.0.1", Port: 3306}
+	e := &Extractor{mysqlContext: &config.MySQLDriverConfig{ConnectionConfig: first}}
+	source := &umconf.ConnectionConfig{Host: "10.0.0.2", Port: 3307}
+	e.onSourceFailover(source)
+	defer e.sourceDB().Close()
+
+	// The candidate handed over stays the reader's own
+	source.Host = "10.0.0.3"
+	if got := e.sourceConnection(); got.Host != "10.0.0.2" || got.Port != 3307 {
+		t.Errorf("sourceConnection() = %s:%d, want 10.0.0.2:3307", got.Host, got.Port)
+	}
+	if first.Host != "10.0.0.1" {
+		t.Errorf("the replaced ConnectionConfig changed to %s", first.Host)
+	}
+}
@@ -103,7 +103,7 @@ func (i *Inspector) ValidateOriginalTable(databaseName, tableName string, table
 		for _, column := range uk.Columns.Columns {
 			switch column.Type {
 			case umconf.FloatColumnType:
-				i.logger.Warning("Will not use %+v as unique key due to FLOAT data type", uk.Name)
+				i.logger.Warningf("Will not use %+v as unique key due to FLOAT data type", uk.Name)
 				uniqueKeyIsValid = false
 			case umconf.JSONColumnType:
 				// Noteworthy that at this time MySQL does not allow JSON indexing anyhow, but this code
@@ -146,15 +146,21 @@ func (i *Inspector) ValidateOriginalTable(databaseName, tableName string, table
 	_, err = uconf.NewWhereCtx(table.Where, table)
 	if err != nil {
 		i.logger.Errorf("mysql.inspector: Error parse where '%v'", table.Where)
-		return err
+		return badWhereError{fmt.Errorf("bad 'where' %q: %v", table.Where, err)}
 	}
-	// TODO the err cause only a WARN
 	// TODO name escaping
 	// endregion
 
 	return nil
 }
 
+// badWhereError is the error of a 'where' that can't filter the rows of a
+// table. Unlike other problems of the table, which skip it, it fails the
+// job.
+type badWhereError struct {
+	error
+}
+
 func (i *Inspector) InspectTableColumnsAndUniqueKeys(databaseName, tableName string) (columns *umconf.ColumnList, uniqueKeys [](*umconf.UniqueKey), err error) {
 	uniqueKeys, err = i.getCandidateUniqueKeys(databaseName, tableName)
 	if err != nil {
@@ -262,7 +268,12 @@ func (i *Inspector) validateBinlogs() error {
 		return fmt.Errorf("%s:%d must have binary logs enabled", i.mysqlContext.ConnectionConfig.Host, i.mysqlContext.ConnectionConfig.Port)
 	}
 	if i.mysqlContext.RequiresBinlogFormatChange() {
-		return fmt.Errorf("You must be using ROW binlog format. I can switch it for you, provided --switch-to-rbr and that %s:%d doesn't have replicas", i.mysqlContext.ConnectionConfig.Host, i.mysqlContext.ConnectionConfig.Port)
+		return fmt.Errorf("%s:%d has binlog_format %s, which logs no rows to replicate: set binlog_format = ROW on the source, with SET GLOBAL and in its configuration file",
+			i.mysqlContext.ConnectionConfig.Host, i.mysqlContext.ConnectionConfig.Port, i.mysqlContext.BinlogFormat)
+	}
+	if strings.ToUpper(i.mysqlContext.BinlogFormat) == "MIXED" {
+		i.logger.Warnf("mysql.inspector: %s:%d has binlog_format MIXED: the job fails on DML logged as statements to replicated tables",
+			i.mysqlContext.ConnectionConfig.Host, i.mysqlContext.ConnectionConfig.Port)
 	}
 	query = `select @@global.binlog_row_image`
 	if err := i.db.QueryRow(query).Scan(&i.mysqlContext.BinlogRowImage); err != nil {
@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// jsonChanges returns the changes the update event makes to the documents
+// of its JSON columns, by ordinal, to make them on the target rather than
+// writing the new documents, as PartialJSONUpdates says. It returns nil
+// for the update to write the whole row: if the event holds no partial
+// update, the values of the table are converted or filtered, a column of
+// the source or of the target isn't JSON, or a path counts cells from the
+// last one, which the target may not support. The columns of the updates
+// are ordinals of the source columns, as those of the changes.
+func (a *Applier) jsonChanges(event binlog.DataEvent) map[int][]sql.JSONChange {
+	if !a.mysqlContext.PartialJSONUpdates || event.DML != binlog.UpdateDML || len(event.JSONUpdates) == 0 {
+		return nil
+	}
+	tableItem := event.TableItem.(*applierTableItem)
+	if len(tableItem.converters) > 0 || len(tableItem.transcoders) > 0 {
+		return nil
+	}
+	if tb := a.tableConfig(event.DatabaseName, event.TableName); tb != nil && tb.HasColumnFilter() {
+		return nil
+	}
+	// The target columns by the ordinal of the source column they hold
+	targets := make(map[int]*umconf.Column, tableItem.columns.Len())
+	for i := range tableItem.columns.Columns {
+		column := &tableItem.columns.Columns[i]
+		targets[tableItem.columns.Ordinals[column.Name]] = column
+	}
+	source := a.sourceTables.columns(event.DatabaseName, event.TableName)
+	changes := make(map[int][]sql.JSONChange)
+	for _, update := range event.JSONUpdates {
+		target, ok := targets[update.Column]
+		if !ok || !strings.EqualFold(target.ColumnType, "json") || update.Relative {
+			return nil
+		}
+		if source != nil && (update.Column >= source.Len() ||
+			!strings.EqualFold(source.Columns[update.Column].ColumnType, "json")) {
+			return nil
+		}
+		change := sql.JSONChange{Path: update.Path, Value: update.Value}
+		switch {
+		case update.Op == binlog.JSONReplace:
+			change.Function = "json_replace"
+		case update.Op == binlog.JSONRemove:
+			change.Function = "json_remove"
+		case update.Cell:
+			change.Function = "json_array_insert"
+		default:
+			// Adds the member, or replaces it as the source did
+			change.Function = "json_set"
+		}
+		changes[update.Column] = append(changes[update.Column], change)
+	}
+	return changes
+}
+
+// applyPartialUpdate applies the update event in the transaction of the
+// worker, making changes to the documents of its JSON columns
+func (a *Applier) applyPartialUpdate(event binlog.DataEvent, changes map[int][]sql.JSONChange, workerIdx int) (int64, error) {
+	tableItem := event.TableItem.(*applierTableItem)
+	schema, table := a.nameMapping.Table(event.DatabaseName, event.TableName)
+	if tableItem.targetTable != "" {
+		table = tableItem.targetTable
+	}
+	query, args, err := sql.BuildDMLPartialUpdateQuery(schema, table, tableItem.columns, changes,
+		event.NewColumnValues.GetAbstractValues(), event.WhereColumnValues.GetAbstractValues())
+	if err != nil {
+		a.logger.Errorf("mysql.applier: Build dml query error: %v", err)
+		return 0, err
+	}
+	a.logger.Debugf("ApplyBinlogEvent. args: %v", args)
+
+	// Statements of dbApplier.Db run in the session of tx
+	if _, err := a.dbs[workerIdx].Db.ExecContext(context.Background(), query, args...); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// jsonUpdateEvent returns the update of the row 1 of db1.t1 (id, j) setting
+// j with the changes of updates
+func jsonUpdateEvent(jsonType string, updates ...binlog.JSONUpdate) binlog.DataEvent {
+	item := newApplierTableItem(1)
+	item.columns = umconf.NewColumnList([]umconf.Column{{Name: "id", Key: "PRI"}, {Name: "j", ColumnType: jsonType}})
+	e := binlog.NewDataEvent("db1", "t1", binlog.UpdateDML, 2)
+	e.TableItem = item
+	e.WhereColumnValues = umconf.ToColumnValues([]interface{}{int64(1), `{"a": 1, "b": [1, 2]}`})
+	e.NewColumnValues = umconf.ToColumnValues([]interface{}{int64(1), `{"a": 2, "b": [0, 2], "c": "x"}`})
+	e.JSONUpdates = updates
+	return e
+}
+
+func TestApplier_jsonChanges(t *testing.T) {
+	updates := []binlog.JSONUpdate{
+		{Column: 1, Op: binlog.JSONReplace, Path: "$.a", Value: "2"},
+		{Column: 1, Op: binlog.JSONInsert, Path: "$.b[0]", Value: "0", Cell: true},
+		{Column: 1, Op: binlog.JSONInsert, Path: "$.c", Value: `"x"`},
+		{Column: 1, Op: binlog.JSONRemove, Path: "$.d"},
+	}
+	want := map[int][]sql.JSONChange{1: {
+		{Function: "json_replace", Path: "$.a", Value: "2"},
+		{Function: "json_array_insert", Path: "$.b[0]", Value: "0"},
+		{Function: "json_set", Path: "$.c", Value: `"x"`},
+		{Function: "json_remove", Path: "$.d"},
+	}}
+	filtered := &config.DataSource{TableSchema: "db1", Tables: []*config.Table{{TableName: "t1", ExcludeColumns: []string{"j"}}}}
+	tests := []struct {
+		name    string
+		enabled bool
+		filter  bool
+		event   binlog.DataEvent
+		want    map[int][]sql.JSONChange
+	}{
+		{"partial update", true, false, jsonUpdateEvent("json", updates...), want},
+		{"disabled", false, false, jsonUpdateEvent("json", updates...), nil},
+		{"whole document", true, false, jsonUpdateEvent("json"), nil},
+		{"text on the target", true, false, jsonUpdateEvent("longtext", updates...), nil},
+		{"last cell", true, false, jsonUpdateEvent("json", binlog.JSONUpdate{
+			Column: 1, Op: binlog.JSONRemove, Path: "$.b[last]", Cell: true, Relative: true}), nil},
+		{"column filter", true, true, jsonUpdateEvent("json", updates...), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Applier{mysqlContext: &config.MySQLDriverConfig{PartialJSONUpdates: tt.enabled}}
+			if tt.filter {
+				a.mysqlContext.ReplicateDoDb = []*config.DataSource{filtered}
+			}
+			if got := a.jsonChanges(tt.event); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jsonChanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplier_jsonChanges_SourceColumns(t *testing.T) {
+	update := binlog.JSONUpdate{Column: 1, Op: binlog.JSONReplace, Path: "$.a", Value: "2"}
+	want := map[int][]sql.JSONChange{1: {{Function: "json_replace", Path: "$.a", Value: "2"}}}
+	tests := []struct {
+		name   string
+		source []umconf.Column
+		want   map[int][]sql.JSONChange
+	}{
+		// The target has j first, the update still locates it in the source
+		{"reordered target", []umconf.Column{{Name: "id"}, {Name: "j", ColumnType: "json"}}, want},
+		{"text on the source", []umconf.Column{{Name: "id"}, {Name: "j", ColumnType: "longtext"}}, nil},
+		{"column missing on the target", []umconf.Column{{Name: "id"}, {Name: "k", ColumnType: "json"}, {Name: "j", ColumnType: "json"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Applier{mysqlContext: &config.MySQLDriverConfig{PartialJSONUpdates: true}}
+			source := umconf.NewColumnList(tt.source)
+			a.sourceTables.learn(&binlog.BinlogEntry{Events: []binlog.DataEvent{{
+				DatabaseName: "db1", TableName: "t1", Table: &config.Table{OriginalTableColumns: source},
+			}}})
+			target := umconf.NewColumnList([]umconf.Column{{Name: "j", ColumnType: "json"}, {Name: "id", Key: "PRI"}})
+			columns, err := sourceOrdinals(target, source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			event := jsonUpdateEvent("json", update)
+			event.TableItem.(*applierTableItem).columns = columns
+			if got := a.jsonChanges(event); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jsonChanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplier_applyRow_PartialJSONUpdates(t *testing.T) {
+	a, server, stop := newBatchApplier(t, &config.MySQLDriverConfig{PartialJSONUpdates: true})
+	defer stop()
+
+	event := jsonUpdateEvent("json",
+		binlog.JSONUpdate{Column: 1, Op: binlog.JSONReplace, Path: "$.a", Value: "2"},
+		binlog.JSONUpdate{Column: 1, Op: binlog.JSONRemove, Path: "$.b[0]", Cell: true})
+	if _, err := a.applyRow(event, 0); err != nil {
+		t.Fatalf("applyRow() error = %v", err)
+	}
+	want := `update db1.t1 set id=?, j=json_remove(json_replace(j, ?, cast(? as json)), ?) where ((id = ?)) limit 1 [1 $.a 2 $.b[0] 1]`
+	if len(server.execs) != 1 || strings.Replace(server.execs[0], "`", "", -1) != want {
+		t.Errorf("server executed %q, want %q", server.execs, want)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+)
+
+// eventOperation returns the row operation of the Operations of tables the
+// row event dml is
+func eventOperation(dml binlog.EventDML) string {
+	switch dml {
+	case binlog.InsertDML:
+		return config.OperationInsert
+	case binlog.UpdateDML:
+		return config.OperationUpdate
+	case binlog.DeleteDML:
+		return config.OperationDelete
+	}
+	return ""
+}
+
+// dropOperations drops the row events of binlogEntry whose operation the
+// configuration of their table doesn't replicate
+func (a *Applier) dropOperations(binlogEntry *binlog.BinlogEntry) {
+	var events []binlog.DataEvent
+	for i, event := range binlogEntry.Events {
+		if event.DML == binlog.NotDML {
+			if events != nil {
+				events = append(events, event)
+			}
+			continue
+		}
+		tb := a.tableConfig(event.DatabaseName, event.TableName)
+		if tb == nil || tb.ReplicatesOperation(eventOperation(event.DML)) {
+			if events != nil {
+				events = append(events, event)
+			}
+			continue
+		}
+		if events == nil {
+			events = append(make([]binlog.DataEvent, 0, len(binlogEntry.Events)), binlogEntry.Events[:i]...)
+		}
+		atomic.AddInt64(&a.droppedRows, 1)
+	}
+	if events != nil {
+		binlogEntry.Events = events
+	}
+}
+
+// ValidateOperations checks the Operations of the tables of doDbs, and
+// returns the warnings of the tables some operations of which are dropped
+func ValidateOperations(doDbs []*config.DataSource) (warnings []string, err error) {
+	for _, ds := range doDbs {
+		for _, tb := range ds.Tables {
+			tableWarnings, err := tb.ValidateOperations()
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", ds.TableSchema, tb.TableName, err)
+			}
+			for _, warning := range tableWarnings {
+				warnings = append(warnings, fmt.Sprintf("%s.%s: %s", ds.TableSchema, tb.TableName, warning))
+			}
+		}
+	}
+	return warnings, nil
+}
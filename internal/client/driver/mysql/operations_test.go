@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+)
+
+func TestApplier_dropOperations(t *testing.T) {
+	audit := config.NewTable("db1", "audit")
+	audit.Operations = []string{config.OperationInsert}
+	a := &Applier{mysqlContext: &config.MySQLDriverConfig{ReplicateDoDb: []*config.DataSource{
+		{TableSchema: "db1", Tables: []*config.Table{audit, config.NewTable("db1", "t1")}},
+	}}}
+
+	entry := &binlog.BinlogEntry{Events: []binlog.DataEvent{
+		{DatabaseName: "db1", TableName: "audit", DML: binlog.UpdateDML},
+		{DatabaseName: "db1", TableName: "audit", DML: binlog.InsertDML},
+		{DatabaseName: "db1", TableName: "t1", DML: binlog.DeleteDML},
+		{CurrentSchema: "db1", TableName: "audit", DML: binlog.NotDML, Query: "alter table audit add c int"},
+		{DatabaseName: "db1", TableName: "audit", DML: binlog.DeleteDML},
+	}}
+	a.dropOperations(entry)
+	var got []string
+	for _, event := range entry.Events {
+		got = append(got, event.TableName+" "+eventOperation(event.DML))
+	}
+	want := []string{"audit insert", "t1 delete", "audit "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Applier.dropOperations() left %q, want %q", got, want)
+	}
+	if a.droppedRows != 2 {
+		t.Errorf("Applier.droppedRows = %d, want 2", a.droppedRows)
+	}
+}
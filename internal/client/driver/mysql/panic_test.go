@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestApplier_recoverPanic(t *testing.T) {
+	a := &Applier{
+		logger:     log.NewEntry(log.New(ioutil.Discard, log.DebugLevel)),
+		waitCh:     make(chan *models.WaitResult, 1),
+		shutdownCh: make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer a.recoverPanic()
+		var counts map[string]int
+		counts["rows"]++
+	}()
+	<-done
+
+	res := <-a.waitCh
+	if res.ExitCode != TaskStateRestart {
+		t.Errorf("ExitCode = %d, want %d", res.ExitCode, TaskStateRestart)
+	}
+	err, ok := res.Err.(*models.PanicError)
+	if !ok {
+		t.Fatalf("Err = %#v, want a *models.PanicError", res.Err)
+	}
+	if !strings.Contains(err.Stack, "TestApplier_recoverPanic") {
+		t.Errorf("Stack = %q, missing the panicking goroutine", err.Stack)
+	}
+	if !a.shutdown {
+		t.Errorf("the applier was not shut down")
+	}
+}
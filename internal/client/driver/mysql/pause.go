@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"sync"
+)
+
+// pauser holds the applier back while its job is paused
+type pauser struct {
+	mu       sync.Mutex
+	isPaused bool
+
+	// pausedCh is closed while paused, resumedCh while not
+	pausedCh  chan struct{}
+	resumedCh chan struct{}
+}
+
+func newPauser() *pauser {
+	p := &pauser{
+		pausedCh:  make(chan struct{}),
+		resumedCh: make(chan struct{}),
+	}
+	close(p.resumedCh)
+	return p
+}
+
+// set pauses or resumes. It returns false if it already was.
+func (p *pauser) set(paused bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.isPaused == paused {
+		return false
+	}
+	p.isPaused = paused
+	if paused {
+		close(p.pausedCh)
+		p.resumedCh = make(chan struct{})
+	} else {
+		close(p.resumedCh)
+		p.pausedCh = make(chan struct{})
+	}
+	return true
+}
+
+// paused returns a channel closed once paused
+func (p *pauser) paused() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pausedCh
+}
+
+// resumed returns a channel closed once resumed
+func (p *pauser) resumed() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumedCh
+}
+
+// get tells whether the applier is paused
+func (p *pauser) get() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isPaused
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+)
+
+func TestPauser(t *testing.T) {
+	p := newPauser()
+	isClosed := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	tests := []struct {
+		name        string
+		paused      bool
+		wantChanged bool
+	}{
+		{"pause", true, true},
+		{"pause again", true, false},
+		{"resume", false, true},
+		{"resume again", false, false},
+	}
+	for _, tt := range tests {
+		pausedCh, resumedCh := p.paused(), p.resumed()
+		if got := p.set(tt.paused); got != tt.wantChanged {
+			t.Errorf("%s: pauser.set() = %v, want %v", tt.name, got, tt.wantChanged)
+		}
+		if got := p.get(); got != tt.paused {
+			t.Errorf("%s: pauser.get() = %v, want %v", tt.name, got, tt.paused)
+		}
+		if isClosed(p.paused()) != tt.paused || isClosed(p.resumed()) == tt.paused {
+			t.Errorf("%s: paused channel closed = %v, resumed channel closed = %v",
+				tt.name, isClosed(p.paused()), isClosed(p.resumed()))
+		}
+		// Waiters on the channels from before are woken
+		if tt.wantChanged && !isClosed(pausedCh) && !isClosed(resumedCh) {
+			t.Errorf("%s: no channel from before was closed", tt.name)
+		}
+	}
+}
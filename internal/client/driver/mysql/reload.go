@@ -0,0 +1,202 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+)
+
+// Running tasks reload the fields of models.ReloadableConfig without
+// restarting: the applier its throttle and its number of workers, the
+// extractor the where predicates of its tables. The binlog stream is kept.
+// A full copy in progress keeps the predicates it started with.
+
+// Reload applies the fields of cfg to the applier. The workers are added
+// or removed once the transactions being applied are committed.
+func (a *Applier) Reload(cfg map[string]interface{}, fields []string) error {
+	var driverConfig config.MySQLDriverConfig
+	if err := mapstructure.WeakDecode(cfg, &driverConfig); err != nil {
+		return err
+	}
+	driverConfig.SetDefault()
+
+	throttle := false
+	for _, field := range fields {
+		switch field {
+		case "ThrottleBytesPerSecond", "ThrottleRowsPerSecond":
+			throttle = true
+		case "ParallelWorkers":
+			if err := a.setParallelWorkers(driverConfig.ParallelWorkers); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("the applier can't reload %s", field)
+		}
+	}
+	if throttle {
+		return a.SetThrottle(driverConfig.ThrottleBytesPerSecond, driverConfig.ThrottleRowsPerSecond)
+	}
+	return nil
+}
+
+// setParallelWorkers has the applier apply with n workers, from the next
+// transaction it receives on
+func (a *Applier) setParallelWorkers(n int) error {
+	if !a.mysqlContext.ApproveHeterogeneous {
+		return fmt.Errorf("ParallelWorkers can only be reloaded with ApproveHeterogeneous")
+	}
+	if strings.HasPrefix(a.mysqlContext.MySQLVersion, "5.6") {
+		return fmt.Errorf("MySQL %s is applied to by a single worker", a.mysqlContext.MySQLVersion)
+	}
+	// A resize not done yet is replaced
+	select {
+	case <-a.workersCh:
+	default:
+	}
+	a.workersCh <- n
+	return nil
+}
+
+// startMtsWorkers starts a worker per connection of the applier
+func (a *Applier) startMtsWorkers() {
+	a.workersStopCh = make(chan struct{})
+	atomic.StoreInt64(&a.parallelWorkers, int64(a.mysqlContext.ParallelWorkers))
+	for i := 0; i < a.mysqlContext.ParallelWorkers; i++ {
+		a.workersWg.Add(1)
+		go func(workerIndex int, stopCh chan struct{}) {
+			defer a.workersWg.Done()
+			a.MtsWorker(workerIndex, stopCh)
+		}(i, a.workersStopCh)
+	}
+}
+
+// resizeWorkers stops the workers, opens or closes connections for n
+// workers to apply, and starts them again. The transactions received must
+// all be committed.
+func (a *Applier) resizeWorkers(n int) error {
+	if n == a.mysqlContext.ParallelWorkers {
+		return nil
+	}
+	close(a.workersStopCh)
+	a.workersWg.Wait()
+
+	a.db.SetMaxOpenConns(maxOpenConns(a.mysqlContext, n))
+	conns := workerConns(a.mysqlContext, n)
+	if conns > len(a.dbs) {
+		dbs, err := sql.CreateConns(a.db, conns-len(a.dbs))
+		if err != nil {
+			return err
+		}
+		for _, db := range dbs {
+			if err := a.prepareGtidExecutedStmts(db); err != nil {
+				return err
+			}
+		}
+		a.dbs = append(a.dbs, dbs...)
+	} else {
+		if err := sql.CloseConns(a.dbs[conns:]...); err != nil {
+			return err
+		}
+		a.dbs = a.dbs[:conns]
+	}
+	a.setConnPool(newConnPool(len(a.dbs)))
+	a.warnMaxConnections(n)
+	// The statements are prepared again on the connections of the workers
+	for _, schemaItem := range a.tableItems {
+		for _, tableItem := range schemaItem {
+			tableItem.resize(n)
+		}
+	}
+
+	a.logger.Printf("mysql.applier: Applying with %d workers instead of %d", n, a.mysqlContext.ParallelWorkers)
+	a.mysqlContext.ParallelWorkers = n
+	a.startMtsWorkers()
+	return nil
+}
+
+// resize closes the statements of the item, and makes room for those of
+// parallelWorkers workers
+func (ait *applierTableItem) resize(parallelWorkers int) {
+	closeStmts := func(stmts []*gosql.Stmt) []*gosql.Stmt {
+		for _, stmt := range stmts {
+			if stmt != nil {
+				stmt.Close()
+			}
+		}
+		return make([]*gosql.Stmt, parallelWorkers)
+	}
+	ait.psInsert = closeStmts(ait.psInsert)
+	ait.psDelete = closeStmts(ait.psDelete)
+	ait.psUpdate = closeStmts(ait.psUpdate)
+	ait.resetBatchStmts(parallelWorkers)
+	for _, item := range ait.routed {
+		item.resize(parallelWorkers)
+	}
+}
+
+// Reload applies the where predicates of the tables of ReplicateDoDb in cfg
+// to the rows the extractor streams from the binlog
+func (e *Extractor) Reload(cfg map[string]interface{}, fields []string) error {
+	var driverConfig config.MySQLDriverConfig
+	if err := mapstructure.WeakDecode(cfg, &driverConfig); err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if field != "ReplicateDoDb" {
+			return fmt.Errorf("the extractor can't reload %s", field)
+		}
+	}
+
+	if !e.mysqlContext.ApproveHeterogeneous {
+		return fmt.Errorf("the where predicates can only be reloaded with ApproveHeterogeneous")
+	}
+	e.reloadLock.Lock()
+	defer e.reloadLock.Unlock()
+	if e.binlogReader == nil {
+		return fmt.Errorf("the where predicates can only be reloaded once the binlog is streamed, after the copy of the tables")
+	}
+	for _, doDb := range driverConfig.ReplicateDoDb {
+		for _, tb := range doDb.Tables {
+			table := e.lookupTable(doDb.TableSchema, tb.TableName)
+			if table == nil {
+				return fmt.Errorf("%s.%s is not replicated", doDb.TableSchema, tb.TableName)
+			}
+			where := tb.Where
+			if where == "" {
+				where = "true"
+			}
+			if err := e.binlogReader.SetWhere(table, where); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookupTable returns the table schema.name the extractor replicates, nil
+// if it doesn't
+func (e *Extractor) lookupTable(schema, name string) *config.Table {
+	for _, db := range e.replicateDoDb {
+		if db.TableSchema != schema {
+			continue
+		}
+		for _, tb := range db.Tables {
+			if tb.TableName == name {
+				return tb
+			}
+		}
+	}
+	return nil
+}
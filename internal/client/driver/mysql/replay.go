@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/satori/go.uuid"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+)
+
+// replayProgressInterval is how often the applier of a replay reports how
+// far it went
+const replayProgressInterval = 10 * time.Second
+
+// replayRange is the transactions a replay applies again: for each source
+// uuid, from the gno of GtidStart to the gno of GtidStop
+type replayRange struct {
+	start map[uuid.UUID]int64
+	stop  map[uuid.UUID]int64
+	// reached holds the uuids whose last transaction was read
+	reached map[uuid.UUID]bool
+
+	applied    int64
+	lastReport time.Time
+}
+
+// ValidateReplayRange checks that gtidStart and gtidStop, both "uuid:gno"
+// for the same uuids, bound a replay
+func ValidateReplayRange(gtidStart, gtidStop string) error {
+	_, err := parseReplayRange(gtidStart, gtidStop)
+	return err
+}
+
+func parseReplayRange(gtidStart, gtidStop string) (*replayRange, error) {
+	start, err := parseGtidPoints(gtidStart)
+	if err != nil {
+		return nil, fmt.Errorf("bad GtidStart %q: %v", gtidStart, err)
+	}
+	stop, err := parseGtidPoints(gtidStop)
+	if err != nil {
+		return nil, fmt.Errorf("bad GtidStop %q: %v", gtidStop, err)
+	}
+	if len(start) == 0 {
+		return nil, fmt.Errorf("GtidStart is empty")
+	}
+	if len(start) != len(stop) {
+		return nil, fmt.Errorf("GtidStart %q and GtidStop %q must have the same uuids", gtidStart, gtidStop)
+	}
+	for sid, gno := range start {
+		stopGno, ok := stop[sid]
+		if !ok {
+			return nil, fmt.Errorf("GtidStop %q has no transaction of %v", gtidStop, sid)
+		}
+		if stopGno < gno {
+			return nil, fmt.Errorf("GtidStop %v:%d is before GtidStart %v:%d", sid, stopGno, sid, gno)
+		}
+	}
+	return &replayRange{
+		start:      start,
+		stop:       stop,
+		reached:    make(map[uuid.UUID]bool),
+		lastReport: time.Now(),
+	}, nil
+}
+
+// parseGtidPoints parses "uuid:gno,..." with a single transaction per uuid
+func parseGtidPoints(s string) (map[uuid.UUID]int64, error) {
+	set, err := gomysql.ParseMysqlGTIDSet(s)
+	if err != nil {
+		return nil, err
+	}
+	points := make(map[uuid.UUID]int64)
+	for _, uuidSet := range set.(*gomysql.MysqlGTIDSet).Sets {
+		if len(uuidSet.Intervals) != 1 || uuidSet.Intervals[0].Start+1 != uuidSet.Intervals[0].Stop {
+			return nil, fmt.Errorf("want a single transaction of %v", uuidSet.SID)
+		}
+		points[uuidSet.SID] = uuidSet.Intervals[0].Start
+	}
+	return points, nil
+}
+
+// contains tells whether the transaction at c is one of the range
+func (r *replayRange) contains(c *base.BinlogCoordinateTx) bool {
+	start, ok := r.start[c.SID]
+	return ok && c.GNO >= start && c.GNO <= r.stop[c.SID]
+}
+
+// reach records that the transaction at c was read, and returns whether
+// the last transaction of every uuid was
+func (r *replayRange) reach(c *base.BinlogCoordinateTx) bool {
+	if stop, ok := r.stop[c.SID]; ok && c.GNO >= stop {
+		r.reached[c.SID] = true
+	}
+	return len(r.reached) == len(r.stop)
+}
+
+// progress counts a transaction applied at c, and returns what to report
+// of the replay, if it is time to
+func (r *replayRange) progress(c *base.BinlogCoordinateTx) (string, bool) {
+	r.applied++
+	if time.Since(r.lastReport) < replayProgressInterval {
+		return "", false
+	}
+	r.lastReport = time.Now()
+	return fmt.Sprintf("replay of %v: %d transactions applied, at %v:%d", r, r.applied, c.SID, c.GNO), true
+}
+
+// String returns the range as a GTID set
+func (r *replayRange) String() string {
+	var intervals []string
+	for sid, start := range r.start {
+		intervals = append(intervals, fmt.Sprintf("%v:%d-%d", sid, start, r.stop[sid]))
+	}
+	sort.Strings(intervals)
+	return strings.Join(intervals, ",")
+}
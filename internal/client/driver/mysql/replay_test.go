@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+)
+
+func TestParseReplayRange(t *testing.T) {
+	const (
+		sid1 = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+		sid2 = "5b2c1a3e-71ca-11e1-9e33-c80aa9429562"
+	)
+	tests := []struct {
+		start, stop string
+		wantErr     bool
+	}{
+		{sid1 + ":10", sid1 + ":20", false},
+		{sid1 + ":10," + sid2 + ":1", sid1 + ":10," + sid2 + ":5", false},
+		{sid1 + ":20", sid1 + ":10", true},
+		{sid1 + ":1-10", sid1 + ":20", true},
+		{sid1 + ":10", sid2 + ":20", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		if _, err := parseReplayRange(tt.start, tt.stop); (err != nil) != tt.wantErr {
+			t.Errorf("parseReplayRange(%q, %q) error = %v, wantErr %v", tt.start, tt.stop, err, tt.wantErr)
+		}
+	}
+
+	r, err := parseReplayRange(sid1+":10,"+sid2+":1", sid1+":20,"+sid2+":2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(sid string, gno int64) *base.BinlogCoordinateTx {
+		return &base.BinlogCoordinateTx{SID: uuid.FromStringOrNil(sid), GNO: gno}
+	}
+	if r.contains(at(sid1, 9)) || !r.contains(at(sid1, 10)) || !r.contains(at(sid1, 20)) || r.contains(at(sid1, 21)) {
+		t.Errorf("replayRange.contains() doesn't bound %v", r)
+	}
+	if r.contains(&base.BinlogCoordinateTx{}) {
+		t.Errorf("replayRange.contains() of a heartbeat = true")
+	}
+	if r.reach(at(sid1, 20)) {
+		t.Errorf("replayRange.reach() = true before the last transaction of %v", sid2)
+	}
+	if !r.reach(at(sid2, 2)) {
+		t.Errorf("replayRange.reach() = false after the last transactions")
+	}
+	if got, want := r.String(), sid1+":10-20,"+sid2+":1-2"; got != want {
+		t.Errorf("replayRange.String() = %q, want %q", got, want)
+	}
+}
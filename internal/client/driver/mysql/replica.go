@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+)
+
+// A source may itself be a replica of the primary. It logs the transactions
+// it replicates with the GTIDs they got on the primary, which the job
+// tracks, while the transactions executed on the replica itself, such as
+// errant writes, get the server_uuid of the replica: the job neither
+// replicates nor records those, so that its position stays valid on the
+// other servers of the topology, should the job move to another replica or
+// to the primary. The extractor writes no heartbeat to a replica either.
+
+// replicaSource is the replica the extractor reads from
+type replicaSource struct {
+	serverUUID string
+	masterHost string
+	masterPort int
+}
+
+// readReplicaSource returns the replica db is connected to, nil if the
+// server replicates from no other
+func readReplicaSource(db *gosql.DB) (*replicaSource, error) {
+	var r *replicaSource
+	err := sql.QueryRowsMap(db, "show slave status", func(m sql.RowMap) error {
+		r = &replicaSource{
+			masterHost: m.GetString("Master_Host"),
+			masterPort: m.GetInt("Master_Port"),
+		}
+		return nil
+	})
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	var logSlaveUpdates bool
+	if err := db.QueryRow("select @@global.log_slave_updates, @@global.server_uuid").Scan(&logSlaveUpdates, &r.serverUUID); err != nil {
+		return nil, err
+	}
+	if !logSlaveUpdates {
+		return nil, fmt.Errorf("the source is a replica of %s:%d that doesn't log the transactions it replicates: set log_slave_updates = ON",
+			r.masterHost, r.masterPort)
+	}
+	return r, nil
+}
+
+// lagSeconds returns how far the replica is behind the primary. It fails
+// while the replica applies nothing, its lag being unknown then.
+func (r *replicaSource) lagSeconds(db *gosql.DB) (int64, error) {
+	var lag gosql.NullInt64
+	found := false
+	err := sql.QueryRowsMap(db, "show slave status", func(m sql.RowMap) error {
+		found = true
+		lag = m.GetNullInt64("Seconds_Behind_Master")
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("the source no longer replicates from %s:%d", r.masterHost, r.masterPort)
+	}
+	if !lag.Valid {
+		return 0, fmt.Errorf("the replication of the source from %s:%d is stopped", r.masterHost, r.masterPort)
+	}
+	return lag.Int64, nil
+}
+
+// isLocalTx tells whether the transaction of the server sid was executed
+// on the replica itself
+func (r *replicaSource) isLocalTx(sid string) bool {
+	return r != nil && sid == r.serverUUID
+}
+
+// trackedGtidSet returns set without the transactions executed on the
+// replica itself, which the job doesn't track
+func (r *replicaSource) trackedGtidSet(set string) (string, error) {
+	if r == nil {
+		return set, nil
+	}
+	return base.GtidSetReplaceSid(set, r.serverUUID, "")
+}
+
+// streamedGtidSet returns the set the binlog streamer of the job at the
+// tracked set starts after: the transactions executed on the replica
+// itself are skipped, as far as executed holds them
+func (r *replicaSource) streamedGtidSet(set, executed string) (string, error) {
+	if r == nil {
+		return set, nil
+	}
+	return base.GtidSetReplaceSid(set, r.serverUUID, executed)
+}
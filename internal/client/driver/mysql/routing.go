@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// routeBinlogEntry sets the table items of the row events of the routed
+// tables of binlogEntry to those of their target tables. An update moving
+// a row to another target table becomes the delete of its old image and
+// the insert of its new one.
+func (a *Applier) routeBinlogEntry(binlogEntry *binlog.BinlogEntry) error {
+	var events []binlog.DataEvent
+	for i, event := range binlogEntry.Events {
+		var tb *config.Table
+		if event.DML != binlog.NotDML {
+			tb = a.tableConfig(event.DatabaseName, event.TableName)
+		}
+		if tb == nil || tb.Routing == nil {
+			if events != nil {
+				events = append(events, event)
+			}
+			continue
+		}
+		if events == nil {
+			events = append(events, binlogEntry.Events[:i]...)
+		}
+
+		source := a.getTableItem(event.DatabaseName, event.TableName)
+		route := func(values *umconf.ColumnValues) (*applierTableItem, error) {
+			return a.routedTableItem(source, tb, *values.AbstractValues[source.routeOrdinal])
+		}
+		if source.routed == nil {
+			if err := a.loadRouting(source, tb); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		switch event.DML {
+		case binlog.InsertDML:
+			event.TableItem, err = route(event.NewColumnValues)
+		case binlog.DeleteDML:
+			event.TableItem, err = route(event.WhereColumnValues)
+		case binlog.UpdateDML:
+			var from, to *applierTableItem
+			if from, err = route(event.WhereColumnValues); err != nil {
+				return err
+			}
+			if to, err = route(event.NewColumnValues); err != nil {
+				return err
+			}
+			if from != to {
+				// The row moves to another table
+				del, ins := event, event
+				del.DML, del.NewColumnValues, del.TableItem = binlog.DeleteDML, nil, from
+				ins.DML, ins.WhereColumnValues, ins.TableItem = binlog.InsertDML, nil, to
+				events = append(events, del, ins)
+				continue
+			}
+			event.TableItem = to
+		}
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+	}
+	if events != nil {
+		binlogEntry.Events = events
+	}
+	return nil
+}
+
+// loadRouting locates the key of the routed table tb in row images, from
+// the columns of the source table the extractor sent, or else from those
+// of its first target table
+func (a *Applier) loadRouting(source *applierTableItem, tb *config.Table) error {
+	var err error
+	columns := a.sourceTables.columns(tb.TableSchema, tb.TableName)
+	if columns == nil {
+		schema, _ := a.nameMapping.Table(tb.TableSchema, tb.TableName)
+		if columns, err = base.GetTableColumns(a.db, schema, tb.Routing.TargetTables()[0]); err != nil {
+			return err
+		}
+	}
+	source.routeOrdinal, err = routingOrdinal(columns, tb.Routing.Column)
+	if err != nil {
+		return err
+	}
+	source.routed = make(map[string]*applierTableItem)
+	return nil
+}
+
+// routedTableItem returns the item of the target table the row of tb whose
+// key holds value goes to
+func (a *Applier) routedTableItem(source *applierTableItem, tb *config.Table, value interface{}) (*applierTableItem, error) {
+	table, err := tb.Routing.Route(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s.%s: %v", tb.TableSchema, tb.TableName, err)
+	}
+	if item, ok := source.routed[table]; ok {
+		return item, nil
+	}
+
+	item := newApplierTableItem(a.mysqlContext.ParallelWorkers)
+	item.targetTable = table
+	schema, _ := a.nameMapping.Table(tb.TableSchema, tb.TableName)
+	if err := a.loadTableItem(item, tb.TableSchema, tb.TableName, schema, table); err != nil {
+		return nil, err
+	}
+	source.routed[table] = item
+	return item, nil
+}
+
+// routingOrdinal returns the ordinal of the key column in row images
+func routingOrdinal(columns *umconf.ColumnList, column string) (int, error) {
+	for i, col := range columns.Columns {
+		if strings.EqualFold(col.Name, column) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("routing column %v does not exist", column)
+}
+
+// routeDumpRows groups the rows of the copy of the routed table tb by
+// target table, in the order the tables first appear
+func routeDumpRows(tb *config.Table, ordinal int, rows [][]*interface{}) (tables []string, byTable map[string][][]*interface{}, err error) {
+	byTable = make(map[string][][]*interface{})
+	for _, row := range rows {
+		table, err := tb.Routing.Route(*row[ordinal])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s.%s: %v", tb.TableSchema, tb.TableName, err)
+		}
+		if _, ok := byTable[table]; !ok {
+			tables = append(tables, table)
+		}
+		byTable[table] = append(byTable[table], row)
+	}
+	return tables, byTable, nil
+}
+
+// ValidateRouting checks the routing of the tables of doDbs, and that all
+// their target tables exist and hold the key column
+func ValidateRouting(db sql.QueryAble, doDbs []*config.DataSource, mapping *sql.NameMapping) error {
+	for _, ds := range doDbs {
+		for _, tb := range ds.Tables {
+			if tb.Routing == nil {
+				continue
+			}
+			if err := tb.Routing.Validate(); err != nil {
+				return fmt.Errorf("%s.%s: %v", ds.TableSchema, tb.TableName, err)
+			}
+			schema, _ := mapping.Table(ds.TableSchema, tb.TableName)
+			for _, table := range tb.Routing.TargetTables() {
+				columns, err := base.GetTableColumns(db, schema, table)
+				if sql.IsNotExistsError(err) {
+					return fmt.Errorf("%s.%s: target table %s.%s does not exist", ds.TableSchema, tb.TableName, schema, table)
+				} else if err != nil {
+					return err
+				}
+				if _, err := routingOrdinal(columns, tb.Routing.Column); err != nil {
+					return fmt.Errorf("%s.%s: %v in %s.%s", ds.TableSchema, tb.TableName, err, schema, table)
+				}
+				if _, err := tb.ReplicatedColumns(columns); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func TestRouteDumpRows(t *testing.T) {
+	columns := umconf.NewColumnList([]umconf.Column{{Name: "id"}, {Name: "Region"}})
+	ordinal, err := routingOrdinal(columns, "region")
+	if err != nil || ordinal != 1 {
+		t.Fatalf("routingOrdinal() = %v, %v, want 1", ordinal, err)
+	}
+	if _, err := routingOrdinal(columns, "country"); err == nil {
+		t.Errorf("routingOrdinal() of an unknown column = nil error")
+	}
+
+	tb := config.NewTable("db1", "orders")
+	tb.Routing = &config.TableRouting{
+		Column:  "region",
+		Values:  map[string]string{"eu": "orders_eu", "us": "orders_us"},
+		Default: "orders_other",
+	}
+	row := func(id, region string) []*interface{} {
+		var v1, v2 interface{} = []byte(id), []byte(region)
+		if region == "" {
+			v2 = nil
+		}
+		return []*interface{}{&v1, &v2}
+	}
+	rows := [][]*interface{}{row("1", "us"), row("2", "eu"), row("3", "us"), row("4", "")}
+
+	tables, byTable, err := routeDumpRows(tb, ordinal, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"orders_us", "orders_eu", "orders_other"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("routeDumpRows() tables = %v, want %v", tables, want)
+	}
+	ids := func(rows [][]*interface{}) (ids []string) {
+		for _, r := range rows {
+			ids = append(ids, string((*r[0]).([]byte)))
+		}
+		return ids
+	}
+	for table, want := range map[string][]string{"orders_us": {"1", "3"}, "orders_eu": {"2"}, "orders_other": {"4"}} {
+		if got := ids(byTable[table]); !reflect.DeepEqual(got, want) {
+			t.Errorf("routeDumpRows() rows of %v = %v, want %v", table, got, want)
+		}
+	}
+
+	tb.Routing.Default = ""
+	if _, _, err := routeDumpRows(tb, ordinal, rows); err == nil {
+		t.Errorf("routeDumpRows() of a row without table = nil error")
+	}
+}
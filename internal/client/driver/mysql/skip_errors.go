@@ -0,0 +1,137 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/utils"
+)
+
+// maxSkippedStatement is how long the statements skipped are reported at
+// most
+const maxSkippedStatement = 1024
+
+// unskippableErrors fail the transaction, or the connection, rather than
+// the statement: skipping them would drop the statements before it too
+var unskippableErrors = map[uint16]bool{
+	sql.ErrLockDeadlock:        true,
+	sql.ErrLockWaitTimeout:     true,
+	sql.ErrQueryInterrupted:    true,
+	sql.ErrServerShutdown:      true,
+	sql.ErrErrorDuringCommit:   true,
+	sql.ErrErrorDuringRollback: true,
+}
+
+// skipErrors are the MySQL errors of SkipErrors, the applier skips the
+// statements of the binlog transactions failing with them
+type skipErrors struct {
+	numbers map[uint16]bool
+	// skipped is how many statements were skipped
+	skipped int64
+}
+
+// newSkipErrors returns the errors numbers, nil if there are none. Each
+// must be the number of an error of the MySQL server failing a statement
+// alone.
+func newSkipErrors(numbers []int) (*skipErrors, error) {
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+	s := &skipErrors{numbers: make(map[uint16]bool)}
+	for _, n := range numbers {
+		// The numbers from 2000 are those of the errors of the client
+		if n < int(sql.ErrErrorFirst) || n > math.MaxUint16 || (n >= 2000 && n < 3000) {
+			return nil, fmt.Errorf("SkipErrors: %d is not the number of an error of the MySQL server", n)
+		}
+		if unskippableErrors[uint16(n)] {
+			return nil, fmt.Errorf("SkipErrors: error %d fails the transaction rather than the statement, it can't be skipped", n)
+		}
+		s.numbers[uint16(n)] = true
+	}
+	return s, nil
+}
+
+// skips returns whether err is one of the errors to skip
+func (s *skipErrors) skips(err error) bool {
+	if s == nil {
+		return false
+	}
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && s.numbers[mysqlErr.Number]
+}
+
+// count returns how many statements were skipped
+func (s *skipErrors) count() int64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.skipped)
+}
+
+// skipError skips statement, which failed with err in the transaction of
+// where, if err is one of SkipErrors: the transaction goes on without it,
+// and it is logged and reported in a task event. It returns whether it
+// skipped it.
+func (a *Applier) skipError(err error, where, statement string) bool {
+	if !a.skipErrors.skips(err) {
+		return false
+	}
+	atomic.AddInt64(&a.skipErrors.skipped, 1)
+	message := fmt.Sprintf("skipped error in %s: %v, statement: %s", where, err,
+		utils.StrLim(statement, maxSkippedStatement))
+	a.logger.Warnf("mysql.applier: %s", message)
+	a.emit(message)
+	return true
+}
+
+// rowStatement returns the statement applying the row event, with its
+// args, to report it
+func (a *Applier) rowStatement(event binlog.DataEvent) string {
+	tableItem := event.TableItem.(*applierTableItem)
+	columns := tableItem.columns
+	schema, table := a.nameMapping.Table(event.DatabaseName, event.TableName)
+	if tableItem.targetTable != "" {
+		table = tableItem.targetTable
+	}
+	var query string
+	var args []interface{}
+	var err error
+	switch event.DML {
+	case binlog.InsertDML:
+		query, args, err = sql.BuildDMLInsertQuery(schema, table, columns, columns, columns,
+			event.NewColumnValues.GetAbstractValues())
+	case binlog.DeleteDML:
+		query, args, err = sql.BuildDMLDeleteQuery(schema, table, columns, event.WhereColumnValues.GetAbstractValues())
+	case binlog.UpdateDML:
+		var keyArgs []interface{}
+		query, args, keyArgs, err = sql.BuildDMLUpdateQuery(schema, table, columns, columns, columns, columns,
+			event.NewColumnValues.GetAbstractValues(), event.WhereColumnValues.GetAbstractValues())
+		args = append(args, keyArgs...)
+	default:
+		return fmt.Sprintf("%v on %s.%s", event.DML, schema, table)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v on %s.%s", event.DML, schema, table)
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			values[i] = "NULL"
+		} else {
+			values[i] = valueText(arg)
+		}
+	}
+	return fmt.Sprintf("%s [%s]", query, strings.Join(values, ", "))
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/satori/go.uuid"
+)
+
+func TestNewSkipErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		numbers []int
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"duplicate entry", []int{1062, 1452}, false},
+		{"not a server error", []int{999}, true},
+		{"client error", []int{2013}, true},
+		{"too large", []int{70000}, true},
+		{"deadlock", []int{1062, 1213}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSkipErrors(tt.numbers)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSkipErrors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (s == nil) != (len(tt.numbers) == 0) {
+				t.Errorf("newSkipErrors() = %v", s)
+			}
+		})
+	}
+
+	s, _ := newSkipErrors([]int{1062})
+	if !s.skips(&gomysql.MySQLError{Number: 1062}) || s.skips(&gomysql.MySQLError{Number: 1452}) ||
+		s.skips(fmt.Errorf("1062")) {
+		t.Errorf("skipErrors.skips() doesn't tell error 1062 alone")
+	}
+}
+
+func TestApplier_ApplyBinlogEvent_SkipErrors(t *testing.T) {
+	a, server, stop := newBatchApplier(t, &config.MySQLDriverConfig{ApplyBatchSize: 3})
+	defer stop()
+	var events []string
+	a.emitEvent = func(message string, args ...interface{}) {
+		events = append(events, fmt.Sprintf(message, args...))
+	}
+	var err error
+	if a.skipErrors, err = newSkipErrors([]int{int(sql.ErrNoReferencedRow2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	item := newApplierTableItem(1)
+	item.columns = umconf.NewColumnList([]umconf.Column{{Name: "id", Key: "PRI"}, {Name: "v"}})
+	var rows []binlog.DataEvent
+	for id, v := range []string{"a", "bad", "c"} {
+		e := binlog.NewDataEvent("db1", "t1", binlog.InsertDML, 2)
+		e.TableItem = item
+		e.NewColumnValues = umconf.ToColumnValues([]interface{}{int64(id + 1), v})
+		rows = append(rows, e)
+	}
+	sid := uuid.NewV4()
+	tx := &binlog.BinlogEntry{Coordinates: base.BinlogCoordinateTx{SID: sid, GNO: 1, SeqenceNumber: 1}, Events: rows}
+
+	// The rows are applied one by one, the transaction goes on without the
+	// bad one
+	if err := a.ApplyBinlogEvent(0, tx); err != nil {
+		t.Fatalf("ApplyBinlogEvent() error = %v", err)
+	}
+	want := []string{
+		"replace into db1.t1 (id, v) values (?, ?) [1 a]",
+		"replace into db1.t1 (id, v) values (?, ?) [3 c]",
+	}
+	if got := strings.Replace(strings.Join(server.execs, "\n"), "`", "", -1); got != strings.Join(want, "\n") {
+		t.Errorf("server executed\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+	if got := a.skipErrors.count(); got != 1 {
+		t.Errorf("skipErrors.count() = %d, want 1", got)
+	}
+	if len(events) != 1 || !strings.Contains(events[0], fmt.Sprintf("gtid %s:1", sid)) ||
+		!strings.Contains(events[0], "[2, bad]") {
+		t.Errorf("events = %q, want the statement skipped", events)
+	}
+}
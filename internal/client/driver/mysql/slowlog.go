@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+// slowLog logs the transactions the applier takes longer than a threshold
+// to apply, from a goroutine of its own so that the workers don't wait for
+// the log. Transactions coming faster than they are logged are counted but
+// not logged.
+type slowLog struct {
+	threshold time.Duration
+	logger    *log.Entry
+	ch        chan *slowTransaction
+
+	// count is how many transactions were slow, dropped how many of them
+	// were not logged yet
+	count   int64
+	dropped int64
+}
+
+// slowTransaction is a transaction the applier took long to apply
+type slowTransaction struct {
+	gtid     string
+	duration time.Duration
+	rows     int64
+	// tables are the tables of the target it wrote to
+	tables []string
+}
+
+// newSlowLog returns the log of the transactions applied in threshold
+// milliseconds or more, nil to log none if threshold is not positive
+func newSlowLog(threshold int, logger *log.Entry) *slowLog {
+	if threshold <= 0 {
+		return nil
+	}
+	return &slowLog{
+		threshold: time.Duration(threshold) * time.Millisecond,
+		logger:    logger,
+		ch:        make(chan *slowTransaction, 64),
+	}
+}
+
+// slow returns whether a transaction applied in duration is logged
+func (l *slowLog) slow(duration time.Duration) bool {
+	return l != nil && duration >= l.threshold
+}
+
+// add counts the slow transaction tx, and queues it to be logged
+func (l *slowLog) add(tx *slowTransaction) {
+	atomic.AddInt64(&l.count, 1)
+	select {
+	case l.ch <- tx:
+	default:
+		atomic.AddInt64(&l.dropped, 1)
+	}
+}
+
+// run logs the queued transactions until stopCh is closed
+func (l *slowLog) run(stopCh chan struct{}) {
+	for {
+		select {
+		case tx := <-l.ch:
+			l.logger.Warnf("mysql.applier: slow transaction %s: applied in %v, %d rows, tables %s",
+				tx.gtid, tx.duration, tx.rows, strings.Join(tx.tables, ","))
+			if dropped := atomic.SwapInt64(&l.dropped, 0); dropped > 0 {
+				l.logger.Warnf("mysql.applier: %d more slow transactions were not logged", dropped)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// slowTransactions returns how many transactions were slow
+func (l *slowLog) slowTransactions() int64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&l.count)
+}
+
+// entryTables returns the tables of the target the transaction binlogEntry
+// writes to, sorted
+func (a *Applier) entryTables(binlogEntry *binlog.BinlogEntry) []string {
+	seen := make(map[string]bool)
+	var tables []string
+	for _, event := range binlogEntry.Events {
+		if event.TableName == "" {
+			continue
+		}
+		schema := event.DatabaseName
+		if schema == "" {
+			schema = event.CurrentSchema
+		}
+		schema, table := a.nameMapping.Table(schema, event.TableName)
+		if item, ok := event.TableItem.(*applierTableItem); ok && item.targetTable != "" {
+			table = item.targetTable
+		}
+		name := schema + "." + table
+		if !seen[name] {
+			seen[name] = true
+			tables = append(tables, name)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
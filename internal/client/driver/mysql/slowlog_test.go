@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestSlowLog(t *testing.T) {
+	if l := newSlowLog(0, nil); l != nil || l.slow(time.Hour) || l.slowTransactions() != 0 {
+		t.Fatalf("newSlowLog(0) = %v, want nil logging nothing", l)
+	}
+
+	var buf bytes.Buffer
+	l := newSlowLog(100, log.NewEntry(log.New(&buf, log.WarnLevel)))
+	if l.slow(99*time.Millisecond) || !l.slow(100*time.Millisecond) {
+		t.Errorf("slowLog.slow() is not from the threshold of 100ms on")
+	}
+
+	// One more than the queue holds
+	for i := 0; i <= cap(l.ch); i++ {
+		l.add(&slowTransaction{
+			gtid:     fmt.Sprintf("00000000-0000-0000-0000-000000000001:%d", i+1),
+			duration: time.Second,
+			rows:     3,
+			tables:   []string{"db1.t1", "db1.t2"},
+		})
+	}
+	if got := l.slowTransactions(); got != int64(cap(l.ch)+1) {
+		t.Errorf("slowLog.slowTransactions() = %v, want %v", got, cap(l.ch)+1)
+	}
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		l.run(stopCh)
+		close(done)
+	}()
+	for len(l.ch) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(stopCh)
+	<-done
+
+	logged := buf.String()
+	for _, want := range []string{
+		"slow transaction 00000000-0000-0000-0000-000000000001:1: applied in 1s, 3 rows, tables db1.t1,db1.t2",
+		"1 more slow transactions were not logged",
+	} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("slowLog logged %q, want it to hold %q", logged, want)
+		}
+	}
+}
+
+func TestApplier_entryTables(t *testing.T) {
+	a := &Applier{}
+	routed := newApplierTableItem(1)
+	routed.targetTable = "orders_eu"
+	entry := &binlog.BinlogEntry{Events: []binlog.DataEvent{
+		{DatabaseName: "db1", TableName: "t2", DML: binlog.InsertDML},
+		{CurrentSchema: "db1", TableName: "t1", DML: binlog.NotDML},
+		{DatabaseName: "db1", TableName: "orders", DML: binlog.UpdateDML, TableItem: routed},
+		{DatabaseName: "db1", TableName: "t2", DML: binlog.DeleteDML},
+		{CurrentSchema: "db1", DML: binlog.NotDML},
+	}}
+	want := []string{"db1.orders_eu", "db1.t1", "db1.t2"}
+	if got := a.entryTables(entry); !reflect.DeepEqual(got, want) {
+		t.Errorf("Applier.entryTables() = %v, want %v", got, want)
+	}
+}
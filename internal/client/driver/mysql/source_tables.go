@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// sourceTables holds the columns of the source tables the extractor sends
+// with their first rows, in the order of their row images, by table
+type sourceTables struct {
+	sync.Mutex
+	tables map[string]*umconf.ColumnList
+}
+
+// learn takes the columns of the tables of the row events of binlogEntry
+// which carry their definition. It returns the tables whose definition
+// changed since it was last learnt.
+func (s *sourceTables) learn(binlogEntry *binlog.BinlogEntry) (changed []binlog.SchemaTable) {
+	for i := range binlogEntry.Events {
+		event := &binlogEntry.Events[i]
+		if event.Table == nil || event.Table.OriginalTableColumns == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s.%s", event.DatabaseName, event.TableName)
+		s.Lock()
+		if s.tables == nil {
+			s.tables = make(map[string]*umconf.ColumnList)
+		}
+		if known, ok := s.tables[key]; ok && !reflect.DeepEqual(known.Columns, event.Table.OriginalTableColumns.Columns) {
+			changed = append(changed, binlog.SchemaTable{Schema: event.DatabaseName, Table: event.TableName})
+		}
+		s.tables[key] = event.Table.OriginalTableColumns
+		s.Unlock()
+	}
+	return changed
+}
+
+// columns returns the columns of schema.table, nil if the extractor sent
+// none
+func (s *sourceTables) columns(schema, table string) *umconf.ColumnList {
+	s.Lock()
+	defer s.Unlock()
+	return s.tables[fmt.Sprintf("%s.%s", schema, table)]
+}
+
+// charsets returns the charsets of the text columns of schema.table, nil
+// if the extractor sent none
+func (s *sourceTables) charsets(schema, table string) map[string]string {
+	columns := s.columns(schema, table)
+	if columns == nil {
+		return nil
+	}
+	charsets := make(map[string]string)
+	for _, column := range columns.Columns {
+		if column.Charset != "" {
+			charsets[column.Name] = column.Charset
+		}
+	}
+	return charsets
+}
+
+// sourceOrdinals returns columns, some columns of a target table, with the
+// ordinals of the same columns in source, the columns of the source table
+// in the order of its row images, so that they locate their values in the
+// rows of the source. Without source, the target is taken to have the
+// columns of the source in the same order and columns is returned as is.
+func sourceOrdinals(columns, source *umconf.ColumnList) (*umconf.ColumnList, error) {
+	if source == nil {
+		return columns, nil
+	}
+	ordinals := make(map[string]int, len(source.Columns))
+	for i, column := range source.Columns {
+		ordinals[strings.ToLower(column.Name)] = i
+	}
+	result := &umconf.ColumnList{Columns: columns.Columns, Ordinals: umconf.NewEmptyColumnsMap()}
+	for _, column := range columns.Columns {
+		ordinal, ok := ordinals[strings.ToLower(column.Name)]
+		if !ok {
+			return nil, fmt.Errorf("column %v of the target is not a column of the source, leave it out with ExcludeColumns", column.Name)
+		}
+		result.Ordinals[column.Name] = ordinal
+	}
+	return result, nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+func Test_sourceOrdinals(t *testing.T) {
+	var tables sourceTables
+	tables.learn(&binlog.BinlogEntry{Events: []binlog.DataEvent{{
+		DatabaseName: "db1",
+		TableName:    "t1",
+		Table: &config.Table{OriginalTableColumns: umconf.NewColumnList([]umconf.Column{
+			{Name: "id"}, {Name: "name"}, {Name: "price"}, {Name: "note"},
+		})},
+	}}})
+	source := tables.columns("db1", "t1")
+	if source == nil || tables.columns("db1", "t2") != nil {
+		t.Fatalf("sourceTables.columns() = %v", source)
+	}
+
+	// The target has the columns in another order, the filter left note out
+	target := umconf.NewColumnList([]umconf.Column{{Name: "ID"}, {Name: "price"}, {Name: "name"}})
+	got, err := sourceOrdinals(target, source)
+	if err != nil {
+		t.Fatalf("sourceOrdinals() error = %v", err)
+	}
+	for name, want := range map[string]int{"ID": 0, "price": 2, "name": 1} {
+		if got.Ordinals[name] != want {
+			t.Errorf("sourceOrdinals() ordinal of %v = %v, want %v", name, got.Ordinals[name], want)
+		}
+	}
+	if target.Ordinals["price"] != 1 {
+		t.Errorf("sourceOrdinals() changed the ordinals of the target to %v", target.Ordinals)
+	}
+
+	if got, err := sourceOrdinals(target, nil); err != nil || got != target {
+		t.Errorf("sourceOrdinals() without source = %v, %v, want the target as is", got, err)
+	}
+	extra := umconf.NewColumnList([]umconf.Column{{Name: "id"}, {Name: "created_at"}})
+	if _, err := sourceOrdinals(extra, source); err == nil {
+		t.Errorf("sourceOrdinals() of a column missing on the source = nil error")
+	}
+}
+
+func TestApplier_resetTableItems(t *testing.T) {
+	a := &Applier{
+		logger:       log.NewEntry(log.New(ioutil.Discard, log.ErrorLevel)),
+		mysqlContext: &config.MySQLDriverConfig{ParallelWorkers: 1},
+		tableItems:   make(mapSchemaTableItems),
+		mtsManager:   NewMtsManager(make(chan struct{})),
+	}
+	definition := func(columns ...umconf.Column) *binlog.BinlogEntry {
+		return &binlog.BinlogEntry{Events: []binlog.DataEvent{{
+			DatabaseName: "db1",
+			TableName:    "t1",
+			Table:        &config.Table{OriginalTableColumns: umconf.NewColumnList(columns)},
+		}}}
+	}
+	if changed := a.sourceTables.learn(definition(umconf.Column{Name: "id"}, umconf.Column{Name: "name", Charset: "latin1"})); changed != nil {
+		t.Errorf("sourceTables.learn() of a first definition = %v", changed)
+	}
+	item := a.getTableItem("db1", "t1")
+	item.columns = umconf.NewColumnList([]umconf.Column{{Name: "id"}, {Name: "name"}})
+	item.transcoders = []*columnTranscoder{{column: "name", ordinal: 1, source: "latin1", target: "utf8mb4"}}
+
+	// The extractor sends the same definition again once it restarts
+	changed := a.sourceTables.learn(definition(umconf.Column{Name: "id"}, umconf.Column{Name: "name", Charset: "latin1"}))
+	if changed != nil || !a.resetTableItems(changed) || item.transcoders == nil {
+		t.Fatalf("sourceTables.learn() of the same definition = %v", changed)
+	}
+
+	changed = a.sourceTables.learn(definition(umconf.Column{Name: "id"}, umconf.Column{Name: "name", Charset: "utf8mb4"}))
+	if len(changed) != 1 || changed[0] != (binlog.SchemaTable{Schema: "db1", Table: "t1"}) {
+		t.Fatalf("sourceTables.learn() of a new definition = %v", changed)
+	}
+	if !a.resetTableItems(changed) {
+		t.Fatalf("Applier.resetTableItems() = false")
+	}
+	if item.columns != nil || item.transcoders != nil {
+		t.Errorf("Applier.resetTableItems() left the item loaded: %v, %v", item.columns, item.transcoders)
+	}
+}
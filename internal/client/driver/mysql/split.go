@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"context"
+	gosql "database/sql"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/binlog"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/g"
+
+	"github.com/satori/go.uuid"
+)
+
+// splitProgress holds how many events of the transactions split by the
+// applier are committed, by GTID. Each part but the last inserts a row in
+// the split progress table in its transaction, the last one deletes them
+// together with inserting the checkpoint of the transaction, so the
+// target holds either the events of the parts and where they end, or
+// neither.
+type splitProgress struct {
+	sync.Mutex
+	events map[string]int
+}
+
+// get returns how many events of the transaction gtid are committed
+func (p *splitProgress) get(gtid string) int {
+	p.Lock()
+	defer p.Unlock()
+	return p.events[gtid]
+}
+
+func (p *splitProgress) set(gtid string, events int) {
+	p.Lock()
+	defer p.Unlock()
+	if p.events == nil {
+		p.events = make(map[string]int)
+	}
+	if events == 0 {
+		delete(p.events, gtid)
+	} else {
+		p.events[gtid] = events
+	}
+}
+
+// createTableSplitProgress creates the split progress table, for the
+// parts of the transactions split
+func (a *Applier) createTableSplitProgress() error {
+	query := fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %v.%v (
+				job_uuid binary(16) NOT NULL COMMENT 'unique identifier of job',
+				source_uuid binary(16) NOT NULL COMMENT 'uuid of the source where the transaction was originally executed.',
+				gno bigint NOT NULL COMMENT 'number of the transaction.',
+				events bigint NOT NULL COMMENT 'number of events of the transaction committed.',
+				PRIMARY KEY (job_uuid, source_uuid, gno, events)
+			);
+		`, g.DtleSchemaName, g.SplitProgressTableV2)
+	_, err := sql.Exec(a.db, query)
+	return err
+}
+
+// loadSplitProgress reads how far the transactions split are committed.
+// The table doesn't exist if no transaction was ever split.
+func (a *Applier) loadSplitProgress() error {
+	query := fmt.Sprintf(`SELECT source_uuid, gno, max(events) FROM %v.%v where job_uuid=? group by source_uuid, gno`,
+		g.DtleSchemaName, g.SplitProgressTableV2)
+	rows, err := a.db.Query(query, a.subjectUUID.Bytes())
+	if sql.IsNotExistsError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sidBytes []byte
+		var gno int64
+		var events int
+		if err := rows.Scan(&sidBytes, &gno, &events); err != nil {
+			return err
+		}
+		sid, err := uuid.FromBytes(sidBytes)
+		if err != nil {
+			return err
+		}
+		gtid := fmt.Sprintf("%s:%d", sid, gno)
+		a.logger.Warnf("mysql.applier: %d events of the split transaction %s are committed, applying the rest", events, gtid)
+		a.splits.set(gtid, events)
+	}
+	return rows.Err()
+}
+
+// splittable returns whether the applier commits the transaction
+// binlogEntry in parts: it holds more rows than SplitTransactionRows, and
+// no DDL
+func (a *Applier) splittable(binlogEntry *binlog.BinlogEntry) bool {
+	limit := a.mysqlContext.SplitTransactionRows
+	if limit <= 0 || len(binlogEntry.Events) <= limit {
+		return false
+	}
+	for _, event := range binlogEntry.Events {
+		if event.DML == binlog.NotDML {
+			return false
+		}
+	}
+	return true
+}
+
+// applySplit commits the parts of the transaction binlogEntry but the last,
+// SplitTransactionRows events each, from the first event not committed
+// yet on. It returns where the last part begins, 0 if the transaction is
+// not split.
+func (a *Applier) applySplit(workerIdx int, binlogEntry *binlog.BinlogEntry, replaying bool) (int, error) {
+	gtid := binlogEntry.Coordinates.GetGtidForThisTx()
+	from := a.splits.get(gtid)
+	if !a.splittable(binlogEntry) {
+		// A transaction split with another SplitTransactionRows
+		return from, nil
+	}
+	limit := a.mysqlContext.SplitTransactionRows
+	if from == 0 {
+		a.logger.Warnf("mysql.applier: splitting transaction %s of %d rows in parts of %d rows, the target holds it partially until the last one is committed",
+			gtid, len(binlogEntry.Events), limit)
+	}
+
+	insert := fmt.Sprintf("insert into %v.%v (job_uuid,source_uuid,gno,events) values (unhex('%s'), ?, ?, ?)",
+		g.DtleSchemaName, g.SplitProgressTableV2, hex.EncodeToString(a.subjectUUID.Bytes()))
+	for from+limit < len(binlogEntry.Events) {
+		to := from + limit
+		err := func() (err error) {
+			tx, err := a.dbs[workerIdx].Db.BeginTx(context.Background(), &gosql.TxOptions{})
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err != nil {
+					tx.Rollback()
+				} else {
+					err = tx.Commit()
+				}
+			}()
+			if _, err = a.applyEvents(tx, workerIdx, binlogEntry, from, to, replaying); err != nil {
+				return err
+			}
+			_, err = tx.Exec(insert, binlogEntry.Coordinates.SID.Bytes(), binlogEntry.Coordinates.GNO, to)
+			return err
+		}()
+		if err != nil {
+			return 0, err
+		}
+		a.splits.set(gtid, to)
+		a.logger.Debugf("mysql.applier: committed %d/%d events of the split transaction %s", to, len(binlogEntry.Events), gtid)
+		from = to
+	}
+	return from, nil
+}
+
+// deleteSplitProgress deletes the progress of the split transaction at
+// coordinates in tx, which commits its last part
+func (a *Applier) deleteSplitProgress(tx *gosql.Tx, coordinates base.BinlogCoordinateTx) error {
+	query := fmt.Sprintf("delete from %v.%v where job_uuid = unhex('%s') and source_uuid = ? and gno = ?",
+		g.DtleSchemaName, g.SplitProgressTableV2, hex.EncodeToString(a.subjectUUID.Bytes()))
+	_, err := tx.Exec(query, coordinates.SID.Bytes(), coordinates.GNO)
+	return err
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package sql
+
+import (
+	"fmt"
+	"strings"
+
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+)
+
+// BuildDMLBatchInsertQuery builds a statement replacing the rows of all the
+// row images of rows at once, like BuildDMLInsertQuery does for one
+func BuildDMLBatchInsertQuery(databaseName, tableName string, tableColumns *umconf.ColumnList, rows [][]*interface{}) (result string, sharedArgs []interface{}, err error) {
+	if tableColumns.Len() == 0 {
+		return result, sharedArgs, fmt.Errorf("No shared columns found in BuildDMLBatchInsertQuery")
+	}
+	names := duplicateNames(tableColumns.Names())
+	for i := range names {
+		names[i] = EscapeName(names[i])
+	}
+	row := fmt.Sprintf("(%s)", strings.Join(buildColumnsPreparedValues(tableColumns), ", "))
+
+	values := make([]string, len(rows))
+	for i, args := range rows {
+		if len(args) < tableColumns.Len() {
+			return result, sharedArgs, fmt.Errorf("args count differs from table column count in BuildDMLBatchInsertQuery %v, %v",
+				len(args), tableColumns.Len())
+		}
+		sharedArgs = append(sharedArgs, buildInsertArgs(tableColumns, args)...)
+		values[i] = row
+	}
+
+	result = fmt.Sprintf(`
+			replace into
+				%s.%s
+					(%s)
+				values
+					%s
+		`, EscapeName(databaseName), EscapeName(tableName),
+		strings.Join(names, ", "),
+		strings.Join(values, ", "),
+	)
+	return result, sharedArgs, nil
+}
+
+// BuildDMLBatchDeleteQuery builds a statement deleting the rows of all the
+// row images of rows at once, like BuildDMLDeleteQuery does for one
+func BuildDMLBatchDeleteQuery(databaseName, tableName string, tableColumns *umconf.ColumnList, rows [][]*interface{}) (result string, columnArgs []interface{}, err error) {
+	comparisons := make([]string, len(rows))
+	for i, args := range rows {
+		if len(args) < tableColumns.Len() {
+			return result, columnArgs, fmt.Errorf("args count differs from table column count in BuildDMLBatchDeleteQuery %v, %v",
+				len(args), tableColumns.Len())
+		}
+		comparison, rowArgs, err := buildRowComparison(tableColumns, args)
+		if err != nil {
+			return result, columnArgs, err
+		}
+		comparisons[i] = comparison
+		columnArgs = append(columnArgs, rowArgs...)
+	}
+
+	result = fmt.Sprintf(`
+			delete
+				from
+					%s.%s
+				where
+					%s
+		`, EscapeName(databaseName), EscapeName(tableName),
+		strings.Join(comparisons, " or "),
+	)
+	return result, columnArgs, nil
+}
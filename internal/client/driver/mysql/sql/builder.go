@@ -113,22 +113,45 @@ func BuildSetPreparedClause(columns *umconf.ColumnList) (result string, err erro
 	}
 	setTokens := []string{}
 	for _, column := range columns.ColumnList() {
-		var setToken string
-		if column.TimezoneConversion != nil {
-			setToken = fmt.Sprintf("%s=convert_tz(?, '%s', '%s')", EscapeName(column.Name), column.TimezoneConversion.ToTimezone, "+00:00")
-		} else {
-			setToken = fmt.Sprintf("%s=?", EscapeName(column.Name))
-		}
-		setTokens = append(setTokens, setToken)
+		setTokens = append(setTokens, buildSetPreparedToken(column))
 	}
 	return strings.Join(setTokens, ", "), nil
 }
 
+// buildSetPreparedToken returns the assignment of the value of column in a
+// set clause
+func buildSetPreparedToken(column umconf.Column) string {
+	if column.TimezoneConversion != nil {
+		return fmt.Sprintf("%s=convert_tz(?, '%s', '%s')", EscapeName(column.Name), column.TimezoneConversion.ToTimezone, "+00:00")
+	}
+	return fmt.Sprintf("%s=?", EscapeName(column.Name))
+}
+
 func BuildDMLDeleteQuery(databaseName, tableName string, tableColumns *umconf.ColumnList, args []*interface{}) (result string, columnArgs []interface{}, err error) {
 	if len(args) < tableColumns.Len() {
 		return result, columnArgs, fmt.Errorf("args count differs from table column count in BuildDMLDeleteQuery %v, %v",
 			len(args), tableColumns.Len())
 	}
+	where, columnArgs, err := buildRowComparison(tableColumns, args)
+	if err != nil {
+		return result, columnArgs, err
+	}
+	databaseName = EscapeName(databaseName)
+	tableName = EscapeName(tableName)
+	result = fmt.Sprintf(`
+			delete
+				from
+					%s.%s
+				where
+					%s
+		`, databaseName, tableName, where,
+	)
+	return result, columnArgs, nil
+}
+
+// buildRowComparison returns the condition matching the row image args, on
+// its primary key if the table has one, and its arguments
+func buildRowComparison(tableColumns *umconf.ColumnList, args []*interface{}) (result string, columnArgs []interface{}, err error) {
 	comparisons := []string{}
 	uniqueKeyComparisons := []string{}
 	uniqueKeyArgs := make([]interface{}, 0)
@@ -174,21 +197,7 @@ func BuildDMLDeleteQuery(databaseName, tableName string, tableColumns *umconf.Co
 	if len(uniqueKeyArgs) > 0 {
 		columnArgs = uniqueKeyArgs
 	}
-	databaseName = EscapeName(databaseName)
-	tableName = EscapeName(tableName)
-	if err != nil {
-		return result, columnArgs, err
-	}
-	result = fmt.Sprintf(`
-			delete
-				from
-					%s.%s
-				where
-					%s
-		`, databaseName, tableName,
-		fmt.Sprintf("(%s)", strings.Join(comparisons, " and ")),
-	)
-	return result, columnArgs, nil
+	return fmt.Sprintf("(%s)", strings.Join(comparisons, " and ")), columnArgs, nil
 }
 
 func BuildDMLInsertQuery(databaseName, tableName string, tableColumns, sharedColumns, mappedSharedColumns *umconf.ColumnList, args []*interface{}) (result string, sharedArgs []interface{}, err error) {
@@ -206,6 +215,29 @@ func BuildDMLInsertQuery(databaseName, tableName string, tableColumns, sharedCol
 	databaseName = EscapeName(databaseName)
 	tableName = EscapeName(tableName)
 
+	sharedArgs = buildInsertArgs(tableColumns, args)
+
+	mappedSharedColumnNames := duplicateNames(tableColumns.Names())
+	for i := range mappedSharedColumnNames {
+		mappedSharedColumnNames[i] = EscapeName(mappedSharedColumnNames[i])
+	}
+	preparedValues := buildColumnsPreparedValues(tableColumns)
+
+	result = fmt.Sprintf(`
+			replace into
+				%s.%s
+					(%s)
+				values
+					(%s)
+		`, databaseName, tableName,
+		strings.Join(mappedSharedColumnNames, ", "),
+		strings.Join(preparedValues, ", "),
+	)
+	return result, sharedArgs, nil
+}
+
+// buildInsertArgs returns the values of the columns of the row image args
+func buildInsertArgs(tableColumns *umconf.ColumnList, args []*interface{}) (sharedArgs []interface{}) {
 	for _, column := range tableColumns.ColumnList() {
 		tableOrdinal := tableColumns.Ordinals[column.Name]
 		if *args[tableOrdinal] == nil {
@@ -215,22 +247,45 @@ func BuildDMLInsertQuery(databaseName, tableName string, tableColumns, sharedCol
 			sharedArgs = append(sharedArgs, arg)
 		}
 	}
+	return sharedArgs
+}
 
-	mappedSharedColumnNames := duplicateNames(tableColumns.Names())
-	for i := range mappedSharedColumnNames {
-		mappedSharedColumnNames[i] = EscapeName(mappedSharedColumnNames[i])
+// BuildDMLUpsertQuery returns the insert of the columns of tableColumns of
+// the row image args which, on the rows holding any of its keys, updates
+// them only, leaving the other columns of these rows as they are
+func BuildDMLUpsertQuery(databaseName, tableName string, tableColumns *umconf.ColumnList, args []*interface{}) (result string, sharedArgs []interface{}, err error) {
+	if len(args) < tableColumns.Len() {
+		return result, sharedArgs, fmt.Errorf("args count differs from table column count in BuildDMLUpsertQuery %v, %v",
+			len(args), tableColumns.Len())
+	}
+	if tableColumns.Len() == 0 {
+		return result, sharedArgs, fmt.Errorf("No columns found in BuildDMLUpsertQuery")
+	}
+	databaseName = EscapeName(databaseName)
+	tableName = EscapeName(tableName)
+
+	sharedArgs = buildInsertArgs(tableColumns, args)
+
+	names := make([]string, tableColumns.Len())
+	updates := make([]string, tableColumns.Len())
+	for i, name := range tableColumns.Names() {
+		names[i] = EscapeName(name)
+		updates[i] = fmt.Sprintf("%s=values(%s)", names[i], names[i])
 	}
 	preparedValues := buildColumnsPreparedValues(tableColumns)
 
 	result = fmt.Sprintf(`
-			replace into
+			insert into
 				%s.%s
 					(%s)
 				values
 					(%s)
+				on duplicate key update
+					%s
 		`, databaseName, tableName,
-		strings.Join(mappedSharedColumnNames, ", "),
+		strings.Join(names, ", "),
 		strings.Join(preparedValues, ", "),
+		strings.Join(updates, ", "),
 	)
 	return result, sharedArgs, nil
 }
@@ -253,6 +308,31 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 	databaseName = EscapeName(databaseName)
 	tableName = EscapeName(tableName)
 
+	sharedArgs = buildUpdateArgs(tableColumns, valueArgs)
+	where, columnArgs, err := buildUpdateComparison(tableColumns, whereArgs)
+	if err != nil {
+		return result, sharedArgs, columnArgs, err
+	}
+	setClause, err := BuildSetPreparedClause(mappedSharedColumns)
+
+	result = fmt.Sprintf(`
+ 			update
+ 					%s.%s
+				set
+					%s
+				where
+ 					%s
+ 				limit 1
+ 		`, databaseName, tableName,
+		setClause,
+		where,
+	)
+	return result, sharedArgs, columnArgs, nil
+}
+
+// buildUpdateArgs returns the values of the columns of the new image
+// valueArgs of an update
+func buildUpdateArgs(tableColumns *umconf.ColumnList, valueArgs []*interface{}) (sharedArgs []interface{}) {
 	for _, column := range tableColumns.ColumnList() {
 		tableOrdinal := tableColumns.Ordinals[column.Name]
 		if *valueArgs[tableOrdinal] == nil || *valueArgs[tableOrdinal] == "NULL" ||
@@ -263,7 +343,14 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 			sharedArgs = append(sharedArgs, arg)
 		}
 	}
+	return sharedArgs
+}
 
+// buildUpdateComparison returns the condition of an update on the row of
+// the before image whereArgs, by its primary key if it has one, and its
+// args
+func buildUpdateComparison(tableColumns *umconf.ColumnList, whereArgs []*interface{}) (string, []interface{}, error) {
+	var columnArgs []interface{}
 	comparisons := []string{}
 	uniqueKeyComparisons := []string{}
 	uniqueKeyArgs := make([]interface{}, 0)
@@ -272,7 +359,7 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 		if *whereArgs[tableOrdinal] == nil {
 			comparison, err := BuildValueComparison(column.Name, "NULL", IsEqualsComparisonSign)
 			if err != nil {
-				return result, sharedArgs, columnArgs, err
+				return "", columnArgs, err
 			}
 			comparisons = append(comparisons, comparison)
 		} else {
@@ -280,7 +367,7 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 				arg := column.ConvertArg(*whereArgs[tableOrdinal])
 				comparison, err := BuildValueComparison(column.Name, fmt.Sprintf("cast('%v' as %s)", arg, column.ColumnType), EqualsComparisonSign)
 				if err != nil {
-					return result, sharedArgs, columnArgs, err
+					return "", columnArgs, err
 				}
 				if strings.ToUpper(column.Key) == "PRI" {
 					uniqueKeyComparisons = append(uniqueKeyComparisons, comparison)
@@ -291,7 +378,7 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 				arg := column.ConvertArg(*whereArgs[tableOrdinal])
 				comparison, err := BuildValueComparison(column.Name, "?", EqualsComparisonSign)
 				if err != nil {
-					return result, sharedArgs, columnArgs, err
+					return "", columnArgs, err
 				}
 				if strings.ToUpper(column.Key) == "PRI" {
 					uniqueKeyArgs = append(uniqueKeyArgs, arg)
@@ -309,7 +396,53 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 	if len(uniqueKeyArgs) > 0 {
 		columnArgs = uniqueKeyArgs
 	}
-	setClause, err := BuildSetPreparedClause(mappedSharedColumns)
+	return fmt.Sprintf("(%s)", strings.Join(comparisons, " and ")), columnArgs, nil
+}
+
+// JSONChange is a change to the document of a JSON column: the MySQL
+// function Function, JSON_SET for instance, called with Path and, but for
+// JSON_REMOVE, the JSON text Value
+type JSONChange struct {
+	Function string
+	Path     string
+	Value    string
+}
+
+// BuildDMLPartialUpdateQuery is BuildDMLUpdateQuery setting the JSON
+// columns of changes, by ordinal, with the calls making their changes to
+// their documents rather than with their new documents. It returns the
+// args of the set clause and then those of the where clause.
+func BuildDMLPartialUpdateQuery(databaseName, tableName string, tableColumns *umconf.ColumnList, changes map[int][]JSONChange, valueArgs, whereArgs []*interface{}) (result string, args []interface{}, err error) {
+	if len(valueArgs) < tableColumns.Len() || len(whereArgs) < tableColumns.Len() {
+		return result, args, fmt.Errorf("args count differs from table column count in BuildDMLPartialUpdateQuery %v, %v, %v",
+			len(valueArgs), len(whereArgs), tableColumns.Len())
+	}
+	sharedArgs := buildUpdateArgs(tableColumns, valueArgs)
+	setTokens := []string{}
+	for i, column := range tableColumns.ColumnList() {
+		columnChanges, ok := changes[tableColumns.Ordinals[column.Name]]
+		if !ok {
+			setTokens = append(setTokens, buildSetPreparedToken(column))
+			args = append(args, sharedArgs[i])
+			continue
+		}
+		expression := EscapeName(column.Name)
+		for _, change := range columnChanges {
+			if strings.EqualFold(change.Function, "json_remove") {
+				expression = fmt.Sprintf("%s(%s, ?)", change.Function, expression)
+				args = append(args, change.Path)
+			} else {
+				expression = fmt.Sprintf("%s(%s, ?, cast(? as json))", change.Function, expression)
+				args = append(args, change.Path, change.Value)
+			}
+		}
+		setTokens = append(setTokens, fmt.Sprintf("%s=%s", EscapeName(column.Name), expression))
+	}
+	where, whereArgsValues, err := buildUpdateComparison(tableColumns, whereArgs)
+	if err != nil {
+		return result, args, err
+	}
+	args = append(args, whereArgsValues...)
 
 	result = fmt.Sprintf(`
  			update
@@ -319,9 +452,9 @@ func BuildDMLUpdateQuery(databaseName, tableName string, tableColumns, sharedCol
 				where
  					%s
  				limit 1
- 		`, databaseName, tableName,
-		setClause,
-		fmt.Sprintf("(%s)", strings.Join(comparisons, " and ")),
+ 		`, EscapeName(databaseName), EscapeName(tableName),
+		strings.Join(setTokens, ", "),
+		where,
 	)
-	return result, sharedArgs, columnArgs, nil
+	return result, args, nil
 }
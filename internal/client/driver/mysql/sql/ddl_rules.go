@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package sql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+// ddlVerbs are the keywords DDL statements start with
+var ddlVerbs = map[string]bool{
+	"CREATE":   true,
+	"ALTER":    true,
+	"DROP":     true,
+	"RENAME":   true,
+	"TRUNCATE": true,
+}
+
+// ddlObjects are the keywords naming what a DDL statement is about
+var ddlObjects = map[string]string{
+	"DATABASE":  "database",
+	"SCHEMA":    "database",
+	"TABLE":     "table",
+	"INDEX":     "index",
+	"VIEW":      "view",
+	"TRIGGER":   "trigger",
+	"PROCEDURE": "procedure",
+	"FUNCTION":  "function",
+	"EVENT":     "event",
+	"USER":      "user",
+}
+
+// DDLStatementType returns the type of a DDL statement, its verb and its
+// object such as create_table or drop_index, or "" if query isn't DDL
+func DDLStatementType(query string) string {
+	var verb string
+	for _, tok := range splitSQLTokens(query) {
+		if tok.space {
+			continue
+		}
+		if !tok.ident || tok.quoted {
+			if verb == "" {
+				return ""
+			}
+			continue
+		}
+		word := strings.ToUpper(tok.text)
+		if verb == "" {
+			if !ddlVerbs[word] {
+				return ""
+			}
+			verb = strings.ToLower(word)
+			continue
+		}
+		if object, ok := ddlObjects[word]; ok {
+			return verb + "_" + object
+		}
+		if verb == "truncate" {
+			// TRUNCATE [TABLE] t
+			return "truncate_table"
+		}
+	}
+	return ""
+}
+
+// DDLDecision is what the DDL rules decide for a statement
+type DDLDecision struct {
+	// StatementType is the type of the statement
+	StatementType string
+	// Action is one of the config.DDLAction values
+	Action string
+	// Query is the statement to apply, rewritten for config.DDLActionRewrite
+	Query string
+	// Rule is the index of the rule that decided, -1 if none did
+	Rule int
+}
+
+type ddlRule struct {
+	*config.DDLRule
+	match *regexp.Regexp
+}
+
+// DDLRules decides what the applier does with the DDL statements of a job
+type DDLRules struct {
+	rules []ddlRule
+}
+
+// NewDDLRules checks and compiles rules. It returns nil if there are none.
+func NewDDLRules(rules []*config.DDLRule) (*DDLRules, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	r := &DDLRules{}
+	for i, rule := range rules {
+		switch rule.Action {
+		case "", config.DDLActionApply, config.DDLActionSkip, config.DDLActionFail:
+		case config.DDLActionRewrite:
+			if rule.Match == "" {
+				return nil, fmt.Errorf("DDLRules[%d]: rewrite needs a Match", i)
+			}
+		default:
+			return nil, fmt.Errorf("DDLRules[%d]: unknown Action %q", i, rule.Action)
+		}
+		compiled := ddlRule{DDLRule: rule}
+		if rule.Match != "" {
+			var err error
+			if compiled.match, err = regexp.Compile(rule.Match); err != nil {
+				return nil, fmt.Errorf("DDLRules[%d]: %v", i, err)
+			}
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// Decide returns what the first rule matching query decides. Statements
+// that aren't DDL and those no rule matches are applied.
+func (r *DDLRules) Decide(query string) DDLDecision {
+	d := DDLDecision{Action: config.DDLActionApply, Query: query, Rule: -1}
+	if r == nil {
+		return d
+	}
+	d.StatementType = DDLStatementType(query)
+	if d.StatementType == "" {
+		return d
+	}
+
+	for i, rule := range r.rules {
+		if rule.StatementType != "" && rule.StatementType != "*" && !strings.EqualFold(rule.StatementType, d.StatementType) {
+			continue
+		}
+		if rule.match != nil && !rule.match.MatchString(query) {
+			continue
+		}
+		d.Rule = i
+		if rule.Action != "" {
+			d.Action = rule.Action
+		}
+		if d.Action == config.DDLActionRewrite {
+			d.Query = rule.match.ReplaceAllString(query, rule.Replacement)
+		}
+		return d
+	}
+	return d
+}
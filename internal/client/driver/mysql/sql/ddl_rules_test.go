@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package sql
+
+import (
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+func TestDDLStatementType(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"CREATE TABLE t (id int)", "create_table"},
+		{"create temporary table t (id int)", "create_table"},
+		{"/* comment */ ALTER TABLE t ADD INDEX i (c)", "alter_table"},
+		{"CREATE UNIQUE INDEX i ON t (c)", "create_index"},
+		{"drop schema if exists db", "drop_database"},
+		{"CREATE DEFINER=`root`@`%` TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET @a = 1", "create_trigger"},
+		{"truncate t", "truncate_table"},
+		{"RENAME TABLE a TO b", "rename_table"},
+		{"insert into t values (1)", ""},
+		{"SET NAMES utf8", ""},
+	}
+	for _, tt := range tests {
+		if got := DDLStatementType(tt.query); got != tt.want {
+			t.Errorf("DDLStatementType(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestDDLRules_Decide(t *testing.T) {
+	rules, err := NewDDLRules([]*config.DDLRule{
+		{StatementType: "alter_table", Match: `(?i)ADD COLUMN (\w+) (\w+) AS \(.*\) VIRTUAL`, Action: config.DDLActionRewrite, Replacement: "ADD COLUMN $1 $2"},
+		{StatementType: "create_trigger", Action: config.DDLActionSkip},
+		{StatementType: "drop_database", Action: config.DDLActionFail},
+		{StatementType: "*", Match: "keep_me", Action: config.DDLActionApply},
+		{Match: "_tmp", Action: config.DDLActionSkip},
+	})
+	if err != nil {
+		t.Fatalf("NewDDLRules() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantAction string
+		wantQuery  string
+		wantRule   int
+	}{
+		{"rewrite", "ALTER TABLE t ADD COLUMN c int AS (a + b) VIRTUAL", config.DDLActionRewrite, "ALTER TABLE t ADD COLUMN c int", 0},
+		{"no match", "ALTER TABLE t ADD COLUMN c int", config.DDLActionApply, "ALTER TABLE t ADD COLUMN c int", -1},
+		{"skip", "CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET @a = 1", config.DDLActionSkip, "CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET @a = 1", 1},
+		{"fail", "DROP DATABASE db", config.DDLActionFail, "DROP DATABASE db", 2},
+		{"first match wins", "create table keep_me_tmp (id int)", config.DDLActionApply, "create table keep_me_tmp (id int)", 3},
+		{"any type", "create table t_tmp (id int)", config.DDLActionSkip, "create table t_tmp (id int)", 4},
+		{"not ddl", "insert into t_tmp values (1)", config.DDLActionApply, "insert into t_tmp values (1)", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := rules.Decide(tt.query)
+			if d.Action != tt.wantAction || d.Query != tt.wantQuery || d.Rule != tt.wantRule {
+				t.Errorf("DDLRules.Decide() = %v %q (rule %d), want %v %q (rule %d)",
+					d.Action, d.Query, d.Rule, tt.wantAction, tt.wantQuery, tt.wantRule)
+			}
+		})
+	}
+
+	var none *DDLRules
+	if d := none.Decide("DROP TABLE t"); d.Action != config.DDLActionApply {
+		t.Errorf("DDLRules.Decide() of nil rules = %v, want %v", d.Action, config.DDLActionApply)
+	}
+	for _, bad := range []*config.DDLRule{
+		{Action: "ignore"},
+		{Action: config.DDLActionRewrite},
+		{Match: "(", Action: config.DDLActionSkip},
+	} {
+		if _, err := NewDDLRules([]*config.DDLRule{bad}); err == nil {
+			t.Errorf("NewDDLRules(%+v) error = nil", *bad)
+		}
+	}
+}
@@ -925,3 +925,42 @@ func IgnoreExistsError(err error) bool {
 		return false
 	}
 }
+
+// IsNotExistsError returns whether err is about a missing table or database
+func IsNotExistsError(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+
+	switch mysqlErr.Number {
+	case ErrDatabaseNotExists, ErrTableNotExists:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsDupEntryError returns whether err is about a duplicate key
+func IsDupEntryError(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == ErrDupEntry
+}
+
+// IsRowError returns whether err is about a row the table can't hold: it
+// violates a key or a constraint, or a value doesn't fit its column. Such
+// errors fail the statement, the transaction goes on.
+func IsRowError(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+
+	switch mysqlErr.Number {
+	case ErrDupEntry, ErrBadNull, ErrNoReferencedRow, ErrRowIsReferenced, ErrNoReferencedRow2, ErrRowIsReferenced2,
+		ErrWarnDataOutOfRange, ErrTruncatedWrongValueForField, ErrDataTooLong:
+		return true
+	default:
+		return false
+	}
+}
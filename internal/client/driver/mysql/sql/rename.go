@@ -0,0 +1,348 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package sql
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/tidb/ast"
+	"github.com/pingcap/tidb/parser"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+// NameMapping holds the rename rules of a job: schemas and tables are
+// replicated to the target under another name.
+type NameMapping struct {
+	// schemas maps a source schema to its name on the target
+	schemas map[string]string
+
+	// tables maps a source schema and table to the name of the table on
+	// the target
+	tables map[string]map[string]string
+}
+
+// NewNameMapping returns the rename rules configured in dataSources, or nil
+// if nothing is renamed. Names are compared as they are written.
+func NewNameMapping(dataSources []*config.DataSource) *NameMapping {
+	m := &NameMapping{
+		schemas: make(map[string]string),
+		tables:  make(map[string]map[string]string),
+	}
+	for _, ds := range dataSources {
+		if ds.TableSchemaRename != "" && ds.TableSchemaRename != ds.TableSchema {
+			m.schemas[ds.TableSchema] = ds.TableSchemaRename
+		}
+		for _, tb := range ds.Tables {
+			if tb.TableRename == "" || tb.TableRename == tb.TableName {
+				continue
+			}
+			if m.tables[ds.TableSchema] == nil {
+				m.tables[ds.TableSchema] = make(map[string]string)
+			}
+			m.tables[ds.TableSchema][tb.TableName] = tb.TableRename
+		}
+	}
+	if len(m.schemas) == 0 && len(m.tables) == 0 {
+		return nil
+	}
+	return m
+}
+
+// Schema returns the name of schema on the target
+func (m *NameMapping) Schema(schema string) string {
+	if m == nil {
+		return schema
+	}
+	if name, ok := m.schemas[schema]; ok {
+		return name
+	}
+	return schema
+}
+
+// Table returns the names of the schema and the table on the target of
+// table in schema
+func (m *NameMapping) Table(schema, table string) (string, string) {
+	if m == nil {
+		return schema, table
+	}
+	if name, ok := m.tables[schema][table]; ok {
+		table = name
+	}
+	return m.Schema(schema), table
+}
+
+// renames returns whether the schema, or a table of it, is renamed
+func (m *NameMapping) renames(schema string) bool {
+	_, renamed := m.schemas[schema]
+	return renamed || len(m.tables[schema]) > 0
+}
+
+// RewriteQuery rewrites the schema and table names query refers to with
+// their names on the target. Unqualified table names are resolved in
+// currentSchema, which a USE statement in query changes. It returns the
+// rewritten query and the current schema after it, both unchanged for a nil
+// mapping.
+//
+// Statements the rules can't be applied to faithfully are reported with an
+// error: INSERT ... SELECT, whose source rows may be read from different
+// tables on the target, and foreign keys across schemas when one of them
+// is renamed.
+func (m *NameMapping) RewriteQuery(query string, currentSchema string) (string, string, error) {
+	if m == nil {
+		return query, currentSchema, nil
+	}
+	if err := m.checkQuery(query, currentSchema); err != nil {
+		return "", "", err
+	}
+
+	tokens := splitSQLTokens(query)
+
+	// sig indexes the tokens that aren't spaces or comments
+	var sig []int
+	for i := range tokens {
+		if !tokens[i].space {
+			sig = append(sig, i)
+		}
+	}
+	// keyword returns the j-th significant token if it is a bare word, in
+	// upper case
+	keyword := func(j int) string {
+		if j < 0 || j >= len(sig) {
+			return ""
+		}
+		tok := tokens[sig[j]]
+		if tok.quoted {
+			return ""
+		}
+		return strings.ToUpper(tok.text)
+	}
+	text := func(j int) string {
+		if j < 0 || j >= len(sig) {
+			return ""
+		}
+		return tokens[sig[j]].text
+	}
+
+	for j := 0; j < len(sig); j++ {
+		tok := &tokens[sig[j]]
+		if !tok.ident || text(j-1) == "." {
+			continue
+		}
+
+		if text(j+1) == "." && j+2 < len(sig) {
+			// schema.table, or a table qualifying a column
+			schema := tok.name
+			tok.rename(m.Schema(schema))
+			if table := &tokens[sig[j+2]]; table.ident {
+				_, name := m.Table(schema, table.name)
+				table.rename(name)
+			}
+			j += 2
+			continue
+		}
+
+		prev := keyword(j - 1)
+		if prev == "EXISTS" {
+			// IF [NOT] EXISTS names a schema or a table
+			k := j - 2
+			if keyword(k) == "NOT" {
+				k--
+			}
+			if keyword(k-1) == "DATABASE" || keyword(k-1) == "SCHEMA" {
+				prev = "DATABASE"
+			}
+		}
+		switch prev {
+		case "USE":
+			currentSchema = tok.name
+			tok.rename(m.Schema(tok.name))
+		case "DATABASE", "SCHEMA":
+			tok.rename(m.Schema(tok.name))
+		case "TABLE", "EXISTS", "REFERENCES", "LIKE", "ON", "TO", "INTO", "FROM", "JOIN", "UPDATE", "TRUNCATE":
+			_, name := m.Table(currentSchema, tok.name)
+			tok.rename(name)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, tok := range tokens {
+		buf.WriteString(tok.text)
+	}
+	return buf.String(), currentSchema, nil
+}
+
+// checkQuery reports the statements of query the rules can't be applied to.
+// Queries the parser doesn't understand are not checked.
+func (m *NameMapping) checkQuery(query string, currentSchema string) error {
+	stmts, err := parser.New().Parse(query, "", "")
+	if err != nil {
+		return nil
+	}
+
+	for _, stmt := range stmts {
+		var table *ast.TableName
+		var constraints []*ast.Constraint
+		switch v := stmt.(type) {
+		case *ast.UseStmt:
+			currentSchema = v.DBName
+		case *ast.InsertStmt:
+			if v.Select != nil {
+				return fmt.Errorf("INSERT ... SELECT can't be applied with schema or table renames: %s", query)
+			}
+		case *ast.CreateTableStmt:
+			table, constraints = v.Table, v.Constraints
+		case *ast.AlterTableStmt:
+			table = v.Table
+			for _, spec := range v.Specs {
+				if spec.Constraint != nil {
+					constraints = append(constraints, spec.Constraint)
+				}
+			}
+		}
+
+		for _, c := range constraints {
+			if c.Refer == nil || c.Refer.Table == nil {
+				continue
+			}
+			schema := table.Schema.O
+			if schema == "" {
+				schema = currentSchema
+			}
+			referSchema := c.Refer.Table.Schema.O
+			if referSchema == "" {
+				referSchema = schema
+			}
+			if referSchema != schema && (m.renames(schema) || m.renames(referSchema)) {
+				return fmt.Errorf("foreign key of %s.%s references %s.%s in another schema, which can't be applied with schema or table renames",
+					schema, table.Name.O, referSchema, c.Refer.Table.Name.O)
+			}
+		}
+	}
+	return nil
+}
+
+// sqlToken is a piece of a query
+type sqlToken struct {
+	text string
+
+	// space is set for whitespace and comments
+	space bool
+
+	// ident is set for words and quoted identifiers, name holds the name
+	// they stand for
+	ident  bool
+	quoted bool
+	name   string
+}
+
+// rename changes the name an identifier stands for, keeping the quotes if
+// it had some
+func (t *sqlToken) rename(name string) {
+	if name == t.name {
+		return
+	}
+	t.name = name
+	if t.quoted || !isBareName(name) {
+		t.text = "`" + strings.Replace(name, "`", "``", -1) + "`"
+	} else {
+		t.text = name
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
+
+func isBareName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isWordByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// endOfQuoted returns the offset right after the quoted string or
+// identifier starting at query[i]
+func endOfQuoted(query string, i int, backslash bool) int {
+	q := query[i]
+	for k := i + 1; k < len(query); k++ {
+		switch {
+		case backslash && query[k] == '\\':
+			k++
+		case query[k] == q:
+			if k+1 < len(query) && query[k+1] == q {
+				k++
+				continue
+			}
+			return k + 1
+		}
+	}
+	return len(query)
+}
+
+// splitSQLTokens splits query into tokens. Concatenating them gives back
+// query.
+func splitSQLTokens(query string) (tokens []sqlToken) {
+	for i := 0; i < len(query); {
+		var tok sqlToken
+		c := query[i]
+		j := i + 1
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			for j < len(query) && strings.IndexByte(" \t\n\r", query[j]) >= 0 {
+				j++
+			}
+			tok.space = true
+		case c == '#' || strings.HasPrefix(query[i:], "--") && (i+2 == len(query) || strings.IndexByte(" \t\n\r", query[i+2]) >= 0):
+			if k := strings.IndexByte(query[i:], '\n'); k >= 0 {
+				j = i + k
+			} else {
+				j = len(query)
+			}
+			tok.space = true
+		case strings.HasPrefix(query[i:], "/*"):
+			if k := strings.Index(query[i+2:], "*/"); k >= 0 {
+				j = i + 2 + k + 2
+			} else {
+				j = len(query)
+			}
+			tok.space = true
+		case c == '\'' || c == '"':
+			j = endOfQuoted(query, i, true)
+		case c == '`':
+			j = endOfQuoted(query, i, false)
+			tok.ident, tok.quoted = true, true
+			name := query[i+1 : j]
+			if strings.HasSuffix(name, "`") {
+				name = name[:len(name)-1]
+			}
+			tok.name = strings.Replace(name, "``", "`", -1)
+		case c == '@':
+			// user and system variables, such as @@session.sql_mode
+			for j < len(query) && (isWordByte(query[j]) || query[j] == '@' || query[j] == '.') {
+				j++
+			}
+		case isWordByte(c):
+			for j < len(query) && isWordByte(query[j]) {
+				j++
+			}
+			tok.ident = true
+			tok.name = query[i:j]
+		}
+		tok.text = query[i:j]
+		tokens = append(tokens, tok)
+		i = j
+	}
+	return tokens
+}
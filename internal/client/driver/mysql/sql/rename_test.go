@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package sql
+
+import (
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+)
+
+func TestNameMapping_RewriteQuery(t *testing.T) {
+	m := NewNameMapping([]*config.DataSource{
+		{TableSchema: "prod", TableSchemaRename: "prod_archive", Tables: []*config.Table{
+			{TableName: "orders", TableRename: "orders_2018"},
+			{TableName: "items"},
+		}},
+		{TableSchema: "other"},
+	})
+
+	tests := []struct {
+		name          string
+		query         string
+		currentSchema string
+		want          string
+		wantSchema    string
+		wantErr       bool
+	}{
+		{"use", "USE prod", "", "USE prod_archive", "prod", false},
+		{"create database", "CREATE DATABASE IF NOT EXISTS prod", "", "CREATE DATABASE IF NOT EXISTS prod_archive", "", false},
+		{"drop database", "drop database `prod`", "other", "drop database `prod_archive`", "other", false},
+		{"qualified table", "drop table if exists prod.`orders`", "", "drop table if exists prod_archive.`orders_2018`", "", false},
+		{"unqualified table", "USE `prod`;CREATE TABLE `orders` (`id` int, `orders` int)", "", "USE `prod_archive`;CREATE TABLE `orders_2018` (`id` int, `orders` int)", "prod", false},
+		{"table of another schema", "ALTER TABLE orders ADD COLUMN c int", "other", "ALTER TABLE orders ADD COLUMN c int", "other", false},
+		{"strings and comments", "ALTER TABLE prod.items COMMENT 'prod.orders' /* prod.orders */", "", "ALTER TABLE prod_archive.items COMMENT 'prod.orders' /* prod.orders */", "", false},
+		{"index", "CREATE INDEX i ON orders (c)", "prod", "CREATE INDEX i ON orders_2018 (c)", "prod", false},
+		{"foreign key in the schema", "CREATE TABLE items (oid int, FOREIGN KEY (oid) REFERENCES orders (id))", "prod", "CREATE TABLE items (oid int, FOREIGN KEY (oid) REFERENCES orders_2018 (id))", "prod", false},
+		{"foreign key across schemas", "CREATE TABLE items (oid int, FOREIGN KEY (oid) REFERENCES other.orders (id))", "prod", "", "", true},
+		{"foreign key added across schemas", "ALTER TABLE other.t ADD FOREIGN KEY (oid) REFERENCES prod.orders (id)", "", "", "", true},
+		{"insert select", "INSERT INTO items SELECT * FROM orders", "prod", "", "", true},
+		{"insert values", "INSERT INTO orders VALUES (1)", "prod", "INSERT INTO orders_2018 VALUES (1)", "prod", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotSchema, err := m.RewriteQuery(tt.query, tt.currentSchema)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NameMapping.RewriteQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || gotSchema != tt.wantSchema {
+				t.Errorf("NameMapping.RewriteQuery() = %q, %q, want %q, %q", got, gotSchema, tt.want, tt.wantSchema)
+			}
+		})
+	}
+
+	if NewNameMapping([]*config.DataSource{{TableSchema: "prod", TableSchemaRename: "prod"}}) != nil {
+		t.Errorf("NewNameMapping() renames nothing but isn't nil")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// throttle paces the writes of the applier with a token bucket of bytes
+// and one of rows, each holding up to a second of writes. A rate of 0
+// doesn't limit.
+type throttle struct {
+	mu             sync.Mutex
+	bytesPerSecond int64
+	rowsPerSecond  int64
+	bytes          float64
+	rows           float64
+	last           time.Time
+
+	// waited is the time spent waiting for the buckets, in nanoseconds
+	waited int64
+}
+
+func newThrottle(bytesPerSecond, rowsPerSecond int64) *throttle {
+	t := &throttle{}
+	t.set(bytesPerSecond, rowsPerSecond)
+	return t
+}
+
+// set changes the rates, starting from empty buckets
+func (t *throttle) set(bytesPerSecond, rowsPerSecond int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bytesPerSecond, t.rowsPerSecond = bytesPerSecond, rowsPerSecond
+	t.bytes, t.rows = 0, 0
+	t.last = time.Now()
+}
+
+// take takes bytes and rows out of the buckets at now, and returns how
+// long to wait for them to be refilled. The buckets may go below zero:
+// writes larger than a second's worth still get through, after waiting.
+func (t *throttle) take(now time.Time, bytes, rows int64) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	elapsed := now.Sub(t.last).Seconds()
+	t.last = now
+
+	var delay time.Duration
+	fill := func(tokens *float64, rate, n int64) {
+		if rate <= 0 {
+			return
+		}
+		*tokens += elapsed * float64(rate)
+		if *tokens > float64(rate) {
+			*tokens = float64(rate)
+		}
+		*tokens -= float64(n)
+		if *tokens < 0 {
+			if d := time.Duration(-*tokens / float64(rate) * float64(time.Second)); d > delay {
+				delay = d
+			}
+		}
+	}
+	fill(&t.bytes, t.bytesPerSecond, bytes)
+	fill(&t.rows, t.rowsPerSecond, rows)
+	return delay
+}
+
+// wait blocks until the buckets hold bytes and rows, or shutdownCh is
+// closed. A nil throttle doesn't wait.
+func (t *throttle) wait(bytes, rows int64, shutdownCh <-chan struct{}) {
+	if t == nil {
+		return
+	}
+	delay := t.take(time.Now(), bytes, rows)
+	if delay <= 0 {
+		return
+	}
+	atomic.AddInt64(&t.waited, int64(delay))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-shutdownCh:
+	}
+}
+
+// waitedSeconds returns the time spent waiting for the buckets
+func (t *throttle) waitedSeconds() float64 {
+	if t == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&t.waited)).Seconds()
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle_take(t *testing.T) {
+	tr := newThrottle(1000, 10)
+	start := tr.last
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		bytes int64
+		rows  int64
+		want  time.Duration
+	}{
+		{"empty bucket", 0, 500, 1, 500 * time.Millisecond},
+		{"paid back", 500 * time.Millisecond, 0, 0, 0},
+		{"refilled for a second at most", 5 * time.Second, 1000, 10, 0},
+		{"rows wait longer", 5 * time.Second, 100, 20, time.Second},
+		{"larger than a second", 10 * time.Second, 3000, 0, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tr.take(start.Add(tt.after), tt.bytes, tt.rows); got != tt.want {
+			t.Errorf("%s: throttle.take() = %v, want %v", tt.name, got, tt.want)
+		}
+		start = start.Add(tt.after)
+	}
+
+	// Removing the limits lets everything through
+	tr.set(0, 0)
+	if got := tr.take(tr.last, 1<<30, 1<<20); got != 0 {
+		t.Errorf("throttle.take() without limits = %v, want 0", got)
+	}
+
+	// The throttle gives up waiting on shutdown
+	tr.set(1, 0)
+	shutdownCh := make(chan struct{})
+	close(shutdownCh)
+	done := make(chan struct{})
+	go func() {
+		tr.wait(3600, 0, shutdownCh)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("throttle.wait() kept waiting after shutdown")
+	}
+	if tr.waitedSeconds() <= 0 {
+		t.Errorf("throttle.waitedSeconds() = %v, want the wait counted", tr.waitedSeconds())
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	umconf "github.com/actiontech/dtle/internal/config/mysql"
+	log "github.com/actiontech/dtle/internal/logger"
+)
+
+// ValidateTables runs on db the checks the extractor runs on the tables
+// of cfg.ReplicateDoDb, and returns the problems of the schemas and tables
+// the extractor would fail on or skip
+func ValidateTables(db *gosql.DB, cfg *config.MySQLDriverConfig, logger *log.Logger) error {
+	if logger == nil {
+		logger = log.New(ioutil.Discard, log.ErrorLevel)
+	}
+	inspector := NewInspector(cfg, log.NewEntry(logger))
+	inspector.db = db
+
+	var problems []string
+	for _, doDb := range cfg.ReplicateDoDb {
+		if doDb.TableSchema == "" {
+			continue
+		}
+		if len(doDb.Tables) == 0 {
+			if _, err := sql.ShowTables(db, doDb.TableSchema, false); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", doDb.TableSchema, err))
+			}
+			continue
+		}
+		for _, doTb := range doDb.Tables {
+			// ValidateOriginalTable fills the table in, leave the job's as it is
+			tb := *doTb
+			tb.TableSchema = doDb.TableSchema
+			if err := inspector.ValidateOriginalTable(doDb.TableSchema, doTb.TableName, &tb); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.%s: %v", doDb.TableSchema, doTb.TableName, err))
+			}
+		}
+	}
+	return problemsError(problems)
+}
+
+// ValidateSchemas checks that the tables the source replicates which
+// already exist on the target have the columns replicated to them.
+// srcCfg is the config of the extractor, destCfg the config of the
+// applier, with its renames and column filters. The applier creates the
+// missing tables, unless SkipCreateDbTable is set and CreateTables is not.
+// With CreateTables, the tables that exist must match those of the source.
+func ValidateSchemas(src, dest *gosql.DB, srcCfg, destCfg *config.MySQLDriverConfig) error {
+	mapping := sql.NewNameMapping(destCfg.ReplicateDoDb)
+
+	var problems []string
+	for _, doDb := range srcCfg.ReplicateDoDb {
+		if doDb.TableSchema == "" {
+			continue
+		}
+		tables := doDb.Tables
+		if len(tables) == 0 {
+			var err error
+			if tables, err = sql.ShowTables(src, doDb.TableSchema, false); err != nil {
+				// reported by ValidateTables
+				continue
+			}
+		}
+		for _, tb := range tables {
+			srcColumns, err := base.GetTableColumns(src, doDb.TableSchema, tb.TableName)
+			if err != nil {
+				continue
+			}
+			schema, table := mapping.Table(doDb.TableSchema, tb.TableName)
+			destColumns, err := base.GetTableColumns(dest, schema, table)
+			if sql.IsNotExistsError(err) {
+				if srcCfg.SkipCreateDbTable && !destCfg.CreateTables {
+					problems = append(problems, fmt.Sprintf("%s.%s does not exist on the target and SkipCreateDbTable is set", schema, table))
+				}
+				continue
+			} else if err != nil {
+				problems = append(problems, fmt.Sprintf("%s.%s: %v", schema, table, err))
+				continue
+			}
+
+			destNames := make(map[string]bool)
+			for _, name := range destColumns.Names() {
+				destNames[strings.ToLower(name)] = true
+			}
+			filter := lookupTable(destCfg.ReplicateDoDb, doDb.TableSchema, tb.TableName)
+			var missing []string
+			for _, name := range srcColumns.Names() {
+				if filter != nil && !filter.ReplicatesColumn(name) {
+					continue
+				}
+				if !destNames[strings.ToLower(name)] {
+					missing = append(missing, name)
+				}
+			}
+			if len(missing) > 0 {
+				problems = append(problems, fmt.Sprintf("%s.%s on the target lacks the columns %s of %s.%s",
+					schema, table, strings.Join(missing, ", "), doDb.TableSchema, tb.TableName))
+			}
+			if destCfg.CreateTables {
+				if diff := columnsDiff(srcColumns, destColumns, filter); len(diff) > 0 {
+					problems = append(problems, fmt.Sprintf("%s.%s on the target differs from %s.%s: %s",
+						schema, table, doDb.TableSchema, tb.TableName, strings.Join(diff, ", ")))
+				}
+			}
+		}
+	}
+	return problemsError(problems)
+}
+
+// intDisplayWidth matches the display width of integer types, which MySQL
+// 8.0 no longer prints
+var intDisplayWidth = regexp.MustCompile(`^((tiny|small|medium|big)?int)\(\d+\)`)
+
+// columnsDiff returns how the columns of the target dest differ from those
+// of the source src they are replicated from, tb being the config of the
+// table: the replicated columns whose types differ, unless they are
+// converted, and the columns only the target has that inserts can't leave
+// out
+func columnsDiff(src, dest *umconf.ColumnList, tb *config.Table) (diff []string) {
+	srcColumns := make(map[string]*umconf.Column)
+	for i := range src.Columns {
+		srcColumns[strings.ToLower(src.Columns[i].Name)] = &src.Columns[i]
+	}
+	normalize := func(columnType string) string {
+		return intDisplayWidth.ReplaceAllString(strings.ToLower(columnType), "$1")
+	}
+	for _, destColumn := range dest.Columns {
+		srcColumn, ok := srcColumns[strings.ToLower(destColumn.Name)]
+		switch {
+		case !ok:
+			if !destColumn.Nullable && !destColumn.HasDefault {
+				diff = append(diff, fmt.Sprintf("%s %s only on the target is NOT NULL without a default",
+					destColumn.Name, destColumn.ColumnType))
+			}
+		case tb != nil && (!tb.ReplicatesColumn(srcColumn.Name) || tb.ColumnConversion(srcColumn.Name) != nil):
+		case normalize(srcColumn.ColumnType) != normalize(destColumn.ColumnType):
+			diff = append(diff, fmt.Sprintf("%s %s on the source, %s on the target",
+				destColumn.Name, srcColumn.ColumnType, destColumn.ColumnType))
+		}
+	}
+	return diff
+}
+
+// lookupTable returns the table schema.name of doDbs, nil if it isn't
+// listed
+func lookupTable(doDbs []*config.DataSource, schema, name string) *config.Table {
+	for _, doDb := range doDbs {
+		if doDb.TableSchema != schema {
+			continue
+		}
+		for _, tb := range doDb.Tables {
+			if tb.TableName == name {
+				return tb
+			}
+		}
+	}
+	return nil
+}
+
+func problemsError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
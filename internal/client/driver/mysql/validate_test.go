@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config"
+
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+// schemaServer stands for a server answering show columns, with the
+// columns of each `schema`.`table`
+type schemaServer map[string][]string
+
+func (s schemaServer) Open(name string) (driver.Conn, error) {
+	return schemaConn{server: s}, nil
+}
+
+type schemaConn struct {
+	server schemaServer
+}
+
+func (c schemaConn) Prepare(query string) (driver.Stmt, error) {
+	return schemaStmt{server: c.server, query: query}, nil
+}
+func (c schemaConn) Close() error              { return nil }
+func (c schemaConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type schemaStmt struct {
+	server schemaServer
+	query  string
+}
+
+var showColumnsRegexp = regexp.MustCompile("show columns from (\\S+)")
+
+func (s schemaStmt) Close() error  { return nil }
+func (s schemaStmt) NumInput() int { return -1 }
+func (s schemaStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+func (s schemaStmt) Query(args []driver.Value) (driver.Rows, error) {
+	m := showColumnsRegexp.FindStringSubmatch(s.query)
+	if m == nil {
+		return nil, driver.ErrSkip
+	}
+	columns, ok := s.server[m[1]]
+	if !ok {
+		return nil, &gomysql.MySQLError{Number: 1146, Message: "Table doesn't exist"}
+	}
+	return &schemaRows{columns: columns}, nil
+}
+
+type schemaRows struct {
+	columns []string
+}
+
+func (r *schemaRows) Columns() []string { return []string{"Field", "Type"} }
+func (r *schemaRows) Close() error      { return nil }
+
+func (r *schemaRows) Next(dest []driver.Value) error {
+	if len(r.columns) == 0 {
+		return io.EOF
+	}
+	dest[0], dest[1] = []byte(r.columns[0]), []byte("int")
+	r.columns = r.columns[1:]
+	return nil
+}
+
+var registerSchemaDrivers sync.Once
+
+func TestValidateSchemas(t *testing.T) {
+	registerSchemaDrivers.Do(func() {
+		gosql.Register("schema_src", schemaServer{
+			"`db1`.`t1`": {"id", "name", "secret"},
+			"`db1`.`t2`": {"id", "c"},
+			"`db1`.`t3`": {"id"},
+		})
+		gosql.Register("schema_dest", schemaServer{
+			"`db1`.`t1`":     {"ID", "name"},
+			"`db1`.`t2_new`": {"id"},
+		})
+	})
+	src, err := gosql.Open("schema_src", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := gosql.Open("schema_dest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcCfg := &config.MySQLDriverConfig{
+		ReplicateDoDb: []*config.DataSource{{TableSchema: "db1", Tables: []*config.Table{
+			{TableName: "t1"}, {TableName: "t2"}, {TableName: "t3"},
+		}}},
+	}
+	destCfg := &config.MySQLDriverConfig{
+		ReplicateDoDb: []*config.DataSource{{TableSchema: "db1", Tables: []*config.Table{
+			{TableName: "t1", ExcludeColumns: []string{"secret"}},
+			{TableName: "t2", TableRename: "t2_new"},
+		}}},
+	}
+
+	// t1 has the columns replicated to it, t2 lacks c, t3 gets created
+	err = ValidateSchemas(src, dest, srcCfg, destCfg)
+	if err == nil || strings.Contains(err.Error(), "t1") || !strings.Contains(err.Error(), "db1.t2_new on the target lacks the columns c of db1.t2") {
+		t.Errorf("ValidateSchemas() error = %v, want t2_new lacking c", err)
+	}
+
+	srcCfg.SkipCreateDbTable = true
+	err = ValidateSchemas(src, dest, srcCfg, destCfg)
+	if err == nil || !strings.Contains(err.Error(), "db1.t3 does not exist on the target") {
+		t.Errorf("ValidateSchemas() with SkipCreateDbTable error = %v, want t3 missing", err)
+	}
+
+	// The applier creates t3 at start
+	destCfg.CreateTables = true
+	err = ValidateSchemas(src, dest, srcCfg, destCfg)
+	if err == nil || strings.Contains(err.Error(), "t3") {
+		t.Errorf("ValidateSchemas() with CreateTables error = %v, want t3 created", err)
+	}
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/client/driver/mysql/base"
+	"github.com/actiontech/dtle/internal/client/driver/mysql/sql"
+	"github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// defaultVerifyChunkSize is the number of rows VerifyTables compares at
+// once by default
+const defaultVerifyChunkSize = 1000
+
+// VerifyTables compares the rows of the tables the task of srcCfg
+// replicates with those of the target of destCfg, following its renames
+// and column filters. Tables are cut in chunks of chunkSize rows by
+// primary key, and the checksums of the rows of each chunk compared on
+// both sides. Nothing is locked, so the chunks that differ are compared
+// again at the end, leaving out the rows replication was then writing.
+func VerifyTables(src, dest *gosql.DB, srcCfg, destCfg *config.MySQLDriverConfig, chunkSize int) ([]*models.TableVerification, error) {
+	if chunkSize <= 0 {
+		chunkSize = defaultVerifyChunkSize
+	}
+	mapping := sql.NewNameMapping(destCfg.ReplicateDoDb)
+
+	var results []*models.TableVerification
+	for _, doDb := range srcCfg.ReplicateDoDb {
+		if doDb.TableSchema == "" {
+			continue
+		}
+		tables := doDb.Tables
+		if len(tables) == 0 {
+			var err error
+			if tables, err = sql.ShowTables(src, doDb.TableSchema, false); err != nil {
+				return nil, err
+			}
+		}
+		for _, tb := range tables {
+			schema, table := mapping.Table(doDb.TableSchema, tb.TableName)
+			v := &models.TableVerification{
+				TableSchema:  doDb.TableSchema,
+				TableName:    tb.TableName,
+				TargetSchema: schema,
+				TargetTable:  table,
+			}
+			filter := lookupTable(destCfg.ReplicateDoDb, doDb.TableSchema, tb.TableName)
+			if err := verifyTable(src, dest, v, tb.Where, filter, chunkSize); err != nil {
+				v.Error = err.Error()
+			}
+			results = append(results, v)
+		}
+	}
+	return results, nil
+}
+
+// verifyTable compares the table of v by chunks, the rows of the source
+// matching where. filter is the configuration of the table on the target,
+// nil if it has none.
+func verifyTable(src, dest *gosql.DB, v *models.TableVerification, where string, filter *config.Table, chunkSize int) error {
+	if filter != nil && filter.Routing != nil {
+		return fmt.Errorf("routed to several tables")
+	}
+	if where == "true" {
+		where = ""
+	}
+	columns, err := base.GetTableColumns(src, v.TableSchema, v.TableName)
+	if err != nil {
+		return err
+	}
+	if filter != nil {
+		if columns, err = filter.ReplicatedColumns(columns); err != nil {
+			return err
+		}
+	}
+	for _, col := range columns.ColumnList() {
+		if col.IsPk() {
+			v.KeyColumns = append(v.KeyColumns, col.Name)
+		}
+	}
+	if len(v.KeyColumns) == 0 {
+		return fmt.Errorf("no primary key to cut the table in chunks by")
+	}
+
+	compare := func(c *models.ChunkMismatch) (bool, error) {
+		cond, args := chunkRange(v.KeyColumns, c.LowerBound, c.UpperBound)
+		srcSum, err := checksumChunk(src, checksumQuery(v.TableSchema, v.TableName, columns.Names(), cond, where), args)
+		if err != nil {
+			return false, err
+		}
+		destSum, err := checksumChunk(dest, checksumQuery(v.TargetSchema, v.TargetTable, columns.Names(), cond, ""), args)
+		if err != nil {
+			return false, err
+		}
+		c.SourceRows, c.TargetRows = srcSum.rows, destSum.rows
+		return *srcSum == *destSum, nil
+	}
+
+	var differing []*models.ChunkMismatch
+	var lower []string
+	for {
+		query, args := chunkBoundQuery(v.TableSchema, v.TableName, v.KeyColumns, lower, where, chunkSize)
+		upper, err := nextChunkBound(src, query, args)
+		if err != nil {
+			return err
+		}
+		c := &models.ChunkMismatch{LowerBound: lower, UpperBound: upper}
+		same, err := compare(c)
+		if err != nil {
+			return err
+		}
+		v.Chunks++
+		v.SourceRows += c.SourceRows
+		v.TargetRows += c.TargetRows
+		if !same {
+			differing = append(differing, c)
+		}
+		if upper == nil {
+			break
+		}
+		lower = upper
+	}
+
+	for _, c := range differing {
+		sourceRows, targetRows := c.SourceRows, c.TargetRows
+		same, err := compare(c)
+		if err != nil {
+			return err
+		}
+		v.SourceRows += c.SourceRows - sourceRows
+		v.TargetRows += c.TargetRows - targetRows
+		if !same {
+			v.Mismatches = append(v.Mismatches, c)
+		}
+	}
+	return nil
+}
+
+// chunkRange returns the condition on the key of the rows after lower and
+// up to upper, nil bounds being open, and its args
+func chunkRange(key []string, lower, upper []string) (string, []interface{}) {
+	names := make([]string, len(key))
+	for i, name := range key {
+		names[i] = sql.EscapeName(name)
+	}
+	tuple := fmt.Sprintf("(%s)", strings.Join(names, ", "))
+	placeholders := fmt.Sprintf("(%s)", strings.TrimSuffix(strings.Repeat("?, ", len(key)), ", "))
+
+	var conds []string
+	var args []interface{}
+	if lower != nil {
+		conds = append(conds, fmt.Sprintf("%s > %s", tuple, placeholders))
+		for _, v := range lower {
+			args = append(args, v)
+		}
+	}
+	if upper != nil {
+		conds = append(conds, fmt.Sprintf("%s <= %s", tuple, placeholders))
+		for _, v := range upper {
+			args = append(args, v)
+		}
+	}
+	if len(conds) == 0 {
+		return "true", nil
+	}
+	return strings.Join(conds, " and "), args
+}
+
+// chunkBoundQuery returns the query of the key of the last row of the
+// chunk of chunkSize rows after lower, and its args
+func chunkBoundQuery(schema, table string, key []string, lower []string, where string, chunkSize int) (string, []interface{}) {
+	names := make([]string, len(key))
+	for i, name := range key {
+		names[i] = sql.EscapeName(name)
+	}
+	cond, args := chunkRange(key, lower, nil)
+	if where != "" {
+		cond = fmt.Sprintf("%s and (%s)", cond, where)
+	}
+	return fmt.Sprintf("select %s from %s.%s where %s order by %s limit 1 offset %d",
+		strings.Join(names, ", "), sql.EscapeName(schema), sql.EscapeName(table), cond,
+		strings.Join(names, ", "), chunkSize-1), args
+}
+
+// checksumQuery returns the query of the row count and of the checksum of
+// the columns of the rows matching cond and where. NULL is told apart
+// from the empty string by the flags ending the checksummed text.
+func checksumQuery(schema, table string, columns []string, cond, where string) string {
+	names := make([]string, len(columns))
+	nulls := make([]string, len(columns))
+	for i, name := range columns {
+		names[i] = sql.EscapeName(name)
+		nulls[i] = fmt.Sprintf("isnull(%s)", names[i])
+	}
+	if where != "" {
+		cond = fmt.Sprintf("%s and (%s)", cond, where)
+	}
+	return fmt.Sprintf("select count(*), coalesce(bit_xor(crc32(concat_ws('#', %s, concat(%s)))), 0) from %s.%s where %s",
+		strings.Join(names, ", "), strings.Join(nulls, ", "), sql.EscapeName(schema), sql.EscapeName(table), cond)
+}
+
+// nextChunkBound returns the key the query of chunkBoundQuery finds, nil
+// if the last chunk ends before
+func nextChunkBound(db *gosql.DB, query string, args []interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]gosql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	bound := make([]string, len(values))
+	for i, v := range values {
+		bound[i] = v.String
+	}
+	return bound, nil
+}
+
+type chunkChecksum struct {
+	rows     int64
+	checksum uint64
+}
+
+func checksumChunk(db *gosql.DB, query string, args []interface{}) (*chunkChecksum, error) {
+	c := &chunkChecksum{}
+	if err := db.QueryRow(query, args...).Scan(&c.rows, &c.checksum); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChunkRange(t *testing.T) {
+	key := []string{"region", "id"}
+	tests := []struct {
+		name         string
+		lower, upper []string
+		want         string
+		wantArgs     []interface{}
+	}{
+		{"whole table", nil, nil, "true", nil},
+		{"first", nil, []string{"eu", "10"}, "(`region`, `id`) <= (?, ?)", []interface{}{"eu", "10"}},
+		{"last", []string{"eu", "10"}, nil, "(`region`, `id`) > (?, ?)", []interface{}{"eu", "10"}},
+		{"middle", []string{"eu", "10"}, []string{"us", "3"}, "(`region`, `id`) > (?, ?) and (`region`, `id`) <= (?, ?)",
+			[]interface{}{"eu", "10", "us", "3"}},
+	}
+	for _, tt := range tests {
+		got, args := chunkRange(key, tt.lower, tt.upper)
+		if got != tt.want || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("%s: chunkRange() = %q, %v, want %q, %v", tt.name, got, args, tt.want, tt.wantArgs)
+		}
+	}
+}
+
+func TestVerifyQueries(t *testing.T) {
+	query, args := chunkBoundQuery("db1", "t1", []string{"id"}, []string{"1000"}, "region = 'us'", 1000)
+	if want := "select `id` from `db1`.`t1` where (`id`) > (?) and (region = 'us') order by `id` limit 1 offset 999"; query != want {
+		t.Errorf("chunkBoundQuery() = %v, want %v", query, want)
+	}
+	if want := []interface{}{"1000"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("chunkBoundQuery() args = %v, want %v", args, want)
+	}
+
+	query = checksumQuery("db1", "t1", []string{"id", "name"}, "(`id`) <= (?)", "")
+	want := "select count(*), coalesce(bit_xor(crc32(concat_ws('#', `id`, `name`, concat(isnull(`id`), isnull(`name`))))), 0) " +
+		"from `db1`.`t1` where (`id`) <= (?)"
+	if query != want {
+		t.Errorf("checksumQuery() = %v, want %v", query, want)
+	}
+}
@@ -21,11 +21,18 @@ const (
 	ReasonUnrecoverableErrror = "Error was unrecoverable"
 	ReasonWithinPolicy        = "Restart within policy"
 	ReasonDelay               = "Exceeded allowed attempts, applying a delay"
+	ReasonFail                = "Exceeded allowed attempts, not restarting"
 )
 
-func newRestartTracker() *RestartTracker {
+// newRestartTracker returns the tracker of the restarts of a task of a job
+// with the restart policy, the default one if nil
+func newRestartTracker(policy *models.RestartPolicy) *RestartTracker {
+	if policy == nil {
+		policy = models.NewDefaultRestartPolicy()
+	}
 	onSuccess := true
 	return &RestartTracker{
+		policy:    policy,
 		startTime: time.Now(),
 		onSuccess: onSuccess,
 		rand:      rand.New(rand.NewSource(time.Now().Unix())),
@@ -33,6 +40,7 @@ func newRestartTracker() *RestartTracker {
 }
 
 type RestartTracker struct {
+	policy           *models.RestartPolicy
 	waitRes          *models.WaitResult
 	startErr         error
 	restartTriggered bool      // Whether the task has been signalled to be restarted
@@ -116,7 +124,7 @@ func (r *RestartTracker) GetState() (string, time.Duration) {
 	r.count++
 
 	// Check if we have entered a new interval.
-	end := r.startTime.Add(1 * time.Minute)
+	end := r.startTime.Add(r.interval())
 	now := time.Now()
 	if now.After(end) {
 		r.count = 0
@@ -143,7 +151,7 @@ func (r *RestartTracker) handleStartError() (string, time.Duration) {
 		return models.TaskNotRestarting, 0
 	}
 
-	if r.count > 5 {
+	if r.count > r.policy.Attempts {
 		r.reason = ReasonDelay
 		return models.TaskRestarting, r.getDelay()
 	}
@@ -162,7 +170,11 @@ func (r *RestartTracker) handleWaitResult() (string, time.Duration) {
 		return models.TaskTerminated, 0
 	}
 
-	if r.count > 5 {
+	if r.count > r.policy.Attempts {
+		if r.policy.Mode == models.RestartPolicyModeFail {
+			r.reason = ReasonFail
+			return models.TaskNotRestarting, 0
+		}
 		r.reason = ReasonDelay
 		return models.TaskRestarting, r.getDelay()
 	}
@@ -171,17 +183,23 @@ func (r *RestartTracker) handleWaitResult() (string, time.Duration) {
 	return models.TaskRestarting, r.jitter()
 }
 
+// interval returns the interval the attempts of the policy are counted in
+func (r *RestartTracker) interval() time.Duration {
+	return time.Duration(r.policy.IntervalSeconds) * time.Second
+}
+
 // getDelay returns the delay time to enter the next interval.
 func (r *RestartTracker) getDelay() time.Duration {
-	end := r.startTime.Add(1 * time.Minute)
+	end := r.startTime.Add(r.interval())
 	now := time.Now()
 	return end.Sub(now)
 }
 
-// jitter returns the delay time plus a jitter.
+// jitter returns the delay time plus a jitter. The delay grows with the
+// restarts within the interval as the policy backs off.
 func (r *RestartTracker) jitter() time.Duration {
 	// Get the delay and ensure it is valid.
-	d := 15 * time.Second.Nanoseconds()
+	d := r.policy.Delay(r.count).Nanoseconds()
 	if d == 0 {
 		d = 1
 	}
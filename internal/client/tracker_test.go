@@ -24,7 +24,7 @@ func Test_newRestartTracker(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := newRestartTracker(); !reflect.DeepEqual(got, tt.want) {
+			if got := newRestartTracker(nil); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("newRestartTracker() = %v, want %v", got, tt.want)
 			}
 		})
@@ -404,3 +404,40 @@ func TestRestartTracker_jitter(t *testing.T) {
 		})
 	}
 }
+
+func TestRestartTracker_policy(t *testing.T) {
+	policy := &models.RestartPolicy{
+		Attempts:        3,
+		IntervalSeconds: 600,
+		DelaySeconds:    10,
+		MaxDelaySeconds: 30,
+		Mode:            models.RestartPolicyModeFail,
+	}
+	r := newRestartTracker(policy)
+	failed := models.NewWaitResult(1, models.NewPanicError("boom"))
+
+	// The delays back off up to the maximum, before jitter
+	for _, want := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second} {
+		state, delay := r.SetWaitResult(failed).GetState()
+		if state != models.TaskRestarting {
+			t.Fatalf("GetState() = %v, want %v", state, models.TaskRestarting)
+		}
+		if delay < want || delay > want+want/4 {
+			t.Errorf("GetState() delay = %v, want %v plus jitter", delay, want)
+		}
+	}
+	if state, _ := r.SetWaitResult(failed).GetState(); state != models.TaskNotRestarting {
+		t.Errorf("GetState() = %v after %d restarts, want %v", state, policy.Attempts, models.TaskNotRestarting)
+	}
+	if reason := r.GetReason(); reason != ReasonFail {
+		t.Errorf("GetReason() = %q, want %q", reason, ReasonFail)
+	}
+
+	// In delay mode, the task restarts once the interval ends
+	policy.Mode = models.RestartPolicyModeDelay
+	r = newRestartTracker(policy)
+	r.count = policy.Attempts
+	if state, delay := r.SetWaitResult(failed).GetState(); state != models.TaskRestarting || delay <= 30*time.Second {
+		t.Errorf("GetState() = %v, %v, want %v until the interval ends", state, delay, models.TaskRestarting)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
@@ -47,6 +48,9 @@ type Worker struct {
 	alloc          *models.Allocation
 	restartTracker *RestartTracker
 
+	// breaker pauses the job when the task fails too often
+	breaker *circuitBreaker
+
 	// running marks whether the task is running
 	running     bool
 	runningLock sync.Mutex
@@ -54,10 +58,15 @@ type Worker struct {
 	taskStats     *models.TaskStatistics
 	taskStatsLock sync.RWMutex
 
+	// errorCount is how many times the task failed
+	errorCount int64
+
 	task *models.Task
 
 	handle     driver.DriverHandle
 	handleLock sync.Mutex
+	// paused marks whether the task should be paused, guarded by handleLock
+	paused bool
 
 	// payloadRendered tracks whether the payload has been rendered to disk
 	payloadRendered bool
@@ -112,13 +121,14 @@ func NewWorker(logger *log.Logger, config *config.ClientConfig,
 		return nil
 	}
 
-	restartTracker := newRestartTracker()
+	restartTracker := newRestartTracker(alloc.Job.RestartPolicy)
 
 	tc := &Worker{
 		config:         config,
 		updater:        updater,
 		logger:         logger,
 		restartTracker: restartTracker,
+		breaker:        newCircuitBreaker(alloc.Job.CircuitBreaker),
 		alloc:          alloc,
 		task:           task,
 		destroyCh:      make(chan struct{}),
@@ -178,16 +188,23 @@ func (r *Worker) SaveState() error {
 				}
 			}
 		} else {
-			r.workUpdates <- &models.TaskUpdate{
+			update := &models.TaskUpdate{
 				JobID:    r.alloc.JobID,
 				NatsAddr: id.DriverConfig.NatsAddr,
 			}
+			if r.task.Type == models.TaskTypeDest {
+				update.DumpCheckpoint = id.DriverConfig.DumpCheckpoint
+			}
+			r.workUpdates <- update
 		}
 		r.logger.Debugf("Worker.SaveState: lock: %p, %p", r.task, r.task.ConfigLock)
 		r.task.ConfigLock.Lock()
 		r.logger.Debugf("Worker.SaveState: after lock: %p", r.task)
 		r.task.Config["Gtid"] = id.DriverConfig.Gtid
 		r.task.Config["NatsAddr"] = id.DriverConfig.NatsAddr
+		if r.task.Type == models.TaskTypeDest {
+			r.task.Config["DumpCheckpoint"] = id.DriverConfig.DumpCheckpoint
+		}
 		r.task.ConfigLock.Unlock()
 		r.logger.Debugf("Worker.SaveState: after unlock: %p", r.task)
 	}
@@ -218,7 +235,15 @@ func (r *Worker) setState(state string, event *models.TaskEvent) {
 
 // createDriver makes a driver for the task
 func (r *Worker) createDriver() (driver.Driver, error) {
-	driverCtx := driver.NewDriverContext(r.task.Type, r.alloc.ID, r.config, r.config.Node, r.logger)
+	// Create a task-specific event emitter callback to expose minimal
+	// state to drivers
+	eventEmitter := func(m string, args ...interface{}) {
+		msg := fmt.Sprintf(m, args...)
+		r.logger.Debugf("agent: driver event for alloc %q: %s", r.alloc.ID, msg)
+		r.setState("", models.NewTaskEvent(models.TaskDriverMessage).SetDriverMessage(msg))
+	}
+
+	driverCtx := driver.NewDriverContext(r.task.Type, r.alloc.ID, r.config, r.config.Node, r.logger, eventEmitter)
 	driver, err := driver.NewDriver(r.task.Driver, driverCtx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create driver '%s' for alloc %s: %v",
@@ -306,6 +331,7 @@ func (r *Worker) run() {
 					startErr := r.startTask()
 					r.restartTracker.SetStartError(startErr)
 					if startErr != nil {
+						atomic.AddInt64(&r.errorCount, 1)
 						r.logger.Debugf("setState 2")
 						r.setState("", models.NewTaskEvent(models.TaskDriverFailure).SetDriverError(startErr))
 						goto RESTART
@@ -343,7 +369,13 @@ func (r *Worker) run() {
 				r.logger.Debugf("setState 4")
 				r.setState("", r.waitErrorToEvent(waitRes))
 				if !waitRes.Successful() {
+					atomic.AddInt64(&r.errorCount, 1)
 					r.logger.Errorf("agent: Task %q for alloc %q failed: %v", r.task.Type, r.alloc.ID, waitRes)
+					if waitRes.Err != nil {
+						r.recordFailure(waitRes.Err.Error())
+					} else {
+						r.recordFailure(waitRes.String())
+					}
 				} else {
 					r.logger.Printf("agent: Task %q for alloc %q completed successfully", r.task.Type, r.alloc.ID)
 				}
@@ -427,6 +459,23 @@ func (r *Worker) run() {
 	}
 }
 
+// recordFailure records the failure err of the task with the circuit
+// breaker of its job. If it trips, the task is paused from its restart on,
+// and the servers are asked to pause the job, until it is resumed.
+func (r *Worker) recordFailure(err string) {
+	tripped, pattern := r.breaker.fail(time.Now(), err)
+	if !tripped {
+		return
+	}
+	r.logger.Errorf("agent: Circuit breaker of job %q tripped on task %q for alloc %q: %s",
+		r.alloc.JobID, r.task.Type, r.alloc.ID, pattern)
+	r.handleLock.Lock()
+	r.paused = true
+	r.handleLock.Unlock()
+	r.setState("", models.NewTaskEvent(models.TaskCircuitBreakerTripped).SetMessage(pattern))
+	r.workUpdates <- &models.TaskUpdate{JobID: r.alloc.JobID, Pause: true}
+}
+
 // shouldRestart returns if the task should restart. If the return value is
 // true, the task's restart policy has already been considered and any wait time
 // between restarts has been applied.
@@ -517,7 +566,15 @@ func (r *Worker) killTask(killingEvent *models.TaskEvent) {
 }
 
 // startTask creates the driver, task dir, and starts the task.
-func (r *Worker) startTask() error {
+func (r *Worker) startTask() (err error) {
+	defer func() {
+		// A driver panicking fails the start of the task alone
+		if p := recover(); p != nil {
+			err = models.NewRecoverableError(models.NewPanicError(p), true)
+			r.logger.Errorf("agent: Failed to start task %q for alloc %q: %v", r.task.Type, r.alloc.ID, err)
+		}
+	}()
+
 	// Create a driver
 	drv, err := r.createDriver()
 	if err != nil {
@@ -527,6 +584,9 @@ func (r *Worker) startTask() error {
 
 	// Run prestart
 	ctx := driver.NewExecContext(r.alloc.Job.ID, r.alloc.Job.Type, r.config.MaxPayload)
+	if r.task.Type == models.TaskTypeDest {
+		ctx.Source = r.alloc.Job.LookupTask(models.TaskTypeSrc)
+	}
 
 	// Start the job
 	handle, err := drv.Start(ctx, r.task)
@@ -539,8 +599,14 @@ func (r *Worker) startTask() error {
 	}
 
 	r.handleLock.Lock()
+	defer r.handleLock.Unlock()
 	r.handle = handle
-	r.handleLock.Unlock()
+	// A task restarted while its job is paused starts paused
+	if pauser, ok := handle.(driver.Pauser); ok && r.paused {
+		if err := pauser.Pause(); err != nil {
+			r.logger.Errorf("agent: Failed to pause task %q for alloc %q: %v", r.task.Type, r.alloc.ID, err)
+		}
+	}
 	return nil
 }
 
@@ -588,6 +654,88 @@ func (r *Worker) collectResourceUsageStats(stopCollection <-chan struct{}) {
 	}
 }
 
+// SetThrottle changes the rates the running task writes at. It returns
+// false if the task can't be throttled.
+func (r *Worker) SetThrottle(bytesPerSecond, rowsPerSecond int64) (bool, error) {
+	r.handleLock.Lock()
+	handle := r.handle
+	r.handleLock.Unlock()
+	throttler, ok := handle.(driver.Throttler)
+	if !ok {
+		return false, nil
+	}
+	return true, throttler.SetThrottle(bytesPerSecond, rowsPerSecond)
+}
+
+// SetPaused pauses or resumes the running task, which goes on from where it
+// stopped. It returns false if the task can't be paused.
+func (r *Worker) SetPaused(paused bool) (bool, error) {
+	r.handleLock.Lock()
+	r.paused = paused
+	handle := r.handle
+	r.handleLock.Unlock()
+	if !paused {
+		// The job was resumed, its failures start over
+		r.breaker.reset()
+	}
+	pauser, ok := handle.(driver.Pauser)
+	if !ok {
+		return false, nil
+	}
+
+	var err error
+	event := models.NewTaskEvent(models.TaskPaused)
+	if paused {
+		err = pauser.Pause()
+	} else {
+		err = pauser.Resume()
+		event = models.NewTaskEvent(models.TaskResumed)
+	}
+	if err != nil {
+		return true, err
+	}
+	r.setState(models.TaskStateRunning, event)
+	return true, nil
+}
+
+// Reload sets the fields of the configuration of the task to those of
+// task, and has the running task reload them. The fields are recorded in
+// the events of the task.
+func (r *Worker) Reload(task *models.Task, fields []string) error {
+	r.task.ConfigLock.Lock()
+	for _, k := range fields {
+		if v, ok := task.Config[k]; ok {
+			r.task.Config[k] = v
+		} else {
+			delete(r.task.Config, k)
+		}
+	}
+	config := make(map[string]interface{}, len(r.task.Config))
+	for k, v := range r.task.Config {
+		config[k] = v
+	}
+	r.task.ConfigLock.Unlock()
+
+	r.handleLock.Lock()
+	handle := r.handle
+	r.handleLock.Unlock()
+
+	var err error
+	if handle != nil {
+		if reloader, ok := handle.(driver.Reloader); !ok {
+			err = fmt.Errorf("the %s driver can't reload its configuration, restart the job", r.task.Driver)
+		} else if config, err = r.config.SecretsKeyring.OpenTaskConfig(config); err == nil {
+			err = reloader.Reload(config, fields)
+		}
+	}
+	message := fmt.Sprintf("Reloaded %s", strings.Join(fields, ", "))
+	if err != nil {
+		message = fmt.Sprintf("Failed to reload %s: %v", strings.Join(fields, ", "), err)
+	}
+	r.setState("", models.NewTaskEvent(models.TaskReloaded).SetMessage(message))
+	return err
+}
+
 // LatestResourceUsage returns the last resource utilization datapoint collected
 func (r *Worker) LatestTaskStats() *models.TaskStatistics {
 	r.taskStatsLock.RLock()
@@ -603,6 +751,35 @@ func (r *Worker) LatestTaskStats() *models.TaskStatistics {
 	return r.taskStats
 }
 
+// TaskMetrics returns the metrics of the task reported to the servers. They
+// only hold the error count while the task doesn't run.
+func (r *Worker) TaskMetrics() *models.TaskMetrics {
+	m := &models.TaskMetrics{
+		JobID:      r.alloc.JobID,
+		AllocID:    r.alloc.ID,
+		TaskType:   r.task.Type,
+		ErrorCount: atomic.LoadInt64(&r.errorCount),
+	}
+	if stats := r.LatestTaskStats(); stats != nil {
+		m.RowsApplied = stats.RowsApplied
+		m.BytesApplied = stats.BytesApplied
+		m.LastAppliedGtid = stats.LastAppliedGtid
+		if d := stats.Dump; d != nil {
+			m.RowsCopied = d.RowsCopied
+			m.RowsEstimate = d.RowsEstimate
+			m.RowsEstimateUnknown = d.RowsEstimateUnknown
+		}
+		if d := stats.DelayCount; d != nil {
+			// The lag of the heartbeats, of the transactions without them
+			m.LagSeconds = d.LagSeconds
+			if m.LagSeconds == 0 {
+				m.LagSeconds = float64(d.Time)
+			}
+		}
+	}
+	return m
+}
+
 // handleDestroy kills the task handle. In the case that killing fails,
 // handleDestroy will retry with an exponential backoff and will give up at a
 // given limit. It returns whether the task was destroyed and the error
@@ -666,8 +843,14 @@ func (r *Worker) UnblockStart(source string) {
 	close(r.unblockCh)
 }
 
-// Helper function for converting a WaitResult into a TaskTerminated event.
+// Helper function for converting a WaitResult into a TaskTerminated event, or
+// a TaskPanicked one if the task panicked.
 func (r *Worker) waitErrorToEvent(res *models.WaitResult) *models.TaskEvent {
+	if _, ok := res.Err.(*models.PanicError); ok {
+		return models.NewTaskEvent(models.TaskPanicked).
+			SetExitCode(res.ExitCode).
+			SetExitMessage(res.Err)
+	}
 	return models.NewTaskEvent(models.TaskTerminated).
 		SetExitCode(res.ExitCode).
 		SetExitMessage(res.Err)
@@ -702,6 +885,20 @@ func (r *Worker) emitStats(ru *models.TaskStatistics) {
 		metrics.SetGaugeWithLabels([]string{"buffer", "dest_queue_size"}, float32(ru.BufferStat.ApplierTxQueueSize), labels)
 		metrics.SetGaugeWithLabels([]string{"buffer", "send_by_timeout"}, float32(ru.BufferStat.SendByTimeout), labels)
 		metrics.SetGaugeWithLabels([]string{"buffer", "send_by_size_full"}, float32(ru.BufferStat.SendBySizeFull), labels)
+		metrics.SetGaugeWithLabels([]string{"buffer", "binlog_entries"}, float32(ru.BufferStat.BinlogBufferEntries), labels)
+		metrics.SetGaugeWithLabels([]string{"buffer", "binlog_bytes"}, float32(ru.BufferStat.BinlogBufferBytes), labels)
+		metrics.SetGaugeWithLabels([]string{"buffer", "binlog_fill"}, float32(ru.BufferStat.BinlogBufferFill), labels)
+		metrics.SetGaugeWithLabels([]string{"buffer", "binlog_paused_seconds"}, float32(ru.BufferStat.BinlogPausedSeconds), labels)
+		metrics.SetGaugeWithLabels([]string{"binlog", "reconnects"}, float32(ru.BinlogReconnects), labels)
+		metrics.SetGaugeWithLabels([]string{"binlog", "failovers"}, float32(ru.BinlogFailovers), labels)
+		metrics.SetGaugeWithLabels([]string{"applier", "slow_transactions"}, float32(ru.SlowTransactions), labels)
+		metrics.SetGaugeWithLabels([]string{"applier", "batch_statements"}, float32(ru.BatchStatements), labels)
+		metrics.SetGaugeWithLabels([]string{"applier", "batched_rows"}, float32(ru.BatchedRows), labels)
+		metrics.SetGaugeWithLabels([]string{"applier", "dropped_rows"}, float32(ru.DroppedRows), labels)
+		metrics.SetGaugeWithLabels([]string{"applier", "skipped_errors"}, float32(ru.SkippedErrors), labels)
+		if ru.ParallelWorkers > 0 {
+			metrics.SetGaugeWithLabels([]string{"applier", "workers"}, float32(ru.ParallelWorkers), labels)
+		}
 	}
 	if ru.TableStats != nil && r.config.PublishAllocationMetrics {
 		metrics.SetGaugeWithLabels([]string{"table", "insert"}, float32(ru.TableStats.InsertCount), labels)
@@ -709,9 +906,25 @@ func (r *Worker) emitStats(ru *models.TaskStatistics) {
 		metrics.SetGaugeWithLabels([]string{"table", "delete"}, float32(ru.TableStats.DelCount), labels)
 	}
 
+	if ru.Connections != nil && r.config.PublishAllocationMetrics {
+		targetLabels := append(labels, metrics.Label{"target", ru.Connections.Target})
+		metrics.SetGaugeWithLabels([]string{"applier", "connections_open"}, float32(ru.Connections.Open), targetLabels)
+		metrics.SetGaugeWithLabels([]string{"applier", "worker_connections"}, float32(ru.Connections.Workers), targetLabels)
+		metrics.SetGaugeWithLabels([]string{"applier", "worker_connections_in_use"}, float32(ru.Connections.WorkersInUse), targetLabels)
+		metrics.SetGaugeWithLabels([]string{"applier", "connection_wait_seconds"}, float32(ru.Connections.WaitSeconds), targetLabels)
+	}
+
+	if ru.Dump != nil && r.config.PublishAllocationMetrics {
+		metrics.SetGaugeWithLabels([]string{"dump", "bytes"}, float32(ru.Dump.Bytes), labels)
+		metrics.SetGaugeWithLabels([]string{"dump", "wire_bytes"}, float32(ru.Dump.WireBytes), labels)
+		metrics.SetGaugeWithLabels([]string{"dump", "seconds"}, float32(ru.Dump.Seconds), labels)
+	}
+
 	if ru.DelayCount != nil && r.config.PublishAllocationMetrics {
 		metrics.SetGaugeWithLabels([]string{"delay", "num"}, float32(ru.DelayCount.Num), labels)
 		metrics.SetGaugeWithLabels([]string{"delay", "time"}, float32(ru.DelayCount.Time), labels)
+		metrics.SetGaugeWithLabels([]string{"delay", "lag_seconds"}, float32(ru.DelayCount.LagSeconds), labels)
+		metrics.SetGaugeWithLabels([]string{"delay", "throttled_seconds"}, float32(ru.DelayCount.ThrottledSeconds), labels)
 	}
 
 	if ru.ThroughputStat != nil && r.config.PublishAllocationMetrics {
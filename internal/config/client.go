@@ -8,8 +8,10 @@ package config
 
 import (
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -35,6 +37,121 @@ const (
 	defaultChunkSize  = 2000
 	defaultNumWorkers = 1
 	defaultMsgBytes   = 20 * 1024
+
+	defaultBinlogReconnectMaxRetries = 10
+)
+
+// Values of MySQLDriverConfig.DependencyTracking, which decides what
+// transactions the applier may apply in parallel
+const (
+	// DependencyTrackingCommitOrder follows the logical clock of the
+	// source, transactions committed together there are applied together
+	DependencyTrackingCommitOrder = "commit_order"
+	// DependencyTrackingTable keeps the order of the transactions writing
+	// to the same table
+	DependencyTrackingTable = "table"
+	// DependencyTrackingWriteset keeps the order of the transactions
+	// writing to the same rows, found by primary key. Tables with other
+	// unique keys or without a primary key are tracked as a whole.
+	DependencyTrackingWriteset = "writeset"
+)
+
+// Values of TableRouting.Method, which decides how the value of the key
+// column picks the target table of a row
+const (
+	// RoutingByValue looks the value up in TableRouting.Values
+	RoutingByValue = "value"
+	// RoutingByHash picks one of TableRouting.Tables by the CRC32 of the
+	// value
+	RoutingByHash = "hash"
+)
+
+// Values of MySQLDriverConfig.ConflictPolicy, which decides what the
+// applier does with a row conflicting with the one of the target: an
+// insert of a key the target holds, or an update or delete of a row the
+// target doesn't hold or holds in another version
+const (
+	// ConflictPolicyError fails the job
+	ConflictPolicyError = "error"
+	// ConflictPolicySource writes the row of the source over the one of
+	// the target
+	ConflictPolicySource = "source"
+	// ConflictPolicyTarget keeps the row of the target and leaves the
+	// change out
+	ConflictPolicyTarget = "target"
+	// ConflictPolicyTimestamp keeps the row with the latest
+	// ConflictColumn, the one of the source on a tie
+	ConflictPolicyTimestamp = "timestamp"
+)
+
+// Values of MySQLDriverConfig.DumpCompression, which decides whether the
+// rows of the copy are compressed on their way to the applier
+const (
+	// DumpCompressionAuto compresses them when the applier runs on
+	// another node than the extractor
+	DumpCompressionAuto = "auto"
+	// DumpCompressionSnappy always compresses them with snappy
+	DumpCompressionSnappy = "snappy"
+	// DumpCompressionNone never compresses them
+	DumpCompressionNone = "none"
+)
+
+// Values of DDLRule.Action, what the applier does with a DDL statement
+const (
+	// DDLActionApply executes the statement as it is
+	DDLActionApply = "apply"
+	// DDLActionSkip logs the statement and leaves it out
+	DDLActionSkip = "skip"
+	// DDLActionRewrite replaces the matches of DDLRule.Match before
+	// executing the statement
+	DDLActionRewrite = "rewrite"
+	// DDLActionFail fails the job on the statement
+	DDLActionFail = "fail"
+)
+
+// Values of ColumnConversion.To, the built-in conversions of the values of
+// a column of the source to the type of the column of the target
+const (
+	// ConvertToInteger converts numbers, and text holding one, to an
+	// integer type, dropping the fraction
+	ConvertToInteger = "integer"
+	// ConvertToDecimal converts numbers to the precision and scale of a
+	// DECIMAL column, rounding half away from zero
+	ConvertToDecimal = "decimal"
+	// ConvertToDouble converts numbers to a DOUBLE or FLOAT column
+	ConvertToDouble = "double"
+	// ConvertToString writes values as text to a CHAR, VARCHAR or TEXT
+	// column
+	ConvertToString = "string"
+)
+
+// Values of ColumnConversion.OnLoss, what the applier does with a value the
+// column of the target can't hold exactly: it overflows, or loses digits
+// or characters
+const (
+	// OnLossFail fails the transaction writing the value
+	OnLossFail = "fail"
+	// OnLossTruncate writes the closest value the column holds, and logs a
+	// warning
+	OnLossTruncate = "truncate"
+)
+
+// Values of MySQLDriverConfig.InvalidCharacters, what the applier does with
+// the text of a column holding bytes invalid in the charset of the source,
+// or characters the column of the target can't hold
+const (
+	// InvalidCharactersFail fails the transaction writing the text
+	InvalidCharactersFail = "fail"
+	// InvalidCharactersReplace writes U+FFFD in place of the invalid bytes,
+	// and ? in place of the characters the target can't hold
+	InvalidCharactersReplace = "replace"
+)
+
+// Values of Table.Operations, the row operations of the source
+const (
+	OperationInsert = "insert"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
 )
 
 // RPCHandler can be provided to the Client if there is a local server
@@ -80,6 +197,13 @@ type ClientConfig struct {
 	// ConsulConfig is this Agent's Consul configuration
 	ConsulConfig *ConsulConfig
 
+	// TLSConfig holds various TLS related configurations
+	TLSConfig *TLSConfig
+
+	// SecretsKeyring opens the passwords of the jobs the servers sealed,
+	// for the tasks to connect with
+	SecretsKeyring *Keyring
+
 	NatsAddr string
 
 	MaxPayload int
@@ -110,6 +234,7 @@ func (c *ClientConfig) Copy() *ClientConfig {
 	nc.Node = nc.Node.Copy()
 	nc.Servers = internal.CopySliceString(nc.Servers)
 	nc.ConsulConfig = c.ConsulConfig.Copy()
+	nc.TLSConfig = c.TLSConfig.Copy()
 	return nc
 }
 
@@ -118,7 +243,7 @@ type DriverCtx struct {
 }
 
 func (d *DataSource) String() string {
-	return fmt.Sprintf(d.TableSchema)
+	return d.TableSchema
 }
 
 type MySQLDriverConfig struct {
@@ -152,6 +277,7 @@ type MySQLDriverConfig struct {
 	AutoGtid                 bool // For internal use. Might be changed without notification.
 	NatsAddr                 string
 	ParallelWorkers          int
+	DependencyTracking       string
 	ConnectionConfig         *umconf.ConnectionConfig
 	SystemVariables          map[string]string
 	HasSuperPrivilege        bool
@@ -181,6 +307,162 @@ type MySQLDriverConfig struct {
 	UserCommandedUnpostponeFlag int64
 
 	SkipPrivilegeCheck bool
+
+	// DDLRules decide what the applier does with each DDL statement, the
+	// first one matching it wins. Statements no rule matches are applied.
+	DDLRules []*DDLRule
+	// DDLDryRun reports what DDLRules would do to the statements, and
+	// applies them as they are
+	DDLDryRun bool
+
+	// HeartbeatIntervalSeconds is how often the extractor writes the time
+	// to HeartbeatTable on the source, never if 0. The applier reports the
+	// age of the last heartbeat it applied as the lag of the job.
+	HeartbeatIntervalSeconds int
+	// HeartbeatTable is the schema.table the heartbeats are written to,
+	// heartbeat in the dtle schema if empty
+	HeartbeatTable string
+
+	// ThrottleBytesPerSecond and ThrottleRowsPerSecond limit the rate the
+	// applier writes to the target at, 0 not to limit it. They can be
+	// changed while the job runs.
+	ThrottleBytesPerSecond int64
+	ThrottleRowsPerSecond  int64
+
+	// ConflictPolicy is one of the ConflictPolicy values. Conflicts are not
+	// looked for if it's empty: inserts replace the rows of the target, and
+	// the errors of updates fail the job.
+	ConflictPolicy string
+	// ConflictColumn is the column holding the version of rows, such as the
+	// time they were last written at. Updates and deletes also conflict
+	// with a row of another version if it is set. Tables without it can
+	// only have conflicts of keys.
+	ConflictColumn string
+
+	// DumpCheckpoint is how far the full copy went when the job stopped.
+	// The applier records it as it commits the chunks of the copy, if
+	// ApproveHeterogeneous, and the extractor resumes the copy from there.
+	DumpCheckpoint *models.DumpCheckpoint
+
+	// BinlogReconnectMaxRetries is how many times in a row the extractor
+	// tries to connect the binlog stream again when the connection to the
+	// source breaks, before failing the job. 10 if 0, never if negative.
+	BinlogReconnectMaxRetries int
+
+	// SlowTransactionMilliseconds is how long the applier may take to apply
+	// a transaction before it logs it as slow, with its GTID, row count and
+	// tables. Transactions are not logged if 0.
+	SlowTransactionMilliseconds int
+
+	// ApplyBatchSize is how many consecutive inserts, or deletes, of a
+	// table the applier writes in one statement at most. Rows are written
+	// one statement each if it's 0 or 1.
+	ApplyBatchSize int
+
+	// CreateTables has the applier create the tables of the target that
+	// don't exist yet when the job starts, from their definitions on the
+	// source, with the renames, column filters and conversion types of
+	// ReplicateDoDb applied
+	CreateTables bool
+	// SkipCreateIndexes and SkipCreateForeignKeys leave the secondary
+	// indexes and the foreign keys out of the tables the applier creates,
+	// at start and in the full copy. The primary key is always kept.
+	SkipCreateIndexes     bool
+	SkipCreateForeignKeys bool
+
+	// BinlogBufferBytes is how many bytes of transactions the extractor
+	// holds at most, read from the binlog and not yet sent to the applier.
+	// Once it holds as many, or ReplChanBufferSize transactions, it pauses
+	// reading the binlog until the applier takes some. Only
+	// ReplChanBufferSize bounds them if 0.
+	BinlogBufferBytes int64
+
+	// MaxConnections is how many connections the applier opens to the
+	// target at most. Its workers share all but one of them, and wait for
+	// a free one while the others use them all. 10 more than
+	// ParallelWorkers if 0.
+	MaxConnections int
+
+	// GtidStop, as "uuid:gno" for each uuid of GtidStart, is the last
+	// transaction a replay of the job applies. The extractor stops after
+	// it, and the applier completes once it applied it.
+	GtidStop string
+
+	// FailoverHosts are the "host:port" of the servers the extractor
+	// streams the binlog from, in order, when it can't reconnect to the
+	// source, with the User, Password and TLS of ConnectionConfig. It only
+	// streams from one which executed the transactions read so far.
+	FailoverHosts []string
+
+	// DumpCompression is one of the DumpCompression values, auto if empty
+	DumpCompression string
+
+	// DumpParallelism is how many connections of the extractor copy the
+	// rows of a table at once, in ranges of its unique key balanced by
+	// sampling the key. They read from snapshots opened at the same point
+	// of the binlog. Only the tables of more than ChunkSize rows whose key
+	// starts with an integer column are split. 1 if 0.
+	DumpParallelism int
+
+	// MaxParallelWorkers has the applier adjust its number of workers,
+	// from ParallelWorkers on, between MinParallelWorkers and it: it adds
+	// workers while the lag grows, and removes one when they stay mostly
+	// idle. TargetApplyMilliseconds, if not 0, is how long transactions
+	// may take to apply on average for workers to be added, longer meaning
+	// the target is the bottleneck. The number is not adjusted if
+	// MaxParallelWorkers is 0, MinParallelWorkers is 1 if 0.
+	MinParallelWorkers      int
+	MaxParallelWorkers      int
+	TargetApplyMilliseconds int
+
+	// SplitTransactionRows, if not 0, has the applier commit the
+	// transactions of more rows than it in parts of that many rows, each
+	// with its progress, so that a restart resumes after the last part
+	// committed. The target then holds the parts of a transaction before
+	// it holds all of it: the transactions split are not atomic. Those
+	// holding DDL are never split.
+	SplitTransactionRows int
+
+	// SourceCharset, if set, is the charset of the text columns of the
+	// source, in place of the charsets the source reports for them. The
+	// applier transcodes their values from it to the charsets of the
+	// columns of the target. InvalidCharacters is one of the
+	// InvalidCharacters values, InvalidCharactersFail if empty.
+	SourceCharset     string
+	InvalidCharacters string
+
+	// SkipErrors are the numbers of the MySQL errors the applier skips the
+	// statements of the binlog transactions failing with, rather than
+	// failing the job: the transaction goes on without them. Each
+	// statement skipped is logged and reported in a task event. The
+	// errors failing the transaction rather than the statement can't be
+	// skipped. Rows are not batched if set.
+	SkipErrors []int
+
+	// PartialJSONUpdates has the applier make the changes a partial update
+	// of a JSON document logged by MySQL 8.0, with
+	// binlog_row_value_options PARTIAL_JSON, with JSON_REPLACE, JSON_SET,
+	// JSON_ARRAY_INSERT and JSON_REMOVE on the document of the target,
+	// rather than writing the whole new document. Updates write the whole
+	// document to columns of the target which aren't JSON, of converted or
+	// filtered tables, and when a path counts cells from the last one.
+	PartialJSONUpdates bool
+}
+
+// DDLRule decides what the applier does with the DDL statements of a type
+type DDLRule struct {
+	// StatementType is the type of the statements the rule is for:
+	// create_table, alter_table, drop_index... (the verb and the object
+	// of the statement), or * or empty for all of them
+	StatementType string
+	// Match is a regular expression the statement must match for the rule
+	// to apply, any statement if empty
+	Match string
+	// Action is one of the DDLAction values, apply if empty
+	Action string
+	// Replacement replaces the matches of Match when rewriting, with $1
+	// standing for the first submatch
+	Replacement string
 }
 
 func (a *MySQLDriverConfig) SetDefault() *MySQLDriverConfig {
@@ -198,6 +480,9 @@ func (a *MySQLDriverConfig) SetDefault() *MySQLDriverConfig {
 	if result.ParallelWorkers <= 0 {
 		result.ParallelWorkers = defaultNumWorkers
 	}
+	if result.DependencyTracking == "" {
+		result.DependencyTracking = DependencyTrackingCommitOrder
+	}
 	if result.MsgBytesLimit <= 0 {
 		result.MsgBytesLimit = defaultMsgBytes
 	}
@@ -210,6 +495,9 @@ func (a *MySQLDriverConfig) SetDefault() *MySQLDriverConfig {
 	if result.GroupTimeout == 0 {
 		result.GroupTimeout = 100
 	}
+	if result.BinlogReconnectMaxRetries == 0 {
+		result.BinlogReconnectMaxRetries = defaultBinlogReconnectMaxRetries
+	}
 
 	// TODO temporarily (or permanently) disable homogeneous replication, hetero only.
 	result.ApproveHeterogeneous = true
@@ -220,9 +508,16 @@ func (a *MySQLDriverConfig) SetDefault() *MySQLDriverConfig {
 	return &result
 }
 
-// RequiresBinlogFormatChange is `true` when the original binlog format isn't `ROW`
+// RequiresBinlogFormatChange is `true` when the original binlog format logs
+// no rows: anything but `ROW` and `MIXED`. Statements `MIXED` logs as they
+// are fail the extractor when it reads them.
 func (m *MySQLDriverConfig) RequiresBinlogFormatChange() bool {
-	return m.BinlogFormat != "ROW"
+	switch strings.ToUpper(m.BinlogFormat) {
+	case "ROW", "MIXED":
+		return false
+	default:
+		return true
+	}
 }
 
 // ElapsedRowCopyTime returns time since starting to copy chunks of rows
@@ -300,6 +595,10 @@ func (m *MySQLDriverConfig) GetCriticalLoad() umconf.LoadMap {
 type DataSource struct {
 	TableSchema string
 	Tables      []*Table
+
+	// TableSchemaRename is the name of the schema on the target, if it
+	// differs from TableSchema
+	TableSchemaRename string
 }
 
 type Table struct {
@@ -307,6 +606,35 @@ type Table struct {
 	TableSchema string
 	Counter     int64
 
+	// TableRename is the name of the table on the target, if it differs
+	// from TableName
+	TableRename string
+
+	// IncludeColumns, if set, lists the only columns replicated to the
+	// target. ExcludeColumns lists columns that aren't. Both are read by
+	// the applier.
+	IncludeColumns []string
+	ExcludeColumns []string
+
+	// Routing, if set, spreads the rows of the table over several tables of
+	// the target, picked per row by the applier. They must exist when the
+	// job starts.
+	Routing *TableRouting
+
+	// ColumnConversions convert the values of columns to the type of the
+	// columns of the target before the applier writes them
+	ColumnConversions []*ColumnConversion
+
+	// SourceCharsets are the charsets of text columns of the source table,
+	// by column, in place of SourceCharset and the charsets the source
+	// reports for them
+	SourceCharsets map[string]string
+
+	// Operations, if set, lists the only row operations of the table, of
+	// the Operation values, replicated to the target. The applier drops
+	// the others. The rows of the full copy are always written.
+	Operations []string
+
 	OriginalTableColumns *umconf.ColumnList
 	UseUniqueKey         *umconf.UniqueKey
 	Iteration            int64
@@ -318,6 +646,240 @@ type Table struct {
 	Where string // TODO load from job description
 }
 
+// HasColumnFilter returns whether some columns of the table may not be
+// replicated
+func (t *Table) HasColumnFilter() bool {
+	return len(t.IncludeColumns) > 0 || len(t.ExcludeColumns) > 0
+}
+
+// ReplicatesColumn returns whether the column is replicated to the target
+func (t *Table) ReplicatesColumn(name string) bool {
+	if len(t.IncludeColumns) > 0 && !containsFold(t.IncludeColumns, name) {
+		return false
+	}
+	return !containsFold(t.ExcludeColumns, name)
+}
+
+// ReplicatesOperation returns whether the row operation op, one of the
+// Operation values, is replicated to the target
+func (t *Table) ReplicatesOperation(op string) bool {
+	return len(t.Operations) == 0 || containsFold(t.Operations, op)
+}
+
+// ValidateOperations checks Operations. The warnings tell how the target
+// drifts from the source with the operations left out.
+func (t *Table) ValidateOperations() (warnings []string, err error) {
+	if len(t.Operations) == 0 {
+		return nil, nil
+	}
+	for _, op := range t.Operations {
+		switch strings.ToLower(op) {
+		case OperationInsert, OperationUpdate, OperationDelete:
+		default:
+			return nil, fmt.Errorf("unsupported operation %q, want one of %v, %v, %v",
+				op, OperationInsert, OperationUpdate, OperationDelete)
+		}
+	}
+
+	inserts := t.ReplicatesOperation(OperationInsert)
+	updates := t.ReplicatesOperation(OperationUpdate)
+	deletes := t.ReplicatesOperation(OperationDelete)
+	if !inserts && (updates || deletes) {
+		warnings = append(warnings, "rows inserted on the source after the full copy are missing on the target, "+
+			"their updates and deletes change nothing")
+	}
+	if !updates {
+		warning := "rows updated on the source keep their old values on the target"
+		if deletes {
+			warning += ", their deletes find them only if the target table has a primary key"
+		}
+		warnings = append(warnings, warning)
+	}
+	if !deletes {
+		warnings = append(warnings, "rows deleted on the source stay on the target, "+
+			"a row inserted again with their key replaces them")
+	}
+	return warnings, nil
+}
+
+// ReplicatedColumns returns the columns of the target table that are
+// replicated. Their ordinals are still those of the row images. It fails
+// if a filter names an unknown column, or leaves out a primary key column
+// or a NOT NULL column without a default.
+func (t *Table) ReplicatedColumns(columns *umconf.ColumnList) (*umconf.ColumnList, error) {
+	if !t.HasColumnFilter() {
+		return columns, nil
+	}
+	for _, name := range append(t.IncludeColumns, t.ExcludeColumns...) {
+		found := false
+		for _, col := range columns.Columns {
+			found = found || strings.EqualFold(col.Name, name)
+		}
+		if !found {
+			return nil, fmt.Errorf("column %v of %v.%v in IncludeColumns or ExcludeColumns does not exist",
+				name, t.TableSchema, t.TableName)
+		}
+	}
+
+	result := &umconf.ColumnList{Ordinals: umconf.NewEmptyColumnsMap()}
+	for i, col := range columns.Columns {
+		switch {
+		case t.ReplicatesColumn(col.Name):
+			result.Columns = append(result.Columns, col)
+			result.Ordinals[col.Name] = i
+		case col.IsPk():
+			return nil, fmt.Errorf("column %v of %v.%v is part of the primary key and must be replicated",
+				col.Name, t.TableSchema, t.TableName)
+		case !col.Nullable && !col.HasDefault:
+			return nil, fmt.Errorf("column %v of %v.%v is NOT NULL without a default on the target and must be replicated",
+				col.Name, t.TableSchema, t.TableName)
+		}
+	}
+	return result, nil
+}
+
+// TableRouting picks the target table of each row of a table by the value
+// of its key column
+type TableRouting struct {
+	// Column is the key column
+	Column string
+	// Method is one of the Routing values, RoutingByValue if empty
+	Method string
+	// Tables are the tables rows are hashed to, with RoutingByHash
+	Tables []string
+	// Values maps the values of the key, as text, to their table, with
+	// RoutingByValue. Rows holding other values, or NULL, go to Default.
+	Values  map[string]string
+	Default string
+}
+
+// Validate checks the routing names a column and the tables for it
+func (r *TableRouting) Validate() error {
+	if r.Column == "" {
+		return fmt.Errorf("routing without Column")
+	}
+	switch r.Method {
+	case "", RoutingByValue:
+		if len(r.Values) == 0 && r.Default == "" {
+			return fmt.Errorf("routing by value without Values")
+		}
+	case RoutingByHash:
+		if len(r.Tables) == 0 {
+			return fmt.Errorf("routing by hash without Tables")
+		}
+	default:
+		return fmt.Errorf("unknown routing Method %q", r.Method)
+	}
+	for _, table := range r.TargetTables() {
+		if table == "" {
+			return fmt.Errorf("routing to a table without name")
+		}
+	}
+	return nil
+}
+
+// TargetTables returns the tables rows may be routed to, sorted
+func (r *TableRouting) TargetTables() []string {
+	names := r.Tables
+	if r.Method != RoutingByHash {
+		names = nil
+		for _, table := range r.Values {
+			names = append(names, table)
+		}
+		if r.Default != "" {
+			names = append(names, r.Default)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var tables []string
+	for _, table := range names {
+		if !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Route returns the target table of a row whose key holds value, which is
+// nil for NULL
+func (r *TableRouting) Route(value interface{}) (string, error) {
+	var text string
+	switch v := value.(type) {
+	case nil:
+	case []byte:
+		text = string(v)
+	default:
+		text = fmt.Sprint(v)
+	}
+
+	if r.Method == RoutingByHash {
+		return r.Tables[crc32.ChecksumIEEE([]byte(text))%uint32(len(r.Tables))], nil
+	}
+	if table, ok := r.Values[text]; ok && value != nil {
+		return table, nil
+	}
+	if r.Default == "" {
+		return "", fmt.Errorf("no table to route %v = %q to", r.Column, text)
+	}
+	return r.Default, nil
+}
+
+// ColumnConversion returns the conversion of the column name, nil if its
+// values are written as they are
+func (t *Table) ColumnConversion(name string) *ColumnConversion {
+	for _, c := range t.ColumnConversions {
+		if strings.EqualFold(c.Column, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// ColumnConversion converts the values of a column whose type differs
+// between the source and the target. Values it can't convert at all, like
+// text that is not a number, always fail the transaction.
+type ColumnConversion struct {
+	Column string
+	// To is one of the ConvertTo values
+	To string
+	// OnLoss is one of the OnLoss values, OnLossFail if empty
+	OnLoss string
+	// Type, if set, is the type of the column in the tables the applier
+	// creates, such as DECIMAL(10,2)
+	Type string
+}
+
+// Validate checks the conversion names a column, a built-in conversion and
+// what to do on loss
+func (c *ColumnConversion) Validate() error {
+	if c.Column == "" {
+		return fmt.Errorf("column conversion without Column")
+	}
+	switch c.To {
+	case ConvertToInteger, ConvertToDecimal, ConvertToDouble, ConvertToString:
+	default:
+		return fmt.Errorf("unknown conversion of column %v to %q", c.Column, c.To)
+	}
+	switch c.OnLoss {
+	case "", OnLossFail, OnLossTruncate:
+	default:
+		return fmt.Errorf("unknown OnLoss %q of column %v", c.OnLoss, c.Column)
+	}
+	return nil
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
 type TableContext struct {
 	Table          *Table
 	WhereCtx       *WhereContext
@@ -407,6 +969,7 @@ func DefaultClientConfig() *ClientConfig {
 	return &ClientConfig{
 		NatsAddr:                "0.0.0.0:8193",
 		ConsulConfig:            DefaultConsulConfig(),
+		TLSConfig:               &TLSConfig{},
 		LogOutput:               os.Stderr,
 		Region:                  "global",
 		StatsCollectionInterval: 1 * time.Second,
@@ -0,0 +1,344 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// sealedPrefix begins the secrets sealed by a keyring, followed by the ID
+// of the key and the base64 of the nonce and the ciphertext
+const sealedPrefix = "sealed:v1:"
+
+// Keyring seals the secrets of the jobs, the DSNs of their connections and
+// the checkpoints of their copies, with AES-GCM so that they are never
+// stored in plaintext. The first key seals, all of them open, so that a new
+// key can be put first while the secrets sealed by the old ones are still
+// opened.
+type Keyring struct {
+	keys []keyringKey
+}
+
+type keyringKey struct {
+	// id is the first bytes of the SHA-256 of the key, in hex
+	id   string
+	aead cipher.AEAD
+}
+
+// LoadKeyring reads the keys of a keyring from path, one base64 encoded
+// AES key of 16, 24 or 32 bytes per line
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the secrets keys: %v", err)
+	}
+	var keys [][]byte
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid base64 secrets key: %v", path, i+1, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s holds no secrets key", path)
+	}
+	return NewKeyring(keys)
+}
+
+// NewKeyring returns the keyring of keys, the first one sealing
+func NewKeyring(keys [][]byte) (*Keyring, error) {
+	k := &Keyring{}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secrets key: %v", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		k.keys = append(k.keys, keyringKey{id: hex.EncodeToString(sum[:4]), aead: aead})
+	}
+	return k, nil
+}
+
+// IsSealed returns whether value was sealed by a keyring
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// Seal returns plaintext sealed by the first key
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	key := k.keys[0]
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := key.aead.Seal(nonce, nonce, []byte(plaintext), []byte(key.id))
+	return sealedPrefix + key.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open returns the plaintext of value if it's sealed, value itself if
+// not. The keyring may be nil if it's not sealed.
+func (k *Keyring) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, sealedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("malformed sealed secret")
+	}
+	if k == nil {
+		return "", fmt.Errorf("the secret is sealed by key %s but no secrets key is configured", parts[0])
+	}
+	for _, key := range k.keys {
+		if key.id != parts[0] {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(sealed) < key.aead.NonceSize() {
+			return "", fmt.Errorf("malformed sealed secret")
+		}
+		nonceSize := key.aead.NonceSize()
+		plaintext, err := key.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(key.id))
+		if err != nil {
+			return "", fmt.Errorf("failed to open the secret sealed by key %s: %v", key.id, err)
+		}
+		return string(plaintext), nil
+	}
+	return "", fmt.Errorf("the secret is sealed by key %s, which is not a secrets key", parts[0])
+}
+
+// sealedConnectionFields are the fields of the connections of the tasks
+// that are sealed, those making up their DSN but the port
+var sealedConnectionFields = []string{"Host", "User", "Password"}
+
+// sealedCheckpoint is the field of the config of the tasks holding how far
+// the copy went, sealed as JSON as it holds rows of the source
+const sealedCheckpoint = "DumpCheckpoint"
+
+// SealJob returns job with the secrets of the configs of its tasks sealed,
+// job itself if they all are already. job is left as is.
+func (k *Keyring) SealJob(job *models.Job) (*models.Job, error) {
+	if k == nil || job == nil {
+		return job, nil
+	}
+	var sealed *models.Job
+	for i, t := range job.Tasks {
+		st, err := k.SealTask(t)
+		if err != nil {
+			return nil, err
+		}
+		if st == t {
+			continue
+		}
+		if sealed == nil {
+			sealed = job.Copy()
+		}
+		sealed.Tasks[i] = st
+	}
+	if sealed == nil {
+		return job, nil
+	}
+	return sealed, nil
+}
+
+// SealTask returns t with the secrets of its config sealed: the DSN fields
+// of its connection and the checkpoint of its copy. It returns t itself if
+// they all are already, t is left as is.
+func (k *Keyring) SealTask(t *models.Task) (*models.Task, error) {
+	if k == nil || t == nil {
+		return t, nil
+	}
+	// The maps of the config are shared with t, they are copied before
+	// being changed
+	var cfg map[string]interface{}
+	set := func(name string, v interface{}) {
+		if cfg == nil {
+			cfg = copyConfig(t.Config)
+		}
+		cfg[name] = v
+	}
+	for name, v := range t.Config {
+		switch {
+		case strings.EqualFold(name, "ConnectionConfig"):
+			connCfg, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var sealedConnCfg map[string]interface{}
+			for key, value := range connCfg {
+				plaintext, ok := value.(string)
+				if !ok || plaintext == "" || IsSealed(plaintext) || !isSealedConnectionField(key) {
+					continue
+				}
+				sealedValue, err := k.Seal(plaintext)
+				if err != nil {
+					return nil, err
+				}
+				if sealedConnCfg == nil {
+					sealedConnCfg = copyConfig(connCfg)
+				}
+				sealedConnCfg[key] = sealedValue
+			}
+			if sealedConnCfg != nil {
+				set(name, sealedConnCfg)
+			}
+		case name == sealedCheckpoint:
+			if v == nil {
+				continue
+			}
+			if value, ok := v.(string); ok && IsSealed(value) {
+				continue
+			}
+			sealedValue, err := k.SealValue(v)
+			if err != nil {
+				return nil, err
+			}
+			set(name, sealedValue)
+		}
+	}
+	if cfg == nil {
+		return t, nil
+	}
+	sealed := new(models.Task)
+	*sealed = *t
+	sealed.Config = cfg
+	sealed.ConfigLock = nil
+	return sealed, nil
+}
+
+// SealTasks returns tasks with the secrets of their configs sealed, tasks
+// itself if they all are already. tasks is left as is.
+func (k *Keyring) SealTasks(tasks []*models.Task) ([]*models.Task, error) {
+	var sealed []*models.Task
+	for i, t := range tasks {
+		st, err := k.SealTask(t)
+		if err != nil {
+			return nil, err
+		}
+		if st == t {
+			continue
+		}
+		if sealed == nil {
+			sealed = append([]*models.Task(nil), tasks...)
+		}
+		sealed[i] = st
+	}
+	if sealed == nil {
+		return tasks, nil
+	}
+	return sealed, nil
+}
+
+// SealValue returns v sealed as JSON by the first key
+func (k *Keyring) SealValue(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return k.Seal(string(data))
+}
+
+// OpenValue decodes the JSON of value into vPtr, opening it if it's
+// sealed. The keyring may be nil if it's not sealed.
+func (k *Keyring) OpenValue(value string, vPtr interface{}) error {
+	data, err := k.Open(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), vPtr)
+}
+
+// OpenTaskConfig returns the config of a task with its secrets opened, cfg
+// itself if none is sealed. cfg is left as is. The keyring may be nil if
+// none is sealed.
+func (k *Keyring) OpenTaskConfig(cfg map[string]interface{}) (map[string]interface{}, error) {
+	var opened map[string]interface{}
+	set := func(name string, v interface{}) {
+		if opened == nil {
+			opened = copyConfig(cfg)
+		}
+		opened[name] = v
+	}
+	for name, v := range cfg {
+		switch {
+		case strings.EqualFold(name, "ConnectionConfig"):
+			connCfg, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var openedConnCfg map[string]interface{}
+			for key, value := range connCfg {
+				sealed, ok := value.(string)
+				if !ok || !IsSealed(sealed) {
+					continue
+				}
+				plaintext, err := k.Open(sealed)
+				if err != nil {
+					return nil, fmt.Errorf("%s of the connection: %v", key, err)
+				}
+				if openedConnCfg == nil {
+					openedConnCfg = copyConfig(connCfg)
+				}
+				openedConnCfg[key] = plaintext
+			}
+			if openedConnCfg != nil {
+				set(name, openedConnCfg)
+			}
+		case name == sealedCheckpoint:
+			sealed, ok := v.(string)
+			if !ok || !IsSealed(sealed) {
+				continue
+			}
+			var checkpoint interface{}
+			if err := k.OpenValue(sealed, &checkpoint); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			set(name, checkpoint)
+		}
+	}
+	if opened == nil {
+		return cfg, nil
+	}
+	return opened, nil
+}
+
+func isSealedConnectionField(key string) bool {
+	for _, field := range sealedConnectionFields {
+		if strings.EqualFold(key, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyConfig(cfg map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(cfg))
+	for name, v := range cfg {
+		c[name] = v
+	}
+	return c
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestKeyring_Rotation(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+	old, err := NewKeyring([][]byte{oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := old.Seal("secret")
+	if err != nil || !IsSealed(sealed) || strings.Contains(sealed, "secret") {
+		t.Fatalf("Keyring.Seal() = %q, %v", sealed, err)
+	}
+
+	rotated, err := NewKeyring([][]byte{newKey, oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rotated.Open(sealed); err != nil || got != "secret" {
+		t.Errorf("Keyring.Open() by the old key = %q, %v", got, err)
+	}
+	resealed, _ := rotated.Seal("secret")
+	if _, err := old.Open(resealed); err == nil {
+		t.Errorf("Keyring.Open() of a secret sealed by an unknown key error = nil")
+	}
+	if got, err := rotated.Open("plain"); err != nil || got != "plain" {
+		t.Errorf("Keyring.Open() of plaintext = %q, %v", got, err)
+	}
+	var none *Keyring
+	if _, err := none.Open(sealed); err == nil {
+		t.Errorf("Keyring.Open() without keys error = nil")
+	}
+
+	if _, err := NewKeyring([][]byte{[]byte("short")}); err == nil {
+		t.Errorf("NewKeyring() of a 5 bytes key error = nil")
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys")
+
+	ioutil.WriteFile(path, []byte("# new key first\nAgICAgICAgICAgICAgICAg==\n\nAQEBAQEBAQEBAQEBAQEBAQ==\n"), 0600)
+	if k, err := LoadKeyring(path); err != nil || len(k.keys) != 2 {
+		t.Errorf("LoadKeyring() = %v, %v", k, err)
+	}
+	ioutil.WriteFile(path, []byte("not base64\n"), 0600)
+	if _, err := LoadKeyring(path); err == nil {
+		t.Errorf("LoadKeyring() of an invalid key error = nil")
+	}
+	ioutil.WriteFile(path, []byte("\n"), 0600)
+	if _, err := LoadKeyring(path); err == nil {
+		t.Errorf("LoadKeyring() without keys error = nil")
+	}
+	if _, err := LoadKeyring(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("LoadKeyring() of a missing file error = nil")
+	}
+}
+
+func TestKeyring_SealJob(t *testing.T) {
+	k, err := NewKeyring([][]byte{bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connCfg := map[string]interface{}{"Host": "127.0.0.1", "Password": "secret"}
+	job := &models.Job{ID: "job", Tasks: []*models.Task{
+		{Type: models.TaskTypeSrc, Config: map[string]interface{}{"ConnectionConfig": connCfg}},
+		{Type: models.TaskTypeDest, Config: map[string]interface{}{}},
+	}}
+
+	sealed, err := k.SealJob(job)
+	if err != nil || sealed == job {
+		t.Fatalf("Keyring.SealJob() = %v, %v", sealed, err)
+	}
+	if connCfg["Password"] != "secret" {
+		t.Errorf("Keyring.SealJob() changed the job to %v", connCfg)
+	}
+	password := sealed.Tasks[0].Config["ConnectionConfig"].(map[string]interface{})["Password"].(string)
+	if !IsSealed(password) {
+		t.Fatalf("sealed password = %q", password)
+	}
+	if again, err := k.SealJob(sealed); err != nil || again != sealed {
+		t.Errorf("Keyring.SealJob() of a sealed job = %v, %v", again, err)
+	}
+
+	opened, err := k.OpenTaskConfig(sealed.Tasks[0].Config)
+	if err != nil {
+		t.Fatalf("Keyring.OpenTaskConfig() error = %v", err)
+	}
+	if got := opened["ConnectionConfig"].(map[string]interface{})["Password"]; got != "secret" {
+		t.Errorf("Keyring.OpenTaskConfig() password = %v", got)
+	}
+}
+
+func TestKeyring_SealTask(t *testing.T) {
+	k, err := NewKeyring([][]byte{bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint := &models.DumpCheckpoint{Gtid: "uuid:1-5"}
+	task := &models.Task{Type: models.TaskTypeSrc, Config: map[string]interface{}{
+		"ConnectionConfig": map[string]interface{}{"Host": "10.0.0.1", "Port": 3306, "User": "repl", "Password": "secret"},
+		"DumpCheckpoint":   checkpoint,
+		"Gtid":             "uuid:1-10",
+	}}
+	tasks, err := k.SealTasks([]*models.Task{task})
+	if err != nil || len(tasks) != 1 || tasks[0] == task {
+		t.Fatalf("Keyring.SealTasks() = %v, %v", tasks, err)
+	}
+	sealed := tasks[0].Config
+	connCfg := sealed["ConnectionConfig"].(map[string]interface{})
+	for _, key := range []string{"Host", "User", "Password"} {
+		if v, ok := connCfg[key].(string); !ok || !IsSealed(v) {
+			t.Errorf("sealed %s = %v", key, connCfg[key])
+		}
+	}
+	if connCfg["Port"] != 3306 || sealed["Gtid"] != "uuid:1-10" {
+		t.Errorf("Keyring.SealTask() sealed the other fields: %v", sealed)
+	}
+	if v, ok := sealed["DumpCheckpoint"].(string); !ok || !IsSealed(v) {
+		t.Errorf("sealed DumpCheckpoint = %v", sealed["DumpCheckpoint"])
+	}
+	if task.Config["DumpCheckpoint"] != checkpoint {
+		t.Errorf("Keyring.SealTask() changed the task to %v", task.Config)
+	}
+
+	opened, err := k.OpenTaskConfig(sealed)
+	if err != nil {
+		t.Fatalf("Keyring.OpenTaskConfig() error = %v", err)
+	}
+	connCfg = opened["ConnectionConfig"].(map[string]interface{})
+	if connCfg["Host"] != "10.0.0.1" || connCfg["User"] != "repl" || connCfg["Password"] != "secret" {
+		t.Errorf("Keyring.OpenTaskConfig() connection = %v", connCfg)
+	}
+	got, ok := opened["DumpCheckpoint"].(map[string]interface{})
+	if !ok || got["Gtid"] != "uuid:1-5" {
+		t.Errorf("Keyring.OpenTaskConfig() DumpCheckpoint = %v", opened["DumpCheckpoint"])
+	}
+
+	// A plaintext config is returned as is, even without a keyring
+	var none *Keyring
+	if plain, err := none.OpenTaskConfig(task.Config); err != nil || plain["DumpCheckpoint"] != checkpoint {
+		t.Errorf("Keyring.OpenTaskConfig() of a plaintext config = %v, %v", plain, err)
+	}
+}
@@ -7,7 +7,14 @@
 package mysql
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+
+	gomysql "github.com/go-sql-driver/mysql"
 )
 
 // ConnectionConfig is the minimal configuration required to connect to a MySQL server
@@ -17,19 +24,97 @@ type ConnectionConfig struct {
 	User     string
 	Password string
 	Charset  string
+
+	// TLS encrypts the connections, verifying the server with the CAs of
+	// the system unless TLSCA is set. Setting any other TLS parameter
+	// enables it too.
+	TLS bool
+	// TLSCA is the PEM file of the CA certificates verifying the server
+	TLSCA string
+	// TLSCert and TLSKey are the PEM files of the client certificate and
+	// its key, for servers requiring X509
+	TLSCert string
+	TLSKey  string
+	// TLSServerName is the name the server certificate must be for, Host
+	// if empty
+	TLSServerName string
+	// TLSSkipVerify encrypts without verifying the server certificate
+	TLSSkipVerify bool
+}
+
+// UsesTLS tells whether the connections are encrypted
+func (c *ConnectionConfig) UsesTLS() bool {
+	return c.TLS || c.TLSCA != "" || c.TLSCert != "" || c.TLSKey != "" || c.TLSServerName != "" || c.TLSSkipVerify
+}
+
+// TLSConfig loads the TLS parameters. It returns nil if the connections
+// aren't encrypted.
+func (c *ConnectionConfig) TLSConfig() (*tls.Config, error) {
+	if !c.UsesTLS() {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSSkipVerify,
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = c.Host
+	}
+	if c.TLSCA != "" {
+		pem, err := ioutil.ReadFile(c.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("TLS to %s:%d: failed to read TLSCA: %v", c.Host, c.Port, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS to %s:%d: TLSCA %s holds no PEM certificate", c.Host, c.Port, c.TLSCA)
+		}
+	}
+	if c.TLSCert != "" || c.TLSKey != "" {
+		if c.TLSCert == "" || c.TLSKey == "" {
+			return nil, fmt.Errorf("TLS to %s:%d: TLSCert and TLSKey must be set together", c.Host, c.Port)
+		}
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("TLS to %s:%d: failed to load TLSCert %s and TLSKey %s: %v", c.Host, c.Port, c.TLSCert, c.TLSKey, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// RegisterTLSConfig loads the TLS parameters for the DB URIs to use. The
+// URIs of encrypted connections fail to connect until it is called.
+func (c *ConnectionConfig) RegisterTLSConfig() error {
+	tlsConfig, err := c.TLSConfig()
+	if err != nil || tlsConfig == nil {
+		return err
+	}
+	return gomysql.RegisterTLSConfig(c.tlsParam(), tlsConfig)
+}
+
+// tlsParam is the tls parameter of the DB URIs, false or the name of the
+// TLS config registered for the parameters
+func (c *ConnectionConfig) tlsParam() string {
+	if !c.UsesTLS() {
+		return "false"
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%v",
+		c.Host, c.TLSCA, c.TLSCert, c.TLSKey, c.TLSServerName, c.TLSSkipVerify)))
+	return "dtle-" + hex.EncodeToString(sum[:8])
 }
 
 func (c *ConnectionConfig) GetDBUriByDbName(databaseName string) string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%v&maxAllowedPacket=0", c.User, c.Password, c.Host, c.Port, databaseName, c.Charset)
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?tls=%s&charset=%v&maxAllowedPacket=0", c.User, c.Password, c.Host, c.Port, databaseName, c.tlsParam(), c.Charset)
 }
 
 func (c *ConnectionConfig) GetDBUri() string {
 	if "" == c.Charset {
 		c.Charset = "utf8mb4"
 	}
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&tls=false&autocommit=true&charset=%v&multiStatements=true&maxAllowedPacket=0", c.User, c.Password, c.Host, c.Port, c.Charset)
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&tls=%s&autocommit=true&charset=%v&multiStatements=true&maxAllowedPacket=0", c.User, c.Password, c.Host, c.Port, c.tlsParam(), c.Charset)
 }
 
 func (c *ConnectionConfig) GetSingletonDBUri() string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&tls=false&autocommit=false&charset=%v&multiStatements=true&maxAllowedPacket=0", c.User, c.Password, c.Host, c.Port, c.Charset)
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=5s&tls=%s&autocommit=false&charset=%v&multiStatements=true&maxAllowedPacket=0", c.User, c.Password, c.Host, c.Port, c.tlsParam(), c.Charset)
 }
@@ -7,47 +7,96 @@
 package mysql
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
-
-	test "github.com/outbrain/golib/tests"
+	"time"
 )
 
-func TestNewConnectionConfig(t *testing.T) {
-	c := NewConnectionConfig()
-	test.S(t).ExpectEquals(c.Key.Hostname, "")
-	test.S(t).ExpectEquals(c.Key.Port, 0)
-	test.S(t).ExpectEquals(c.ImpliedKey.Hostname, "")
-	test.S(t).ExpectEquals(c.ImpliedKey.Port, 0)
-	test.S(t).ExpectEquals(c.User, "")
-	test.S(t).ExpectEquals(c.Password, "")
-}
-
-func TestDuplicateCredentials(t *testing.T) {
-	c := NewConnectionConfig()
-	c.Key = InstanceKey{Hostname: "myhost", Port: 3306}
-	c.User = "gromit"
-	c.Password = "penguin"
-
-	dup := c.DuplicateCredentials(InstanceKey{Hostname: "otherhost", Port: 3310})
-	test.S(t).ExpectEquals(dup.Key.Hostname, "otherhost")
-	test.S(t).ExpectEquals(dup.Key.Port, 3310)
-	test.S(t).ExpectEquals(dup.ImpliedKey.Hostname, "otherhost")
-	test.S(t).ExpectEquals(dup.ImpliedKey.Port, 3310)
-	test.S(t).ExpectEquals(dup.User, "gromit")
-	test.S(t).ExpectEquals(dup.Password, "penguin")
+// writeTestCert writes a self-signed certificate and its key to dir
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "mysql"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
 }
 
-func TestDuplicate(t *testing.T) {
-	c := NewConnectionConfig()
-	c.Key = InstanceKey{Hostname: "myhost", Port: 3306}
-	c.User = "gromit"
-	c.Password = "penguin"
+func TestConnectionConfig_TLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtle-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir)
 
-	dup := c.Duplicate()
-	test.S(t).ExpectEquals(dup.Key.Hostname, "myhost")
-	test.S(t).ExpectEquals(dup.Key.Port, 3306)
-	test.S(t).ExpectEquals(dup.ImpliedKey.Hostname, "myhost")
-	test.S(t).ExpectEquals(dup.ImpliedKey.Port, 3306)
-	test.S(t).ExpectEquals(dup.User, "gromit")
-	test.S(t).ExpectEquals(dup.Password, "penguin")
+	tests := []struct {
+		name    string
+		config  ConnectionConfig
+		wantTLS bool
+		wantErr bool
+	}{
+		{"plaintext", ConnectionConfig{Host: "db1"}, false, false},
+		{"system CAs", ConnectionConfig{Host: "db1", TLS: true}, true, false},
+		{"CA and client certificate", ConnectionConfig{Host: "db1", TLSCA: certFile, TLSCert: certFile, TLSKey: keyFile}, true, false},
+		{"skip verify", ConnectionConfig{Host: "db1", TLSSkipVerify: true}, true, false},
+		{"missing CA", ConnectionConfig{Host: "db1", TLSCA: filepath.Join(dir, "none.pem")}, false, true},
+		{"CA without certificate", ConnectionConfig{Host: "db1", TLSCA: keyFile}, false, true},
+		{"certificate without key", ConnectionConfig{Host: "db1", TLSCert: certFile}, false, true},
+		{"key not matching", ConnectionConfig{Host: "db1", TLSCert: keyFile, TLSKey: keyFile}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.TLSConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConnectionConfig.TLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got != nil) != tt.wantTLS {
+				t.Fatalf("ConnectionConfig.TLSConfig() = %v, want TLS %v", got, tt.wantTLS)
+			}
+			if got != nil && got.ServerName != "db1" {
+				t.Errorf("ConnectionConfig.TLSConfig().ServerName = %q, want db1", got.ServerName)
+			}
+			if err := tt.config.RegisterTLSConfig(); (err != nil) != tt.wantErr {
+				t.Errorf("ConnectionConfig.RegisterTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// Parameters failing to load never fall back to plaintext
+			wantPlaintext := !tt.wantTLS && !tt.wantErr
+			if uri := tt.config.GetDBUri(); strings.Contains(uri, "tls=false") != wantPlaintext {
+				t.Errorf("ConnectionConfig.GetDBUri() = %q, want plaintext %v", uri, wantPlaintext)
+			}
+		})
+	}
 }
@@ -7,9 +7,14 @@
 package mysql
 
 import (
+	"strings"
+
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
 	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
 )
 
 type charsetEncoding map[string]encoding.Encoding
@@ -22,4 +27,40 @@ func init() {
 	charsetEncodingMap["latin1"] = charmap.Windows1252
 	charsetEncodingMap["gbk"] = simplifiedchinese.GBK
 	charsetEncodingMap["gb2312"] = simplifiedchinese.GB18030
+	charsetEncodingMap["gb18030"] = simplifiedchinese.GB18030
+	charsetEncodingMap["big5"] = traditionalchinese.Big5
+	charsetEncodingMap["sjis"] = japanese.ShiftJIS
+	charsetEncodingMap["cp932"] = japanese.ShiftJIS
+	charsetEncodingMap["ujis"] = japanese.EUCJP
+	charsetEncodingMap["eucjpms"] = japanese.EUCJP
+	charsetEncodingMap["euckr"] = korean.EUCKR
+	charsetEncodingMap["latin2"] = charmap.ISO8859_2
+	charsetEncodingMap["greek"] = charmap.ISO8859_7
+	charsetEncodingMap["hebrew"] = charmap.ISO8859_8
+	charsetEncodingMap["cp1250"] = charmap.Windows1250
+	charsetEncodingMap["cp1251"] = charmap.Windows1251
+	charsetEncodingMap["cp1256"] = charmap.Windows1256
+	charsetEncodingMap["cp1257"] = charmap.Windows1257
+	charsetEncodingMap["cp866"] = charmap.CodePage866
+	charsetEncodingMap["koi8r"] = charmap.KOI8R
+	charsetEncodingMap["koi8u"] = charmap.KOI8U
+}
+
+// utf8Charsets are the charsets whose text is valid UTF-8
+var utf8Charsets = map[string]bool{
+	"utf8":    true,
+	"utf8mb3": true,
+	"utf8mb4": true,
+	"ascii":   true,
+}
+
+// IsUTF8Charset returns whether the text of the MySQL charset is UTF-8
+func IsUTF8Charset(charset string) bool {
+	return utf8Charsets[strings.ToLower(charset)]
+}
+
+// CharsetEncoding returns the encoding of the text of the MySQL charset,
+// nil if it is not known or is UTF-8
+func CharsetEncoding(charset string) encoding.Encoding {
+	return charsetEncodingMap[strings.ToLower(charset)]
 }
@@ -67,6 +67,9 @@ type Column struct {
 	Nullable           bool
 	Precision          int // for decimal, time or datetime
 	Scale              int // for decimal
+	// HasDefault is set if inserts may leave the column out: it has a
+	// default, or it is auto_increment or generated
+	HasDefault bool
 	// somehow ugly. A better solution might be MetaInfo with subtypes
 }
 
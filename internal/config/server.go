@@ -17,6 +17,7 @@ import (
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
 
+	"github.com/actiontech/dtle/internal/models"
 	"github.com/actiontech/dtle/internal/server/scheduler"
 )
 
@@ -60,9 +61,64 @@ type ServerConfig struct {
 	// reachable
 	RPCAdvertise *net.TCPAddr
 
+	// RPCExtraAddrs are additional addresses the RPC server listens on,
+	// for instance to serve a separate management network. Only RPCAddr
+	// is advertised.
+	RPCExtraAddrs []*net.TCPAddr
+
+	// RPCAllowedMethods and RPCDeniedMethods map RPC listener addresses,
+	// as "ip:port", to the methods that may or may not be called on them.
+	// A method is a name like "Status.Ping", "Status.*" or "*". Listeners
+	// with an allow-list only serve the methods on it, and listeners with
+	// either list never serve Raft.
+	RPCAllowedMethods map[string][]string
+	RPCDeniedMethods  map[string][]string
+
+	// RPCIdleTimeout closes RPC connections and multiplexed streams that
+	// didn't send a request for that long. Zero keeps them open.
+	RPCIdleTimeout time.Duration
+
+	// RPCPingInterval is how often the connections pooled to other servers
+	// are pinged, and RPCMaxMissedPings how many pings in a row they may
+	// miss before they are closed as dead.
+	RPCPingInterval   time.Duration
+	RPCMaxMissedPings int
+
+	// RPCCircuitFailureThreshold failures to another server within
+	// RPCCircuitFailureWindow open its circuit, refusing the RPCs to it for
+	// RPCCircuitCooldown before one probes whether it is back.
+	RPCCircuitFailureThreshold int
+	RPCCircuitFailureWindow    time.Duration
+	RPCCircuitCooldown         time.Duration
+
 	// RaftConfig is the configuration used for Raft in the local DC
 	RaftConfig *raft.Config
 
+	// LeaderHealthInterval is how often the leader checks it can still make
+	// progress, stepping down in favor of another voter once it can't.
+	// Zero, the default, disables the checks.
+	LeaderHealthInterval time.Duration
+
+	// LeaderMaxApplyFailures is the number of Raft applies that may fail in
+	// a row before the leader steps down. Zero disables the check.
+	LeaderMaxApplyFailures int
+
+	// LeaderMinFreeDisk is the free space in bytes the leader needs on the
+	// file system of its Raft data to keep the leadership. Zero disables
+	// the check.
+	LeaderMinFreeDisk uint64
+
+	// OrphanReconcileInterval is how often the leader looks for the
+	// pending or running jobs no worker runs, to reschedule them, or mark
+	// them failed if they are still orphaned the next time. Zero disables
+	// the reconciliation.
+	OrphanReconcileInterval time.Duration
+
+	// WarmStandbyInterval is how often followers pull the digest of the
+	// connections the leader has pooled to other servers, which they open
+	// when they win an election. Zero disables it.
+	WarmStandbyInterval time.Duration
+
 	// RaftTimeout is applied to any network traffic for raft. Defaults to 10s.
 	RaftTimeout time.Duration
 
@@ -138,6 +194,119 @@ type ServerConfig struct {
 	// This period is meant to be long enough for a leader election to take
 	// place, and a small jitter is applied to avoid a thundering herd.
 	RPCHoldTimeout time.Duration
+
+	// LeaderTransferMaxLag is how many Raft entries a voter may be behind
+	// the leader to be handed the leadership by Operator.LeadershipTransfer.
+	LeaderTransferMaxLag uint64
+
+	// LeaderTransferTimeout is how long a leadership transfer waits for the
+	// voter to catch up with the leader, and then for a new leader to be
+	// elected.
+	LeaderTransferTimeout time.Duration
+
+	// TLSConfig holds various TLS related configurations
+	TLSConfig *TLSConfig
+
+	// RPCCompression enables compression of RPCs forwarded to servers in
+	// other regions, provided the remote server supports it.
+	RPCCompression bool
+
+	// RPCCompressionThreshold is the minimum payload size in bytes that is
+	// compressed. Smaller payloads are sent uncompressed.
+	RPCCompressionThreshold int
+
+	// RPCMaxStreamWindow is the maximum flow control window in bytes of
+	// every multiplexed RPC stream, zero for the yamux default of 256KB.
+	// Larger windows speed up large transfers such as snapshots over links
+	// with a high bandwidth-delay product, but a slow reader can make a
+	// stream buffer up to its whole window, so the memory held by a
+	// connection grows with the window times the number of its streams.
+	// Servers forwarding to each other should use the same value.
+	RPCMaxStreamWindow int
+
+	// RPCMaxConns is the maximum number of concurrent RPC connections the
+	// server accepts. Zero means unlimited.
+	RPCMaxConns int
+
+	// RPCMaxConnsPerIP is the maximum number of concurrent RPC connections
+	// accepted from a single source IP. Zero means unlimited.
+	RPCMaxConnsPerIP int
+
+	// RPCDrainTimeout is how long shutdown waits for in-flight RPCs to
+	// complete before closing their connections.
+	RPCDrainTimeout time.Duration
+
+	// MaxRaftEntrySize is the size in bytes above which a command is
+	// refused instead of being applied through Raft. Zero disables the
+	// limit.
+	MaxRaftEntrySize int
+
+	// RPCWeight is advertised to the servers of other regions, which favor
+	// servers with a higher weight when forwarding RPCs. Zero advertises
+	// no weight.
+	RPCWeight int
+
+	// NonVoter makes the server join Raft as a non-voter: it replicates
+	// the state and serves stale reads but never takes part in elections.
+	NonVoter bool
+
+	// RPCRateLimits maps RPC method names to the rate they are limited to.
+	// The "*" entry applies to the methods without an entry of their own.
+	// The limits can be changed at runtime with Server.Reload.
+	RPCRateLimits map[string]RateLimit
+
+	// RPCRateLimitPerClient applies RPCRateLimits to every client IP
+	// separately instead of to all the callers of a method together.
+	RPCRateLimitPerClient bool
+
+	// RPCRegionTimeouts maps region names to how long an RPC forwarded to
+	// them may take, on top of the time a blocking query waits. Regions
+	// without an entry use RPCHoldTimeout. The timeouts can be changed at
+	// runtime with Server.Reload.
+	RPCRegionTimeouts map[string]time.Duration
+
+	// RPCFrameChecksums checks the RPCs forwarded to other regions against
+	// a CRC32 of every frame, with the servers that support it.
+	RPCFrameChecksums bool
+
+	// RPCOverloadThreshold is the number of RPCs in flight above which the
+	// server asks clients to back off through QueryMeta.RetryAfter. Zero
+	// disables the hint.
+	RPCOverloadThreshold int
+
+	// MaxBlockingQueries is the number of blocking queries the server
+	// serves at once. Past it blocking queries are answered right away and
+	// flagged with QueryMeta.BlockingLimited. Zero means no limit.
+	MaxBlockingQueries int
+
+	// JobEventsRetention is the number of task events kept for each job,
+	// the oldest being dropped first. The leader's applies to all the
+	// servers.
+	JobEventsRetention int
+
+	// RPCMaxConcurrent is the number of RPCs the server serves at once,
+	// not counting blocking queries. Up to RPCDispatchQueue more wait,
+	// the higher priorities being served and kept first, and the others
+	// fail with models.ErrServerOverloaded. Zero means no limit.
+	RPCMaxConcurrent int
+	RPCDispatchQueue int
+
+	// Webhooks are the URLs the server POSTs a models.Notification to, as
+	// JSON, when it acquires or loses the leadership and, as the leader,
+	// when a job changes status. Delivery is best effort.
+	Webhooks []string
+
+	// SecretsKeyring seals the passwords of the jobs before they are
+	// applied through Raft, so that neither the state nor its snapshots
+	// hold them in plaintext. Nil leaves them as they are.
+	SecretsKeyring *Keyring
+}
+
+// RateLimit is a token bucket: Rate requests per second are allowed on
+// average, with bursts of up to Burst requests.
+type RateLimit struct {
+	Rate  float64
+	Burst int
 }
 
 // DefaultConfig returns the default configuration
@@ -148,24 +317,41 @@ func DefaultServerConfig() *ServerConfig {
 	}
 
 	c := &ServerConfig{
-		Region:                 DefaultRegion,
-		Datacenter:             DefaultDC,
-		NodeName:               hostname,
-		RaftConfig:             raft.DefaultConfig(),
-		RaftTimeout:            10 * time.Second,
-		LogOutput:              os.Stderr,
-		RPCAddr:                DefaultRPCAddr,
-		SerfConfig:             serf.DefaultConfig(),
-		NumSchedulers:          1,
-		ReconcileInterval:      60 * time.Second,
-		EvalNackTimeout:        60 * time.Second,
-		EvalDeliveryLimit:      3,
-		MinHeartbeatTTL:        10 * time.Second,
-		MaxHeartbeatsPerSecond: 50.0,
-		HeartbeatGrace:         10 * time.Second,
-		FailoverHeartbeatTTL:   300 * time.Second,
-		ConsulConfig:           DefaultConsulConfig(),
-		RPCHoldTimeout:         5 * time.Second,
+		Region:                  DefaultRegion,
+		Datacenter:              DefaultDC,
+		NodeName:                hostname,
+		RaftConfig:              raft.DefaultConfig(),
+		RaftTimeout:             10 * time.Second,
+		LogOutput:               os.Stderr,
+		RPCAddr:                 DefaultRPCAddr,
+		SerfConfig:              serf.DefaultConfig(),
+		NumSchedulers:           1,
+		ReconcileInterval:       60 * time.Second,
+		EvalNackTimeout:         60 * time.Second,
+		EvalDeliveryLimit:       3,
+		MinHeartbeatTTL:         10 * time.Second,
+		MaxHeartbeatsPerSecond:  50.0,
+		HeartbeatGrace:          10 * time.Second,
+		FailoverHeartbeatTTL:    300 * time.Second,
+		ConsulConfig:            DefaultConsulConfig(),
+		RPCHoldTimeout:          5 * time.Second,
+		LeaderTransferMaxLag:    256,
+		LeaderTransferTimeout:   10 * time.Second,
+		TLSConfig:               &TLSConfig{},
+		RPCCompressionThreshold: 1024,
+		MaxRaftEntrySize:        8 * 1024 * 1024,
+		RPCDrainTimeout:         5 * time.Second,
+		RPCOverloadThreshold:    512,
+		RPCPingInterval:         10 * time.Second,
+		RPCMaxMissedPings:       3,
+		LeaderMaxApplyFailures:  10,
+		LeaderMinFreeDisk:       64 * 1024 * 1024,
+		WarmStandbyInterval:     30 * time.Second,
+		OrphanReconcileInterval: time.Minute,
+		MaxBlockingQueries:      4096,
+		JobEventsRetention:      models.DefaultJobEventsRetention,
+		RPCMaxConcurrent:        512,
+		RPCDispatchQueue:        2048,
 	}
 
 	// Enable all known schedulers by default
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/config/mysql"
+)
+
+func TestTable_ReplicatedColumns(t *testing.T) {
+	columns := mysql.NewColumnList([]mysql.Column{
+		{Name: "id", Key: "PRI"},
+		{Name: "name", Nullable: true},
+		{Name: "ssn", Nullable: true},
+		{Name: "created", HasDefault: true},
+		{Name: "email"},
+	})
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+		wantErr bool
+	}{
+		{"no filter", nil, nil, []string{"id", "name", "ssn", "created", "email"}, false},
+		{"exclude", nil, []string{"SSN", "created"}, []string{"id", "name", "email"}, false},
+		{"include", []string{"id", "email"}, nil, []string{"id", "email"}, false},
+		{"include and exclude", []string{"id", "name", "email"}, []string{"name"}, []string{"id", "email"}, false},
+		{"primary key", nil, []string{"id"}, nil, true},
+		{"not null without default", nil, []string{"email"}, nil, true},
+		{"unknown column", nil, []string{"phone"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewTable("a", "a")
+			table.IncludeColumns = tt.include
+			table.ExcludeColumns = tt.exclude
+			got, err := table.ReplicatedColumns(columns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Table.ReplicatedColumns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(got.Names()) != len(tt.want) {
+				t.Fatalf("Table.ReplicatedColumns() = %v, want %v", got.Names(), tt.want)
+			}
+			for i, name := range tt.want {
+				if got.Columns[i].Name != name || got.Ordinals[name] != columns.Ordinals[name] {
+					t.Errorf("Table.ReplicatedColumns() = %v with ordinals %v, want %v", got.Names(), got.Ordinals, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTableRouting(t *testing.T) {
+	byValue := &TableRouting{
+		Column:  "region",
+		Values:  map[string]string{"eu": "orders_eu", "us": "orders_us", "ca": "orders_us"},
+		Default: "orders_other",
+	}
+	byHash := &TableRouting{Column: "id", Method: RoutingByHash, Tables: []string{"t_0", "t_1", "t_2"}}
+
+	for _, r := range []*TableRouting{byValue, byHash} {
+		if err := r.Validate(); err != nil {
+			t.Errorf("TableRouting.Validate() = %v", err)
+		}
+	}
+	for _, r := range []*TableRouting{
+		{Values: map[string]string{"eu": "orders_eu"}},
+		{Column: "region"},
+		{Column: "id", Method: RoutingByHash},
+		{Column: "id", Method: "range", Tables: []string{"t_0"}},
+		{Column: "region", Values: map[string]string{"eu": ""}},
+	} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("TableRouting.Validate() of %+v = nil, want an error", r)
+		}
+	}
+
+	if got, want := byValue.TargetTables(), []string{"orders_eu", "orders_other", "orders_us"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TableRouting.TargetTables() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"bytes", []byte("eu"), "orders_eu"},
+		{"string", "ca", "orders_us"},
+		{"unknown", []byte("jp"), "orders_other"},
+		{"null", nil, "orders_other"},
+	}
+	for _, tt := range tests {
+		if got, err := byValue.Route(tt.value); err != nil || got != tt.want {
+			t.Errorf("%s: TableRouting.Route() = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+	byValue.Default = ""
+	if _, err := byValue.Route([]byte("jp")); err == nil {
+		t.Errorf("TableRouting.Route() of an unknown value without Default = nil error")
+	}
+
+	// Hashing depends on the value only, not on its type
+	got, err := byHash.Route([]byte("42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := byHash.Route(int64(42)); again != got {
+		t.Errorf("TableRouting.Route() = %v for []byte, %v for int64", got, again)
+	}
+}
+
+func TestColumnConversion_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		conversion ColumnConversion
+		wantErr    bool
+	}{
+		{"decimal", ColumnConversion{Column: "amount", To: ConvertToDecimal}, false},
+		{"truncate", ColumnConversion{Column: "note", To: ConvertToString, OnLoss: OnLossTruncate}, false},
+		{"no column", ColumnConversion{To: ConvertToInteger}, true},
+		{"unknown conversion", ColumnConversion{Column: "amount", To: "money"}, true},
+		{"unknown on loss", ColumnConversion{Column: "amount", To: ConvertToDouble, OnLoss: "round"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.conversion.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ColumnConversion.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	table := NewTable("a", "a")
+	table.ColumnConversions = []*ColumnConversion{{Column: "Amount", To: ConvertToDecimal}}
+	if c := table.ColumnConversion("amount"); c == nil || c.To != ConvertToDecimal {
+		t.Errorf("Table.ColumnConversion() = %v, want the conversion of Amount", c)
+	}
+	if c := table.ColumnConversion("id"); c != nil {
+		t.Errorf("Table.ColumnConversion() of a column without conversion = %v, want nil", c)
+	}
+}
+
+func TestTable_ValidateOperations(t *testing.T) {
+	tests := []struct {
+		name         string
+		operations   []string
+		wantWarnings int
+		wantErr      bool
+	}{
+		{"all", nil, 0, false},
+		{"all listed", []string{"insert", "UPDATE", "delete"}, 0, false},
+		{"inserts only", []string{"insert"}, 2, false},
+		{"no updates", []string{"insert", "delete"}, 1, false},
+		{"no inserts", []string{"update", "delete"}, 1, false},
+		{"unknown", []string{"insert", "truncate"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewTable("a", "a")
+			table.Operations = tt.operations
+			warnings, err := table.ValidateOperations()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Table.ValidateOperations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("Table.ValidateOperations() warnings = %q, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+
+	table := NewTable("a", "a")
+	table.Operations = []string{"Insert"}
+	if !table.ReplicatesOperation(OperationInsert) || table.ReplicatesOperation(OperationDelete) {
+		t.Errorf("Table.ReplicatesOperation() doesn't follow Operations %v", table.Operations)
+	}
+}
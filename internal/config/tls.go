@@ -0,0 +1,230 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/actiontech/dtle/internal"
+)
+
+// TLSHandshakeTimeout bounds how long we wait for a peer to complete the
+// TLS handshake before the connection is dropped.
+const TLSHandshakeTimeout = 10 * time.Second
+
+// TLSWrapper is used to turn a raw outgoing connection to a server of
+// region into a TLS connection. The handshake is performed before the
+// wrapper returns.
+type TLSWrapper func(region string, conn net.Conn) (net.Conn, error)
+
+// TLSConfig provides TLS related configuration for the RPC layer
+type TLSConfig struct {
+	// EnableRPC enables mutual TLS on the RPC listener and on the
+	// connections we make to other servers.
+	EnableRPC *bool `mapstructure:"rpc"`
+
+	// VerifyServerHostname is used to enable hostname verification of
+	// servers. When disabled only the certificate chain is verified.
+	VerifyServerHostname *bool `mapstructure:"verify_server_hostname"`
+
+	// ServerName is the name the certificates of servers are verified
+	// against, server.<region>.dtle if empty.
+	ServerName string `mapstructure:"server_name"`
+
+	// CAFile is a path to a certificate authority file. This is used to
+	// verify the certificates presented by both ends of the connection.
+	CAFile string `mapstructure:"ca_file"`
+
+	// CertFile is used to provide a TLS certificate that is used for
+	// serving TLS connections. Must be provided to serve TLS connections.
+	CertFile string `mapstructure:"cert_file"`
+
+	// KeyFile is used to provide a TLS key that is used for serving TLS
+	// connections. Must be provided to serve TLS connections.
+	KeyFile string `mapstructure:"key_file"`
+}
+
+// Copy returns a copy of the TLS configuration
+func (t *TLSConfig) Copy() *TLSConfig {
+	if t == nil {
+		return nil
+	}
+	nt := new(TLSConfig)
+	*nt = *t
+
+	// Copy the bools
+	if nt.EnableRPC != nil {
+		nt.EnableRPC = internal.BoolToPtr(*nt.EnableRPC)
+	}
+	if nt.VerifyServerHostname != nil {
+		nt.VerifyServerHostname = internal.BoolToPtr(*nt.VerifyServerHostname)
+	}
+	return nt
+}
+
+// Merge is used to merge two TLS configs together. The booleans of b
+// override those of t when they are set, even to false.
+func (t *TLSConfig) Merge(b *TLSConfig) *TLSConfig {
+	result := t.Copy()
+
+	if b.EnableRPC != nil {
+		result.EnableRPC = internal.BoolToPtr(*b.EnableRPC)
+	}
+	if b.VerifyServerHostname != nil {
+		result.VerifyServerHostname = internal.BoolToPtr(*b.VerifyServerHostname)
+	}
+	if b.ServerName != "" {
+		result.ServerName = b.ServerName
+	}
+	if b.CAFile != "" {
+		result.CAFile = b.CAFile
+	}
+	if b.CertFile != "" {
+		result.CertFile = b.CertFile
+	}
+	if b.KeyFile != "" {
+		result.KeyFile = b.KeyFile
+	}
+	return result
+}
+
+// loadKeyPair is used to load the certificate and key pair
+func (t *TLSConfig) loadKeyPair() (*tls.Certificate, error) {
+	if t.CertFile == "" || t.KeyFile == "" {
+		return nil, fmt.Errorf("cert_file and key_file must be provided when TLS is enabled")
+	}
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load cert/key pair: %v", err)
+	}
+	return &cert, nil
+}
+
+// loadCAPool is used to build the certificate pool from the CA file
+func (t *TLSConfig) loadCAPool() (*x509.CertPool, error) {
+	if t.CAFile == "" {
+		return nil, fmt.Errorf("ca_file must be provided when TLS is enabled")
+	}
+	data, err := ioutil.ReadFile(t.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("Failed to parse any CA certificates")
+	}
+	return pool, nil
+}
+
+// IncomingTLSConfig generates a TLS configuration for incoming RPC
+// connections. Peers must present a certificate signed by our CA.
+func (t *TLSConfig) IncomingTLSConfig() (*tls.Config, error) {
+	cert, err := t.loadKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	pool, err := t.loadCAPool()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// OutgoingTLSConfig generates a TLS configuration for outgoing RPC
+// connections. Our certificate is always presented to the peer.
+func (t *TLSConfig) OutgoingTLSConfig() (*tls.Config, error) {
+	cert, err := t.loadKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	pool, err := t.loadCAPool()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		RootCAs:      pool,
+		// Hostname verification is handled in the wrapper so that the
+		// chain is still checked when VerifyServerHostname is disabled.
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+	}, nil
+}
+
+// OutgoingTLSWrapper returns a TLSWrapper based on the OutgoingTLS
+// configuration. If TLS is not enabled, a nil wrapper is returned.
+func (t *TLSConfig) OutgoingTLSWrapper() (TLSWrapper, error) {
+	if t == nil || t.EnableRPC == nil || !*t.EnableRPC {
+		return nil, nil
+	}
+	tlsConf, err := t.OutgoingTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	wrapper := func(region string, conn net.Conn) (net.Conn, error) {
+		conf := tlsConf.Clone()
+		if t.VerifyServerHostname != nil && *t.VerifyServerHostname {
+			conf.ServerName = t.serverName(region)
+		}
+
+		tlsConn := tls.Client(conn, conf)
+		tlsConn.SetDeadline(time.Now().Add(TLSHandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			tlsConn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %v", err)
+		}
+		tlsConn.SetDeadline(time.Time{})
+
+		if err := verifyPeerChain(tlsConn, conf); err != nil {
+			tlsConn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return wrapper, nil
+}
+
+// serverName returns the name of the servers of region their certificates
+// are issued for
+func (t *TLSConfig) serverName(region string) string {
+	if t.ServerName != "" {
+		return t.ServerName
+	}
+	return fmt.Sprintf("server.%s.dtle", region)
+}
+
+// verifyPeerChain checks the certificate chain presented by the server
+// against our CA, optionally verifying the hostname as well.
+func verifyPeerChain(conn *tls.Conn, conf *tls.Config) error {
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return fmt.Errorf("TLS peer presented no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         conf.RootCAs,
+		DNSName:       conf.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return fmt.Errorf("TLS peer certificate is not trusted: %v", err)
+	}
+	return nil
+}
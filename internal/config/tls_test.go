@@ -0,0 +1,273 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal"
+)
+
+// testCA is a certificate authority issuing the certificates of a test
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a server and client
+// certificate signed by the CA, valid for the server names
+func (ca *testCA) issue(t *testing.T, serial int64, names ...string) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "server.global.udup"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     names,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// tlsConfig writes the files of a TLS configuration trusting ca and
+// presenting the certificate of certPEM and keyPEM
+func (ca *testCA) tlsConfig(t *testing.T, dir, name string, certPEM, keyPEM []byte, verifyHostname bool) *TLSConfig {
+	conf := &TLSConfig{
+		EnableRPC:            internal.BoolToPtr(true),
+		VerifyServerHostname: internal.BoolToPtr(verifyHostname),
+		CAFile:               filepath.Join(dir, name+"-ca.pem"),
+		CertFile:             filepath.Join(dir, name+".pem"),
+		KeyFile:              filepath.Join(dir, name+"-key.pem"),
+	}
+	for path, data := range map[string][]byte{conf.CAFile: ca.pem, conf.CertFile: certPEM, conf.KeyFile: keyPEM} {
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conf
+}
+
+// serveTLS accepts a single connection on a listener of conf, and echoes
+// its first byte once the handshake is done. The error of the handshake is
+// sent on the returned channel.
+func serveTLS(t *testing.T, conf *TLSConfig) (net.Addr, <-chan error) {
+	incoming, err := conf.IncomingTLSConfig()
+	if err != nil {
+		t.Fatalf("IncomingTLSConfig() error = %v", err)
+	}
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		defer list.Close()
+		conn, err := tls.NewListener(list, incoming).Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.(*tls.Conn).Handshake(); err != nil {
+			errCh <- err
+			return
+		}
+		buf := make([]byte, 1)
+		if _, err := conn.Read(buf); err != nil {
+			errCh <- err
+			return
+		}
+		_, err = conn.Write(buf)
+		errCh <- err
+	}()
+	return list.Addr(), errCh
+}
+
+func TestTLSConfig_Handshake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, other := newTestCA(t, "ca"), newTestCA(t, "other")
+	serverCert, serverKey := ca.issue(t, 2, "server.global.dtle")
+	otherRegionCert, otherRegionKey := ca.issue(t, 3, "server.other.dtle")
+	untrustedCert, untrustedKey := other.issue(t, 4, "server.global.dtle")
+	clientCert, clientKey := ca.issue(t, 5)
+	otherClientCert, otherClientKey := other.issue(t, 6)
+	// The name of the servers is configured
+	namedClient := ca.tlsConfig(t, dir, "namedclient", clientCert, clientKey, true)
+	namedClient.ServerName = "server.other.dtle"
+
+	tests := []struct {
+		name          string
+		server        *TLSConfig
+		client        *TLSConfig
+		wantClientErr string
+		wantServerErr bool
+	}{
+		{"mutual TLS",
+			ca.tlsConfig(t, dir, "server", serverCert, serverKey, false),
+			ca.tlsConfig(t, dir, "client", clientCert, clientKey, true), "", false},
+		{"untrusted server certificate",
+			ca.tlsConfig(t, dir, "untrusted", untrustedCert, untrustedKey, false),
+			ca.tlsConfig(t, dir, "client", clientCert, clientKey, false), "not trusted", true},
+		{"server hostname not verified",
+			ca.tlsConfig(t, dir, "otherregion", otherRegionCert, otherRegionKey, false),
+			ca.tlsConfig(t, dir, "client", clientCert, clientKey, false), "", false},
+		{"server hostname mismatch",
+			ca.tlsConfig(t, dir, "otherregion", otherRegionCert, otherRegionKey, false),
+			ca.tlsConfig(t, dir, "client", clientCert, clientKey, true), "not trusted", true},
+		{"configured server name",
+			ca.tlsConfig(t, dir, "otherregion", otherRegionCert, otherRegionKey, false),
+			namedClient, "", false},
+		{"untrusted client certificate",
+			ca.tlsConfig(t, dir, "server", serverCert, serverKey, false),
+			ca.tlsConfig(t, dir, "otherclient", otherClientCert, otherClientKey, false), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, errCh := serveTLS(t, tt.server)
+			wrap, err := tt.client.OutgoingTLSWrapper()
+			if err != nil || wrap == nil {
+				t.Fatalf("OutgoingTLSWrapper() = %v, %v", wrap, err)
+			}
+			raw, err := net.Dial("tcp", addr.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer raw.Close()
+
+			conn, err := wrap("global", raw)
+			if err == nil {
+				// The server may only refuse the client certificate once
+				// the client handshake is done
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				buf := []byte{1}
+				if _, err = conn.Write(buf); err == nil {
+					_, err = conn.Read(buf)
+				}
+				conn.Close()
+			}
+			switch {
+			case tt.wantClientErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantClientErr)):
+				t.Errorf("client error = %v, want one containing %q", err, tt.wantClientErr)
+			case tt.wantClientErr == "" && !tt.wantServerErr && err != nil:
+				t.Errorf("client error = %v", err)
+			}
+			if serverErr := <-errCh; (serverErr != nil) != tt.wantServerErr {
+				t.Errorf("server error = %v, wantServerErr %v", serverErr, tt.wantServerErr)
+			}
+		})
+	}
+}
+
+func TestTLSConfig_Plaintext(t *testing.T) {
+	for _, conf := range []*TLSConfig{nil, {}, {EnableRPC: internal.BoolToPtr(false), CAFile: "missing.pem"}} {
+		if wrap, err := conf.OutgoingTLSWrapper(); wrap != nil || err != nil {
+			t.Errorf("OutgoingTLSWrapper() of %+v = %v, %v, want no wrapper", conf, wrap, err)
+		}
+	}
+
+	// A plaintext peer is refused by a TLS listener
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t, "ca")
+	cert, key := ca.issue(t, 2, "server.global.dtle")
+	addr, errCh := serveTLS(t, ca.tlsConfig(t, dir, "server", cert, key, false))
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("plaintext rpc request\r\n\r\n"))
+	if err := <-errCh; err == nil {
+		t.Errorf("server error of a plaintext peer = nil")
+	}
+}
+
+func TestTLSConfig_Merge(t *testing.T) {
+	base := &TLSConfig{
+		EnableRPC:            internal.BoolToPtr(true),
+		VerifyServerHostname: internal.BoolToPtr(true),
+		CAFile:               "ca.pem",
+	}
+
+	// Unset fields leave the base as is
+	merged := base.Merge(&TLSConfig{CertFile: "cert.pem", ServerName: "dtle.example.com"})
+	if !*merged.EnableRPC || !*merged.VerifyServerHostname || merged.CAFile != "ca.pem" || merged.CertFile != "cert.pem" ||
+		merged.ServerName != "dtle.example.com" {
+		t.Errorf("Merge() of unset booleans = %+v", merged)
+	}
+
+	// False turns them back off
+	merged = base.Merge(&TLSConfig{EnableRPC: internal.BoolToPtr(false), VerifyServerHostname: internal.BoolToPtr(false)})
+	if *merged.EnableRPC || *merged.VerifyServerHostname || merged.CAFile != "ca.pem" {
+		t.Errorf("Merge() of false booleans = %+v", merged)
+	}
+	if !*base.EnableRPC || !*base.VerifyServerHostname {
+		t.Errorf("Merge() changed its receiver to %+v", base)
+	}
+}
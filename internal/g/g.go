@@ -6,4 +6,7 @@ var (
 
 const (
 	GtidExecutedTableV2 string = "gtid_executed_v2"
+	// SplitProgressTableV2 holds how far the transactions split by the
+	// applier are committed
+	SplitProgressTableV2 string = "split_progress_v2"
 )
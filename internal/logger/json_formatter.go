@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// The fields every entry the JSONFormatter formats has. The component is the
+// "component: " prefix of the message unless the entry has a field for it.
+const (
+	FieldLevel     = "level"
+	FieldTimestamp = "timestamp"
+	FieldMessage   = "message"
+	FieldComponent = "component"
+	FieldNodeID    = "node_id"
+	FieldJobID     = "job_id"
+	FieldRequestID = "request_id"
+)
+
+// componentPrefix matches the prefix of the messages telling their component,
+// as in "server.job: Register failed"
+var componentPrefix = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_.-]*): `)
+
+// JSONFormatter formats the entries as JSON objects, one per line, so that
+// log pipelines can parse them.
+type JSONFormatter struct {
+	// TimestampFormat to use for the timestamp field
+	TimestampFormat string
+
+	// fields are added to every entry, as the node ID once it is known
+	fields Fields
+	lock   sync.RWMutex
+}
+
+// SetField adds the field key to every entry formatted from now on
+func (f *JSONFormatter) SetField(key string, value interface{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.fields == nil {
+		f.fields = make(Fields)
+	}
+	f.fields[key] = value
+}
+
+func (f *JSONFormatter) Format(entry *Entry) ([]byte, error) {
+	f.lock.RLock()
+	data := make(Fields, len(f.fields)+len(entry.Data)+4)
+	for k, v := range f.fields {
+		data[k] = v
+	}
+	f.lock.RUnlock()
+
+	for k, v := range entry.Data {
+		switch k {
+		case FieldLevel, FieldTimestamp, FieldMessage:
+			k = "fields." + k
+		}
+		if err, ok := v.(error); ok {
+			// Otherwise errors are ignored by encoding/json
+			v = err.Error()
+		}
+		data[k] = v
+	}
+
+	timestampFormat := f.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = DefaultTimestampFormat
+	}
+	data[FieldLevel] = entry.Level.String()
+	data[FieldTimestamp] = entry.Time.Format(timestampFormat)
+	data[FieldMessage] = entry.Message
+	if _, ok := data[FieldComponent]; !ok {
+		if m := componentPrefix.FindStringSubmatch(entry.Message); m != nil {
+			data[FieldComponent] = m[1]
+		}
+	}
+
+	serialized, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal fields to JSON, %v", err)
+	}
+	return append(serialized, '\n'), nil
+}
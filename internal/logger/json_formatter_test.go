@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestJSONFormatter_Format(t *testing.T) {
+	formatter := &JSONFormatter{}
+	formatter.SetField(FieldNodeID, "node1")
+	var out bytes.Buffer
+	logger := New(&out, InfoLevel)
+	logger.Formatter = formatter
+
+	tests := []struct {
+		name string
+		log  func()
+		want map[string]interface{}
+	}{
+		{"component of the message", func() {
+			logger.WithFields(Fields{FieldJobID: "job1", FieldRequestID: "req1"}).Errorf("server.job: Register failed: %v", errors.New("no leader"))
+		}, map[string]interface{}{
+			"level": "ERR", "message": "server.job: Register failed: no leader",
+			"component": "server.job", "node_id": "node1", "job_id": "job1", "request_id": "req1",
+		}},
+		{"no component", func() {
+			logger.WithFields(Fields{"message": "clash", ErrorKey: errors.New("failed")}).Infof("setState 1")
+		}, map[string]interface{}{
+			"level": "INFO", "message": "setState 1", "fields.message": "clash",
+			"error": "failed", "node_id": "node1",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			tt.log()
+			var got map[string]interface{}
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("JSONFormatter.Format() = %q: %v", out.String(), err)
+			}
+			if _, ok := got[FieldTimestamp]; !ok {
+				t.Errorf("JSONFormatter.Format() = %q, want a timestamp", out.String())
+			}
+			delete(got, FieldTimestamp)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("JSONFormatter.Format() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
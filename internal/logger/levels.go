@@ -0,0 +1,216 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LevelOverride logs the entries of a component, or of a job, at another
+// level than the logger. A component is the "component: " prefix of the
+// message, as in "server.rpc: ...", or the component field of the entry,
+// and matches the components it is a prefix of up to a dot: "server"
+// matches "server.rpc". A job matches the entries with its job_id field.
+type LevelOverride struct {
+	Component string
+	JobID     string
+	Level     Level
+}
+
+func (o *LevelOverride) String() string {
+	switch {
+	case o.JobID != "":
+		return fmt.Sprintf("job %s at %s", o.JobID, o.Level)
+	case o.Component != "":
+		return fmt.Sprintf("component %s at %s", o.Component, o.Level)
+	}
+	return fmt.Sprintf("all at %s", o.Level)
+}
+
+// levels is the level of a logger changed at runtime, with its overrides.
+// It is never modified once it is in use, a change swaps in a copy.
+type levels struct {
+	// base is the level of the entries no override matches
+	base       Level
+	components map[string]Level
+	jobs       map[string]Level
+	// max is the highest level of all, which an entry must be below to be
+	// worth matching against the overrides
+	max Level
+}
+
+// levelsLock serializes the changes of the levels of the loggers
+var levelsLock sync.Mutex
+
+// loadLevels returns the levels of logger, nil if they never changed
+func (logger *Logger) loadLevels() *levels {
+	l, _ := logger.levels.Load().(*levels)
+	return l
+}
+
+// enabled returns whether an entry at level may be logged, according to
+// the level of logger or one of its overrides
+func (logger *Logger) enabled(level Level) bool {
+	if l := logger.loadLevels(); l != nil {
+		return l.max >= level
+	}
+	return logger.Level >= level
+}
+
+// allows returns whether entry, at level, is logged: its job or component
+// may be logged at another level than the others
+func (logger *Logger) allows(level Level, entry *Entry) bool {
+	l := logger.loadLevels()
+	if l == nil {
+		return true
+	}
+	if len(l.jobs) > 0 {
+		if id, ok := entry.Data[FieldJobID].(string); ok {
+			if jl, ok := l.jobs[id]; ok {
+				return jl >= level
+			}
+		}
+	}
+	if len(l.components) > 0 {
+		component, _ := entry.Data[FieldComponent].(string)
+		if component == "" {
+			if m := componentPrefix.FindStringSubmatch(entry.Message); m != nil {
+				component = m[1]
+			}
+		}
+		for component != "" {
+			if cl, ok := l.components[component]; ok {
+				return cl >= level
+			}
+			i := strings.LastIndex(component, ".")
+			if i < 0 {
+				break
+			}
+			component = component[:i]
+		}
+	}
+	return l.base >= level
+}
+
+// SetLevelOverride changes the level entries are logged at, for those of
+// the component or job of o, or for all of them if it has neither. The
+// level of all the entries doesn't change the overrides.
+func (logger *Logger) SetLevelOverride(o *LevelOverride) {
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+	l := logger.copyLevels()
+	switch {
+	case o.JobID != "":
+		l.jobs[o.JobID] = o.Level
+	case o.Component != "":
+		l.components[o.Component] = o.Level
+	default:
+		l.base = o.Level
+	}
+	logger.storeLevels(l)
+}
+
+// RemoveLevelOverride makes the entries of the component or job of o
+// logged at the level of the others again
+func (logger *Logger) RemoveLevelOverride(o *LevelOverride) {
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+	l := logger.copyLevels()
+	delete(l.jobs, o.JobID)
+	delete(l.components, o.Component)
+	logger.storeLevels(l)
+}
+
+// LevelOverrides returns the level all the entries are logged at, first,
+// and the overrides of logger, by component then job
+func (logger *Logger) LevelOverrides() []*LevelOverride {
+	l := logger.loadLevels()
+	if l == nil {
+		return []*LevelOverride{{Level: logger.Level}}
+	}
+	overrides := []*LevelOverride{{Level: l.base}}
+	var components, jobs []*LevelOverride
+	for component, level := range l.components {
+		components = append(components, &LevelOverride{Component: component, Level: level})
+	}
+	for id, level := range l.jobs {
+		jobs = append(jobs, &LevelOverride{JobID: id, Level: level})
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i].Component < components[j].Component })
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].JobID < jobs[j].JobID })
+	return append(append(overrides, components...), jobs...)
+}
+
+func (logger *Logger) copyLevels() *levels {
+	l := &levels{base: logger.Level, components: make(map[string]Level), jobs: make(map[string]Level)}
+	if old := logger.loadLevels(); old != nil {
+		l.base = old.base
+		for k, v := range old.components {
+			l.components[k] = v
+		}
+		for k, v := range old.jobs {
+			l.jobs[k] = v
+		}
+	}
+	return l
+}
+
+func (logger *Logger) storeLevels(l *levels) {
+	l.max = l.base
+	for _, level := range l.components {
+		if level > l.max {
+			l.max = level
+		}
+	}
+	for _, level := range l.jobs {
+		if level > l.max {
+			l.max = level
+		}
+	}
+	logger.levels.Store(l)
+}
+
+// LookupLevel returns the level named name, as ParseLevel does, or an error
+// rather than the info level if there is none
+func LookupLevel(name string) (Level, error) {
+	switch strings.ToUpper(name) {
+	case "ERR":
+		return ErrorLevel, nil
+	case "INFO":
+		return InfoLevel, nil
+	}
+	if level := ParseLevel(name); level != InfoLevel {
+		return level, nil
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q", name)
+}
+
+// ChangeLevel logs the entries of component or of the job jobID, or all of
+// them if both are empty, at the level named level, or at the level of the
+// others if it is empty. It returns the change, to be logged.
+func (logger *Logger) ChangeLevel(level, component, jobID string) (string, error) {
+	if component != "" && jobID != "" {
+		return "", fmt.Errorf("only one of the component and the job can be set")
+	}
+	o := &LevelOverride{Component: component, JobID: jobID}
+	if level == "" {
+		if component == "" && jobID == "" {
+			return "", fmt.Errorf("missing log level")
+		}
+		logger.RemoveLevelOverride(o)
+		return fmt.Sprintf("%s%s at the level of the others", component, jobID), nil
+	}
+	var err error
+	if o.Level, err = LookupLevel(level); err != nil {
+		return "", err
+	}
+	logger.SetLevelOverride(o)
+	return o.String(), nil
+}
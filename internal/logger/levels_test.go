@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package logger
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestLogger_ChangeLevel(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, InfoLevel)
+	logs := func(log func()) bool {
+		out.Reset()
+		log()
+		return out.Len() > 0
+	}
+
+	if logs(func() { logger.Debugf("server.rpc: request") }) {
+		t.Fatalf("logged a debug entry at the info level")
+	}
+	for _, change := range [][3]string{
+		{"debug", "server", ""},
+		{"error", "server.rpc.stream", ""},
+		{"debug", "", "job1"},
+	} {
+		if _, err := logger.ChangeLevel(change[0], change[1], change[2]); err != nil {
+			t.Fatalf("Logger.ChangeLevel(%q) error = %v", change, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		log  func()
+		want bool
+	}{
+		{"component", func() { logger.Debugf("server.rpc: request") }, true},
+		{"component of an entry", func() { logger.WithField(FieldComponent, "server.job").Debug("register") }, true},
+		{"other component", func() { logger.Debugf("client.driver: start") }, false},
+		{"no component", func() { logger.Debugf("[DEBUG] server: join") }, false},
+		{"quieter component", func() { logger.Warnf("server.rpc.stream: closed") }, false},
+		{"quieter component error", func() { logger.Errorf("server.rpc.stream: failed") }, true},
+		{"job", func() { logger.WithField(FieldJobID, "job1").Debugf("client.driver: start") }, true},
+		{"job over component", func() { logger.WithField(FieldJobID, "job1").Debugf("server.rpc.stream: open") }, true},
+		{"other job", func() { logger.WithField(FieldJobID, "job2").Debugf("client.driver: start") }, false},
+		{"info", func() { logger.Infof("client.driver: start") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logs(tt.log); got != tt.want {
+				t.Errorf("logged = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	want := []*LevelOverride{
+		{Level: InfoLevel},
+		{Component: "server", Level: DebugLevel},
+		{Component: "server.rpc.stream", Level: ErrorLevel},
+		{JobID: "job1", Level: DebugLevel},
+	}
+	if got := logger.LevelOverrides(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Logger.LevelOverrides() = %v, want %v", got, want)
+	}
+
+	// Back to the level of the others
+	if _, err := logger.ChangeLevel("", "server", ""); err != nil {
+		t.Fatalf("Logger.ChangeLevel() error = %v", err)
+	}
+	if _, err := logger.ChangeLevel("warn", "", ""); err != nil {
+		t.Fatalf("Logger.ChangeLevel() error = %v", err)
+	}
+	if logs(func() { logger.Debugf("server.rpc: request") }) || logs(func() { logger.Infof("client.driver: start") }) {
+		t.Errorf("logged below the warn level")
+	}
+
+	for _, change := range [][3]string{
+		{"verbose", "", ""},
+		{"", "", ""},
+		{"debug", "server", "job1"},
+	} {
+		if _, err := logger.ChangeLevel(change[0], change[1], change[2]); err == nil {
+			t.Errorf("Logger.ChangeLevel(%q) = nil error", change)
+		}
+	}
+}
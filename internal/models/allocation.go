@@ -352,6 +352,11 @@ type AllocUpdateRequest struct {
 	// It is pulled out since it is common to reduce payload size.
 	Job *Job
 
+	// JobEventsRetention is the number of task events the servers keep for
+	// each job, set by the leader so that they all keep the same. Zero is
+	// DefaultJobEventsRetention.
+	JobEventsRetention int
+
 	WriteRequest
 }
 
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 
@@ -21,16 +22,19 @@ const (
 )
 
 const (
-	JobStatusPause    = "pause"    // Pause means the job is pause
-	JobStatusPending  = "pending"  // Pending means the job is waiting on scheduling
-	JobStatusRunning  = "running"  // Running means the job has non-terminal allocations
-	JobStatusDead     = "dead"     // Dead means all evaluation's and allocations are terminal
-	JobStatusComplete = "complete" // Complete means all evaluation's and allocations are terminal
+	JobStatusPause     = "pause"     // Pause means the job is pause
+	JobStatusPending   = "pending"   // Pending means the job is waiting on scheduling
+	JobStatusRunning   = "running"   // Running means the job has non-terminal allocations
+	JobStatusDead      = "dead"      // Dead means all evaluation's and allocations are terminal
+	JobStatusComplete  = "complete"  // Complete means all evaluation's and allocations are terminal
+	JobStatusFailed    = "failed"    // Failed means one of the job's allocations failed
+	JobStatusCancelled = "cancelled" // Cancelled means the job was cancelled and its allocations stopped
 )
 
 func ValidJobStatus(status string) bool {
 	switch status {
-	case JobStatusPending, JobStatusRunning, JobStatusPause, JobStatusDead, JobStatusComplete:
+	case JobStatusPending, JobStatusRunning, JobStatusPause, JobStatusDead, JobStatusComplete, JobStatusFailed,
+		JobStatusCancelled:
 		return true
 	default:
 		return false
@@ -74,6 +78,14 @@ type Job struct {
 	// to run. Each task is an atomic unit of scheduling and placement.
 	Tasks []*Task
 
+	// RestartPolicy decides how the tasks of the job are restarted when
+	// they fail
+	RestartPolicy *RestartPolicy
+
+	// CircuitBreaker pauses the job when its tasks fail too often, nil to
+	// never pause it
+	CircuitBreaker *CircuitBreaker
+
 	// Job status
 	Status string
 
@@ -94,6 +106,9 @@ func (j *Job) Canonicalize() {
 	for _, t := range j.Tasks {
 		t.Canonicalize(j)
 	}
+	if j.RestartPolicy == nil {
+		j.RestartPolicy = NewDefaultRestartPolicy()
+	}
 }
 
 // Copy returns a deep copy of the Job. It is expected that callers use recover.
@@ -106,6 +121,14 @@ func (j *Job) Copy() *Job {
 	*nj = *j
 	nj.Datacenters = internal.CopySliceString(nj.Datacenters)
 	nj.Constraints = CopySliceConstraints(nj.Constraints)
+	if j.RestartPolicy != nil {
+		policy := *j.RestartPolicy
+		nj.RestartPolicy = &policy
+	}
+	if j.CircuitBreaker != nil {
+		breaker := *j.CircuitBreaker
+		nj.CircuitBreaker = &breaker
+	}
 
 	if j.Tasks != nil {
 		ts := make([]*Task, len(nj.Tasks))
@@ -149,6 +172,17 @@ func (j *Job) Validate() error {
 		}
 	}
 
+	if j.RestartPolicy != nil {
+		if err := j.RestartPolicy.Validate(); err != nil {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("Restart policy validation failed: %v", err))
+		}
+	}
+	if j.CircuitBreaker != nil {
+		if err := j.CircuitBreaker.Validate(); err != nil {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("Circuit breaker validation failed: %v", err))
+		}
+	}
+
 	// Check for duplicate tasks
 	tasks := make(map[string]int)
 	for idx, t := range j.Tasks {
@@ -172,6 +206,93 @@ func (j *Job) Validate() error {
 	return mErr.ErrorOrNil()
 }
 
+const (
+	// RestartPolicyModeDelay restarts the tasks that failed more than
+	// Attempts times once the interval ends, RestartPolicyModeFail fails
+	// them
+	RestartPolicyModeDelay = "delay"
+	RestartPolicyModeFail  = "fail"
+)
+
+// RestartPolicy decides how the tasks of a job are restarted when they
+// fail or panic. Each task is restarted on its own, the other jobs of the
+// node go on.
+type RestartPolicy struct {
+	// Attempts is how many times a task is restarted within IntervalSeconds
+	Attempts        int
+	IntervalSeconds int
+	// DelaySeconds is the wait before a restart. It doubles with each
+	// restart within the interval, up to MaxDelaySeconds if greater.
+	DelaySeconds    int
+	MaxDelaySeconds int
+	// Mode is what happens to the tasks failing more often, one of the
+	// RestartPolicyMode values
+	Mode string
+}
+
+// NewDefaultRestartPolicy returns the policy of the jobs setting none: 5
+// restarts a minute, 15 seconds apart
+func NewDefaultRestartPolicy() *RestartPolicy {
+	return &RestartPolicy{
+		Attempts:        5,
+		IntervalSeconds: 60,
+		DelaySeconds:    15,
+		Mode:            RestartPolicyModeDelay,
+	}
+}
+
+// Validate checks the values of the policy
+func (p *RestartPolicy) Validate() error {
+	switch p.Mode {
+	case RestartPolicyModeDelay, RestartPolicyModeFail:
+	default:
+		return fmt.Errorf("unsupported restart mode: %q", p.Mode)
+	}
+	if p.Attempts < 0 {
+		return fmt.Errorf("Attempts can't be negative: %d", p.Attempts)
+	}
+	if p.IntervalSeconds <= 0 {
+		return fmt.Errorf("IntervalSeconds must be greater than zero: %d", p.IntervalSeconds)
+	}
+	if p.DelaySeconds < 0 || p.MaxDelaySeconds < 0 {
+		return fmt.Errorf("DelaySeconds and MaxDelaySeconds can't be negative")
+	}
+	return nil
+}
+
+// Delay returns the wait before the restart of a task restarted count
+// times within the interval, before jitter
+func (p *RestartPolicy) Delay(count int) time.Duration {
+	delay := time.Duration(p.DelaySeconds) * time.Second
+	max := time.Duration(p.MaxDelaySeconds) * time.Second
+	for i := 1; i < count && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max && max > time.Duration(p.DelaySeconds)*time.Second {
+		delay = max
+	}
+	return delay
+}
+
+// CircuitBreaker pauses a job whose tasks failed Errors times within
+// WindowSeconds, for the target not to be hammered by a job failing over and
+// over. The job stays paused until it is resumed.
+type CircuitBreaker struct {
+	Errors        int
+	WindowSeconds int
+}
+
+// Validate checks the values of the circuit breaker
+func (b *CircuitBreaker) Validate() error {
+	if b.Errors <= 0 {
+		return fmt.Errorf("Errors must be greater than zero: %d", b.Errors)
+	}
+	if b.WindowSeconds <= 0 {
+		return fmt.Errorf("WindowSeconds must be greater than zero: %d", b.WindowSeconds)
+	}
+	return nil
+}
+
 // LookupTask finds a task by name
 func (j *Job) LookupTask(tp string) *Task {
 	for _, t := range j.Tasks {
@@ -234,6 +355,126 @@ type JobUpdateStatusRequest struct {
 	WriteRequest
 }
 
+// JobPauseRequest is used to pause or resume a running job
+type JobPauseRequest struct {
+	JobID string
+	WriteRequest
+}
+
+// JobConfigUpdateRequest is used to change the configuration of the tasks
+// of a job, which reload it as they run. Only the fields of ReloadableConfig
+// may differ from the configuration of the job.
+type JobConfigUpdateRequest struct {
+	JobID string
+	// Tasks are the tasks of the job with their new configuration
+	Tasks []*Task
+	WriteRequest
+}
+
+// JobConfigUpdateResponse names the fields of the configuration a
+// JobConfigUpdateRequest changed, by task type
+type JobConfigUpdateResponse struct {
+	Changed map[string][]string
+	Success bool
+	WriteMeta
+}
+
+// JobVerifyRequest is used to compare the rows of the tables a job
+// replicates on the source and on the target
+type JobVerifyRequest struct {
+	JobID string
+	// ChunkSize is the number of rows compared at once, 1000 if 0
+	ChunkSize int
+	QueryOptions
+}
+
+// JobVerifyStatusRequest is used to get the last comparison of the tables
+// of a job
+type JobVerifyStatusRequest struct {
+	JobID string
+	QueryOptions
+}
+
+// JobVerifyResponse returns a comparison of the tables of a job
+type JobVerifyResponse struct {
+	Verification *JobVerification
+	QueryMeta
+}
+
+// Values of JobVerification.Status
+const (
+	JobVerificationRunning  = "running"
+	JobVerificationComplete = "complete"
+	JobVerificationFailed   = "failed"
+)
+
+// JobVerification is a comparison of the tables of a job, which the leader
+// runs in the background. It is kept in memory, and lost if the leadership
+// changes.
+type JobVerification struct {
+	ID     string
+	JobID  string
+	Status string
+	// Error tells why the verification failed
+	Error  string
+	Tables []*TableVerification
+	// Consistent is true if every table was compared and matches, once
+	// complete
+	Consistent bool
+	StartTime  time.Time
+	// EndTime is zero while it runs
+	EndTime time.Time
+}
+
+// JobReplayRequest is used to apply again the transactions of a job from
+// GtidStart to GtidStop, both "uuid:gno", in a job of its own
+type JobReplayRequest struct {
+	JobID     string
+	GtidStart string
+	GtidStop  string
+	// Target is the ConnectionConfig of the target the transactions are
+	// applied to, nil for the one of the job
+	Target map[string]interface{}
+	WriteRequest
+}
+
+// JobReplayResponse returns the job of a replay
+type JobReplayResponse struct {
+	// ReplayJobID is the job applying the transactions, whose events report
+	// how far it went and when it completes
+	ReplayJobID string
+	QueryMeta
+}
+
+// TableVerification is the comparison of a table of the source with the
+// one it is replicated to
+type TableVerification struct {
+	TableSchema  string
+	TableName    string
+	TargetSchema string
+	TargetTable  string
+	// KeyColumns is the primary key the table is cut in chunks by
+	KeyColumns []string
+	Chunks     int
+	SourceRows int64
+	TargetRows int64
+	// Mismatches are the chunks whose rows differ
+	Mismatches []*ChunkMismatch
+	// Error tells why the table could not be compared
+	Error string
+}
+
+// ChunkMismatch is a range of primary keys whose rows differ on the source
+// and on the target
+type ChunkMismatch struct {
+	// LowerBound is the key the range starts after, nil from the first
+	// row. UpperBound is the last key of the range, nil up to the last row.
+	LowerBound []string
+	UpperBound []string
+	SourceRows int64
+	TargetRows int64
+}
+
 // JobPlanResponse is used to respond to a job plan request
 type JobPlanResponse struct {
 	// Annotations stores annotations explaining decisions the scheduler made.
@@ -289,6 +530,13 @@ type JobDeregisterRequest struct {
 	WriteRequest
 }
 
+// JobCancelRequest is used for Job.Cancel endpoint to cancel a job, whatever
+// the state of its allocations
+type JobCancelRequest struct {
+	JobID string
+	WriteRequest
+}
+
 // JobEvaluateRequest is used when we just need to re-evaluate a target job
 type JobEvaluateRequest struct {
 	JobID string
@@ -336,12 +584,18 @@ type JobValidateResponse struct {
 	// ValidationErrors is a list of validation errors
 	ValidationTasks []*TaskValidateResponse
 
+	// Valid is true if every check of every task passed
+	Valid bool
+
 	Error string
 }
 
 type TaskValidateResponse struct {
 	Type string
 
+	// Checks is the report of every check run for the task, in order
+	Checks []*ValidateCheck
+
 	Connection ConnectionValidate
 
 	LogSlaveUpdates LogSlaveUpdatesValidate
@@ -355,6 +609,45 @@ type TaskValidateResponse struct {
 	ServerID ServerIDValidate
 
 	Binlog BinlogValidate
+
+	ColumnFilters ColumnFiltersValidate
+}
+
+// ValidateCheck is the outcome of a check run before a task starts
+type ValidateCheck struct {
+	Name    string
+	Success bool
+	// Detail tells what failed
+	Detail string
+	// Warnings tell what may go wrong, even though the check passed
+	Warnings []string
+}
+
+// AddCheck records the outcome of the check name, which passed if err is
+// nil, and returns it
+func (r *TaskValidateResponse) AddCheck(name string, err error) *ValidateCheck {
+	check := &ValidateCheck{Name: name, Success: err == nil}
+	if err != nil {
+		check.Detail = err.Error()
+	}
+	r.Checks = append(r.Checks, check)
+	return check
+}
+
+// Valid tells whether every check run for the task passed
+func (r *TaskValidateResponse) Valid() bool {
+	for _, check := range r.Checks {
+		if !check.Success {
+			return false
+		}
+	}
+	return true
+}
+
+type ColumnFiltersValidate struct {
+	Success bool
+	// Error is a string version of any error that may have occured
+	Error string
 }
 
 type BinlogValidate struct {
@@ -8,7 +8,9 @@ package models
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"reflect"
 	"time"
 
@@ -18,8 +20,63 @@ import (
 )
 
 var (
-	ErrNoLeader     = fmt.Errorf("No cluster leader")
-	ErrNoRegionPath = fmt.Errorf("No path to region")
+	ErrNoLeader     = NewRPCError(ErrCodeNoLeader, "No cluster leader")
+	ErrNoRegionPath = NewRPCError(ErrCodeNoRegionPath, "No path to region")
+
+	// ErrInvalidPageToken is returned when a NextToken can't be parsed
+	ErrInvalidPageToken = NewRPCError(ErrCodeInvalidPageToken, "Invalid pagination token")
+
+	// ErrRaftEntryTooLarge is returned when a command is larger than the
+	// configured MaxRaftEntrySize and was not applied.
+	ErrRaftEntryTooLarge = NewRPCError(ErrCodeRaftEntryTooLarge, "Raft entry too large")
+
+	// ErrReadIndexTimeout is returned when a follower couldn't catch up
+	// with the leader in time to serve a consistent read.
+	ErrReadIndexTimeout = NewRPCError(ErrCodeReadIndexTimeout, "Timed out waiting to catch up with the leader")
+
+	// ErrUnsupportedSchemaVersion is returned when decoding a message
+	// written by a newer release with a schema this node doesn't know.
+	ErrUnsupportedSchemaVersion = NewRPCError(ErrCodeUnsupportedSchemaVersion, "Unsupported message schema version")
+
+	// ErrSnapshotInProgress is returned when a snapshot is requested while
+	// another requested snapshot is still being taken.
+	ErrSnapshotInProgress = NewRPCError(ErrCodeSnapshotInProgress, "Snapshot already in progress")
+
+	// ErrQueryCancelled is returned by a blocking query whose caller went
+	// away before it completed.
+	ErrQueryCancelled = NewRPCError(ErrCodeQueryCancelled, "Query cancelled")
+
+	// ErrRateLimited is returned when a request exceeds the rate limit
+	// configured for its RPC method.
+	ErrRateLimited = NewRPCError(ErrCodeRateLimited, "Rate limit exceeded")
+
+	// ErrServerOverloaded is returned when a request was shed because the
+	// server was serving and queueing as many requests as it allows
+	ErrServerOverloaded = NewRPCError(ErrCodeServerOverloaded, "Server overloaded")
+
+	// ErrRemoveLeader is returned when asked to remove the current leader
+	// from the Raft configuration.
+	ErrRemoveLeader = NewRPCError(ErrCodeRemoveLeader, "Refusing to remove the current Raft leader")
+
+	// ErrRemovePeerQuorum is returned when removing a Raft peer would
+	// leave fewer live voters than the quorum of the new configuration.
+	ErrRemovePeerQuorum = NewRPCError(ErrCodeRemovePeerQuorum, "Refusing to remove a Raft peer: too few live voters would be left for a quorum")
+
+	// ErrFrameCorrupt is returned when an RPC frame doesn't match its
+	// checksum
+	ErrFrameCorrupt = NewRPCError(ErrCodeFrameCorrupt, "RPC frame checksum mismatch")
+
+	// ErrPermissionDenied is returned when an RPC method may not be called
+	// on the listener the request came in on.
+	ErrPermissionDenied = NewRPCError(ErrCodePermissionDenied, "Permission denied")
+
+	// ErrMaintenanceMode is returned when asked to start a job while the
+	// cluster is in maintenance mode.
+	ErrMaintenanceMode = NewRPCError(ErrCodeMaintenanceMode, "The cluster is in maintenance mode, no job can be started")
+
+	// ErrServersNotUpgraded is returned when a request needs a message type
+	// some servers of the region don't know yet.
+	ErrServersNotUpgraded = NewRPCError(ErrCodeServersNotUpgraded, "Not every server supports this request yet, upgrade them first")
 )
 
 type MessageType uint8
@@ -39,8 +96,55 @@ const (
 	EvalDeleteRequestType
 	AllocUpdateRequestType
 	AllocClientUpdateRequestType
+	BatchRequestType
+	JobConfigUpdateRequestType
+	JobCancelRequestType
+	MaintenanceModeRequestType
+	StateImportRequestType
 )
 
+var messageTypeNames = []string{
+	"NodeRegister",
+	"NodeDeregister",
+	"NodeUpdateStatus",
+	"JobUpdateStatus",
+	"JobRegister",
+	"JobDeregister",
+	"JobRenewal",
+	"JobClientUpdate",
+	"OrderRegister",
+	"OrderDeregister",
+	"EvalUpdate",
+	"EvalDelete",
+	"AllocUpdate",
+	"AllocClientUpdate",
+	"Batch",
+	"JobConfigUpdate",
+	"JobCancel",
+	"MaintenanceMode",
+	"StateImport",
+}
+
+func (t MessageType) String() string {
+	if int(t) < len(messageTypeNames) {
+		return messageTypeNames[t]
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(t))
+}
+
+// MinSchemaVersion returns the lowest schema version of the servers that
+// know the message type. Older servers panic applying it, so it may only
+// be written to the Raft log once every server decodes that version.
+func (t MessageType) MinSchemaVersion() uint8 {
+	switch t &^ IgnoreUnknownTypeFlag {
+	case BatchRequestType, JobConfigUpdateRequestType, JobCancelRequestType, MaintenanceModeRequestType,
+		StateImportRequestType:
+		return 1
+	default:
+		return LegacySchemaVersion
+	}
+}
+
 const (
 	// IgnoreUnknownTypeFlag is set along with a MessageType
 	// to indicate that the message type can be safely ignored
@@ -55,8 +159,59 @@ type RPCInfo interface {
 	RequestRegion() string
 	IsRead() bool
 	AllowStaleRead() bool
+	NoLeaderWaitRequested() bool
+	IsRetrySafe() bool
+	ConsistentRead() bool
+	GetRequestID() string
+	SetRequestID(string)
+	RequestDeadline() time.Time
+	RequestPriority() RPCPriority
+}
+
+// MaxQueryTime is the longest a blocking query waits for a change, and how
+// long it waits if it doesn't set MaxQueryTime
+const MaxQueryTime = 300 * time.Second
+
+// deadlineSetter is implemented by the requests whose Deadline can be set
+// from a timeout
+type deadlineSetter interface {
+	SetTimeout(timeout time.Duration)
 }
 
+// SetRequestTimeout sets the Deadline of args to timeout from now, if it
+// is a request that has none yet
+func SetRequestTimeout(args interface{}, timeout time.Duration) {
+	if req, ok := args.(deadlineSetter); ok {
+		req.SetTimeout(timeout)
+	}
+}
+
+// RPCPriority orders the requests waiting to be served by a busy server.
+// Higher priorities are served first and lower ones shed first.
+type RPCPriority int8
+
+const (
+	RPCPriorityLow    RPCPriority = -1
+	RPCPriorityNormal RPCPriority = 0
+	RPCPriorityHigh   RPCPriority = 1
+)
+
+// ReadConsistency is the consistency level a read query asks for
+type ReadConsistency uint8
+
+const (
+	// ReadLeader forwards the read to the leader. It is the default.
+	ReadLeader ReadConsistency = iota
+
+	// ReadStale lets any server serve the read, which is the same as
+	// setting AllowStale.
+	ReadStale
+
+	// ReadConsistent lets a follower serve the read once it has applied
+	// everything the leader had committed when the read arrived.
+	ReadConsistent
+)
+
 // QueryOptions is used to specify various flags for read queries
 type QueryOptions struct {
 	// The target region for this query
@@ -73,8 +228,62 @@ type QueryOptions struct {
 	// may be arbitrarily stale.
 	AllowStale bool
 
+	// ReadConsistency selects which server may serve the read. AllowStale
+	// takes precedence over it.
+	ReadConsistency ReadConsistency
+
+	// MaxStaleness bounds how stale a stale read may be. A follower that
+	// didn't hear from the leader for longer forwards the read to the
+	// leader instead of serving it. Zero means no bound.
+	MaxStaleness time.Duration
+
 	// If set, used as prefix for resource list searches
 	Prefix string
+
+	// If set, the query fails with ErrNoLeader right away instead of
+	// waiting up to RPCHoldTimeout for a leader to be elected.
+	NoLeaderWait bool
+
+	// PerPage is the number of entries to be returned in queries that
+	// support paginated lists. Zero means everything is returned.
+	PerPage int32
+
+	// NextToken is the token used to indicate where to start paging for
+	// queries that support paginated lists. It is taken from the QueryMeta
+	// of the previous page. Queries for any page but the first never block.
+	NextToken string
+
+	// RequestID correlates the logs of every server the query goes
+	// through. It is generated by the first server if empty.
+	RequestID string
+
+	// Deadline is the time after which the caller no longer waits for
+	// the reply. The query is refused if it arrives after it, and work on
+	// it is abandoned once it passes. Zero means no deadline.
+	Deadline time.Time
+
+	// Priority is the priority of the query on a busy server. Bulk reads
+	// should use RPCPriorityLow.
+	Priority RPCPriority
+
+	// ctx is cancelled when the connection the query arrived on goes away
+	// or the Deadline passes. It is set by the RPC layer and never sent
+	// over the wire.
+	ctx context.Context
+}
+
+// SetContext attaches the context of the connection serving the query
+func (q *QueryOptions) SetContext(ctx context.Context) {
+	q.ctx = ctx
+}
+
+// Context returns the context of the connection serving the query, or a
+// background context if there is none.
+func (q *QueryOptions) Context() context.Context {
+	if q.ctx == nil {
+		return context.Background()
+	}
+	return q.ctx
 }
 
 func (q QueryOptions) RequestRegion() string {
@@ -87,12 +296,111 @@ func (q QueryOptions) IsRead() bool {
 }
 
 func (q QueryOptions) AllowStaleRead() bool {
-	return q.AllowStale
+	return q.AllowStale || q.ReadConsistency == ReadStale
+}
+
+func (q QueryOptions) ConsistentRead() bool {
+	return q.ReadConsistency == ReadConsistent
+}
+
+// RequestMaxStaleness returns how stale a stale read may be
+func (q QueryOptions) RequestMaxStaleness() time.Duration {
+	return q.MaxStaleness
+}
+
+func (q QueryOptions) GetRequestID() string {
+	return q.RequestID
+}
+
+func (q *QueryOptions) SetRequestID(id string) {
+	q.RequestID = id
+}
+
+func (q QueryOptions) RequestDeadline() time.Time {
+	return q.Deadline
+}
+
+func (q QueryOptions) RequestPriority() RPCPriority {
+	return q.Priority
+}
+
+// RequestMaxQueryTime returns the time the query is allowed to take
+func (q QueryOptions) RequestMaxQueryTime() time.Duration {
+	return q.MaxQueryTime
+}
+
+// IsBlockingQuery returns whether the query waits for a change
+func (q QueryOptions) IsBlockingQuery() bool {
+	return q.MinQueryIndex > 0
+}
+
+// SetTimeout sets the Deadline of the query to timeout from now, plus the
+// time a blocking query may wait for a change and its jitter. A deadline
+// already set is kept.
+func (q *QueryOptions) SetTimeout(timeout time.Duration) {
+	if !q.Deadline.IsZero() || timeout <= 0 {
+		return
+	}
+	if q.IsBlockingQuery() {
+		wait := q.MaxQueryTime
+		if wait <= 0 || wait > MaxQueryTime {
+			wait = MaxQueryTime
+		}
+		timeout += wait + wait/16
+	}
+	q.Deadline = time.Now().Add(timeout)
+}
+
+func (q QueryOptions) NoLeaderWaitRequested() bool {
+	return q.NoLeaderWait
+}
+
+// Queries don't modify anything so they can always be retried
+func (q QueryOptions) IsRetrySafe() bool {
+	return true
 }
 
 type WriteRequest struct {
 	// The target region for this write
 	Region string
+
+	// EnqueueTimeout overrides how long the leader waits to enqueue the
+	// Raft command of a slow write, such as a bulk operation. Zero uses
+	// the default and the server caps it.
+	EnqueueTimeout time.Duration
+
+	// RequestID correlates the logs of every server the write goes
+	// through, including the FSM applying it. It is generated by the first
+	// server if empty.
+	RequestID string
+
+	// Deadline is the time after which the caller no longer waits for
+	// the reply. The write is refused if it arrives after it, and the
+	// server stops waiting for Raft once it passes, although the write
+	// may still be applied. Zero means no deadline.
+	Deadline time.Time
+
+	// Priority is the priority of the write on a busy server
+	Priority RPCPriority
+
+	// ctx is cancelled when the connection the write arrived on goes away
+	// or the Deadline passes. It is set by the RPC layer and never sent
+	// over the wire.
+	ctx context.Context
+}
+
+// SetContext attaches the context of the connection serving the write
+func (w *WriteRequest) SetContext(ctx context.Context) {
+	w.ctx = ctx
+}
+
+// Context returns the context of the connection serving the write, or a
+// background context if there is none.
+func (w *WriteRequest) Context() context.Context {
+	if w.ctx == nil {
+		return context.Background()
+	}
+	return w.ctx
 }
 
 func (w WriteRequest) RequestRegion() string {
@@ -109,6 +417,49 @@ func (w WriteRequest) AllowStaleRead() bool {
 	return false
 }
 
+// Writes always wait for a leader
+func (w WriteRequest) NoLeaderWaitRequested() bool {
+	return false
+}
+
+// Writes may not be idempotent, so they are only retried if they
+// certainly didn't reach the leader
+func (w WriteRequest) IsRetrySafe() bool {
+	return false
+}
+
+func (w WriteRequest) ConsistentRead() bool {
+	return false
+}
+
+func (w WriteRequest) GetRequestID() string {
+	return w.RequestID
+}
+
+func (w *WriteRequest) SetRequestID(id string) {
+	w.RequestID = id
+}
+
+func (w WriteRequest) RequestDeadline() time.Time {
+	return w.Deadline
+}
+
+// SetTimeout sets the Deadline of the write to timeout from now, unless
+// one is already set
+func (w *WriteRequest) SetTimeout(timeout time.Duration) {
+	if w.Deadline.IsZero() && timeout > 0 {
+		w.Deadline = time.Now().Add(timeout)
+	}
+}
+
+func (w WriteRequest) RequestPriority() RPCPriority {
+	return w.Priority
+}
+
+func (w WriteRequest) RequestEnqueueTimeout() time.Duration {
+	return w.EnqueueTimeout
+}
+
 // QueryMeta allows a query response to include potentially
 // useful metadata about a query
 type QueryMeta struct {
@@ -122,6 +473,28 @@ type QueryMeta struct {
 
 	// Used to indicate if there is a known leader node
 	KnownLeader bool
+
+	// NextToken is the token returned with queries that support
+	// paginated lists. An empty token means there are no more pages.
+	NextToken string
+
+	// IndexChanged is set on a paginated query if the underlying table
+	// was modified since the first page was served, in which case entries
+	// may have been skipped or repeated.
+	IndexChanged bool
+
+	// ServerLoad is the number of RPCs the server answering the query was
+	// serving, not counting blocking queries waiting for a change.
+	ServerLoad int
+
+	// RetryAfter is set when the server is overloaded to the time clients
+	// should wait before their next request. It is only advisory.
+	RetryAfter time.Duration
+
+	// BlockingLimited is set when the server was already serving as many
+	// blocking queries as it allows. The query was then answered without
+	// waiting for a change and should be retried.
+	BlockingLimited bool
 }
 
 // WriteMeta allows a write response to include potentially
@@ -150,6 +523,211 @@ type VersionResponse struct {
 	QueryMeta
 }
 
+// RaftProgressResponse is used for the Status.RaftProgress response. The
+// embedded QueryMeta carries the time since the last contact with the
+// leader.
+type RaftProgressResponse struct {
+	// AppliedIndex is the last index applied to the FSM
+	AppliedIndex uint64
+
+	// CommitIndex is the last index known to be committed
+	CommitIndex uint64
+
+	// LastLogIndex is the last index in the local Raft log
+	LastLogIndex uint64
+
+	// LeaderLastLogIndex is the last index in the leader's Raft log, so
+	// the lag of a follower can be computed in entries. It is zero if the
+	// leader couldn't be reached.
+	LeaderLastLogIndex uint64
+
+	QueryMeta
+}
+
+// LeaderResponse is used for the Status.LeaderInfo response
+type LeaderResponse struct {
+	// Address is the RPC address of the leader, empty without a known
+	// leader
+	Address string
+
+	// ID is the Raft ID of the leader and Name its server name, which is
+	// empty if the leader isn't known to this server yet
+	ID   string
+	Name string
+
+	// KnownLeader is set if the server knows of a cluster leader
+	KnownLeader bool
+}
+
+// PingResponse is used for the Status.Ping response. It only describes the
+// server that answered, which never forwards a ping.
+type PingResponse struct {
+	// RaftState is the Raft state of the server: Leader, Follower,
+	// Candidate or Shutdown
+	RaftState string
+
+	// KnownLeader is set if the server knows of a cluster leader
+	KnownLeader bool
+
+	// Uptime is the time since the server was started
+	Uptime time.Duration
+
+	// AppliedIndex is the last index applied to the FSM
+	AppliedIndex uint64
+
+	// FSMApplied is set once the FSM applied a log entry or a snapshot
+	FSMApplied bool
+
+	// Maintenance is the maintenance mode of the cluster as the server
+	// knows it
+	Maintenance *MaintenanceMode
+}
+
+// FSMStatsResponse is used for the Status.FSMStats response. It describes
+// the FSM of the server that answered.
+type FSMStatsResponse struct {
+	// AppliedIndex is the last index applied to the FSM
+	AppliedIndex uint64
+
+	// Applied is the number of messages applied since the server started,
+	// keyed by message type. The entries of a batch are counted one by one.
+	Applied map[string]uint64
+}
+
+// MetricsUpdateRequest is used by clients to report the metrics of the
+// tasks they run
+type MetricsUpdateRequest struct {
+	Metrics []*TaskMetrics
+
+	WriteRequest
+}
+
+// JobMetricsRequest is used for the Status.JobMetrics request
+type JobMetricsRequest struct {
+	// JobID is the job to report, every job if empty
+	JobID string
+
+	QueryOptions
+}
+
+// JobMetricsResponse is used for the Status.JobMetrics response. Its index
+// is the one of the last metrics reported, which blocking queries wait on.
+type JobMetricsResponse struct {
+	Metrics []*JobMetrics
+
+	QueryMeta
+}
+
+// BatchRequest is used to apply several messages as a single Raft entry.
+// They are applied in order, and if one fails none of them is.
+type BatchRequest struct {
+	// Entries are messages encoded with Encode. They can't be batches.
+	Entries [][]byte
+
+	WriteRequest
+}
+
+// StreamingRPCHeader starts every streaming RPC. It names the method the
+// arguments that follow it are for.
+type StreamingRPCHeader struct {
+	Method string
+}
+
+// EventStreamRequest is used to subscribe to the changes of state store
+// tables through Event.Stream
+type EventStreamRequest struct {
+	// Tables lists the tables whose changes are pushed, e.g. "jobs"
+	Tables []string
+
+	QueryOptions
+}
+
+// EventStreamFrame is pushed on an event stream every time some of the
+// watched tables changed. The stream ends after a frame with an Error.
+type EventStreamFrame struct {
+	// Index is the highest index of the tables that changed
+	Index uint64
+
+	// Tables lists the tables that changed since the previous frame
+	Tables []string
+
+	// Error is set if the stream failed
+	Error string
+}
+
+// ListStreamFrame is sent by the streaming variants of the list RPCs, such
+// as Job.ListStream. Every frame is followed by Count items of the list,
+// until a frame with Done set carries the QueryMeta of the list. The
+// stream ends early after a frame with an Error.
+type ListStreamFrame struct {
+	Count int
+	Done  bool
+
+	// Error is set if the stream failed
+	Error string
+
+	QueryMeta
+}
+
+// ConnPoolStats describes the pooled RPC connection to a single server
+type ConnPoolStats struct {
+	Region string
+	Addr   string
+
+	// Pooled is set while a connection to the server is pooled
+	Pooled bool
+
+	// Active is the number of RPCs currently using the connection and
+	// Idle the number of streams kept open for reuse
+	Active int
+	Idle   int
+
+	// Created and Evicted count the connections opened to the server and
+	// removed from the pool, because they failed or sat idle too long
+	Created uint64
+	Evicted uint64
+}
+
+// ConnPoolResponse is used for the Status.ConnPool response
+type ConnPoolResponse struct {
+	// Pools is keyed by address, compressed connections being suffixed
+	// with "/compressed"
+	Pools map[string]*ConnPoolStats
+}
+
+// WatchesResponse is used for the Status.Watches response. It describes
+// the blocking queries the server that answered is serving, which a
+// client opening watches without consuming them piles up.
+type WatchesResponse struct {
+	// Count is the number of blocking queries being served
+	Count int
+
+	// ByTable counts them by what they watch, a table of the state store
+	// for most
+	ByTable map[string]int
+
+	// Ages counts them by age. The last bucket, whose Below is zero, holds
+	// the ones older than the others'.
+	Ages []*WatchAgeBucket
+
+	// Oldest lists the oldest ones, first to last, 20 at most
+	Oldest []*WatchInfo
+}
+
+// WatchAgeBucket counts the blocking queries younger than Below, and older
+// than the Below of the previous bucket
+type WatchAgeBucket struct {
+	Below time.Duration
+	Count int
+}
+
+// WatchInfo describes a blocking query being served
+type WatchInfo struct {
+	Table         string
+	MinQueryIndex uint64
+	Age           time.Duration
+}
+
 // msgpackHandle is a shared handle for encoding/decoding of structs
 var MsgpackHandle = func() *codec.MsgpackHandle {
 	h := &codec.MsgpackHandle{RawToString: true}
@@ -172,18 +750,81 @@ var HashiMsgpackHandle = func() *hcodec.MsgpackHandle {
 }()
 
 // Decode is used to decode a MsgPack encoded object
+// Buffers produced by Encode carry the schema version they were written
+// with, so messages can change shape between releases.
 func Decode(buf []byte, out interface{}) error {
-	return codec.NewDecoder(bytes.NewReader(buf), MsgpackHandle).Decode(out)
+	version, payload, err := splitSchemaVersion(buf)
+	if err != nil {
+		return err
+	}
+
+	switch version {
+	case LegacySchemaVersion, 1:
+		// Version 1 only added the header, the payload is unchanged
+		return codec.NewDecoder(bytes.NewReader(payload), MsgpackHandle).Decode(out)
+	default:
+		return ErrUnsupportedSchemaVersion
+	}
 }
 
-// Encode is used to encode a MsgPack object with type prefix
+// Encode is used to encode a MsgPack object with type prefix, followed by
+// the current schema version
 func Encode(t MessageType, msg interface{}) ([]byte, error) {
+	return EncodeVersion(t, SchemaVersion, msg)
+}
+
+// EncodeVersion is Encode writing schema version rather than the current
+// one, for readers not decoding it yet. The legacy version has no header.
+func EncodeVersion(t MessageType, version uint8, msg interface{}) ([]byte, error) {
 	var buf bytes.Buffer
 	buf.WriteByte(uint8(t))
+	if version != LegacySchemaVersion {
+		buf.WriteByte(schemaVersionMarker)
+		buf.WriteByte(version)
+	}
 	err := codec.NewEncoder(&buf, MsgpackHandle).Encode(msg)
 	return buf.Bytes(), err
 }
 
+const (
+	// SchemaVersion is the version of the message schema written by Encode.
+	// It must be bumped, and Decode taught to convert the previous version,
+	// whenever a message changes in an incompatible way.
+	SchemaVersion uint8 = 1
+
+	// LegacySchemaVersion is the version of messages written before the
+	// schema was versioned
+	LegacySchemaVersion uint8 = 0
+
+	// schemaVersionMarker starts the version header. It is a byte msgpack
+	// never uses, so it can't be mistaken for the start of a legacy payload.
+	schemaVersionMarker byte = 0xc1
+)
+
+// CheckSchemaVersion returns an error if buf, stripped of its message type,
+// was encoded with a schema version this node doesn't know.
+func CheckSchemaVersion(buf []byte) error {
+	version, _, err := splitSchemaVersion(buf)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return ErrUnsupportedSchemaVersion
+	}
+	return nil
+}
+
+// splitSchemaVersion returns the schema version of buf and its payload
+func splitSchemaVersion(buf []byte) (uint8, []byte, error) {
+	if len(buf) == 0 || buf[0] != schemaVersionMarker {
+		return LegacySchemaVersion, buf, nil
+	}
+	if len(buf) < 2 {
+		return 0, nil, fmt.Errorf("truncated schema version header")
+	}
+	return buf[1], buf[2:], nil
+}
+
 // RecoverableError wraps an error and marks whether it is recoverable and could
 // be retried or it is fatal.
 type RecoverableError struct {
@@ -257,8 +898,23 @@ type RaftServer struct {
 	// it's a non-voting server, which will be added in a future release of
 	// Udup.
 	Voter bool
+
+	// Suffrage is the voting status of the server: "voter", "nonvoter"
+	// or "staging".
+	Suffrage string
+
+	// Datacenter is the datacenter of the server, or empty if the server
+	// isn't a known peer.
+	Datacenter string
 }
 
+// Suffrage values of a RaftServer
+const (
+	RaftSuffrageVoter    = "voter"
+	RaftSuffrageNonvoter = "nonvoter"
+	RaftSuffrageStaging  = "staging"
+)
+
 // RaftConfigrationResponse is returned when querying for the current Raft
 // configuration.
 type RaftConfigurationResponse struct {
@@ -269,6 +925,39 @@ type RaftConfigurationResponse struct {
 	Index uint64
 }
 
+// LeadershipTransferRequest is used by the Operator endpoint to hand the
+// leadership to another voter.
+type LeadershipTransferRequest struct {
+	// ID is the voter to hand the leadership to. If it is empty, the live
+	// voter the least behind the leader is picked.
+	ID raft.ServerID
+
+	// Reason is logged along with the transfer.
+	Reason string
+
+	// WriteRequest holds the Region for this request.
+	WriteRequest
+}
+
+// LeadershipTransferResponse is returned once another voter won the
+// leadership.
+type LeadershipTransferResponse struct {
+	// OldLeader and NewLeader are the Raft addresses of the leader before
+	// and after the transfer.
+	OldLeader raft.ServerAddress
+	NewLeader raft.ServerAddress
+}
+
+// RaftPeerByIDRequest is used by the Operator endpoint to apply a Raft
+// operation on a specific Raft peer by ID.
+type RaftPeerByIDRequest struct {
+	// ID is the peer to apply the operation on.
+	ID raft.ServerID
+
+	// WriteRequest holds the Region for this request.
+	WriteRequest
+}
+
 // RaftPeerByAddressRequest is used by the Operator endpoint to apply a Raft
 // operation on a specific Raft peer by address in the form of "IP:port".
 type RaftPeerByAddressRequest struct {
@@ -294,3 +983,321 @@ type RaftRemovePeerRequest struct {
 	// WriteRequest holds the ACL token to go along with this request.
 	WriteRequest
 }
+
+// RaftRemovePeerResponse is returned once a Raft peer was removed
+type RaftRemovePeerResponse struct {
+	// Index is the Raft index of the configuration without the peer
+	Index uint64
+}
+
+// WarmCacheResponse is returned by Operator.WarmCache
+type WarmCacheResponse struct {
+	// Digest is the number of connections the leader has pooled to other
+	// servers, and Warmed the number of those the server has pooled
+	Digest int
+	Warmed int
+}
+
+// Events of the Notification the servers POST to their webhooks
+const (
+	// NotificationEventJob is a job going from one status to another
+	NotificationEventJob = "job"
+	// NotificationEventLeadership is a server acquiring or losing the
+	// leadership of the cluster
+	NotificationEventLeadership = "leadership"
+	// NotificationEventTest is sent by Operator.TestWebhook
+	NotificationEventTest = "test"
+)
+
+// Notification is the JSON body the servers POST to their webhooks
+type Notification struct {
+	// Event is one of the NotificationEvent values
+	Event string
+	// JobID is the job of a job event. OldState and NewState are the
+	// status of the job, or "leader" and "follower" for a leadership
+	// event.
+	JobID    string `json:",omitempty"`
+	OldState string
+	NewState string
+	// NodeID is the node the event happened on: the node of the last
+	// allocation of the job that changed, empty if it has none, or the
+	// name of the server whose leadership changed
+	NodeID string
+	// Server is the name of the server sending the notification
+	Server    string
+	Timestamp time.Time
+}
+
+// WebhookTestRequest is used by Operator.TestWebhook to send a test
+// notification to the webhooks of the leader
+type WebhookTestRequest struct {
+	WriteRequest
+}
+
+// WebhookTestResponse is returned by Operator.TestWebhook
+type WebhookTestResponse struct {
+	// Results are those of the webhooks, in order
+	Results []*WebhookResult
+}
+
+// WebhookResult is the result of POSTing a notification to a webhook
+type WebhookResult struct {
+	URL string
+	// Error is why the webhook didn't take the notification, empty if it
+	// did
+	Error string
+}
+
+// RaftSnapshotRequest is used by the Operator endpoint to force the leader
+// to take a Raft snapshot.
+type RaftSnapshotRequest struct {
+	WriteRequest
+}
+
+// RaftSnapshotResponse is returned once the snapshot was taken
+type RaftSnapshotResponse struct {
+	// Index is the last Raft index included in the snapshot
+	Index uint64
+}
+
+// StateExportVersion is the version of the format of the state exports
+// streamed by Operator.StateExport
+const StateExportVersion = 1
+
+// StateExportTables are the tables of the state store in a state export,
+// in the order they are exported
+var StateExportTables = []string{"nodes", "jobs", "orders", "evals", "allocs"}
+
+// StateExportRequest is used by Operator.StateExport to export the state
+// store of the server serving it
+type StateExportRequest struct {
+	QueryOptions
+}
+
+// StateExportFrame is sent by Operator.StateExport. A state export is a
+// msgpack stream of frames, each followed by Count items of its Table: a
+// Node for "nodes", a Job for "jobs", an Order for "orders", an Evaluation
+// for "evals" and an Allocation for "allocs". The first frame, which has
+// no items, carries the Version of the format and the Index of the state
+// exported. The tables come in the order of StateExportTables, and the
+// export ends with a frame with Done set, or early after a frame with an
+// Error.
+type StateExportFrame struct {
+	Version int
+	Index   uint64
+	Region  string
+
+	Table string
+	Count int
+	Done  bool
+
+	// Error is set if the export failed
+	Error string
+}
+
+// StateExport holds the items of a state export, by table
+type StateExport struct {
+	Index  uint64
+	Region string
+
+	Nodes  []*Node
+	Jobs   []*Job
+	Orders []*Order
+	Evals  []*Evaluation
+	Allocs []*Allocation
+}
+
+// StateImportRequest is used by Operator.StateImport to restore the jobs
+// and orders of a state export into a cluster that has none
+type StateImportRequest struct {
+	Jobs   []*Job
+	Orders []*Order
+
+	WriteRequest
+}
+
+// StateImportApplyRequest is a chunk of a state import, applied as a
+// single Raft entry. The first chunk is refused unless the cluster has no
+// jobs or orders, the others if any of their jobs or orders exists, so that
+// an import never overwrites what the cluster has.
+type StateImportApplyRequest struct {
+	Jobs   []*Job
+	Orders []*Order
+	// First is set on the first chunk of the import
+	First bool
+
+	// Evals schedule the jobs of the chunk that were pending or running,
+	// committed along with them
+	Evals []*Evaluation
+
+	WriteRequest
+}
+
+// StateImportResponse is returned once a state export was imported
+type StateImportResponse struct {
+	// Jobs and Orders count the ones imported, and Evals the evaluations
+	// created to schedule the jobs that were pending or running
+	Jobs   int
+	Orders int
+	Evals  int
+
+	// Chunks is the number of Raft entries the import was applied in, and
+	// Index the Raft index of the last one
+	Chunks int
+	Index  uint64
+}
+
+// ReadStateExport reads the state export streamed by Operator.StateExport
+// from r
+func ReadStateExport(r io.Reader) (*StateExport, error) {
+	dec := hcodec.NewDecoder(r, HashiMsgpackHandle)
+	var frame StateExportFrame
+	if err := dec.Decode(&frame); err != nil {
+		return nil, err
+	}
+	if frame.Error != "" {
+		return nil, fmt.Errorf("state export failed: %s", frame.Error)
+	}
+	if frame.Version != StateExportVersion {
+		return nil, fmt.Errorf("unsupported state export version %d, want %d", frame.Version, StateExportVersion)
+	}
+	export := &StateExport{Index: frame.Index, Region: frame.Region}
+
+	for {
+		frame = StateExportFrame{}
+		if err := dec.Decode(&frame); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if frame.Error != "" {
+			return nil, fmt.Errorf("state export failed: %s", frame.Error)
+		}
+		if frame.Done {
+			return export, nil
+		}
+		for i := 0; i < frame.Count; i++ {
+			var err error
+			switch frame.Table {
+			case "nodes":
+				node := new(Node)
+				err = dec.Decode(node)
+				export.Nodes = append(export.Nodes, node)
+			case "jobs":
+				job := new(Job)
+				err = dec.Decode(job)
+				export.Jobs = append(export.Jobs, job)
+			case "orders":
+				order := new(Order)
+				err = dec.Decode(order)
+				export.Orders = append(export.Orders, order)
+			case "evals":
+				eval := new(Evaluation)
+				err = dec.Decode(eval)
+				export.Evals = append(export.Evals, eval)
+			case "allocs":
+				alloc := new(Allocation)
+				err = dec.Decode(alloc)
+				export.Allocs = append(export.Allocs, alloc)
+			default:
+				return nil, fmt.Errorf("unknown table %q in state export", frame.Table)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// LogLevelRequest is used by Operator.SetLogLevel to change the level a
+// server, and the client of its agent, log at, without a restart
+type LogLevelRequest struct {
+	// Level is the level to log at, as the log_level option, or empty to
+	// log the Component or JobID at the level of the others again
+	Level string
+
+	// Component, as in "server.rpc", or JobID restrict the change to the
+	// entries of a component or of a job. With neither, the level of the
+	// entries matching no override changes.
+	Component string
+	JobID     string
+
+	// AllServers makes the server serving the request relay it to the
+	// other servers of the region. It doesn't reach the agents running
+	// only a client.
+	AllServers bool
+
+	WriteRequest
+}
+
+// LogLevelResponse is returned by Operator.SetLogLevel
+type LogLevelResponse struct {
+	// Agents holds the levels of the agents the change reached, by name
+	Agents map[string]*AgentLogLevels
+}
+
+// AgentLogLevels are the levels an agent logs at once it changed them, or
+// the Error it failed with
+type AgentLogLevels struct {
+	// Levels come first for all the entries, then the overrides by
+	// component and by job
+	Levels []*LogLevel
+	Error  string
+}
+
+// LogLevel is the level the entries of a component or of a job, or all of
+// them if it has neither, are logged at
+type LogLevel struct {
+	Component string
+	JobID     string
+	Level     string
+}
+
+// MaintenanceMode is the state of the cluster-wide maintenance mode. While
+// it is enabled the jobs are paused, and none can be registered or resumed.
+type MaintenanceMode struct {
+	Enabled bool
+	Reason  string
+
+	// Since is when the cluster entered the maintenance mode
+	Since time.Time
+
+	// Jobs are the jobs paused when entering the maintenance mode, which
+	// are resumed when leaving it
+	Jobs []string
+
+	ModifyIndex uint64
+}
+
+// MaintenanceModeRequest is used by Operator.MaintenanceMode to enter or
+// leave the maintenance mode
+type MaintenanceModeRequest struct {
+	Enabled bool
+	Reason  string
+
+	// Since and Jobs are set by the leader, for every server to apply the
+	// same
+	Since time.Time
+	Jobs  []string
+
+	// Evals pause or resume the allocations of Jobs. They are committed
+	// along with the change, so that no job is left paused while its
+	// allocations keep running.
+	Evals []*Evaluation
+
+	WriteRequest
+}
+
+// MaintenanceModeResponse is returned by Operator.MaintenanceMode
+type MaintenanceModeResponse struct {
+	// Maintenance is the maintenance mode once changed
+	Maintenance *MaintenanceMode
+
+	// Jobs are the jobs the change paused or resumed
+	Jobs []string
+
+	// Index is the Raft index of the change and of the evaluations pausing
+	// or resuming the jobs
+	Index uint64
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// encodeLegacy encodes msg the way Encode did before schema versioning
+func encodeLegacy(t MessageType, msg interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(uint8(t))
+	err := codec.NewEncoder(&buf, MsgpackHandle).Encode(msg)
+	return buf.Bytes(), err
+}
+
+func TestDecode_SchemaVersions(t *testing.T) {
+	req := &JobDeregisterRequest{
+		JobID:        "job",
+		WriteRequest: WriteRequest{Region: "global", RequestID: "request"},
+	}
+	current, err := Encode(JobDeregisterRequestType, req)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	legacy, err := encodeLegacy(JobDeregisterRequestType, req)
+	if err != nil {
+		t.Fatalf("encodeLegacy() error = %v", err)
+	}
+	future := append([]byte{current[0], schemaVersionMarker, SchemaVersion + 1}, current[3:]...)
+
+	tests := []struct {
+		name    string
+		buf     []byte
+		wantErr error
+	}{
+		{"current", current, nil},
+		{"legacy", legacy, nil},
+		{"future", future, ErrUnsupportedSchemaVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckSchemaVersion(tt.buf[1:]); err != tt.wantErr {
+				t.Fatalf("CheckSchemaVersion() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var out JobDeregisterRequest
+			err := Decode(tt.buf[1:], &out)
+			if err != tt.wantErr {
+				t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(&out, req) {
+				t.Errorf("Decode() = %#v, want %#v", &out, req)
+			}
+		})
+	}
+}
+
+func TestEncodeVersion_Legacy(t *testing.T) {
+	req := &JobDeregisterRequest{
+		JobID:        "job",
+		WriteRequest: WriteRequest{Region: "global", RequestID: "request"},
+	}
+	buf, err := EncodeVersion(JobDeregisterRequestType, LegacySchemaVersion, req)
+	if err != nil {
+		t.Fatalf("EncodeVersion() error = %v", err)
+	}
+	legacy, err := encodeLegacy(JobDeregisterRequestType, req)
+	if err != nil {
+		t.Fatalf("encodeLegacy() error = %v", err)
+	}
+	if !bytes.Equal(buf, legacy) {
+		t.Errorf("EncodeVersion() = %x, want %x", buf, legacy)
+	}
+
+	// A server predating the schema version decodes it as it always did
+	var out JobDeregisterRequest
+	if err := codec.NewDecoder(bytes.NewReader(buf[1:]), MsgpackHandle).Decode(&out); err != nil {
+		t.Fatalf("legacy Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(&out, req) {
+		t.Errorf("legacy Decode() = %#v, want %#v", &out, req)
+	}
+}
+
+func TestMessageType_MinSchemaVersion(t *testing.T) {
+	tests := []struct {
+		msgType MessageType
+		want    uint8
+	}{
+		{JobRegisterRequestType, LegacySchemaVersion},
+		{BatchRequestType, 1},
+		{BatchRequestType | IgnoreUnknownTypeFlag, 1},
+		{JobConfigUpdateRequestType, 1},
+		{JobCancelRequestType, 1},
+		{MaintenanceModeRequestType, 1},
+		{StateImportRequestType, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.msgType.MinSchemaVersion(); got != tt.want {
+			t.Errorf("%v.MinSchemaVersion() = %v, want %v", tt.msgType, got, tt.want)
+		}
+	}
+}
+
+func TestSetRequestTimeout(t *testing.T) {
+	before := time.Now()
+	tests := []struct {
+		name     string
+		args     interface{}
+		deadline func(args interface{}) time.Time
+		min, max time.Duration
+	}{
+		{"write", &JobRegisterRequest{},
+			func(args interface{}) time.Time { return args.(*JobRegisterRequest).Deadline },
+			time.Minute, time.Minute + time.Second},
+		{"query", &JobSpecificRequest{},
+			func(args interface{}) time.Time { return args.(*JobSpecificRequest).Deadline },
+			time.Minute, time.Minute + time.Second},
+		{"blocking query", &JobSpecificRequest{QueryOptions: QueryOptions{MinQueryIndex: 5, MaxQueryTime: 16 * time.Second}},
+			func(args interface{}) time.Time { return args.(*JobSpecificRequest).Deadline },
+			time.Minute + 17*time.Second, time.Minute + 18*time.Second},
+		{"blocking query without a wait", &JobSpecificRequest{QueryOptions: QueryOptions{MinQueryIndex: 5}},
+			func(args interface{}) time.Time { return args.(*JobSpecificRequest).Deadline },
+			time.Minute + MaxQueryTime, time.Minute + MaxQueryTime + MaxQueryTime/16 + time.Second},
+		{"deadline set", &JobRegisterRequest{WriteRequest: WriteRequest{Deadline: before.Add(time.Hour)}},
+			func(args interface{}) time.Time { return args.(*JobRegisterRequest).Deadline },
+			time.Hour, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetRequestTimeout(tt.args, time.Minute)
+			got := tt.deadline(tt.args).Sub(before)
+			if got < tt.min || got > tt.max {
+				t.Errorf("SetRequestTimeout() deadline in %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+
+	// Requests without a deadline are left alone
+	SetRequestTimeout(&struct{}{}, time.Minute)
+}
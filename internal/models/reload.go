@@ -0,0 +1,137 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ReloadableConfig are the fields of the configuration of the tasks, by
+// type, that running tasks reload without restarting. Only the where
+// predicates of the tables of ReplicateDoDb can be reloaded.
+var ReloadableConfig = map[string][]string{
+	TaskTypeSrc:  {"ReplicateDoDb"},
+	TaskTypeDest: {"ThrottleBytesPerSecond", "ThrottleRowsPerSecond", "ParallelWorkers"},
+}
+
+// runtimeConfig are the fields of the configuration the tasks record as
+// they run, or the agent sets, rather than the user
+var runtimeConfig = map[string]bool{
+	"Gtid":                 true,
+	"NatsAddr":             true,
+	"DumpCheckpoint":       true,
+	"TrafficAgainstLimits": true,
+}
+
+// ConfigChanges returns the fields that differ between the configurations
+// from and to of a task of type taskType, in order. It fails if a field that
+// can't be reloaded differs, the job then has to be created again.
+func ConfigChanges(taskType string, from, to map[string]interface{}) ([]string, error) {
+	keys := make(map[string]bool)
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+
+	var changed []string
+	for k := range keys {
+		if runtimeConfig[k] {
+			continue
+		}
+		same, err := sameConfigValue(from[k], to[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		if same {
+			continue
+		}
+		if !reloadable(taskType, k) {
+			return nil, fmt.Errorf("%s of task %s can't be reloaded: create the job again to change it", k, taskType)
+		}
+		if k == "ReplicateDoDb" {
+			same, err := sameConfigValue(withoutWhere(from[k]), withoutWhere(to[k]))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+			if !same {
+				return nil, fmt.Errorf("only the where predicates of the tables of ReplicateDoDb can be reloaded: create the job again to change the tables")
+			}
+		}
+		changed = append(changed, k)
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func reloadable(taskType, key string) bool {
+	for _, k := range ReloadableConfig[taskType] {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sameConfigValue compares values of configurations by their JSON, as those
+// decoded from requests and from the state differ in types
+func sameConfigValue(a, b interface{}) (bool, error) {
+	na, err := normalizeConfigValue(a)
+	if err != nil {
+		return false, err
+	}
+	nb, err := normalizeConfigValue(b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(na, nb), nil
+}
+
+func normalizeConfigValue(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var n interface{}
+	if err := json.Unmarshal(bs, &n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// withoutWhere returns the value of ReplicateDoDb with the where predicates
+// of its tables dropped
+func withoutWhere(doDb interface{}) interface{} {
+	n, err := normalizeConfigValue(doDb)
+	if err != nil {
+		return doDb
+	}
+	dbs, ok := n.([]interface{})
+	if !ok {
+		return n
+	}
+	for _, db := range dbs {
+		dbMap, ok := db.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		tables, _ := dbMap["Tables"].([]interface{})
+		for _, tb := range tables {
+			if tbMap, ok := tb.(map[string]interface{}); ok {
+				delete(tbMap, "Where")
+			}
+		}
+	}
+	return dbs
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigChanges(t *testing.T) {
+	doDb := func(where string) []interface{} {
+		return []interface{}{map[string]interface{}{
+			"TableSchema": "db",
+			"Tables":      []interface{}{map[string]interface{}{"TableName": "t1", "Where": where}},
+		}}
+	}
+	dest := map[string]interface{}{
+		"ParallelWorkers":  int64(1),
+		"ConnectionConfig": map[string]interface{}{"Host": "10.0.0.1", "Port": int64(3306)},
+		"Gtid":             "applied",
+	}
+
+	tests := []struct {
+		name     string
+		taskType string
+		from, to map[string]interface{}
+		want     []string
+		wantErr  bool
+	}{
+		{"unchanged", TaskTypeDest, dest,
+			map[string]interface{}{
+				"ParallelWorkers":  1.0,
+				"ConnectionConfig": map[string]interface{}{"Host": "10.0.0.1", "Port": 3306},
+			}, nil, false},
+		{"reloadable", TaskTypeDest, dest,
+			map[string]interface{}{
+				"ParallelWorkers":       8,
+				"ThrottleRowsPerSecond": 1000,
+				"ConnectionConfig":      map[string]interface{}{"Host": "10.0.0.1", "Port": 3306},
+			}, []string{"ParallelWorkers", "ThrottleRowsPerSecond"}, false},
+		{"connection", TaskTypeDest, dest,
+			map[string]interface{}{
+				"ParallelWorkers":  1,
+				"ConnectionConfig": map[string]interface{}{"Host": "10.0.0.2", "Port": 3306},
+			}, nil, true},
+		{"not reloadable by the task", TaskTypeSrc,
+			map[string]interface{}{"ParallelWorkers": 1},
+			map[string]interface{}{"ParallelWorkers": 2}, nil, true},
+		{"gtid start", TaskTypeSrc,
+			map[string]interface{}{"GtidStart": ""},
+			map[string]interface{}{"GtidStart": "00000000-0000-0000-0000-000000000001:1-10"}, nil, true},
+		{"where", TaskTypeSrc,
+			map[string]interface{}{"ReplicateDoDb": doDb("true")},
+			map[string]interface{}{"ReplicateDoDb": doDb("id > 10")}, []string{"ReplicateDoDb"}, false},
+		{"tables", TaskTypeSrc,
+			map[string]interface{}{"ReplicateDoDb": doDb("true")},
+			map[string]interface{}{"ReplicateDoDb": []interface{}{}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConfigChanges(tt.taskType, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigChanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConfigChanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
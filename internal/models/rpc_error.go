@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RPCErrorCode identifies the cause of an RPC error so clients can act on
+// it without matching its message. Codes are sent over the wire: never
+// renumber them, only add new ones.
+type RPCErrorCode int
+
+const (
+	ErrCodeUnknown                  RPCErrorCode = 0
+	ErrCodeNoLeader                 RPCErrorCode = 1
+	ErrCodeNoRegionPath             RPCErrorCode = 2
+	ErrCodeInvalidPageToken         RPCErrorCode = 3
+	ErrCodeRaftEntryTooLarge        RPCErrorCode = 4
+	ErrCodeReadIndexTimeout         RPCErrorCode = 5
+	ErrCodeUnsupportedSchemaVersion RPCErrorCode = 6
+	ErrCodeSnapshotInProgress       RPCErrorCode = 7
+	ErrCodeQueryCancelled           RPCErrorCode = 8
+	ErrCodeRateLimited              RPCErrorCode = 9
+	ErrCodeRemoveLeader             RPCErrorCode = 10
+	ErrCodeRemovePeerQuorum         RPCErrorCode = 11
+	ErrCodeFrameCorrupt             RPCErrorCode = 12
+	ErrCodePermissionDenied         RPCErrorCode = 13
+	ErrCodeDeadlineExceeded         RPCErrorCode = 14
+	ErrCodeForwardFailed            RPCErrorCode = 15
+	ErrCodeInvalidRequest           RPCErrorCode = 16
+	ErrCodeServerOverloaded         RPCErrorCode = 17
+	ErrCodeMaintenanceMode          RPCErrorCode = 18
+	ErrCodeServersNotUpgraded       RPCErrorCode = 19
+)
+
+// rpcErrorPrefix starts the message of every RPCError, followed by its
+// code, so the code survives net/rpc, which only sends error messages
+const rpcErrorPrefix = "rpc error "
+
+// Retryable returns whether a request that failed with the code may
+// succeed if it is sent again unchanged, possibly after backing off
+func (c RPCErrorCode) Retryable() bool {
+	switch c {
+	case ErrCodeNoLeader, ErrCodeNoRegionPath, ErrCodeReadIndexTimeout, ErrCodeSnapshotInProgress,
+		ErrCodeRateLimited, ErrCodeFrameCorrupt, ErrCodeForwardFailed, ErrCodeServerOverloaded:
+		return true
+	}
+	return false
+}
+
+// RPCError is an error carrying a stable code next to its message
+type RPCError struct {
+	Code    RPCErrorCode
+	Message string
+}
+
+// NewRPCError returns an RPCError of code with a message formatted like
+// fmt.Errorf does
+func NewRPCError(code RPCErrorCode, format string, args ...interface{}) error {
+	return &RPCError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *RPCError) Error() string {
+	return rpcErrorPrefix + strconv.Itoa(int(e.Code)) + ": " + e.Message
+}
+
+// ErrorCode returns the code of err, which is either an RPCError or the
+// error an RPC client got for one. Other errors are ErrCodeUnknown.
+func ErrorCode(err error) RPCErrorCode {
+	if err == nil {
+		return ErrCodeUnknown
+	}
+	if e, ok := err.(*RPCError); ok {
+		return e.Code
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, rpcErrorPrefix) {
+		return ErrCodeUnknown
+	}
+	msg = msg[len(rpcErrorPrefix):]
+	end := strings.IndexByte(msg, ':')
+	if end < 0 {
+		return ErrCodeUnknown
+	}
+	code, err := strconv.Atoi(msg[:end])
+	if err != nil {
+		return ErrCodeUnknown
+	}
+	return RPCErrorCode(code)
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want RPCErrorCode
+	}{
+		{"nil", nil, ErrCodeUnknown},
+		{"sentinel", ErrNoLeader, ErrCodeNoLeader},
+		{"received over RPC", rpc.ServerError(ErrPermissionDenied.Error()), ErrCodePermissionDenied},
+		{"formatted", NewRPCError(ErrCodeInvalidRequest, "missing %s", "region"), ErrCodeInvalidRequest},
+		{"uncoded", errors.New("job not found"), ErrCodeUnknown},
+		{"wrapped", fmt.Errorf("apply failed: %v", ErrRaftEntryTooLarge), ErrCodeUnknown},
+		{"malformed", errors.New("rpc error x: boom"), ErrCodeUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorCode(tt.err); got != tt.want {
+				t.Errorf("ErrorCode(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRPCErrorCode_Retryable(t *testing.T) {
+	if !ErrorCode(ErrNoLeader).Retryable() {
+		t.Errorf("ErrNoLeader isn't retryable")
+	}
+	if ErrorCode(ErrPermissionDenied).Retryable() {
+		t.Errorf("ErrPermissionDenied is retryable")
+	}
+}
@@ -13,6 +13,7 @@ import (
 const (
 	StageFinishedReadingOneBinlogSwitchingToNextBinlog = "Finished reading one binlog; switching to next binlog"
 	StageMasterHasSentAllBinlogToSlave                 = "Master has sent all binlog to slave; waiting for more updates"
+	StagePaused                                        = "Paused"
 	StageRegisteringSlaveOnMaster                      = "Registering slave on master"
 	StageRequestingBinlogDump                          = "Requesting binlog dump"
 	StageSearchingRowsForUpdate                        = "Searching rows for update"
@@ -30,9 +31,19 @@ type TableStats struct {
 	DelCount    int64
 }
 
+// DelayCount tells how far the applier is behind the source
 type DelayCount struct {
-	Num  uint64
+	// Num is the number of transactions waiting to be applied
+	Num uint64
+	// Time is the lag of the last applied transaction in seconds, 0 when
+	// nothing is waiting
 	Time uint64
+	// LagSeconds is the age of the last heartbeat the applier applied, 0
+	// without heartbeats
+	LagSeconds float64
+	// ThrottledSeconds is the time the applier spent waiting for its
+	// throttle
+	ThrottledSeconds float64
 }
 
 type ThroughputStat struct {
@@ -53,6 +64,15 @@ type BufferStat struct {
 	ApplierGroupTxQueueSize int
 	SendByTimeout           int
 	SendBySizeFull          int
+
+	// BinlogBufferEntries and BinlogBufferBytes are the transactions the
+	// extractor read from the binlog and didn't send to the applier yet.
+	// BinlogBufferFill is how full their buffer is, in percent, and
+	// BinlogPausedSeconds how long reading the binlog paused as it was full.
+	BinlogBufferEntries int
+	BinlogBufferBytes   int64
+	BinlogBufferFill    float64
+	BinlogPausedSeconds float64
 }
 
 type CurrentCoordinates struct {
@@ -81,9 +101,156 @@ type TaskStatistics struct {
 	MsgStat            gonats.Statistics
 	BufferStat         BufferStat
 	Stage              string
-	Timestamp          int64
+	// RowsApplied and BytesApplied are what the applier wrote to the
+	// target, copied rows and replicated ones together
+	RowsApplied  int64
+	BytesApplied int64
+	// LastAppliedGtid is the GTID of the last transaction the applier
+	// committed
+	LastAppliedGtid string
+	// BinlogReconnects is how many times the extractor tried to connect
+	// the binlog stream again after the connection to the source broke
+	BinlogReconnects int64
+	// BinlogFailovers is how many times the extractor failed over to
+	// another server to stream the binlog from
+	BinlogFailovers int64
+	Timestamp       int64
+	// SlowTransactions is how many transactions the applier took longer
+	// than SlowTransactionMilliseconds to apply
+	SlowTransactions int64
+	// BatchStatements is how many statements the applier wrote batches of
+	// rows with, and BatchedRows how many rows they held: batching saved
+	// BatchedRows - BatchStatements round trips to the target
+	BatchStatements int64
+	BatchedRows     int64
+	// DroppedRows is how many row events the applier dropped, as their
+	// tables don't replicate their operation
+	DroppedRows int64
+	// SkippedErrors is how many statements the applier skipped, as they
+	// failed with one of SkipErrors
+	SkippedErrors int64
+	// Connections is how busy the connections of the applier to the target
+	// are
+	Connections *ConnectionStat
+	// Dump is how much the extractor sent of the copy, nil without one
+	Dump *DumpStat
+	// ParallelWorkers is how many workers the applier applies with
+	ParallelWorkers int
+}
+
+// DumpStat is what the extractor sent of the copy of the tables
+type DumpStat struct {
+	// Compressed tells whether the rows were compressed on their way to
+	// the applier
+	Compressed bool
+	// Bytes is the size of the rows sent, and WireBytes the size they
+	// were sent as
+	Bytes     int64
+	WireBytes int64
+	// Seconds is how long the copy took, or has taken while it runs
+	Seconds float64
+
+	// Tables is how far the copy of each table is. RowsCopied adds up
+	// their rows copied and RowsEstimate their estimates, of which
+	// ProgressPct is the percentage copied. The estimate of a table may be
+	// unknown, then RowsEstimateUnknown is set and ProgressPct is 0.
+	Tables              []*TableProgress
+	RowsCopied          int64
+	RowsEstimate        int64
+	RowsEstimateUnknown bool
+	ProgressPct         float64
+}
+
+// Values of TableProgress.EstimateSource, where the estimate of the rows
+// of a table comes from
+const (
+	// RowsEstimateStatistics is the number of rows of the statistics of
+	// the source, the estimate until the table is counted
+	RowsEstimateStatistics = "statistics"
+	// RowsEstimateCount is the exact count of the rows to copy
+	RowsEstimateCount = "count"
+	// RowsEstimateCopied is the rows copied, once they all are
+	RowsEstimateCopied = "copied"
+)
+
+// TableProgress is how far the copy of a table is
+type TableProgress struct {
+	TableSchema string
+	TableName   string
+	RowsCopied  int64
+	// RowsEstimate is how many rows the table has, as EstimateSource
+	// tells, -1 and an empty EstimateSource if it is not known. Then
+	// ProgressPct is 0.
+	RowsEstimate   int64
+	EstimateSource string
+	ProgressPct    float64
+	// Ranges is how many ranges of its key the table is copied in, in
+	// parallel, and RangesCopied how many of them are. Both are 0 if it is
+	// copied with a single connection.
+	Ranges       int
+	RangesCopied int
+}
+
+// ConnectionStat is how the applier uses its connections to the target
+type ConnectionStat struct {
+	// Target is the host:port of the target
+	Target string
+	// Open is how many connections the applier has open, Workers how many
+	// of them its workers share and WorkersInUse how many of those apply a
+	// transaction. WaitSeconds is how long the workers waited for a free
+	// one in all.
+	Open         int
+	Workers      int
+	WorkersInUse int
+	WaitSeconds  float64
 }
 
 type AllocStatistics struct {
 	Tasks map[string]*TaskStatistics
 }
+
+// TaskMetrics is how a task of a job is doing, as the client running it
+// reports it to the servers
+type TaskMetrics struct {
+	JobID    string
+	AllocID  string
+	TaskType string
+
+	RowsApplied     int64
+	BytesApplied    int64
+	LagSeconds      float64
+	LastAppliedGtid string
+	// ErrorCount is how many times the task failed since the client
+	// started it
+	ErrorCount int64
+	// RowsCopied is how many rows the copy of the tables sent, out of
+	// RowsEstimate, unless RowsEstimateUnknown
+	RowsCopied          int64
+	RowsEstimate        int64
+	RowsEstimateUnknown bool
+}
+
+// JobMetrics is how a job is doing, from the metrics its tasks last
+// reported
+type JobMetrics struct {
+	JobID string
+
+	// RowsApplied, BytesApplied and ErrorCount add up the ones of the
+	// tasks, LagSeconds is the largest lag of the tasks
+	RowsApplied     int64
+	BytesApplied    int64
+	LagSeconds      float64
+	LastAppliedGtid string
+	ErrorCount      int64
+
+	// RowsCopied is how many rows the copy of the tables sent, out of
+	// RowsEstimate. ProgressPct is the percentage copied, -1 while the
+	// estimate of a table is not known.
+	RowsCopied   int64
+	RowsEstimate int64
+	ProgressPct  float64
+
+	// UpdateTime is when a task of the job last reported, in unix
+	// nanoseconds
+	UpdateTime int64
+}
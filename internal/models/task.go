@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"runtime/debug"
 	"strings"
 	"time"
 
@@ -219,6 +220,30 @@ const (
 
 	// TaskLeaderDead indicates that the leader task within the has finished.
 	TaskLeaderDead = "Leader Task Dead"
+
+	// TaskPaused indicates that the task stopped its work, without being
+	// torn down, as its job was paused.
+	TaskPaused = "Paused"
+
+	// TaskResumed indicates that the task went on with its work from where
+	// it was paused.
+	TaskResumed = "Resumed"
+
+	// TaskReloaded indicates that the task reloaded the fields of its
+	// configuration the message names, without restarting.
+	TaskReloaded = "Reloaded"
+
+	// TaskCircuitBreakerTripped indicates that the task failed too often
+	// and paused its job. The message tells the errors.
+	TaskCircuitBreakerTripped = "Circuit Breaker Tripped"
+
+	// TaskDriverMessage is an informational event message emitted by
+	// drivers such as when they skip or rewrite a statement.
+	TaskDriverMessage = "Driver"
+
+	// TaskPanicked indicates that a goroutine of the task panicked. The task
+	// alone terminated, the message holds the stack trace of the panic.
+	TaskPanicked = "Panicked"
 )
 
 // TaskEvent is an event that effects the state of a task and contains meta-data
@@ -383,10 +408,167 @@ func (e *TaskEvent) SetDriverMessage(m string) *TaskEvent {
 	return e
 }
 
+// The severities of task events, from the lowest
+const (
+	TaskEventSeverityInfo    = "info"
+	TaskEventSeverityWarning = "warning"
+	TaskEventSeverityError   = "error"
+)
+
+// taskEventSeverities orders the severities
+var taskEventSeverities = map[string]int{
+	TaskEventSeverityInfo:    0,
+	TaskEventSeverityWarning: 1,
+	TaskEventSeverityError:   2,
+}
+
+// Severity returns how bad the event is: an error if it fails the task or
+// tells an error, a warning if it stops or restarts the task.
+func (e *TaskEvent) Severity() string {
+	if e.FailsTask || e.SetupError != "" || e.DriverError != "" || e.KillError != "" {
+		return TaskEventSeverityError
+	}
+	switch e.Type {
+	case TaskSetupFailure, TaskDriverFailure, TaskNotRestarting, TaskPanicked:
+		return TaskEventSeverityError
+	case TaskKilled, TaskRestarting, TaskSiblingFailed, TaskLeaderDead, TaskCircuitBreakerTripped:
+		return TaskEventSeverityWarning
+	case TaskTerminated:
+		if e.ExitCode != 0 {
+			return TaskEventSeverityWarning
+		}
+	}
+	return TaskEventSeverityInfo
+}
+
+// DefaultJobEventsRetention is the number of events kept for each job by
+// default
+const DefaultJobEventsRetention = 100
+
+// JobEvent is an event of a task of a job, as the servers keep it
+type JobEvent struct {
+	AllocID  string
+	NodeID   string
+	TaskName string
+	Severity string
+	Event    *TaskEvent
+
+	// Index is the Raft index of the update of the allocation reporting
+	// the event
+	Index uint64
+}
+
+// JobEvents are the last events of the tasks of a job, the oldest first
+type JobEvents struct {
+	JobID  string
+	Events []*JobEvent
+
+	CreateIndex uint64
+	ModifyIndex uint64
+}
+
+// JobEventsRequest is used for Job.Events, to get the events of a job
+// matching its filters
+type JobEventsRequest struct {
+	JobID string
+
+	// Severity is the lowest severity of the events, all if empty
+	Severity string
+	// Types are the types of the events, all if empty
+	Types []string
+	// Since and Until bound the time of the events, if not zero
+	Since time.Time
+	Until time.Time
+
+	QueryOptions
+}
+
+// Validate returns an error if the filters are invalid
+func (r *JobEventsRequest) Validate() error {
+	if r.JobID == "" {
+		return fmt.Errorf("missing job ID")
+	}
+	if _, ok := taskEventSeverities[r.Severity]; r.Severity != "" && !ok {
+		return fmt.Errorf("invalid severity %q, want one of %s, %s or %s", r.Severity,
+			TaskEventSeverityInfo, TaskEventSeverityWarning, TaskEventSeverityError)
+	}
+	if !r.Since.IsZero() && !r.Until.IsZero() && r.Until.Before(r.Since) {
+		return fmt.Errorf("until %v is before since %v", r.Until, r.Since)
+	}
+	return nil
+}
+
+// Matches returns whether the event passes the filters
+func (r *JobEventsRequest) Matches(e *JobEvent) bool {
+	if r.Severity != "" && taskEventSeverities[e.Severity] < taskEventSeverities[r.Severity] {
+		return false
+	}
+	if len(r.Types) > 0 {
+		found := false
+		for _, tp := range r.Types {
+			found = found || strings.EqualFold(tp, e.Event.Type)
+		}
+		if !found {
+			return false
+		}
+	}
+	if !r.Since.IsZero() && e.Event.Time.Before(r.Since) {
+		return false
+	}
+	return r.Until.IsZero() || !e.Event.Time.After(r.Until)
+}
+
+// JobEventsResponse is used to return the events of a job, the oldest
+// first
+type JobEventsResponse struct {
+	Events []*JobEvent
+	QueryMeta
+}
+
 type TaskUpdate struct {
 	JobID    string
 	Gtid     string
 	NatsAddr string
+	// DumpCheckpoint is how far the full copy went, while it runs
+	DumpCheckpoint *DumpCheckpoint
+	// SealedDumpCheckpoint is DumpCheckpoint sealed by the keyring of the
+	// servers, which set it instead before applying the update
+	SealedDumpCheckpoint string
+
+	// Pause asks for the job to be paused, as the circuit breaker of a
+	// task tripped
+	Pause bool
+}
+
+// DumpCheckpoint is how far the full copy of a job went, for a restart to
+// resume it rather than copy everything again
+type DumpCheckpoint struct {
+	// Gtid is the GTID set of the snapshot the copy started at, where the
+	// binlog is streamed from once it completes
+	Gtid string
+	// Tables are the tables whose rows were copied, in order
+	Tables []*TableCheckpoint
+}
+
+// TableCheckpoint is how far the copy of the rows of a table went
+type TableCheckpoint struct {
+	TableSchema string
+	TableName   string
+	// LastMaxVals is the primary key of the last row copied, as SQL literals
+	LastMaxVals []string
+	// Done tells all the rows of the table were copied
+	Done bool
+}
+
+// Table returns the checkpoint of the table, nil if none of its rows was
+// copied
+func (c *DumpCheckpoint) Table(schema, table string) *TableCheckpoint {
+	for _, tc := range c.Tables {
+		if tc.TableSchema == schema && tc.TableName == table {
+			return tc
+		}
+	}
+	return nil
 }
 
 const (
@@ -420,3 +602,21 @@ func (r *WaitResult) String() string {
 	return fmt.Sprintf("Wait returned exit code %v, and error %v",
 		r.ExitCode, r.Err)
 }
+
+// PanicError is the error of a task a goroutine of which panicked
+type PanicError struct {
+	Value interface{}
+	// Stack is the stack trace of the goroutine when it panicked
+	Stack string
+}
+
+// NewPanicError returns the error of the panic of value. It must be called
+// by the function recovering it, for the stack trace to show where the
+// goroutine panicked.
+func NewPanicError(value interface{}) *PanicError {
+	return &PanicError{Value: value, Stack: string(debug.Stack())}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", e.Value, e.Stack)
+}
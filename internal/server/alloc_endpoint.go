@@ -7,10 +7,12 @@
 package server
 
 import (
+	"context"
 	"time"
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-memdb"
+	"github.com/hashicorp/go-msgpack/codec"
 
 	"github.com/actiontech/dtle/internal/models"
 	"github.com/actiontech/dtle/internal/server/store"
@@ -32,6 +34,7 @@ func (a *Alloc) List(args *models.AllocListRequest, reply *models.AllocListRespo
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "allocs",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Capture all the allocations
 			var err error
@@ -45,9 +48,16 @@ func (a *Alloc) List(args *models.AllocListRequest, reply *models.AllocListRespo
 				return err
 			}
 
+			pager, err := newPaginator(iter, &args.QueryOptions, func(raw interface{}) string {
+				return raw.(*models.Allocation).ID
+			})
+			if err != nil {
+				return err
+			}
+
 			var allocs []*models.AllocListStub
 			for {
-				raw := iter.Next()
+				raw := pager.Next()
 				if raw == nil {
 					break
 				}
@@ -62,6 +72,7 @@ func (a *Alloc) List(args *models.AllocListRequest, reply *models.AllocListRespo
 				return err
 			}
 			reply.Index = index
+			pager.setMeta(&reply.QueryMeta, index)
 
 			// Set the query response
 			a.srv.setQueryMeta(&reply.QueryMeta)
@@ -70,6 +81,30 @@ func (a *Alloc) List(args *models.AllocListRequest, reply *models.AllocListRespo
 	return a.srv.blockingRPC(&opts)
 }
 
+// ListStream is the streaming variant of List, sending the stubs of the
+// allocations as they are iterated instead of in a single reply
+func (a *Alloc) ListStream(ctx context.Context, args *models.AllocListRequest, enc *codec.Encoder) error {
+	return a.srv.streamList(ctx, "Alloc.ListStream", &args.QueryOptions, "allocs", enc,
+		func(state *store.StateStore, l *listStreamer) error {
+			var err error
+			var iter memdb.ResultIterator
+			if prefix := args.QueryOptions.Prefix; prefix != "" {
+				iter, err = state.AllocsByIDPrefix(nil, prefix)
+			} else {
+				iter, err = state.Allocs(nil)
+			}
+			if err != nil {
+				return err
+			}
+			for raw := iter.Next(); raw != nil; raw = iter.Next() {
+				if err := l.add(raw.(*models.Allocation).Stub()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+}
+
 // GetAlloc is used to lookup a particular allocation
 func (a *Alloc) GetAlloc(args *models.AllocSpecificRequest,
 	reply *models.SingleAllocResponse) error {
@@ -82,6 +117,7 @@ func (a *Alloc) GetAlloc(args *models.AllocSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "allocs",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Lookup the allocation
 			out, err := state.AllocByID(ws, args.AllocID)
@@ -125,6 +161,7 @@ func (a *Alloc) GetAllocs(args *models.AllocsGetRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "allocs",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Lookup the allocation
 			thresholdMet := false
@@ -8,7 +8,6 @@ package server
 
 import (
 	"reflect"
-	"sync"
 	"testing"
 	"time"
 	"github.com/actiontech/dtle/internal/models"
@@ -39,7 +38,6 @@ func TestBlockedEvals_Enabled(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -62,7 +60,6 @@ func TestBlockedEvals_Enabled(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -84,7 +81,6 @@ func TestBlockedEvals_SetEnabled(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -110,7 +106,6 @@ func TestBlockedEvals_SetEnabled(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -130,7 +125,6 @@ func TestBlockedEvals_Block(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -156,7 +150,6 @@ func TestBlockedEvals_Block(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -176,7 +169,6 @@ func TestBlockedEvals_Reblock(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -203,7 +195,6 @@ func TestBlockedEvals_Reblock(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -223,7 +214,6 @@ func TestBlockedEvals_processBlock(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -250,7 +240,6 @@ func TestBlockedEvals_processBlock(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -270,7 +259,6 @@ func TestBlockedEvals_missedUnblock(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -297,7 +285,6 @@ func TestBlockedEvals_missedUnblock(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -319,7 +306,6 @@ func TestBlockedEvals_Untrack(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -345,7 +331,6 @@ func TestBlockedEvals_Untrack(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -365,7 +350,6 @@ func TestBlockedEvals_Unblock(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -392,7 +376,6 @@ func TestBlockedEvals_Unblock(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -412,7 +395,6 @@ func TestBlockedEvals_watchCapacity(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -434,7 +416,6 @@ func TestBlockedEvals_watchCapacity(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -454,7 +435,6 @@ func TestBlockedEvals_unblock(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -481,7 +461,6 @@ func TestBlockedEvals_unblock(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -501,7 +480,6 @@ func TestBlockedEvals_UnblockFailed(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -523,7 +501,6 @@ func TestBlockedEvals_UnblockFailed(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -543,7 +520,6 @@ func TestBlockedEvals_GetDuplicates(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -570,7 +546,6 @@ func TestBlockedEvals_GetDuplicates(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -592,7 +567,6 @@ func TestBlockedEvals_Flush(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -614,7 +588,6 @@ func TestBlockedEvals_Flush(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -634,7 +607,6 @@ func TestBlockedEvals_Stats(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -657,7 +629,6 @@ func TestBlockedEvals_Stats(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -679,7 +650,6 @@ func TestBlockedEvals_EmitStats(t *testing.T) {
 		evalBroker       *EvalBroker
 		enabled          bool
 		stats            *BlockedStats
-		l                sync.RWMutex
 		captured         map[string]wrappedEval
 		escaped          map[string]wrappedEval
 		capacityChangeCh chan *capacityUpdate
@@ -706,7 +676,6 @@ func TestBlockedEvals_EmitStats(t *testing.T) {
 				evalBroker:       tt.fields.evalBroker,
 				enabled:          tt.fields.enabled,
 				stats:            tt.fields.stats,
-				l:                tt.fields.l,
 				captured:         tt.fields.captured,
 				escaped:          tt.fields.escaped,
 				capacityChangeCh: tt.fields.capacityChangeCh,
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/armon/go-metrics"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// checksumHeaderSize is the payload length plus its CRC32
+const checksumHeaderSize = 8
+
+// checksumConn wraps a net.Conn so that every write is sent as a frame
+// carrying the length and the CRC32 of its payload. A frame is only handed
+// to the reader once its checksum matched, so a corrupted request fails
+// with models.ErrFrameCorrupt rather than somewhere in the decoder. Both
+// ends of the connection must wrap it.
+type checksumConn struct {
+	net.Conn
+
+	reader  *bufio.Reader
+	pending []byte
+	header  [checksumHeaderSize]byte
+
+	// err is returned by every read once a frame was found corrupt, since
+	// the stream can't be resynchronized
+	err error
+
+	writeLock sync.Mutex
+}
+
+// newChecksumConn returns a checksumConn around conn
+func newChecksumConn(conn net.Conn) *checksumConn {
+	return &checksumConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// Read returns the payload of checked frames, reading a new frame when the
+// previous one has been fully consumed.
+func (c *checksumConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		if err := c.readFrame(); err != nil {
+			if err == models.ErrFrameCorrupt {
+				c.err = err
+				metrics.IncrCounter([]string{"server", "rpc", "corrupt_frame"}, 1)
+			}
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// readFrame reads the next frame into the pending buffer if its checksum
+// matches
+func (c *checksumConn) readFrame() error {
+	if _, err := io.ReadFull(c.reader, c.header[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(c.header[:4])
+	if size > maxFrameSize {
+		return models.ErrFrameCorrupt
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, buf); err != nil {
+		return err
+	}
+	if crc32.ChecksumIEEE(buf) != binary.BigEndian.Uint32(c.header[4:]) {
+		return models.ErrFrameCorrupt
+	}
+	c.pending = buf
+	return nil
+}
+
+// Write sends p as a single frame
+func (c *checksumConn) Write(p []byte) (int, error) {
+	frame := make([]byte, checksumHeaderSize+len(p))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(p)))
+	binary.BigEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(p))
+	copy(frame[checksumHeaderSize:], p)
+
+	c.writeLock.Lock()
+	_, err := c.Conn.Write(frame)
+	c.writeLock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
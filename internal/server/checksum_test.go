@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// bufferConn is a net.Conn reading and writing an in-memory buffer
+type bufferConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *bufferConn) Read(p []byte) (int, error)  { return c.buf.Read(p) }
+func (c *bufferConn) Write(p []byte) (int, error) { return c.buf.Write(p) }
+
+func Test_checksumConn_RoundTrip(t *testing.T) {
+	conn := &bufferConn{}
+	w := newChecksumConn(conn)
+	payloads := [][]byte{[]byte("ping"), bytes.Repeat([]byte("dtle"), 4096)}
+	for _, payload := range payloads {
+		if _, err := w.Write(payload); err != nil {
+			t.Fatalf("checksumConn.Write() error = %v", err)
+		}
+	}
+
+	got, err := ioutil.ReadAll(newChecksumConn(conn))
+	if err != nil {
+		t.Fatalf("checksumConn.Read() error = %v", err)
+	}
+	if want := bytes.Join(payloads, nil); !bytes.Equal(got, want) {
+		t.Errorf("checksumConn.Read() returned %d bytes, want %d", len(got), len(want))
+	}
+}
+
+// Flipping any byte of the checksum or of the payload, or the high bits of
+// the length, must be reported as a corrupt frame
+func Test_checksumConn_FaultInjection(t *testing.T) {
+	frame := &bufferConn{}
+	if _, err := newChecksumConn(frame).Write([]byte("a request that crossed a flaky link")); err != nil {
+		t.Fatalf("checksumConn.Write() error = %v", err)
+	}
+	clean := frame.buf.Bytes()
+
+	for offset := 0; offset < len(clean); offset++ {
+		if offset > 0 && offset < 4 {
+			// Smaller lengths are caught by the checksum, larger ones
+			// just wait for more data
+			continue
+		}
+		conn := &bufferConn{}
+		conn.buf.Write(clean)
+		conn.buf.Bytes()[offset] ^= 0x80
+
+		_, err := ioutil.ReadAll(newChecksumConn(conn))
+		if err != models.ErrFrameCorrupt {
+			t.Errorf("byte %d flipped: checksumConn.Read() error = %v, want %v", offset, err, models.ErrFrameCorrupt)
+		}
+	}
+}
+
+func Test_checksumConn_Codec(t *testing.T) {
+	conn := &bufferConn{}
+	client := NewClientCodec(newChecksumConn(conn))
+	req := &rpc.Request{ServiceMethod: "Status.Ping", Seq: 1}
+	if err := client.WriteRequest(req, struct{}{}); err != nil {
+		t.Fatalf("WriteRequest() error = %v", err)
+	}
+	conn.buf.Bytes()[conn.buf.Len()-1] ^= 0xff
+
+	var got rpc.Request
+	server := NewServerCodec(newChecksumConn(conn))
+	if err := server.ReadRequestHeader(&got); err == nil {
+		t.Fatalf("ReadRequestHeader() decoded a corrupt frame: %+v", got)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+const (
+	// circuitFailureThreshold is the default number of consecutive failures
+	// to an address within the failure window that opens its circuit
+	circuitFailureThreshold = 5
+
+	// circuitFailureWindow is how close the failures opening a circuit
+	// must be by default. Older failures are forgotten.
+	circuitFailureWindow = time.Minute
+
+	// circuitCooldown is how long an open circuit refuses calls by default
+	// before a single probe is let through
+	circuitCooldown = 30 * time.Second
+)
+
+// circuit tracks the recent failures of a single address
+type circuit struct {
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+
+	// probing is set while the call probing a circuit whose cooldown
+	// elapsed is in flight
+	probing bool
+}
+
+// tripped returns whether the circuit refuses calls at now, ignoring the
+// probe
+func (b *circuitBreaker) tripped(c *circuit, now time.Time) bool {
+	return c.failures >= b.threshold && now.Sub(c.openedAt) < b.cooldown
+}
+
+// circuitBreaker refuses calls to the addresses that kept failing, for a
+// cooldown period after which a single call probes whether the address is
+// back.
+type circuitBreaker struct {
+	circuits map[string]*circuit
+	l        sync.Mutex
+
+	// threshold failures within window open a circuit, which then
+	// refuses calls for cooldown
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+}
+
+// newCircuitBreaker returns a breaker with every circuit closed, and the
+// default thresholds
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		circuits:  make(map[string]*circuit),
+		threshold: circuitFailureThreshold,
+		window:    circuitFailureWindow,
+		cooldown:  circuitCooldown,
+	}
+}
+
+// setThresholds changes the thresholds of the breaker, the zero ones
+// being left as they are. The circuits already open stay open.
+func (b *circuitBreaker) setThresholds(threshold int, window, cooldown time.Duration) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if threshold > 0 {
+		b.threshold = threshold
+	}
+	if window > 0 {
+		b.window = window
+	}
+	if cooldown > 0 {
+		b.cooldown = cooldown
+	}
+}
+
+// allow returns whether a call to addr may be made. Once the cooldown of
+// an open circuit elapsed, only the first caller is allowed through to
+// probe the address.
+func (b *circuitBreaker) allow(addr string) bool {
+	b.l.Lock()
+	defer b.l.Unlock()
+	c, ok := b.circuits[addr]
+	if !ok || c.failures < b.threshold {
+		return true
+	}
+	if b.tripped(c, time.Now()) || c.probing {
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+// isOpen returns whether calls to addr are currently refused
+func (b *circuitBreaker) isOpen(addr string) bool {
+	b.l.Lock()
+	defer b.l.Unlock()
+	c, ok := b.circuits[addr]
+	if !ok {
+		return false
+	}
+	return b.tripped(c, time.Now()) || c.probing
+}
+
+// success closes the circuit of addr
+func (b *circuitBreaker) success(addr string) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	c, ok := b.circuits[addr]
+	if !ok {
+		return
+	}
+	if c.failures >= b.threshold {
+		metrics.SetGauge([]string{"server", "rpc", "circuit_open", addr}, 0)
+	}
+	delete(b.circuits, addr)
+}
+
+// failure records a failed call to addr, opening its circuit once the
+// threshold is reached. A failed probe opens the circuit again.
+func (b *circuitBreaker) failure(addr string) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	now := time.Now()
+	c, ok := b.circuits[addr]
+	if !ok {
+		c = &circuit{}
+		b.circuits[addr] = c
+	}
+
+	if c.probing {
+		c.probing = false
+		c.openedAt = now
+		return
+	}
+	if c.failures < b.threshold && now.Sub(c.firstFailure) > b.window {
+		c.failures = 0
+		c.firstFailure = now
+	}
+	c.failures++
+	if c.failures == b.threshold {
+		c.openedAt = now
+		metrics.IncrCounter([]string{"server", "rpc", "circuit_tripped"}, 1)
+		metrics.SetGauge([]string{"server", "rpc", "circuit_open", addr}, 1)
+	}
+}
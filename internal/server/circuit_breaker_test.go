@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_circuitBreaker(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		expire    bool
+		wantAllow bool
+	}{
+		{"closed", 0, false, true},
+		{"below threshold", circuitFailureThreshold - 1, false, true},
+		{"open", circuitFailureThreshold, false, false},
+		{"cooldown elapsed", circuitFailureThreshold, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker()
+			for i := 0; i < tt.failures; i++ {
+				b.failure("a")
+			}
+			if tt.expire {
+				b.circuits["a"].openedAt = time.Now().Add(-circuitCooldown)
+			}
+			if got := b.allow("a"); got != tt.wantAllow {
+				t.Errorf("circuitBreaker.allow() = %v, want %v", got, tt.wantAllow)
+			}
+			if !b.allow("b") {
+				t.Errorf("circuitBreaker.allow() refused an address that never failed")
+			}
+		})
+	}
+}
+
+func Test_circuitBreaker_Probe(t *testing.T) {
+	b := newCircuitBreaker()
+	for i := 0; i < circuitFailureThreshold; i++ {
+		b.failure("a")
+	}
+	b.circuits["a"].openedAt = time.Now().Add(-circuitCooldown)
+
+	// Only one probe goes through, a failed probe opens the circuit again
+	if !b.allow("a") || b.allow("a") {
+		t.Fatalf("circuitBreaker.allow() didn't let exactly one probe through")
+	}
+	b.failure("a")
+	if b.allow("a") || !b.isOpen("a") {
+		t.Fatalf("circuitBreaker.allow() let a call through after a failed probe")
+	}
+
+	// A successful probe closes it
+	b.circuits["a"].openedAt = time.Now().Add(-circuitCooldown)
+	if !b.allow("a") {
+		t.Fatalf("circuitBreaker.allow() refused the probe")
+	}
+	b.success("a")
+	if !b.allow("a") || !b.allow("a") || b.isOpen("a") {
+		t.Errorf("circuitBreaker.allow() refused calls after a successful probe")
+	}
+}
+
+func Test_circuitBreaker_setThresholds(t *testing.T) {
+	b := newCircuitBreaker()
+	b.setThresholds(2, 0, time.Hour)
+	if b.window != circuitFailureWindow {
+		t.Errorf("circuitBreaker.setThresholds() changed the window to %v", b.window)
+	}
+	b.failure("a")
+	if !b.allow("a") {
+		t.Fatalf("circuitBreaker.allow() refused a call below the threshold")
+	}
+	b.failure("a")
+	if b.allow("a") {
+		t.Fatalf("circuitBreaker.allow() let a call through at the threshold")
+	}
+
+	// The default cooldown elapsed, not the configured one
+	b.circuits["a"].openedAt = time.Now().Add(-circuitCooldown)
+	if b.allow("a") {
+		t.Errorf("circuitBreaker.allow() probed before the configured cooldown")
+	}
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/armon/go-metrics"
+	"github.com/golang/snappy"
+)
+
+const (
+	// frameRaw marks a frame whose payload is sent as is
+	frameRaw byte = 0x00
+
+	// frameSnappy marks a frame whose payload is snappy compressed
+	frameSnappy byte = 0x01
+
+	// frameHeaderSize is the flag byte plus the payload length
+	frameHeaderSize = 5
+
+	// maxFrameSize bounds the size of a single decoded frame so a corrupt
+	// length can't make us allocate arbitrary amounts of memory.
+	maxFrameSize = 64 * 1024 * 1024
+
+	// defaultCompressionThreshold is the payload size below which we don't
+	// bother compressing.
+	defaultCompressionThreshold = 1024
+)
+
+// compressedConn wraps a net.Conn so that every write is sent as a frame
+// which is snappy compressed when it is at least threshold bytes long.
+// Both ends of the connection must wrap it.
+type compressedConn struct {
+	net.Conn
+
+	threshold int
+
+	reader  *bufio.Reader
+	pending []byte
+	header  [frameHeaderSize]byte
+
+	writeLock sync.Mutex
+}
+
+// newCompressedConn returns a compressedConn around conn. A threshold of
+// zero or less uses the default threshold.
+func newCompressedConn(conn net.Conn, threshold int) *compressedConn {
+	if threshold <= 0 {
+		threshold = defaultCompressionThreshold
+	}
+	return &compressedConn{
+		Conn:      conn,
+		threshold: threshold,
+		reader:    bufio.NewReader(conn),
+	}
+}
+
+// Read returns decoded bytes, reading a new frame when the previous one
+// has been fully consumed.
+func (c *compressedConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if err := c.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// readFrame reads and decodes the next frame into the pending buffer
+func (c *compressedConn) readFrame() error {
+	if _, err := io.ReadFull(c.reader, c.header[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(c.header[1:])
+	if size > maxFrameSize {
+		return fmt.Errorf("compressed frame too large: %d bytes", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, buf); err != nil {
+		return err
+	}
+
+	switch c.header[0] {
+	case frameRaw:
+		c.pending = buf
+	case frameSnappy:
+		decoded, err := snappy.Decode(nil, buf)
+		if err != nil {
+			return fmt.Errorf("failed to decompress frame: %v", err)
+		}
+		c.pending = decoded
+	default:
+		return fmt.Errorf("unknown compressed frame type: %v", c.header[0])
+	}
+	return nil
+}
+
+// Write sends p as a single frame, compressing it if it is large enough
+// and compression actually saves space.
+func (c *compressedConn) Write(p []byte) (int, error) {
+	flag := frameRaw
+	payload := p
+	if len(p) >= c.threshold {
+		if encoded := snappy.Encode(nil, p); len(encoded) < len(p) {
+			flag = frameSnappy
+			payload = encoded
+		}
+	}
+
+	frame := make([]byte, frameHeaderSize+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	copy(frame[frameHeaderSize:], payload)
+
+	c.writeLock.Lock()
+	_, err := c.Conn.Write(frame)
+	c.writeLock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if flag == frameSnappy {
+		metrics.IncrCounter([]string{"server", "rpc", "compression", "compressed_bytes"}, float32(len(p)))
+		metrics.IncrCounter([]string{"server", "rpc", "compression", "wire_bytes"}, float32(len(payload)))
+	} else {
+		metrics.IncrCounter([]string{"server", "rpc", "compression", "uncompressed_bytes"}, float32(len(p)))
+	}
+	return len(p), nil
+}
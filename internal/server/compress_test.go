@@ -0,0 +1,53 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func Test_compressedConn_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		payload   []byte
+	}{
+		{"small payload", 1024, []byte("ping")},
+		{"large payload", 1024, bytes.Repeat([]byte("dtle"), 4096)},
+		{"default threshold", 0, bytes.Repeat([]byte{0x01}, 2048)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			w := newCompressedConn(client, tt.threshold)
+			r := newCompressedConn(server, tt.threshold)
+
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := w.Write(tt.payload)
+				errCh <- err
+			}()
+
+			got := make([]byte, len(tt.payload))
+			if _, err := io.ReadFull(r, got); err != nil {
+				t.Fatalf("compressedConn.Read() error = %v", err)
+			}
+			if err := <-errCh; err != nil {
+				t.Fatalf("compressedConn.Write() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.payload) {
+				t.Errorf("compressedConn round trip = %d bytes, want %d bytes", len(got), len(tt.payload))
+			}
+		})
+	}
+}
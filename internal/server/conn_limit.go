@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// connLimiter tracks the number of open RPC connections, both in total and
+// per source IP, and refuses new ones above the configured limits. A limit
+// of zero means unlimited.
+type connLimiter struct {
+	maxConns      int
+	maxConnsPerIP int
+
+	total int
+	perIP map[string]int
+	l     sync.Mutex
+}
+
+// newConnLimiter returns a limiter for the given limits
+func newConnLimiter(maxConns, maxConnsPerIP int) *connLimiter {
+	return &connLimiter{
+		maxConns:      maxConns,
+		maxConnsPerIP: maxConnsPerIP,
+		perIP:         make(map[string]int),
+	}
+}
+
+// connIP returns the IP a connection originates from
+func connIP(conn net.Conn) string {
+	addr := conn.RemoteAddr()
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// acquire accounts for a new connection. If a limit would be exceeded an
+// error is returned and nothing is recorded. Otherwise the returned conn
+// must be used in place of conn so that closing it releases the slot.
+func (l *connLimiter) acquire(conn net.Conn) (net.Conn, error) {
+	ip := connIP(conn)
+
+	l.l.Lock()
+	defer l.l.Unlock()
+	if l.maxConns > 0 && l.total >= l.maxConns {
+		return nil, fmt.Errorf("connection limit of %d reached", l.maxConns)
+	}
+	if l.maxConnsPerIP > 0 && l.perIP[ip] >= l.maxConnsPerIP {
+		return nil, fmt.Errorf("connection limit of %d reached for %s", l.maxConnsPerIP, ip)
+	}
+	l.total++
+	l.perIP[ip]++
+
+	return &limitedConn{Conn: conn, release: func() { l.release(ip) }}, nil
+}
+
+// release frees the slot held by a connection from ip
+func (l *connLimiter) release(ip string) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// limitedConn releases its slot in the connLimiter the first time it is
+// closed, no matter which handler ends up owning it.
+type limitedConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
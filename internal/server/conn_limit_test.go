@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func Test_connLimiter_acquire(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxConns      int
+		maxConnsPerIP int
+		open          int
+		wantAccepted  int
+	}{
+		{"unlimited", 0, 0, 5, 5},
+		{"global limit", 3, 0, 5, 3},
+		{"per ip limit", 0, 2, 5, 2},
+		{"both limits", 4, 2, 5, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newConnLimiter(tt.maxConns, tt.maxConnsPerIP)
+			var accepted []net.Conn
+			for i := 0; i < tt.open; i++ {
+				c1, c2 := net.Pipe()
+				defer c2.Close()
+				conn, err := l.acquire(c1)
+				if err != nil {
+					c1.Close()
+					continue
+				}
+				accepted = append(accepted, conn)
+			}
+			if len(accepted) != tt.wantAccepted {
+				t.Fatalf("connLimiter.acquire() accepted %d, want %d", len(accepted), tt.wantAccepted)
+			}
+
+			// Closing a connection twice must only release one slot
+			for _, conn := range accepted {
+				conn.Close()
+				conn.Close()
+			}
+			if l.total != 0 || len(l.perIP) != 0 {
+				t.Errorf("connLimiter after close: total = %d, perIP = %v", l.total, l.perIP)
+			}
+		})
+	}
+}
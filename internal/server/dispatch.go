@@ -0,0 +1,191 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// highPriorityMethods are served at models.RPCPriorityHigh unless the
+// request asks for another priority, so a busy cluster can still be
+// managed and clients keep their heartbeats going. Entries are methods or
+// "Service.*".
+var highPriorityMethods = map[string]bool{
+	"Status.*":          true,
+	"Operator.*":        true,
+	"Node.UpdateStatus": true,
+}
+
+// prioritizer is implemented by requests that carry a priority
+type prioritizer interface {
+	RequestPriority() models.RPCPriority
+}
+
+// requestPriority returns the priority body is dispatched at when calling
+// method
+func requestPriority(method string, body interface{}) models.RPCPriority {
+	if req, ok := body.(prioritizer); ok && req.RequestPriority() != models.RPCPriorityNormal {
+		return req.RequestPriority()
+	}
+	if highPriorityMethods[method] {
+		return models.RPCPriorityHigh
+	}
+	if i := strings.IndexByte(method, '.'); i > 0 && highPriorityMethods[method[:i]+".*"] {
+		return models.RPCPriorityHigh
+	}
+	return models.RPCPriorityNormal
+}
+
+// dispatchWaiter is a request waiting for a slot
+type dispatchWaiter struct {
+	prio models.RPCPriority
+
+	// ch receives nil once the request got a slot, or the error it was
+	// shed with
+	ch chan error
+
+	// elem is the element of the waiter in its queue, nil once it left it
+	elem *list.Element
+}
+
+// rpcDispatcher bounds the number of RPCs served at once. Requests past the
+// limit wait in a bounded queue that serves the highest priority first.
+// Once the queue is full, a request displaces a waiter of lower priority,
+// the lowest first, or is shed itself.
+type rpcDispatcher struct {
+	maxConcurrent int
+	maxQueued     int
+
+	l       sync.Mutex
+	running int
+	queued  int
+
+	// queues holds the waiters of every priority in arrival order, indexed
+	// from RPCPriorityLow
+	queues [models.RPCPriorityHigh - models.RPCPriorityLow + 1]*list.List
+}
+
+// newRPCDispatcher returns a dispatcher serving up to maxConcurrent RPCs
+// with up to maxQueued waiting. It returns nil, which admits everything,
+// if maxConcurrent isn't positive.
+func newRPCDispatcher(maxConcurrent, maxQueued int) *rpcDispatcher {
+	if maxConcurrent <= 0 {
+		return nil
+	}
+	d := &rpcDispatcher{maxConcurrent: maxConcurrent, maxQueued: maxQueued}
+	for i := range d.queues {
+		d.queues[i] = list.New()
+	}
+	return d
+}
+
+// queue returns the queue of the waiters of prio, clamped to the known
+// priorities
+func (d *rpcDispatcher) queue(prio models.RPCPriority) *list.List {
+	if prio < models.RPCPriorityLow {
+		prio = models.RPCPriorityLow
+	} else if prio > models.RPCPriorityHigh {
+		prio = models.RPCPriorityHigh
+	}
+	return d.queues[prio-models.RPCPriorityLow]
+}
+
+// acquire waits for a slot to serve a request of priority prio. It fails
+// with models.ErrServerOverloaded if the request was shed, or with the
+// error of ctx if it was done first. The lock must not be held.
+func (d *rpcDispatcher) acquire(ctx context.Context, prio models.RPCPriority) error {
+	if d == nil {
+		return nil
+	}
+
+	d.l.Lock()
+	if d.running < d.maxConcurrent && d.queued == 0 {
+		d.running++
+		d.l.Unlock()
+		return nil
+	}
+	if d.queued >= d.maxQueued {
+		victim := d.lowestBelow(prio)
+		if victim == nil {
+			d.l.Unlock()
+			return models.ErrServerOverloaded
+		}
+		d.dequeue(victim)
+		victim.ch <- models.ErrServerOverloaded
+	}
+	w := &dispatchWaiter{prio: prio, ch: make(chan error, 1)}
+	w.elem = d.queue(prio).PushBack(w)
+	d.queued++
+	d.l.Unlock()
+
+	select {
+	case err := <-w.ch:
+		return err
+	case <-ctx.Done():
+	}
+
+	d.l.Lock()
+	if w.elem != nil {
+		d.dequeue(w)
+		d.l.Unlock()
+		return ctx.Err()
+	}
+	d.l.Unlock()
+
+	// The request got a slot or was shed at the same time
+	if err := <-w.ch; err != nil {
+		return err
+	}
+	d.release()
+	return ctx.Err()
+}
+
+// release frees the slot of a request that was served, handing it to the
+// next waiter if any
+func (d *rpcDispatcher) release() {
+	if d == nil {
+		return
+	}
+
+	d.l.Lock()
+	defer d.l.Unlock()
+	for i := len(d.queues) - 1; i >= 0; i-- {
+		if front := d.queues[i].Front(); front != nil {
+			w := front.Value.(*dispatchWaiter)
+			d.dequeue(w)
+			w.ch <- nil
+			return
+		}
+	}
+	d.running--
+}
+
+// lowestBelow returns the most recent waiter of the lowest priority below
+// prio, or nil. The lock must be held.
+func (d *rpcDispatcher) lowestBelow(prio models.RPCPriority) *dispatchWaiter {
+	for i := range d.queues {
+		if models.RPCPriority(i)+models.RPCPriorityLow >= prio {
+			return nil
+		}
+		if back := d.queues[i].Back(); back != nil {
+			return back.Value.(*dispatchWaiter)
+		}
+	}
+	return nil
+}
+
+// dequeue removes w from its queue. The lock must be held.
+func (d *rpcDispatcher) dequeue(w *dispatchWaiter) {
+	d.queue(w.prio).Remove(w.elem)
+	w.elem = nil
+	d.queued--
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func Test_requestPriority(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   interface{}
+		want   models.RPCPriority
+	}{
+		{"default", "Job.List", &models.JobListRequest{}, models.RPCPriorityNormal},
+		{"low priority query", "Job.List", &models.JobListRequest{QueryOptions: models.QueryOptions{Priority: models.RPCPriorityLow}}, models.RPCPriorityLow},
+		{"high priority write", "Job.Register", &models.JobRegisterRequest{WriteRequest: models.WriteRequest{Priority: models.RPCPriorityHigh}}, models.RPCPriorityHigh},
+		{"control plane service", "Operator.RaftGetConfiguration", &models.GenericRequest{}, models.RPCPriorityHigh},
+		{"request without options", "Status.Ping", &struct{}{}, models.RPCPriorityHigh},
+		{"heartbeat", "Node.UpdateStatus", &models.NodeUpdateStatusRequest{}, models.RPCPriorityHigh},
+		{"lowered control plane call", "Status.Peers", &models.GenericRequest{QueryOptions: models.QueryOptions{Priority: models.RPCPriorityLow}}, models.RPCPriorityLow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestPriority(tt.method, tt.body); got != tt.want {
+				t.Errorf("requestPriority() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// waitQueued waits for d to have n requests waiting
+func waitQueued(t *testing.T, d *rpcDispatcher, n int) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		d.l.Lock()
+		queued := d.queued
+		d.l.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rpcDispatcher has %d requests waiting, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func Test_rpcDispatcher(t *testing.T) {
+	d := newRPCDispatcher(1, 2)
+	if err := d.acquire(context.Background(), models.RPCPriorityNormal); err != nil {
+		t.Fatalf("rpcDispatcher.acquire() error = %v", err)
+	}
+
+	// Waiting requests report the order they were served in
+	served := make(chan string, 4)
+	wait := func(name string, prio models.RPCPriority) {
+		err := d.acquire(context.Background(), prio)
+		if err != nil {
+			served <- name + ": " + err.Error()
+			return
+		}
+		served <- name
+	}
+	go wait("low", models.RPCPriorityLow)
+	waitQueued(t, d, 1)
+	go wait("normal", models.RPCPriorityNormal)
+	waitQueued(t, d, 2)
+
+	// A full queue sheds the lowest priority for a higher one, and
+	// requests that can't displace anyone
+	go wait("high", models.RPCPriorityHigh)
+	if got, want := <-served, "low: "+models.ErrServerOverloaded.Error(); got != want {
+		t.Fatalf("rpcDispatcher served %q, want %q", got, want)
+	}
+	waitQueued(t, d, 2)
+	if err := d.acquire(context.Background(), models.RPCPriorityLow); err != models.ErrServerOverloaded {
+		t.Fatalf("rpcDispatcher.acquire() error = %v, want %v", err, models.ErrServerOverloaded)
+	}
+
+	// A request whose caller went away leaves the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	d.maxQueued = 3
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.acquire(ctx, models.RPCPriorityHigh) }()
+	waitQueued(t, d, 3)
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Fatalf("rpcDispatcher.acquire() error = %v, want %v", err, context.Canceled)
+	}
+	waitQueued(t, d, 2)
+
+	for _, want := range []string{"high", "normal"} {
+		d.release()
+		if got := <-served; got != want {
+			t.Fatalf("rpcDispatcher served %q, want %q", got, want)
+		}
+	}
+	d.release()
+	if d.running != 0 || d.queued != 0 {
+		t.Errorf("rpcDispatcher left %d running and %d queued", d.running, d.queued)
+	}
+}
+
+func TestServer_handleUdupConn_Shed(t *testing.T) {
+	s := &Server{
+		config:        &uconf.ServerConfig{},
+		logger:        ulog.New(ioutil.Discard, ulog.ErrorLevel),
+		rpcServer:     rpc.NewServer(),
+		rpcDrainer:    newRPCDrainer(),
+		rpcDispatcher: newRPCDispatcher(1, 0),
+		connPool:      NewPool(ioutil.Discard, time.Minute, 1, nil),
+		shutdownCh:    make(chan struct{}),
+	}
+	defer s.connPool.Shutdown()
+	s.rpcServer.Register(&Status{s})
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go s.handleUdupConn(context.Background(), c1)
+	client := rpc.NewClientWithCodec(NewClientCodec(c2))
+
+	// Another request holds the only slot
+	s.rpcDispatcher.acquire(context.Background(), models.RPCPriorityNormal)
+	var reply models.ConnPoolResponse
+	err := client.Call("Status.ConnPool", &models.GenericRequest{}, &reply)
+	if models.ErrorCode(err) != models.ErrCodeServerOverloaded {
+		t.Fatalf("Status.ConnPool error = %v, want %v", err, models.ErrServerOverloaded)
+	}
+
+	// The stream is still served once the slot is free
+	s.rpcDispatcher.release()
+	if err := client.Call("Status.ConnPool", &models.GenericRequest{}, &reply); err != nil {
+		t.Fatalf("Status.ConnPool error = %v", err)
+	}
+
+	// Requests end right after their reply is written
+	deadline := time.Now().Add(time.Second)
+	for s.rpcDrainer.activeRequests() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("rpcDrainer has %d requests in flight", s.rpcDrainer.activeRequests())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rpcDrainer tracks the RPC connections and in-flight requests of the
+// server so that shutdown can let the requests complete before closing
+// the connections under them.
+type rpcDrainer struct {
+	draining bool
+	conns    map[net.Conn]struct{}
+	l        sync.Mutex
+
+	// inflight counts the requests read but not yet answered. Requests
+	// are only added while not draining so Wait never races with Add.
+	inflight sync.WaitGroup
+
+	// active mirrors inflight as a number that can be read, it is
+	// accessed atomically
+	active int64
+}
+
+// newRPCDrainer returns a drainer with nothing tracked
+func newRPCDrainer() *rpcDrainer {
+	return &rpcDrainer{
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// trackConn registers an open connection. It returns false if the server
+// is draining, in which case the connection should be closed.
+func (d *rpcDrainer) trackConn(conn net.Conn) bool {
+	d.l.Lock()
+	defer d.l.Unlock()
+	if d.draining {
+		return false
+	}
+	d.conns[conn] = struct{}{}
+	return true
+}
+
+// untrackConn forgets a connection that was closed
+func (d *rpcDrainer) untrackConn(conn net.Conn) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	delete(d.conns, conn)
+}
+
+// startRequest registers an in-flight request. It returns false if the
+// server is draining, in which case the request must not be served.
+func (d *rpcDrainer) startRequest() bool {
+	d.l.Lock()
+	defer d.l.Unlock()
+	if d.draining {
+		return false
+	}
+	d.inflight.Add(1)
+	atomic.AddInt64(&d.active, 1)
+	return true
+}
+
+// endRequest is called once the reply of a request has been written
+func (d *rpcDrainer) endRequest() {
+	atomic.AddInt64(&d.active, -1)
+	d.inflight.Done()
+}
+
+// activeRequests returns the number of requests in flight
+func (d *rpcDrainer) activeRequests() int64 {
+	return atomic.LoadInt64(&d.active)
+}
+
+// drain stops accepting requests, waits up to timeout for the in-flight
+// ones to complete and then closes all the tracked connections. It
+// returns false if requests were still in flight when the connections
+// were closed.
+func (d *rpcDrainer) drain(timeout time.Duration) bool {
+	d.l.Lock()
+	d.draining = true
+	d.l.Unlock()
+
+	doneCh := make(chan struct{})
+	go func() {
+		d.inflight.Wait()
+		close(doneCh)
+	}()
+
+	completed := true
+	select {
+	case <-doneCh:
+	case <-time.After(timeout):
+		completed = false
+	}
+
+	d.l.Lock()
+	defer d.l.Unlock()
+	for conn := range d.conns {
+		conn.Close()
+	}
+	d.conns = make(map[net.Conn]struct{})
+	return completed
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_rpcDrainer_drain(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestTime   time.Duration
+		timeout       time.Duration
+		wantCompleted bool
+	}{
+		{"idle", 0, 100 * time.Millisecond, true},
+		{"request completes", 20 * time.Millisecond, time.Second, true},
+		{"request outlives timeout", time.Second, 20 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newRPCDrainer()
+			c1, c2 := net.Pipe()
+			defer c2.Close()
+			if !d.trackConn(c1) {
+				t.Fatalf("rpcDrainer.trackConn() refused a connection before draining")
+			}
+
+			if tt.requestTime > 0 {
+				if !d.startRequest() {
+					t.Fatalf("rpcDrainer.startRequest() refused a request before draining")
+				}
+				time.AfterFunc(tt.requestTime, d.endRequest)
+			}
+
+			if got := d.drain(tt.timeout); got != tt.wantCompleted {
+				t.Errorf("rpcDrainer.drain() = %v, want %v", got, tt.wantCompleted)
+			}
+
+			// The tracked connection is closed and nothing new is accepted
+			if _, err := c1.Write([]byte{0}); err == nil {
+				t.Errorf("tracked connection still open after drain")
+			}
+			if d.startRequest() {
+				t.Errorf("rpcDrainer.startRequest() accepted a request while draining")
+			}
+			if d.trackConn(c2) {
+				t.Errorf("rpcDrainer.trackConn() accepted a connection while draining")
+			}
+		})
+	}
+}
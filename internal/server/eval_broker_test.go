@@ -8,7 +8,6 @@ package server
 
 import (
 	"reflect"
-	"sync"
 	"testing"
 	"time"
 	"github.com/actiontech/dtle/internal/models"
@@ -55,7 +54,6 @@ func TestEvalBroker_Enabled(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	tests := []struct {
 		name   string
@@ -79,7 +77,6 @@ func TestEvalBroker_Enabled(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			if got := b.Enabled(); got != tt.want {
 				t.Errorf("EvalBroker.Enabled() = %v, want %v", got, tt.want)
@@ -102,7 +99,6 @@ func TestEvalBroker_SetEnabled(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		enabled bool
@@ -129,7 +125,6 @@ func TestEvalBroker_SetEnabled(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			b.SetEnabled(tt.args.enabled)
 		})
@@ -150,7 +145,6 @@ func TestEvalBroker_Enqueue(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		eval *models.Evaluation
@@ -177,7 +171,6 @@ func TestEvalBroker_Enqueue(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			b.Enqueue(tt.args.eval)
 		})
@@ -198,7 +191,6 @@ func TestEvalBroker_EnqueueAll(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		evals map[*models.Evaluation]string
@@ -225,7 +217,6 @@ func TestEvalBroker_EnqueueAll(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			b.EnqueueAll(tt.args.evals)
 		})
@@ -246,7 +237,6 @@ func TestEvalBroker_processEnqueue(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		eval  *models.Evaluation
@@ -274,7 +264,6 @@ func TestEvalBroker_processEnqueue(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			b.processEnqueue(tt.args.eval, tt.args.token)
 		})
@@ -295,7 +284,6 @@ func TestEvalBroker_enqueueWaiting(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		eval *models.Evaluation
@@ -322,7 +310,6 @@ func TestEvalBroker_enqueueWaiting(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			b.enqueueWaiting(tt.args.eval)
 		})
@@ -343,7 +330,6 @@ func TestEvalBroker_enqueueLocked(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		eval  *models.Evaluation
@@ -371,7 +357,6 @@ func TestEvalBroker_enqueueLocked(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			b.enqueueLocked(tt.args.eval, tt.args.queue)
 		})
@@ -392,7 +377,6 @@ func TestEvalBroker_Dequeue(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		schedulers []string
@@ -423,7 +407,6 @@ func TestEvalBroker_Dequeue(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			got, got1, err := b.Dequeue(tt.args.schedulers, tt.args.timeout)
 			if (err != nil) != tt.wantErr {
@@ -454,7 +437,6 @@ func TestEvalBroker_scanForSchedulers(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		schedulers []string
@@ -484,7 +466,6 @@ func TestEvalBroker_scanForSchedulers(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			got, got1, err := b.scanForSchedulers(tt.args.schedulers)
 			if (err != nil) != tt.wantErr {
@@ -515,7 +496,6 @@ func TestEvalBroker_dequeueForSched(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		sched string
@@ -545,7 +525,6 @@ func TestEvalBroker_dequeueForSched(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			got, got1, err := b.dequeueForSched(tt.args.sched)
 			if (err != nil) != tt.wantErr {
@@ -576,7 +555,6 @@ func TestEvalBroker_waitForSchedulers(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		schedulers []string
@@ -605,7 +583,6 @@ func TestEvalBroker_waitForSchedulers(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			if got := b.waitForSchedulers(tt.args.schedulers, tt.args.timeoutCh); got != tt.want {
 				t.Errorf("EvalBroker.waitForSchedulers() = %v, want %v", got, tt.want)
@@ -628,7 +605,6 @@ func TestEvalBroker_Outstanding(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		evalID string
@@ -657,7 +633,6 @@ func TestEvalBroker_Outstanding(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			got, got1 := b.Outstanding(tt.args.evalID)
 			if got != tt.want {
@@ -684,7 +659,6 @@ func TestEvalBroker_OutstandingReset(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		evalID string
@@ -713,7 +687,6 @@ func TestEvalBroker_OutstandingReset(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			if err := b.OutstandingReset(tt.args.evalID, tt.args.token); (err != nil) != tt.wantErr {
 				t.Errorf("EvalBroker.OutstandingReset() error = %v, wantErr %v", err, tt.wantErr)
@@ -736,7 +709,6 @@ func TestEvalBroker_Ack(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		evalID string
@@ -765,7 +737,6 @@ func TestEvalBroker_Ack(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			if err := b.Ack(tt.args.evalID, tt.args.token); (err != nil) != tt.wantErr {
 				t.Errorf("EvalBroker.Ack() error = %v, wantErr %v", err, tt.wantErr)
@@ -788,7 +759,6 @@ func TestEvalBroker_Nack(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		evalID string
@@ -817,7 +787,6 @@ func TestEvalBroker_Nack(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			if err := b.Nack(tt.args.evalID, tt.args.token); (err != nil) != tt.wantErr {
 				t.Errorf("EvalBroker.Nack() error = %v, wantErr %v", err, tt.wantErr)
@@ -840,7 +809,6 @@ func TestEvalBroker_PauseNackTimeout(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		evalID string
@@ -869,7 +837,6 @@ func TestEvalBroker_PauseNackTimeout(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			if err := b.PauseNackTimeout(tt.args.evalID, tt.args.token); (err != nil) != tt.wantErr {
 				t.Errorf("EvalBroker.PauseNackTimeout() error = %v, wantErr %v", err, tt.wantErr)
@@ -892,7 +859,6 @@ func TestEvalBroker_ResumeNackTimeout(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		evalID string
@@ -921,7 +887,6 @@ func TestEvalBroker_ResumeNackTimeout(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			if err := b.ResumeNackTimeout(tt.args.evalID, tt.args.token); (err != nil) != tt.wantErr {
 				t.Errorf("EvalBroker.ResumeNackTimeout() error = %v, wantErr %v", err, tt.wantErr)
@@ -944,7 +909,6 @@ func TestEvalBroker_Flush(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	tests := []struct {
 		name   string
@@ -967,7 +931,6 @@ func TestEvalBroker_Flush(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			b.Flush()
 		})
@@ -988,7 +951,6 @@ func TestEvalBroker_Stats(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	tests := []struct {
 		name   string
@@ -1012,7 +974,6 @@ func TestEvalBroker_Stats(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			if got := b.Stats(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("EvalBroker.Stats() = %v, want %v", got, tt.want)
@@ -1035,7 +996,6 @@ func TestEvalBroker_EmitStats(t *testing.T) {
 		waiting       map[string]chan struct{}
 		requeue       map[string]*models.Evaluation
 		timeWait      map[string]*time.Timer
-		l             sync.RWMutex
 	}
 	type args struct {
 		period time.Duration
@@ -1063,7 +1023,6 @@ func TestEvalBroker_EmitStats(t *testing.T) {
 				waiting:       tt.fields.waiting,
 				requeue:       tt.fields.requeue,
 				timeWait:      tt.fields.timeWait,
-				l:             tt.fields.l,
 			}
 			b.EmitStats(tt.args.period, tt.args.stopCh)
 		})
@@ -40,6 +40,7 @@ func (e *Eval) GetEval(args *models.EvalSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "evals",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Look for the job
 			out, err := state.EvalByID(ws, args.EvalID)
@@ -286,6 +287,7 @@ func (e *Eval) List(args *models.EvalListRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "evals",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Scan all the evaluations
 			var err error
@@ -299,9 +301,16 @@ func (e *Eval) List(args *models.EvalListRequest,
 				return err
 			}
 
+			pager, err := newPaginator(iter, &args.QueryOptions, func(raw interface{}) string {
+				return raw.(*models.Evaluation).ID
+			})
+			if err != nil {
+				return err
+			}
+
 			var evals []*models.Evaluation
 			for {
-				raw := iter.Next()
+				raw := pager.Next()
 				if raw == nil {
 					break
 				}
@@ -316,6 +325,7 @@ func (e *Eval) List(args *models.EvalListRequest,
 				return err
 			}
 			reply.Index = index
+			pager.setMeta(&reply.QueryMeta, index)
 
 			// Set the query response
 			e.srv.setQueryMeta(&reply.QueryMeta)
@@ -336,6 +346,7 @@ func (e *Eval) Allocations(args *models.EvalSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "allocs",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Capture the allocations
 			allocs, err := state.AllocsByEval(ws, args.EvalID)
@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/armon/go-metrics"
+	memdb "github.com/hashicorp/go-memdb"
+	"github.com/hashicorp/go-msgpack/codec"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// eventTables are the state store tables whose changes can be streamed
+var eventTables = map[string]bool{
+	"nodes":      true,
+	"jobs":       true,
+	"orders":     true,
+	"evals":      true,
+	"allocs":     true,
+	"job_events": true,
+}
+
+// Event endpoint is used to stream the changes of the state store. It is
+// served on rpcStreaming connections rather than through net/rpc.
+type Event struct {
+	srv *Server
+}
+
+// Stream pushes an EventStreamFrame to enc every time some of the tables
+// requested by args change, until ctx is cancelled. Changes after
+// args.MinQueryIndex are pushed right away. The stream is always served
+// from the local state, so it may be stale.
+func (e *Event) Stream(ctx context.Context, args *models.EventStreamRequest, enc *codec.Encoder) error {
+	if args.Region != "" && args.Region != e.srv.config.Region {
+		return fmt.Errorf("event streams are only served for region %q", e.srv.config.Region)
+	}
+	if len(args.Tables) == 0 {
+		return fmt.Errorf("missing tables to stream")
+	}
+	for _, table := range args.Tables {
+		if !eventTables[table] {
+			return fmt.Errorf("unknown table %q", table)
+		}
+	}
+
+	metrics.IncrCounter([]string{"server", "event", "stream"}, 1)
+	last := make(map[string]uint64, len(args.Tables))
+	for _, table := range args.Tables {
+		last[table] = args.MinQueryIndex
+	}
+
+	for {
+		// The state is looked up again every time since a restore
+		// abandons it
+		state := e.srv.fsm.State()
+		ws := memdb.NewWatchSet()
+		ws.Add(state.AbandonCh())
+
+		frame := models.EventStreamFrame{}
+		for table := range last {
+			index, err := state.IndexWatch(ws, table)
+			if err != nil {
+				return err
+			}
+			if index <= last[table] {
+				continue
+			}
+			last[table] = index
+			frame.Tables = append(frame.Tables, table)
+			if index > frame.Index {
+				frame.Index = index
+			}
+		}
+
+		if len(frame.Tables) > 0 {
+			sort.Strings(frame.Tables)
+			if err := enc.Encode(&frame); err != nil {
+				return err
+			}
+			metrics.IncrCounter([]string{"server", "event", "frame"}, 1)
+			continue
+		}
+
+		if err := ws.WatchCtx(ctx); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-msgpack/codec"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+func testEventServer(t *testing.T) (*Server, *store.StateStore) {
+	state, err := store.NewStateStore(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("store.NewStateStore() error = %v", err)
+	}
+	s := &Server{
+		config:     &uconf.ServerConfig{Region: "global"},
+		logger:     ulog.New(ioutil.Discard, ulog.ErrorLevel),
+		fsm:        &udupFSM{state: state},
+		rpcDrainer: newRPCDrainer(),
+		shutdownCh: make(chan struct{}),
+	}
+	s.endpoints.Event = &Event{s}
+	return s, state
+}
+
+func TestServer_handleStreamingConn(t *testing.T) {
+	s, state := testEventServer(t)
+	if err := state.UpsertJob(5, &models.Job{ID: "a", Type: models.JobTypeSync}); err != nil {
+		t.Fatalf("StateStore.UpsertJob() error = %v", err)
+	}
+
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.handleStreamingConn(context.Background(), c2)
+		close(done)
+	}()
+
+	enc := codec.NewEncoder(c1, models.HashiMsgpackHandle)
+	dec := codec.NewDecoder(c1, models.HashiMsgpackHandle)
+	if err := enc.Encode(&models.StreamingRPCHeader{Method: "Event.Stream"}); err != nil {
+		t.Fatalf("Encode() header error = %v", err)
+	}
+	args := &models.EventStreamRequest{Tables: []string{"jobs", "nodes"}}
+	args.MinQueryIndex = 5
+	if err := enc.Encode(args); err != nil {
+		t.Fatalf("Encode() args error = %v", err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() {
+		state.UpsertJob(6, &models.Job{ID: "b", Type: models.JobTypeSync})
+	})
+	var frame models.EventStreamFrame
+	if err := dec.Decode(&frame); err != nil {
+		t.Fatalf("Decode() frame error = %v", err)
+	}
+	want := models.EventStreamFrame{Index: 6, Tables: []string{"jobs"}}
+	if !reflect.DeepEqual(frame, want) {
+		t.Errorf("Event.Stream frame = %+v, want %+v", frame, want)
+	}
+
+	// The stream is torn down once the client goes away
+	c1.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("handleStreamingConn() didn't return after the client closed")
+	}
+}
+
+func TestEvent_Stream_Invalid(t *testing.T) {
+	s, _ := testEventServer(t)
+	tests := []struct {
+		name string
+		args *models.EventStreamRequest
+	}{
+		{"no tables", &models.EventStreamRequest{}},
+		{"unknown table", &models.EventStreamRequest{Tables: []string{"index"}}},
+		{"other region", &models.EventStreamRequest{Tables: []string{"jobs"},
+			QueryOptions: models.QueryOptions{Region: "far"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.endpoints.Event.Stream(context.Background(), tt.args, nil); err == nil {
+				t.Errorf("Event.Stream() accepted %+v", tt.args)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
@@ -41,12 +42,18 @@ const (
 	EvalSnapshot
 	AllocSnapshot
 	TimeTableSnapshot
+	JobEventsSnapshot
+	MaintenanceSnapshot
 )
 
 // udupFSM implements a finite store machine that is used
 // along with Raft to provide strong consistency. We implement
 // this outside the Server to avoid exposing this outside the package.
 type udupFSM struct {
+	// applyCounts counts the applied messages by type, it is accessed
+	// atomically and kept first for the alignment of its counters
+	applyCounts [models.IgnoreUnknownTypeFlag]uint64
+
 	evalBroker   *EvalBroker
 	blockedEvals *BlockedEvals
 	logOutput    io.Writer
@@ -59,14 +66,29 @@ type udupFSM struct {
 	// new store store). Everything internal here is synchronized by the
 	// Raft side, so doesn't need to lock this.
 	stateLock sync.RWMutex
+
+	// applied is set once an entry or a snapshot was applied, it is
+	// accessed atomically
+	applied int32
+
+	// batchEffects holds the side effects of the messages of the batch
+	// being applied, evals to enqueue or to unblock, until the whole batch
+	// is committed. It is nil outside of a batch.
+	batchEffects []func()
+
+	// schemaVersion returns the schema version every server of the region
+	// decodes, snapshots leave out the records older servers can't
+	// restore. It is nil outside of a server, where all records are kept.
+	schemaVersion func() uint8
 }
 
 // udupSnapshot is used to provide a snapshot of the current
 // store in a way that can be accessed concurrently with operations
 // that may modify the live store.
 type udupSnapshot struct {
-	snap      *store.StateSnapshot
-	timetable *TimeTable
+	snap          *store.StateSnapshot
+	timetable     *TimeTable
+	schemaVersion uint8
 }
 
 // snapshotHeader is the first entry in our snapshot
@@ -105,6 +127,23 @@ func (n *udupFSM) State() *store.StateStore {
 	return n.state
 }
 
+// hasApplied returns whether any log entry or snapshot was applied
+func (n *udupFSM) hasApplied() bool {
+	return atomic.LoadInt32(&n.applied) == 1
+}
+
+// applyStats returns the number of applied messages by type, leaving out
+// the types that were never applied
+func (n *udupFSM) applyStats() map[string]uint64 {
+	stats := make(map[string]uint64)
+	for t := range n.applyCounts {
+		if count := atomic.LoadUint64(&n.applyCounts[t]); count > 0 {
+			stats[models.MessageType(t).String()] = count
+		}
+	}
+	return stats
+}
+
 // TimeTable returns the time table of transactions
 func (n *udupFSM) TimeTable() *TimeTable {
 	return n.timetable
@@ -116,6 +155,7 @@ func (n *udupFSM) Apply(log *raft.Log) interface{} {
 
 	// Witness this write
 	n.timetable.Witness(log.Index, time.Now().UTC())
+	atomic.StoreInt32(&n.applied, 1)
 
 	// Check if this message type should be ignored when unknown. This is
 	// used so that new commands can be added with developer control if older
@@ -126,35 +166,61 @@ func (n *udupFSM) Apply(log *raft.Log) interface{} {
 		ignoreUnknown = true
 	}
 
+	// Reject entries written with a schema this server can't decode rather
+	// than panicking on them below
+	if err := models.CheckSchemaVersion(buf[1:]); err != nil {
+		n.logger.Errorf("server.fsm: rejecting entry at index %d: %v", log.Index, err)
+		return err
+	}
+
+	if msgType == models.BatchRequestType {
+		return n.applyBatch(buf[1:], log.Index)
+	}
+	return n.applyMessage(msgType, ignoreUnknown, buf, log.Index)
+}
+
+// applyMessage applies a single message of buf, which starts with its type
+// byte, at index
+func (n *udupFSM) applyMessage(msgType models.MessageType, ignoreUnknown bool, buf []byte, index uint64) interface{} {
+	atomic.AddUint64(&n.applyCounts[msgType], 1)
+
 	switch msgType {
 	case models.NodeRegisterRequestType:
-		return n.applyUpsertNode(buf[1:], log.Index)
+		return n.applyUpsertNode(buf[1:], index)
 	case models.NodeDeregisterRequestType:
-		return n.applyDeregisterNode(buf[1:], log.Index)
+		return n.applyDeregisterNode(buf[1:], index)
 	case models.NodeUpdateStatusRequestType:
-		return n.applyStatusUpdate(buf[1:], log.Index)
+		return n.applyStatusUpdate(buf[1:], index)
 	case models.JobUpdateStatusRequestType:
-		return n.applyJobStatusUpdate(buf[1:], log.Index)
+		return n.applyJobStatusUpdate(buf[1:], index)
 	case models.JobRegisterRequestType:
-		return n.applyUpsertJob(buf[1:], log.Index)
+		return n.applyUpsertJob(buf[1:], index)
 	case models.JobDeregisterRequestType:
-		return n.applyDeregisterJob(buf[1:], log.Index)
+		return n.applyDeregisterJob(buf[1:], index)
 	case models.JobRenewalRequestType:
-		return n.applyRenewalJob(buf[1:], log.Index)
+		return n.applyRenewalJob(buf[1:], index)
 	case models.OrderRegisterRequestType:
-		return n.applyUpsertOrder(buf[1:], log.Index)
+		return n.applyUpsertOrder(buf[1:], index)
 	case models.OrderDeregisterRequestType:
-		return n.applyDeregisterOrder(buf[1:], log.Index)
+		return n.applyDeregisterOrder(buf[1:], index)
 	case models.JobClientUpdateRequestType:
-		return n.applyJobClientUpdate(buf[1:], log.Index)
+		return n.applyJobClientUpdate(buf[1:], index)
 	case models.EvalUpdateRequestType:
-		return n.applyUpdateEval(buf[1:], log.Index)
+		return n.applyUpdateEval(buf[1:], index)
 	case models.EvalDeleteRequestType:
-		return n.applyDeleteEval(buf[1:], log.Index)
+		return n.applyDeleteEval(buf[1:], index)
 	case models.AllocUpdateRequestType:
-		return n.applyAllocUpdate(buf[1:], log.Index)
+		return n.applyAllocUpdate(buf[1:], index)
 	case models.AllocClientUpdateRequestType:
-		return n.applyAllocClientUpdate(buf[1:], log.Index)
+		return n.applyAllocClientUpdate(buf[1:], index)
+	case models.JobConfigUpdateRequestType:
+		return n.applyJobConfigUpdate(buf[1:], index)
+	case models.JobCancelRequestType:
+		return n.applyCancelJob(buf[1:], index)
+	case models.MaintenanceModeRequestType:
+		return n.applyMaintenanceMode(buf[1:], index)
+	case models.StateImportRequestType:
+		return n.applyStateImport(buf[1:], index)
 	default:
 		if ignoreUnknown {
 			n.logger.Warnf("server.fsm: ignoring unknown message type (%d), upgrade to newer version", msgType)
@@ -165,6 +231,69 @@ func (n *udupFSM) Apply(log *raft.Log) interface{} {
 	}
 }
 
+// sideEffect runs f, which acts on the eval broker or the blocked evals
+// rather than on the state, at once or, while a batch is applied, once the
+// whole batch is committed
+func (n *udupFSM) sideEffect(f func()) {
+	if n.batchEffects != nil {
+		n.batchEffects = append(n.batchEffects, f)
+		return
+	}
+	f()
+}
+
+// applyBatch applies the messages of a BatchRequest in order, all at the
+// index of the batch. If one of them fails, the state is rolled back to
+// what it was before the batch and the error is returned. The side effects
+// of the messages only run once all of them are applied.
+func (n *udupFSM) applyBatch(buf []byte, index uint64) interface{} {
+	defer metrics.MeasureSince([]string{"server", "fsm", "batch"}, time.Now())
+	var req models.BatchRequest
+	if err := models.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	// Check every entry before applying any of them
+	for i, entry := range req.Entries {
+		if len(entry) == 0 {
+			return fmt.Errorf("batch entry %d is empty", i)
+		}
+		if models.MessageType(entry[0])&^models.IgnoreUnknownTypeFlag == models.BatchRequestType {
+			return fmt.Errorf("batch entry %d is a nested batch", i)
+		}
+		if err := models.CheckSchemaVersion(entry[1:]); err != nil {
+			return fmt.Errorf("batch entry %d: %v", i, err)
+		}
+	}
+
+	savepoint, err := n.state.Snapshot()
+	if err != nil {
+		return err
+	}
+	n.batchEffects = make([]func(), 0)
+	defer func() { n.batchEffects = nil }()
+	for i, entry := range req.Entries {
+		msgType := models.MessageType(entry[0])
+		ignoreUnknown := msgType&models.IgnoreUnknownTypeFlag == models.IgnoreUnknownTypeFlag
+		msgType &^= models.IgnoreUnknownTypeFlag
+
+		resp := n.applyMessage(msgType, ignoreUnknown, entry, index)
+		if err, ok := resp.(error); ok && err != nil {
+			n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: batch entry %d of %d failed, rolling back: %v",
+				i, len(req.Entries), err)
+			if rbErr := n.state.Rollback(savepoint); rbErr != nil {
+				panic(fmt.Errorf("failed to roll back batch: %v", rbErr))
+			}
+			return fmt.Errorf("batch entry %d: %v", i, err)
+		}
+	}
+	for _, f := range n.batchEffects {
+		f()
+	}
+	metrics.IncrCounter([]string{"server", "fsm", "batch_entries"}, float32(len(req.Entries)))
+	return nil
+}
+
 func (n *udupFSM) applyUpsertNode(buf []byte, index uint64) interface{} {
 	defer metrics.MeasureSince([]string{"server", "fsm", "register_node"}, time.Now())
 	var req models.NodeRegisterRequest
@@ -173,14 +302,14 @@ func (n *udupFSM) applyUpsertNode(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.UpsertNode(index, req.Node); err != nil {
-		n.logger.Errorf("server.fsm: UpsertNode failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: UpsertNode failed: %v", err)
 		return err
 	}
 
 	// Unblock evals for the nodes computed node class if it is in a ready
 	// store.
 	if req.Node.Status == models.NodeStatusReady {
-		n.blockedEvals.Unblock(req.Node.ComputedClass, index)
+		n.sideEffect(func() { n.blockedEvals.Unblock(req.Node.ComputedClass, index) })
 	}
 
 	return nil
@@ -194,7 +323,7 @@ func (n *udupFSM) applyDeregisterNode(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.DeleteNode(index, req.NodeID); err != nil {
-		n.logger.Errorf("server.fsm: DeleteNode failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: DeleteNode failed: %v", err)
 		return err
 	}
 	return nil
@@ -208,7 +337,7 @@ func (n *udupFSM) applyStatusUpdate(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.UpdateNodeStatus(index, req.NodeID, req.Status); err != nil {
-		n.logger.Errorf("server.fsm: UpdateNodeStatus failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: UpdateNodeStatus failed: %v", err)
 		return err
 	}
 
@@ -222,7 +351,7 @@ func (n *udupFSM) applyStatusUpdate(buf []byte, index uint64) interface{} {
 			return err
 
 		}
-		n.blockedEvals.Unblock(node.ComputedClass, index)
+		n.sideEffect(func() { n.blockedEvals.Unblock(node.ComputedClass, index) })
 	}
 
 	if req.Status == models.NodeStatusDown {
@@ -351,7 +480,7 @@ func (n *udupFSM) applyJobStatusUpdate(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.UpdateJobStatus(index, req.JobID, req.Status); err != nil {
-		n.logger.Errorf("server.fsm: UpdateJobStatus failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: UpdateJobStatus failed: %v", err)
 		return err
 	}
 
@@ -368,7 +497,7 @@ func (n *udupFSM) applyUpsertJob(buf []byte, index uint64) interface{} {
 	req.Job.Canonicalize()
 
 	if err := n.state.UpsertJob(index, req.Job); err != nil {
-		n.logger.Errorf("server.fsm: UpsertJob failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: UpsertJob failed: %v", err)
 		return err
 	}
 
@@ -383,7 +512,7 @@ func (n *udupFSM) applyRenewalJob(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.RenewalJob(index, req.JobID, req.OrderID); err != nil {
-		n.logger.Errorf("server.fsm: RenewalJob failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: RenewalJob failed: %v", err)
 		return err
 	}
 
@@ -398,10 +527,71 @@ func (n *udupFSM) applyDeregisterJob(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.DeleteJob(index, req.JobID); err != nil {
-		n.logger.Errorf("server.fsm: DeleteJob failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: DeleteJob failed: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (n *udupFSM) applyCancelJob(buf []byte, index uint64) interface{} {
+	defer metrics.MeasureSince([]string{"server", "fsm", "cancel_job"}, time.Now())
+	var req models.JobCancelRequest
+	if err := models.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	if err := n.state.CancelJob(index, req.JobID); err != nil {
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: CancelJob failed: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (n *udupFSM) applyMaintenanceMode(buf []byte, index uint64) interface{} {
+	defer metrics.MeasureSince([]string{"server", "fsm", "maintenance_mode"}, time.Now())
+	var req models.MaintenanceModeRequest
+	if err := models.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	evals, err := n.state.SetMaintenanceMode(index, &req)
+	if err != nil {
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: SetMaintenanceMode failed: %v", err)
+		return err
+	}
+
+	n.sideEffect(func() {
+		for _, eval := range evals {
+			if eval.ShouldEnqueue() {
+				n.evalBroker.Enqueue(eval)
+			}
+		}
+	})
+	return nil
+}
+
+func (n *udupFSM) applyStateImport(buf []byte, index uint64) interface{} {
+	defer metrics.MeasureSince([]string{"server", "fsm", "state_import"}, time.Now())
+	var req models.StateImportApplyRequest
+	if err := models.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	evals, err := n.state.ImportState(index, &req)
+	if err != nil {
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: ImportState failed: %v", err)
 		return err
 	}
 
+	n.sideEffect(func() {
+		for _, eval := range evals {
+			if eval.ShouldEnqueue() {
+				n.evalBroker.Enqueue(eval)
+			}
+		}
+	})
 	return nil
 }
 
@@ -413,7 +603,7 @@ func (n *udupFSM) applyUpsertOrder(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.UpsertOrder(index, req.Order); err != nil {
-		n.logger.Errorf("server.fsm: UpsertOrder failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: UpsertOrder failed: %v", err)
 		return err
 	}
 
@@ -428,7 +618,7 @@ func (n *udupFSM) applyDeregisterOrder(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.DeleteOrder(index, req.OrderID); err != nil {
-		n.logger.Errorf("server.fsm: DeleteOrder failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: DeleteOrder failed: %v", err)
 		return err
 	}
 
@@ -443,22 +633,24 @@ func (n *udupFSM) applyUpdateEval(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.UpsertEvals(index, req.Evals); err != nil {
-		n.logger.Errorf("server.fsm: UpsertEvals failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: UpsertEvals failed: %v", err)
 		return err
 	}
 
-	for _, eval := range req.Evals {
-		if eval.ShouldEnqueue() {
-			n.evalBroker.Enqueue(eval)
-		} else if eval.ShouldBlock() {
-			n.blockedEvals.Block(eval)
-		} else if eval.Status == models.EvalStatusComplete &&
-			len(eval.FailedTGAllocs) == 0 {
-			// If we have a successful evaluation for a node, untrack any
-			// blocked evaluation
-			n.blockedEvals.Untrack(eval.JobID)
+	n.sideEffect(func() {
+		for _, eval := range req.Evals {
+			if eval.ShouldEnqueue() {
+				n.evalBroker.Enqueue(eval)
+			} else if eval.ShouldBlock() {
+				n.blockedEvals.Block(eval)
+			} else if eval.Status == models.EvalStatusComplete &&
+				len(eval.FailedTGAllocs) == 0 {
+				// If we have a successful evaluation for a node, untrack any
+				// blocked evaluation
+				n.blockedEvals.Untrack(eval.JobID)
+			}
 		}
-	}
+	})
 	return nil
 }
 
@@ -470,7 +662,7 @@ func (n *udupFSM) applyDeleteEval(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.DeleteEval(index, req.Evals, req.Allocs); err != nil {
-		n.logger.Errorf("server.fsm: DeleteEval failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: DeleteEval failed: %v", err)
 		return err
 	}
 	return nil
@@ -495,7 +687,7 @@ func (n *udupFSM) applyAllocUpdate(buf []byte, index uint64) interface{} {
 	}
 
 	if err := n.state.UpsertAllocs(index, req.Alloc); err != nil {
-		n.logger.Errorf("server.fsm: UpsertAllocs failed: %v", err)
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: UpsertAllocs failed: %v", err)
 		return err
 	}
 	return nil
@@ -523,6 +715,8 @@ func (n *udupFSM) applyJobClientUpdate(buf []byte, index uint64) interface{} {
 				existing.JobModifyIndex = index
 				for _, t := range existing.Tasks {
 					t.Config["Gtid"] = ju.Gtid
+					// The copy is complete
+					delete(t.Config, "DumpCheckpoint")
 					//t.Config["NatsAddr"] = ju.NatsAddr
 				}
 				// Update all the client allocations
@@ -536,6 +730,15 @@ func (n *udupFSM) applyJobClientUpdate(buf []byte, index uint64) interface{} {
 				/*for _, t := range existing.Tasks {
 					t.Config["NatsAddr"] = ju.NatsAddr
 				}*/
+				if ju.SealedDumpCheckpoint != "" {
+					for _, t := range existing.Tasks {
+						t.Config["DumpCheckpoint"] = ju.SealedDumpCheckpoint
+					}
+				} else if ju.DumpCheckpoint != nil {
+					for _, t := range existing.Tasks {
+						t.Config["DumpCheckpoint"] = ju.DumpCheckpoint
+					}
+				}
 				// Update all the client allocations
 				if err := n.state.UpdateJobFromClient(index, existing); err != nil {
 					n.logger.Errorf("server.fsm: UpdateJobFromClient failed: %v", err)
@@ -548,6 +751,20 @@ func (n *udupFSM) applyJobClientUpdate(buf []byte, index uint64) interface{} {
 	return nil
 }
 
+func (n *udupFSM) applyJobConfigUpdate(buf []byte, index uint64) interface{} {
+	defer metrics.MeasureSince([]string{"server", "fsm", "job_config_update"}, time.Now())
+	var req models.JobConfigUpdateRequest
+	if err := models.Decode(buf, &req); err != nil {
+		panic(fmt.Errorf("failed to decode request: %v", err))
+	}
+
+	if err := n.state.UpdateJobConfig(index, req.JobID, req.Tasks); err != nil {
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: UpdateJobConfig failed: %v", err)
+		return err
+	}
+	return nil
+}
+
 func (n *udupFSM) applyAllocClientUpdate(buf []byte, index uint64) interface{} {
 	defer metrics.MeasureSince([]string{"server", "fsm", "alloc_client_update"}, time.Now())
 	var req models.AllocUpdateRequest
@@ -570,8 +787,8 @@ func (n *udupFSM) applyAllocClientUpdate(buf []byte, index uint64) interface{} {
 	}
 
 	// Update all the client allocations
-	if err := n.state.UpdateAllocsFromClient(index, req.Alloc); err != nil {
-		n.logger.Errorf("server.fsm: UpdateAllocFromClient failed: %v", err)
+	if err := n.state.UpdateAllocsFromClient(index, req.Alloc, req.JobEventsRetention); err != nil {
+		n.logger.WithField(log.FieldRequestID, req.RequestID).Errorf("server.fsm: UpdateAllocFromClient failed: %v", err)
 		return err
 	}
 
@@ -587,7 +804,7 @@ func (n *udupFSM) applyAllocClientUpdate(buf []byte, index uint64) interface{} {
 				return err
 
 			}
-			n.blockedEvals.Unblock(node.ComputedClass, index)
+			n.sideEffect(func() { n.blockedEvals.Unblock(node.ComputedClass, index) })
 		}
 	}
 
@@ -602,8 +819,12 @@ func (n *udupFSM) Snapshot() (raft.FSMSnapshot, error) {
 	}
 
 	ns := &udupSnapshot{
-		snap:      snap,
-		timetable: n.timetable,
+		snap:          snap,
+		timetable:     n.timetable,
+		schemaVersion: models.SchemaVersion,
+	}
+	if n.schemaVersion != nil {
+		ns.schemaVersion = n.schemaVersion()
 	}
 	return ns, nil
 }
@@ -690,6 +911,24 @@ func (n *udupFSM) Restore(old io.ReadCloser) error {
 				return err
 			}
 
+		case JobEventsSnapshot:
+			events := new(models.JobEvents)
+			if err := dec.Decode(events); err != nil {
+				return err
+			}
+			if err := restore.JobEventsRestore(events); err != nil {
+				return err
+			}
+
+		case MaintenanceSnapshot:
+			mode := new(models.MaintenanceMode)
+			if err := dec.Decode(mode); err != nil {
+				return err
+			}
+			if err := restore.MaintenanceRestore(mode); err != nil {
+				return err
+			}
+
 		case IndexSnapshot:
 			idx := new(store.IndexEntry)
 			if err := dec.Decode(idx); err != nil {
@@ -717,6 +956,7 @@ func (n *udupFSM) Restore(old io.ReadCloser) error {
 	// because we don't operate on it any more, we just throw it away, so
 	// blocking queries won't see any changes and need to be woken up.
 	stateOld.Abandon()
+	atomic.StoreInt32(&n.applied, 1)
 
 	return nil
 }
@@ -761,6 +1001,19 @@ func (s *udupSnapshot) Persist(sink raft.SnapshotSink) error {
 		sink.Cancel()
 		return err
 	}
+	// An older server fails to restore a snapshot holding the job events
+	// or the maintenance mode, they are left out until all are upgraded.
+	// The maintenance mode can't be set before then anyway.
+	if s.schemaVersion > models.LegacySchemaVersion {
+		if err := s.persistJobEvents(sink, encoder); err != nil {
+			sink.Cancel()
+			return err
+		}
+		if err := s.persistMaintenance(sink, encoder); err != nil {
+			sink.Cancel()
+			return err
+		}
+	}
 
 	return nil
 }
@@ -904,6 +1157,45 @@ func (s *udupSnapshot) persistAllocs(sink raft.SnapshotSink,
 	return nil
 }
 
+func (s *udupSnapshot) persistJobEvents(sink raft.SnapshotSink,
+	encoder *codec.Encoder) error {
+	// Get the events of all the jobs
+	ws := memdb.NewWatchSet()
+	iter, err := s.snap.JobEvents(ws)
+	if err != nil {
+		return err
+	}
+
+	for {
+		raw := iter.Next()
+		if raw == nil {
+			break
+		}
+
+		events := raw.(*models.JobEvents)
+		sink.Write([]byte{byte(JobEventsSnapshot)})
+		if err := encoder.Encode(events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *udupSnapshot) persistMaintenance(sink raft.SnapshotSink,
+	encoder *codec.Encoder) error {
+	mode, err := s.snap.Maintenance(memdb.NewWatchSet())
+	if err != nil {
+		return err
+	}
+	// A cluster that never entered the maintenance mode has none to persist
+	if mode.ModifyIndex == 0 {
+		return nil
+	}
+
+	sink.Write([]byte{byte(MaintenanceSnapshot)})
+	return encoder.Encode(mode)
+}
+
 // Release is a no-op, as we just need to GC the pointer
 // to the store store snapshot. There is nothing to explicitly
 // cleanup.
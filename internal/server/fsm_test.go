@@ -11,8 +11,11 @@ import (
 	"io"
 	"reflect"
 	"sync"
+	"io/ioutil"
 	"testing"
+	"time"
 	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
 	"github.com/actiontech/dtle/internal/server/store"
 
 	"github.com/hashicorp/raft"
@@ -60,7 +63,6 @@ func Test_udupFSM_Close(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	tests := []struct {
 		name    string
@@ -78,7 +80,6 @@ func Test_udupFSM_Close(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if err := n.Close(); (err != nil) != tt.wantErr {
 				t.Errorf("udupFSM.Close() error = %v, wantErr %v", err, tt.wantErr)
@@ -95,7 +96,6 @@ func Test_udupFSM_State(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	tests := []struct {
 		name   string
@@ -113,7 +113,6 @@ func Test_udupFSM_State(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.State(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.State() = %v, want %v", got, tt.want)
@@ -130,7 +129,6 @@ func Test_udupFSM_TimeTable(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	tests := []struct {
 		name   string
@@ -148,7 +146,6 @@ func Test_udupFSM_TimeTable(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.TimeTable(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.TimeTable() = %v, want %v", got, tt.want)
@@ -165,7 +162,6 @@ func Test_udupFSM_Apply(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		log *raft.Log
@@ -187,7 +183,6 @@ func Test_udupFSM_Apply(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.Apply(tt.args.log); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.Apply() = %v, want %v", got, tt.want)
@@ -204,7 +199,6 @@ func Test_udupFSM_applyUpsertNode(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -227,7 +221,6 @@ func Test_udupFSM_applyUpsertNode(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyUpsertNode(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyUpsertNode() = %v, want %v", got, tt.want)
@@ -244,7 +237,6 @@ func Test_udupFSM_applyDeregisterNode(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -267,7 +259,6 @@ func Test_udupFSM_applyDeregisterNode(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyDeregisterNode(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyDeregisterNode() = %v, want %v", got, tt.want)
@@ -284,7 +275,6 @@ func Test_udupFSM_applyStatusUpdate(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -307,7 +297,6 @@ func Test_udupFSM_applyStatusUpdate(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyStatusUpdate(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyStatusUpdate() = %v, want %v", got, tt.want)
@@ -324,7 +313,6 @@ func Test_udupFSM_applyJobStatusUpdate(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -347,7 +335,6 @@ func Test_udupFSM_applyJobStatusUpdate(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyJobStatusUpdate(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyJobStatusUpdate() = %v, want %v", got, tt.want)
@@ -364,7 +351,6 @@ func Test_udupFSM_applyUpsertJob(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -387,7 +373,6 @@ func Test_udupFSM_applyUpsertJob(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyUpsertJob(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyUpsertJob() = %v, want %v", got, tt.want)
@@ -404,7 +389,6 @@ func Test_udupFSM_applyDeregisterJob(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -427,7 +411,6 @@ func Test_udupFSM_applyDeregisterJob(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyDeregisterJob(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyDeregisterJob() = %v, want %v", got, tt.want)
@@ -444,7 +427,6 @@ func Test_udupFSM_applyUpdateEval(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -467,7 +449,6 @@ func Test_udupFSM_applyUpdateEval(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyUpdateEval(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyUpdateEval() = %v, want %v", got, tt.want)
@@ -484,7 +465,6 @@ func Test_udupFSM_applyDeleteEval(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -507,7 +487,6 @@ func Test_udupFSM_applyDeleteEval(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyDeleteEval(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyDeleteEval() = %v, want %v", got, tt.want)
@@ -524,7 +503,6 @@ func Test_udupFSM_applyAllocUpdate(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -547,7 +525,6 @@ func Test_udupFSM_applyAllocUpdate(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyAllocUpdate(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyAllocUpdate() = %v, want %v", got, tt.want)
@@ -564,7 +541,6 @@ func Test_udupFSM_applyJobClientUpdate(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -587,7 +563,6 @@ func Test_udupFSM_applyJobClientUpdate(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyJobClientUpdate(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyJobClientUpdate() = %v, want %v", got, tt.want)
@@ -604,7 +579,6 @@ func Test_udupFSM_applyAllocClientUpdate(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		buf   []byte
@@ -627,7 +601,6 @@ func Test_udupFSM_applyAllocClientUpdate(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if got := n.applyAllocClientUpdate(tt.args.buf, tt.args.index); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("udupFSM.applyAllocClientUpdate() = %v, want %v", got, tt.want)
@@ -644,7 +617,6 @@ func Test_udupFSM_Snapshot(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	tests := []struct {
 		name    string
@@ -663,7 +635,6 @@ func Test_udupFSM_Snapshot(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			got, err := n.Snapshot()
 			if (err != nil) != tt.wantErr {
@@ -685,7 +656,6 @@ func Test_udupFSM_Restore(t *testing.T) {
 		logger       *log.Logger
 		state        *store.StateStore
 		timetable    *TimeTable
-		stateLock    sync.RWMutex
 	}
 	type args struct {
 		old io.ReadCloser
@@ -707,7 +677,6 @@ func Test_udupFSM_Restore(t *testing.T) {
 				logger:       tt.fields.logger,
 				state:        tt.fields.state,
 				timetable:    tt.fields.timetable,
-				stateLock:    tt.fields.stateLock,
 			}
 			if err := n.Restore(tt.args.old); (err != nil) != tt.wantErr {
 				t.Errorf("udupFSM.Restore() error = %v, wantErr %v", err, tt.wantErr)
@@ -916,3 +885,164 @@ func Test_udupSnapshot_Release(t *testing.T) {
 		})
 	}
 }
+
+func Test_udupFSM_applyBatch(t *testing.T) {
+	encode := func(t models.MessageType, msg interface{}) []byte {
+		buf, err := models.Encode(t, msg)
+		if err != nil {
+			panic(err)
+		}
+		return buf
+	}
+	jobA := encode(models.JobRegisterRequestType, &models.JobRegisterRequest{
+		Job: &models.Job{ID: "a", Type: models.JobTypeSync}})
+	jobB := encode(models.JobRegisterRequestType, &models.JobRegisterRequest{
+		Job: &models.Job{ID: "b", Type: models.JobTypeSync}})
+	missingJob := encode(models.JobUpdateStatusRequestType, &models.JobUpdateStatusRequest{
+		JobID: "missing", Status: models.JobStatusRunning})
+	nested := encode(models.BatchRequestType, &models.BatchRequest{Entries: [][]byte{jobB}})
+	eval := encode(models.EvalUpdateRequestType, &models.EvalUpdateRequest{Evals: []*models.Evaluation{{
+		ID: models.GenerateUUID(), JobID: "a", Type: models.JobTypeSync, Status: models.EvalStatusPending}}})
+
+	tests := []struct {
+		name      string
+		entries   [][]byte
+		wantErr   bool
+		wantJobs  []string
+		wantReady int
+	}{
+		{"applied in order", [][]byte{jobA, eval, jobB}, false, []string{"a", "b"}, 1},
+		{"rolled back", [][]byte{jobA, eval, missingJob, jobB}, true, nil, 0},
+		{"nested batch", [][]byte{jobA, nested}, true, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := store.NewStateStore(ioutil.Discard)
+			if err != nil {
+				t.Fatalf("store.NewStateStore() error = %v", err)
+			}
+			broker, err := NewEvalBroker(time.Minute, 3)
+			if err != nil {
+				t.Fatalf("NewEvalBroker() error = %v", err)
+			}
+			broker.SetEnabled(true)
+			n := &udupFSM{state: state, evalBroker: broker, logger: log.New(ioutil.Discard, log.ErrorLevel)}
+
+			buf := encode(models.BatchRequestType, &models.BatchRequest{Entries: tt.entries})
+			resp := n.applyBatch(buf[1:], 10)
+			if err, _ := resp.(error); (err != nil) != tt.wantErr {
+				t.Fatalf("udupFSM.applyBatch() = %v, wantErr %v", resp, tt.wantErr)
+			}
+
+			var got []string
+			iter, err := state.Jobs(nil)
+			if err != nil {
+				t.Fatalf("StateStore.Jobs() error = %v", err)
+			}
+			for raw := iter.Next(); raw != nil; raw = iter.Next() {
+				got = append(got, raw.(*models.Job).ID)
+			}
+			if !reflect.DeepEqual(got, tt.wantJobs) {
+				t.Errorf("udupFSM.applyBatch() left jobs %v, want %v", got, tt.wantJobs)
+			}
+			if index, _ := state.Index("jobs"); tt.wantErr && index != 0 {
+				t.Errorf("udupFSM.applyBatch() left the jobs index at %d", index)
+			}
+			// The evals of a rolled back batch must not be enqueued
+			if ready := broker.Stats().TotalReady; ready != tt.wantReady {
+				t.Errorf("udupFSM.applyBatch() enqueued %d evals, want %d", ready, tt.wantReady)
+			}
+		})
+	}
+}
+
+func Test_udupFSM_applyStats(t *testing.T) {
+	encode := func(t models.MessageType, msg interface{}) []byte {
+		buf, err := models.Encode(t, msg)
+		if err != nil {
+			panic(err)
+		}
+		return buf
+	}
+	jobA := encode(models.JobRegisterRequestType, &models.JobRegisterRequest{
+		Job: &models.Job{ID: "a", Type: models.JobTypeSync}})
+	jobB := encode(models.JobRegisterRequestType, &models.JobRegisterRequest{
+		Job: &models.Job{ID: "b", Type: models.JobTypeSync}})
+	deregister := encode(models.JobDeregisterRequestType, &models.JobDeregisterRequest{JobID: "a"})
+	batch := encode(models.BatchRequestType, &models.BatchRequest{Entries: [][]byte{jobB, deregister}})
+
+	state, err := store.NewStateStore(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("store.NewStateStore() error = %v", err)
+	}
+	n := &udupFSM{
+		state:     state,
+		timetable: NewTimeTable(timeTableGranularity, timeTableLimit),
+		logger:    log.New(ioutil.Discard, log.ErrorLevel),
+	}
+	if got := n.applyStats(); len(got) != 0 {
+		t.Fatalf("udupFSM.applyStats() = %v before any apply", got)
+	}
+	for i, buf := range [][]byte{jobA, batch} {
+		if resp := n.Apply(&raft.Log{Index: uint64(10 + i), Data: buf}); resp != nil {
+			t.Fatalf("udupFSM.Apply() = %v", resp)
+		}
+	}
+
+	want := map[string]uint64{"JobRegister": 2, "JobDeregister": 1}
+	if got := n.applyStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("udupFSM.applyStats() = %v, want %v", got, want)
+	}
+}
+
+func Test_udupFSM_applyJobConfigUpdate(t *testing.T) {
+	state, err := store.NewStateStore(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("store.NewStateStore() error = %v", err)
+	}
+	n := &udupFSM{state: state, logger: log.New(ioutil.Discard, log.ErrorLevel)}
+
+	job := &models.Job{ID: "a", Type: models.JobTypeSync, Tasks: []*models.Task{{
+		Type:       models.TaskTypeDest,
+		ConfigLock: &sync.RWMutex{},
+		Config:     map[string]interface{}{"ParallelWorkers": 1, "Gtid": "applied"},
+	}}}
+	if err := state.UpsertJob(10, job); err != nil {
+		t.Fatalf("StateStore.UpsertJob() error = %v", err)
+	}
+	running := &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), JobID: "a", Job: job, Task: models.TaskTypeDest,
+		DesiredStatus: models.AllocDesiredStatusRun, ClientStatus: models.AllocClientStatusRunning}
+	failed := &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), JobID: "a", Job: job, Task: models.TaskTypeDest,
+		DesiredStatus: models.AllocDesiredStatusRun, ClientStatus: models.AllocClientStatusFailed}
+	if err := state.UpsertAllocs(11, []*models.Allocation{running, failed}); err != nil {
+		t.Fatalf("StateStore.UpsertAllocs() error = %v", err)
+	}
+
+	buf, err := models.Encode(models.JobConfigUpdateRequestType, &models.JobConfigUpdateRequest{
+		JobID: "a",
+		Tasks: []*models.Task{{
+			Type:   models.TaskTypeDest,
+			Config: map[string]interface{}{"ParallelWorkers": 4, "ThrottleRowsPerSecond": 100},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := n.applyJobConfigUpdate(buf[1:], 12); resp != nil {
+		t.Fatalf("udupFSM.applyJobConfigUpdate() = %v", resp)
+	}
+
+	want := map[string]interface{}{"ParallelWorkers": int64(4), "ThrottleRowsPerSecond": int64(100), "Gtid": "applied"}
+	got, _ := state.JobByID(nil, "a")
+	if !reflect.DeepEqual(got.Tasks[0].Config, want) || got.JobModifyIndex != 12 {
+		t.Errorf("job config = %v at %d, want %v at 12", got.Tasks[0].Config, got.JobModifyIndex, want)
+	}
+	alloc, _ := state.AllocByID(nil, running.ID)
+	if !reflect.DeepEqual(alloc.Job.Tasks[0].Config, want) || alloc.AllocModifyIndex != 12 {
+		t.Errorf("running alloc config = %v at %d, want %v at 12", alloc.Job.Tasks[0].Config, alloc.AllocModifyIndex, want)
+	}
+	alloc, _ = state.AllocByID(nil, failed.ID)
+	if alloc.AllocModifyIndex != 11 || alloc.Job.Tasks[0].Config["ParallelWorkers"] != 1 {
+		t.Errorf("failed alloc updated: config %v at %d", alloc.Job.Tasks[0].Config, alloc.AllocModifyIndex)
+	}
+}
@@ -9,7 +9,6 @@ package server
 import (
 	"net"
 	"net/rpc"
-	"sync"
 	"testing"
 	"time"
 	uconf "github.com/actiontech/dtle/internal/config"
@@ -42,7 +41,6 @@ func TestServer_initializeHeartbeatTimers(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -50,12 +48,10 @@ func TestServer_initializeHeartbeatTimers(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -85,7 +81,6 @@ func TestServer_initializeHeartbeatTimers(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -93,12 +88,10 @@ func TestServer_initializeHeartbeatTimers(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.initializeHeartbeatTimers(); (err != nil) != tt.wantErr {
 				t.Errorf("Server.initializeHeartbeatTimers() error = %v, wantErr %v", err, tt.wantErr)
@@ -127,7 +120,6 @@ func TestServer_resetHeartbeatTimer(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -135,12 +127,10 @@ func TestServer_resetHeartbeatTimer(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		id string
@@ -175,7 +165,6 @@ func TestServer_resetHeartbeatTimer(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -183,12 +172,10 @@ func TestServer_resetHeartbeatTimer(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			got, err := s.resetHeartbeatTimer(tt.args.id)
 			if (err != nil) != tt.wantErr {
@@ -222,7 +209,6 @@ func TestServer_resetHeartbeatTimerLocked(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -230,12 +216,10 @@ func TestServer_resetHeartbeatTimerLocked(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		id  string
@@ -269,7 +253,6 @@ func TestServer_resetHeartbeatTimerLocked(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -277,12 +260,10 @@ func TestServer_resetHeartbeatTimerLocked(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.resetHeartbeatTimerLocked(tt.args.id, tt.args.ttl)
 		})
@@ -309,7 +290,6 @@ func TestServer_invalidateHeartbeat(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -317,12 +297,10 @@ func TestServer_invalidateHeartbeat(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		id string
@@ -355,7 +333,6 @@ func TestServer_invalidateHeartbeat(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -363,12 +340,10 @@ func TestServer_invalidateHeartbeat(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.invalidateHeartbeat(tt.args.id)
 		})
@@ -395,7 +370,6 @@ func TestServer_clearHeartbeatTimer(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -403,12 +377,10 @@ func TestServer_clearHeartbeatTimer(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		id string
@@ -442,7 +414,6 @@ func TestServer_clearHeartbeatTimer(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -450,12 +421,10 @@ func TestServer_clearHeartbeatTimer(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.clearHeartbeatTimer(tt.args.id); (err != nil) != tt.wantErr {
 				t.Errorf("Server.clearHeartbeatTimer() error = %v, wantErr %v", err, tt.wantErr)
@@ -484,7 +453,6 @@ func TestServer_clearAllHeartbeatTimers(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -492,12 +460,10 @@ func TestServer_clearAllHeartbeatTimers(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -527,7 +493,6 @@ func TestServer_clearAllHeartbeatTimers(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -535,12 +500,10 @@ func TestServer_clearAllHeartbeatTimers(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.clearAllHeartbeatTimers(); (err != nil) != tt.wantErr {
 				t.Errorf("Server.clearAllHeartbeatTimers() error = %v, wantErr %v", err, tt.wantErr)
@@ -569,7 +532,6 @@ func TestServer_heartbeatStats(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -577,12 +539,10 @@ func TestServer_heartbeatStats(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -611,7 +571,6 @@ func TestServer_heartbeatStats(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -619,12 +578,10 @@ func TestServer_heartbeatStats(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.heartbeatStats()
 		})
@@ -31,6 +31,7 @@ func (m *Internal) NodeInfo(args *models.NodeSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "nodes",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Capture all the nodes
 			var err error
@@ -64,6 +65,7 @@ func (m *Internal) NodeDump(args *models.DCSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "nodes",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Capture all the nodes
 			var err error
@@ -7,13 +7,16 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-memdb"
+	"github.com/hashicorp/go-msgpack/codec"
 
 	"github.com/actiontech/dtle/internal/client/driver"
+	uconf "github.com/actiontech/dtle/internal/config"
 	"github.com/actiontech/dtle/internal/models"
 	"github.com/actiontech/dtle/internal/server/scheduler"
 	"github.com/actiontech/dtle/internal/server/store"
@@ -45,6 +48,10 @@ func (j *Job) Register(args *models.JobRegisterRequest, reply *models.JobRespons
 		reply.Success = false
 		return fmt.Errorf("missing job for registration")
 	}
+	if err := j.checkMaintenance(); err != nil {
+		reply.Success = false
+		return err
+	}
 
 	// Initialize the job fields (sets defaults and any necessary init work).
 	args.Job.Canonicalize()
@@ -87,7 +94,7 @@ func (j *Job) Register(args *models.JobRegisterRequest, reply *models.JobRespons
 	// Commit this update via Raft
 	_, index, err := j.srv.raftApply(models.JobRegisterRequestType, args)
 	if err != nil {
-		j.srv.logger.Errorf("server.job: Register failed: %v", err)
+		j.srv.requestLog(args, args.Job.ID).Errorf("server.job: Register failed: %v", err)
 		reply.Success = false
 		return err
 	}
@@ -111,7 +118,7 @@ func (j *Job) Register(args *models.JobRegisterRequest, reply *models.JobRespons
 	// but that the EvalUpdate does not.
 	_, evalIndex, err := j.srv.raftApply(models.EvalUpdateRequestType, update)
 	if err != nil {
-		j.srv.logger.Errorf("server.job: Eval create failed: %v", err)
+		j.srv.requestLog(args, args.Job.ID).Errorf("server.job: Eval create failed: %v", err)
 		reply.Success = false
 		return err
 	}
@@ -148,7 +155,7 @@ func (j *Job) Renewal(args *models.JobRenewalRequest, reply *models.JobResponse)
 	// Commit this update via Raft
 	_, index, err := j.srv.raftApply(models.JobRenewalRequestType, args)
 	if err != nil {
-		j.srv.logger.Errorf("server.job: Renewal failed: %v", err)
+		j.srv.requestLog(args, args.JobID).Errorf("server.job: Renewal failed: %v", err)
 		reply.Success = false
 		return err
 	}
@@ -176,66 +183,242 @@ func (j *Job) UpdateStatus(args *models.JobUpdateStatusRequest, reply *models.Jo
 		return fmt.Errorf("invalid status for job")
 	}
 
-	// Look for the job
-	snap, err := j.srv.fsm.State().Snapshot()
+	job, err := j.lookupJob(args.JobID)
 	if err != nil {
 		reply.Success = false
 		return err
 	}
+	if job.Status == models.JobStatusCancelled {
+		reply.Success = false
+		return fmt.Errorf("job %q is cancelled", args.JobID)
+	}
+	if job.Status == models.JobStatusPause && args.Status == models.JobStatusRunning {
+		if err := j.checkMaintenance(); err != nil {
+			reply.Success = false
+			return err
+		}
+	}
+	// Commit this update via Raft
+	if job.Status != args.Status {
+		return j.applyStatus(job, args, reply)
+	}
 
-	ws := memdb.NewWatchSet()
-	job, err := snap.JobByID(ws, args.JobID)
+	return nil
+}
+
+// Pause is used to pause a running job. Its tasks stop their work, without
+// being torn down, until the job is resumed.
+func (j *Job) Pause(args *models.JobPauseRequest, reply *models.JobResponse) error {
+	if done, err := j.srv.forward("Job.Pause", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "pause"}, time.Now())
+
+	return j.setPaused(args, models.JobStatusPause, models.JobStatusRunning, reply)
+}
+
+// Resume is used to resume a paused job. Its tasks go on with their work
+// from where they stopped.
+func (j *Job) Resume(args *models.JobPauseRequest, reply *models.JobResponse) error {
+	if done, err := j.srv.forward("Job.Resume", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "resume"}, time.Now())
+
+	if err := j.checkMaintenance(); err != nil {
+		reply.Success = false
+		return err
+	}
+	return j.setPaused(args, models.JobStatusRunning, models.JobStatusPause, reply)
+}
+
+// Update changes the configuration of the tasks of a job, which reload it
+// as they run, without restarting. Only the fields of ReloadableConfig may
+// change, the job has to be created again to change the others.
+func (j *Job) Update(args *models.JobConfigUpdateRequest, reply *models.JobConfigUpdateResponse) error {
+	if done, err := j.srv.forward("Job.Update", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "update"}, time.Now())
+
+	if args.JobID == "" {
+		reply.Success = false
+		return fmt.Errorf("missing job ID")
+	}
+	job, err := j.lookupJob(args.JobID)
 	if err != nil {
 		reply.Success = false
 		return err
 	}
-	if job == nil {
+	if job.Status != models.JobStatusRunning && job.Status != models.JobStatusPause {
 		reply.Success = false
-		return fmt.Errorf("job not found")
+		return fmt.Errorf("job %q is %s, not running", args.JobID, job.Status)
+	}
+
+	changed, err := configChanges(job, args.Tasks, j.srv.config.SecretsKeyring)
+	if err != nil {
+		reply.Success = false
+		return err
 	}
+	reply.Changed = changed
+	if len(changed) == 0 {
+		reply.Success = true
+		reply.Index = job.ModifyIndex
+		return nil
+	}
+
 	// Commit this update via Raft
-	if job.Status != args.Status {
-		_, index, err := j.srv.raftApply(models.JobUpdateStatusRequestType, args)
-		if err != nil {
-			j.srv.logger.Errorf("server.job: status update failed: %v", err)
-			reply.Success = false
-			return err
+	_, index, err := j.srv.raftApply(models.JobConfigUpdateRequestType, args)
+	if err != nil {
+		j.srv.requestLog(args, args.JobID).Errorf("server.job: config update failed: %v", err)
+		reply.Success = false
+		return err
+	}
+	reply.Success = true
+	reply.Index = index
+	return nil
+}
+
+// configChanges returns the fields of the configuration of the tasks of job
+// that differ in tasks, by task type. The secrets are compared once opened
+// by keyring, those of job being sealed.
+func configChanges(job *models.Job, tasks []*models.Task, keyring *uconf.Keyring) (map[string][]string, error) {
+	if len(tasks) != len(job.Tasks) {
+		return nil, fmt.Errorf("the job has %d tasks, not %d: create the job again to change its tasks", len(job.Tasks), len(tasks))
+	}
+	changes := make(map[string][]string)
+	for _, t := range tasks {
+		existing := job.LookupTask(t.Type)
+		if existing == nil {
+			return nil, fmt.Errorf("the job has no task %s: create the job again to change its tasks", t.Type)
 		}
-		var triggeredBy string
-		if args.Status == models.JobStatusPause {
-			triggeredBy = models.EvalTriggerJobPause
-		} else {
-			triggeredBy = models.EvalTriggerJobResume
+		if t.Driver != "" && t.Driver != existing.Driver {
+			return nil, fmt.Errorf("the driver of task %s can't be reloaded: create the job again to change it", t.Type)
 		}
-		// Create a new evaluation
-		eval := &models.Evaluation{
-			ID:             models.GenerateUUID(),
-			Type:           job.Type,
-			TriggeredBy:    triggeredBy,
-			JobID:          args.JobID,
-			JobModifyIndex: index,
-			Status:         models.EvalStatusPending,
+		from, err := keyring.OpenTaskConfig(existing.Config)
+		if err != nil {
+			return nil, err
 		}
-		update := &models.EvalUpdateRequest{
-			Evals:        []*models.Evaluation{eval},
-			WriteRequest: models.WriteRequest{Region: args.Region},
+		to, err := keyring.OpenTaskConfig(t.Config)
+		if err != nil {
+			return nil, err
 		}
-
-		// Commit this evaluation via Raft
-		// XXX: There is a risk of partial failure where the JobRegister succeeds
-		// but that the EvalUpdate does not.
-		_, evalIndex, err := j.srv.raftApply(models.EvalUpdateRequestType, update)
+		changed, err := models.ConfigChanges(t.Type, from, to)
 		if err != nil {
-			j.srv.logger.Errorf("server.job: Eval create failed: %v", err)
-			reply.Success = false
-			return err
+			return nil, err
+		}
+		if len(changed) != 0 {
+			changes[t.Type] = changed
 		}
+	}
+	return changes, nil
+}
+
+// setPaused moves the job of args to status, from the status from only.
+// A job already in status is left as is.
+func (j *Job) setPaused(args *models.JobPauseRequest, status, from string, reply *models.JobResponse) error {
+	if args.JobID == "" {
+		reply.Success = false
+		return fmt.Errorf("missing job ID")
+	}
 
-		// Populate the reply with eval information
+	job, err := j.lookupJob(args.JobID)
+	if err != nil {
+		reply.Success = false
+		return err
+	}
+	switch job.Status {
+	case status:
 		reply.Success = true
-		reply.Index = evalIndex
+		reply.Index = job.ModifyIndex
+		return nil
+	case from:
+	default:
+		reply.Success = false
+		return fmt.Errorf("job %q is %s, not %s", args.JobID, job.Status, from)
+	}
+
+	update := &models.JobUpdateStatusRequest{
+		JobID:        args.JobID,
+		Status:       status,
+		WriteRequest: args.WriteRequest,
+	}
+	return j.applyStatus(job, update, reply)
+}
+
+// lookupJob returns the job jobID, or an error if it doesn't exist
+func (j *Job) lookupJob(jobID string) (*models.Job, error) {
+	snap, err := j.srv.fsm.State().Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	ws := memdb.NewWatchSet()
+	job, err := snap.JobByID(ws, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, fmt.Errorf("job not found")
+	}
+	return job, nil
+}
+
+// checkMaintenance returns ErrMaintenanceMode if the cluster is in
+// maintenance mode, when no job may start
+func (j *Job) checkMaintenance() error {
+	mode, err := j.srv.fsm.State().Maintenance(memdb.NewWatchSet())
+	if err != nil {
+		return err
+	}
+	if mode.Enabled {
+		return models.ErrMaintenanceMode
+	}
+	return nil
+}
+
+// applyStatus commits the status update of job via Raft, and creates the
+// evaluation pausing or resuming its allocations
+func (j *Job) applyStatus(job *models.Job, args *models.JobUpdateStatusRequest, reply *models.JobResponse) error {
+	_, index, err := j.srv.raftApply(models.JobUpdateStatusRequestType, args)
+	if err != nil {
+		j.srv.requestLog(args, args.JobID).Errorf("server.job: status update failed: %v", err)
+		reply.Success = false
+		return err
+	}
+	var triggeredBy string
+	if args.Status == models.JobStatusPause {
+		triggeredBy = models.EvalTriggerJobPause
+	} else {
+		triggeredBy = models.EvalTriggerJobResume
+	}
+	// Create a new evaluation
+	eval := &models.Evaluation{
+		ID:             models.GenerateUUID(),
+		Type:           job.Type,
+		TriggeredBy:    triggeredBy,
+		JobID:          args.JobID,
+		JobModifyIndex: index,
+		Status:         models.EvalStatusPending,
+	}
+	update := &models.EvalUpdateRequest{
+		Evals:        []*models.Evaluation{eval},
+		WriteRequest: models.WriteRequest{Region: args.Region},
+	}
+
+	// Commit this evaluation via Raft
+	// XXX: There is a risk of partial failure where the JobRegister succeeds
+	// but that the EvalUpdate does not.
+	_, evalIndex, err := j.srv.raftApply(models.EvalUpdateRequestType, update)
+	if err != nil {
+		j.srv.requestLog(args, args.JobID).Errorf("server.job: Eval create failed: %v", err)
+		reply.Success = false
+		return err
 	}
 
+	// Populate the reply with eval information
+	reply.Success = true
+	reply.Index = evalIndex
 	return nil
 }
 
@@ -272,10 +455,111 @@ func (j *Job) Validate(args *models.JobValidateRequest,
 		rep.Type = task.Type
 		reply.ValidationTasks = append(reply.ValidationTasks, rep)
 	}
+
+	// Check the tables of the source against those already on the target
+	src, dest := args.Job.LookupTask(models.TaskTypeSrc), args.Job.LookupTask(models.TaskTypeDest)
+	if src != nil && dest != nil && src.Driver == models.TaskDriverMySQL && dest.Driver == models.TaskDriverMySQL {
+		var srcRep, destRep *models.TaskValidateResponse
+		for _, rep := range reply.ValidationTasks {
+			switch rep.Type {
+			case models.TaskTypeSrc:
+				srcRep = rep
+			case models.TaskTypeDest:
+				destRep = rep
+			}
+		}
+		if srcRep.Connection.Success && destRep.Connection.Success {
+			destRep.AddCheck("schemas", driver.ValidateSchemas(src, dest, j.srv.config.SecretsKeyring))
+		}
+	}
+
+	reply.Valid = true
+	for _, rep := range reply.ValidationTasks {
+		reply.Valid = reply.Valid && rep.Valid()
+	}
 	reply.DriverConfigValidated = true
 	return nil
 }
 
+// Verify starts comparing the rows of the tables a job replicates on the
+// source and on the target, while it runs. The comparison runs in the
+// background, VerifyStatus tells how it went.
+func (j *Job) Verify(args *models.JobVerifyRequest, reply *models.JobVerifyResponse) error {
+	if done, err := j.srv.forward("Job.Verify", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "verify"}, time.Now())
+
+	job, err := j.lookupJob(args.JobID)
+	if err != nil {
+		return err
+	}
+	src, dest := job.LookupTask(models.TaskTypeSrc), job.LookupTask(models.TaskTypeDest)
+	if src == nil || dest == nil || src.Driver != models.TaskDriverMySQL || dest.Driver != models.TaskDriverMySQL {
+		return fmt.Errorf("job %q does not replicate from MySQL to MySQL", args.JobID)
+	}
+
+	keyring := j.srv.config.SecretsKeyring
+	reply.Verification = j.srv.verifications.start(args.JobID, func() ([]*models.TableVerification, error) {
+		return driver.VerifyTables(src, dest, args.ChunkSize, keyring)
+	})
+	j.srv.requestLog(args, args.JobID).Infof("server.job: verifying the tables in %s",
+		reply.Verification.ID)
+	return nil
+}
+
+// VerifyStatus returns the last comparison of the tables of a job started
+// by Verify, running or not
+func (j *Job) VerifyStatus(args *models.JobVerifyStatusRequest, reply *models.JobVerifyResponse) error {
+	if done, err := j.srv.forward("Job.VerifyStatus", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "verify_status"}, time.Now())
+
+	reply.Verification = j.srv.verifications.get(args.JobID)
+	if reply.Verification == nil {
+		return fmt.Errorf("job %q was not verified since the leader was elected", args.JobID)
+	}
+	return nil
+}
+
+// Replay applies again the transactions of a job from one GTID to another,
+// in a job of its own that completes after the last one, leaving the job
+// replicating as it was
+func (j *Job) Replay(args *models.JobReplayRequest, reply *models.JobReplayResponse) error {
+	if done, err := j.srv.forward("Job.Replay", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "replay"}, time.Now())
+
+	job, err := j.lookupJob(args.JobID)
+	if err != nil {
+		return err
+	}
+	src, dest := job.LookupTask(models.TaskTypeSrc), job.LookupTask(models.TaskTypeDest)
+	if src == nil || dest == nil || src.Driver != models.TaskDriverMySQL || dest.Driver != models.TaskDriverMySQL {
+		return fmt.Errorf("job %q does not replicate from MySQL to MySQL", args.JobID)
+	}
+
+	replay, err := driver.ReplayJob(job, args.GtidStart, args.GtidStop, args.Target)
+	if err != nil {
+		return err
+	}
+	register := &models.JobRegisterRequest{
+		Job:          replay,
+		WriteRequest: args.WriteRequest,
+	}
+	var registerReply models.JobResponse
+	if err := j.Register(register, &registerReply); err != nil {
+		return err
+	}
+	j.srv.requestLog(args, args.JobID).Infof("server.job: replaying %s to %s in job %s",
+		args.GtidStart, args.GtidStop, replay.ID)
+	reply.ReplayJobID = replay.ID
+	reply.Index = registerReply.Index
+	return nil
+}
+
 // Evaluate is used to force a job for re-evaluation
 func (j *Job) Evaluate(args *models.JobEvaluateRequest, reply *models.JobResponse) error {
 	if done, err := j.srv.forward("Job.Evaluate", args, args, reply); done {
@@ -323,7 +607,7 @@ func (j *Job) Evaluate(args *models.JobEvaluateRequest, reply *models.JobRespons
 	// Commit this evaluation via Raft
 	_, evalIndex, err := j.srv.raftApply(models.EvalUpdateRequestType, update)
 	if err != nil {
-		j.srv.logger.Errorf("server.job: Eval create failed: %v", err)
+		j.srv.requestLog(args, job.ID).Errorf("server.job: Eval create failed: %v", err)
 		reply.Success = false
 		return err
 	}
@@ -350,7 +634,7 @@ func (j *Job) Deregister(args *models.JobDeregisterRequest, reply *models.JobRes
 	// Commit this update via Raft
 	_, index, err := j.srv.raftApply(models.JobDeregisterRequestType, args)
 	if err != nil {
-		j.srv.logger.Errorf("server.job: Deregister failed: %v", err)
+		j.srv.requestLog(args, args.JobID).Errorf("server.job: Deregister failed: %v", err)
 		reply.Success = false
 		return err
 	}
@@ -375,7 +659,7 @@ func (j *Job) Deregister(args *models.JobDeregisterRequest, reply *models.JobRes
 	// Commit this evaluation via Raft
 	_, evalIndex, err := j.srv.raftApply(models.EvalUpdateRequestType, update)
 	if err != nil {
-		j.srv.logger.Errorf("server.job: Eval create failed: %v", err)
+		j.srv.requestLog(args, args.JobID).Errorf("server.job: Eval create failed: %v", err)
 		reply.Success = false
 		return err
 	}
@@ -386,6 +670,36 @@ func (j *Job) Deregister(args *models.JobDeregisterRequest, reply *models.JobRes
 	return nil
 }
 
+// Cancel is used to cancel a job whose tasks can't be stopped otherwise,
+// as when the servers and the clients disagree on its state. The job is
+// marked cancelled and its allocations to stop, for the clients to tear
+// its tasks down, and those that still run one of them later kill it. A
+// job that doesn't exist or is already cancelled is left as is.
+func (j *Job) Cancel(args *models.JobCancelRequest, reply *models.JobResponse) error {
+	if done, err := j.srv.forward("Job.Cancel", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "cancel"}, time.Now())
+
+	if args.JobID == "" {
+		reply.Success = false
+		return fmt.Errorf("missing job ID")
+	}
+
+	// Commit this update via Raft
+	_, index, err := j.srv.raftApply(models.JobCancelRequestType, args)
+	if err != nil {
+		j.srv.requestLog(args, args.JobID).Errorf("server.job: Cancel failed: %v", err)
+		reply.Success = false
+		return err
+	}
+	j.srv.requestLog(args, args.JobID).Infof("server.job: job cancelled at index %d", index)
+
+	reply.Success = true
+	reply.Index = index
+	return nil
+}
+
 // GetJob is used to request information about a specific job
 func (j *Job) GetJob(args *models.JobSpecificRequest,
 	reply *models.SingleJobResponse) error {
@@ -398,6 +712,7 @@ func (j *Job) GetJob(args *models.JobSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "jobs",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Look for the job
 			out, err := state.JobByID(ws, args.JobID)
@@ -437,6 +752,7 @@ func (j *Job) List(args *models.JobListRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "jobs",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Capture all the jobs
 			var err error
@@ -450,31 +766,24 @@ func (j *Job) List(args *models.JobListRequest,
 				return err
 			}
 
+			pager, err := newPaginator(iter, &args.QueryOptions, func(raw interface{}) string {
+				return raw.(*models.Job).ID
+			})
+			if err != nil {
+				return err
+			}
+
 			var jobs []*models.JobListStub
 			for {
-				raw := iter.Next()
+				raw := pager.Next()
 				if raw == nil {
 					break
 				}
-				job := raw.(*models.Job)
-				jobCopy0, err := copystructure.Copy(job)
+				stub, err := jobListStub(raw.(*models.Job))
 				if err != nil {
 					return err
 				}
-				jobCopy, ok := jobCopy0.(*models.Job)
-				if !ok {
-					return fmt.Errorf("failed to deep copy job")
-				}
-				//fmt.Printf("**** mask password\n")
-				for _, t := range jobCopy.Tasks {
-					if connCfg, ok := t.Config["ConnectionConfig"]; ok {
-						if connCfgMap, ok := connCfg.(map[string]interface{}); ok {
-							//getStar := func() string { return "*" }
-							connCfgMap["Password"] = MaskedPassword
-						}
-					}
-				}
-				jobs = append(jobs, job.Stub(jobCopy))
+				jobs = append(jobs, stub)
 			}
 			reply.Jobs = jobs
 
@@ -484,6 +793,7 @@ func (j *Job) List(args *models.JobListRequest,
 				return err
 			}
 			reply.Index = index
+			pager.setMeta(&reply.QueryMeta, index)
 
 			// Set the query response
 			j.srv.setQueryMeta(&reply.QueryMeta)
@@ -492,6 +802,55 @@ func (j *Job) List(args *models.JobListRequest,
 	return j.srv.blockingRPC(&opts)
 }
 
+// ListStream is the streaming variant of List, sending the stubs of the
+// jobs as they are iterated instead of in a single reply
+func (j *Job) ListStream(ctx context.Context, args *models.JobListRequest, enc *codec.Encoder) error {
+	return j.srv.streamList(ctx, "Job.ListStream", &args.QueryOptions, "jobs", enc,
+		func(state *store.StateStore, l *listStreamer) error {
+			var err error
+			var iter memdb.ResultIterator
+			if prefix := args.QueryOptions.Prefix; prefix != "" {
+				iter, err = state.JobsByIDPrefix(nil, prefix)
+			} else {
+				iter, err = state.Jobs(nil)
+			}
+			if err != nil {
+				return err
+			}
+			for raw := iter.Next(); raw != nil; raw = iter.Next() {
+				stub, err := jobListStub(raw.(*models.Job))
+				if err != nil {
+					return err
+				}
+				if err := l.add(stub); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+}
+
+// jobListStub returns the stub of job listing it, with the passwords of
+// its connections masked
+func jobListStub(job *models.Job) (*models.JobListStub, error) {
+	jobCopy0, err := copystructure.Copy(job)
+	if err != nil {
+		return nil, err
+	}
+	jobCopy, ok := jobCopy0.(*models.Job)
+	if !ok {
+		return nil, fmt.Errorf("failed to deep copy job")
+	}
+	for _, t := range jobCopy.Tasks {
+		if connCfg, ok := t.Config["ConnectionConfig"]; ok {
+			if connCfgMap, ok := connCfg.(map[string]interface{}); ok {
+				connCfgMap["Password"] = MaskedPassword
+			}
+		}
+	}
+	return job.Stub(jobCopy), nil
+}
+
 // Allocations is used to list the allocations for a job
 func (j *Job) Allocations(args *models.JobSpecificRequest,
 	reply *models.JobAllocationsResponse) error {
@@ -504,6 +863,7 @@ func (j *Job) Allocations(args *models.JobSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "allocs",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Capture the allocations
 			allocs, err := state.AllocsByJob(ws, args.JobID, args.AllAllocs)
@@ -546,6 +906,7 @@ func (j *Job) Evaluations(args *models.JobSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "evals",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Capture the evals
 			var err error
@@ -569,6 +930,55 @@ func (j *Job) Evaluations(args *models.JobSpecificRequest,
 	return j.srv.blockingRPC(&opts)
 }
 
+// Events is used to list the last events of the tasks of a job matching
+// the filters of args. As a blocking query, it returns once the job has
+// new events, so that they can be followed.
+func (j *Job) Events(args *models.JobEventsRequest,
+	reply *models.JobEventsResponse) error {
+	if done, err := j.srv.forward("Job.Events", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "job", "events"}, time.Now())
+
+	if err := args.Validate(); err != nil {
+		return err
+	}
+
+	// Setup the blocking query
+	opts := blockingOptions{
+		queryOpts: &args.QueryOptions,
+		queryMeta: &reply.QueryMeta,
+		table:     "job_events",
+		run: func(ws memdb.WatchSet, state *store.StateStore) error {
+			// Capture the events
+			events, err := state.JobEventsByID(ws, args.JobID)
+			if err != nil {
+				return err
+			}
+			reply.Events = nil
+			if events != nil {
+				for _, e := range events.Events {
+					if args.Matches(e) {
+						reply.Events = append(reply.Events, e)
+					}
+				}
+			}
+
+			// Use the last index that affected the job events table
+			index, err := state.Index("job_events")
+			if err != nil {
+				return err
+			}
+			reply.Index = index
+
+			// Set the query response
+			j.srv.setQueryMeta(&reply.QueryMeta)
+			return nil
+		}}
+
+	return j.srv.blockingRPC(&opts)
+}
+
 // Plan is used to cause a dry-run evaluation of the Job and return the results
 // with a potential diff containing annotations.
 func (j *Job) Plan(args *models.JobPlanRequest, reply *models.JobPlanResponse) error {
@@ -7,7 +7,13 @@
 package server
 
 import (
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hashicorp/go-memdb"
+
+	uconf "github.com/actiontech/dtle/internal/config"
 	"github.com/actiontech/dtle/internal/models"
 )
 
@@ -67,6 +73,299 @@ func TestJob_UpdateStatus(t *testing.T) {
 	}
 }
 
+func TestJob_PauseResume(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	evalBroker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evalBroker.SetEnabled(true)
+	s.fsm.evalBroker = evalBroker
+	s.fsm.blockedEvals = NewBlockedEvals(evalBroker)
+
+	state := s.fsm.State()
+	if err := state.UpsertJob(5, &models.Job{ID: "a", Type: models.JobTypeSync}); err != nil {
+		t.Fatalf("StateStore.UpsertJob() error = %v", err)
+	}
+	j := &Job{srv: s}
+	pauseReq := func(jobID string) *models.JobPauseRequest {
+		return &models.JobPauseRequest{JobID: jobID, WriteRequest: models.WriteRequest{Region: "global"}}
+	}
+	status := func() string {
+		job, err := state.JobByID(memdb.NewWatchSet(), "a")
+		if err != nil {
+			t.Fatalf("StateStore.JobByID() error = %v", err)
+		}
+		return job.Status
+	}
+
+	var reply models.JobResponse
+	if err := j.Resume(pauseReq("a"), &reply); err == nil || !strings.Contains(err.Error(), "not pause") {
+		t.Errorf("Job.Resume() of a pending job error = %v, want refused", err)
+	}
+	job, err := state.JobByID(memdb.NewWatchSet(), "a")
+	if err != nil {
+		t.Fatalf("StateStore.JobByID() error = %v", err)
+	}
+	alloc := &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), NodeID: "n", JobID: "a", Job: job,
+		DesiredStatus: models.AllocDesiredStatusRun, ClientStatus: models.AllocClientStatusRunning}
+	if err := state.UpsertAllocs(6, []*models.Allocation{alloc}); err != nil {
+		t.Fatalf("StateStore.UpsertAllocs() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		rpc    func(*models.JobPauseRequest, *models.JobResponse) error
+		status string
+	}{
+		{"pause", j.Pause, models.JobStatusPause},
+		{"pause again", j.Pause, models.JobStatusPause},
+		{"resume", j.Resume, models.JobStatusRunning},
+	}
+	for _, tt := range tests {
+		var reply models.JobResponse
+		if err := tt.rpc(pauseReq("a"), &reply); err != nil || !reply.Success {
+			t.Errorf("%s: error = %v, success = %v", tt.name, err, reply.Success)
+		}
+		if got := status(); got != tt.status {
+			t.Errorf("%s: job status = %v, want %v", tt.name, got, tt.status)
+		}
+	}
+	// The evaluations of a job are handed out one at a time
+	if stats := evalBroker.Stats(); stats.TotalReady+stats.TotalBlocked != 2 {
+		t.Errorf("evaluations = %+v, want one to pause and one to resume", stats)
+	}
+
+	if err := j.Pause(pauseReq("missing"), &reply); err == nil {
+		t.Errorf("Job.Pause() of a missing job error = nil")
+	}
+}
+
+func TestJob_Verify(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+
+	conn := map[string]interface{}{"Host": "127.0.0.1", "Port": 1, "User": "root"}
+	jobs := []*models.Job{
+		{ID: "kafka", Type: models.JobTypeSync, Tasks: []*models.Task{
+			{Type: models.TaskTypeSrc, Driver: models.TaskDriverMySQL, Config: map[string]interface{}{"ConnectionConfig": conn}},
+			{Type: models.TaskTypeDest, Driver: models.TaskDriverKafka, Config: map[string]interface{}{}},
+		}},
+		{ID: "mysql", Type: models.JobTypeSync, Tasks: []*models.Task{
+			{Type: models.TaskTypeSrc, Driver: models.TaskDriverMySQL, Config: map[string]interface{}{"ConnectionConfig": conn}},
+			{Type: models.TaskTypeDest, Driver: models.TaskDriverMySQL, Config: map[string]interface{}{"ConnectionConfig": conn}},
+		}},
+	}
+	for i, job := range jobs {
+		if err := s.fsm.State().UpsertJob(uint64(5+i), job); err != nil {
+			t.Fatalf("StateStore.UpsertJob() error = %v", err)
+		}
+	}
+
+	j := &Job{srv: s}
+	tests := []struct {
+		jobID   string
+		wantErr string
+	}{
+		{"missing", "not found"},
+		{"kafka", "does not replicate from MySQL to MySQL"},
+	}
+	for _, tt := range tests {
+		args := &models.JobVerifyRequest{JobID: tt.jobID, QueryOptions: models.QueryOptions{Region: "global"}}
+		var reply models.JobVerifyResponse
+		if err := j.Verify(args, &reply); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Job.Verify(%q) error = %v, want %q", tt.jobID, err, tt.wantErr)
+		}
+	}
+
+	// The tables are compared in the background
+	status := &models.JobVerifyStatusRequest{JobID: "mysql", QueryOptions: models.QueryOptions{Region: "global"}}
+	var reply models.JobVerifyResponse
+	if err := j.VerifyStatus(status, &reply); err == nil {
+		t.Errorf("Job.VerifyStatus() before Job.Verify() error = nil")
+	}
+	args := &models.JobVerifyRequest{JobID: "mysql", QueryOptions: models.QueryOptions{Region: "global"}}
+	if err := j.Verify(args, &reply); err != nil {
+		t.Fatalf("Job.Verify() error = %v", err)
+	}
+	started := reply.Verification
+	if started.ID == "" || started.JobID != "mysql" || started.Status != models.JobVerificationRunning {
+		t.Fatalf("Job.Verify() = %+v, want a running verification", started)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if err := j.VerifyStatus(status, &reply); err != nil {
+			t.Fatalf("Job.VerifyStatus() error = %v", err)
+		}
+		if reply.Verification.Status != models.JobVerificationRunning || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := reply.Verification
+	if got.ID != started.ID || got.Status != models.JobVerificationFailed || !strings.Contains(got.Error, "source: ") || got.EndTime.IsZero() {
+		t.Errorf("Job.VerifyStatus() = %+v, want %s failed to reach the source", got, started.ID)
+	}
+}
+
+func TestJob_Replay(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	evalBroker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evalBroker.SetEnabled(true)
+	s.fsm.evalBroker = evalBroker
+	s.fsm.blockedEvals = NewBlockedEvals(evalBroker)
+
+	conn := map[string]interface{}{"Host": "127.0.0.1", "Port": 1, "User": "root"}
+	job := &models.Job{ID: "mysql", Name: "orders", Type: models.JobTypeSync, Tasks: []*models.Task{
+		{Type: models.TaskTypeSrc, Driver: models.TaskDriverMySQL, Config: map[string]interface{}{
+			"ConnectionConfig": conn, "ApproveHeterogeneous": true, "Gtid": "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-100"}},
+		{Type: models.TaskTypeDest, Driver: models.TaskDriverMySQL, Config: map[string]interface{}{
+			"ConnectionConfig": conn, "approveHeterogeneous": true}},
+	}}
+	if err := s.fsm.State().UpsertJob(5, job); err != nil {
+		t.Fatalf("StateStore.UpsertJob() error = %v", err)
+	}
+
+	j := &Job{srv: s}
+	replayReq := func(start, stop string) *models.JobReplayRequest {
+		return &models.JobReplayRequest{JobID: "mysql", GtidStart: start, GtidStop: stop,
+			Target:       map[string]interface{}{"Host": "127.0.0.2", "Port": 3306},
+			WriteRequest: models.WriteRequest{Region: "global"}}
+	}
+	var reply models.JobReplayResponse
+	if err := j.Replay(replayReq("3e11fa47-71ca-11e1-9e33-c80aa9429562:50", "3e11fa47-71ca-11e1-9e33-c80aa9429562:10"), &reply); err == nil {
+		t.Errorf("Job.Replay() of a stop before the start error = nil")
+	}
+	if err := j.Replay(replayReq("3e11fa47-71ca-11e1-9e33-c80aa9429562:10", "3e11fa47-71ca-11e1-9e33-c80aa9429562:50"), &reply); err != nil {
+		t.Fatalf("Job.Replay() error = %v", err)
+	}
+
+	replay, err := s.fsm.State().JobByID(memdb.NewWatchSet(), reply.ReplayJobID)
+	if err != nil || replay == nil {
+		t.Fatalf("StateStore.JobByID(%q) = %v, %v", reply.ReplayJobID, replay, err)
+	}
+	if !strings.HasPrefix(replay.Name, "orders-replay-") {
+		t.Errorf("replay job name = %q, want orders-replay-", replay.Name)
+	}
+	src, dest := replay.LookupTask(models.TaskTypeSrc), replay.LookupTask(models.TaskTypeDest)
+	if _, ok := src.Config["Gtid"]; ok || src.Config["GtidStop"] != "3e11fa47-71ca-11e1-9e33-c80aa9429562:50" {
+		t.Errorf("replay source config = %v, want GtidStop and no Gtid", src.Config)
+	}
+	if dest.Config["ConflictPolicy"] != "source" || dest.Config["ConnectionConfig"].(map[string]interface{})["Host"] != "127.0.0.2" {
+		t.Errorf("replay target config = %v, want the source ConflictPolicy and the alternate target", dest.Config)
+	}
+	if _, ok := job.LookupTask(models.TaskTypeSrc).Config["GtidStop"]; ok {
+		t.Errorf("replayed job config = %v, want it unchanged", job.LookupTask(models.TaskTypeSrc).Config)
+	}
+}
+
+func TestJob_Cancel(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+
+	job := &models.Job{ID: "stuck", Type: models.JobTypeSync, Status: models.JobStatusRunning,
+		Tasks: []*models.Task{{Type: models.TaskTypeSrc}}}
+	if err := s.fsm.State().UpsertJob(5, job); err != nil {
+		t.Fatalf("StateStore.UpsertJob() error = %v", err)
+	}
+	running := &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), JobID: "stuck", Job: job,
+		Task: models.TaskTypeSrc, DesiredStatus: models.AllocDesiredStatusRun, ClientStatus: models.AllocClientStatusRunning}
+	if err := s.fsm.State().UpsertAllocs(6, []*models.Allocation{running}); err != nil {
+		t.Fatalf("StateStore.UpsertAllocs() error = %v", err)
+	}
+
+	j := &Job{srv: s}
+	for _, id := range []string{"stuck", "stuck", "gone"} {
+		var reply models.JobResponse
+		req := &models.JobCancelRequest{JobID: id, WriteRequest: models.WriteRequest{Region: "global"}}
+		if err := j.Cancel(req, &reply); err != nil || !reply.Success {
+			t.Fatalf("Job.Cancel(%q) = %v, %v", id, reply.Success, err)
+		}
+	}
+
+	got, _ := s.fsm.State().JobByID(memdb.NewWatchSet(), "stuck")
+	if got.Status != models.JobStatusCancelled {
+		t.Errorf("job status = %q, want %q", got.Status, models.JobStatusCancelled)
+	}
+	alloc, _ := s.fsm.State().AllocByID(memdb.NewWatchSet(), running.ID)
+	if alloc.DesiredStatus != models.AllocDesiredStatusStop {
+		t.Errorf("alloc desired status = %q, want %q", alloc.DesiredStatus, models.AllocDesiredStatusStop)
+	}
+
+	// The client reporting the task running doesn't revive the job
+	update := alloc.Copy()
+	update.ClientStatus = models.AllocClientStatusRunning
+	if err := s.fsm.State().UpdateAllocsFromClient(20, []*models.Allocation{update}, 0); err != nil {
+		t.Fatalf("StateStore.UpdateAllocsFromClient() error = %v", err)
+	}
+	if got, _ := s.fsm.State().JobByID(memdb.NewWatchSet(), "stuck"); got.Status != models.JobStatusCancelled {
+		t.Errorf("job status after a client update = %q, want %q", got.Status, models.JobStatusCancelled)
+	}
+}
+
+func TestServer_raftApplySealsSecrets(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	keyring, err := uconf.NewKeyring([][]byte{[]byte("0123456789abcdef")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.config.SecretsKeyring = keyring
+
+	connCfg := map[string]interface{}{"Host": "127.0.0.1", "Password": "secret"}
+	job := &models.Job{ID: "sealed", Name: "sealed", Type: models.JobTypeSync, Tasks: []*models.Task{
+		{Type: models.TaskTypeSrc, Driver: models.TaskDriverMySQL,
+			Config: map[string]interface{}{"ConnectionConfig": connCfg}},
+	}}
+	req := &models.JobRegisterRequest{Job: job, WriteRequest: models.WriteRequest{Region: "global"}}
+	if _, _, err := s.raftApply(models.JobRegisterRequestType, req); err != nil {
+		t.Fatalf("Server.raftApply() error = %v", err)
+	}
+
+	got, _ := s.fsm.State().JobByID(memdb.NewWatchSet(), "sealed")
+	password := got.Tasks[0].Config["ConnectionConfig"].(map[string]interface{})["Password"].(string)
+	if !uconf.IsSealed(password) {
+		t.Fatalf("stored password = %q, want it sealed", password)
+	}
+	if plaintext, err := keyring.Open(password); err != nil || plaintext != "secret" {
+		t.Errorf("Keyring.Open() of the stored password = %q, %v", plaintext, err)
+	}
+	if connCfg["Password"] != "secret" {
+		t.Errorf("Server.raftApply() changed the config of the job to %v", connCfg)
+	}
+}
+
+func TestConfigChanges_SealedSecrets(t *testing.T) {
+	keyring, err := uconf.NewKeyring([][]byte{[]byte("0123456789abcdef")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := func(workers int) *models.Task {
+		return &models.Task{Type: models.TaskTypeDest, Driver: models.TaskDriverMySQL, Config: map[string]interface{}{
+			"ParallelWorkers":  workers,
+			"ConnectionConfig": map[string]interface{}{"Host": "127.0.0.1", "User": "root", "Password": "secret"},
+		}}
+	}
+	job, err := keyring.SealJob(&models.Job{ID: "sealed", Tasks: []*models.Task{task(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The plaintext secrets of the update match the sealed ones of the job
+	changed, err := configChanges(job, []*models.Task{task(4)}, keyring)
+	if err != nil {
+		t.Fatalf("configChanges() error = %v", err)
+	}
+	if got := changed[models.TaskTypeDest]; len(got) != 1 || got[0] != "ParallelWorkers" {
+		t.Errorf("configChanges() = %v, want only ParallelWorkers", changed)
+	}
+}
+
 func TestJob_Validate(t *testing.T) {
 	type fields struct {
 		srv *Server
@@ -290,23 +589,3 @@ func TestJob_Plan(t *testing.T) {
 		})
 	}
 }
-
-func Test_validateJob(t *testing.T) {
-	type args struct {
-		job *models.Job
-	}
-	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := validateJob(tt.args.job); (err != nil) != tt.wantErr {
-				t.Errorf("validateJob() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	memdb "github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+// bufferSink is a raft.SnapshotSink writing to memory
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (s *bufferSink) ID() string    { return "buffer" }
+func (s *bufferSink) Cancel() error { return nil }
+func (s *bufferSink) Close() error  { return nil }
+
+// taskEventString tells the type and the time of e
+func taskEventString(e *models.TaskEvent) string {
+	return fmt.Sprintf("%s at %d", e.Type, e.Time.Unix())
+}
+
+func TestJob_Events(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	state := s.fsm.State()
+
+	job := &models.Job{ID: "job1", Type: models.JobTypeSync, Tasks: []*models.Task{{Type: models.TaskTypeSrc}}}
+	if err := state.UpsertJob(5, job); err != nil {
+		t.Fatalf("StateStore.UpsertJob() error = %v", err)
+	}
+	alloc := &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), NodeID: "node1",
+		JobID: "job1", Job: job, Task: models.TaskTypeSrc, DesiredStatus: models.AllocDesiredStatusRun}
+	if err := state.UpsertAllocs(6, []*models.Allocation{alloc}); err != nil {
+		t.Fatalf("StateStore.UpsertAllocs() error = %v", err)
+	}
+
+	start := time.Unix(1000, 0)
+	events := []*models.TaskEvent{
+		{Type: models.TaskReceived, Time: start},
+		{Type: models.TaskStarted, Time: start.Add(time.Second)},
+		{Type: models.TaskRestarting, Time: start.Add(2 * time.Second)},
+		{Type: models.TaskDriverFailure, Time: start.Add(3 * time.Second), DriverError: "broken"},
+		{Type: models.TaskDriverMessage, Time: start.Add(4 * time.Second), DriverMessage: "skipped"},
+	}
+	// report applies the update of the client reporting the events, as the
+	// leader does
+	report := func(events ...*models.TaskEvent) uint64 {
+		update := alloc.Copy()
+		update.ClientStatus = models.AllocClientStatusRunning
+		update.TaskStates = map[string]*models.TaskState{models.TaskTypeSrc: {State: models.TaskStateRunning, Events: events}}
+		req := &models.AllocUpdateRequest{Alloc: []*models.Allocation{update}, JobEventsRetention: 3,
+			WriteRequest: models.WriteRequest{Region: "global"}}
+		_, index, err := s.raftApply(models.AllocClientUpdateRequestType, req)
+		if err != nil {
+			t.Fatalf("Server.raftApply() error = %v", err)
+		}
+		return index
+	}
+	report(events[:2]...)
+	// The client reports the last events it has, some of them again
+	index := report(events[:4]...)
+
+	j := &Job{srv: s}
+	query := func(args models.JobEventsRequest) ([]string, uint64) {
+		args.JobID = "job1"
+		args.Region = "global"
+		var reply models.JobEventsResponse
+		if err := j.Events(&args, &reply); err != nil {
+			t.Fatalf("Job.Events() error = %v", err)
+		}
+		var got []string
+		for _, e := range reply.Events {
+			if e.AllocID != alloc.ID || e.NodeID != "node1" || e.TaskName != models.TaskTypeSrc {
+				t.Errorf("Job.Events() event %+v, want one of the task of alloc %s", e, alloc.ID)
+			}
+			got = append(got, taskEventString(e.Event))
+		}
+		return got, reply.Index
+	}
+
+	tests := []struct {
+		name string
+		args models.JobEventsRequest
+		want []*models.TaskEvent
+	}{
+		{"retained", models.JobEventsRequest{}, events[1:4]},
+		{"warnings", models.JobEventsRequest{Severity: models.TaskEventSeverityWarning}, events[2:4]},
+		{"errors", models.JobEventsRequest{Severity: models.TaskEventSeverityError}, events[3:4]},
+		{"types", models.JobEventsRequest{Types: []string{"started", models.TaskRestarting}}, events[1:3]},
+		{"time range", models.JobEventsRequest{Since: events[2].Time, Until: events[2].Time}, events[2:3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := query(tt.args)
+			var want []string
+			for _, e := range tt.want {
+				want = append(want, taskEventString(e))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Job.Events() = %v, want %v", got, want)
+			}
+		})
+	}
+
+	var reply models.JobEventsResponse
+	if err := j.Events(&models.JobEventsRequest{JobID: "job1", Severity: "fatal",
+		QueryOptions: models.QueryOptions{Region: "global"}}, &reply); err == nil {
+		t.Errorf("Job.Events() of an invalid severity error = nil")
+	}
+
+	// A blocking query returns with the new events
+	done := make(chan []string)
+	go func() {
+		got, _ := query(models.JobEventsRequest{Severity: models.TaskEventSeverityInfo,
+			QueryOptions: models.QueryOptions{MinQueryIndex: index, MaxQueryTime: 5 * time.Second}})
+		done <- got
+	}()
+	time.Sleep(50 * time.Millisecond)
+	report(events...)
+	select {
+	case got := <-done:
+		if len(got) != 3 || got[2] != taskEventString(events[4]) {
+			t.Errorf("blocking Job.Events() = %v, want the last 3 events", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocking Job.Events() didn't return")
+	}
+
+	// The events are kept in snapshots, and deleted with their job
+	snap, err := s.fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &bufferSink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("Persist() error = %v", err)
+	}
+	fresh, err := store.NewStateStore(ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm := &udupFSM{logOutput: ioutil.Discard, state: fresh, timetable: NewTimeTable(timeTableGranularity, timeTableLimit)}
+	if err := fsm.Restore(ioutil.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	want, _ := s.fsm.State().JobEventsByID(memdb.NewWatchSet(), "job1")
+	restored, err := fsm.State().JobEventsByID(memdb.NewWatchSet(), "job1")
+	if err != nil || !reflect.DeepEqual(restored, want) {
+		t.Errorf("restored job events = %+v, %v, want %+v", restored, err, want)
+	}
+
+	// They are left out while a server predating them may restore it
+	s.fsm.schemaVersion = func() uint8 { return models.LegacySchemaVersion }
+	if snap, err = s.fsm.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	sink = &bufferSink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("Persist() error = %v", err)
+	}
+	if fresh, err = store.NewStateStore(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	fsm = &udupFSM{logOutput: ioutil.Discard, state: fresh, timetable: NewTimeTable(timeTableGranularity, timeTableLimit)}
+	if err := fsm.Restore(ioutil.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got, _ := fsm.State().JobEventsByID(memdb.NewWatchSet(), "job1"); got != nil {
+		t.Errorf("job events restored from a legacy snapshot = %+v, want none", got)
+	}
+
+	if err := s.fsm.State().DeleteJob(100, "job1"); err != nil {
+		t.Fatalf("StateStore.DeleteJob() error = %v", err)
+	}
+	if got, _ := s.fsm.State().JobEventsByID(memdb.NewWatchSet(), "job1"); got != nil {
+		t.Errorf("job events after the job was deleted = %+v, want none", got)
+	}
+}
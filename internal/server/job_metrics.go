@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// jobMetricsTTL is how long the metrics of a task are kept once its
+// client stopped reporting them
+const jobMetricsTTL = time.Minute
+
+// jobMetrics holds the metrics the clients reported for the tasks they
+// run. They are kept in memory on the leader, the clients report them
+// again to a new leader.
+type jobMetrics struct {
+	l sync.Mutex
+
+	// tasks are the last metrics of each task, keyed by alloc ID and task
+	// type
+	tasks map[string]*reportedMetrics
+
+	// index is bumped on each report, and updateCh closed
+	index    uint64
+	updateCh chan struct{}
+}
+
+type reportedMetrics struct {
+	metrics  *models.TaskMetrics
+	received time.Time
+}
+
+func newJobMetrics() *jobMetrics {
+	return &jobMetrics{
+		tasks:    make(map[string]*reportedMetrics),
+		index:    1,
+		updateCh: make(chan struct{}),
+	}
+}
+
+// update records the metrics reported at now, and returns the index of
+// the report
+func (m *jobMetrics) update(now time.Time, metrics []*models.TaskMetrics) uint64 {
+	m.l.Lock()
+	defer m.l.Unlock()
+	for _, tm := range metrics {
+		m.tasks[tm.AllocID+"/"+tm.TaskType] = &reportedMetrics{metrics: tm, received: now}
+	}
+	for key, r := range m.tasks {
+		if now.Sub(r.received) > jobMetricsTTL {
+			delete(m.tasks, key)
+		}
+	}
+	m.index++
+	close(m.updateCh)
+	m.updateCh = make(chan struct{})
+	return m.index
+}
+
+// jobs returns the metrics of the job jobID, or of every job if it's
+// empty, at now, sorted by job ID. It also returns the index of the last
+// report and a channel closed by the next one.
+func (m *jobMetrics) jobs(now time.Time, jobID string) ([]*models.JobMetrics, uint64, <-chan struct{}) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	byJob := make(map[string]*models.JobMetrics)
+	// estimateUnknown are the jobs a task of which doesn't know how many
+	// rows it copies
+	estimateUnknown := make(map[string]bool)
+	for _, r := range m.tasks {
+		tm := r.metrics
+		if (jobID != "" && tm.JobID != jobID) || now.Sub(r.received) > jobMetricsTTL {
+			continue
+		}
+		jm, ok := byJob[tm.JobID]
+		if !ok {
+			jm = &models.JobMetrics{JobID: tm.JobID}
+			byJob[tm.JobID] = jm
+		}
+		jm.RowsApplied += tm.RowsApplied
+		jm.BytesApplied += tm.BytesApplied
+		jm.ErrorCount += tm.ErrorCount
+		jm.RowsCopied += tm.RowsCopied
+		jm.RowsEstimate += tm.RowsEstimate
+		if tm.RowsEstimateUnknown {
+			estimateUnknown[tm.JobID] = true
+		}
+		if tm.LagSeconds > jm.LagSeconds {
+			jm.LagSeconds = tm.LagSeconds
+		}
+		received := r.received.UnixNano()
+		if tm.LastAppliedGtid != "" && (jm.LastAppliedGtid == "" || received > jm.UpdateTime) {
+			jm.LastAppliedGtid = tm.LastAppliedGtid
+		}
+		if received > jm.UpdateTime {
+			jm.UpdateTime = received
+		}
+	}
+
+	ids := make([]string, 0, len(byJob))
+	for id := range byJob {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	jobs := make([]*models.JobMetrics, len(ids))
+	for i, id := range ids {
+		jm := byJob[id]
+		switch {
+		case estimateUnknown[id]:
+			jm.ProgressPct = -1
+		case jm.RowsCopied >= jm.RowsEstimate && jm.RowsEstimate > 0:
+			jm.ProgressPct = 100
+		case jm.RowsEstimate > 0:
+			jm.ProgressPct = 100 * float64(jm.RowsCopied) / float64(jm.RowsEstimate)
+		}
+		jobs[i] = jm
+	}
+	return jobs, m.index, m.updateCh
+}
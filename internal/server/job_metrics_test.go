@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestJobMetrics(t *testing.T) {
+	m := newJobMetrics()
+	start := time.Unix(1000, 0)
+
+	_, index, updateCh := m.jobs(start, "")
+	m.update(start, []*models.TaskMetrics{
+		{JobID: "job1", AllocID: "a1", TaskType: "Src", ErrorCount: 1, RowsCopied: 50, RowsEstimate: 200},
+		{JobID: "job1", AllocID: "a2", TaskType: "Dest", RowsApplied: 10, BytesApplied: 100, LagSeconds: 2, LastAppliedGtid: "sid:5", ErrorCount: 2},
+		{JobID: "job2", AllocID: "a3", TaskType: "Src", RowsCopied: 7, RowsEstimateUnknown: true},
+		{JobID: "job2", AllocID: "a3", TaskType: "Dest", RowsApplied: 1},
+	})
+	select {
+	case <-updateCh:
+	default:
+		t.Fatal("jobMetrics.update() didn't notify")
+	}
+
+	later := start.Add(jobMetricsTTL / 2)
+	m.update(later, []*models.TaskMetrics{
+		{JobID: "job1", AllocID: "a2", TaskType: "Dest", RowsApplied: 20, BytesApplied: 200, LagSeconds: 1, LastAppliedGtid: "sid:9", ErrorCount: 2},
+	})
+
+	jobs, newIndex, _ := m.jobs(later, "")
+	if newIndex != index+2 {
+		t.Errorf("jobMetrics index = %v, want %v", newIndex, index+2)
+	}
+	want := []*models.JobMetrics{
+		{JobID: "job1", RowsApplied: 20, BytesApplied: 200, LagSeconds: 1, LastAppliedGtid: "sid:9", ErrorCount: 3,
+			RowsCopied: 50, RowsEstimate: 200, ProgressPct: 25, UpdateTime: later.UnixNano()},
+		{JobID: "job2", RowsApplied: 1, RowsCopied: 7, ProgressPct: -1, UpdateTime: start.UnixNano()},
+	}
+	if !reflect.DeepEqual(jobs, want) {
+		t.Errorf("jobMetrics.jobs() = %+v, want %+v", jobs, want)
+	}
+
+	// The tasks which stopped reporting are left out
+	jobs, _, _ = m.jobs(start.Add(jobMetricsTTL+time.Second), "job1")
+	want = []*models.JobMetrics{
+		{JobID: "job1", RowsApplied: 20, BytesApplied: 200, LagSeconds: 1, LastAppliedGtid: "sid:9", ErrorCount: 2, UpdateTime: later.UnixNano()},
+	}
+	if !reflect.DeepEqual(jobs, want) {
+		t.Errorf("jobMetrics.jobs() after TTL = %+v, want %+v", jobs, want)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// jobVerifications holds the last comparison of the tables of each job,
+// run in the background so that a full scan doesn't hold an RPC of the
+// leader. They are kept in memory on the leader only.
+type jobVerifications struct {
+	l    sync.Mutex
+	jobs map[string]*models.JobVerification
+}
+
+func newJobVerifications() *jobVerifications {
+	return &jobVerifications{jobs: make(map[string]*models.JobVerification)}
+}
+
+// start runs verify for jobID in the background, unless a verification
+// of the job is still running, and returns the one of the job
+func (v *jobVerifications) start(jobID string, verify func() ([]*models.TableVerification, error)) *models.JobVerification {
+	v.l.Lock()
+	defer v.l.Unlock()
+	if running := v.jobs[jobID]; running != nil && running.Status == models.JobVerificationRunning {
+		return copyJobVerification(running)
+	}
+	verification := &models.JobVerification{
+		ID:        models.GenerateUUID(),
+		JobID:     jobID,
+		Status:    models.JobVerificationRunning,
+		StartTime: time.Now(),
+	}
+	v.jobs[jobID] = verification
+
+	go func() {
+		tables, err := verify()
+		v.l.Lock()
+		defer v.l.Unlock()
+		verification.EndTime = time.Now()
+		if err != nil {
+			verification.Status = models.JobVerificationFailed
+			verification.Error = err.Error()
+			return
+		}
+		verification.Status = models.JobVerificationComplete
+		verification.Tables = tables
+		verification.Consistent = true
+		for _, table := range tables {
+			verification.Consistent = verification.Consistent && table.Error == "" && len(table.Mismatches) == 0
+		}
+	}()
+	return copyJobVerification(verification)
+}
+
+// get returns the last verification of jobID, nil if there is none
+func (v *jobVerifications) get(jobID string) *models.JobVerification {
+	v.l.Lock()
+	defer v.l.Unlock()
+	if verification := v.jobs[jobID]; verification != nil {
+		return copyJobVerification(verification)
+	}
+	return nil
+}
+
+// copyJobVerification copies v, whose tables are set once and not changed
+func copyJobVerification(v *models.JobVerification) *models.JobVerification {
+	c := *v
+	return &c
+}
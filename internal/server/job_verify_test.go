@@ -0,0 +1,49 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestJobVerifications(t *testing.T) {
+	v := newJobVerifications()
+	release := make(chan struct{})
+	verify := func() ([]*models.TableVerification, error) {
+		<-release
+		return []*models.TableVerification{{TableName: "a"}, {TableName: "b", Mismatches: []*models.ChunkMismatch{{}}}}, nil
+	}
+
+	first := v.start("job1", verify)
+	if first.Status != models.JobVerificationRunning {
+		t.Fatalf("start() = %+v, want running", first)
+	}
+	// A job is verified once at a time
+	if again := v.start("job1", verify); again.ID != first.ID {
+		t.Errorf("start() while running = %v, want %v", again.ID, first.ID)
+	}
+	if got := v.get("job2"); got != nil {
+		t.Errorf("get() of a job never verified = %+v", got)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	got := v.get("job1")
+	for got.Status == models.JobVerificationRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		got = v.get("job1")
+	}
+	if got.ID != first.ID || got.Status != models.JobVerificationComplete || len(got.Tables) != 2 || got.Consistent {
+		t.Errorf("get() = %+v, want complete and inconsistent", got)
+	}
+	if next := v.start("job1", verify); next.ID == first.ID {
+		t.Errorf("start() once complete = %v, want a new verification", next.ID)
+	}
+}
@@ -9,6 +9,7 @@ package server
 import (
 	"fmt"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
@@ -38,10 +39,12 @@ func (s *Server) monitorLeadership() {
 				stopCh = make(chan struct{})
 				go s.leaderLoop(stopCh)
 				s.logger.Printf("manager: cluster leadership acquired")
+				s.notifyLeadership(true)
 			} else if stopCh != nil {
 				close(stopCh)
 				stopCh = nil
 				s.logger.Printf("manager: cluster leadership lost")
+				s.notifyLeadership(false)
 			}
 		case <-s.shutdownCh:
 			return
@@ -149,6 +152,26 @@ func (s *Server) establishLeadership(stopCh chan struct{}) error {
 	// Periodically unblock failed allocations
 	go s.periodicUnblockFailedEvals(stopCh)
 
+	// Open the connections the previous leader had pooled
+	go func() {
+		if warmed := s.warmConns(); warmed > 0 {
+			s.logger.Printf("manager: warmed %d pooled connections", warmed)
+		}
+	}()
+
+	// Step down if we stop making progress. Failures recorded while we
+	// were a follower don't count.
+	atomic.StoreInt32(&s.applyFailures, 0)
+	go s.monitorLeaderHealth(stopCh)
+
+	// Reschedule or fail the jobs no worker runs
+	go s.reconcileOrphans(stopCh)
+
+	// Notify the jobs changing status to the webhooks
+	if s.notifier != nil {
+		go s.notifyJobTransitions(stopCh)
+	}
+
 	// Setup the heartbeat timers. This is done both when starting up or when
 	// a leader fail over happens. Since the timers are maintained by the leader
 	// node, effectively this means all the timers are renewed at the time of failover.
@@ -377,20 +400,35 @@ func (s *Server) addRaftPeer(m serf.Member, parts *serverParts) error {
 
 	// See if it's already in the configuration. It's harmless to re-add it
 	// but we want to avoid doing that if possible to prevent useless Raft
-	// log entries.
+	// log entries. A voter that stepped down as an unhealthy leader is
+	// still there as a non-voter and gets promoted back.
 	configFuture := s.raft.GetConfiguration()
 	if err := configFuture.Error(); err != nil {
 		s.logger.Errorf("manager: failed to get raft configuration: %v", err)
 		return err
 	}
 	for _, server := range configFuture.Configuration().Servers {
-		if server.Address == raft.ServerAddress(addr) {
+		if server.Address != raft.ServerAddress(addr) {
+			continue
+		}
+		if parts.NonVoter || server.Suffrage == raft.Voter {
 			return nil
 		}
+		if err := s.raft.AddVoter(server.ID, server.Address, 0, 0).Error(); err != nil {
+			s.logger.Errorf("manager: failed to promote raft peer: %v", err)
+			return err
+		}
+		s.logger.Printf("manager: promoted raft peer back to voter: %v", parts)
+		return nil
 	}
 
-	// Attempt to add as a peer
-	addFuture := s.raft.AddPeer(raft.ServerAddress(addr))
+	// Attempt to add as a peer, a non-voter never gets a vote
+	var addFuture raft.Future
+	if parts.NonVoter {
+		addFuture = s.raft.AddNonvoter(raft.ServerID(addr), raft.ServerAddress(addr), 0, 0)
+	} else {
+		addFuture = s.raft.AddPeer(raft.ServerAddress(addr))
+	}
 	if err := addFuture.Error(); err != nil {
 		s.logger.Errorf("manager: failed to add raft peer: %v", err)
 		return err
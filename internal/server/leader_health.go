@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/raft"
+)
+
+// recordApply counts the Raft applies that failed in a row. The errors
+// raised because this server isn't, or stopped being, the leader don't say
+// anything about its health and leave the count alone.
+func (s *Server) recordApply(err error) {
+	switch err {
+	case nil:
+		atomic.StoreInt32(&s.applyFailures, 0)
+	case raft.ErrNotLeader, raft.ErrLeadershipLost, raft.ErrRaftShutdown:
+	default:
+		atomic.AddInt32(&s.applyFailures, 1)
+	}
+}
+
+// monitorLeaderHealth periodically checks whether the leader is still able
+// to make progress and steps down if it isn't, so a healthier server takes
+// over instead of every write stalling behind it
+func (s *Server) monitorLeaderHealth(stopCh chan struct{}) {
+	interval := s.config.LeaderHealthInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			reason := s.leaderUnhealthy()
+			if reason == "" {
+				continue
+			}
+			if err := s.stepDown(reason); err != nil {
+				s.logger.Errorf("manager: leader is unhealthy (%s) but can't step down: %v", reason, err)
+			}
+		}
+	}
+}
+
+// leaderUnhealthy returns why the leader should step down, or an empty
+// string if it is healthy
+func (s *Server) leaderUnhealthy() string {
+	if max := s.config.LeaderMaxApplyFailures; max > 0 {
+		if failures := atomic.LoadInt32(&s.applyFailures); int(failures) >= max {
+			return fmt.Sprintf("%d Raft applies failed in a row", failures)
+		}
+	}
+	if min := s.config.LeaderMinFreeDisk; min > 0 {
+		free, err := freeDiskSpace(filepath.Join(s.config.DataDir, raftState))
+		if err != nil {
+			s.logger.Warnf("manager: failed to check the free disk space: %v", err)
+			return ""
+		}
+		if free < min {
+			return fmt.Sprintf("%d bytes of free disk space left, below %d", free, min)
+		}
+	}
+	return ""
+}
+
+// stepDown gives up the leadership by demoting this server to a non-voter,
+// provided the other voters can still form a quorum. The next leader
+// promotes it back when it reconciles the members.
+func (s *Server) stepDown(reason string) error {
+	future := s.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+	servers := future.Configuration().Servers
+	if err := s.checkQuorumWithout(servers, s.config.RaftConfig.LocalID); err != nil {
+		return err
+	}
+
+	s.logger.Warnf("manager: stepping down as leader: %s", reason)
+	metrics.IncrCounter([]string{"server", "leader", "self_step_down"}, 1)
+	if err := s.raft.DemoteVoter(s.config.RaftConfig.LocalID, 0, 0).Error(); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&s.applyFailures, 0)
+	return nil
+}
+
+// freeDiskSpace returns the bytes available to unprivileged users on the
+// file system holding path
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
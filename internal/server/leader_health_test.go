@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/raft"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestServer_leaderUnhealthy(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "leader-health")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+	if err := os.MkdirAll(filepath.Join(dataDir, raftState), 0755); err != nil {
+		t.Fatalf("os.MkdirAll() error = %v", err)
+	}
+
+	failed := errors.New("disk I/O error")
+	tests := []struct {
+		name        string
+		maxFailures int
+		minFreeDisk uint64
+		applies     []error
+		want        bool
+	}{
+		{"healthy", 3, 1, []error{failed, failed, nil}, false},
+		{"applies failing", 3, 0, []error{nil, failed, failed, failed}, true},
+		{"not the leader", 3, 0, []error{raft.ErrNotLeader, raft.ErrLeadershipLost, failed}, false},
+		{"checks disabled", 0, 0, []error{failed, failed, failed, failed}, false},
+		{"disk full", 0, math.MaxUint64, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{
+				config: &uconf.ServerConfig{
+					DataDir:                dataDir,
+					LeaderMaxApplyFailures: tt.maxFailures,
+					LeaderMinFreeDisk:      tt.minFreeDisk,
+				},
+				logger: ulog.New(ioutil.Discard, ulog.ErrorLevel),
+			}
+			for _, err := range tt.applies {
+				s.recordApply(err)
+			}
+			if got := s.leaderUnhealthy(); (got != "") != tt.want {
+				t.Errorf("Server.leaderUnhealthy() = %q, want unhealthy %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_stepDown(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	s.config.RaftConfig = &raft.Config{LocalID: "server-a"}
+
+	// The only voter can't hand the leadership to anybody
+	if err := s.stepDown("testing"); err != models.ErrRemovePeerQuorum {
+		t.Fatalf("Server.stepDown() error = %v, want %v", err, models.ErrRemovePeerQuorum)
+	}
+	if s.raft.State() != raft.Leader {
+		t.Errorf("Server.stepDown() gave up the leadership")
+	}
+}
@@ -9,7 +9,6 @@ package server
 import (
 	"net"
 	"net/rpc"
-	"sync"
 	"testing"
 	"time"
 	uconf "github.com/actiontech/dtle/internal/config"
@@ -42,7 +41,6 @@ func TestServer_monitorLeadership(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -50,12 +48,10 @@ func TestServer_monitorLeadership(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -84,7 +80,6 @@ func TestServer_monitorLeadership(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -92,12 +87,10 @@ func TestServer_monitorLeadership(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.monitorLeadership()
 		})
@@ -124,7 +117,6 @@ func TestServer_leaderLoop(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -132,12 +124,10 @@ func TestServer_leaderLoop(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		stopCh chan struct{}
@@ -170,7 +160,6 @@ func TestServer_leaderLoop(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -178,12 +167,10 @@ func TestServer_leaderLoop(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.leaderLoop(tt.args.stopCh)
 		})
@@ -210,7 +197,6 @@ func TestServer_establishLeadership(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -218,12 +204,10 @@ func TestServer_establishLeadership(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		stopCh chan struct{}
@@ -257,7 +241,6 @@ func TestServer_establishLeadership(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -265,12 +248,10 @@ func TestServer_establishLeadership(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.establishLeadership(tt.args.stopCh); (err != nil) != tt.wantErr {
 				t.Errorf("Server.establishLeadership() error = %v, wantErr %v", err, tt.wantErr)
@@ -299,7 +280,6 @@ func TestServer_restoreEvals(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -307,12 +287,10 @@ func TestServer_restoreEvals(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -342,7 +320,6 @@ func TestServer_restoreEvals(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -350,12 +327,10 @@ func TestServer_restoreEvals(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.restoreEvals(); (err != nil) != tt.wantErr {
 				t.Errorf("Server.restoreEvals() error = %v, wantErr %v", err, tt.wantErr)
@@ -384,7 +359,6 @@ func TestServer_reapFailedEvaluations(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -392,12 +366,10 @@ func TestServer_reapFailedEvaluations(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		stopCh chan struct{}
@@ -430,7 +402,6 @@ func TestServer_reapFailedEvaluations(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -438,12 +409,10 @@ func TestServer_reapFailedEvaluations(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.reapFailedEvaluations(tt.args.stopCh)
 		})
@@ -470,7 +439,6 @@ func TestServer_reapDupBlockedEvaluations(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -478,12 +446,10 @@ func TestServer_reapDupBlockedEvaluations(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		stopCh chan struct{}
@@ -516,7 +482,6 @@ func TestServer_reapDupBlockedEvaluations(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -524,12 +489,10 @@ func TestServer_reapDupBlockedEvaluations(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.reapDupBlockedEvaluations(tt.args.stopCh)
 		})
@@ -556,7 +519,6 @@ func TestServer_periodicUnblockFailedEvals(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -564,12 +526,10 @@ func TestServer_periodicUnblockFailedEvals(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		stopCh chan struct{}
@@ -602,7 +562,6 @@ func TestServer_periodicUnblockFailedEvals(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -610,12 +569,10 @@ func TestServer_periodicUnblockFailedEvals(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.periodicUnblockFailedEvals(tt.args.stopCh)
 		})
@@ -642,7 +599,6 @@ func TestServer_revokeLeadership(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -650,12 +606,10 @@ func TestServer_revokeLeadership(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -685,7 +639,6 @@ func TestServer_revokeLeadership(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -693,12 +646,10 @@ func TestServer_revokeLeadership(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.revokeLeadership(); (err != nil) != tt.wantErr {
 				t.Errorf("Server.revokeLeadership() error = %v, wantErr %v", err, tt.wantErr)
@@ -727,7 +678,6 @@ func TestServer_reconcile(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -735,12 +685,10 @@ func TestServer_reconcile(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -770,7 +718,6 @@ func TestServer_reconcile(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -778,12 +725,10 @@ func TestServer_reconcile(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.reconcile(); (err != nil) != tt.wantErr {
 				t.Errorf("Server.reconcile() error = %v, wantErr %v", err, tt.wantErr)
@@ -812,7 +757,6 @@ func TestServer_reconcileMember(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -820,12 +764,10 @@ func TestServer_reconcileMember(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		member serf.Member
@@ -859,7 +801,6 @@ func TestServer_reconcileMember(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -867,12 +808,10 @@ func TestServer_reconcileMember(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.reconcileMember(tt.args.member); (err != nil) != tt.wantErr {
 				t.Errorf("Server.reconcileMember() error = %v, wantErr %v", err, tt.wantErr)
@@ -901,7 +840,6 @@ func TestServer_addRaftPeer(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -909,12 +847,10 @@ func TestServer_addRaftPeer(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		m     serf.Member
@@ -949,7 +885,6 @@ func TestServer_addRaftPeer(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -957,12 +892,10 @@ func TestServer_addRaftPeer(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.addRaftPeer(tt.args.m, tt.args.parts); (err != nil) != tt.wantErr {
 				t.Errorf("Server.addRaftPeer() error = %v, wantErr %v", err, tt.wantErr)
@@ -991,7 +924,6 @@ func TestServer_removeRaftPeer(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -999,12 +931,10 @@ func TestServer_removeRaftPeer(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		m     serf.Member
@@ -1039,7 +969,6 @@ func TestServer_removeRaftPeer(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -1047,12 +976,10 @@ func TestServer_removeRaftPeer(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.removeRaftPeer(tt.args.m, tt.args.parts); (err != nil) != tt.wantErr {
 				t.Errorf("Server.removeRaftPeer() error = %v, wantErr %v", err, tt.wantErr)
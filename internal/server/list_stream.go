@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	memdb "github.com/hashicorp/go-memdb"
+	"github.com/hashicorp/go-msgpack/codec"
+
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+// listStreamBatch is the maximum number of items sent after a single
+// ListStreamFrame
+const listStreamBatch = 256
+
+// listStreamer writes the items of a list to a stream as they are
+// iterated, in frames of up to listStreamBatch items
+type listStreamer struct {
+	enc      *codec.Encoder
+	batch    []interface{}
+	sent     int
+	finished bool
+
+	// frame returns the frame announcing count items
+	frame func(count int) interface{}
+}
+
+func newListStreamer(enc *codec.Encoder) *listStreamer {
+	return &listStreamer{enc: enc, batch: make([]interface{}, 0, listStreamBatch),
+		frame: func(count int) interface{} { return &models.ListStreamFrame{Count: count} }}
+}
+
+// add queues item, sending the batch once it is full
+func (l *listStreamer) add(item interface{}) error {
+	l.batch = append(l.batch, item)
+	if len(l.batch) < listStreamBatch {
+		return nil
+	}
+	return l.flush()
+}
+
+// flush sends the queued items after a frame counting them
+func (l *listStreamer) flush() error {
+	if len(l.batch) == 0 {
+		return nil
+	}
+	if err := l.enc.Encode(l.frame(len(l.batch))); err != nil {
+		return err
+	}
+	for i, item := range l.batch {
+		if err := l.enc.Encode(item); err != nil {
+			return err
+		}
+		l.batch[i] = nil
+	}
+	l.sent += len(l.batch)
+	l.batch = l.batch[:0]
+	return nil
+}
+
+// done sends the queued items and the final frame carrying meta
+func (l *listStreamer) done(meta *models.QueryMeta) error {
+	if err := l.flush(); err != nil {
+		return err
+	}
+	l.finished = true
+	return l.enc.Encode(&models.ListStreamFrame{Done: true, QueryMeta: *meta})
+}
+
+// catchUpForRead makes the local state fit for a read with args: unless
+// they allow a stale read, a follower first catches up with the leader
+// like for a consistent read
+func (s *Server) catchUpForRead(args *models.QueryOptions) error {
+	if args.AllowStaleRead() && !s.tooStale(args) {
+		return nil
+	}
+	isLeader, leader := s.getLeader()
+	if isLeader {
+		return nil
+	}
+	if leader == nil {
+		return models.ErrNoLeader
+	}
+	return s.readIndexBarrier(leader, s.readIndexTimeout(args))
+}
+
+// streamList serves the streaming variant of a list query on table. The
+// stream is served locally: unless args allow a stale read, a follower
+// first catches up with the leader like for a consistent read. Blocking
+// queries wait for the table to change before anything is written, and
+// iterate then streams the items of a snapshot of the state. Pagination
+// options are ignored since the whole list is streamed.
+func (s *Server) streamList(ctx context.Context, method string, args *models.QueryOptions, table string,
+	enc *codec.Encoder, iterate func(state *store.StateStore, l *listStreamer) error) error {
+	if args.Region != "" && args.Region != s.config.Region {
+		return fmt.Errorf("list streams are only served for region %q", s.config.Region)
+	}
+	if err := s.catchUpForRead(args); err != nil {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "rpc", "list_stream", method}, time.Now())
+
+	args.SetContext(ctx)
+	var meta models.QueryMeta
+	l := newListStreamer(enc)
+	opts := blockingOptions{
+		queryOpts: args,
+		queryMeta: &meta,
+		table:     table,
+		run: func(ws memdb.WatchSet, state *store.StateStore) error {
+			index, err := state.IndexWatch(ws, table)
+			if err != nil {
+				return err
+			}
+			meta.Index = index
+			s.setQueryMeta(&meta)
+
+			// Nothing is written until there is something new, since
+			// blockingRPC runs the query again once there is
+			if args.MinQueryIndex > 0 && index <= args.MinQueryIndex {
+				return nil
+			}
+			if err := iterate(state, l); err != nil {
+				return err
+			}
+			return l.done(&meta)
+		}}
+	if err := s.blockingRPC(&opts); err != nil {
+		return err
+	}
+
+	// A blocking query that timed out gets the unchanged list, like
+	// blocking RPCs reply with it
+	if !l.finished {
+		snap, err := s.fsm.State().Snapshot()
+		if err != nil {
+			return err
+		}
+		if err := iterate(&snap.StateStore, l); err != nil {
+			return err
+		}
+		if err := l.done(&meta); err != nil {
+			return err
+		}
+	}
+	metrics.IncrCounter([]string{"server", "rpc", "list_stream_items", method}, float32(l.sent))
+	return nil
+}
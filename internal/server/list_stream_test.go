@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-msgpack/codec"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// readNodeListStream reads the frames of a Node.ListStream until the last
+// one and returns the streamed nodes along with the last frame
+func readNodeListStream(dec *codec.Decoder) ([]*models.NodeListStub, models.ListStreamFrame, error) {
+	var nodes []*models.NodeListStub
+	for {
+		var frame models.ListStreamFrame
+		if err := dec.Decode(&frame); err != nil {
+			return nil, frame, err
+		}
+		if frame.Done || frame.Error != "" {
+			return nodes, frame, nil
+		}
+		for i := 0; i < frame.Count; i++ {
+			var node models.NodeListStub
+			if err := dec.Decode(&node); err != nil {
+				return nil, frame, err
+			}
+			nodes = append(nodes, &node)
+		}
+	}
+}
+
+func TestNode_ListStream(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	s.endpoints.Node = &Node{srv: s}
+
+	const count = listStreamBatch + 10
+	for i := 0; i < count; i++ {
+		node := &models.Node{ID: fmt.Sprintf("00000000-0000-0000-0000-000000000%03d", i), Name: "node", Status: models.NodeStatusReady}
+		if err := s.fsm.State().UpsertNode(uint64(10+i), node); err != nil {
+			t.Fatalf("StateStore.UpsertNode() error = %v", err)
+		}
+	}
+	lastIndex := uint64(10 + count - 1)
+
+	tests := []struct {
+		name      string
+		args      models.QueryOptions
+		wantCount int
+		wantErr   bool
+	}{
+		{"whole list", models.QueryOptions{Region: "global"}, count, false},
+		{"prefix", models.QueryOptions{Region: "global", Prefix: "00000000-0000-0000-0000-0000000000"}, 100, false},
+		{"blocking query timing out", models.QueryOptions{Region: "global", MinQueryIndex: lastIndex, MaxQueryTime: 20 * time.Millisecond}, count, false},
+		{"other region", models.QueryOptions{Region: "eu"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c1, c2 := net.Pipe()
+			defer c1.Close()
+			go s.handleStreamingConn(context.Background(), c2)
+
+			enc := codec.NewEncoder(c1, models.HashiMsgpackHandle)
+			if err := enc.Encode(&models.StreamingRPCHeader{Method: "Node.ListStream"}); err != nil {
+				t.Fatalf("Encode() header error = %v", err)
+			}
+			if err := enc.Encode(&models.NodeListRequest{QueryOptions: tt.args}); err != nil {
+				t.Fatalf("Encode() args error = %v", err)
+			}
+
+			nodes, last, err := readNodeListStream(codec.NewDecoder(c1, models.HashiMsgpackHandle))
+			if err != nil {
+				t.Fatalf("reading the stream: %v", err)
+			}
+			if (last.Error != "") != tt.wantErr {
+				t.Fatalf("Node.ListStream error = %q, wantErr %v", last.Error, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(nodes) != tt.wantCount {
+				t.Errorf("Node.ListStream streamed %d nodes, want %d", len(nodes), tt.wantCount)
+			}
+			if last.Index != lastIndex {
+				t.Errorf("Node.ListStream index = %d, want %d", last.Index, lastIndex)
+			}
+		})
+	}
+}
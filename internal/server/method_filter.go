@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// methodFilterKey is the context key of the method filter of the listener
+// a connection was accepted on
+type methodFilterKey struct{}
+
+// rpcMethodFilter decides which RPC methods may be called on a listener.
+// Patterns are either a method name such as "Status.Ping", a whole
+// endpoint such as "Status.*", or "*" for every method. A method must
+// match the allow-list, when there is one, and must not match the
+// deny-list.
+type rpcMethodFilter struct {
+	allow []string
+	deny  []string
+}
+
+// newRPCMethodFilter returns the filter of the given lists, or nil if both
+// are empty and every method is allowed
+func newRPCMethodFilter(allow, deny []string) (*rpcMethodFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	for _, pattern := range append(append([]string{}, allow...), deny...) {
+		if pattern != anyRPCMethod && strings.Count(pattern, ".") != 1 {
+			return nil, fmt.Errorf("invalid RPC method pattern %q", pattern)
+		}
+	}
+	return &rpcMethodFilter{allow: allow, deny: deny}, nil
+}
+
+// permits returns whether method may be called. A nil filter permits
+// every method.
+func (f *rpcMethodFilter) permits(method string) bool {
+	if f == nil {
+		return true
+	}
+	if matchMethod(f.deny, method) {
+		return false
+	}
+	return len(f.allow) == 0 || matchMethod(f.allow, method)
+}
+
+// matchMethod returns whether method matches any of patterns
+func matchMethod(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if pattern == anyRPCMethod || pattern == method {
+			return true
+		}
+		if strings.HasSuffix(pattern, ".*") && strings.HasPrefix(method, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// withMethodFilter returns a context carrying the filter of the
+// connections served with it
+func withMethodFilter(ctx context.Context, f *rpcMethodFilter) context.Context {
+	if f == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, methodFilterKey{}, f)
+}
+
+// methodFilterFrom returns the filter carried by ctx, if any
+func methodFilterFrom(ctx context.Context) *rpcMethodFilter {
+	f, _ := ctx.Value(methodFilterKey{}).(*rpcMethodFilter)
+	return f
+}
+
+// listenerMethodFilters builds the method filters of the listeners from
+// the allow and deny lists keyed by listener address. Addresses that
+// aren't the one of a listener are rejected so a typo can't silently
+// leave a listener unfiltered.
+func listenerMethodFilters(addrs []*net.TCPAddr, allow, deny map[string][]string) (map[string]*rpcMethodFilter, error) {
+	listening := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		listening[addr.String()] = true
+	}
+	for _, lists := range []map[string][]string{allow, deny} {
+		for addr := range lists {
+			if !listening[addr] {
+				return nil, fmt.Errorf("RPC method filter for %q, which isn't an RPC listener address", addr)
+			}
+		}
+	}
+
+	filters := make(map[string]*rpcMethodFilter)
+	for addr := range listening {
+		f, err := newRPCMethodFilter(allow[addr], deny[addr])
+		if err != nil {
+			return nil, fmt.Errorf("RPC method filter for %q: %v", addr, err)
+		}
+		if f != nil {
+			filters[addr] = f
+		}
+	}
+	return filters, nil
+}
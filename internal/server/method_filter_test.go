@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"context"
+	uconf "github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+func Test_rpcMethodFilter_permits(t *testing.T) {
+	tests := []struct {
+		name   string
+		allow  []string
+		deny   []string
+		method string
+		want   bool
+	}{
+		{"no filter", nil, nil, "Job.Register", true},
+		{"allowed method", []string{"Status.Ping"}, nil, "Status.Ping", true},
+		{"method not allowed", []string{"Status.Ping"}, nil, "Status.Leader", false},
+		{"allowed endpoint", []string{"Status.*"}, nil, "Status.Leader", true},
+		{"endpoint prefix only", []string{"Status.*"}, nil, "StatusX.Leader", false},
+		{"denied method", nil, []string{"Operator.*"}, "Operator.RaftRemovePeerByID", false},
+		{"not denied", nil, []string{"Operator.*"}, "Job.List", true},
+		{"deny wins", []string{"*"}, []string{"Job.Register"}, "Job.Register", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newRPCMethodFilter(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatalf("newRPCMethodFilter() error = %v", err)
+			}
+			if got := f.permits(tt.method); got != tt.want {
+				t.Errorf("rpcMethodFilter.permits(%q) = %v, want %v", tt.method, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_listenerMethodFilters(t *testing.T) {
+	addrs := []*net.TCPAddr{
+		{IP: net.ParseIP("10.0.0.1"), Port: 8191},
+		{IP: net.ParseIP("192.168.0.1"), Port: 8191},
+	}
+	tests := []struct {
+		name    string
+		allow   map[string][]string
+		deny    map[string][]string
+		want    []string
+		wantErr bool
+	}{
+		{"none", nil, nil, nil, false},
+		{"public listener", map[string][]string{"192.168.0.1:8191": {"Status.*"}}, nil, []string{"192.168.0.1:8191"}, false},
+		{"unknown listener", nil, map[string][]string{"10.0.0.2:8191": {"Job.*"}}, nil, true},
+		{"bad pattern", map[string][]string{"10.0.0.1:8191": {"Status"}}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := listenerMethodFilters(addrs, tt.allow, tt.deny)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("listenerMethodFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("listenerMethodFilters() = %v, want filters for %v", got, tt.want)
+			}
+			for _, addr := range tt.want {
+				if got[addr] == nil {
+					t.Errorf("listenerMethodFilters() has no filter for %v", addr)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_handleUdupConn_MethodFilter(t *testing.T) {
+	s := &Server{
+		config:     &uconf.ServerConfig{},
+		logger:     ulog.New(ioutil.Discard, ulog.ErrorLevel),
+		rpcServer:  rpc.NewServer(),
+		rpcDrainer: newRPCDrainer(),
+		rpcLimiter: newRPCRateLimiter(nil, false),
+		connPool:   NewPool(ioutil.Discard, time.Minute, 1, nil),
+		shutdownCh: make(chan struct{}),
+	}
+	defer s.connPool.Shutdown()
+	s.rpcServer.Register(&Status{s})
+
+	f, err := newRPCMethodFilter([]string{"Status.*"}, []string{"Status.ConnPool"})
+	if err != nil {
+		t.Fatalf("newRPCMethodFilter() error = %v", err)
+	}
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go s.handleUdupConn(withMethodFilter(context.Background(), f), c1)
+
+	client := rpc.NewClientWithCodec(NewClientCodec(c2))
+	var reply models.ConnPoolResponse
+	err = client.Call("Status.ConnPool", &models.GenericRequest{}, &reply)
+	if err == nil || err.Error() != models.ErrPermissionDenied.Error() {
+		t.Fatalf("Status.ConnPool error = %v, want %v", err, models.ErrPermissionDenied)
+	}
+
+	// The connection keeps serving the allowed methods
+	var leader string
+	if err := client.Call("Status.Leader", &models.GenericRequest{}, &leader); err != nil && err.Error() == models.ErrPermissionDenied.Error() {
+		t.Fatalf("Status.Leader error = %v", err)
+	}
+}
@@ -7,12 +7,14 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-memdb"
+	"github.com/hashicorp/go-msgpack/codec"
 	"github.com/hashicorp/go-multierror"
 
 	"github.com/actiontech/dtle/internal/models"
@@ -363,6 +365,7 @@ func (n *Node) GetNode(args *models.NodeSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "nodes",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Verify the arguments
 			if args.NodeID == "" {
@@ -413,6 +416,7 @@ func (n *Node) GetAllocs(args *models.NodeSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "allocs",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Look for the node
 			allocs, err := state.AllocsByNode(ws, args.NodeID)
@@ -466,6 +470,7 @@ func (n *Node) GetClientAllocs(args *models.NodeSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "allocs",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Look for the node
 			node, err := state.NodeByID(ws, args.NodeID)
@@ -526,11 +531,37 @@ func (n *Node) UpdateJob(args *models.JobUpdateRequest, reply *models.GenericRes
 		return err
 	}
 
+	// Pause the jobs whose circuit breaker tripped, until they are resumed
+	for _, ju := range args.JobUpdates {
+		if !ju.Pause {
+			continue
+		}
+		pause := &models.JobPauseRequest{JobID: ju.JobID, WriteRequest: args.WriteRequest}
+		var resp models.JobResponse
+		if err := n.srv.endpoints.Job.setPaused(pause, models.JobStatusPause, models.JobStatusRunning, &resp); err != nil {
+			n.srv.logger.Warnf("server.job: failed to pause job %q as its circuit breaker tripped: %v", ju.JobID, err)
+		} else {
+			n.srv.logger.Warnf("server.job: paused job %q as its circuit breaker tripped", ju.JobID)
+		}
+	}
+
 	// Setup the response
 	reply.Index = index
 	return nil
 }
 
+// UpdateMetrics records the metrics of the tasks of a client, which the
+// leader keeps in memory for Status.JobMetrics
+func (n *Node) UpdateMetrics(args *models.MetricsUpdateRequest, reply *models.GenericResponse) error {
+	if done, err := n.srv.forward("Node.UpdateMetrics", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "client", "update_metrics"}, time.Now())
+
+	reply.Index = n.srv.jobMetrics.update(time.Now(), args.Metrics)
+	return nil
+}
+
 // UpdateAlloc is used to update the client status of an allocation
 func (n *Node) UpdateAlloc(args *models.AllocUpdateRequest, reply *models.GenericResponse) error {
 	if done, err := n.srv.forward("Node.UpdateAlloc", args, args, reply); done {
@@ -582,8 +613,9 @@ func (n *Node) UpdateAlloc(args *models.AllocUpdateRequest, reply *models.Generi
 func (n *Node) batchUpdate(future *batchFuture, updates []*models.Allocation) {
 	// Prepare the batch update
 	batch := &models.AllocUpdateRequest{
-		Alloc:        updates,
-		WriteRequest: models.WriteRequest{Region: n.srv.config.Region},
+		Alloc:              updates,
+		JobEventsRetention: n.srv.config.JobEventsRetention,
+		WriteRequest:       models.WriteRequest{Region: n.srv.config.Region},
 	}
 
 	// Commit this update via Raft
@@ -610,6 +642,7 @@ func (n *Node) List(args *models.NodeListRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "nodes",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Capture all the nodes
 			var err error
@@ -623,9 +656,16 @@ func (n *Node) List(args *models.NodeListRequest,
 				return err
 			}
 
+			pager, err := newPaginator(iter, &args.QueryOptions, func(raw interface{}) string {
+				return raw.(*models.Node).ID
+			})
+			if err != nil {
+				return err
+			}
+
 			var nodes []*models.NodeListStub
 			for {
-				raw := iter.Next()
+				raw := pager.Next()
 				if raw == nil {
 					break
 				}
@@ -640,6 +680,7 @@ func (n *Node) List(args *models.NodeListRequest,
 				return err
 			}
 			reply.Index = index
+			pager.setMeta(&reply.QueryMeta, index)
 
 			// Set the query response
 			n.srv.setQueryMeta(&reply.QueryMeta)
@@ -648,6 +689,30 @@ func (n *Node) List(args *models.NodeListRequest,
 	return n.srv.blockingRPC(&opts)
 }
 
+// ListStream is the streaming variant of List, sending the stubs of the
+// nodes as they are iterated instead of in a single reply
+func (n *Node) ListStream(ctx context.Context, args *models.NodeListRequest, enc *codec.Encoder) error {
+	return n.srv.streamList(ctx, "Node.ListStream", &args.QueryOptions, "nodes", enc,
+		func(state *store.StateStore, l *listStreamer) error {
+			var err error
+			var iter memdb.ResultIterator
+			if prefix := args.QueryOptions.Prefix; prefix != "" {
+				iter, err = state.NodesByIDPrefix(nil, prefix)
+			} else {
+				iter, err = state.Nodes(nil)
+			}
+			if err != nil {
+				return err
+			}
+			for raw := iter.Next(); raw != nil; raw = iter.Next() {
+				if err := l.add(raw.(*models.Node).Stub()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+}
+
 // createNodeEvals is used to create evaluations for each alloc on a node.
 // Each Eval is scoped to a job, so we need to potentially trigger many evals.
 func (n *Node) createNodeEvals(nodeID string, nodeIndex uint64) ([]string, uint64, error) {
@@ -8,7 +8,6 @@ package server
 
 import (
 	"reflect"
-	"sync"
 	"testing"
 	"time"
 	"github.com/actiontech/dtle/internal/models"
@@ -21,7 +20,6 @@ func TestNode_Register(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		args  *models.NodeRegisterRequest
@@ -42,7 +40,6 @@ func TestNode_Register(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.Register(tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.Register() error = %v, wantErr %v", err, tt.wantErr)
@@ -57,7 +54,6 @@ func TestNode_constructNodeServerInfoResponse(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		snap  *store.StateSnapshot
@@ -78,7 +74,6 @@ func TestNode_constructNodeServerInfoResponse(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.constructNodeServerInfoResponse(tt.args.snap, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.constructNodeServerInfoResponse() error = %v, wantErr %v", err, tt.wantErr)
@@ -93,7 +88,6 @@ func TestNode_Deregister(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		args  *models.NodeDeregisterRequest
@@ -114,7 +108,6 @@ func TestNode_Deregister(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.Deregister(tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.Deregister() error = %v, wantErr %v", err, tt.wantErr)
@@ -129,7 +122,6 @@ func TestNode_UpdateStatus(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		args  *models.NodeUpdateStatusRequest
@@ -150,7 +142,6 @@ func TestNode_UpdateStatus(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.UpdateStatus(tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.UpdateStatus() error = %v, wantErr %v", err, tt.wantErr)
@@ -186,7 +177,6 @@ func TestNode_Evaluate(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		args  *models.NodeEvaluateRequest
@@ -207,7 +197,6 @@ func TestNode_Evaluate(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.Evaluate(tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.Evaluate() error = %v, wantErr %v", err, tt.wantErr)
@@ -222,7 +211,6 @@ func TestNode_GetNode(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		args  *models.NodeSpecificRequest
@@ -243,7 +231,6 @@ func TestNode_GetNode(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.GetNode(tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.GetNode() error = %v, wantErr %v", err, tt.wantErr)
@@ -258,7 +245,6 @@ func TestNode_GetAllocs(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		args  *models.NodeSpecificRequest
@@ -279,7 +265,6 @@ func TestNode_GetAllocs(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.GetAllocs(tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.GetAllocs() error = %v, wantErr %v", err, tt.wantErr)
@@ -294,7 +279,6 @@ func TestNode_GetClientAllocs(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		args  *models.NodeSpecificRequest
@@ -315,7 +299,6 @@ func TestNode_GetClientAllocs(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.GetClientAllocs(tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.GetClientAllocs() error = %v, wantErr %v", err, tt.wantErr)
@@ -330,7 +313,6 @@ func TestNode_UpdateJob(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		args  *models.JobUpdateRequest
@@ -351,7 +333,6 @@ func TestNode_UpdateJob(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.UpdateJob(tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.UpdateJob() error = %v, wantErr %v", err, tt.wantErr)
@@ -366,7 +347,6 @@ func TestNode_UpdateAlloc(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		args  *models.AllocUpdateRequest
@@ -387,7 +367,6 @@ func TestNode_UpdateAlloc(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.UpdateAlloc(tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.UpdateAlloc() error = %v, wantErr %v", err, tt.wantErr)
@@ -402,7 +381,6 @@ func TestNode_batchUpdate(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		future  *batchFuture
@@ -422,7 +400,6 @@ func TestNode_batchUpdate(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			n.batchUpdate(tt.args.future, tt.args.updates)
 		})
@@ -435,7 +412,6 @@ func TestNode_List(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		args  *models.NodeListRequest
@@ -456,7 +432,6 @@ func TestNode_List(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			if err := n.List(tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Node.List() error = %v, wantErr %v", err, tt.wantErr)
@@ -471,7 +446,6 @@ func TestNode_createNodeEvals(t *testing.T) {
 		updates      []*models.Allocation
 		updateFuture *batchFuture
 		updateTimer  *time.Timer
-		updatesLock  sync.Mutex
 	}
 	type args struct {
 		nodeID    string
@@ -494,7 +468,6 @@ func TestNode_createNodeEvals(t *testing.T) {
 				updates:      tt.fields.updates,
 				updateFuture: tt.fields.updateFuture,
 				updateTimer:  tt.fields.updateTimer,
-				updatesLock:  tt.fields.updatesLock,
 			}
 			got, got1, err := n.createNodeEvals(tt.args.nodeID, tt.args.nodeIndex)
 			if (err != nil) != tt.wantErr {
@@ -0,0 +1,233 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/armon/go-metrics"
+	memdb "github.com/hashicorp/go-memdb"
+
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	// webhookQueueSize is how many notifications wait at most for a
+	// webhook. More are dropped rather than delay the server.
+	webhookQueueSize = 256
+
+	// webhookAttempts is how many times a notification is POSTed to a
+	// webhook that fails, waiting webhookRetryInterval, then twice as
+	// long, between attempts
+	webhookAttempts      = 3
+	webhookRetryInterval = time.Second
+
+	// webhookTimeout bounds each POST to a webhook
+	webhookTimeout = 10 * time.Second
+)
+
+// notifier POSTs the notifications of the server to its webhooks, each
+// from a goroutine of its own, so that neither the server nor a webhook
+// waits for a slow one
+type notifier struct {
+	webhooks []*webhook
+	client   *http.Client
+	logger   *ulog.Logger
+
+	// retryInterval is webhookRetryInterval, shorter in tests
+	retryInterval time.Duration
+}
+
+type webhook struct {
+	url string
+	ch  chan *models.Notification
+}
+
+// newNotifier returns the notifier of urls, nil if there is none
+func newNotifier(urls []string, logger *ulog.Logger) *notifier {
+	if len(urls) == 0 {
+		return nil
+	}
+	n := &notifier{
+		client:        &http.Client{Timeout: webhookTimeout},
+		logger:        logger,
+		retryInterval: webhookRetryInterval,
+	}
+	for _, url := range urls {
+		n.webhooks = append(n.webhooks, &webhook{url: url, ch: make(chan *models.Notification, webhookQueueSize)})
+	}
+	return n
+}
+
+// run delivers the notifications until shutdownCh is closed
+func (n *notifier) run(shutdownCh chan struct{}) {
+	for _, w := range n.webhooks {
+		go func(w *webhook) {
+			for {
+				select {
+				case event := <-w.ch:
+					n.deliver(w.url, event, shutdownCh)
+				case <-shutdownCh:
+					return
+				}
+			}
+		}(w)
+	}
+}
+
+// notify queues event for the webhooks, without waiting. The notifier
+// may be nil.
+func (n *notifier) notify(event *models.Notification) {
+	if n == nil {
+		return
+	}
+	for _, w := range n.webhooks {
+		select {
+		case w.ch <- event:
+		default:
+			metrics.IncrCounter([]string{"server", "webhook", "dropped"}, 1)
+			n.logger.Warnf("manager: Dropped the %s notification to webhook %s, too many are queued", event.Event, w.url)
+		}
+	}
+}
+
+// deliver POSTs event to url until it takes it, webhookAttempts times at
+// most
+func (n *notifier) deliver(url string, event *models.Notification, shutdownCh chan struct{}) {
+	wait := n.retryInterval
+	for attempt := 1; ; attempt++ {
+		err := n.post(url, event)
+		if err == nil {
+			metrics.IncrCounter([]string{"server", "webhook", "sent"}, 1)
+			return
+		}
+		if attempt == webhookAttempts {
+			metrics.IncrCounter([]string{"server", "webhook", "failed"}, 1)
+			n.logger.Warnf("manager: Failed to send the %s notification to webhook %s: %v", event.Event, url, err)
+			return
+		}
+		select {
+		case <-time.After(wait):
+			wait *= 2
+		case <-shutdownCh:
+			return
+		}
+	}
+}
+
+// post POSTs event to url as JSON
+func (n *notifier) post(url string, event *models.Notification) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook replied %s", resp.Status)
+	}
+	return nil
+}
+
+// test POSTs event to every webhook once, and returns how it went
+func (n *notifier) test(event *models.Notification) []*models.WebhookResult {
+	if n == nil {
+		return nil
+	}
+	results := make([]*models.WebhookResult, len(n.webhooks))
+	for i, w := range n.webhooks {
+		results[i] = &models.WebhookResult{URL: w.url}
+		if err := n.post(w.url, event); err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+// notifyLeadership notifies the server acquired the leadership, or lost it
+func (s *Server) notifyLeadership(isLeader bool) {
+	event := &models.Notification{
+		Event:     models.NotificationEventLeadership,
+		OldState:  "leader",
+		NewState:  "follower",
+		NodeID:    s.config.NodeName,
+		Server:    s.config.NodeName,
+		Timestamp: time.Now().UTC(),
+	}
+	if isLeader {
+		event.OldState, event.NewState = event.NewState, event.OldState
+	}
+	s.notifier.notify(event)
+}
+
+// notifyJobTransitions notifies the jobs changing status, until stopCh is
+// closed. The statuses the jobs have when it starts are not notified, the
+// previous leader did.
+func (s *Server) notifyJobTransitions(stopCh chan struct{}) {
+	var statuses map[string]string
+	for {
+		state := s.fsm.State()
+		ws := memdb.NewWatchSet()
+		ws.Add(stopCh)
+		ws.Add(state.AbandonCh())
+		iter, err := state.Jobs(ws)
+		if err != nil {
+			s.logger.Errorf("manager: failed to watch the jobs to notify: %v", err)
+			return
+		}
+		current := make(map[string]string)
+		for raw := iter.Next(); raw != nil; raw = iter.Next() {
+			job := raw.(*models.Job)
+			current[job.ID] = job.Status
+			old, ok := statuses[job.ID]
+			if statuses == nil || (ok && old == job.Status) {
+				continue
+			}
+			event := &models.Notification{
+				Event:     models.NotificationEventJob,
+				JobID:     job.ID,
+				OldState:  old,
+				NewState:  job.Status,
+				Server:    s.config.NodeName,
+				Timestamp: time.Now().UTC(),
+			}
+			// The node of the allocation last changed is where the job
+			// changed status
+			var modifyIndex uint64
+			allocs, err := state.AllocsByJob(nil, job.ID, false)
+			if err != nil {
+				s.logger.Errorf("manager: failed to look up the allocations of job %s to notify: %v", job.ID, err)
+			}
+			for _, alloc := range allocs {
+				if alloc.ModifyIndex >= modifyIndex {
+					modifyIndex = alloc.ModifyIndex
+					event.NodeID = alloc.NodeID
+				}
+			}
+			s.notifier.notify(event)
+		}
+		statuses = current
+
+		ws.Watch(nil)
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+	}
+}
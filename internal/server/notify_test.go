@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// testWebhook is a webhook failing its first failures requests, which
+// forwards the notifications it takes to received
+func testWebhook(t *testing.T, failures int32) (*httptest.Server, chan *models.Notification) {
+	received := make(chan *models.Notification, 16)
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event models.Notification
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("webhook body error = %v", err)
+		}
+		received <- &event
+	}))
+	return srv, received
+}
+
+func TestNotifier_retries(t *testing.T) {
+	srv, received := testWebhook(t, webhookAttempts-1)
+	defer srv.Close()
+
+	n := newNotifier([]string{srv.URL}, ulog.New(ioutil.Discard, ulog.ErrorLevel))
+	n.retryInterval = time.Millisecond
+	shutdownCh := make(chan struct{})
+	defer close(shutdownCh)
+	n.run(shutdownCh)
+
+	n.notify(&models.Notification{Event: models.NotificationEventJob, JobID: "job", OldState: "running", NewState: "failed"})
+	select {
+	case event := <-received:
+		if event.JobID != "job" || event.NewState != models.JobStatusFailed {
+			t.Errorf("webhook received %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("webhook received nothing")
+	}
+
+	if newNotifier(nil, nil) != nil {
+		t.Errorf("newNotifier() without webhooks is not nil")
+	}
+}
+
+func TestNotifier_test(t *testing.T) {
+	ok, received := testWebhook(t, 0)
+	defer ok.Close()
+	failing, _ := testWebhook(t, 1)
+	defer failing.Close()
+
+	n := newNotifier([]string{ok.URL, failing.URL}, ulog.New(ioutil.Discard, ulog.ErrorLevel))
+	results := n.test(&models.Notification{Event: models.NotificationEventTest})
+	if len(results) != 2 || results[0].Error != "" || results[1].Error == "" {
+		t.Fatalf("notifier.test() = %+v", results)
+	}
+	if event := <-received; event.Event != models.NotificationEventTest {
+		t.Errorf("webhook received %+v", event)
+	}
+}
+
+func TestServer_notifyJobTransitions(t *testing.T) {
+	srv, received := testWebhook(t, 0)
+	defer srv.Close()
+
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	s.notifier = newNotifier([]string{srv.URL}, s.logger)
+	s.notifier.run(s.shutdownCh)
+	defer close(s.shutdownCh)
+
+	job := &models.Job{ID: "job", Type: models.JobTypeSync, Status: models.JobStatusPending}
+	if err := s.fsm.State().UpsertJob(5, job); err != nil {
+		t.Fatalf("StateStore.UpsertJob() error = %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go s.notifyJobTransitions(stopCh)
+
+	// The status the job has already is not notified
+	time.Sleep(100 * time.Millisecond)
+	if err := s.fsm.State().UpdateJobStatus(6, job.ID, models.JobStatusPause); err != nil {
+		t.Fatalf("StateStore.UpdateJobStatus() error = %v", err)
+	}
+	select {
+	case event := <-received:
+		if event.Event != models.NotificationEventJob || event.OldState != models.JobStatusPending ||
+			event.NewState != models.JobStatusPause {
+			t.Errorf("webhook received %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("webhook received nothing")
+	}
+}
@@ -8,11 +8,14 @@ package server
 
 import (
 	"fmt"
-	"net"
+	"sync/atomic"
+	"time"
 
+	"github.com/armon/go-metrics"
+	memdb "github.com/hashicorp/go-memdb"
 	"github.com/hashicorp/raft"
-	"github.com/hashicorp/serf/serf"
 
+	ulog "github.com/actiontech/dtle/internal/logger"
 	"github.com/actiontech/dtle/internal/models"
 )
 
@@ -22,6 +25,8 @@ type Operator struct {
 }
 
 // RaftGetConfiguration is used to retrieve the current Raft configuration.
+// It is forwarded to the leader, unless stale reads are allowed, so the
+// view is authoritative.
 func (op *Operator) RaftGetConfiguration(args *models.GenericRequest, reply *models.RaftConfigurationResponse) error {
 	if done, err := op.srv.forward("Operator.RaftGetConfiguration", args, args, reply); done {
 		return err
@@ -34,39 +39,42 @@ func (op *Operator) RaftGetConfiguration(args *models.GenericRequest, reply *mod
 		return err
 	}
 
-	// Index the Udup information about the servers.
-	serverMap := make(map[raft.ServerAddress]serf.Member)
-	for _, member := range op.srv.serf.Members() {
-		valid, parts := isUdupServer(member)
-		if !valid {
-			continue
-		}
-
-		addr := (&net.TCPAddr{IP: member.Addr, Port: parts.Port}).String()
-		serverMap[raft.ServerAddress(addr)] = member
-	}
-
-	// Fill out the reply.
+	// Fill out the reply, naming the servers after the local peers they
+	// match.
 	leader := op.srv.raft.Leader()
 	reply.Index = future.Index()
+	op.srv.peerLock.RLock()
+	defer op.srv.peerLock.RUnlock()
 	for _, server := range future.Configuration().Servers {
-		node := "(unknown)"
-		if member, ok := serverMap[server.Address]; ok {
-			node = member.Name
-		}
-
 		entry := &models.RaftServer{
-			ID:      server.ID,
-			Node:    node,
-			Address: server.Address,
-			Leader:  server.Address == leader,
-			Voter:   server.Suffrage == raft.Voter,
+			ID:       server.ID,
+			Node:     "(unknown)",
+			Address:  server.Address,
+			Leader:   server.Address == leader,
+			Voter:    server.Suffrage == raft.Voter,
+			Suffrage: raftSuffrage(server.Suffrage),
+		}
+		if parts, ok := op.srv.localPeers[server.Address]; ok {
+			entry.Node = parts.Name
+			entry.Datacenter = parts.Datacenter
 		}
 		reply.Servers = append(reply.Servers, entry)
 	}
 	return nil
 }
 
+// raftSuffrage returns the name of the voting status of a Raft server
+func raftSuffrage(suffrage raft.ServerSuffrage) string {
+	switch suffrage {
+	case raft.Voter:
+		return models.RaftSuffrageVoter
+	case raft.Nonvoter:
+		return models.RaftSuffrageNonvoter
+	default:
+		return models.RaftSuffrageStaging
+	}
+}
+
 // RaftRemovePeerByAddress is used to kick a stale peer (one that it in the Raft
 // quorum but no longer known to Serf or the catalog) by address in the form of
 // "IP:port". The reply argument is not used, but it required to fulfill the RPC
@@ -113,11 +121,11 @@ REMOVE:
 	return nil
 }
 
-// RaftRemovePeerByID is used to kick a stale peer (one that is in the Raft
-// quorum but no longer known to Serf or the catalog) by address in the form of
-// "IP:port". The reply argument is not used, but is required to fulfill the RPC
-// interface.
-func (op *Operator) RaftRemovePeerByID(args *models.RaftRemovePeerRequest, reply *struct{}) error {
+// RaftRemovePeerByID is used to kick a dead peer (one that is in the Raft
+// quorum but no longer known to Serf or the catalog) by ID. The leader is
+// never removed, nor a voter whose removal would leave fewer live voters
+// than a quorum. The reply has the index of the new configuration.
+func (op *Operator) RaftRemovePeerByID(args *models.RaftRemovePeerRequest, reply *models.RaftRemovePeerResponse) error {
 	if done, err := op.srv.forward("Operator.RaftRemovePeerByID", args, args, reply); done {
 		return err
 	}
@@ -125,38 +133,472 @@ func (op *Operator) RaftRemovePeerByID(args *models.RaftRemovePeerRequest, reply
 	// Since this is an operation designed for humans to use, we will return
 	// an error if the supplied id isn't among the peers since it's
 	// likely they screwed up.
-	{
-		future := op.srv.raft.GetConfiguration()
-		if err := future.Error(); err != nil {
-			return err
-		}
-		for _, s := range future.Configuration().Servers {
-			if s.ID == args.ID {
-				args.Address = s.Address
-				goto REMOVE
-			}
+	future := op.srv.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+	servers := future.Configuration().Servers
+	var target *raft.Server
+	for i := range servers {
+		if servers[i].ID == args.ID {
+			target = &servers[i]
+			break
 		}
+	}
+	if target == nil {
 		return fmt.Errorf("id %q was not found in the Raft configuration",
 			args.ID)
 	}
+	args.Address = target.Address
+	if err := op.srv.checkPeerRemoval(servers, target); err != nil {
+		op.srv.logger.Printf("[WARN] udup.operator: Refusing to remove Raft peer %q (%s): %v",
+			args.ID, args.Address, err)
+		return err
+	}
 
-REMOVE:
-	// The Raft library itself will prevent various forms of foot-shooting,
-	// like making a configuration with no voters. Some consideration was
-	// given here to adding more checks, but it was decided to make this as
-	// low-level and direct as possible. We've got ACL coverage to lock this
-	// down, and if you are an operator, it's assumed you know what you are
-	// doing if you are calling this. If you remove a peer that's known to
-	// Serf, for example, it will come back when the leader does a reconcile
-	// pass.
-	var future raft.Future
-	future = op.srv.raft.RemoveServer(args.ID, 0, 0)
-	if err := future.Error(); err != nil {
+	removeFuture := op.srv.raft.RemoveServer(args.ID, 0, 0)
+	if err := removeFuture.Error(); err != nil {
 		op.srv.logger.Printf("[WARN] udup.operator: Failed to remove Raft peer with id %q: %v",
 			args.ID, err)
 		return err
 	}
 
-	op.srv.logger.Printf("[WARN] udup.operator: Removed Raft peer with id %q", args.ID)
+	metrics.IncrCounter([]string{"server", "operator", "raft_remove_peer"}, 1)
+	op.srv.logger.Printf("[WARN] udup.operator: Removed Raft peer with id %q (%s) (request %s)",
+		args.ID, args.Address, args.RequestID)
+	reply.Index = removeFuture.Index()
+	return nil
+}
+
+// checkPeerRemoval returns an error if target can't be safely removed from
+// the Raft configuration made of servers: it is the leader, or it is a
+// voter and the live voters left would be fewer than a quorum.
+func (s *Server) checkPeerRemoval(servers []raft.Server, target *raft.Server) error {
+	if target.Address == s.raft.Leader() {
+		return models.ErrRemoveLeader
+	}
+	if target.Suffrage != raft.Voter {
+		return nil
+	}
+	return s.checkQuorumWithout(servers, target.ID)
+}
+
+// checkQuorumWithout returns ErrRemovePeerQuorum unless the voters of
+// servers other than id that are known to be alive form a quorum of the
+// configuration left without id's vote
+func (s *Server) checkQuorumWithout(servers []raft.Server, id raft.ServerID) error {
+	s.peerLock.RLock()
+	defer s.peerLock.RUnlock()
+	voters, alive := 0, 0
+	for _, server := range servers {
+		if server.Suffrage != raft.Voter || server.ID == id {
+			continue
+		}
+		voters++
+		if _, ok := s.localPeers[server.Address]; ok {
+			alive++
+		}
+	}
+	if alive < voters/2+1 {
+		return models.ErrRemovePeerQuorum
+	}
+	return nil
+}
+
+// WarmCache pulls the digest of the connections pooled by the leader and
+// opens them on the server serving the request, as it would after winning
+// an election. It is meant to test the warm standby of followers.
+func (op *Operator) WarmCache(args *models.GenericRequest, reply *models.WarmCacheResponse) error {
+	if args.Region != "" && args.Region != op.srv.config.Region {
+		return op.srv.forwardRegion(args.Region, "Operator.WarmCache", false,
+			op.srv.regionTimeout(args.Region, args), args, reply)
+	}
+
+	if err := op.srv.pullHotConns(); err != nil {
+		return err
+	}
+	reply.Digest = len(op.srv.warmStandby.get())
+	reply.Warmed = op.srv.warmConns()
+	op.srv.logger.Printf("[INFO] udup.operator: Warmed %d of the %d connections pooled by the leader", reply.Warmed, reply.Digest)
+	return nil
+}
+
+// TestWebhook POSTs a test notification to the webhooks of the leader, once
+// each, and returns how it went, for users to check their endpoints
+func (op *Operator) TestWebhook(args *models.WebhookTestRequest, reply *models.WebhookTestResponse) error {
+	if done, err := op.srv.forward("Operator.TestWebhook", args, args, reply); done {
+		return err
+	}
+	if op.srv.notifier == nil {
+		return fmt.Errorf("no webhook is configured")
+	}
+
+	reply.Results = op.srv.notifier.test(&models.Notification{
+		Event:     models.NotificationEventTest,
+		NodeID:    op.srv.config.NodeName,
+		Server:    op.srv.config.NodeName,
+		Timestamp: time.Now().UTC(),
+	})
+	return nil
+}
+
+// Snapshot forces the leader to take a Raft snapshot, which compacts the
+// Raft log, and returns the index the snapshot was taken at. A request made
+// while a previous one is still running is rejected rather than queued.
+func (op *Operator) Snapshot(args *models.RaftSnapshotRequest, reply *models.RaftSnapshotResponse) error {
+	if done, err := op.srv.forward("Operator.Snapshot", args, args, reply); done {
+		return err
+	}
+
+	if !atomic.CompareAndSwapInt32(&op.srv.snapshotInProgress, 0, 1) {
+		return models.ErrSnapshotInProgress
+	}
+	defer atomic.StoreInt32(&op.srv.snapshotInProgress, 0)
+
+	future := op.srv.raft.Snapshot()
+	if err := future.Error(); err != nil {
+		op.srv.logger.Printf("[WARN] udup.operator: Failed to take Raft snapshot: %v", err)
+		return err
+	}
+	meta, snap, err := future.Open()
+	if err != nil {
+		return err
+	}
+	snap.Close()
+
+	op.srv.logger.Printf("[INFO] udup.operator: Took Raft snapshot at index %d", meta.Index)
+	reply.Index = meta.Index
+	return nil
+}
+
+// LeadershipTransfer hands the leadership to another voter, so the leader
+// can be stopped without clients waiting for an election: the voter of
+// args.ID, or the live voter the least behind if it is empty. The vendored
+// Raft has no TimeoutNow RPC, so the leader waits for the voter to have all
+// of its log, gives up its vote for the other voters to elect a new leader,
+// and gets its vote back from the new leader. Another voter as up to date
+// as the one picked may win that election, NewLeader is the one that did.
+// It is refused if the voter is more than LeaderTransferMaxLag Raft entries
+// behind, or if the other live voters couldn't form a quorum.
+func (op *Operator) LeadershipTransfer(args *models.LeadershipTransferRequest, reply *models.LeadershipTransferResponse) error {
+	if done, err := op.srv.forward("Operator.LeadershipTransfer", args, args, reply); done {
+		return err
+	}
+
+	future := op.srv.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+	var local raft.Server
+	voters := make(map[raft.ServerID]raft.Server)
+	for _, server := range future.Configuration().Servers {
+		switch {
+		case server.ID == op.srv.config.RaftConfig.LocalID:
+			local = server
+		case server.Suffrage == raft.Voter:
+			voters[server.ID] = server
+		}
+	}
+	reply.OldLeader = local.Address
+
+	indexes := make(map[raft.ServerID]uint64)
+	for id, server := range voters {
+		index, err := op.srv.raftLastIndex(server)
+		if err != nil {
+			op.srv.logger.Printf("[WARN] udup.operator: Failed to get the Raft progress of voter %q: %v", id, err)
+			continue
+		}
+		indexes[id] = index
+	}
+	lastIndex := op.srv.raft.LastIndex()
+	target, err := pickTransferTarget(args.ID, len(voters), indexes, lastIndex, op.srv.config.LeaderTransferMaxLag)
+	if err != nil {
+		op.srv.logger.Printf("[WARN] udup.operator: Refusing to transfer the leadership of %q: %v", reply.OldLeader, err)
+		return err
+	}
+
+	// The voter must have the whole log of the leader to win the election
+	deadline := time.Now().Add(op.srv.config.LeaderTransferTimeout)
+	for index := indexes[target]; index < lastIndex; {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("voter %q didn't catch up with the leader in %v, it is at index %d of %d",
+				target, op.srv.config.LeaderTransferTimeout, index, lastIndex)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if index, err = op.srv.raftLastIndex(voters[target]); err != nil {
+			return fmt.Errorf("failed to get the Raft progress of voter %q: %v", target, err)
+		}
+	}
+
+	op.srv.logger.Printf("[WARN] udup.operator: Transferring the leadership of %q to %q: %s",
+		reply.OldLeader, target, args.Reason)
+	if err := op.srv.raft.DemoteVoter(local.ID, 0, 0).Error(); err != nil {
+		op.srv.logger.Printf("[WARN] udup.operator: Failed to give up the vote of %q: %v", local.ID, err)
+		return err
+	}
+
+	// Wait for the election, then get the vote back from the new leader
+	for {
+		leader := op.srv.raft.Leader()
+		if leader != "" && leader != reply.OldLeader {
+			reply.NewLeader = leader
+			break
+		}
+		if time.Now().After(deadline) {
+			op.srv.logger.Printf("[WARN] udup.operator: No new leader elected after %q gave up its vote", reply.OldLeader)
+			return models.ErrNoLeader
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	promoteArgs := models.RaftPeerByIDRequest{
+		ID:           local.ID,
+		WriteRequest: models.WriteRequest{Region: op.srv.config.Region},
+	}
+	for {
+		var promoteReply struct{}
+		err := op.RaftPromotePeerByID(&promoteArgs, &promoteReply)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			op.srv.logger.Printf("[WARN] udup.operator: Failed to get the vote of %q back from %q: %v",
+				local.ID, reply.NewLeader, err)
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	metrics.IncrCounter([]string{"server", "operator", "leadership_transfer"}, 1)
+	op.srv.logger.Printf("[WARN] udup.operator: Transferred the leadership from %q to %q",
+		reply.OldLeader, reply.NewLeader)
 	return nil
 }
+
+// RaftPromotePeerByID gives back its vote to a non-voter of the Raft
+// configuration, as the leader of a leadership transfer asks the new leader
+// once it is elected. The reply argument is not used, but is required to
+// fulfill the RPC interface.
+func (op *Operator) RaftPromotePeerByID(args *models.RaftPeerByIDRequest, reply *struct{}) error {
+	if done, err := op.srv.forward("Operator.RaftPromotePeerByID", args, args, reply); done {
+		return err
+	}
+
+	future := op.srv.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+	for _, server := range future.Configuration().Servers {
+		if server.ID != args.ID {
+			continue
+		}
+		if server.Suffrage == raft.Voter {
+			return nil
+		}
+		if err := op.srv.raft.AddVoter(server.ID, server.Address, 0, 0).Error(); err != nil {
+			op.srv.logger.Printf("[WARN] udup.operator: Failed to promote Raft peer with id %q: %v",
+				args.ID, err)
+			return err
+		}
+		op.srv.logger.Printf("[WARN] udup.operator: Promoted Raft peer with id %q to a voter", args.ID)
+		return nil
+	}
+	return fmt.Errorf("id %q was not found in the Raft configuration", args.ID)
+}
+
+// raftLastIndex asks a Raft peer for the last index of its log
+func (s *Server) raftLastIndex(server raft.Server) (uint64, error) {
+	s.peerLock.RLock()
+	parts := s.localPeers[server.Address]
+	s.peerLock.RUnlock()
+	if parts == nil {
+		return 0, fmt.Errorf("unknown server %q", server.Address)
+	}
+
+	args := models.GenericRequest{
+		QueryOptions: models.QueryOptions{Region: s.config.Region},
+	}
+	var reply models.RaftProgressResponse
+	if err := s.connPool.RPC(s.config.Region, parts.Addr, "Status.RaftProgress", &args, &reply); err != nil {
+		return 0, err
+	}
+	return reply.LastLogIndex, nil
+}
+
+// pickTransferTarget returns the voter the leadership is handed to, out of
+// the indexes of the last Raft entry of the live voters other than the
+// leader: id, or the voter the least behind if it is empty. It is refused
+// if the voter is more than maxLag entries behind lastIndex, the last index
+// of the leader, or if the live voters aren't a quorum of the voters left
+// once the leader gave up its vote.
+func pickTransferTarget(id raft.ServerID, voters int, indexes map[raft.ServerID]uint64, lastIndex, maxLag uint64) (raft.ServerID, error) {
+	if voters == 0 {
+		return "", fmt.Errorf("there is no other voter to transfer the leadership to")
+	}
+	if quorum := voters/2 + 1; len(indexes) < quorum {
+		return "", fmt.Errorf("only %d of the %d other voters are live, %d are needed for a quorum",
+			len(indexes), voters, quorum)
+	}
+
+	if id == "" {
+		var best uint64
+		for voter, index := range indexes {
+			if id == "" || index > best || index == best && voter < id {
+				id, best = voter, index
+			}
+		}
+	}
+	index, ok := indexes[id]
+	if !ok {
+		return "", fmt.Errorf("%q isn't a live voter other than the leader", id)
+	}
+	if index < lastIndex && lastIndex-index > maxLag {
+		return "", fmt.Errorf("voter %q is %d Raft entries behind the leader, more than the %d allowed",
+			id, lastIndex-index, maxLag)
+	}
+	return id, nil
+}
+
+// SetLogLevel changes the level the server, and the client of its agent,
+// log at, for all the entries or those of a component or of a job, until
+// the agent restarts. The change only applies to the server serving the
+// request unless args.AllServers relays it to the other servers of the
+// region, whose failures are reported rather than returned. The clients of
+// the agents running no server are never reached: servers don't call
+// clients, each of them changes its level through its own agent.
+func (op *Operator) SetLogLevel(args *models.LogLevelRequest, reply *models.LogLevelResponse) error {
+	if args.Region != "" && args.Region != op.srv.config.Region {
+		return op.srv.forwardRegion(args.Region, "Operator.SetLogLevel", false,
+			op.srv.regionTimeout(args.Region, args), args, reply)
+	}
+	change, err := op.srv.logger.ChangeLevel(args.Level, args.Component, args.JobID)
+	if err != nil {
+		return err
+	}
+	op.srv.logger.Printf("[INFO] udup.operator: Logging %s", change)
+	self := fmt.Sprintf("%s.%s", op.srv.config.NodeName, op.srv.config.Region)
+	reply.Agents = map[string]*models.AgentLogLevels{self: {Levels: LogLevels(op.srv.logger)}}
+	if !args.AllServers {
+		return nil
+	}
+
+	op.srv.peerLock.RLock()
+	var peers []*serverParts
+	for _, server := range op.srv.localPeers {
+		if server.Name != self {
+			peers = append(peers, server)
+		}
+	}
+	op.srv.peerLock.RUnlock()
+
+	relay := *args
+	relay.AllServers = false
+	for _, server := range peers {
+		var peerReply models.LogLevelResponse
+		if err := op.srv.connPool.RPC(op.srv.config.Region, server.Addr, "Operator.SetLogLevel", &relay, &peerReply); err != nil {
+			op.srv.logger.Printf("[WARN] udup.operator: Failed to change the log level of %s: %v", server.Name, err)
+			reply.Agents[server.Name] = &models.AgentLogLevels{Error: err.Error()}
+			continue
+		}
+		for name, levels := range peerReply.Agents {
+			reply.Agents[name] = levels
+		}
+	}
+	return nil
+}
+
+// MaintenanceMode enters or leaves the maintenance mode of the cluster.
+// Entering it pauses the running and pending jobs, whose tasks stop at
+// their checkpoint, and no job can be registered or resumed until it is
+// left, which resumes the jobs it paused. The mode is kept in the state, so
+// it outlives the leader. A request for the current mode changes nothing.
+func (op *Operator) MaintenanceMode(args *models.MaintenanceModeRequest, reply *models.MaintenanceModeResponse) error {
+	if done, err := op.srv.forward("Operator.MaintenanceMode", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "operator", "maintenance_mode"}, time.Now())
+
+	state := op.srv.fsm.State()
+	mode, err := state.Maintenance(memdb.NewWatchSet())
+	if err != nil {
+		return err
+	}
+	if mode.Enabled == args.Enabled {
+		reply.Maintenance = mode
+		reply.Index = mode.ModifyIndex
+		return nil
+	}
+
+	// The leader picks the jobs, for every server to change the same
+	var jobs []*models.Job
+	if args.Enabled {
+		iter, err := state.Jobs(memdb.NewWatchSet())
+		if err != nil {
+			return err
+		}
+		for raw := iter.Next(); raw != nil; raw = iter.Next() {
+			job := raw.(*models.Job)
+			if job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending {
+				jobs = append(jobs, job)
+			}
+		}
+		args.Since = time.Now().UTC()
+	} else {
+		for _, jobID := range mode.Jobs {
+			job, err := state.JobByID(memdb.NewWatchSet(), jobID)
+			if err != nil {
+				return err
+			}
+			// Jobs deleted or resumed meanwhile are left as they are
+			if job != nil && job.Status == models.JobStatusPause {
+				jobs = append(jobs, job)
+			}
+		}
+		args.Since = time.Time{}
+	}
+	// The evaluations pausing or resuming the allocations of the jobs are
+	// committed along with the change
+	triggeredBy := models.EvalTriggerJobResume
+	if args.Enabled {
+		triggeredBy = models.EvalTriggerJobPause
+	}
+	args.Jobs, args.Evals = nil, nil
+	for _, job := range jobs {
+		args.Jobs = append(args.Jobs, job.ID)
+		args.Evals = append(args.Evals, &models.Evaluation{
+			ID:          models.GenerateUUID(),
+			Type:        job.Type,
+			TriggeredBy: triggeredBy,
+			JobID:       job.ID,
+			Status:      models.EvalStatusPending,
+		})
+	}
+
+	_, index, err := op.srv.raftApply(models.MaintenanceModeRequestType, args)
+	if err != nil {
+		op.srv.logger.Printf("[WARN] udup.operator: Failed to change the maintenance mode: %v", err)
+		return err
+	}
+	reply.Index = index
+	reply.Jobs = args.Jobs
+	if reply.Maintenance, err = op.srv.fsm.State().Maintenance(memdb.NewWatchSet()); err != nil {
+		return err
+	}
+	if args.Enabled {
+		op.srv.logger.Printf("[WARN] udup.operator: Entered the maintenance mode (%s), pausing %d jobs (request %s)",
+			args.Reason, len(jobs), args.RequestID)
+	} else {
+		op.srv.logger.Printf("[WARN] udup.operator: Left the maintenance mode, resuming %d jobs (request %s)",
+			len(jobs), args.RequestID)
+	}
+	return nil
+}
+
+// LogLevels returns the levels logger logs at
+func LogLevels(logger *ulog.Logger) []*models.LogLevel {
+	overrides := logger.LevelOverrides()
+	levels := make([]*models.LogLevel, 0, len(overrides))
+	for _, o := range overrides {
+		levels = append(levels, &models.LogLevel{Component: o.Component, JobID: o.JobID, Level: o.Level.String()})
+	}
+	return levels
+}
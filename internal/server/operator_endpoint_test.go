@@ -0,0 +1,384 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	memdb "github.com/hashicorp/go-memdb"
+	"github.com/hashicorp/raft"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+func Test_pickTransferTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      raft.ServerID
+		voters  int
+		indexes map[raft.ServerID]uint64
+		want    raft.ServerID
+		wantErr string
+	}{
+		{"no other voter", "", 0, nil, "", "there is no other voter"},
+		{"no quorum left", "", 3, map[raft.ServerID]uint64{"server-b": 100}, "", "only 1 of the 3 other voters are live"},
+		{"least behind", "", 2, map[raft.ServerID]uint64{"server-b": 95, "server-c": 100}, "server-c", ""},
+		{"smaller ID first", "", 2, map[raft.ServerID]uint64{"server-c": 100, "server-b": 100}, "server-b", ""},
+		{"named within the lag", "server-b", 2, map[raft.ServerID]uint64{"server-b": 90, "server-c": 100}, "server-b", ""},
+		{"named lagging", "server-b", 2, map[raft.ServerID]uint64{"server-b": 89, "server-c": 100}, "", `voter "server-b" is 11 Raft entries behind`},
+		{"named unknown", "server-d", 2, map[raft.ServerID]uint64{"server-b": 100, "server-c": 100}, "", `"server-d" isn't a live voter`},
+		{"all lagging", "", 1, map[raft.ServerID]uint64{"server-b": 50}, "", `voter "server-b" is 50 Raft entries behind`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pickTransferTarget(tt.id, tt.voters, tt.indexes, 100, 10)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Fatalf("pickTransferTarget() error = %v, want %q", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("pickTransferTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testRaftServer returns a server that is the leader of a single node
+// in-memory Raft cluster, and known as its own local peer
+func testRaftServer(t *testing.T) *Server {
+	state, err := store.NewStateStore(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("store.NewStateStore() error = %v", err)
+	}
+	fsm := &udupFSM{state: state, timetable: NewTimeTable(timeTableGranularity, timeTableLimit)}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = "server-a"
+	conf.LogOutput = ioutil.Discard
+	conf.HeartbeatTimeout = 50 * time.Millisecond
+	conf.ElectionTimeout = 50 * time.Millisecond
+	conf.LeaderLeaseTimeout = 50 * time.Millisecond
+	conf.CommitTimeout = 5 * time.Millisecond
+	logs := raft.NewInmemStore()
+	snaps := raft.NewInmemSnapshotStore()
+	addr, trans := raft.NewInmemTransport("")
+	configuration := raft.Configuration{
+		Servers: []raft.Server{{Suffrage: raft.Voter, ID: conf.LocalID, Address: addr}},
+	}
+	if err := raft.BootstrapCluster(conf, logs, logs, snaps, trans, configuration); err != nil {
+		t.Fatalf("raft.BootstrapCluster() error = %v", err)
+	}
+	r, err := raft.NewRaft(conf, fsm, logs, logs, snaps, trans)
+	if err != nil {
+		t.Fatalf("raft.NewRaft() error = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for r.State() != raft.Leader {
+		if time.Now().After(deadline) {
+			r.Shutdown()
+			t.Fatalf("raft never became the leader")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return &Server{
+		config:     &uconf.ServerConfig{Region: "global", RPCHoldTimeout: time.Second},
+		logger:     ulog.New(ioutil.Discard, ulog.ErrorLevel),
+		raft:       r,
+		fsm:        fsm,
+		rpcDrainer: newRPCDrainer(),
+		peers:      make(map[string][]*serverParts),
+		localPeers: map[raft.ServerAddress]*serverParts{
+			addr: {Name: "server-a", Region: "global", Datacenter: "dc1"},
+		},
+		shutdownCh:    make(chan struct{}),
+		jobMetrics:    newJobMetrics(),
+		verifications: newJobVerifications(),
+	}
+}
+
+func TestOperator_RaftGetConfiguration(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	op := &Operator{srv: s}
+
+	args := &models.GenericRequest{QueryOptions: models.QueryOptions{Region: "global"}}
+	var reply models.RaftConfigurationResponse
+	if err := op.RaftGetConfiguration(args, &reply); err != nil {
+		t.Fatalf("Operator.RaftGetConfiguration() error = %v", err)
+	}
+	if len(reply.Servers) != 1 {
+		t.Fatalf("Operator.RaftGetConfiguration() returned %d servers, want 1", len(reply.Servers))
+	}
+	want := &models.RaftServer{
+		ID:         "server-a",
+		Node:       "server-a",
+		Address:    s.raft.Leader(),
+		Leader:     true,
+		Voter:      true,
+		Suffrage:   models.RaftSuffrageVoter,
+		Datacenter: "dc1",
+	}
+	if got := reply.Servers[0]; *got != *want {
+		t.Errorf("Operator.RaftGetConfiguration() server = %+v, want %+v", got, want)
+	}
+	if reply.Index == 0 {
+		t.Errorf("Operator.RaftGetConfiguration() Index = 0")
+	}
+}
+
+func TestOperator_RaftRemovePeerByID(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	op := &Operator{srv: s}
+
+	tests := []struct {
+		name    string
+		id      raft.ServerID
+		wantErr error
+	}{
+		{"leader", "server-a", models.ErrRemoveLeader},
+		{"unknown", "server-z", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := &models.RaftRemovePeerRequest{ID: tt.id}
+			args.Region = "global"
+			var reply models.RaftRemovePeerResponse
+			err := op.RaftRemovePeerByID(args, &reply)
+			if err == nil {
+				t.Fatalf("Operator.RaftRemovePeerByID() removed %q", tt.id)
+			}
+			if tt.wantErr != nil && err != tt.wantErr {
+				t.Errorf("Operator.RaftRemovePeerByID() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServer_checkPeerRemoval(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	leader := s.raft.Leader()
+	s.localPeers["b"] = &serverParts{Name: "server-b"}
+
+	servers := []raft.Server{
+		{Suffrage: raft.Voter, ID: "server-a", Address: leader},
+		{Suffrage: raft.Voter, ID: "server-b", Address: "b"},
+		{Suffrage: raft.Voter, ID: "server-c", Address: "c"},
+		{Suffrage: raft.Voter, ID: "server-d", Address: "d"},
+		{Suffrage: raft.Nonvoter, ID: "server-e", Address: "e"},
+	}
+	tests := []struct {
+		name    string
+		target  int
+		wantErr error
+	}{
+		{"leader", 0, models.ErrRemoveLeader},
+		{"live voter", 1, models.ErrRemovePeerQuorum},
+		{"dead voter", 2, nil},
+		{"non-voter", 4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.checkPeerRemoval(servers, &servers[tt.target]); err != tt.wantErr {
+				t.Errorf("Server.checkPeerRemoval() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOperator_SetLogLevel(t *testing.T) {
+	s := &Server{
+		config:     &uconf.ServerConfig{NodeName: "server-a", Region: "global"},
+		logger:     ulog.New(ioutil.Discard, ulog.InfoLevel),
+		localPeers: map[raft.ServerAddress]*serverParts{"a": {Name: "server-a.global"}},
+	}
+	op := &Operator{srv: s}
+
+	args := &models.LogLevelRequest{Level: "debug", Component: "server.rpc", AllServers: true}
+	var reply models.LogLevelResponse
+	if err := op.SetLogLevel(args, &reply); err != nil {
+		t.Fatalf("Operator.SetLogLevel() error = %v", err)
+	}
+	want := map[string]*models.AgentLogLevels{"server-a.global": {Levels: []*models.LogLevel{
+		{Level: "INFO"},
+		{Component: "server.rpc", Level: "DEBUG"},
+	}}}
+	if !reflect.DeepEqual(reply.Agents, want) {
+		t.Errorf("Operator.SetLogLevel() = %v, want %v", reply.Agents, want)
+	}
+
+	for _, args := range []*models.LogLevelRequest{
+		{Level: "loud"},
+		{Component: "server.rpc", JobID: "job1", Level: "debug"},
+		{},
+	} {
+		if err := op.SetLogLevel(args, &models.LogLevelResponse{}); err == nil {
+			t.Errorf("Operator.SetLogLevel(%+v) = nil error", args)
+		}
+	}
+}
+
+func TestOperator_MaintenanceMode(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	broker, err := NewEvalBroker(time.Second, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.fsm.evalBroker = broker
+	state := s.fsm.State()
+
+	for i, status := range []string{models.JobStatusRunning, models.JobStatusPending, models.JobStatusPause, models.JobStatusDead} {
+		job := &models.Job{ID: fmt.Sprintf("job%d", i+1), Type: models.JobTypeSync}
+		if err := state.UpsertJob(uint64(10+i), job); err != nil {
+			t.Fatalf("StateStore.UpsertJob() error = %v", err)
+		}
+		if i == 0 {
+			alloc := &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), NodeID: "node1", JobID: job.ID,
+				Job: job, DesiredStatus: models.AllocDesiredStatusRun, ClientStatus: models.AllocClientStatusRunning}
+			if err := state.UpsertAllocs(20, []*models.Allocation{alloc}); err != nil {
+				t.Fatalf("StateStore.UpsertAllocs() error = %v", err)
+			}
+		}
+		if err := state.UpdateJobStatus(uint64(30+i), job.ID, status); err != nil {
+			t.Fatalf("StateStore.UpdateJobStatus() error = %v", err)
+		}
+	}
+	op := &Operator{srv: s}
+	j := &Job{srv: s}
+	write := models.WriteRequest{Region: "global"}
+	// check tells the status of job1 to job4 and their last evaluation
+	check := func(statuses []string, triggeredBy []string) {
+		t.Helper()
+		for i := range statuses {
+			jobID := fmt.Sprintf("job%d", i+1)
+			job, err := s.fsm.State().JobByID(memdb.NewWatchSet(), jobID)
+			if err != nil || job.Status != statuses[i] {
+				t.Errorf("%s status = %v (%v), want %s", jobID, job.Status, err, statuses[i])
+			}
+			evals, err := s.fsm.State().EvalsByJob(memdb.NewWatchSet(), jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			for _, eval := range evals {
+				if eval.JobModifyIndex >= job.JobModifyIndex {
+					got = eval.TriggeredBy
+				}
+			}
+			if got != triggeredBy[i] {
+				t.Errorf("%s evaluation triggered by %q, want %q", jobID, got, triggeredBy[i])
+			}
+		}
+	}
+
+	var reply models.MaintenanceModeResponse
+	if err := op.MaintenanceMode(&models.MaintenanceModeRequest{Enabled: true, Reason: "upgrade", WriteRequest: write}, &reply); err != nil {
+		t.Fatalf("Operator.MaintenanceMode() error = %v", err)
+	}
+	if !reflect.DeepEqual(reply.Jobs, []string{"job1", "job2"}) || !reply.Maintenance.Enabled ||
+		reply.Maintenance.Reason != "upgrade" || reply.Maintenance.Since.IsZero() {
+		t.Errorf("Operator.MaintenanceMode() = %+v, %+v, want job1 and job2 paused", reply, reply.Maintenance)
+	}
+	check([]string{models.JobStatusPause, models.JobStatusPause, models.JobStatusPause, models.JobStatusDead},
+		[]string{models.EvalTriggerJobPause, models.EvalTriggerJobPause, "", ""})
+	// The evaluations are committed along with the change
+	evals, err := state.EvalsByJob(memdb.NewWatchSet(), "job1")
+	if err != nil || len(evals) != 1 || evals[0].CreateIndex != reply.Maintenance.ModifyIndex || reply.Index != reply.Maintenance.ModifyIndex {
+		t.Errorf("job1 evaluations = %+v (%v), want one at index %d", evals, err, reply.Maintenance.ModifyIndex)
+	}
+
+	// Entering it again changes nothing
+	var again models.MaintenanceModeResponse
+	if err := op.MaintenanceMode(&models.MaintenanceModeRequest{Enabled: true, WriteRequest: write}, &again); err != nil {
+		t.Fatalf("Operator.MaintenanceMode() error = %v", err)
+	}
+	if again.Jobs != nil || again.Maintenance.Reason != "upgrade" {
+		t.Errorf("Operator.MaintenanceMode() again = %+v, want no change", again)
+	}
+
+	// No job starts
+	if err := j.Register(&models.JobRegisterRequest{Job: &models.Job{ID: "job5", Type: models.JobTypeSync}, WriteRequest: write},
+		&models.JobResponse{}); err != models.ErrMaintenanceMode {
+		t.Errorf("Job.Register() error = %v, want %v", err, models.ErrMaintenanceMode)
+	}
+	if err := j.Resume(&models.JobPauseRequest{JobID: "job3", WriteRequest: write}, &models.JobResponse{}); err != models.ErrMaintenanceMode {
+		t.Errorf("Job.Resume() error = %v, want %v", err, models.ErrMaintenanceMode)
+	}
+
+	var ping models.PingResponse
+	if err := (&Status{srv: s}).Ping(struct{}{}, &ping); err != nil {
+		t.Fatalf("Status.Ping() error = %v", err)
+	}
+	if ping.Maintenance == nil || !ping.Maintenance.Enabled {
+		t.Errorf("Status.Ping() maintenance = %+v, want enabled", ping.Maintenance)
+	}
+
+	// The mode is kept in snapshots
+	snap, err := s.fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &bufferSink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("Persist() error = %v", err)
+	}
+	fresh, err := store.NewStateStore(ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm := &udupFSM{logOutput: ioutil.Discard, state: fresh, timetable: NewTimeTable(timeTableGranularity, timeTableLimit)}
+	if err := fsm.Restore(ioutil.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	restored, err := fsm.State().Maintenance(memdb.NewWatchSet())
+	if err != nil || !reflect.DeepEqual(restored.Jobs, reply.Maintenance.Jobs) || !restored.Enabled {
+		t.Errorf("restored maintenance mode = %+v, %v, want %+v", restored, err, reply.Maintenance)
+	}
+
+	// It is left out while a server predating it may restore it
+	s.fsm.schemaVersion = func() uint8 { return models.LegacySchemaVersion }
+	if snap, err = s.fsm.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	sink = &bufferSink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("Persist() error = %v", err)
+	}
+	if fresh, err = store.NewStateStore(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	fsm = &udupFSM{logOutput: ioutil.Discard, state: fresh, timetable: NewTimeTable(timeTableGranularity, timeTableLimit)}
+	if err := fsm.Restore(ioutil.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if restored, _ = fsm.State().Maintenance(memdb.NewWatchSet()); restored.Enabled {
+		t.Errorf("maintenance mode restored from a legacy snapshot = %+v, want none", restored)
+	}
+	s.fsm.schemaVersion = s.raftSchemaVersion
+
+	// Leaving it resumes the jobs it paused only, job2 waiting on its
+	// placement
+	if err := op.MaintenanceMode(&models.MaintenanceModeRequest{WriteRequest: write}, &reply); err != nil {
+		t.Fatalf("Operator.MaintenanceMode() error = %v", err)
+	}
+	if !reflect.DeepEqual(reply.Jobs, []string{"job1", "job2"}) || reply.Maintenance.Enabled {
+		t.Errorf("Operator.MaintenanceMode() = %+v, %+v, want job1 and job2 resumed", reply, reply.Maintenance)
+	}
+	check([]string{models.JobStatusRunning, models.JobStatusPending, models.JobStatusPause, models.JobStatusDead},
+		[]string{models.EvalTriggerJobResume, models.EvalTriggerJobResume, "", ""})
+}
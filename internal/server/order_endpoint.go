@@ -87,6 +87,7 @@ func (o *Order) List(args *models.OrderListRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "orders",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Capture all the orders
 			var err error
@@ -100,9 +101,16 @@ func (o *Order) List(args *models.OrderListRequest,
 				return err
 			}
 
+			pager, err := newPaginator(iter, &args.QueryOptions, func(raw interface{}) string {
+				return raw.(*models.Order).ID
+			})
+			if err != nil {
+				return err
+			}
+
 			var orders []*models.Order
 			for {
-				raw := iter.Next()
+				raw := pager.Next()
 				if raw == nil {
 					break
 				}
@@ -117,6 +125,7 @@ func (o *Order) List(args *models.OrderListRequest,
 				return err
 			}
 			reply.Index = index
+			pager.setMeta(&reply.QueryMeta, index)
 
 			// Set the query response
 			o.srv.setQueryMeta(&reply.QueryMeta)
@@ -136,6 +145,7 @@ func (o *Order) ListPending(args *models.OrderListRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "orders",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Capture all the orders
 			var err error
@@ -187,6 +197,7 @@ func (j *Order) GetOrder(args *models.OrderSpecificRequest,
 	opts := blockingOptions{
 		queryOpts: &args.QueryOptions,
 		queryMeta: &reply.QueryMeta,
+		table:     "orders",
 		run: func(ws memdb.WatchSet, state *store.StateStore) error {
 			// Look for the job
 			out, err := state.OrderByID(ws, args.OrderID)
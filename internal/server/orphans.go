@@ -0,0 +1,192 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	memdb "github.com/hashicorp/go-memdb"
+
+	log "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+// orphan is a job the cluster should run which no worker runs
+type orphan struct {
+	job    *models.Job
+	reason string
+	// trigger is the trigger of the evaluation rescheduling the job
+	trigger string
+	// nodeID is the missing or down node the allocations of the job are on
+	nodeID string
+	// pending is whether an evaluation of the job is not complete yet,
+	// which may still schedule it
+	pending bool
+}
+
+// findOrphans returns the pending or running jobs of state with no
+// allocation running on a node able to run it, by ID
+func findOrphans(state *store.StateStore) (map[string]*orphan, error) {
+	ws := memdb.NewWatchSet()
+	iter, err := state.Jobs(ws)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]*models.Node)
+	nodeByID := func(id string) (*models.Node, error) {
+		if node, ok := nodes[id]; ok {
+			return node, nil
+		}
+		node, err := state.NodeByID(ws, id)
+		nodes[id] = node
+		return node, err
+	}
+
+	orphans := make(map[string]*orphan)
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		job := raw.(*models.Job)
+		if job.Status != models.JobStatusRunning && job.Status != models.JobStatusPending {
+			continue
+		}
+		allocs, err := state.AllocsByJob(ws, job.ID, false)
+		if err != nil {
+			return nil, err
+		}
+		var live, missing, down int
+		var missingNode, downNode string
+		for _, alloc := range allocs {
+			if alloc.TerminalStatus() {
+				continue
+			}
+			node, err := nodeByID(alloc.NodeID)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case node == nil:
+				missing++
+				missingNode = alloc.NodeID
+			case node.Status == models.NodeStatusDown:
+				down++
+				downNode = alloc.NodeID
+			default:
+				live++
+			}
+		}
+
+		var o *orphan
+		switch {
+		case live > 0:
+		case missing > 0:
+			o = &orphan{job: job, reason: fmt.Sprintf("%d allocations on missing nodes", missing),
+				trigger: models.EvalTriggerNodeUpdate, nodeID: missingNode}
+		case down > 0:
+			o = &orphan{job: job, reason: fmt.Sprintf("%d allocations on down nodes", down),
+				trigger: models.EvalTriggerNodeUpdate, nodeID: downNode}
+		default:
+			o = &orphan{job: job, reason: "no allocation", trigger: models.EvalTriggerJobRegister}
+		}
+		if o == nil {
+			continue
+		}
+
+		evals, err := state.EvalsByJob(ws, job.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, eval := range evals {
+			if !eval.TerminalStatus() {
+				o.pending = true
+			}
+		}
+		orphans[job.ID] = o
+	}
+	return orphans, nil
+}
+
+// reconcileOrphans periodically looks for the jobs no worker runs, until
+// stopCh is closed as the leadership is lost. An orphan is rescheduled
+// when it is found, and marked failed only if it is still an orphan the
+// next time, its evaluations complete.
+func (s *Server) reconcileOrphans(stopCh chan struct{}) {
+	interval := s.config.OrphanReconcileInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// suspects are the orphans found before, by job ID
+	suspects := make(map[string]string)
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if !s.IsLeader() {
+				continue
+			}
+			if err := s.reconcileOrphansOnce(suspects); err != nil {
+				s.logger.Errorf("manager: failed to reconcile the orphaned jobs: %v", err)
+			}
+		}
+	}
+}
+
+// reconcileOrphansOnce acts on the orphans of the current state, given the
+// suspects found before, which it updates
+func (s *Server) reconcileOrphansOnce(suspects map[string]string) error {
+	orphans, err := findOrphans(s.fsm.State())
+	if err != nil {
+		return err
+	}
+	for id := range suspects {
+		if _, ok := orphans[id]; !ok {
+			s.logger.WithField(log.FieldJobID, id).Infof("manager: job is no longer orphaned")
+			metrics.IncrCounter([]string{"server", "orphans", "recovered"}, 1)
+			delete(suspects, id)
+		}
+	}
+
+	for id, o := range orphans {
+		logger := s.logger.WithField(log.FieldJobID, id)
+		if o.pending {
+			// Being scheduled
+			continue
+		}
+		if reason, ok := suspects[id]; ok {
+			logger.Warnf("manager: job is still orphaned (%s, before %s), marking it failed", o.reason, reason)
+			req := models.JobUpdateStatusRequest{JobID: id, Status: models.JobStatusFailed}
+			if _, _, err := s.raftApply(models.JobUpdateStatusRequestType, &req); err != nil {
+				return err
+			}
+			metrics.IncrCounter([]string{"server", "orphans", "failed"}, 1)
+			delete(suspects, id)
+			continue
+		}
+
+		suspects[id] = o.reason
+		logger.Warnf("manager: job is orphaned (%s), rescheduling it", o.reason)
+		eval := &models.Evaluation{
+			ID:             models.GenerateUUID(),
+			Type:           o.job.Type,
+			TriggeredBy:    o.trigger,
+			JobID:          id,
+			JobModifyIndex: o.job.ModifyIndex,
+			NodeID:         o.nodeID,
+			Status:         models.EvalStatusPending,
+		}
+		req := models.EvalUpdateRequest{Evals: []*models.Evaluation{eval}}
+		if _, _, err := s.raftApply(models.EvalUpdateRequestType, &req); err != nil {
+			return err
+		}
+		metrics.IncrCounter([]string{"server", "orphans", "rescheduled"}, 1)
+	}
+	return nil
+}
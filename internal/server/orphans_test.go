@@ -0,0 +1,118 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	memdb "github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func TestServer_reconcileOrphansOnce(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	evalBroker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.fsm.evalBroker = evalBroker
+	s.fsm.blockedEvals = NewBlockedEvals(evalBroker)
+	state := s.fsm.State()
+
+	ready, down, gone := models.GenerateUUID(), models.GenerateUUID(), models.GenerateUUID()
+	if err := state.UpsertNode(1, &models.Node{ID: ready, Status: models.NodeStatusReady}); err != nil {
+		t.Fatalf("StateStore.UpsertNode() error = %v", err)
+	}
+	if err := state.UpsertNode(2, &models.Node{ID: down, Status: models.NodeStatusDown}); err != nil {
+		t.Fatalf("StateStore.UpsertNode() error = %v", err)
+	}
+	var allocs []*models.Allocation
+	for i, id := range []string{"healthy", "lost", "down", "idle", "paused"} {
+		job := &models.Job{ID: id, Type: models.JobTypeSync}
+		if err := state.UpsertJob(uint64(10+i), job); err != nil {
+			t.Fatalf("StateStore.UpsertJob() error = %v", err)
+		}
+		node := map[string]string{"healthy": ready, "lost": gone, "down": down}[id]
+		if node != "" {
+			allocs = append(allocs, &models.Allocation{ID: models.GenerateUUID(), EvalID: models.GenerateUUID(), JobID: id, Job: job, NodeID: node,
+				DesiredStatus: models.AllocDesiredStatusRun, ClientStatus: models.AllocClientStatusRunning})
+		}
+	}
+	if err := state.UpsertAllocs(20, allocs); err != nil {
+		t.Fatalf("StateStore.UpsertAllocs() error = %v", err)
+	}
+	if err := state.UpdateJobStatus(21, "idle", models.JobStatusRunning); err != nil {
+		t.Fatalf("StateStore.UpdateJobStatus() error = %v", err)
+	}
+	if err := state.UpdateJobStatus(22, "paused", models.JobStatusPause); err != nil {
+		t.Fatalf("StateStore.UpdateJobStatus() error = %v", err)
+	}
+
+	// The orphans are rescheduled
+	suspects := make(map[string]string)
+	if err := s.reconcileOrphansOnce(suspects); err != nil {
+		t.Fatalf("Server.reconcileOrphansOnce() error = %v", err)
+	}
+	if len(suspects) != 3 || suspects["lost"] == "" || suspects["down"] == "" || suspects["idle"] == "" {
+		t.Fatalf("suspects = %v, want lost, down and idle", suspects)
+	}
+	ws := memdb.NewWatchSet()
+	var evals []*models.Evaluation
+	for id, trigger := range map[string]string{"lost": models.EvalTriggerNodeUpdate, "down": models.EvalTriggerNodeUpdate,
+		"idle": models.EvalTriggerJobRegister} {
+		jobEvals, err := state.EvalsByJob(ws, id)
+		if err != nil {
+			t.Fatalf("StateStore.EvalsByJob() error = %v", err)
+		}
+		if len(jobEvals) != 1 || jobEvals[0].TriggeredBy != trigger {
+			t.Fatalf("evals of %v = %v, want one triggered by %v", id, jobEvals, trigger)
+		}
+		if id == "down" && jobEvals[0].NodeID != down {
+			t.Errorf("eval of down is of node %v, want %v", jobEvals[0].NodeID, down)
+		}
+		evals = append(evals, jobEvals[0])
+	}
+
+	// The orphans being scheduled are left alone, they fail once their
+	// evaluations didn't reschedule them
+	if err := s.reconcileOrphansOnce(suspects); err != nil {
+		t.Fatalf("Server.reconcileOrphansOnce() error = %v", err)
+	}
+	if job, _ := state.JobByID(ws, "down"); job.Status == models.JobStatusFailed {
+		t.Errorf("status of down being rescheduled = failed")
+	}
+	for _, eval := range evals {
+		eval = eval.Copy()
+		eval.Status = models.EvalStatusComplete
+		if err := state.UpsertEvals(100, []*models.Evaluation{eval}); err != nil {
+			t.Fatalf("StateStore.UpsertEvals() error = %v", err)
+		}
+	}
+	if err := s.reconcileOrphansOnce(suspects); err != nil {
+		t.Fatalf("Server.reconcileOrphansOnce() error = %v", err)
+	}
+	for _, id := range []string{"lost", "down"} {
+		if job, _ := state.JobByID(ws, id); job.Status != models.JobStatusFailed {
+			t.Errorf("status of %v = %v, want failed", id, job.Status)
+		}
+	}
+	// Completed by its evaluation
+	if job, _ := state.JobByID(ws, "idle"); job.Status != models.JobStatusComplete {
+		t.Errorf("status of idle = %v, want complete", job.Status)
+	}
+	for _, id := range []string{"healthy", "paused"} {
+		if job, _ := state.JobByID(ws, id); job.Status == models.JobStatusFailed {
+			t.Errorf("status of %v = failed", id)
+		}
+	}
+	if len(suspects) != 0 {
+		t.Errorf("suspects = %v, want none", suspects)
+	}
+}
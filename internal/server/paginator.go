@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	memdb "github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// paginator wraps a memdb.ResultIterator that is ordered by ID and only
+// returns the entries that belong to the page requested by QueryOptions.
+// Page tokens carry the table index of the first page so a modification
+// of the table in between pages can be reported to the caller.
+type paginator struct {
+	iter    memdb.ResultIterator
+	idFn    func(interface{}) string
+	perPage int32
+
+	// tokenIndex is the table index carried by the request token
+	tokenIndex uint64
+
+	// peeked is the first entry of the page, found while seeking
+	peeked interface{}
+
+	returned  int32
+	nextToken string
+}
+
+// newPaginator returns a paginator positioned at the page requested by
+// opts. idFn must return the ID the iterator is ordered by.
+func newPaginator(iter memdb.ResultIterator, opts *models.QueryOptions, idFn func(interface{}) string) (*paginator, error) {
+	p := &paginator{
+		iter:    iter,
+		idFn:    idFn,
+		perPage: opts.PerPage,
+	}
+	if opts.NextToken == "" {
+		return p, nil
+	}
+
+	index, id, err := parsePageToken(opts.NextToken)
+	if err != nil {
+		return nil, err
+	}
+	p.tokenIndex = index
+
+	// Seek to the first entry at or after the token. A token past the end
+	// of the table simply yields an empty page.
+	for {
+		raw := iter.Next()
+		if raw == nil {
+			break
+		}
+		if idFn(raw) >= id {
+			p.peeked = raw
+			break
+		}
+	}
+	return p, nil
+}
+
+// Next returns the next entry of the page, or nil once the page is full or
+// the iterator is exhausted.
+func (p *paginator) Next() interface{} {
+	var raw interface{}
+	if p.peeked != nil {
+		raw, p.peeked = p.peeked, nil
+	} else {
+		raw = p.iter.Next()
+	}
+	if raw == nil {
+		return nil
+	}
+
+	if p.perPage > 0 && p.returned >= p.perPage {
+		p.nextToken = p.idFn(raw)
+		return nil
+	}
+	p.returned++
+	return raw
+}
+
+// setMeta populates the pagination fields of the QueryMeta. index is the
+// current index of the table being paged through.
+func (p *paginator) setMeta(m *models.QueryMeta, index uint64) {
+	tokenIndex := index
+	if p.tokenIndex != 0 {
+		tokenIndex = p.tokenIndex
+		m.IndexChanged = p.tokenIndex != index
+	}
+	if p.nextToken != "" {
+		m.NextToken = newPageToken(tokenIndex, p.nextToken)
+	} else {
+		m.NextToken = ""
+	}
+}
+
+// newPageToken builds a token from the index of the first page and the ID
+// of the next entry to return.
+func newPageToken(index uint64, id string) string {
+	return fmt.Sprintf("%d.%s", index, id)
+}
+
+// parsePageToken splits a token built by newPageToken
+func parsePageToken(token string) (uint64, string, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", models.ErrInvalidPageToken
+	}
+	index, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", models.ErrInvalidPageToken
+	}
+	return index, parts[1], nil
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// sliceIterator is a memdb.ResultIterator over a sorted slice of IDs
+type sliceIterator struct {
+	ids []string
+}
+
+func (it *sliceIterator) WatchCh() <-chan struct{} { return nil }
+
+func (it *sliceIterator) Next() interface{} {
+	if len(it.ids) == 0 {
+		return nil
+	}
+	id := it.ids[0]
+	it.ids = it.ids[1:]
+	return id
+}
+
+func Test_paginator(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		name      string
+		opts      models.QueryOptions
+		index     uint64
+		want      []string
+		wantToken string
+		wantDirty bool
+		wantErr   bool
+	}{
+		{"no paging", models.QueryOptions{}, 10, ids, "", false, false},
+		{"first page", models.QueryOptions{PerPage: 2}, 10, []string{"a", "b"}, "10.c", false, false},
+		{"middle page", models.QueryOptions{PerPage: 2, NextToken: "10.c"}, 10, []string{"c", "d"}, "10.e", false, false},
+		{"last page", models.QueryOptions{PerPage: 2, NextToken: "10.e"}, 10, []string{"e"}, "", false, false},
+		{"token past end", models.QueryOptions{PerPage: 2, NextToken: "10.z"}, 10, nil, "", false, false},
+		{"index changed", models.QueryOptions{PerPage: 2, NextToken: "7.c"}, 10, []string{"c", "d"}, "7.e", true, false},
+		{"invalid token", models.QueryOptions{NextToken: "c"}, 10, nil, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iter := &sliceIterator{ids: append([]string(nil), ids...)}
+			p, err := newPaginator(iter, &tt.opts, func(raw interface{}) string { return raw.(string) })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newPaginator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			var got []string
+			for raw := p.Next(); raw != nil; raw = p.Next() {
+				got = append(got, raw.(string))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paginator.Next() = %v, want %v", got, tt.want)
+			}
+
+			var meta models.QueryMeta
+			p.setMeta(&meta, tt.index)
+			if meta.NextToken != tt.wantToken {
+				t.Errorf("paginator.setMeta() NextToken = %q, want %q", meta.NextToken, tt.wantToken)
+			}
+			if meta.IndexChanged != tt.wantDirty {
+				t.Errorf("paginator.setMeta() IndexChanged = %v, want %v", meta.IndexChanged, tt.wantDirty)
+			}
+		})
+	}
+}
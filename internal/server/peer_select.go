@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// unhealthyPeerCooldown is how long a server that failed an RPC is
+	// avoided when forwarding to its region.
+	unhealthyPeerCooldown = 30 * time.Second
+)
+
+// peerHealth remembers the servers that recently failed an RPC at the
+// connection level so forwarding can avoid them for a while.
+type peerHealth struct {
+	failed map[string]time.Time
+	l      sync.Mutex
+}
+
+// newPeerHealth returns an empty peerHealth
+func newPeerHealth() *peerHealth {
+	return &peerHealth{
+		failed: make(map[string]time.Time),
+	}
+}
+
+// markFailed records a failed RPC to the server at addr
+func (h *peerHealth) markFailed(addr string) {
+	h.l.Lock()
+	defer h.l.Unlock()
+	h.failed[addr] = time.Now()
+}
+
+// markHealthy clears any failure recorded for the server at addr
+func (h *peerHealth) markHealthy(addr string) {
+	h.l.Lock()
+	defer h.l.Unlock()
+	delete(h.failed, addr)
+}
+
+// healthy returns whether the server at addr hasn't failed an RPC within
+// the cooldown period
+func (h *peerHealth) healthy(addr string) bool {
+	h.l.Lock()
+	defer h.l.Unlock()
+	failedAt, ok := h.failed[addr]
+	if !ok {
+		return true
+	}
+	if time.Since(failedAt) > unhealthyPeerCooldown {
+		delete(h.failed, addr)
+		return true
+	}
+	return false
+}
+
+// selectServer picks the server to forward an RPC to. Servers marked
+// unhealthy are skipped unless there is nothing else left. If any server
+// advertises a weight the choice is weighted, servers without a weight
+// counting as one, otherwise every server is equally likely.
+func selectServer(servers []*serverParts, health *peerHealth) *serverParts {
+	candidates := make([]*serverParts, 0, len(servers))
+	for _, server := range servers {
+		if health.healthy(server.Addr.String()) {
+			candidates = append(candidates, server)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = servers
+	}
+
+	total := 0
+	weighted := false
+	for _, server := range candidates {
+		if server.Weight > 0 {
+			weighted = true
+			total += server.Weight
+		} else {
+			total++
+		}
+	}
+	if !weighted {
+		return candidates[rand.Intn(len(candidates))]
+	}
+
+	pick := rand.Intn(total)
+	for _, server := range candidates {
+		weight := server.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		if pick < weight {
+			return server
+		}
+		pick -= weight
+	}
+	return candidates[len(candidates)-1]
+}
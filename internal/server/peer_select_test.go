@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func testServerParts(name string, port, weight int) *serverParts {
+	return &serverParts{
+		Name:   name,
+		Addr:   &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: port},
+		Weight: weight,
+	}
+}
+
+func Test_selectServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		servers   []*serverParts
+		unhealthy []int
+		want      map[string]bool
+	}{
+		{
+			name:    "uniform",
+			servers: []*serverParts{testServerParts("a", 1, 0), testServerParts("b", 2, 0)},
+			want:    map[string]bool{"a": true, "b": true},
+		},
+		{
+			name:      "skip unhealthy",
+			servers:   []*serverParts{testServerParts("a", 1, 0), testServerParts("b", 2, 0)},
+			unhealthy: []int{0},
+			want:      map[string]bool{"b": true},
+		},
+		{
+			name:      "all unhealthy",
+			servers:   []*serverParts{testServerParts("a", 1, 0), testServerParts("b", 2, 0)},
+			unhealthy: []int{0, 1},
+			want:      map[string]bool{"a": true, "b": true},
+		},
+		{
+			name:      "weighted skip unhealthy",
+			servers:   []*serverParts{testServerParts("a", 1, 100), testServerParts("b", 2, 1)},
+			unhealthy: []int{0},
+			want:      map[string]bool{"b": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := newPeerHealth()
+			for _, i := range tt.unhealthy {
+				health.markFailed(tt.servers[i].Addr.String())
+			}
+			got := make(map[string]bool)
+			for i := 0; i < 200; i++ {
+				got[selectServer(tt.servers, health).Name] = true
+			}
+			for name := range got {
+				if !tt.want[name] {
+					t.Errorf("selectServer() picked %q, want one of %v", name, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_selectServer_Weighted(t *testing.T) {
+	servers := []*serverParts{testServerParts("near", 1, 9), testServerParts("far", 2, 1)}
+	health := newPeerHealth()
+
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		counts[selectServer(servers, health).Name]++
+	}
+	if counts["near"] <= counts["far"] || counts["far"] == 0 {
+		t.Errorf("selectServer() picks = %v, want near favored and far still used", counts)
+	}
+}
+
+func Test_forwardTargets(t *testing.T) {
+	voter := testServerParts("a", 1, 0)
+	nonVoter := testServerParts("b", 2, 0)
+	nonVoter.NonVoter = true
+	servers := []*serverParts{voter, nonVoter}
+
+	if got := forwardTargets(servers, false); len(got) != 1 || got[0] != voter {
+		t.Errorf("forwardTargets() = %v, want only the voter", got)
+	}
+	if got := forwardTargets(servers, true); len(got) != 2 {
+		t.Errorf("forwardTargets() = %v, want every server for a stale read", got)
+	}
+	if got := forwardTargets([]*serverParts{nonVoter}, false); len(got) != 0 {
+		t.Errorf("forwardTargets() = %v, want no target for a write", got)
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"net"
 	"net/rpc"
 	"reflect"
-	"sync"
 	"testing"
 	"time"
 	uconf "github.com/actiontech/dtle/internal/config"
@@ -44,7 +43,6 @@ func TestServer_planApply(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -52,12 +50,10 @@ func TestServer_planApply(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -86,7 +82,6 @@ func TestServer_planApply(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -94,12 +89,10 @@ func TestServer_planApply(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.planApply()
 		})
@@ -126,7 +119,6 @@ func TestServer_applyPlan(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -134,12 +126,10 @@ func TestServer_applyPlan(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		job    *models.Job
@@ -176,7 +166,6 @@ func TestServer_applyPlan(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -184,12 +173,10 @@ func TestServer_applyPlan(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			got, err := s.applyPlan(tt.args.job, tt.args.result, tt.args.snap)
 			if (err != nil) != tt.wantErr {
@@ -223,7 +210,6 @@ func TestServer_asyncPlanWait(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -231,12 +217,10 @@ func TestServer_asyncPlanWait(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		waitCh  chan struct{}
@@ -272,7 +256,6 @@ func TestServer_asyncPlanWait(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -280,12 +263,10 @@ func TestServer_asyncPlanWait(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.asyncPlanWait(tt.args.waitCh, tt.args.future, tt.args.result, tt.args.pending)
 		})
@@ -8,7 +8,6 @@ package server
 
 import (
 	"reflect"
-	"sync"
 	"testing"
 	"time"
 	"github.com/actiontech/dtle/internal/models"
@@ -108,7 +107,6 @@ func TestPlanQueue_Enabled(t *testing.T) {
 		stats   *QueueStats
 		ready   PendingPlans
 		waitCh  chan struct{}
-		l       sync.RWMutex
 	}
 	tests := []struct {
 		name   string
@@ -124,7 +122,6 @@ func TestPlanQueue_Enabled(t *testing.T) {
 				stats:   tt.fields.stats,
 				ready:   tt.fields.ready,
 				waitCh:  tt.fields.waitCh,
-				l:       tt.fields.l,
 			}
 			if got := q.Enabled(); got != tt.want {
 				t.Errorf("PlanQueue.Enabled() = %v, want %v", got, tt.want)
@@ -139,7 +136,6 @@ func TestPlanQueue_SetEnabled(t *testing.T) {
 		stats   *QueueStats
 		ready   PendingPlans
 		waitCh  chan struct{}
-		l       sync.RWMutex
 	}
 	type args struct {
 		enabled bool
@@ -158,7 +154,6 @@ func TestPlanQueue_SetEnabled(t *testing.T) {
 				stats:   tt.fields.stats,
 				ready:   tt.fields.ready,
 				waitCh:  tt.fields.waitCh,
-				l:       tt.fields.l,
 			}
 			q.SetEnabled(tt.args.enabled)
 		})
@@ -171,7 +166,6 @@ func TestPlanQueue_Enqueue(t *testing.T) {
 		stats   *QueueStats
 		ready   PendingPlans
 		waitCh  chan struct{}
-		l       sync.RWMutex
 	}
 	type args struct {
 		plan *models.Plan
@@ -192,7 +186,6 @@ func TestPlanQueue_Enqueue(t *testing.T) {
 				stats:   tt.fields.stats,
 				ready:   tt.fields.ready,
 				waitCh:  tt.fields.waitCh,
-				l:       tt.fields.l,
 			}
 			got, err := q.Enqueue(tt.args.plan)
 			if (err != nil) != tt.wantErr {
@@ -212,7 +205,6 @@ func TestPlanQueue_Dequeue(t *testing.T) {
 		stats   *QueueStats
 		ready   PendingPlans
 		waitCh  chan struct{}
-		l       sync.RWMutex
 	}
 	type args struct {
 		timeout time.Duration
@@ -233,7 +225,6 @@ func TestPlanQueue_Dequeue(t *testing.T) {
 				stats:   tt.fields.stats,
 				ready:   tt.fields.ready,
 				waitCh:  tt.fields.waitCh,
-				l:       tt.fields.l,
 			}
 			got, err := q.Dequeue(tt.args.timeout)
 			if (err != nil) != tt.wantErr {
@@ -253,7 +244,6 @@ func TestPlanQueue_Flush(t *testing.T) {
 		stats   *QueueStats
 		ready   PendingPlans
 		waitCh  chan struct{}
-		l       sync.RWMutex
 	}
 	tests := []struct {
 		name   string
@@ -268,7 +258,6 @@ func TestPlanQueue_Flush(t *testing.T) {
 				stats:   tt.fields.stats,
 				ready:   tt.fields.ready,
 				waitCh:  tt.fields.waitCh,
-				l:       tt.fields.l,
 			}
 			q.Flush()
 		})
@@ -281,7 +270,6 @@ func TestPlanQueue_Stats(t *testing.T) {
 		stats   *QueueStats
 		ready   PendingPlans
 		waitCh  chan struct{}
-		l       sync.RWMutex
 	}
 	tests := []struct {
 		name   string
@@ -297,7 +285,6 @@ func TestPlanQueue_Stats(t *testing.T) {
 				stats:   tt.fields.stats,
 				ready:   tt.fields.ready,
 				waitCh:  tt.fields.waitCh,
-				l:       tt.fields.l,
 			}
 			if got := q.Stats(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("PlanQueue.Stats() = %v, want %v", got, tt.want)
@@ -312,7 +299,6 @@ func TestPlanQueue_EmitStats(t *testing.T) {
 		stats   *QueueStats
 		ready   PendingPlans
 		waitCh  chan struct{}
-		l       sync.RWMutex
 	}
 	type args struct {
 		period time.Duration
@@ -332,7 +318,6 @@ func TestPlanQueue_EmitStats(t *testing.T) {
 				stats:   tt.fields.stats,
 				ready:   tt.fields.ready,
 				waitCh:  tt.fields.waitCh,
-				l:       tt.fields.l,
 			}
 			q.EmitStats(tt.args.period, tt.args.stopCh)
 		})
@@ -16,14 +16,55 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/net-rpc-msgpackrpc"
 	"github.com/hashicorp/yamux"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+)
+
+const (
+	// defaultPingInterval is how often the pooled connections are pinged
+	// unless SetKeepAlive changed it
+	defaultPingInterval = 10 * time.Second
+
+	// defaultMaxMissedPings is how many pings in a row a connection may
+	// miss before it is considered dead unless SetKeepAlive changed it
+	defaultMaxMissedPings = 3
+
+	// minStreamWindow is the window every yamux stream starts with, which
+	// its maximum window can't be below
+	minStreamWindow = 256 * 1024
+)
+
+// The states of the ping of a pooled connection
+const (
+	pingIdle int32 = iota
+	pingInFlight
+	pingLate
+)
+
+// ConnMode selects how the traffic of a pooled connection is encoded. The
+// remote host must support every mode set.
+type ConnMode uint8
+
+const (
+	// ConnCompressed opens the connection in rpcCompressed mode
+	ConnCompressed ConnMode = 1 << iota
+
+	// ConnChecksummed has the streams of the connection carry frames
+	// checked against their CRC32
+	ConnChecksummed
 )
 
 // streamClient is used to wrap a stream with an RPC client
 type StreamClient struct {
 	stream net.Conn
 	codec  rpc.ClientCodec
+
+	// frames is set if the stream carries checksummed frames
+	frames *checksumConn
 }
 
 func (sc *StreamClient) Close() {
@@ -35,10 +76,21 @@ type Conn struct {
 	refCount    int32
 	shouldClose int32
 
+	region   string
 	addr     net.Addr
+	key      string
 	session  *yamux.Session
 	lastUsed time.Time
 
+	// checksum is set if the streams carry checksummed frames
+	checksum bool
+
+	// missedPings counts the pings in a row that failed or timed out.
+	// pinging is pingIdle, pingInFlight, or pingLate once the ping in
+	// flight was already counted as missed.
+	missedPings int32
+	pinging     int32
+
 	pool *ConnPool
 
 	clients    *list.List
@@ -74,13 +126,13 @@ func (c *Conn) getClient() (*StreamClient, error) {
 		return nil, err
 	}
 
-	// Create a client codec
-	codec := NewClientCodec(stream)
-
 	// Return a new stream client
-	sc := &StreamClient{
-		stream: stream,
-		codec:  codec,
+	sc := &StreamClient{stream: stream}
+	if c.checksum {
+		sc.frames = newChecksumConn(stream)
+		sc.codec = NewClientCodec(sc.frames)
+	} else {
+		sc.codec = NewClientCodec(stream)
 	}
 	return sc, nil
 }
@@ -132,6 +184,30 @@ type ConnPool struct {
 	// on to close.
 	limiter map[string]chan struct{}
 
+	// tlsWrap is used to wrap outbound connections using TLS. It should
+	// be nil when TLS is disabled.
+	tlsWrap uconf.TLSWrapper
+
+	// compressThreshold is the minimum write size that is compressed on
+	// connections opened through CompressedRPC.
+	compressThreshold int
+
+	// streamWindow is the maximum window of the streams of the new
+	// connections, zero for the yamux default
+	streamWindow int
+
+	// stats counts the connections created and evicted per pool key
+	stats map[string]*connStats
+
+	// breaker refuses RPCs to the addresses that kept failing
+	breaker *circuitBreaker
+
+	// pingInterval is how often every pooled connection is pinged, and
+	// maxMissedPings how many pings in a row it may miss before it is
+	// closed as dead
+	pingInterval   time.Duration
+	maxMissedPings int
+
 	// Used to indicate the pool is shutdown
 	shutdown   bool
 	shutdownCh chan struct{}
@@ -140,22 +216,92 @@ type ConnPool struct {
 // NewPool is used to make a new connection pool
 // Maintain at most one connection per host, for up to maxTime.
 // Set maxTime to 0 to disable reaping. maxStreams is used to control
-// the number of idle streams allowed.
-func NewPool(logOutput io.Writer, maxTime time.Duration, maxStreams int) *ConnPool {
+// the number of idle streams allowed. If TLS settings are provided outgoing
+// connections use TLS.
+func NewPool(logOutput io.Writer, maxTime time.Duration, maxStreams int, tlsWrap uconf.TLSWrapper) *ConnPool {
 	pool := &ConnPool{
 		logOutput:  logOutput,
 		maxTime:    maxTime,
 		maxStreams: maxStreams,
 		pool:       make(map[string]*Conn),
 		limiter:    make(map[string]chan struct{}),
+		stats:      make(map[string]*connStats),
+		breaker:    newCircuitBreaker(),
+		tlsWrap:    tlsWrap,
 		shutdownCh: make(chan struct{}),
+
+		pingInterval:   defaultPingInterval,
+		maxMissedPings: defaultMaxMissedPings,
 	}
 	if maxTime > 0 {
 		go pool.reap()
 	}
+	go pool.keepAlive()
 	return pool
 }
 
+// SetKeepAlive sets how often the pooled connections are pinged and how
+// many pings in a row they may miss before they are closed as dead. It
+// also sets the TCP keepalive period of the new connections.
+func (p *ConnPool) SetKeepAlive(interval time.Duration, maxMissed int) {
+	p.Lock()
+	defer p.Unlock()
+	if interval > 0 {
+		p.pingInterval = interval
+	}
+	if maxMissed > 0 {
+		p.maxMissedPings = maxMissed
+	}
+}
+
+// SetCircuitBreaker sets how many failures within window open the circuit
+// of an address, and how long it then refuses RPCs before it is probed.
+// Zero values keep the defaults.
+func (p *ConnPool) SetCircuitBreaker(threshold int, window, cooldown time.Duration) {
+	p.breaker.setThresholds(threshold, window, cooldown)
+}
+
+// SetCompressionThreshold sets the minimum payload size that is compressed
+// on connections used by CompressedRPC. Smaller payloads are sent as is.
+func (p *ConnPool) SetCompressionThreshold(threshold int) {
+	p.Lock()
+	defer p.Unlock()
+	p.compressThreshold = threshold
+}
+
+// SetStreamWindow sets the maximum window of the streams of the
+// connections opened from now on. Zero restores the yamux default.
+func (p *ConnPool) SetStreamWindow(size int) {
+	p.Lock()
+	defer p.Unlock()
+	p.streamWindow = size
+}
+
+// yamuxConfig returns the yamux configuration of the RPC sessions. Both
+// ends of a session should use the same maxStreamWindow: a stream only
+// grows its window up to the maximum of the side receiving its data.
+func yamuxConfig(logOutput io.Writer, maxStreamWindow int) *yamux.Config {
+	conf := yamux.DefaultConfig()
+	conf.LogOutput = logOutput
+	if maxStreamWindow > 0 {
+		conf.MaxStreamWindowSize = uint32(maxStreamWindow)
+	}
+	return conf
+}
+
+// poolKey returns the key a connection is pooled under. Connections to the
+// same address in different modes are pooled separately.
+func poolKey(addr net.Addr, mode ConnMode) string {
+	key := addr.String()
+	if mode&ConnCompressed != 0 {
+		key += "/compressed"
+	}
+	if mode&ConnChecksummed != 0 {
+		key += "/checksummed"
+	}
+	return key
+}
+
 // Shutdown is used to close the connection pool
 func (p *ConnPool) Shutdown() error {
 	p.Lock()
@@ -176,12 +322,19 @@ func (p *ConnPool) Shutdown() error {
 
 // Acquire is used to get a connection that is
 // pooled or to return a new connection
-func (p *ConnPool) acquire(region string, addr net.Addr) (*Conn, error) {
+func (p *ConnPool) acquire(region string, addr net.Addr, mode ConnMode) (*Conn, error) {
 	// Check to see if there's a pooled connection available. This is up
 	// here since it should the vastly more common case than the rest
 	// of the code here.
+	key := poolKey(addr, mode)
 	p.Lock()
-	c := p.pool[addr.String()]
+	c := p.pool[key]
+	if c != nil && c.session.IsClosed() {
+		// The peer went away, don't wait for a stream to fail on it
+		delete(p.pool, key)
+		p.statsFor(c).evicted++
+		c = nil
+	}
 	if c != nil {
 		c.markForUse()
 		p.Unlock()
@@ -193,9 +346,9 @@ func (p *ConnPool) acquire(region string, addr net.Addr) (*Conn, error) {
 	// attempt is done.
 	var wait chan struct{}
 	var ok bool
-	if wait, ok = p.limiter[addr.String()]; !ok {
+	if wait, ok = p.limiter[key]; !ok {
 		wait = make(chan struct{})
-		p.limiter[addr.String()] = wait
+		p.limiter[key] = wait
 	}
 	isLeadThread := !ok
 	p.Unlock()
@@ -203,16 +356,17 @@ func (p *ConnPool) acquire(region string, addr net.Addr) (*Conn, error) {
 	// If we are the lead thread, make the new connection and then wake
 	// everybody else up to see if we got it.
 	if isLeadThread {
-		c, err := p.getNewConn(region, addr)
+		c, err := p.getNewConn(region, addr, mode)
 		p.Lock()
-		delete(p.limiter, addr.String())
+		delete(p.limiter, key)
 		close(wait)
 		if err != nil {
 			p.Unlock()
 			return nil, err
 		}
 
-		p.pool[addr.String()] = c
+		p.pool[key] = c
+		p.statsFor(c).created++
 		p.Unlock()
 		return c, nil
 	}
@@ -227,7 +381,7 @@ func (p *ConnPool) acquire(region string, addr net.Addr) (*Conn, error) {
 
 	// See if the lead thread was able to get us a connection.
 	p.Lock()
-	if c := p.pool[addr.String()]; c != nil {
+	if c := p.pool[key]; c != nil {
 		c.markForUse()
 		p.Unlock()
 		return c, nil
@@ -237,29 +391,64 @@ func (p *ConnPool) acquire(region string, addr net.Addr) (*Conn, error) {
 	return nil, fmt.Errorf("rpc error: lead thread didn't get connection")
 }
 
-// getNewConn is used to return a new connection
-func (p *ConnPool) getNewConn(region string, addr net.Addr) (*Conn, error) {
+// getNewConn is used to return a new connection in the given mode
+func (p *ConnPool) getNewConn(region string, addr net.Addr, mode ConnMode) (*Conn, error) {
 	// Try to dial the conn
 	conn, err := net.DialTimeout("tcp", addr.String(), 10*time.Second)
 	if err != nil {
 		return nil, err
 	}
 
+	p.Lock()
+	pingInterval := p.pingInterval
+	p.Unlock()
+
 	// Cast to TCPConn
 	if tcp, ok := conn.(*net.TCPConn); ok {
 		tcp.SetKeepAlive(true)
+		tcp.SetKeepAlivePeriod(pingInterval)
 		tcp.SetNoDelay(true)
 	}
 
-	// Write the multiplex byte to set the mode
-	if _, err := conn.Write([]byte{byte(rpcMultiplex)}); err != nil {
+	// Upgrade to TLS if enabled. The handshake happens here so that an
+	// untrusted peer is reported before any RPC traffic is sent.
+	if p.tlsWrap != nil {
+		tlsConn, err := p.tlsWrap(region, conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	// Write the multiplex byte to set the mode, checksummed streams are
+	// announced first
+	compress := mode&ConnCompressed != 0
+	checksum := mode&ConnChecksummed != 0
+	var header []byte
+	if checksum {
+		header = append(header, byte(rpcChecksummed))
+	}
+	if compress {
+		header = append(header, byte(rpcCompressed))
+	} else {
+		header = append(header, byte(rpcMultiplex))
+	}
+	if _, err := conn.Write(header); err != nil {
 		conn.Close()
 		return nil, err
 	}
+	p.Lock()
+	threshold, window := p.compressThreshold, p.streamWindow
+	p.Unlock()
+	if compress {
+		conn = newCompressedConn(conn, threshold)
+	}
 
-	// Setup the logger
-	conf := yamux.DefaultConfig()
-	conf.LogOutput = p.logOutput
+	// The pool pings the session itself so a single late ping doesn't
+	// kill it
+	conf := yamuxConfig(p.logOutput, window)
+	conf.EnableKeepAlive = false
 
 	// Create a multiplexed session
 	session, err := yamux.Client(conn, conf)
@@ -271,8 +460,11 @@ func (p *ConnPool) getNewConn(region string, addr net.Addr) (*Conn, error) {
 	// Wrap the connection
 	c := &Conn{
 		refCount: 1,
+		region:   region,
 		addr:     addr,
+		key:      poolKey(addr, mode),
 		session:  session,
+		checksum: checksum,
 		clients:  list.New(),
 		lastUsed: time.Now(),
 		pool:     p,
@@ -287,8 +479,9 @@ func (p *ConnPool) clearConn(conn *Conn) {
 
 	// Clear from the cache
 	p.Lock()
-	if c, ok := p.pool[conn.addr.String()]; ok && c == conn {
-		delete(p.pool, conn.addr.String())
+	if c, ok := p.pool[conn.key]; ok && c == conn {
+		delete(p.pool, conn.key)
+		p.statsFor(conn).evicted++
 	}
 	p.Unlock()
 
@@ -307,11 +500,11 @@ func (p *ConnPool) releaseConn(conn *Conn) {
 }
 
 // getClient is used to get a usable client for an address and protocol version
-func (p *ConnPool) getClient(region string, addr net.Addr) (*Conn, *StreamClient, error) {
+func (p *ConnPool) getClient(region string, addr net.Addr, mode ConnMode) (*Conn, *StreamClient, error) {
 	retries := 0
 START:
 	// Try to get a conn first
-	conn, err := p.acquire(region, addr)
+	conn, err := p.acquire(region, addr, mode)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get conn: %v", err)
 	}
@@ -334,26 +527,109 @@ START:
 
 // RPC is used to make an RPC call to a remote host
 func (p *ConnPool) RPC(region string, addr net.Addr, method string, args interface{}, reply interface{}) error {
+	return p.rpc(region, addr, 0, 0, method, args, reply)
+}
+
+// CompressedRPC is used to make an RPC call to a remote host over a
+// compressed connection. The remote host must support rpcCompressed.
+func (p *ConnPool) CompressedRPC(region string, addr net.Addr, method string, args interface{}, reply interface{}) error {
+	return p.rpc(region, addr, ConnCompressed, 0, method, args, reply)
+}
+
+// TimedRPC is used to make an RPC call to a remote host over a connection
+// in the given mode that is abandoned once timeout elapsed. A zero timeout
+// waits for the reply indefinitely.
+func (p *ConnPool) TimedRPC(region string, addr net.Addr, mode ConnMode, timeout time.Duration, method string, args interface{}, reply interface{}) error {
+	return p.rpc(region, addr, mode, timeout, method, args, reply)
+}
+
+// rpc is used to make an RPC call using a pooled connection. Calls to an
+// address whose circuit is open fail with models.ErrNoRegionPath without
+// being attempted.
+func (p *ConnPool) rpc(region string, addr net.Addr, mode ConnMode, timeout time.Duration, method string, args interface{}, reply interface{}) error {
+	if !p.breaker.allow(addr.String()) {
+		metrics.IncrCounter([]string{"server", "rpc", "circuit_rejected"}, 1)
+		return models.ErrNoRegionPath
+	}
+
 	// Get a usable client
-	conn, sc, err := p.getClient(region, addr)
+	conn, sc, err := p.getClient(region, addr, mode)
 	if err != nil {
-		return fmt.Errorf("rpc error: %v", err)
+		p.breaker.failure(addr.String())
+		return &connError{err: err, sent: false}
 	}
 
 	// Make the RPC call
+	start := time.Now()
+	if timeout > 0 {
+		sc.stream.SetDeadline(start.Add(timeout))
+	}
 	err = msgpackrpc.CallWithCodec(sc.codec, method, args, reply)
 	if err != nil {
 		sc.Close()
 		p.releaseConn(conn)
-		return fmt.Errorf("rpc error: %v", err)
+		if _, ok := err.(rpc.ServerError); ok {
+			p.breaker.success(addr.String())
+			return fmt.Errorf("rpc error: %v", err)
+		}
+
+		// Only the stream is abandoned, the connection may well be fine
+		if timeout > 0 && time.Since(start) >= timeout {
+			metrics.IncrCounter([]string{"server", "rpc", "timeout", region}, 1)
+			p.breaker.failure(addr.String())
+			return &connError{err: fmt.Errorf("%s timed out after %v", method, timeout), sent: true}
+		}
+
+		// A failed stream doesn't take the session down with it, the
+		// connection is only dropped once the session itself is dead
+		p.breaker.failure(addr.String())
+		if conn.session.IsClosed() {
+			p.clearConn(conn)
+		} else {
+			metrics.IncrCounter([]string{"server", "rpc", "stream_failed"}, 1)
+		}
+		if sc.frames != nil && sc.frames.err == models.ErrFrameCorrupt {
+			err = models.ErrFrameCorrupt
+		}
+		return &connError{err: err, sent: true}
 	}
 
 	// Done with the connection
+	p.breaker.success(addr.String())
+	if timeout > 0 {
+		sc.stream.SetDeadline(time.Time{})
+	}
 	conn.returnClient(sc)
 	p.releaseConn(conn)
 	return nil
 }
 
+// CircuitOpen returns whether RPCs to addr are currently refused because
+// it kept failing
+func (p *ConnPool) CircuitOpen(addr net.Addr) bool {
+	return p.breaker.isOpen(addr.String())
+}
+
+// connError is returned by the ConnPool when an RPC failed because of the
+// connection to the server rather than an error returned by the endpoint.
+type connError struct {
+	err error
+
+	// sent is set if the request may have reached the server before the
+	// connection failed
+	sent bool
+}
+
+func (e *connError) Error() string {
+	return fmt.Sprintf("rpc error: %v", e.err)
+}
+
+// isConnError returns whether err is a connection level RPC error
+func isConnError(err error) bool {
+	_, ok := err.(*connError)
+	return ok
+}
+
 // Reap is used to close conns open over maxTime
 func (p *ConnPool) reap() {
 	for {
@@ -384,6 +660,7 @@ func (p *ConnPool) reap() {
 
 			// Remove from pool
 			removed = append(removed, host)
+			p.statsFor(conn).evicted++
 		}
 		for _, host := range removed {
 			delete(p.pool, host)
@@ -391,3 +668,126 @@ func (p *ConnPool) reap() {
 		p.Unlock()
 	}
 }
+
+// keepAlive pings every pooled connection each ping interval and closes
+// the ones that missed too many pings in a row, failing the RPCs still
+// waiting on them.
+func (p *ConnPool) keepAlive() {
+	for {
+		p.Lock()
+		interval := p.pingInterval
+		p.Unlock()
+
+		select {
+		case <-p.shutdownCh:
+			return
+		case <-time.After(interval):
+		}
+
+		p.Lock()
+		conns := make([]*Conn, 0, len(p.pool))
+		for _, conn := range p.pool {
+			conns = append(conns, conn)
+		}
+		p.Unlock()
+
+		for _, conn := range conns {
+			if atomic.CompareAndSwapInt32(&conn.pinging, pingIdle, pingInFlight) {
+				go p.ping(conn)
+				continue
+			}
+
+			// The last ping is still unanswered
+			atomic.StoreInt32(&conn.pinging, pingLate)
+			p.missedPing(conn)
+		}
+	}
+}
+
+// ping pings the session of conn once
+func (p *ConnPool) ping(conn *Conn) {
+	_, err := conn.session.Ping()
+	late := atomic.SwapInt32(&conn.pinging, pingIdle) == pingLate
+	if err == nil {
+		atomic.StoreInt32(&conn.missedPings, 0)
+	} else if !late {
+		p.missedPing(conn)
+	}
+}
+
+// missedPing records a ping conn missed, closing it once it missed too
+// many in a row
+func (p *ConnPool) missedPing(conn *Conn) {
+	p.Lock()
+	maxMissed := p.maxMissedPings
+	p.Unlock()
+	if atomic.AddInt32(&conn.missedPings, 1) != int32(maxMissed) {
+		return
+	}
+
+	metrics.IncrCounter([]string{"server", "rpc", "pool", "dead_peer"}, 1)
+	p.clearConn(conn)
+	conn.Close()
+}
+
+// connStats counts the connections made to a single server
+type connStats struct {
+	region  string
+	addr    string
+	created uint64
+	evicted uint64
+}
+
+// statsFor returns the counters of the pool key of conn. The pool lock
+// must be held.
+func (p *ConnPool) statsFor(conn *Conn) *connStats {
+	stats, ok := p.stats[conn.key]
+	if !ok {
+		stats = &connStats{region: conn.region, addr: conn.addr.String()}
+		p.stats[conn.key] = stats
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the pooled connections keyed by pool key
+func (p *ConnPool) Stats() map[string]*models.ConnPoolStats {
+	p.Lock()
+	defer p.Unlock()
+
+	out := make(map[string]*models.ConnPoolStats, len(p.stats))
+	for key, stats := range p.stats {
+		s := &models.ConnPoolStats{
+			Region:  stats.region,
+			Addr:    stats.addr,
+			Created: stats.created,
+			Evicted: stats.evicted,
+		}
+		if conn, ok := p.pool[key]; ok {
+			s.Pooled = true
+			s.Active = int(atomic.LoadInt32(&conn.refCount))
+			conn.clientLock.Lock()
+			s.Idle = conn.clients.Len()
+			conn.clientLock.Unlock()
+		}
+		out[key] = s
+	}
+	return out
+}
+
+// EmitStats is used to export metrics about the pooled connections
+func (p *ConnPool) EmitStats(period time.Duration, stopCh chan struct{}) {
+	for {
+		select {
+		case <-time.After(period):
+			for key, stats := range p.Stats() {
+				metrics.SetGauge([]string{"server", "rpc", "pool", key, "active"}, float32(stats.Active))
+				metrics.SetGauge([]string{"server", "rpc", "pool", key, "idle"}, float32(stats.Idle))
+				metrics.SetGauge([]string{"server", "rpc", "pool", key, "created"}, float32(stats.Created))
+				metrics.SetGauge([]string{"server", "rpc", "pool", key, "evicted"}, float32(stats.Evicted))
+			}
+
+		case <-stopCh:
+			return
+		}
+	}
+}
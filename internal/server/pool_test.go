@@ -9,15 +9,21 @@ package server
 import (
 	"bytes"
 	"container/list"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/rpc"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/yamux"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
 )
 
 func TestStreamClient_Close(t *testing.T) {
@@ -51,7 +57,6 @@ func TestConn_markForUse(t *testing.T) {
 		lastUsed    time.Time
 		pool        *ConnPool
 		clients     *list.List
-		clientLock  sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -69,7 +74,6 @@ func TestConn_markForUse(t *testing.T) {
 				lastUsed:    tt.fields.lastUsed,
 				pool:        tt.fields.pool,
 				clients:     tt.fields.clients,
-				clientLock:  tt.fields.clientLock,
 			}
 			c.markForUse()
 		})
@@ -85,7 +89,6 @@ func TestConn_Close(t *testing.T) {
 		lastUsed    time.Time
 		pool        *ConnPool
 		clients     *list.List
-		clientLock  sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -104,7 +107,6 @@ func TestConn_Close(t *testing.T) {
 				lastUsed:    tt.fields.lastUsed,
 				pool:        tt.fields.pool,
 				clients:     tt.fields.clients,
-				clientLock:  tt.fields.clientLock,
 			}
 			if err := c.Close(); (err != nil) != tt.wantErr {
 				t.Errorf("Conn.Close() error = %v, wantErr %v", err, tt.wantErr)
@@ -122,7 +124,6 @@ func TestConn_getClient(t *testing.T) {
 		lastUsed    time.Time
 		pool        *ConnPool
 		clients     *list.List
-		clientLock  sync.Mutex
 	}
 	tests := []struct {
 		name    string
@@ -142,7 +143,6 @@ func TestConn_getClient(t *testing.T) {
 				lastUsed:    tt.fields.lastUsed,
 				pool:        tt.fields.pool,
 				clients:     tt.fields.clients,
-				clientLock:  tt.fields.clientLock,
 			}
 			got, err := c.getClient()
 			if (err != nil) != tt.wantErr {
@@ -165,7 +165,6 @@ func TestConn_returnClient(t *testing.T) {
 		lastUsed    time.Time
 		pool        *ConnPool
 		clients     *list.List
-		clientLock  sync.Mutex
 	}
 	type args struct {
 		client *StreamClient
@@ -187,7 +186,6 @@ func TestConn_returnClient(t *testing.T) {
 				lastUsed:    tt.fields.lastUsed,
 				pool:        tt.fields.pool,
 				clients:     tt.fields.clients,
-				clientLock:  tt.fields.clientLock,
 			}
 			c.returnClient(tt.args.client)
 		})
@@ -198,6 +196,7 @@ func TestNewPool(t *testing.T) {
 	type args struct {
 		maxTime    time.Duration
 		maxStreams int
+		tlsWrap    uconf.TLSWrapper
 	}
 	tests := []struct {
 		name          string
@@ -210,7 +209,7 @@ func TestNewPool(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			logOutput := &bytes.Buffer{}
-			if got := NewPool(logOutput, tt.args.maxTime, tt.args.maxStreams); !reflect.DeepEqual(got, tt.want) {
+			if got := NewPool(logOutput, tt.args.maxTime, tt.args.maxStreams, tt.args.tlsWrap); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewPool() = %v, want %v", got, tt.want)
 			}
 			if gotLogOutput := logOutput.String(); gotLogOutput != tt.wantLogOutput {
@@ -222,7 +221,6 @@ func TestNewPool(t *testing.T) {
 
 func TestConnPool_Shutdown(t *testing.T) {
 	type fields struct {
-		Mutex      sync.Mutex
 		logOutput  io.Writer
 		maxTime    time.Duration
 		maxStreams int
@@ -241,7 +239,6 @@ func TestConnPool_Shutdown(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &ConnPool{
-				Mutex:      tt.fields.Mutex,
 				logOutput:  tt.fields.logOutput,
 				maxTime:    tt.fields.maxTime,
 				maxStreams: tt.fields.maxStreams,
@@ -259,7 +256,6 @@ func TestConnPool_Shutdown(t *testing.T) {
 
 func TestConnPool_acquire(t *testing.T) {
 	type fields struct {
-		Mutex      sync.Mutex
 		logOutput  io.Writer
 		maxTime    time.Duration
 		maxStreams int
@@ -271,6 +267,7 @@ func TestConnPool_acquire(t *testing.T) {
 	type args struct {
 		region string
 		addr   net.Addr
+		mode   ConnMode
 	}
 	tests := []struct {
 		name    string
@@ -284,7 +281,6 @@ func TestConnPool_acquire(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &ConnPool{
-				Mutex:      tt.fields.Mutex,
 				logOutput:  tt.fields.logOutput,
 				maxTime:    tt.fields.maxTime,
 				maxStreams: tt.fields.maxStreams,
@@ -293,7 +289,7 @@ func TestConnPool_acquire(t *testing.T) {
 				shutdown:   tt.fields.shutdown,
 				shutdownCh: tt.fields.shutdownCh,
 			}
-			got, err := p.acquire(tt.args.region, tt.args.addr)
+			got, err := p.acquire(tt.args.region, tt.args.addr, tt.args.mode)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ConnPool.acquire() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -307,7 +303,6 @@ func TestConnPool_acquire(t *testing.T) {
 
 func TestConnPool_getNewConn(t *testing.T) {
 	type fields struct {
-		Mutex      sync.Mutex
 		logOutput  io.Writer
 		maxTime    time.Duration
 		maxStreams int
@@ -319,6 +314,7 @@ func TestConnPool_getNewConn(t *testing.T) {
 	type args struct {
 		region string
 		addr   net.Addr
+		mode   ConnMode
 	}
 	tests := []struct {
 		name    string
@@ -332,7 +328,6 @@ func TestConnPool_getNewConn(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &ConnPool{
-				Mutex:      tt.fields.Mutex,
 				logOutput:  tt.fields.logOutput,
 				maxTime:    tt.fields.maxTime,
 				maxStreams: tt.fields.maxStreams,
@@ -341,7 +336,7 @@ func TestConnPool_getNewConn(t *testing.T) {
 				shutdown:   tt.fields.shutdown,
 				shutdownCh: tt.fields.shutdownCh,
 			}
-			got, err := p.getNewConn(tt.args.region, tt.args.addr)
+			got, err := p.getNewConn(tt.args.region, tt.args.addr, tt.args.mode)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ConnPool.getNewConn() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -355,7 +350,6 @@ func TestConnPool_getNewConn(t *testing.T) {
 
 func TestConnPool_clearConn(t *testing.T) {
 	type fields struct {
-		Mutex      sync.Mutex
 		logOutput  io.Writer
 		maxTime    time.Duration
 		maxStreams int
@@ -377,7 +371,6 @@ func TestConnPool_clearConn(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &ConnPool{
-				Mutex:      tt.fields.Mutex,
 				logOutput:  tt.fields.logOutput,
 				maxTime:    tt.fields.maxTime,
 				maxStreams: tt.fields.maxStreams,
@@ -393,7 +386,6 @@ func TestConnPool_clearConn(t *testing.T) {
 
 func TestConnPool_releaseConn(t *testing.T) {
 	type fields struct {
-		Mutex      sync.Mutex
 		logOutput  io.Writer
 		maxTime    time.Duration
 		maxStreams int
@@ -415,7 +407,6 @@ func TestConnPool_releaseConn(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &ConnPool{
-				Mutex:      tt.fields.Mutex,
 				logOutput:  tt.fields.logOutput,
 				maxTime:    tt.fields.maxTime,
 				maxStreams: tt.fields.maxStreams,
@@ -431,7 +422,6 @@ func TestConnPool_releaseConn(t *testing.T) {
 
 func TestConnPool_getClient(t *testing.T) {
 	type fields struct {
-		Mutex      sync.Mutex
 		logOutput  io.Writer
 		maxTime    time.Duration
 		maxStreams int
@@ -443,6 +433,7 @@ func TestConnPool_getClient(t *testing.T) {
 	type args struct {
 		region string
 		addr   net.Addr
+		mode   ConnMode
 	}
 	tests := []struct {
 		name    string
@@ -457,7 +448,6 @@ func TestConnPool_getClient(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &ConnPool{
-				Mutex:      tt.fields.Mutex,
 				logOutput:  tt.fields.logOutput,
 				maxTime:    tt.fields.maxTime,
 				maxStreams: tt.fields.maxStreams,
@@ -466,7 +456,7 @@ func TestConnPool_getClient(t *testing.T) {
 				shutdown:   tt.fields.shutdown,
 				shutdownCh: tt.fields.shutdownCh,
 			}
-			got, got1, err := p.getClient(tt.args.region, tt.args.addr)
+			got, got1, err := p.getClient(tt.args.region, tt.args.addr, tt.args.mode)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ConnPool.getClient() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -483,7 +473,6 @@ func TestConnPool_getClient(t *testing.T) {
 
 func TestConnPool_RPC(t *testing.T) {
 	type fields struct {
-		Mutex      sync.Mutex
 		logOutput  io.Writer
 		maxTime    time.Duration
 		maxStreams int
@@ -510,7 +499,6 @@ func TestConnPool_RPC(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &ConnPool{
-				Mutex:      tt.fields.Mutex,
 				logOutput:  tt.fields.logOutput,
 				maxTime:    tt.fields.maxTime,
 				maxStreams: tt.fields.maxStreams,
@@ -528,7 +516,6 @@ func TestConnPool_RPC(t *testing.T) {
 
 func TestConnPool_reap(t *testing.T) {
 	type fields struct {
-		Mutex      sync.Mutex
 		logOutput  io.Writer
 		maxTime    time.Duration
 		maxStreams int
@@ -546,7 +533,6 @@ func TestConnPool_reap(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &ConnPool{
-				Mutex:      tt.fields.Mutex,
 				logOutput:  tt.fields.logOutput,
 				maxTime:    tt.fields.maxTime,
 				maxStreams: tt.fields.maxStreams,
@@ -559,3 +545,360 @@ func TestConnPool_reap(t *testing.T) {
 		})
 	}
 }
+
+func TestConnPool_Stats(t *testing.T) {
+	p := NewPool(nil, 0, 4, nil)
+	defer p.Shutdown()
+
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4647}
+	conn := &Conn{
+		refCount: 2,
+		region:   "global",
+		addr:     addr,
+		key:      poolKey(addr, 0),
+		clients:  list.New(),
+		pool:     p,
+	}
+	conn.clients.PushFront(&StreamClient{})
+
+	p.Lock()
+	p.pool[conn.key] = conn
+	p.statsFor(conn).created++
+	p.Unlock()
+
+	want := map[string]*models.ConnPoolStats{
+		conn.key: {Region: "global", Addr: addr.String(), Pooled: true, Active: 2, Idle: 1, Created: 1},
+	}
+	if got := p.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConnPool.Stats() = %v, want %v", got, want)
+	}
+
+	// An evicted connection is no longer active but its counters remain
+	atomic.StoreInt32(&conn.refCount, 1)
+	p.clearConn(conn)
+	want[conn.key].Pooled = false
+	want[conn.key].Active = 0
+	want[conn.key].Idle = 0
+	want[conn.key].Evicted = 1
+	if got := p.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConnPool.Stats() after clearConn = %v, want %v", got, want)
+	}
+}
+
+func TestConnPool_keepAlive(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   bool
+		wantDead bool
+	}{
+		{"answered", true, false},
+		{"unanswered", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(nil, 0, 4, nil)
+			defer p.Shutdown()
+			p.SetKeepAlive(10*time.Millisecond, 2)
+
+			c1, c2 := net.Pipe()
+			defer c2.Close()
+			conf := yamux.DefaultConfig()
+			conf.EnableKeepAlive = false
+			conf.LogOutput = ioutil.Discard
+			if tt.answer {
+				server, err := yamux.Server(c2, conf)
+				if err != nil {
+					t.Fatalf("yamux.Server() error = %v", err)
+				}
+				defer server.Close()
+			}
+			session, err := yamux.Client(c1, conf)
+			if err != nil {
+				t.Fatalf("yamux.Client() error = %v", err)
+			}
+			defer session.Close()
+
+			addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4647}
+			conn := &Conn{
+				region:  "global",
+				addr:    addr,
+				key:     poolKey(addr, 0),
+				session: session,
+				clients: list.New(),
+				pool:    p,
+			}
+			p.Lock()
+			p.pool[conn.key] = conn
+			p.Unlock()
+
+			time.Sleep(200 * time.Millisecond)
+			p.Lock()
+			_, pooled := p.pool[conn.key]
+			p.Unlock()
+			if dead := !pooled && session.IsClosed(); dead != tt.wantDead {
+				t.Errorf("ConnPool.keepAlive() closed the connection = %v, want %v", dead, tt.wantDead)
+			}
+		})
+	}
+}
+
+func TestConnPool_TimedRPC(t *testing.T) {
+	p := NewPool(nil, 0, 4, nil)
+	defer p.Shutdown()
+
+	// The server accepts the stream but never replies
+	c1, c2 := net.Pipe()
+	conf := yamux.DefaultConfig()
+	conf.LogOutput = ioutil.Discard
+	server, err := yamux.Server(c2, conf)
+	if err != nil {
+		t.Fatalf("yamux.Server() error = %v", err)
+	}
+	defer server.Close()
+	go func() {
+		for {
+			stream, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(ioutil.Discard, stream)
+		}
+	}()
+	session, err := yamux.Client(c1, conf)
+	if err != nil {
+		t.Fatalf("yamux.Client() error = %v", err)
+	}
+
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4647}
+	conn := &Conn{
+		region:  "global",
+		addr:    addr,
+		key:     poolKey(addr, 0),
+		session: session,
+		clients: list.New(),
+		pool:    p,
+	}
+	p.Lock()
+	p.pool[conn.key] = conn
+	p.Unlock()
+
+	start := time.Now()
+	var reply struct{}
+	err = p.TimedRPC("global", addr, 0, 50*time.Millisecond, "Status.Ping", struct{}{}, &reply)
+	if !isConnError(err) {
+		t.Fatalf("ConnPool.TimedRPC() error = %v, want a connection error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ConnPool.TimedRPC() returned after %v", elapsed)
+	}
+
+	// The connection itself is kept
+	p.Lock()
+	_, pooled := p.pool[conn.key]
+	p.Unlock()
+	if !pooled || session.IsClosed() {
+		t.Errorf("ConnPool.TimedRPC() closed the connection after a timeout")
+	}
+}
+
+func Test_yamuxConfig(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxStreamWindow int
+		want            uint32
+	}{
+		{"yamux default", 0, minStreamWindow},
+		{"larger window", 16 << 20, 16 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := yamuxConfig(ioutil.Discard, tt.maxStreamWindow)
+			if conf.MaxStreamWindowSize != tt.want {
+				t.Errorf("yamuxConfig().MaxStreamWindowSize = %v, want %v", conf.MaxStreamWindowSize, tt.want)
+			}
+			if err := yamux.VerifyConfig(conf); err != nil {
+				t.Errorf("yamuxConfig() is invalid: %v", err)
+			}
+		})
+	}
+}
+
+// latencyConn delays every write by delay before it reaches the other end
+// of the connection, without limiting the bandwidth, to simulate a link
+// with a high bandwidth-delay product
+type latencyConn struct {
+	net.Conn
+	delay  time.Duration
+	queue  chan latencyWrite
+	closed chan struct{}
+	once   sync.Once
+}
+
+type latencyWrite struct {
+	buf []byte
+	at  time.Time
+}
+
+func newLatencyConn(conn net.Conn, delay time.Duration) *latencyConn {
+	c := &latencyConn{
+		Conn:   conn,
+		delay:  delay,
+		queue:  make(chan latencyWrite, 4096),
+		closed: make(chan struct{}),
+	}
+	go c.deliver()
+	return c
+}
+
+func (c *latencyConn) Write(b []byte) (int, error) {
+	select {
+	case c.queue <- latencyWrite{buf: append([]byte{}, b...), at: time.Now().Add(c.delay)}:
+		return len(b), nil
+	case <-c.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (c *latencyConn) deliver() {
+	for {
+		select {
+		case w := <-c.queue:
+			time.Sleep(time.Until(w.at))
+			if _, err := c.Conn.Write(w.buf); err != nil {
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *latencyConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// BenchmarkStreamWindow measures the time to stream a 4MB snapshot over a
+// link with a 20ms round trip for different maximum stream windows
+func BenchmarkStreamWindow(b *testing.B) {
+	const snapshotSize = 4 << 20
+	snapshot := make([]byte, snapshotSize)
+
+	for _, window := range []int{0, 1 << 20, 4 << 20} {
+		b.Run(fmt.Sprintf("window=%d", window), func(b *testing.B) {
+			c1, c2 := net.Pipe()
+			server, err := yamux.Server(newLatencyConn(c1, 10*time.Millisecond), yamuxConfig(ioutil.Discard, window))
+			if err != nil {
+				b.Fatalf("yamux.Server() error = %v", err)
+			}
+			defer server.Close()
+			client, err := yamux.Client(newLatencyConn(c2, 10*time.Millisecond), yamuxConfig(ioutil.Discard, window))
+			if err != nil {
+				b.Fatalf("yamux.Client() error = %v", err)
+			}
+			defer client.Close()
+
+			b.SetBytes(snapshotSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				errCh := make(chan error, 1)
+				go func() {
+					stream, err := server.Accept()
+					if err != nil {
+						errCh <- err
+						return
+					}
+					defer stream.Close()
+					_, err = io.CopyN(ioutil.Discard, stream, snapshotSize)
+					errCh <- err
+				}()
+
+				stream, err := client.Open()
+				if err != nil {
+					b.Fatalf("Session.Open() error = %v", err)
+				}
+				if _, err := stream.Write(snapshot); err != nil {
+					b.Fatalf("Stream.Write() error = %v", err)
+				}
+				if err := <-errCh; err != nil {
+					b.Fatalf("reading the snapshot: %v", err)
+				}
+				stream.Close()
+			}
+		})
+	}
+}
+
+func TestConnPool_RPC_streamFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		// closeSession closes the whole server session instead of just
+		// the stream of the call
+		closeSession bool
+		wantPooled   bool
+	}{
+		{"stream reset", false, true},
+		{"session closed", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(nil, 0, 4, nil)
+			defer p.Shutdown()
+
+			// The server drops every stream without replying
+			c1, c2 := net.Pipe()
+			conf := yamux.DefaultConfig()
+			conf.LogOutput = ioutil.Discard
+			server, err := yamux.Server(c2, conf)
+			if err != nil {
+				t.Fatalf("yamux.Server() error = %v", err)
+			}
+			defer server.Close()
+			go func() {
+				for {
+					stream, err := server.Accept()
+					if err != nil {
+						return
+					}
+					if tt.closeSession {
+						server.Close()
+						return
+					}
+					stream.Close()
+				}
+			}()
+			session, err := yamux.Client(c1, conf)
+			if err != nil {
+				t.Fatalf("yamux.Client() error = %v", err)
+			}
+
+			addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4647}
+			conn := &Conn{
+				region:  "global",
+				addr:    addr,
+				key:     poolKey(addr, 0),
+				session: session,
+				clients: list.New(),
+				pool:    p,
+			}
+			p.Lock()
+			p.pool[conn.key] = conn
+			p.Unlock()
+
+			var reply struct{}
+			if err := p.RPC("global", addr, "Status.Ping", struct{}{}, &reply); !isConnError(err) {
+				t.Fatalf("ConnPool.RPC() error = %v, want a connection error", err)
+			}
+
+			p.Lock()
+			_, pooled := p.pool[conn.key]
+			p.Unlock()
+			if pooled != tt.wantPooled {
+				t.Errorf("ConnPool.RPC() left the connection pooled = %v, want %v", pooled, tt.wantPooled)
+			}
+			if session.IsClosed() == tt.wantPooled {
+				t.Errorf("ConnPool.RPC() left the session closed = %v", session.IsClosed())
+			}
+		})
+	}
+}
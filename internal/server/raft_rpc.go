@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/hashicorp/raft"
+
+	uconf "github.com/actiontech/dtle/internal/config"
 )
 
 // RaftLayer implements the raft.StreamLayer interface,
@@ -24,6 +26,11 @@ type RaftLayer struct {
 	// connCh is used to accept connections
 	connCh chan net.Conn
 
+	// tlsWrap is used to wrap outbound connections using TLS, to the
+	// servers of region
+	tlsWrap uconf.TLSWrapper
+	region  string
+
 	// Tracks if we are closed
 	closed    bool
 	closeCh   chan struct{}
@@ -31,11 +38,14 @@ type RaftLayer struct {
 }
 
 // NewRaftLayer is used to initialize a new RaftLayer which can
-// be used as a StreamLayer for Raft.
-func NewRaftLayer(addr net.Addr) *RaftLayer {
+// be used as a StreamLayer for Raft. If a tlsWrap is provided, the
+// connections will be wrapped with TLS.
+func NewRaftLayer(addr net.Addr, region string, tlsWrap uconf.TLSWrapper) *RaftLayer {
 	layer := &RaftLayer{
 		addr:    addr,
 		connCh:  make(chan net.Conn),
+		tlsWrap: tlsWrap,
+		region:  region,
 		closeCh: make(chan struct{}),
 	}
 	return layer
@@ -87,6 +97,16 @@ func (l *RaftLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net
 		return nil, err
 	}
 
+	// Upgrade to TLS if enabled
+	if l.tlsWrap != nil {
+		tlsConn, err := l.tlsWrap(l.region, conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
 	// Write the Raft byte to set the mode
 	_, err = conn.Write([]byte{byte(rpcRaft)})
 	if err != nil {
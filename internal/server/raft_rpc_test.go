@@ -9,16 +9,19 @@ package server
 import (
 	"net"
 	"reflect"
-	"sync"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/raft"
+
+	uconf "github.com/actiontech/dtle/internal/config"
 )
 
 func TestNewRaftLayer(t *testing.T) {
 	type args struct {
-		addr net.Addr
+		addr    net.Addr
+		region  string
+		tlsWrap uconf.TLSWrapper
 	}
 	tests := []struct {
 		name string
@@ -29,7 +32,7 @@ func TestNewRaftLayer(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewRaftLayer(tt.args.addr); !reflect.DeepEqual(got, tt.want) {
+			if got := NewRaftLayer(tt.args.addr, tt.args.region, tt.args.tlsWrap); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewRaftLayer() = %v, want %v", got, tt.want)
 			}
 		})
@@ -38,11 +41,10 @@ func TestNewRaftLayer(t *testing.T) {
 
 func TestRaftLayer_Handoff(t *testing.T) {
 	type fields struct {
-		addr      net.Addr
-		connCh    chan net.Conn
-		closed    bool
-		closeCh   chan struct{}
-		closeLock sync.Mutex
+		addr    net.Addr
+		connCh  chan net.Conn
+		closed  bool
+		closeCh chan struct{}
 	}
 	type args struct {
 		c net.Conn
@@ -58,11 +60,10 @@ func TestRaftLayer_Handoff(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			l := &RaftLayer{
-				addr:      tt.fields.addr,
-				connCh:    tt.fields.connCh,
-				closed:    tt.fields.closed,
-				closeCh:   tt.fields.closeCh,
-				closeLock: tt.fields.closeLock,
+				addr:    tt.fields.addr,
+				connCh:  tt.fields.connCh,
+				closed:  tt.fields.closed,
+				closeCh: tt.fields.closeCh,
 			}
 			if err := l.Handoff(tt.args.c); (err != nil) != tt.wantErr {
 				t.Errorf("RaftLayer.Handoff() error = %v, wantErr %v", err, tt.wantErr)
@@ -73,11 +74,10 @@ func TestRaftLayer_Handoff(t *testing.T) {
 
 func TestRaftLayer_Accept(t *testing.T) {
 	type fields struct {
-		addr      net.Addr
-		connCh    chan net.Conn
-		closed    bool
-		closeCh   chan struct{}
-		closeLock sync.Mutex
+		addr    net.Addr
+		connCh  chan net.Conn
+		closed  bool
+		closeCh chan struct{}
 	}
 	tests := []struct {
 		name    string
@@ -90,11 +90,10 @@ func TestRaftLayer_Accept(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			l := &RaftLayer{
-				addr:      tt.fields.addr,
-				connCh:    tt.fields.connCh,
-				closed:    tt.fields.closed,
-				closeCh:   tt.fields.closeCh,
-				closeLock: tt.fields.closeLock,
+				addr:    tt.fields.addr,
+				connCh:  tt.fields.connCh,
+				closed:  tt.fields.closed,
+				closeCh: tt.fields.closeCh,
 			}
 			got, err := l.Accept()
 			if (err != nil) != tt.wantErr {
@@ -110,11 +109,10 @@ func TestRaftLayer_Accept(t *testing.T) {
 
 func TestRaftLayer_Close(t *testing.T) {
 	type fields struct {
-		addr      net.Addr
-		connCh    chan net.Conn
-		closed    bool
-		closeCh   chan struct{}
-		closeLock sync.Mutex
+		addr    net.Addr
+		connCh  chan net.Conn
+		closed  bool
+		closeCh chan struct{}
 	}
 	tests := []struct {
 		name    string
@@ -126,11 +124,10 @@ func TestRaftLayer_Close(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			l := &RaftLayer{
-				addr:      tt.fields.addr,
-				connCh:    tt.fields.connCh,
-				closed:    tt.fields.closed,
-				closeCh:   tt.fields.closeCh,
-				closeLock: tt.fields.closeLock,
+				addr:    tt.fields.addr,
+				connCh:  tt.fields.connCh,
+				closed:  tt.fields.closed,
+				closeCh: tt.fields.closeCh,
 			}
 			if err := l.Close(); (err != nil) != tt.wantErr {
 				t.Errorf("RaftLayer.Close() error = %v, wantErr %v", err, tt.wantErr)
@@ -141,11 +138,10 @@ func TestRaftLayer_Close(t *testing.T) {
 
 func TestRaftLayer_Addr(t *testing.T) {
 	type fields struct {
-		addr      net.Addr
-		connCh    chan net.Conn
-		closed    bool
-		closeCh   chan struct{}
-		closeLock sync.Mutex
+		addr    net.Addr
+		connCh  chan net.Conn
+		closed  bool
+		closeCh chan struct{}
 	}
 	tests := []struct {
 		name   string
@@ -157,11 +153,10 @@ func TestRaftLayer_Addr(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			l := &RaftLayer{
-				addr:      tt.fields.addr,
-				connCh:    tt.fields.connCh,
-				closed:    tt.fields.closed,
-				closeCh:   tt.fields.closeCh,
-				closeLock: tt.fields.closeLock,
+				addr:    tt.fields.addr,
+				connCh:  tt.fields.connCh,
+				closed:  tt.fields.closed,
+				closeCh: tt.fields.closeCh,
 			}
 			if got := l.Addr(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("RaftLayer.Addr() = %v, want %v", got, tt.want)
@@ -172,11 +167,10 @@ func TestRaftLayer_Addr(t *testing.T) {
 
 func TestRaftLayer_Dial(t *testing.T) {
 	type fields struct {
-		addr      net.Addr
-		connCh    chan net.Conn
-		closed    bool
-		closeCh   chan struct{}
-		closeLock sync.Mutex
+		addr    net.Addr
+		connCh  chan net.Conn
+		closed  bool
+		closeCh chan struct{}
 	}
 	type args struct {
 		address raft.ServerAddress
@@ -194,11 +188,10 @@ func TestRaftLayer_Dial(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			l := &RaftLayer{
-				addr:      tt.fields.addr,
-				connCh:    tt.fields.connCh,
-				closed:    tt.fields.closed,
-				closeCh:   tt.fields.closeCh,
-				closeLock: tt.fields.closeLock,
+				addr:    tt.fields.addr,
+				connCh:  tt.fields.connCh,
+				closed:  tt.fields.closed,
+				closeCh: tt.fields.closeCh,
 			}
 			got, err := l.Dial(tt.args.address, tt.args.timeout)
 			if (err != nil) != tt.wantErr {
@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+)
+
+const (
+	// anyRPCMethod is the rate limit entry used for the methods without a
+	// limit of their own
+	anyRPCMethod = "*"
+
+	// rateLimitPruneInterval is how often buckets that refilled are
+	// forgotten so per-client buckets don't accumulate forever
+	rateLimitPruneInterval = time.Minute
+)
+
+// tokenBucket holds the tokens left to a single method, or to a single
+// client of a method, as of last.
+type tokenBucket struct {
+	limit  uconf.RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket for the time elapsed since it was last used and
+// consumes a token if one is available
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if max := float64(b.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full returns whether the bucket would be full at now, in which case it
+// is no different from a new one
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+// rpcRateLimiter limits the rate of RPCs per method, and optionally per
+// client of each method, with token buckets.
+type rpcRateLimiter struct {
+	limits    map[string]uconf.RateLimit
+	perClient bool
+
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	l         sync.Mutex
+}
+
+// newRPCRateLimiter returns a limiter enforcing the given limits
+func newRPCRateLimiter(limits map[string]uconf.RateLimit, perClient bool) *rpcRateLimiter {
+	r := &rpcRateLimiter{}
+	r.setLimits(limits, perClient)
+	return r
+}
+
+// setLimits replaces the enforced limits. All the buckets start over full.
+func (r *rpcRateLimiter) setLimits(limits map[string]uconf.RateLimit, perClient bool) {
+	copied := make(map[string]uconf.RateLimit, len(limits))
+	for method, limit := range limits {
+		if limit.Burst < 1 {
+			limit.Burst = 1
+		}
+		copied[method] = limit
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.limits = copied
+	r.perClient = perClient
+	r.buckets = make(map[string]*tokenBucket)
+	r.lastPrune = time.Now()
+}
+
+// allow returns whether a call to method from client may be served
+func (r *rpcRateLimiter) allow(method, client string) bool {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	limit, ok := r.limits[method]
+	if !ok {
+		if limit, ok = r.limits[anyRPCMethod]; !ok {
+			return true
+		}
+	}
+
+	now := time.Now()
+	if now.Sub(r.lastPrune) > rateLimitPruneInterval {
+		for key, bucket := range r.buckets {
+			if bucket.full(now) {
+				delete(r.buckets, key)
+			}
+		}
+		r.lastPrune = now
+	}
+
+	key := method
+	if r.perClient {
+		key = method + "/" + client
+	}
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		r.buckets[key] = bucket
+	}
+	return bucket.take(now)
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"testing"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+)
+
+func Test_rpcRateLimiter_allow(t *testing.T) {
+	type call struct {
+		method string
+		client string
+		want   bool
+	}
+	tests := []struct {
+		name      string
+		limits    map[string]uconf.RateLimit
+		perClient bool
+		calls     []call
+	}{
+		{
+			name:   "unlimited method",
+			limits: map[string]uconf.RateLimit{"Job.Register": {Rate: 0.001, Burst: 1}},
+			calls: []call{
+				{"Job.List", "a", true},
+				{"Job.List", "a", true},
+			},
+		},
+		{
+			name:   "burst exhausted",
+			limits: map[string]uconf.RateLimit{"Job.Register": {Rate: 0.001, Burst: 2}},
+			calls: []call{
+				{"Job.Register", "a", true},
+				{"Job.Register", "b", true},
+				{"Job.Register", "a", false},
+			},
+		},
+		{
+			name:   "wildcard",
+			limits: map[string]uconf.RateLimit{"*": {Rate: 0.001, Burst: 1}},
+			calls: []call{
+				{"Job.List", "a", true},
+				{"Job.List", "a", false},
+				{"Node.List", "a", true},
+			},
+		},
+		{
+			name:      "per client",
+			limits:    map[string]uconf.RateLimit{"Job.Register": {Rate: 0.001, Burst: 1}},
+			perClient: true,
+			calls: []call{
+				{"Job.Register", "a", true},
+				{"Job.Register", "a", false},
+				{"Job.Register", "b", true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRPCRateLimiter(tt.limits, tt.perClient)
+			for i, c := range tt.calls {
+				if got := r.allow(c.method, c.client); got != c.want {
+					t.Errorf("call %d: rpcRateLimiter.allow(%q, %q) = %v, want %v", i, c.method, c.client, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_rpcRateLimiter_setLimits(t *testing.T) {
+	r := newRPCRateLimiter(map[string]uconf.RateLimit{"Job.Register": {Rate: 0.001, Burst: 1}}, false)
+	if !r.allow("Job.Register", "a") || r.allow("Job.Register", "a") {
+		t.Fatalf("rpcRateLimiter.allow() didn't enforce the initial limit")
+	}
+
+	r.setLimits(nil, false)
+	if !r.allow("Job.Register", "a") {
+		t.Errorf("rpcRateLimiter.allow() still limited after the limits were removed")
+	}
+}
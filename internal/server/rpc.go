@@ -7,21 +7,28 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
-	"math/rand"
+	"io/ioutil"
 	"net"
 	"net/rpc"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/consul/lib"
 	memdb "github.com/hashicorp/go-memdb"
+	"github.com/hashicorp/go-msgpack/codec"
 	"github.com/hashicorp/net-rpc-msgpackrpc"
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/yamux"
 
+	uconf "github.com/actiontech/dtle/internal/config"
+	log "github.com/actiontech/dtle/internal/logger"
 	"github.com/actiontech/dtle/internal/models"
 	"github.com/actiontech/dtle/internal/server/store"
 )
@@ -29,18 +36,24 @@ import (
 type RPCType byte
 
 const (
-	rpcUdup      RPCType = 0x01
-	rpcRaft              = 0x02
-	rpcMultiplex         = 0x03
+	rpcUdup       RPCType = 0x01
+	rpcRaft               = 0x02
+	rpcMultiplex          = 0x03
+	rpcCompressed         = 0x04
+	rpcStreaming          = 0x05
+
+	// rpcChecksummed is followed by rpcMultiplex or rpcCompressed, whose
+	// streams then carry checksummed frames
+	rpcChecksummed = 0x06
 )
 
 const (
 	// maxQueryTime is used to bound the limit of a blocking query
-	maxQueryTime = 300 * time.Second
+	maxQueryTime = models.MaxQueryTime
 
 	// defaultQueryTime is the amount of time we block waiting for a change
 	// if no time is specified. Previously we would wait the maxQueryTime.
-	defaultQueryTime = 300 * time.Second
+	defaultQueryTime = models.MaxQueryTime
 
 	// jitterFraction is a the limit to the amount of jitter we apply
 	// to a user specified MaxQueryTime. We divide the specified time by
@@ -58,9 +71,36 @@ const (
 	// the requesting goroutine forever.
 	enqueueLimit = 30 * time.Second
 
+	// maxEnqueueLimit is the ceiling for the enqueue timeout a write
+	// request can ask for.
+	maxEnqueueLimit = 10 * time.Minute
+
+	// readIndexPollInterval is how often a consistent read checks whether
+	// the local FSM caught up with the leader.
+	readIndexPollInterval = 5 * time.Millisecond
+
+	// maxForwardRetries bounds how many times a forward to the leader is
+	// retried after a connection error.
+	maxForwardRetries = 3
+
+	// forwardRetryBackoff is the base of the exponential backoff between
+	// retried forwards.
+	forwardRetryBackoff = 25 * time.Millisecond
+
+	// overloadRetryBase is the back off suggested to clients when the
+	// server is at its overload threshold. It grows with the load.
+	overloadRetryBase = 100 * time.Millisecond
+
+	// maxOverloadRetry caps the back off suggested to clients
+	maxOverloadRetry = 10 * time.Second
+
 	defaultLeaderTTL = 20 * time.Second
 )
 
+// errServerDraining is returned by the codec when a request arrives while
+// the server is shutting down
+var errServerDraining = fmt.Errorf("server is shutting down")
+
 // NewClientCodec returns a new rpc.ClientCodec to be used to make RPC calls to
 // the Udup Server.
 func NewClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
@@ -73,27 +113,228 @@ func NewServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
 	return msgpackrpc.NewCodecFromHandle(true, true, conn, models.HashiMsgpackHandle)
 }
 
-// listen is used to listen for incoming RPC connections
+// instrumentedCodec wraps a rpc.ServerCodec to record the latency of every
+// request it serves, keyed by the RPC method name. net/rpc doesn't expose
+// the method to the caller of ServeRequest so we capture it from the header.
+// It also hands the context of the connection to the requests it decodes so
+// blocking queries can notice the caller going away.
+type instrumentedCodec struct {
+	rpc.ServerCodec
+
+	ctx     context.Context
+	drainer *rpcDrainer
+	method  string
+	start   time.Time
+
+	// limiter, if set, rejects the requests of client above the rate
+	// limit of their method before they reach net/rpc
+	limiter *rpcRateLimiter
+	client  string
+
+	// filter, if set, rejects the methods that may not be called on the
+	// listener the connection was accepted on, before they are forwarded
+	// or reach net/rpc
+	filter *rpcMethodFilter
+
+	// dispatcher, if set, holds the decoded requests until they get a
+	// slot, by priority. dispatched is set while the request holds one,
+	// and shed once a request was answered with the error it was shed
+	// with rather than served.
+	dispatcher *rpcDispatcher
+	dispatched bool
+	shed       bool
+
+	// idleConn, if set, has a read deadline while waiting for a request
+	// that is cleared once a request header was read, so the handler and
+	// blocking queries aren't bound by it
+	idleConn net.Conn
+
+	// cancel releases the context bounding the request being served by
+	// its deadline
+	cancel context.CancelFunc
+}
+
+// contextSetter is implemented by requests that embed QueryOptions or
+// WriteRequest
+type contextSetter interface {
+	SetContext(context.Context)
+}
+
+// deadliner is implemented by requests that carry a deadline
+type deadliner interface {
+	RequestDeadline() time.Time
+}
+
+// newInstrumentedCodec returns a codec that records per-method latency
+// and attaches ctx to every request. If drainer is set, requests are
+// tracked as in flight until their reply is written.
+func newInstrumentedCodec(ctx context.Context, codec rpc.ServerCodec, drainer *rpcDrainer) *instrumentedCodec {
+	return &instrumentedCodec{ServerCodec: codec, ctx: ctx, drainer: drainer}
+}
+
+func (c *instrumentedCodec) ReadRequestHeader(req *rpc.Request) error {
+	c.method = ""
+	c.shed = false
+	for {
+		if err := c.ServerCodec.ReadRequestHeader(req); err != nil {
+			return err
+		}
+		if !c.filter.permits(req.ServiceMethod) {
+			if err := c.rejectRequest(req, models.ErrPermissionDenied); err != nil {
+				return err
+			}
+			metrics.IncrCounter([]string{"server", "rpc", "permission_denied", req.ServiceMethod}, 1)
+			continue
+		}
+		if c.limiter == nil || c.limiter.allow(req.ServiceMethod, c.client) {
+			break
+		}
+		if err := c.rejectRequest(req, models.ErrRateLimited); err != nil {
+			return err
+		}
+		metrics.IncrCounter([]string{"server", "rpc", "rate_limited", req.ServiceMethod}, 1)
+	}
+	if c.idleConn != nil {
+		c.idleConn.SetReadDeadline(time.Time{})
+	}
+	if c.drainer != nil && !c.drainer.startRequest() {
+		return errServerDraining
+	}
+	c.method = req.ServiceMethod
+	c.start = time.Now()
+	return nil
+}
+
+// rejectRequest answers the request whose header was just read with err
+// without handing it to net/rpc. Blocking queries only go through here
+// once, when they start, so their later wake ups are never limited.
+func (c *instrumentedCodec) rejectRequest(req *rpc.Request, err error) error {
+	if err := c.ServerCodec.ReadRequestBody(nil); err != nil {
+		return err
+	}
+	resp := &rpc.Response{
+		ServiceMethod: req.ServiceMethod,
+		Seq:           req.Seq,
+		Error:         err.Error(),
+	}
+	return c.ServerCodec.WriteResponse(resp, struct{}{})
+}
+
+func (c *instrumentedCodec) ReadRequestBody(body interface{}) error {
+	if err := c.ServerCodec.ReadRequestBody(body); err != nil {
+		return err
+	}
+
+	// The body of a request net/rpc couldn't route is discarded
+	if body == nil {
+		return nil
+	}
+	ctx := c.ctx
+	if setter, ok := body.(contextSetter); ok {
+		if req, ok := body.(deadliner); ok && !req.RequestDeadline().IsZero() {
+			ctx, c.cancel = context.WithDeadline(ctx, req.RequestDeadline())
+		}
+		setter.SetContext(ctx)
+	}
+	return c.dispatch(ctx, body)
+}
+
+// dispatch waits for the dispatcher to give the request a slot. Blocking
+// queries skip it since they are bounded by MaxBlockingQueries and mostly
+// wait. If the request is shed, net/rpc answers it with the error
+// returned, which ends the ServeRequest call without breaking the stream.
+func (c *instrumentedCodec) dispatch(ctx context.Context, body interface{}) error {
+	if c.dispatcher == nil {
+		return nil
+	}
+	if q, ok := body.(blockingQuerier); ok && q.IsBlockingQuery() {
+		return nil
+	}
+	if err := c.dispatcher.acquire(ctx, requestPriority(c.method, body)); err != nil {
+		metrics.IncrCounter([]string{"server", "rpc", "shed", c.method}, 1)
+		c.shed = true
+		return err
+	}
+	c.dispatched = true
+	return nil
+}
+
+func (c *instrumentedCodec) WriteResponse(resp *rpc.Response, body interface{}) error {
+	if c.drainer != nil {
+		defer c.drainer.endRequest()
+	}
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	if c.dispatched {
+		c.dispatcher.release()
+		c.dispatched = false
+	}
+	if c.method != "" {
+		metrics.MeasureSince([]string{"server", "rpc", "method", c.method}, c.start)
+	}
+
+	// Nobody is left to read the reply of a cancelled query
+	if resp.Error == models.ErrQueryCancelled.Error() && c.ctx.Err() != nil {
+		metrics.IncrCounter([]string{"server", "rpc", "cancelled_query"}, 1)
+		return nil
+	}
+	resp.Error = codeErrorMessage(resp.Error)
+	return c.ServerCodec.WriteResponse(resp, body)
+}
+
+// listen is used to listen for incoming RPC connections on every RPC
+// listener
 func (s *Server) listen() {
+	for _, list := range s.extraRPCListeners {
+		go s.acceptLoop(list)
+	}
+	s.acceptLoop(s.rpcListener)
+}
+
+// acceptLoop accepts the connections of a single RPC listener until the
+// server shuts down. The connections carry the method filter of the
+// listener in their context.
+func (s *Server) acceptLoop(list net.Listener) {
+	ctx := withMethodFilter(context.Background(), s.rpcMethodFilters[list])
 	for {
 		// Accept a connection
-		conn, err := s.rpcListener.Accept()
+		conn, err := list.Accept()
 		if err != nil {
 			if s.shutdown {
 				return
 			}
-			s.logger.Errorf("server.rpc: failed to accept RPC conn: %v", err)
+			s.logger.Errorf("server.rpc: failed to accept RPC conn on %v: %v", list.Addr(), err)
+			continue
+		}
+
+		// Enforce the connection limits before doing any work
+		limited, err := s.connLimiter.acquire(conn)
+		if err != nil {
+			s.logger.Warnf("server.rpc: rejecting RPC conn from %v: %v", conn.RemoteAddr(), err)
+			metrics.IncrCounter([]string{"server", "rpc", "rejected_conn"}, 1)
+			conn.Close()
 			continue
 		}
 
-		go s.handleConn(conn)
+		go s.handleConn(ctx, limited)
 		metrics.IncrCounter([]string{"server", "rpc", "accept_conn"}, 1)
 	}
 }
 
 // handleConn is used to determine if this is a Raft or
 // Udup type RPC connection and invoke the correct handler
-func (s *Server) handleConn(conn net.Conn) {
+func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
+	// Complete the TLS handshake first so that an untrusted peer is
+	// reported as such instead of as a garbled RPC byte
+	if err := s.handshakeTLS(conn); err != nil {
+		s.logger.Errorf("server.rpc: TLS handshake with %v failed: %v", conn.RemoteAddr(), err)
+		metrics.IncrCounter([]string{"server", "rpc", "tls_handshake_error"}, 1)
+		conn.Close()
+		return
+	}
+
 	// Read a single byte
 	buf := make([]byte, 1)
 	if _, err := conn.Read(buf); err != nil {
@@ -107,14 +348,34 @@ func (s *Server) handleConn(conn net.Conn) {
 	// Switch on the byte
 	switch RPCType(buf[0]) {
 	case rpcUdup:
-		s.handleUdupConn(conn)
+		s.handleUdupConn(ctx, conn)
 
 	case rpcRaft:
+		// Raft is only for servers, so it is never served on a listener
+		// restricted to some methods
+		if methodFilterFrom(ctx) != nil {
+			s.logger.Warnf("server.rpc: rejecting Raft conn from %v on a filtered listener", conn.RemoteAddr())
+			metrics.IncrCounter([]string{"server", "rpc", "permission_denied", "raft"}, 1)
+			conn.Close()
+			return
+		}
 		metrics.IncrCounter([]string{"server", "rpc", "raft_handoff"}, 1)
 		s.raftLayer.Handoff(conn)
 
 	case rpcMultiplex:
-		s.handleMultiplex(conn)
+		s.handleMultiplex(ctx, conn, s.handleUdupConn)
+
+	case rpcCompressed:
+		metrics.IncrCounter([]string{"server", "rpc", "compressed_conn"}, 1)
+		s.handleMultiplex(ctx, newCompressedConn(conn, s.config.RPCCompressionThreshold), s.handleUdupConn)
+
+	case rpcStreaming:
+		metrics.IncrCounter([]string{"server", "rpc", "streaming_conn"}, 1)
+		s.handleMultiplex(ctx, conn, s.handleStreamingConn)
+
+	case rpcChecksummed:
+		metrics.IncrCounter([]string{"server", "rpc", "checksummed_conn"}, 1)
+		s.handleChecksummed(ctx, conn)
 
 	default:
 		s.logger.Errorf("server.rpc: unrecognized RPC byte: %v", buf[0])
@@ -123,12 +384,64 @@ func (s *Server) handleConn(conn net.Conn) {
 	}
 }
 
+// handshakeTLS is used to complete the server side of a TLS handshake,
+// bounded by a timeout so a stalled peer can't hold the goroutine. It is a
+// no-op for connections that aren't using TLS.
+func (s *Server) handshakeTLS(conn net.Conn) error {
+	if lc, ok := conn.(*limitedConn); ok {
+		conn = lc.Conn
+	}
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	tlsConn.SetDeadline(time.Now().Add(uconf.TLSHandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	return tlsConn.SetDeadline(time.Time{})
+}
+
+// handleChecksummed serves a multiplexed connection, compressed or not,
+// whose streams carry checksummed frames
+func (s *Server) handleChecksummed(ctx context.Context, conn net.Conn) {
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		if err != io.EOF {
+			s.logger.Errorf("server.rpc: failed to read byte: %v", err)
+		}
+		conn.Close()
+		return
+	}
+
+	handler := func(ctx context.Context, stream net.Conn) {
+		s.handleUdupConn(ctx, newChecksumConn(stream))
+	}
+	switch RPCType(buf[0]) {
+	case rpcMultiplex:
+		s.handleMultiplex(ctx, conn, handler)
+
+	case rpcCompressed:
+		s.handleMultiplex(ctx, newCompressedConn(conn, s.config.RPCCompressionThreshold), handler)
+
+	default:
+		s.logger.Errorf("server.rpc: unrecognized checksummed RPC byte: %v", buf[0])
+		conn.Close()
+	}
+}
+
 // handleMultiplex is used to multiplex a single incoming connection
-// using the Yamux multiplexer
-func (s *Server) handleMultiplex(conn net.Conn) {
+// using the Yamux multiplexer. The streams are served by handler with a
+// context derived from ctx that is cancelled once the session is gone.
+func (s *Server) handleMultiplex(ctx context.Context, conn net.Conn, handler func(context.Context, net.Conn)) {
 	defer conn.Close()
-	conf := yamux.DefaultConfig()
-	conf.LogOutput = s.config.LogOutput
+	if !s.rpcDrainer.trackConn(conn) {
+		return
+	}
+	defer s.rpcDrainer.untrackConn(conn)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conf := yamuxConfig(s.config.LogOutput, s.config.RPCMaxStreamWindow)
 	server, _ := yamux.Server(conn, conf)
 	for {
 		sub, err := server.Accept()
@@ -138,14 +451,139 @@ func (s *Server) handleMultiplex(conn net.Conn) {
 			}
 			return
 		}
-		go s.handleUdupConn(sub)
+		go handler(ctx, sub)
+	}
+}
+
+// handleStreamingConn is used to serve a single streaming RPC. The client
+// sends a StreamingRPCHeader and the arguments of the method, after which
+// the server pushes frames until either side goes away.
+func (s *Server) handleStreamingConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	if !s.rpcDrainer.trackConn(conn) {
+		return
+	}
+	defer s.rpcDrainer.untrackConn(conn)
+
+	dec := codec.NewDecoder(conn, models.HashiMsgpackHandle)
+	enc := codec.NewEncoder(conn, models.HashiMsgpackHandle)
+	var header models.StreamingRPCHeader
+	if err := dec.Decode(&header); err != nil {
+		if err != io.EOF {
+			s.logger.Errorf("server.rpc: failed to read streaming RPC header: %v", err)
+		}
+		return
+	}
+
+	if !methodFilterFrom(ctx).permits(header.Method) {
+		metrics.IncrCounter([]string{"server", "rpc", "permission_denied", header.Method}, 1)
+		enc.Encode(&models.EventStreamFrame{Error: models.ErrPermissionDenied.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer metrics.MeasureSince([]string{"server", "rpc", "stream", header.Method}, time.Now())
+
+	// The client doesn't send anything once it sent the arguments, so a
+	// read returning means it went away
+	watchClient := func() {
+		go func() {
+			io.Copy(ioutil.Discard, conn)
+			cancel()
+		}()
+		go func() {
+			select {
+			case <-s.shutdownCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	var err error
+	var errFrame func(string) interface{}
+	switch header.Method {
+	case "Event.Stream":
+		errFrame = func(msg string) interface{} { return &models.EventStreamFrame{Error: msg} }
+		var args models.EventStreamRequest
+		if err = dec.Decode(&args); err != nil {
+			break
+		}
+		watchClient()
+		err = s.endpoints.Event.Stream(ctx, &args, enc)
+
+	case "Job.ListStream":
+		errFrame = listStreamError
+		var args models.JobListRequest
+		if err = dec.Decode(&args); err != nil {
+			break
+		}
+		watchClient()
+		err = s.endpoints.Job.ListStream(ctx, &args, enc)
+
+	case "Node.ListStream":
+		errFrame = listStreamError
+		var args models.NodeListRequest
+		if err = dec.Decode(&args); err != nil {
+			break
+		}
+		watchClient()
+		err = s.endpoints.Node.ListStream(ctx, &args, enc)
+
+	case "Alloc.ListStream":
+		errFrame = listStreamError
+		var args models.AllocListRequest
+		if err = dec.Decode(&args); err != nil {
+			break
+		}
+		watchClient()
+		err = s.endpoints.Alloc.ListStream(ctx, &args, enc)
+
+	case "Operator.StateExport":
+		errFrame = func(msg string) interface{} { return &models.StateExportFrame{Error: msg} }
+		var args models.StateExportRequest
+		if err = dec.Decode(&args); err != nil {
+			break
+		}
+		watchClient()
+		err = s.endpoints.Operator.StateExport(ctx, &args, enc)
+
+	default:
+		errFrame = func(msg string) interface{} { return &models.EventStreamFrame{Error: msg} }
+		err = fmt.Errorf("unknown streaming RPC method %q", header.Method)
 	}
+
+	if err != nil && ctx.Err() == nil {
+		s.logger.Warnf("server.rpc: streaming RPC %s failed: %v", header.Method, err)
+		enc.Encode(errFrame(err.Error()))
+	}
+}
+
+// listStreamError returns the frame ending a list stream that failed
+func listStreamError(msg string) interface{} {
+	return &models.ListStreamFrame{Error: msg}
 }
 
-// handleUdupConn is used to service a single Udup RPC connection
-func (s *Server) handleUdupConn(conn net.Conn) {
+// handleUdupConn is used to service a single Udup RPC connection. Blocking
+// queries served on it return early once ctx is cancelled. If the server
+// has an RPCIdleTimeout, the connection is closed once it went that long
+// without a new request.
+func (s *Server) handleUdupConn(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
-	rpcCodec := NewServerCodec(conn)
+	if !s.rpcDrainer.trackConn(conn) {
+		return
+	}
+	defer s.rpcDrainer.untrackConn(conn)
+	rpcCodec := newInstrumentedCodec(ctx, NewServerCodec(conn), s.rpcDrainer)
+	rpcCodec.limiter = s.rpcLimiter
+	rpcCodec.client = connIP(conn)
+	rpcCodec.filter = methodFilterFrom(ctx)
+	rpcCodec.dispatcher = s.rpcDispatcher
+	idleTimeout := s.config.RPCIdleTimeout
+	if idleTimeout > 0 {
+		rpcCodec.idleConn = conn
+	}
 	for {
 		select {
 		case <-s.shutdownCh:
@@ -153,8 +591,24 @@ func (s *Server) handleUdupConn(conn net.Conn) {
 		default:
 		}
 
+		var idleDeadline time.Time
+		if idleTimeout > 0 {
+			idleDeadline = time.Now().Add(idleTimeout)
+			conn.SetReadDeadline(idleDeadline)
+		}
+
 		if err := s.rpcServer.ServeRequest(rpcCodec); err != nil {
-			if err != io.EOF && !strings.Contains(err.Error(), "closed") {
+			// The shed request was answered, the stream is still usable
+			if rpcCodec.shed {
+				continue
+			}
+
+			// No request header came in before the deadline
+			if idleTimeout > 0 && rpcCodec.method == "" && !time.Now().Before(idleDeadline) {
+				metrics.IncrCounter([]string{"server", "rpc", "idle_stream_reaped"}, 1)
+				return
+			}
+			if err != io.EOF && err != errServerDraining && !strings.Contains(err.Error(), "closed") {
 				s.logger.Errorf("server.rpc: RPC error: %v (%v)", err, conn)
 				metrics.IncrCounter([]string{"server", "rpc", "request_error"}, 1)
 			}
@@ -165,24 +619,47 @@ func (s *Server) handleUdupConn(conn net.Conn) {
 }
 
 // forward is used to forward to a remote region or to forward to the local leader
-// Returns a bool of if forwarding was performed, as well as any error
+// Returns a bool of if forwarding was performed, as well as any error.
+// Time spent in forwarded calls is recorded under server.rpc.forward so it
+// can be told apart from the work done locally under server.rpc.method.
 func (s *Server) forward(method string, info models.RPCInfo, args interface{}, reply interface{}) (bool, error) {
 	var firstCheck time.Time
+	var firstForward time.Time
+	var retries uint
 
 	region := info.RequestRegion()
 	if region == "" {
-		return true, fmt.Errorf("missing target RPC")
+		return true, models.NewRPCError(models.ErrCodeInvalidRequest, "missing target RPC")
+	}
+
+	// Don't start working on a request the caller already gave up on
+	if deadline := info.RequestDeadline(); !deadline.IsZero() && time.Now().After(deadline) {
+		metrics.IncrCounter([]string{"server", "rpc", "deadline_exceeded"}, 1)
+		return true, context.DeadlineExceeded
 	}
 
+	// Tag the request so its hops can be correlated in the logs
+	if info.GetRequestID() == "" {
+		info.SetRequestID(models.GenerateUUID())
+	}
+	requestID := info.GetRequestID()
+
 	// Handle region forwarding
 	if region != s.config.Region {
-		err := s.forwardRegion(region, method, args, reply)
-		return true, err
+		defer metrics.MeasureSince([]string{"server", "rpc", "forward", method}, time.Now())
+		s.logger.WithField(log.FieldRequestID, requestID).Debugf("server.rpc: forwarding %s to region %s", method, region)
+		err := s.forwardRegion(region, method, info.IsRead() && info.AllowStaleRead(),
+			s.regionTimeout(region, info), args, reply)
+		return true, annotateForwardError(err, requestID)
 	}
 
-	// Check if we can allow a stale read
+	// Check if we can allow a stale read, unless we lost touch with the
+	// leader for longer than the read may be stale
 	if info.IsRead() && info.AllowStaleRead() {
-		return false, nil
+		if !s.tooStale(info) {
+			return false, nil
+		}
+		metrics.IncrCounter([]string{"server", "rpc", "stale_read_forwarded"}, 1)
 	}
 
 CHECK_LEADER:
@@ -194,10 +671,40 @@ CHECK_LEADER:
 		return false, nil
 	}
 
+	// Serve consistent reads locally once we caught up with the leader
+	if remoteServer != nil && info.IsRead() && info.ConsistentRead() {
+		if err := s.readIndexBarrier(remoteServer, s.readIndexTimeout(info)); err != nil {
+			return true, err
+		}
+		return false, nil
+	}
+
 	// Handle the case of a known leader
 	if remoteServer != nil {
+		if firstForward.IsZero() {
+			firstForward = time.Now()
+		}
+		s.logger.WithField(log.FieldRequestID, requestID).Debugf("server.rpc: forwarding %s to leader %v", method, remoteServer)
 		err := s.forwardLeader(remoteServer, method, args, reply)
-		return true, err
+
+		// The leader may have moved, so look it up again and retry
+		if canRetryForward(info, err) && retries < maxForwardRetries &&
+			time.Now().Sub(firstForward) < s.config.RPCHoldTimeout {
+			retries++
+			metrics.IncrCounter([]string{"server", "rpc", "forward_retry"}, 1)
+			select {
+			case <-time.After(forwardRetryBackoff << retries):
+				goto CHECK_LEADER
+			case <-s.shutdownCh:
+			}
+		}
+		metrics.MeasureSince([]string{"server", "rpc", "forward", method}, firstForward)
+		return true, annotateForwardError(err, requestID)
+	}
+
+	// Fail fast if the caller doesn't want to wait for an election
+	if info.NoLeaderWaitRequested() {
+		return true, models.ErrNoLeader
 	}
 
 	// Gate the request until there is a leader
@@ -217,6 +724,121 @@ CHECK_LEADER:
 	return true, models.ErrNoLeader
 }
 
+// annotateForwardError adds the request ID to the error of a forward that
+// failed to reach the next server, coded as ErrCodeForwardFailed. Errors
+// returned by the remote endpoint are left alone.
+func annotateForwardError(err error, requestID string) error {
+	if !isConnError(err) {
+		return err
+	}
+	return models.NewRPCError(models.ErrCodeForwardFailed, "%v (request %s)", err, requestID)
+}
+
+// codeErrorMessage gives a code to the message of the context errors that
+// any RPC may fail with, so clients can tell them apart like the errors
+// of models
+func codeErrorMessage(msg string) string {
+	switch msg {
+	case context.DeadlineExceeded.Error():
+		return models.NewRPCError(models.ErrCodeDeadlineExceeded, "%s", msg).Error()
+	case context.Canceled.Error():
+		return models.NewRPCError(models.ErrCodeQueryCancelled, "%s", msg).Error()
+	}
+	return msg
+}
+
+// maxQueryTimer is implemented by queries that bound how long they take
+type maxQueryTimer interface {
+	RequestMaxQueryTime() time.Duration
+}
+
+// blockingQuerier is implemented by queries that may wait for a change
+type blockingQuerier interface {
+	IsBlockingQuery() bool
+}
+
+// regionTimeout returns how long an RPC forwarded to region may take: the
+// timeout configured for the region, or RPCHoldTimeout, plus the time a
+// blocking query may wait on the remote server.
+func (s *Server) regionTimeout(region string, info models.RPCInfo) time.Duration {
+	s.regionTimeoutsLock.RLock()
+	timeout, ok := s.regionTimeouts[region]
+	s.regionTimeoutsLock.RUnlock()
+	if !ok {
+		timeout = s.config.RPCHoldTimeout
+	}
+
+	if q, ok := info.(blockingQuerier); ok && q.IsBlockingQuery() {
+		wait := defaultQueryTime
+		if mq, ok := info.(maxQueryTimer); ok && mq.RequestMaxQueryTime() > 0 {
+			wait = mq.RequestMaxQueryTime()
+		}
+		if wait > maxQueryTime {
+			wait = maxQueryTime
+		}
+		timeout += wait + wait/jitterFraction
+	}
+	return timeout
+}
+
+// readIndexTimeout returns how long a consistent read may wait for the
+// local FSM to catch up with the leader
+func (s *Server) readIndexTimeout(info models.RPCInfo) time.Duration {
+	timeout := s.config.RPCHoldTimeout
+	if q, ok := info.(maxQueryTimer); ok && q.RequestMaxQueryTime() > 0 {
+		timeout = q.RequestMaxQueryTime()
+	}
+	if timeout > maxQueryTime {
+		timeout = maxQueryTime
+	}
+	return timeout
+}
+
+// readIndexBarrier gets the commit index from the leader and waits until
+// the local FSM has applied it, so a read served afterwards observes every
+// write that completed before it started.
+func (s *Server) readIndexBarrier(leader *serverParts, timeout time.Duration) error {
+	defer metrics.MeasureSince([]string{"server", "rpc", "read_index"}, time.Now())
+	deadline := time.Now().Add(timeout)
+
+	args := models.GenericRequest{
+		QueryOptions: models.QueryOptions{Region: s.config.Region},
+	}
+	var index uint64
+	if err := s.forwardLeader(leader, "Status.ReadIndex", &args, &index); err != nil {
+		return err
+	}
+
+	for s.raft.AppliedIndex() < index {
+		if time.Now().After(deadline) {
+			return models.ErrReadIndexTimeout
+		}
+		select {
+		case <-time.After(readIndexPollInterval):
+		case <-s.shutdownCh:
+			return fmt.Errorf("shutting down")
+		}
+	}
+	return nil
+}
+
+// raftCommitIndex returns the last index known to be committed
+func (s *Server) raftCommitIndex() uint64 {
+	index, _ := strconv.ParseUint(s.raft.Stats()["commit_index"], 10, 64)
+	return index
+}
+
+// canRetryForward returns whether a forward to the leader that failed with
+// err can be sent again. Only connection errors are retried, and writes
+// only if they can't have reached the leader.
+func canRetryForward(info models.RPCInfo, err error) bool {
+	ce, ok := err.(*connError)
+	if !ok {
+		return false
+	}
+	return info.IsRetrySafe() || !ce.sent
+}
+
 // getLeader returns if the current node is the leader, and if not
 // then it returns the leader which is potentially nil if the cluster
 // has not yet elected a leader.
@@ -237,6 +859,11 @@ func (s *Server) getLeader() (bool, *serverParts) {
 	server := s.localPeers[leader]
 	s.peerLock.RUnlock()
 
+	// A non-voter can't be the leader, its tags must be out of date
+	if server != nil && server.NonVoter {
+		return false, nil
+	}
+
 	// Server could be nil
 	return false, server
 }
@@ -250,11 +877,13 @@ func (s *Server) forwardLeader(server *serverParts, method string, args interfac
 	return s.connPool.RPC(s.config.Region, server.Addr, method, args, reply)
 }
 
-// forwardRegion is used to forward an RPC call to a remote region, or fail if no servers
-func (s *Server) forwardRegion(region, method string, args interface{}, reply interface{}) error {
+// forwardRegion is used to forward an RPC call to a remote region, or fail if no servers.
+// Non-voting servers are only considered for stale reads. A call taking longer than a
+// non zero timeout is abandoned.
+func (s *Server) forwardRegion(region, method string, staleRead bool, timeout time.Duration, args interface{}, reply interface{}) error {
 	// Bail if we can't find any servers
 	s.peerLock.RLock()
-	servers := s.peers[region]
+	servers := forwardTargets(s.peers[region], staleRead)
 	if len(servers) == 0 {
 		s.peerLock.RUnlock()
 		s.logger.Warnf("server.rpc: RPC request for region '%s', no path found",
@@ -262,43 +891,325 @@ func (s *Server) forwardRegion(region, method string, args interface{}, reply in
 		return models.ErrNoRegionPath
 	}
 
-	// Select a random addr
-	offset := rand.Intn(len(servers))
-	server := servers[offset]
+	// Skip the servers the pool refuses to call, unless that leaves none
+	// in which case the call fails fast
+	candidates := make([]*serverParts, 0, len(servers))
+	for _, server := range servers {
+		if !s.connPool.CircuitOpen(server.Addr) {
+			candidates = append(candidates, server)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = servers
+	}
+
+	// Select a healthy addr, favoring the servers with a higher weight
+	server := selectServer(candidates, s.peerHealth)
 	s.peerLock.RUnlock()
 
 	// Forward to remote Udup
 	metrics.IncrCounter([]string{"server", "rpc", "cross-region", region}, 1)
-	return s.connPool.RPC(region, server.Addr, method, args, reply)
+	err := s.connPool.TimedRPC(region, server.Addr, s.forwardMode(server), timeout, method, args, reply)
+
+	// Avoid the server for a while if we couldn't talk to it
+	if isConnError(err) {
+		s.peerHealth.markFailed(server.Addr.String())
+	} else {
+		s.peerHealth.markHealthy(server.Addr.String())
+	}
+	return err
+}
+
+// forwardMode returns the mode of the connections RPCs forwarded to server
+// are sent over, compressing and checksumming the payload if both ends
+// support it
+func (s *Server) forwardMode(server *serverParts) ConnMode {
+	var mode ConnMode
+	if s.config.RPCCompression && server.Compression {
+		mode |= ConnCompressed
+	}
+	if s.config.RPCFrameChecksums && server.Checksum {
+		mode |= ConnChecksummed
+	}
+	return mode
+}
+
+// stalenessBounder is implemented by reads that bound how stale they may
+// be served
+type stalenessBounder interface {
+	RequestMaxStaleness() time.Duration
+}
+
+// tooStale returns whether a follower last heard from the leader longer
+// ago than the stale read info accepts, in which case the leader has to
+// serve it
+func (s *Server) tooStale(info models.RPCInfo) bool {
+	req, ok := info.(stalenessBounder)
+	if !ok || req.RequestMaxStaleness() <= 0 || s.IsLeader() {
+		return false
+	}
+	return time.Now().Sub(s.raft.LastContact()) > req.RequestMaxStaleness()
+}
+
+// forwardTargets returns the servers an RPC may be forwarded to. Only
+// stale reads may be served by non-voters, everything else must reach a
+// server that can become the leader.
+func forwardTargets(servers []*serverParts, staleRead bool) []*serverParts {
+	if staleRead {
+		return servers
+	}
+	targets := make([]*serverParts, 0, len(servers))
+	for _, server := range servers {
+		if !server.NonVoter {
+			targets = append(targets, server)
+		}
+	}
+	return targets
+}
+
+// raftSchemaVersion returns the schema version to encode Raft messages
+// with: the current one only once every server of the region decodes it,
+// so that servers not upgraded yet keep applying the log during a rolling
+// upgrade
+func (s *Server) raftSchemaVersion() uint8 {
+	if s.serf == nil {
+		return models.SchemaVersion
+	}
+	return serversSchemaVersion(s.serf.Members(), s.config.Region)
 }
 
 // raftApplyFuture is used to encode a message, run it through raft, and return the Raft future.
 func (s *Server) raftApplyFuture(t models.MessageType, msg interface{}) (raft.ApplyFuture, error) {
-	buf, err := models.Encode(t, msg)
+	// Writes originating on this server get a request ID too, so the FSM
+	// logs of every write can be traced
+	if req, ok := msg.(requestIDSetter); ok && req.GetRequestID() == "" {
+		req.SetRequestID(models.GenerateUUID())
+	}
+
+	if err := s.sealSecrets(msg); err != nil {
+		return nil, err
+	}
+	version := s.raftSchemaVersion()
+	if t.MinSchemaVersion() > version {
+		return nil, models.ErrServersNotUpgraded
+	}
+	buf, err := models.EncodeVersion(t, version, msg)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to encode request: %v", err)
 	}
 
-	// Warn if the command is very large
-	if n := len(buf); n > raftWarnSize {
+	// Refuse commands above the hard limit, and warn if the command is
+	// very large
+	n := len(buf)
+	if limit := s.config.MaxRaftEntrySize; limit > 0 && n > limit {
+		s.logger.Errorf("manager: Refusing to apply raft entry (type %d) (%d bytes) over the %d bytes limit", t, n, limit)
+		metrics.IncrCounter([]string{"server", "raft", "rejected_entry"}, 1)
+		return nil, models.ErrRaftEntryTooLarge
+	}
+	if n > raftWarnSize {
 		s.logger.Warnf("manager: Attempting to apply large raft entry (type %d) (%d bytes)", t, n)
 	}
 
-	future := s.raft.Apply(buf, enqueueLimit)
+	// Don't wait to enqueue past the deadline of the request
+	timeout := s.enqueueTimeout(msg)
+	if req, ok := msg.(deadliner); ok && !req.RequestDeadline().IsZero() {
+		remaining := time.Until(req.RequestDeadline())
+		if remaining <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+		if remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	future := s.raft.Apply(buf, timeout)
 	return future, nil
 }
 
+// sealSecrets seals the passwords of the jobs msg carries with the keyring
+// of the server, if it has one, so that they are never applied in
+// plaintext. The jobs are replaced by sealed copies, those of the state
+// are left as they are.
+func (s *Server) sealSecrets(msg interface{}) error {
+	keyring := s.config.SecretsKeyring
+	if keyring == nil {
+		return nil
+	}
+	var err error
+	switch req := msg.(type) {
+	case *models.JobRegisterRequest:
+		req.Job, err = keyring.SealJob(req.Job)
+	case *models.JobConfigUpdateRequest:
+		req.Tasks, err = keyring.SealTasks(req.Tasks)
+	case *models.JobUpdateRequest:
+		// Older servers don't know the sealed checkpoints
+		if s.raftSchemaVersion() == models.LegacySchemaVersion {
+			break
+		}
+		for i, update := range req.JobUpdates {
+			if update.DumpCheckpoint == nil {
+				continue
+			}
+			sealed := new(models.TaskUpdate)
+			*sealed = *update
+			if sealed.SealedDumpCheckpoint, err = keyring.SealValue(update.DumpCheckpoint); err != nil {
+				break
+			}
+			sealed.DumpCheckpoint = nil
+			req.JobUpdates[i] = sealed
+		}
+	case *models.StateImportApplyRequest:
+		for i, job := range req.Jobs {
+			if req.Jobs[i], err = keyring.SealJob(job); err != nil {
+				break
+			}
+		}
+	case *models.AllocUpdateRequest:
+		if req.Job, err = keyring.SealJob(req.Job); err != nil {
+			break
+		}
+		for i, alloc := range req.Alloc {
+			var job *models.Job
+			if job, err = keyring.SealJob(alloc.Job); err != nil {
+				break
+			}
+			if job != alloc.Job {
+				sealed := new(models.Allocation)
+				*sealed = *alloc
+				sealed.Job = job
+				req.Alloc[i] = sealed
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to seal the secrets of the job: %v", err)
+	}
+	return nil
+}
+
+// requestLog returns the logger of the entries about the job jobID that
+// req is served for, tagged with the IDs of both
+func (s *Server) requestLog(req models.RPCInfo, jobID string) *log.Entry {
+	return s.logger.WithFields(log.Fields{log.FieldJobID: jobID, log.FieldRequestID: req.GetRequestID()})
+}
+
+// requestIDSetter is implemented by requests that carry a request ID
+type requestIDSetter interface {
+	GetRequestID() string
+	SetRequestID(string)
+}
+
+// enqueueTimeouter is implemented by requests that can override the time
+// allowed to enqueue their Raft command
+type enqueueTimeouter interface {
+	RequestEnqueueTimeout() time.Duration
+}
+
+// enqueueTimeout returns how long to wait to enqueue the Raft command for
+// msg. Overrides above maxEnqueueLimit are clamped.
+func (s *Server) enqueueTimeout(msg interface{}) time.Duration {
+	req, ok := msg.(enqueueTimeouter)
+	if !ok {
+		return enqueueLimit
+	}
+	timeout := req.RequestEnqueueTimeout()
+	if timeout <= 0 {
+		return enqueueLimit
+	}
+	if timeout > maxEnqueueLimit {
+		s.logger.Warnf("manager: Clamping requested Raft enqueue timeout %v to %v", timeout, maxEnqueueLimit)
+		return maxEnqueueLimit
+	}
+	return timeout
+}
+
+// contexter is implemented by requests that carry the context of the
+// connection serving them
+type contexter interface {
+	Context() context.Context
+}
+
 // raftApply is used to encode a message, run it through raft, and return
-// the FSM response along with any errors
+// the FSM response along with any errors. If the context of msg is done
+// first, its error is returned without waiting for Raft, although the
+// command may still be applied.
 func (s *Server) raftApply(t models.MessageType, msg interface{}) (interface{}, uint64, error) {
 	future, err := s.raftApplyFuture(t, msg)
 	if err != nil {
 		return nil, 0, err
 	}
-	if err := future.Error(); err != nil {
-		return nil, 0, err
+
+	ctx := context.Background()
+	if req, ok := msg.(contexter); ok {
+		ctx = req.Context()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		err := future.Error()
+		s.recordApply(err)
+		if err != nil {
+			return nil, 0, err
+		}
+		return future.Response(), future.Index(), nil
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		err := future.Error()
+		s.recordApply(err)
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return nil, 0, err
+		}
+		return future.Response(), future.Index(), nil
+	case <-ctx.Done():
+		metrics.IncrCounter([]string{"server", "raft", "apply_abandoned"}, 1)
+		return nil, 0, ctx.Err()
 	}
-	return future.Response(), future.Index(), nil
+}
+
+// raftBatchEntry is a message applied as part of a batch
+type raftBatchEntry struct {
+	Type models.MessageType
+	Msg  interface{}
+}
+
+// raftApplyBatch applies entries as a single Raft entry, in order, paying
+// a single round trip. Either all of them are applied or none is, in which
+// case the error of the failing entry is returned. The batch as a whole is
+// bound by MaxRaftEntrySize. It fails with ErrServersNotUpgraded until
+// every server knows batches.
+func (s *Server) raftApplyBatch(entries []raftBatchEntry) (uint64, error) {
+	req := &models.BatchRequest{Entries: make([][]byte, 0, len(entries))}
+	version := s.raftSchemaVersion()
+	for _, entry := range entries {
+		if entry.Type.MinSchemaVersion() > version {
+			return 0, models.ErrServersNotUpgraded
+		}
+		if r, ok := entry.Msg.(requestIDSetter); ok && r.GetRequestID() == "" {
+			r.SetRequestID(models.GenerateUUID())
+		}
+		if err := s.sealSecrets(entry.Msg); err != nil {
+			return 0, err
+		}
+		buf, err := models.EncodeVersion(entry.Type, version, entry.Msg)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to encode request: %v", err)
+		}
+		req.Entries = append(req.Entries, buf)
+	}
+
+	resp, index, err := s.raftApply(models.BatchRequestType, req)
+	if err != nil {
+		return 0, err
+	}
+	if err, ok := resp.(error); ok && err != nil {
+		return 0, err
+	}
+	metrics.IncrCounter([]string{"server", "raft", "batch_entries"}, float32(len(entries)))
+	return index, nil
 }
 
 // setQueryMeta is used to populate the QueryMeta data for an RPC call
@@ -310,6 +1221,26 @@ func (s *Server) setQueryMeta(m *models.QueryMeta) {
 		m.LastContact = time.Now().Sub(s.raft.LastContact())
 		m.KnownLeader = (s.raft.Leader() != "")
 	}
+	m.ServerLoad, m.RetryAfter = s.loadHint()
+}
+
+// loadHint returns the number of RPCs being served, leaving out the
+// blocking queries, and how long clients should back
+// off for when that is above the overload threshold.
+func (s *Server) loadHint() (int, time.Duration) {
+	load := int(s.rpcDrainer.activeRequests() - atomic.LoadInt64(&s.blockingQueries))
+	if load < 0 {
+		load = 0
+	}
+	threshold := s.config.RPCOverloadThreshold
+	if threshold <= 0 || load <= threshold {
+		return load, 0
+	}
+	retry := overloadRetryBase * time.Duration(load) / time.Duration(threshold)
+	if retry > maxOverloadRetry {
+		retry = maxOverloadRetry
+	}
+	return load, retry
 }
 
 // queryFn is used to perform a query operation. If a re-query is needed, the
@@ -324,19 +1255,73 @@ type blockingOptions struct {
 	queryOpts *models.QueryOptions
 	queryMeta *models.QueryMeta
 	run       queryFn
+
+	// table is what the query watches, a table of the state store for
+	// most, as Status.Watches reports it
+	table string
+}
+
+// queryBlocking runs fn as a blocking query and sets meta from the index
+// it returns. fn only has to register what it reads in the watch set it
+// is given. If tableIndex is set, the query also wakes up on any change
+// to that table and its index is used when fn returns zero, so an empty
+// result still reports an index to block on.
+func (s *Server) queryBlocking(opts *models.QueryOptions, meta *models.QueryMeta, tableIndex string,
+	fn func(memdb.WatchSet, *store.StateStore) (uint64, error)) error {
+	return s.blockingRPC(&blockingOptions{
+		queryOpts: opts,
+		queryMeta: meta,
+		table:     tableIndex,
+		run: func(ws memdb.WatchSet, state *store.StateStore) error {
+			index, err := fn(ws, state)
+			if err != nil {
+				return err
+			}
+			if tableIndex != "" {
+				tableIdx, err := state.IndexWatch(ws, tableIndex)
+				if err != nil {
+					return err
+				}
+				if index == 0 {
+					index = tableIdx
+				}
+			}
+			meta.Index = index
+			s.setQueryMeta(meta)
+			return nil
+		},
+	})
 }
 
 // blockingRPC is used for queries that need to wait for a
 // minimum index. This is used to block and wait for changes.
+// If the context of the query is cancelled while waiting,
+// models.ErrQueryCancelled is returned.
 func (s *Server) blockingRPC(opts *blockingOptions) error {
-	var timeout *time.Timer
+	var ctx context.Context
+	var cancel context.CancelFunc
 	var state *store.StateStore
+	var limited bool
+
+	// Requests for a later page never block, the caller is expected to
+	// page through a consistent view as quickly as possible.
+	blocking := opts.queryOpts.MinQueryIndex > 0 && opts.queryOpts.NextToken == ""
 
 	// Fast path non-blocking
-	if opts.queryOpts.MinQueryIndex == 0 {
+	if !blocking {
 		goto RUN_QUERY
 	}
 
+	// Past the limit of blocking queries the query is run only once and
+	// the client is told to retry
+	if !s.acquireBlockingSlot() {
+		metrics.IncrCounter([]string{"server", "rpc", "blocking_limited"}, 1)
+		blocking, limited = false, true
+		goto RUN_QUERY
+	}
+	defer s.releaseBlockingSlot()
+	defer s.watches.remove(s.watches.add(opts.table, opts.queryOpts.MinQueryIndex))
+
 	// Restrict the max query time, and ensure there is always one
 	if opts.queryOpts.MaxQueryTime > maxQueryTime {
 		opts.queryOpts.MaxQueryTime = maxQueryTime
@@ -348,12 +1333,13 @@ func (s *Server) blockingRPC(opts *blockingOptions) error {
 	opts.queryOpts.MaxQueryTime += lib.RandomStagger(opts.queryOpts.MaxQueryTime / jitterFraction)
 
 	// Setup a query timeout
-	timeout = time.NewTimer(opts.queryOpts.MaxQueryTime)
-	defer timeout.Stop()
+	ctx, cancel = context.WithTimeout(opts.queryOpts.Context(), opts.queryOpts.MaxQueryTime)
+	defer cancel()
 
 RUN_QUERY:
 	// Update the query meta data
 	s.setQueryMeta(opts.queryMeta)
+	opts.queryMeta.BlockingLimited = limited
 
 	// Increment the rpc query counter
 	metrics.IncrCounter([]string{"server", "rpc", "query"}, 1)
@@ -368,7 +1354,7 @@ RUN_QUERY:
 
 	// We can skip all watch tracking if this isn't a blocking query.
 	var ws memdb.WatchSet
-	if opts.queryOpts.MinQueryIndex > 0 {
+	if blocking {
 		ws = memdb.NewWatchSet()
 
 		// This channel will be closed if a snapshot is restored and the
@@ -380,10 +1366,36 @@ RUN_QUERY:
 	err := opts.run(ws, stateSnap)
 
 	// Check for minimum query time
-	if err == nil && opts.queryOpts.MinQueryIndex > 0 && opts.queryMeta.Index <= opts.queryOpts.MinQueryIndex {
-		if expired := ws.Watch(timeout.C); !expired {
+	if err == nil && blocking && opts.queryMeta.Index <= opts.queryOpts.MinQueryIndex {
+		err := ws.WatchCtx(ctx)
+		if err == nil {
 			goto RUN_QUERY
 		}
+		switch opts.queryOpts.Context().Err() {
+		case nil:
+		case context.DeadlineExceeded:
+			return context.DeadlineExceeded
+		default:
+			return models.ErrQueryCancelled
+		}
 	}
 	return err
 }
+
+// acquireBlockingSlot reserves one of the MaxBlockingQueries slots for a
+// blocking query, returning false if they are all taken
+func (s *Server) acquireBlockingSlot() bool {
+	n := atomic.AddInt64(&s.blockingQueries, 1)
+	if limit := s.config.MaxBlockingQueries; limit > 0 && n > int64(limit) {
+		atomic.AddInt64(&s.blockingQueries, -1)
+		return false
+	}
+	metrics.SetGauge([]string{"server", "rpc", "blocking_queries"}, float32(n))
+	return true
+}
+
+// releaseBlockingSlot frees the slot of a blocking query that is done
+func (s *Server) releaseBlockingSlot() {
+	n := atomic.AddInt64(&s.blockingQueries, -1)
+	metrics.SetGauge([]string{"server", "rpc", "blocking_queries"}, float32(n))
+}
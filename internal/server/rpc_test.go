@@ -7,11 +7,13 @@
 package server
 
 import (
+	"context"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/rpc"
 	"reflect"
-	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	uconf "github.com/actiontech/dtle/internal/config"
@@ -20,6 +22,7 @@ import (
 	"github.com/actiontech/dtle/internal/server/store"
 
 	"github.com/docker/leadership"
+	memdb "github.com/hashicorp/go-memdb"
 	"github.com/hashicorp/raft"
 	raftboltdb "github.com/hashicorp/raft-boltdb"
 	"github.com/hashicorp/serf/serf"
@@ -85,7 +88,6 @@ func TestServer_listen(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -93,12 +95,10 @@ func TestServer_listen(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -127,7 +127,6 @@ func TestServer_listen(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -135,12 +134,10 @@ func TestServer_listen(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.listen()
 		})
@@ -167,7 +164,6 @@ func TestServer_handleConn(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -175,12 +171,10 @@ func TestServer_handleConn(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		conn net.Conn
@@ -213,7 +207,6 @@ func TestServer_handleConn(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -221,14 +214,12 @@ func TestServer_handleConn(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
-			s.handleConn(tt.args.conn)
+			s.handleConn(context.Background(), tt.args.conn)
 		})
 	}
 }
@@ -253,7 +244,6 @@ func TestServer_handleMultiplex(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -261,12 +251,10 @@ func TestServer_handleMultiplex(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		conn net.Conn
@@ -299,7 +287,6 @@ func TestServer_handleMultiplex(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -307,14 +294,12 @@ func TestServer_handleMultiplex(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
-			s.handleMultiplex(tt.args.conn)
+			s.handleMultiplex(context.Background(), tt.args.conn, s.handleUdupConn)
 		})
 	}
 }
@@ -339,7 +324,6 @@ func TestServer_handleUdupConn(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -347,12 +331,10 @@ func TestServer_handleUdupConn(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		conn net.Conn
@@ -385,7 +367,6 @@ func TestServer_handleUdupConn(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -393,14 +374,12 @@ func TestServer_handleUdupConn(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
-			s.handleUdupConn(tt.args.conn)
+			s.handleUdupConn(context.Background(), tt.args.conn)
 		})
 	}
 }
@@ -425,7 +404,6 @@ func TestServer_forward(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -433,12 +411,10 @@ func TestServer_forward(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		method string
@@ -476,7 +452,6 @@ func TestServer_forward(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -484,12 +459,10 @@ func TestServer_forward(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			got, err := s.forward(tt.args.method, tt.args.info, tt.args.args, tt.args.reply)
 			if (err != nil) != tt.wantErr {
@@ -523,7 +496,6 @@ func TestServer_getLeader(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -531,12 +503,10 @@ func TestServer_getLeader(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -567,7 +537,6 @@ func TestServer_getLeader(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -575,12 +544,10 @@ func TestServer_getLeader(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			got, got1 := s.getLeader()
 			if got != tt.want {
@@ -613,7 +580,6 @@ func TestServer_forwardLeader(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -621,12 +587,10 @@ func TestServer_forwardLeader(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		server *serverParts
@@ -663,7 +627,6 @@ func TestServer_forwardLeader(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -671,12 +634,10 @@ func TestServer_forwardLeader(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.forwardLeader(tt.args.server, tt.args.method, tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Server.forwardLeader() error = %v, wantErr %v", err, tt.wantErr)
@@ -705,7 +666,6 @@ func TestServer_forwardRegion(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -713,12 +673,10 @@ func TestServer_forwardRegion(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		region string
@@ -755,7 +713,6 @@ func TestServer_forwardRegion(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -763,14 +720,12 @@ func TestServer_forwardRegion(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
-			if err := s.forwardRegion(tt.args.region, tt.args.method, tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
+			if err := s.forwardRegion(tt.args.region, tt.args.method, false, 0, tt.args.args, tt.args.reply); (err != nil) != tt.wantErr {
 				t.Errorf("Server.forwardRegion() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -797,7 +752,6 @@ func TestServer_raftApplyFuture(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -805,12 +759,10 @@ func TestServer_raftApplyFuture(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		t   models.MessageType
@@ -846,7 +798,6 @@ func TestServer_raftApplyFuture(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -854,12 +805,10 @@ func TestServer_raftApplyFuture(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			got, err := s.raftApplyFuture(tt.args.t, tt.args.msg)
 			if (err != nil) != tt.wantErr {
@@ -893,7 +842,6 @@ func TestServer_raftApply(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -901,12 +849,10 @@ func TestServer_raftApply(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		t   models.MessageType
@@ -943,7 +889,6 @@ func TestServer_raftApply(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -951,12 +896,10 @@ func TestServer_raftApply(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			got, got1, err := s.raftApply(tt.args.t, tt.args.msg)
 			if (err != nil) != tt.wantErr {
@@ -993,7 +936,6 @@ func TestServer_setQueryMeta(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -1001,12 +943,10 @@ func TestServer_setQueryMeta(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		m *models.QueryMeta
@@ -1039,7 +979,6 @@ func TestServer_setQueryMeta(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -1047,12 +986,10 @@ func TestServer_setQueryMeta(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.setQueryMeta(tt.args.m)
 		})
@@ -1079,7 +1016,6 @@ func TestServer_blockingRPC(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -1087,12 +1023,10 @@ func TestServer_blockingRPC(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		opts *blockingOptions
@@ -1126,7 +1060,6 @@ func TestServer_blockingRPC(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -1134,12 +1067,10 @@ func TestServer_blockingRPC(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			if err := s.blockingRPC(tt.args.opts); (err != nil) != tt.wantErr {
 				t.Errorf("Server.blockingRPC() error = %v, wantErr %v", err, tt.wantErr)
@@ -1147,3 +1078,411 @@ func TestServer_blockingRPC(t *testing.T) {
 		})
 	}
 }
+
+func Test_canRetryForward(t *testing.T) {
+	tests := []struct {
+		name string
+		info models.RPCInfo
+		err  error
+		want bool
+	}{
+		{"no error", &models.QueryOptions{}, nil, false},
+		{"application error", &models.QueryOptions{}, rpc.ServerError("boom"), false},
+		{"read after send", &models.QueryOptions{}, &connError{err: io.EOF, sent: true}, true},
+		{"write after send", &models.WriteRequest{}, &connError{err: io.EOF, sent: true}, false},
+		{"write before send", &models.WriteRequest{}, &connError{err: io.EOF, sent: false}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canRetryForward(tt.info, tt.err); got != tt.want {
+				t.Errorf("canRetryForward() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_enqueueTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  interface{}
+		want time.Duration
+	}{
+		{"no override", &models.JobRegisterRequest{}, enqueueLimit},
+		{"override", &models.JobRegisterRequest{WriteRequest: models.WriteRequest{EnqueueTimeout: 2 * time.Minute}}, 2 * time.Minute},
+		{"clamped", &models.JobRegisterRequest{WriteRequest: models.WriteRequest{EnqueueTimeout: time.Hour}}, maxEnqueueLimit},
+		{"not a write", &models.GenericRequest{}, enqueueLimit},
+	}
+	s := &Server{logger: ulog.New(ioutil.Discard, ulog.ErrorLevel)}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.enqueueTimeout(tt.msg); got != tt.want {
+				t.Errorf("Server.enqueueTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_readIndexTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		info models.RPCInfo
+		want time.Duration
+	}{
+		{"hold timeout", &models.QueryOptions{ReadConsistency: models.ReadConsistent}, 5 * time.Second},
+		{"max query time", &models.QueryOptions{ReadConsistency: models.ReadConsistent, MaxQueryTime: time.Minute}, time.Minute},
+		{"capped", &models.QueryOptions{ReadConsistency: models.ReadConsistent, MaxQueryTime: time.Hour}, maxQueryTime},
+	}
+	s := &Server{config: &uconf.ServerConfig{RPCHoldTimeout: 5 * time.Second}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.readIndexTimeout(tt.info); got != tt.want {
+				t.Errorf("Server.readIndexTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_loadHint(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		active    int
+		blocking  int64
+		wantLoad  int
+		wantRetry time.Duration
+	}{
+		{"idle", 10, 0, 0, 0, 0},
+		{"below threshold", 10, 10, 0, 10, 0},
+		{"blocking queries left out", 10, 30, 25, 5, 0},
+		{"overloaded", 10, 30, 0, 30, 3 * overloadRetryBase},
+		{"capped", 1, 1000, 0, 1000, maxOverloadRetry},
+		{"disabled", 0, 1000, 0, 1000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{
+				config:          &uconf.ServerConfig{RPCOverloadThreshold: tt.threshold},
+				rpcDrainer:      newRPCDrainer(),
+				blockingQueries: tt.blocking,
+			}
+			for i := 0; i < tt.active; i++ {
+				s.rpcDrainer.startRequest()
+			}
+			load, retry := s.loadHint()
+			if load != tt.wantLoad || retry != tt.wantRetry {
+				t.Errorf("Server.loadHint() = %v, %v, want %v, %v", load, retry, tt.wantLoad, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestServer_handleUdupConn_IdleTimeout(t *testing.T) {
+	s := &Server{
+		config:     &uconf.ServerConfig{RPCIdleTimeout: 50 * time.Millisecond},
+		logger:     ulog.New(ioutil.Discard, ulog.ErrorLevel),
+		rpcServer:  rpc.NewServer(),
+		rpcDrainer: newRPCDrainer(),
+		rpcLimiter: newRPCRateLimiter(nil, false),
+		connPool:   NewPool(ioutil.Discard, time.Minute, 1, nil),
+		shutdownCh: make(chan struct{}),
+	}
+	defer s.connPool.Shutdown()
+	s.rpcServer.Register(&Status{s})
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	doneCh := make(chan struct{})
+	go func() {
+		s.handleUdupConn(context.Background(), c1)
+		close(doneCh)
+	}()
+
+	// Requests keep the connection open past the idle timeout
+	client := rpc.NewClientWithCodec(NewClientCodec(c2))
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		var reply models.ConnPoolResponse
+		if err := client.Call("Status.ConnPool", &models.GenericRequest{}, &reply); err != nil {
+			t.Fatalf("Status.ConnPool error = %v", err)
+		}
+	}
+
+	select {
+	case <-doneCh:
+	case <-time.After(time.Second):
+		t.Fatalf("idle connection wasn't closed")
+	}
+}
+
+func TestServer_queryBlocking(t *testing.T) {
+	state, err := store.NewStateStore(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("store.NewStateStore() error = %v", err)
+	}
+	fsm := &udupFSM{state: state}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = "test"
+	conf.LogOutput = ioutil.Discard
+	logs := raft.NewInmemStore()
+	_, trans := raft.NewInmemTransport("")
+	r, err := raft.NewRaft(conf, fsm, logs, logs, raft.NewInmemSnapshotStore(), trans)
+	if err != nil {
+		t.Fatalf("raft.NewRaft() error = %v", err)
+	}
+	defer r.Shutdown()
+
+	s := &Server{
+		config:     &uconf.ServerConfig{},
+		raft:       r,
+		fsm:        fsm,
+		rpcDrainer: newRPCDrainer(),
+	}
+	if err := state.UpsertJob(5, &models.Job{ID: "a", Type: models.JobTypeSync}); err != nil {
+		t.Fatalf("StateStore.UpsertJob() error = %v", err)
+	}
+
+	// The query only watches the jobs table through tableIndex
+	time.AfterFunc(50*time.Millisecond, func() {
+		state.UpsertJob(6, &models.Job{ID: "b", Type: models.JobTypeSync})
+	})
+	opts := models.QueryOptions{MinQueryIndex: 5, MaxQueryTime: time.Second}
+	var meta models.QueryMeta
+	runs := 0
+	start := time.Now()
+	err = s.queryBlocking(&opts, &meta, "jobs", func(ws memdb.WatchSet, state *store.StateStore) (uint64, error) {
+		runs++
+		return 0, nil
+	})
+	if err != nil {
+		t.Fatalf("Server.queryBlocking() error = %v", err)
+	}
+	if meta.Index != 6 {
+		t.Errorf("Server.queryBlocking() Index = %d, want 6", meta.Index)
+	}
+	if runs != 2 {
+		t.Errorf("Server.queryBlocking() ran the query %d times, want 2", runs)
+	}
+	if elapsed := time.Since(start); elapsed >= opts.MaxQueryTime {
+		t.Errorf("Server.queryBlocking() woke up after %v, not on the change", elapsed)
+	}
+
+	// The index returned by the query wins over the table index
+	err = s.queryBlocking(&models.QueryOptions{}, &meta, "jobs", func(ws memdb.WatchSet, state *store.StateStore) (uint64, error) {
+		return 3, nil
+	})
+	if err != nil || meta.Index != 3 {
+		t.Errorf("Server.queryBlocking() = %v, Index %d, want nil, 3", err, meta.Index)
+	}
+}
+
+func TestServer_blockingRPC_limit(t *testing.T) {
+	state, err := store.NewStateStore(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("store.NewStateStore() error = %v", err)
+	}
+	fsm := &udupFSM{state: state}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = "test"
+	conf.LogOutput = ioutil.Discard
+	logs := raft.NewInmemStore()
+	_, trans := raft.NewInmemTransport("")
+	r, err := raft.NewRaft(conf, fsm, logs, logs, raft.NewInmemSnapshotStore(), trans)
+	if err != nil {
+		t.Fatalf("raft.NewRaft() error = %v", err)
+	}
+	defer r.Shutdown()
+
+	s := &Server{
+		config:     &uconf.ServerConfig{MaxBlockingQueries: 1},
+		raft:       r,
+		fsm:        fsm,
+		rpcDrainer: newRPCDrainer(),
+	}
+	if err := state.UpsertJob(5, &models.Job{ID: "a", Type: models.JobTypeSync}); err != nil {
+		t.Fatalf("StateStore.UpsertJob() error = %v", err)
+	}
+	query := func(minIndex uint64) (models.QueryMeta, time.Duration, error) {
+		opts := models.QueryOptions{MinQueryIndex: minIndex, MaxQueryTime: 5 * time.Second}
+		var meta models.QueryMeta
+		start := time.Now()
+		err := s.queryBlocking(&opts, &meta, "jobs", func(ws memdb.WatchSet, state *store.StateStore) (uint64, error) {
+			return 0, nil
+		})
+		return meta, time.Since(start), err
+	}
+
+	// The first blocking query takes the only slot until the next change
+	doneCh := make(chan models.QueryMeta, 1)
+	go func() {
+		meta, _, _ := query(5)
+		doneCh <- meta
+	}()
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&s.blockingQueries) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the first blocking query didn't take a slot")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	tests := []struct {
+		name        string
+		minIndex    uint64
+		wantLimited bool
+	}{
+		{"blocking query past the limit", 5, true},
+		{"non-blocking query", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, elapsed, err := query(tt.minIndex)
+			if err != nil {
+				t.Fatalf("Server.queryBlocking() error = %v", err)
+			}
+			if meta.BlockingLimited != tt.wantLimited {
+				t.Errorf("Server.queryBlocking() BlockingLimited = %v, want %v", meta.BlockingLimited, tt.wantLimited)
+			}
+			if meta.Index != 5 || elapsed > time.Second {
+				t.Errorf("Server.queryBlocking() = Index %d after %v, want 5 right away", meta.Index, elapsed)
+			}
+		})
+	}
+
+	state.UpsertJob(6, &models.Job{ID: "b", Type: models.JobTypeSync})
+	if meta := <-doneCh; meta.Index != 6 || meta.BlockingLimited {
+		t.Errorf("Server.queryBlocking() = Index %d, BlockingLimited %v, want 6, false", meta.Index, meta.BlockingLimited)
+	}
+	if slots := atomic.LoadInt64(&s.blockingQueries); slots != 0 {
+		t.Errorf("Server.queryBlocking() left %d slots taken", slots)
+	}
+}
+
+func TestServer_Deadline(t *testing.T) {
+	s := &Server{
+		config: &uconf.ServerConfig{Region: "global"},
+		logger: ulog.New(ioutil.Discard, ulog.ErrorLevel),
+	}
+	past := time.Now().Add(-time.Second)
+
+	query := &models.GenericRequest{QueryOptions: models.QueryOptions{Region: "global", Deadline: past}}
+	if done, err := s.forward("Status.Version", query, query, &models.VersionResponse{}); !done || err != context.DeadlineExceeded {
+		t.Errorf("Server.forward() = %v, %v, want true, %v", done, err, context.DeadlineExceeded)
+	}
+
+	write := &models.JobRegisterRequest{WriteRequest: models.WriteRequest{Region: "global", Deadline: past}}
+	if _, err := s.raftApplyFuture(models.JobRegisterRequestType, write); err != context.DeadlineExceeded {
+		t.Errorf("Server.raftApplyFuture() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func Test_instrumentedCodec_Deadline(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	args := &models.GenericRequest{QueryOptions: models.QueryOptions{Deadline: deadline}}
+	codec := newInstrumentedCodec(context.Background(), &inmemCodec{method: "Status.Version", args: args, reply: &models.VersionResponse{}}, nil)
+
+	var req rpc.Request
+	if err := codec.ReadRequestHeader(&req); err != nil {
+		t.Fatalf("instrumentedCodec.ReadRequestHeader() error = %v", err)
+	}
+	var body models.GenericRequest
+	if err := codec.ReadRequestBody(&body); err != nil {
+		t.Fatalf("instrumentedCodec.ReadRequestBody() error = %v", err)
+	}
+	ctx := body.Context()
+	if got, ok := ctx.Deadline(); !ok || !got.Equal(deadline) {
+		t.Errorf("request context deadline = %v, %v, want %v", got, ok, deadline)
+	}
+
+	// The context is released once the reply is written
+	codec.WriteResponse(&rpc.Response{}, &models.VersionResponse{})
+	if ctx.Err() == nil {
+		t.Errorf("request context still live after the reply was written")
+	}
+}
+
+func TestServer_regionTimeout(t *testing.T) {
+	s := &Server{
+		config:         &uconf.ServerConfig{RPCHoldTimeout: 5 * time.Second},
+		regionTimeouts: map[string]time.Duration{"near": 100 * time.Millisecond},
+	}
+	tests := []struct {
+		name   string
+		region string
+		info   models.RPCInfo
+		want   time.Duration
+	}{
+		{"configured", "near", &models.QueryOptions{}, 100 * time.Millisecond},
+		{"default", "far", &models.WriteRequest{}, 5 * time.Second},
+		{"blocking", "near", &models.QueryOptions{MinQueryIndex: 1, MaxQueryTime: 16 * time.Second},
+			100*time.Millisecond + 17*time.Second},
+		{"blocking capped", "near", &models.QueryOptions{MinQueryIndex: 1, MaxQueryTime: time.Hour},
+			100*time.Millisecond + maxQueryTime + maxQueryTime/jitterFraction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.regionTimeout(tt.region, tt.info); got != tt.want {
+				t.Errorf("Server.regionTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_tooStale(t *testing.T) {
+	// A follower that never heard from a leader
+	conf := raft.DefaultConfig()
+	conf.LocalID = "server-b"
+	conf.LogOutput = ioutil.Discard
+	logs := raft.NewInmemStore()
+	_, trans := raft.NewInmemTransport("")
+	follower, err := raft.NewRaft(conf, &udupFSM{}, logs, logs, raft.NewInmemSnapshotStore(), trans)
+	if err != nil {
+		t.Fatalf("raft.NewRaft() error = %v", err)
+	}
+	defer follower.Shutdown()
+
+	leader := testRaftServer(t)
+	defer leader.raft.Shutdown()
+
+	tests := []struct {
+		name string
+		raft *raft.Raft
+		info models.RPCInfo
+		want bool
+	}{
+		{"unbounded", follower, &models.QueryOptions{AllowStale: true}, false},
+		{"follower out of touch", follower, &models.QueryOptions{AllowStale: true, MaxStaleness: time.Second}, true},
+		{"leader", leader.raft, &models.QueryOptions{AllowStale: true, MaxStaleness: time.Second}, false},
+		{"write", follower, &models.WriteRequest{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{raft: tt.raft}
+			if got := s.tooStale(tt.info); got != tt.want {
+				t.Errorf("Server.tooStale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_codeErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want models.RPCErrorCode
+	}{
+		{"deadline", context.DeadlineExceeded.Error(), models.ErrCodeDeadlineExceeded},
+		{"cancelled", context.Canceled.Error(), models.ErrCodeQueryCancelled},
+		{"already coded", models.ErrNoLeader.Error(), models.ErrCodeNoLeader},
+		{"uncoded", "job not found", models.ErrCodeUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := codeErrorMessage(tt.msg)
+			if code := models.ErrorCode(rpc.ServerError(got)); code != tt.want {
+				t.Errorf("codeErrorMessage(%q) = %q with code %v, want %v", tt.msg, got, code, tt.want)
+			}
+		})
+	}
+}
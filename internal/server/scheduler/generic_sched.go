@@ -175,7 +175,8 @@ func (s *GenericScheduler) process() (bool, error) {
 	numTaskGroups := 0
 	if s.job != nil {
 		numTaskGroups = len(s.job.Tasks)
-		if s.job.Status == models.JobStatusDead || s.job.Status == models.JobStatusComplete {
+		if s.job.Status == models.JobStatusDead || s.job.Status == models.JobStatusComplete ||
+			s.job.Status == models.JobStatusFailed || s.job.Status == models.JobStatusCancelled {
 			return true, nil
 		}
 	}
@@ -403,6 +404,14 @@ func (s *GenericScheduler) computePlacements(place []allocTuple) error {
 		s.ctx.Metrics().NodesAvailable = byDC
 
 		if preferredNode != nil {
+			// The allocations of a paused job, such as one paused by the
+			// maintenance mode before it was placed, don't start until it
+			// is resumed
+			desiredStatus := models.AllocDesiredStatusRun
+			if s.job.Status == models.JobStatusPause {
+				desiredStatus = models.AllocDesiredStatusPause
+			}
+
 			// Create an allocation for this
 			alloc := &models.Allocation{
 				ID:            models.GenerateUUID(),
@@ -412,7 +421,7 @@ func (s *GenericScheduler) computePlacements(place []allocTuple) error {
 				Task:          missing.Task.Type,
 				Metrics:       s.ctx.Metrics(),
 				NodeID:        preferredNode.ID,
-				DesiredStatus: models.AllocDesiredStatusRun,
+				DesiredStatus: desiredStatus,
 				ClientStatus:  models.AllocClientStatusPending,
 			}
 
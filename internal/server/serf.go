@@ -128,7 +128,7 @@ func (s *Server) maybeBootstrap() {
 		if !valid {
 			continue
 		}
-		if p.Region != s.config.Region {
+		if p.Region != s.config.Region || p.NonVoter {
 			continue
 		}
 		if p.Expect != 0 && p.Expect != int(atomic.LoadInt32(&s.config.BootstrapExpect)) {
@@ -9,7 +9,6 @@ package server
 import (
 	"net"
 	"net/rpc"
-	"sync"
 	"testing"
 	"time"
 	uconf "github.com/actiontech/dtle/internal/config"
@@ -42,7 +41,6 @@ func TestServer_serfEventHandler(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -50,12 +48,10 @@ func TestServer_serfEventHandler(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -84,7 +80,6 @@ func TestServer_serfEventHandler(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -92,12 +87,10 @@ func TestServer_serfEventHandler(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.serfEventHandler()
 		})
@@ -124,7 +117,6 @@ func TestServer_nodeJoin(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -132,12 +124,10 @@ func TestServer_nodeJoin(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		me serf.MemberEvent
@@ -170,7 +160,6 @@ func TestServer_nodeJoin(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -178,12 +167,10 @@ func TestServer_nodeJoin(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.nodeJoin(tt.args.me)
 		})
@@ -210,7 +197,6 @@ func TestServer_maybeBootstrap(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -218,12 +204,10 @@ func TestServer_maybeBootstrap(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	tests := []struct {
 		name   string
@@ -252,7 +236,6 @@ func TestServer_maybeBootstrap(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -260,12 +243,10 @@ func TestServer_maybeBootstrap(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.maybeBootstrap()
 		})
@@ -292,7 +273,6 @@ func TestServer_nodeFailed(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -300,12 +280,10 @@ func TestServer_nodeFailed(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		me serf.MemberEvent
@@ -338,7 +316,6 @@ func TestServer_nodeFailed(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -346,12 +323,10 @@ func TestServer_nodeFailed(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.nodeFailed(tt.args.me)
 		})
@@ -378,7 +353,6 @@ func TestServer_localMemberEvent(t *testing.T) {
 		rpcAdvertise        net.Addr
 		peers               map[string][]*serverParts
 		localPeers          map[raft.ServerAddress]*serverParts
-		peerLock            sync.RWMutex
 		serf                *serf.Serf
 		reconcileCh         chan serf.Member
 		eventCh             chan serf.Event
@@ -386,12 +360,10 @@ func TestServer_localMemberEvent(t *testing.T) {
 		blockedEvals        *BlockedEvals
 		planQueue           *PlanQueue
 		heartbeatTimers     map[string]*time.Timer
-		heartbeatTimersLock sync.Mutex
 		workers             []*Worker
 		left                bool
 		shutdown            bool
 		shutdownCh          chan struct{}
-		shutdownLock        sync.Mutex
 	}
 	type args struct {
 		me serf.MemberEvent
@@ -424,7 +396,6 @@ func TestServer_localMemberEvent(t *testing.T) {
 				rpcAdvertise:        tt.fields.rpcAdvertise,
 				peers:               tt.fields.peers,
 				localPeers:          tt.fields.localPeers,
-				peerLock:            tt.fields.peerLock,
 				serf:                tt.fields.serf,
 				reconcileCh:         tt.fields.reconcileCh,
 				eventCh:             tt.fields.eventCh,
@@ -432,12 +403,10 @@ func TestServer_localMemberEvent(t *testing.T) {
 				blockedEvals:        tt.fields.blockedEvals,
 				planQueue:           tt.fields.planQueue,
 				heartbeatTimers:     tt.fields.heartbeatTimers,
-				heartbeatTimersLock: tt.fields.heartbeatTimersLock,
 				workers:             tt.fields.workers,
 				left:                tt.fields.left,
 				shutdown:            tt.fields.shutdown,
 				shutdownCh:          tt.fields.shutdownCh,
-				shutdownLock:        tt.fields.shutdownLock,
 			}
 			s.localMemberEvent(tt.args.me)
 		})
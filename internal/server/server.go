@@ -7,6 +7,8 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -30,6 +32,7 @@ import (
 	"github.com/actiontech/dtle/internal"
 	uconf "github.com/actiontech/dtle/internal/config"
 	ulog "github.com/actiontech/dtle/internal/logger"
+	"github.com/actiontech/dtle/internal/models"
 	"github.com/actiontech/dtle/internal/server/store"
 )
 
@@ -62,6 +65,10 @@ type Server struct {
 	// Connection pool to other Udup servers
 	connPool *ConnPool
 
+	// tlsWrap is used to wrap outbound connections with TLS. It is nil
+	// when TLS is disabled.
+	tlsWrap uconf.TLSWrapper
+
 	// Endpoints holds our RPC endpoints
 	endpoints endpoints
 
@@ -79,10 +86,24 @@ type Server struct {
 	store     *store.Store
 	candidate *leadership.Candidate
 
-	// rpcListener is used to listen for incoming connections
-	rpcListener  net.Listener
-	rpcServer    *rpc.Server
-	rpcAdvertise net.Addr
+	// rpcListener is used to listen for incoming connections, on the
+	// advertised address. extraRPCListeners accept connections on the
+	// additional addresses of RPCExtraAddrs. rpcMethodFilters holds the
+	// methods allowed on the listeners that don't serve every method.
+	rpcListener       net.Listener
+	extraRPCListeners []net.Listener
+	rpcMethodFilters  map[net.Listener]*rpcMethodFilter
+	connLimiter       *connLimiter
+	rpcDrainer        *rpcDrainer
+	rpcLimiter        *rpcRateLimiter
+	rpcDispatcher     *rpcDispatcher
+	rpcServer         *rpc.Server
+	rpcAdvertise      net.Addr
+
+	// regionTimeouts bounds the RPCs forwarded to other regions, it is
+	// replaced on reload
+	regionTimeouts     map[string]time.Duration
+	regionTimeoutsLock sync.RWMutex
 
 	// peers is used to track the known Udup servers. This is
 	// used for region forwarding and clustering.
@@ -90,6 +111,9 @@ type Server struct {
 	localPeers map[raft.ServerAddress]*serverParts
 	peerLock   sync.RWMutex
 
+	// peerHealth tracks the remote servers that recently failed RPCs
+	peerHealth *peerHealth
+
 	// serf is the Serf cluster containing only Udup
 	// servers. This is used for multi-region federation
 	// and automatic clustering within regions.
@@ -123,6 +147,40 @@ type Server struct {
 	// Worker used for processing
 	workers []*Worker
 
+	// snapshotInProgress is set while an operator requested snapshot is
+	// being taken
+	snapshotInProgress int32
+
+	// applyFailures counts the Raft applies that failed in a row, for the
+	// leader to step down once it stops making progress
+	applyFailures int32
+
+	// warmStandby is the digest of the connections pooled by the leader,
+	// opened once this server takes over
+	warmStandby warmStandby
+
+	// blockingQueries counts the blocking queries being served, which
+	// can't exceed MaxBlockingQueries. Mostly waiting for a change, they
+	// are left out of the load reported to clients.
+	blockingQueries int64
+	// watches tracks the blocking queries being served, for Status.Watches
+	watches watchTracker
+
+	// startTime is when the server was created, for its uptime
+	startTime time.Time
+
+	// jobMetrics are the metrics the clients report for their tasks,
+	// served by the leader
+	jobMetrics *jobMetrics
+
+	// verifications are the comparisons of the tables of the jobs the
+	// leader runs
+	verifications *jobVerifications
+
+	// notifier POSTs the job status and leadership changes to the
+	// webhooks, nil without any
+	notifier *notifier
+
 	left         bool
 	shutdown     bool
 	shutdownCh   chan struct{}
@@ -131,18 +189,28 @@ type Server struct {
 
 // Holds the RPC endpoints
 type endpoints struct {
-	Status *Status
-	Node   *Node
-	Job    *Job
-	Order  *Order
-	Eval   *Eval
-	Plan   *Plan
-	Alloc  *Alloc
+	Status   *Status
+	Node     *Node
+	Job      *Job
+	Order    *Order
+	Eval     *Eval
+	Plan     *Plan
+	Alloc    *Alloc
+	Operator *Operator
+	Event    *Event
 }
 
 // NewServer is used to construct a new Udup server from the
 // configuration, potentially returning an error
 func NewServer(config *uconf.ServerConfig, logger *ulog.Logger) (*Server, error) {
+	// A non-voter can't count towards the servers bootstrapping a cluster
+	if config.NonVoter && (config.Bootstrap || atomic.LoadInt32(&config.BootstrapExpect) != 0) {
+		return nil, fmt.Errorf("a non-voting server can't bootstrap the cluster")
+	}
+	if w := config.RPCMaxStreamWindow; w != 0 && w < minStreamWindow {
+		return nil, fmt.Errorf("RPC max stream window %d is below the minimum of %d bytes", w, minStreamWindow)
+	}
+
 	// Create an eval broker
 	evalBroker, err := NewEvalBroker(config.EvalNackTimeout, config.EvalDeliveryLimit)
 	if err != nil {
@@ -158,21 +226,44 @@ func NewServer(config *uconf.ServerConfig, logger *ulog.Logger) (*Server, error)
 		return nil, err
 	}
 
+	// Configure TLS for outgoing connections
+	tlsWrap, err := config.TLSConfig.OutgoingTLSWrapper()
+	if err != nil {
+		return nil, err
+	}
+
 	// Create the server
 	s := &Server{
-		config:       config,
-		connPool:     NewPool(config.LogOutput, serverRPCCache, serverMaxStreams),
-		logger:       logger,
-		rpcServer:    rpc.NewServer(),
-		peers:        make(map[string][]*serverParts),
-		localPeers:   make(map[raft.ServerAddress]*serverParts),
-		reconcileCh:  make(chan serf.Member, 32),
-		eventCh:      make(chan serf.Event, 256),
-		evalBroker:   evalBroker,
-		blockedEvals: blockedEvals,
-		planQueue:    planQueue,
-		shutdownCh:   make(chan struct{}),
-	}
+		config:        config,
+		connPool:      NewPool(config.LogOutput, serverRPCCache, serverMaxStreams, tlsWrap),
+		tlsWrap:       tlsWrap,
+		logger:        logger,
+		rpcServer:     rpc.NewServer(),
+		connLimiter:   newConnLimiter(config.RPCMaxConns, config.RPCMaxConnsPerIP),
+		peerHealth:    newPeerHealth(),
+		rpcDrainer:    newRPCDrainer(),
+		rpcLimiter:    newRPCRateLimiter(config.RPCRateLimits, config.RPCRateLimitPerClient),
+		rpcDispatcher: newRPCDispatcher(config.RPCMaxConcurrent, config.RPCDispatchQueue),
+		peers:         make(map[string][]*serverParts),
+		localPeers:    make(map[raft.ServerAddress]*serverParts),
+		reconcileCh:   make(chan serf.Member, 32),
+		eventCh:       make(chan serf.Event, 256),
+		evalBroker:    evalBroker,
+		blockedEvals:  blockedEvals,
+		planQueue:     planQueue,
+		shutdownCh:    make(chan struct{}),
+		startTime:     time.Now(),
+		jobMetrics:    newJobMetrics(),
+		verifications: newJobVerifications(),
+		notifier:      newNotifier(config.Webhooks, logger),
+	}
+
+	// Compress cross-region forwards above the configured size
+	s.connPool.SetCompressionThreshold(config.RPCCompressionThreshold)
+	s.connPool.SetKeepAlive(config.RPCPingInterval, config.RPCMaxMissedPings)
+	s.connPool.SetStreamWindow(config.RPCMaxStreamWindow)
+	s.connPool.SetCircuitBreaker(config.RPCCircuitFailureThreshold, config.RPCCircuitFailureWindow, config.RPCCircuitCooldown)
+	s.regionTimeouts = config.RPCRegionTimeouts
 
 	// Initialize the RPC layer
 	if err := s.setupRPC(); err != nil {
@@ -236,9 +327,20 @@ func NewServer(config *uconf.ServerConfig, logger *ulog.Logger) (*Server, error)
 	// Emit metrics for the blocked eval tracker.
 	go blockedEvals.EmitStats(time.Second, s.shutdownCh)
 
+	// Emit metrics for the RPC connection pool
+	go s.connPool.EmitStats(time.Second, s.shutdownCh)
+
 	// Emit metrics
 	go s.heartbeatStats()
 
+	// Keep track of the connections pooled by the leader
+	go s.monitorWarmStandby()
+
+	// Notify the webhooks
+	if s.notifier != nil {
+		s.notifier.run(s.shutdownCh)
+	}
+
 	// Done
 	return s, nil
 }
@@ -256,6 +358,18 @@ func (s *Server) Shutdown() error {
 	s.shutdown = true
 	close(s.shutdownCh)
 
+	// Stop accepting connections and give the in-flight RPCs a chance to
+	// complete while Raft is still around to serve them
+	if s.rpcListener != nil {
+		s.rpcListener.Close()
+	}
+	for _, list := range s.extraRPCListeners {
+		list.Close()
+	}
+	if !s.rpcDrainer.drain(s.config.RPCDrainTimeout) {
+		s.logger.Warnf("manager: RPCs still in flight after %v, closing their connections", s.config.RPCDrainTimeout)
+	}
+
 	if s.serf != nil {
 		s.serf.Shutdown()
 	}
@@ -272,11 +386,6 @@ func (s *Server) Shutdown() error {
 		}
 	}
 
-	// Shutdown the RPC listener
-	if s.rpcListener != nil {
-		s.rpcListener.Close()
-	}
-
 	// Close the connection pool
 	s.connPool.Shutdown()
 
@@ -298,6 +407,22 @@ func (s *Server) IsShutdown() bool {
 	}
 }
 
+// Reload applies the settings of config that can change while the server
+// is running. Currently these are the RPC rate limits.
+func (s *Server) Reload(config *uconf.ServerConfig) error {
+	if config == nil {
+		return fmt.Errorf("no config to reload")
+	}
+	s.rpcLimiter.setLimits(config.RPCRateLimits, config.RPCRateLimitPerClient)
+	s.logger.Printf("manager: reloaded RPC rate limits (%d methods)", len(config.RPCRateLimits))
+
+	s.regionTimeoutsLock.Lock()
+	s.regionTimeouts = config.RPCRegionTimeouts
+	s.regionTimeoutsLock.Unlock()
+	s.logger.Printf("manager: reloaded RPC timeouts (%d regions)", len(config.RPCRegionTimeouts))
+	return nil
+}
+
 // Leave is used to prepare for a graceful shutdown of the server
 func (s *Server) Leave() error {
 	s.logger.Printf("manager: server starting leave")
@@ -392,6 +517,8 @@ func (s *Server) setupRPC() error {
 	s.endpoints.Node = &Node{srv: s}
 	s.endpoints.Plan = &Plan{s}
 	s.endpoints.Status = &Status{s}
+	s.endpoints.Operator = &Operator{s}
+	s.endpoints.Event = &Event{s}
 
 	// Register the handlers
 	s.rpcServer.Register(s.endpoints.Alloc)
@@ -401,12 +528,37 @@ func (s *Server) setupRPC() error {
 	s.rpcServer.Register(s.endpoints.Node)
 	s.rpcServer.Register(s.endpoints.Plan)
 	s.rpcServer.Register(s.endpoints.Status)
+	s.rpcServer.Register(s.endpoints.Operator)
 
-	list, err := net.ListenTCP("tcp", s.config.RPCAddr)
+	// Event only has streaming methods, served by handleStreamingConn
+
+	filters, err := listenerMethodFilters(append([]*net.TCPAddr{s.config.RPCAddr}, s.config.RPCExtraAddrs...),
+		s.config.RPCAllowedMethods, s.config.RPCDeniedMethods)
+	if err != nil {
+		return err
+	}
+	s.rpcMethodFilters = make(map[net.Listener]*rpcMethodFilter)
+
+	list, err := s.listenRPC(s.config.RPCAddr)
 	if err != nil {
 		return err
 	}
 	s.rpcListener = list
+	if f := filters[s.config.RPCAddr.String()]; f != nil {
+		s.rpcMethodFilters[list] = f
+	}
+
+	for _, addr := range s.config.RPCExtraAddrs {
+		extra, err := s.listenRPC(addr)
+		if err != nil {
+			// Shutdown closes the listeners opened so far
+			return fmt.Errorf("failed to listen on %v: %v", addr, err)
+		}
+		s.extraRPCListeners = append(s.extraRPCListeners, extra)
+		if f := filters[addr.String()]; f != nil {
+			s.rpcMethodFilters[extra] = f
+		}
+	}
 
 	if s.config.RPCAdvertise != nil {
 		s.rpcAdvertise = s.config.RPCAdvertise
@@ -425,10 +577,30 @@ func (s *Server) setupRPC() error {
 		return fmt.Errorf("RPC advertise address is not advertisable: %v", addr)
 	}
 
-	s.raftLayer = NewRaftLayer(s.rpcAdvertise)
+	s.raftLayer = NewRaftLayer(s.rpcAdvertise, s.config.Region, s.tlsWrap)
 	return nil
 }
 
+// listenRPC opens an RPC listener on addr
+func (s *Server) listenRPC(addr *net.TCPAddr) (net.Listener, error) {
+	list, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Require mutual TLS on every incoming connection if enabled. The
+	// handshake is completed in handleConn before the RPC byte is read.
+	if s.config.TLSConfig != nil && s.config.TLSConfig.EnableRPC != nil && *s.config.TLSConfig.EnableRPC {
+		tlsConf, err := s.config.TLSConfig.IncomingTLSConfig()
+		if err != nil {
+			list.Close()
+			return nil, err
+		}
+		return tls.NewListener(list, tlsConf), nil
+	}
+	return list, nil
+}
+
 // setupRaft is used to setup and initialize Raft
 func (s *Server) setupRaft() error {
 	// If we have an unclean exit then attempt to close the Raft store.
@@ -446,6 +618,7 @@ func (s *Server) setupRaft() error {
 	if err != nil {
 		return err
 	}
+	s.fsm.schemaVersion = s.raftSchemaVersion
 
 	// Create a transport layer
 	trans := raft.NewNetworkTransport(s.raftLayer, 3, s.config.RaftTimeout,
@@ -586,6 +759,15 @@ func (s *Server) setupSerf(conf *serf.Config, ch chan serf.Event, path string) (
 	conf.Tags["dc"] = s.config.Datacenter
 	conf.Tags["build"] = s.config.Build
 	conf.Tags["port"] = fmt.Sprintf("%d", s.rpcAdvertise.(*net.TCPAddr).Port)
+	conf.Tags["compress"] = "1"
+	conf.Tags["checksum"] = "1"
+	conf.Tags["schema"] = fmt.Sprintf("%d", models.SchemaVersion)
+	if s.config.NonVoter {
+		conf.Tags["nonvoter"] = "1"
+	}
+	if s.config.RPCWeight > 0 {
+		conf.Tags["weight"] = fmt.Sprintf("%d", s.config.RPCWeight)
+	}
 	if s.config.Bootstrap {
 		conf.Tags["bootstrap"] = "1"
 	}
@@ -740,7 +922,7 @@ func (s *Server) RPC(method string, args interface{}, reply interface{}) error {
 		args:   args,
 		reply:  reply,
 	}
-	if err := s.rpcServer.ServeRequest(codec); err != nil {
+	if err := s.rpcServer.ServeRequest(newInstrumentedCodec(context.Background(), codec, nil)); err != nil {
 		return err
 	}
 	return codec.err
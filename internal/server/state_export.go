@@ -0,0 +1,222 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/armon/go-metrics"
+	memdb "github.com/hashicorp/go-memdb"
+	"github.com/hashicorp/go-msgpack/codec"
+
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+// StateExport streams the state store to enc as a state export, described
+// by StateExportFrame. It is served on rpcStreaming connections rather than
+// through net/rpc. The state is exported from a single snapshot, so it is
+// consistent and the writes go on while it is streamed. Unless args allow
+// a stale read, a follower first catches up with the leader.
+func (op *Operator) StateExport(ctx context.Context, args *models.StateExportRequest, enc *codec.Encoder) error {
+	if args.Region != "" && args.Region != op.srv.config.Region {
+		return fmt.Errorf("state exports are only served for region %q", op.srv.config.Region)
+	}
+	if err := op.srv.catchUpForRead(&args.QueryOptions); err != nil {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "operator", "state_export"}, time.Now())
+
+	snap, err := op.srv.fsm.State().Snapshot()
+	if err != nil {
+		return err
+	}
+	index, err := snap.LatestIndex()
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(&models.StateExportFrame{Version: models.StateExportVersion, Index: index,
+		Region: op.srv.config.Region}); err != nil {
+		return err
+	}
+
+	var sent int
+	for _, table := range models.StateExportTables {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		iter, err := stateExportIterator(&snap.StateStore, table)
+		if err != nil {
+			return err
+		}
+		l := newListStreamer(enc)
+		l.frame = func(count int) interface{} { return &models.StateExportFrame{Table: table, Count: count} }
+		for raw := iter.Next(); raw != nil; raw = iter.Next() {
+			if err := l.add(raw); err != nil {
+				return err
+			}
+		}
+		if err := l.flush(); err != nil {
+			return err
+		}
+		sent += l.sent
+	}
+	if err := enc.Encode(&models.StateExportFrame{Done: true}); err != nil {
+		return err
+	}
+
+	op.srv.logger.Printf("[INFO] udup.operator: Exported %d items of the state at index %d", sent, index)
+	metrics.IncrCounter([]string{"server", "operator", "state_export_items"}, float32(sent))
+	return nil
+}
+
+// stateExportIterator iterates over the items of table in state
+func stateExportIterator(state *store.StateStore, table string) (memdb.ResultIterator, error) {
+	ws := memdb.NewWatchSet()
+	switch table {
+	case "nodes":
+		return state.Nodes(ws)
+	case "jobs":
+		return state.Jobs(ws)
+	case "orders":
+		return state.Orders(ws)
+	case "evals":
+		return state.Evals(ws)
+	case "allocs":
+		return state.Allocs(ws)
+	}
+	return nil, fmt.Errorf("unknown table %q", table)
+}
+
+// StateExport writes a state export of the local state store to w, like
+// Operator.StateExport streams it
+func (s *Server) StateExport(ctx context.Context, args *models.StateExportRequest, w io.Writer) error {
+	return s.endpoints.Operator.StateExport(ctx, args, codec.NewEncoder(w, models.HashiMsgpackHandle))
+}
+
+// StateImport restores the jobs and orders of a state export into a
+// cluster that has none. The import is applied in chunks bound by
+// MaxRaftEntrySize, each a single Raft entry, the FSM refusing the first
+// one if the cluster has jobs or orders and the others if they overwrite
+// any, so that an import running alongside other writes never clobbers
+// them. A failed import leaves the chunks applied before. The jobs keep
+// their status, and those that were pending or running are evaluated again
+// in the same entry to be scheduled on the nodes of the cluster. The
+// nodes, evaluations and allocations of the export describe the cluster it
+// was taken from, so they are not imported. The passwords of the jobs are
+// imported as they were exported, sealed with the keyring of that cluster
+// if it had one.
+func (op *Operator) StateImport(args *models.StateImportRequest, reply *models.StateImportResponse) error {
+	if done, err := op.srv.forward("Operator.StateImport", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"server", "operator", "state_import"}, time.Now())
+
+	for _, order := range args.Orders {
+		if order == nil || order.ID == "" {
+			return fmt.Errorf("missing order ID")
+		}
+	}
+	for _, job := range args.Jobs {
+		if job == nil || job.ID == "" {
+			return fmt.Errorf("missing job ID")
+		}
+		job.Canonicalize()
+	}
+	if len(args.Jobs) == 0 && len(args.Orders) == 0 {
+		return fmt.Errorf("nothing to import")
+	}
+
+	chunks, err := stateImportChunks(args, op.srv.stateImportChunkSize())
+	if err != nil {
+		return err
+	}
+	for i, chunk := range chunks {
+		chunk.First = i == 0
+		chunk.WriteRequest = args.WriteRequest
+		for _, job := range chunk.Jobs {
+			switch job.Status {
+			case models.JobStatusPending, models.JobStatusRunning, "":
+				chunk.Evals = append(chunk.Evals, &models.Evaluation{
+					ID:          models.GenerateUUID(),
+					Type:        job.Type,
+					TriggeredBy: models.EvalTriggerJobRegister,
+					JobID:       job.ID,
+					Status:      models.EvalStatusPending,
+				})
+			}
+		}
+		resp, index, err := op.srv.raftApply(models.StateImportRequestType, chunk)
+		if err == nil {
+			err, _ = resp.(error)
+		}
+		if err != nil {
+			op.srv.logger.Errorf("server.operator: StateImport failed after %d of %d chunks: %v", i, len(chunks), err)
+			return err
+		}
+		reply.Jobs += len(chunk.Jobs)
+		reply.Orders += len(chunk.Orders)
+		reply.Evals += len(chunk.Evals)
+		reply.Chunks++
+		reply.Index = index
+	}
+
+	op.srv.logger.Printf("[INFO] udup.operator: Imported %d jobs and %d orders in %d chunks, scheduling %d of the jobs",
+		reply.Jobs, reply.Orders, reply.Chunks, reply.Evals)
+	return nil
+}
+
+// stateImportChunkSize returns the size in bytes of the chunks a state
+// import is applied in, well below the largest Raft entry
+func (s *Server) stateImportChunkSize() int {
+	size := raftWarnSize
+	if limit := s.config.MaxRaftEntrySize; limit > 0 && limit/2 < size {
+		size = limit / 2
+	}
+	return size
+}
+
+// stateImportChunks splits the orders and the jobs of args in chunks of
+// about size bytes, the orders first for the jobs to find them. An item
+// larger than size is a chunk of its own.
+func stateImportChunks(args *models.StateImportRequest, size int) ([]*models.StateImportApplyRequest, error) {
+	var chunks []*models.StateImportApplyRequest
+	chunk, used := &models.StateImportApplyRequest{}, 0
+	add := func(item interface{}) (*models.StateImportApplyRequest, error) {
+		buf, err := models.Encode(models.StateImportRequestType, item)
+		if err != nil {
+			return nil, err
+		}
+		if used > 0 && used+len(buf) > size {
+			chunks = append(chunks, chunk)
+			chunk, used = &models.StateImportApplyRequest{}, 0
+		}
+		used += len(buf)
+		return chunk, nil
+	}
+	for _, order := range args.Orders {
+		c, err := add(order)
+		if err != nil {
+			return nil, err
+		}
+		c.Orders = append(c.Orders, order)
+	}
+	for _, job := range args.Jobs {
+		c, err := add(job)
+		if err != nil {
+			return nil, err
+		}
+		c.Jobs = append(c.Jobs, job)
+	}
+	if used > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	memdb "github.com/hashicorp/go-memdb"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+func testStateServer(t *testing.T) *Server {
+	s := testRaftServer(t)
+	evalBroker, err := NewEvalBroker(time.Minute, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.fsm.evalBroker = evalBroker
+	s.fsm.blockedEvals = NewBlockedEvals(evalBroker)
+	s.fsm.logger = s.logger
+	s.endpoints.Operator = &Operator{s}
+	return s
+}
+
+func TestOperator_StateExport_StateImport(t *testing.T) {
+	s1 := testStateServer(t)
+	defer s1.raft.Shutdown()
+	state := s1.fsm.State()
+	if err := state.UpsertNode(1, &models.Node{ID: models.GenerateUUID(), Status: models.NodeStatusReady}); err != nil {
+		t.Fatalf("StateStore.UpsertNode() error = %v", err)
+	}
+	if err := state.UpsertOrder(2, &models.Order{ID: "o1"}); err != nil {
+		t.Fatalf("StateStore.UpsertOrder() error = %v", err)
+	}
+	for i, id := range []string{"running", "failed"} {
+		if err := state.UpsertJob(uint64(10+i), &models.Job{ID: id, Type: models.JobTypeSync}); err != nil {
+			t.Fatalf("StateStore.UpsertJob() error = %v", err)
+		}
+	}
+	if err := state.UpdateJobStatus(20, "running", models.JobStatusRunning); err != nil {
+		t.Fatalf("StateStore.UpdateJobStatus() error = %v", err)
+	}
+	if err := state.UpdateJobStatus(21, "failed", models.JobStatusFailed); err != nil {
+		t.Fatalf("StateStore.UpdateJobStatus() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	args := &models.StateExportRequest{}
+	if err := s1.StateExport(context.Background(), args, &buf); err != nil {
+		t.Fatalf("Server.StateExport() error = %v", err)
+	}
+	export, err := models.ReadStateExport(&buf)
+	if err != nil {
+		t.Fatalf("models.ReadStateExport() error = %v", err)
+	}
+	if export.Index != 21 || export.Region != "global" || len(export.Nodes) != 1 || len(export.Jobs) != 2 ||
+		len(export.Orders) != 1 || len(export.Evals) != 0 || len(export.Allocs) != 0 {
+		t.Fatalf("models.ReadStateExport() = %+v", export)
+	}
+
+	s2 := testStateServer(t)
+	defer s2.raft.Shutdown()
+	req := &models.StateImportRequest{Jobs: export.Jobs, Orders: export.Orders,
+		WriteRequest: models.WriteRequest{Region: "global"}}
+	var reply models.StateImportResponse
+	if err := s2.endpoints.Operator.StateImport(req, &reply); err != nil {
+		t.Fatalf("Operator.StateImport() error = %v", err)
+	}
+	if reply.Jobs != 2 || reply.Orders != 1 || reply.Evals != 1 || reply.Chunks != 1 || reply.Index == 0 {
+		t.Errorf("Operator.StateImport() reply = %+v", reply)
+	}
+
+	// The running job is scheduled again, the failed one stays failed
+	ws := memdb.NewWatchSet()
+	imported := s2.fsm.State()
+	if order, _ := imported.OrderByID(ws, "o1"); order == nil {
+		t.Errorf("order o1 wasn't imported")
+	}
+	if job, _ := imported.JobByID(ws, "failed"); job == nil || job.Status != models.JobStatusFailed {
+		t.Errorf("job failed = %+v, want failed", job)
+	}
+	if job, _ := imported.JobByID(ws, "running"); job == nil || job.Status != models.JobStatusPending {
+		t.Errorf("job running = %+v, want pending", job)
+	}
+	if evals, _ := imported.EvalsByJob(ws, "running"); len(evals) != 1 || evals[0].TriggeredBy != models.EvalTriggerJobRegister {
+		t.Errorf("evals of running = %v, want one triggered by %v", evals, models.EvalTriggerJobRegister)
+	}
+
+	// Only a cluster without jobs takes an import, and the chunks after the
+	// first never overwrite a job
+	if err := s2.endpoints.Operator.StateImport(req, &reply); err == nil {
+		t.Errorf("Operator.StateImport() into a cluster with jobs = nil error")
+	}
+	chunk := &models.StateImportApplyRequest{Jobs: []*models.Job{{ID: "failed", Type: models.JobTypeSync}},
+		WriteRequest: models.WriteRequest{Region: "global"}}
+	if resp, _, err := s2.raftApply(models.StateImportRequestType, chunk); err != nil {
+		t.Fatalf("Server.raftApply() error = %v", err)
+	} else if err, _ := resp.(error); err == nil {
+		t.Errorf("applying a chunk overwriting a job error = nil")
+	}
+	if job, _ := imported.JobByID(ws, "failed"); job == nil || job.Status != models.JobStatusFailed {
+		t.Errorf("job failed after a chunk overwriting it = %+v, want failed", job)
+	}
+}
+
+func TestStateImportChunks(t *testing.T) {
+	args := &models.StateImportRequest{
+		Jobs:   []*models.Job{{ID: "j1"}, {ID: "j2"}},
+		Orders: []*models.Order{{ID: "o1"}},
+	}
+	chunks, err := stateImportChunks(args, 1024)
+	if err != nil {
+		t.Fatalf("stateImportChunks() error = %v", err)
+	}
+	if len(chunks) != 1 || len(chunks[0].Jobs) != 2 || len(chunks[0].Orders) != 1 {
+		t.Errorf("stateImportChunks() = %+v, want a single chunk", chunks)
+	}
+
+	// Items larger than the chunks are chunks of their own, the orders
+	// first
+	if chunks, err = stateImportChunks(args, 1); err != nil {
+		t.Fatalf("stateImportChunks() error = %v", err)
+	}
+	if len(chunks) != 3 || len(chunks[0].Orders) != 1 || chunks[1].Jobs[0].ID != "j1" || chunks[2].Jobs[0].ID != "j2" {
+		t.Errorf("stateImportChunks() of 1 byte = %+v, want 3 chunks", chunks)
+	}
+}
+
+func TestReadStateExport_Invalid(t *testing.T) {
+	s := testStateServer(t)
+	defer s.raft.Shutdown()
+	var buf bytes.Buffer
+	args := &models.StateExportRequest{QueryOptions: models.QueryOptions{Region: "far"}}
+	if err := s.StateExport(context.Background(), args, &buf); err == nil {
+		t.Errorf("Server.StateExport() of another region = nil error")
+	}
+	if _, err := models.ReadStateExport(&buf); err == nil {
+		t.Errorf("models.ReadStateExport() of nothing = nil error")
+	}
+}
@@ -7,7 +7,12 @@
 package server
 
 import (
+	"time"
+
+	memdb "github.com/hashicorp/go-memdb"
+
 	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
 )
 
 // Status endpoint is used to check on server status
@@ -27,8 +32,20 @@ func (s *Status) Version(args *models.GenericRequest, reply *models.VersionRespo
 	return nil
 }
 
-// Ping is used to just check for connectivity
-func (s *Status) Ping(args struct{}, reply *struct{}) error {
+// Ping is used to check the health of this server. It is always served
+// locally, even without a leader, so load balancers can tell a failed
+// server from a cluster that has no leader.
+func (s *Status) Ping(args struct{}, reply *models.PingResponse) error {
+	reply.RaftState = s.srv.raft.State().String()
+	reply.KnownLeader = s.srv.raft.Leader() != ""
+	reply.Uptime = time.Since(s.srv.startTime)
+	reply.AppliedIndex = s.srv.raft.AppliedIndex()
+	reply.FSMApplied = s.srv.fsm.hasApplied()
+	mode, err := s.srv.fsm.State().Maintenance(memdb.NewWatchSet())
+	if err != nil {
+		return err
+	}
+	reply.Maintenance = mode
 	return nil
 }
 
@@ -50,6 +67,35 @@ func (s *Status) Leader(args *models.GenericRequest, reply *string) error {
 	return nil
 }
 
+// LeaderInfo returns the RPC address and Raft ID of the leader, for
+// clients to send their writes there directly. It is always answered
+// locally so it works without a leader, reporting KnownLeader false.
+func (s *Status) LeaderInfo(args *models.GenericRequest, reply *models.LeaderResponse) error {
+	isLeader, server := s.srv.getLeader()
+	if isLeader {
+		reply.Address = s.srv.rpcAdvertise.String()
+		reply.ID = string(s.srv.config.RaftConfig.LocalID)
+		reply.Name = s.srv.config.NodeName
+		reply.KnownLeader = true
+		return nil
+	}
+
+	// Raft is multiplexed on the RPC listener, so the Raft address of the
+	// leader, which is also its ID, reaches its RPC server as well
+	leader := s.srv.raft.Leader()
+	if leader == "" {
+		return nil
+	}
+	reply.Address = string(leader)
+	reply.ID = string(leader)
+	reply.KnownLeader = true
+	if server != nil {
+		reply.Address = server.Addr.String()
+		reply.Name = server.Name
+	}
+	return nil
+}
+
 // Peers is used to get all the Raft peers
 func (s *Status) Peers(args *models.GenericRequest, reply *[]string) error {
 	if args.Region == "" {
@@ -106,3 +152,116 @@ func (s *Status) Members(args *models.GenericRequest, reply *models.ServerMember
 	}
 	return nil
 }
+
+// RaftProgress reports how far the local FSM and Raft log are along, along
+// with the leader's last log index. It is always answered locally since it
+// describes this server, and blocks until the state store index exceeds
+// MinQueryIndex.
+func (s *Status) RaftProgress(args *models.GenericRequest, reply *models.RaftProgressResponse) error {
+	opts := blockingOptions{
+		queryOpts: &args.QueryOptions,
+		queryMeta: &reply.QueryMeta,
+		table:     "index",
+		run: func(ws memdb.WatchSet, state *store.StateStore) error {
+			iter, err := state.Indexes()
+			if err != nil {
+				return err
+			}
+			ws.Add(iter.WatchCh())
+
+			index, err := state.LatestIndex()
+			if err != nil {
+				return err
+			}
+			reply.Index = index
+
+			r := s.srv.raft
+			reply.AppliedIndex = r.AppliedIndex()
+			reply.LastLogIndex = r.LastIndex()
+			reply.CommitIndex = s.srv.raftCommitIndex()
+			return nil
+		}}
+	if err := s.srv.blockingRPC(&opts); err != nil {
+		return err
+	}
+
+	// Ask the leader for its own progress once we are done blocking
+	isLeader, leader := s.srv.getLeader()
+	if isLeader {
+		reply.LeaderLastLogIndex = reply.LastLogIndex
+		return nil
+	}
+	if leader == nil {
+		return nil
+	}
+	leaderArgs := models.GenericRequest{
+		QueryOptions: models.QueryOptions{Region: s.srv.config.Region},
+	}
+	var leaderReply models.RaftProgressResponse
+	if err := s.srv.forwardLeader(leader, "Status.RaftProgress", &leaderArgs, &leaderReply); err != nil {
+		s.srv.logger.Warnf("server.status: failed to get Raft progress from leader %v: %v", leader, err)
+		return nil
+	}
+	reply.LeaderLastLogIndex = leaderReply.LastLogIndex
+	return nil
+}
+
+// ConnPool returns a snapshot of the connections this server pools to the
+// other servers. It is always answered locally.
+func (s *Status) ConnPool(args *models.GenericRequest, reply *models.ConnPoolResponse) error {
+	reply.Pools = s.srv.connPool.Stats()
+	return nil
+}
+
+// FSMStats returns how many messages of each type the FSM applied, along
+// with its applied index. It is always answered locally.
+func (s *Status) FSMStats(args *models.GenericRequest, reply *models.FSMStatsResponse) error {
+	reply.AppliedIndex = s.srv.raft.AppliedIndex()
+	reply.Applied = s.srv.fsm.applyStats()
+	return nil
+}
+
+// Watches returns the blocking queries this server is serving: how many,
+// what they watch and for how long. It is always answered locally.
+func (s *Status) Watches(args *models.GenericRequest, reply *models.WatchesResponse) error {
+	*reply = *s.srv.watches.stats(time.Now())
+	return nil
+}
+
+// JobMetrics returns how the jobs are doing, from the metrics their tasks
+// last reported. Only the leader holds them, so the query is never served
+// stale. It blocks until a report comes after MinQueryIndex.
+func (s *Status) JobMetrics(args *models.JobMetricsRequest, reply *models.JobMetricsResponse) error {
+	args.AllowStale = false
+	if done, err := s.srv.forward("Status.JobMetrics", args, args, reply); done {
+		return err
+	}
+
+	opts := blockingOptions{
+		queryOpts: &args.QueryOptions,
+		queryMeta: &reply.QueryMeta,
+		table:     "job_metrics",
+		run: func(ws memdb.WatchSet, state *store.StateStore) error {
+			metrics, index, updateCh := s.srv.jobMetrics.jobs(time.Now(), args.JobID)
+			ws.Add(updateCh)
+			reply.Metrics = metrics
+			reply.Index = index
+			return nil
+		}}
+	return s.srv.blockingRPC(&opts)
+}
+
+// ReadIndex returns the commit index of the leader once it confirmed it is
+// still the leader. Followers wait to have applied that index before they
+// serve a consistent read.
+func (s *Status) ReadIndex(args *models.GenericRequest, reply *uint64) error {
+	if done, err := s.srv.forward("Status.ReadIndex", args, args, reply); done {
+		return err
+	}
+
+	if err := s.srv.raft.VerifyLeader().Error(); err != nil {
+		return err
+	}
+	*reply = s.srv.raftCommitIndex()
+	return nil
+}
@@ -7,8 +7,16 @@
 package server
 
 import (
+	"io/ioutil"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+
+	uconf "github.com/actiontech/dtle/internal/config"
 	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
 )
 
 func TestStatus_Version(t *testing.T) {
@@ -45,7 +53,7 @@ func TestStatus_Ping(t *testing.T) {
 	}
 	type args struct {
 		args  struct{}
-		reply *struct{}
+		reply *models.PingResponse
 	}
 	tests := []struct {
 		name    string
@@ -150,3 +158,95 @@ func TestStatus_Members(t *testing.T) {
 		})
 	}
 }
+
+func TestStatus_LeaderInfo(t *testing.T) {
+	leader := testRaftServer(t)
+	defer leader.raft.Shutdown()
+	leader.config.NodeName = "server-a"
+	leader.config.RaftConfig = &raft.Config{LocalID: "server-a"}
+	leader.rpcAdvertise = &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8191}
+
+	// A server that never joined a cluster has no leader
+	state, err := store.NewStateStore(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("store.NewStateStore() error = %v", err)
+	}
+	conf := raft.DefaultConfig()
+	conf.LocalID = "server-b"
+	conf.LogOutput = ioutil.Discard
+	logs := raft.NewInmemStore()
+	_, trans := raft.NewInmemTransport("")
+	r, err := raft.NewRaft(conf, &udupFSM{state: state}, logs, logs, raft.NewInmemSnapshotStore(), trans)
+	if err != nil {
+		t.Fatalf("raft.NewRaft() error = %v", err)
+	}
+	defer r.Shutdown()
+	lonely := &Server{config: &uconf.ServerConfig{Region: "global"}, raft: r}
+
+	tests := []struct {
+		name string
+		srv  *Server
+		want models.LeaderResponse
+	}{
+		{"leader", leader, models.LeaderResponse{Address: "10.0.0.1:8191", ID: "server-a", Name: "server-a", KnownLeader: true}},
+		{"no leader", lonely, models.LeaderResponse{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Status{srv: tt.srv}
+			var reply models.LeaderResponse
+			if err := s.LeaderInfo(&models.GenericRequest{}, &reply); err != nil {
+				t.Fatalf("Status.LeaderInfo() error = %v", err)
+			}
+			if reply != tt.want {
+				t.Errorf("Status.LeaderInfo() = %+v, want %+v", reply, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatus_JobMetrics(t *testing.T) {
+	s := testRaftServer(t)
+	defer s.raft.Shutdown()
+	status := &Status{srv: s}
+	node := &Node{srv: s}
+
+	report := func(rows int64) {
+		args := &models.MetricsUpdateRequest{
+			Metrics:      []*models.TaskMetrics{{JobID: "job1", AllocID: "a1", TaskType: "Dest", RowsApplied: rows}},
+			WriteRequest: models.WriteRequest{Region: "global"},
+		}
+		var reply models.GenericResponse
+		if err := node.UpdateMetrics(args, &reply); err != nil {
+			t.Fatalf("Node.UpdateMetrics() error = %v", err)
+		}
+	}
+	report(10)
+
+	args := &models.JobMetricsRequest{JobID: "job1", QueryOptions: models.QueryOptions{Region: "global"}}
+	var reply models.JobMetricsResponse
+	if err := status.JobMetrics(args, &reply); err != nil {
+		t.Fatalf("Status.JobMetrics() error = %v", err)
+	}
+	if len(reply.Metrics) != 1 || reply.Metrics[0].RowsApplied != 10 {
+		t.Fatalf("Status.JobMetrics() = %+v, want 10 rows applied", reply.Metrics)
+	}
+
+	// A blocking query returns with the next report
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		report(20)
+	}()
+	start := time.Now()
+	args.MinQueryIndex = reply.Index
+	var blocked models.JobMetricsResponse
+	if err := status.JobMetrics(args, &blocked); err != nil {
+		t.Fatalf("Status.JobMetrics() blocking error = %v", err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Errorf("Status.JobMetrics() returned before the report")
+	}
+	if blocked.Index <= reply.Index || len(blocked.Metrics) != 1 || blocked.Metrics[0].RowsApplied != 20 {
+		t.Errorf("Status.JobMetrics() blocking = index %v %+v, want index above %v and 20 rows applied", blocked.Index, blocked.Metrics, reply.Index)
+	}
+}
@@ -29,6 +29,8 @@ func stateStoreSchema() *memdb.DBSchema {
 		orderTableSchema,
 		evalTableSchema,
 		allocTableSchema,
+		jobEventsTableSchema,
+		maintenanceTableSchema,
 	}
 
 	// Add each of the tables
@@ -240,3 +242,42 @@ func allocTableSchema() *memdb.TableSchema {
 		},
 	}
 }
+
+// jobEventsTableSchema returns the MemDB schema for the job events table.
+// This table keeps the last events of the tasks of each job.
+func jobEventsTableSchema() *memdb.TableSchema {
+	return &memdb.TableSchema{
+		Name: "job_events",
+		Indexes: map[string]*memdb.IndexSchema{
+			"id": {
+				Name:         "id",
+				AllowMissing: false,
+				Unique:       true,
+				Indexer: &memdb.StringFieldIndex{
+					Field:     "JobID",
+					Lowercase: true,
+				},
+			},
+		},
+	}
+}
+
+// maintenanceTableSchema returns the MemDB schema for the maintenance table.
+// This table holds at most the single maintenance mode of the cluster.
+func maintenanceTableSchema() *memdb.TableSchema {
+	return &memdb.TableSchema{
+		Name: "maintenance",
+		Indexes: map[string]*memdb.IndexSchema{
+			"id": {
+				Name:         "id",
+				AllowMissing: false,
+				Unique:       true,
+				Indexer: &memdb.ConditionalIndex{
+					Conditional: func(obj interface{}) (bool, error) {
+						return true, nil
+					},
+				},
+			},
+		},
+	}
+}
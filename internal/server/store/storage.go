@@ -10,7 +10,10 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/go-memdb"
 
@@ -70,6 +73,34 @@ func (s *StateStore) Snapshot() (*StateSnapshot, error) {
 	return snap, nil
 }
 
+// Rollback replaces the whole content of the state store with the one of
+// snap in a single transaction, undoing every change made since snap was
+// taken. It is only meant for the rare failed batch, as it copies the
+// whole state.
+func (s *StateStore) Rollback(snap *StateSnapshot) error {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+	from := snap.db.Txn(false)
+
+	for table := range stateStoreSchema().Tables {
+		if _, err := txn.DeleteAll(table, "id"); err != nil {
+			return fmt.Errorf("failed to clear %s: %v", table, err)
+		}
+		iter, err := from.Get(table, "id")
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", table, err)
+		}
+		for raw := iter.Next(); raw != nil; raw = iter.Next() {
+			if err := txn.Insert(table, raw); err != nil {
+				return fmt.Errorf("failed to restore %s: %v", table, err)
+			}
+		}
+	}
+
+	txn.Commit()
+	return nil
+}
+
 // Restore is used to optimize the efficiency of rebuilding
 // state by minimizing the number of transactions and checking
 // overhead.
@@ -190,6 +221,104 @@ func (s *StateStore) UpdateJobStatus(index uint64, jobID, status string) error {
 	return nil
 }
 
+// UpdateJobConfig sets the reloadable fields of the configuration of the
+// tasks of the job jobID to those of tasks. The allocations of the job that
+// still run get the job updated, for their tasks to reload it.
+func (s *StateStore) UpdateJobConfig(index uint64, jobID string, tasks []*models.Task) error {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := txn.First("jobs", "id", jobID)
+	if err != nil {
+		return fmt.Errorf("job lookup failed: %v", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("job not found")
+	}
+
+	copyJob := reloadJobConfig(existing.(*models.Job), tasks)
+	copyJob.ModifyIndex = index
+	copyJob.JobModifyIndex = index
+	if err := txn.Insert("jobs", copyJob); err != nil {
+		return fmt.Errorf("job insert failed: %v", err)
+	}
+
+	iter, err := txn.Get("allocs", "job", jobID)
+	if err != nil {
+		return fmt.Errorf("alloc lookup failed: %v", err)
+	}
+	var allocs []*models.Allocation
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		alloc := raw.(*models.Allocation)
+		if alloc.TerminalStatus() || alloc.Job == nil || alloc.Job.CreateIndex != copyJob.CreateIndex {
+			continue
+		}
+		allocs = append(allocs, alloc)
+	}
+	for _, alloc := range allocs {
+		copyAlloc := new(models.Allocation)
+		*copyAlloc = *alloc
+		copyAlloc.Job = reloadJobConfig(alloc.Job, tasks)
+		copyAlloc.Job.ModifyIndex = index
+		copyAlloc.Job.JobModifyIndex = index
+		copyAlloc.ModifyIndex = index
+		copyAlloc.AllocModifyIndex = index
+		if err := txn.Insert("allocs", copyAlloc); err != nil {
+			return fmt.Errorf("alloc insert failed: %v", err)
+		}
+	}
+
+	if err := txn.Insert("index", &IndexEntry{"jobs", index}); err != nil {
+		return fmt.Errorf("index update failed: %v", err)
+	}
+	if len(allocs) != 0 {
+		if err := txn.Insert("index", &IndexEntry{"allocs", index}); err != nil {
+			return fmt.Errorf("index update failed: %v", err)
+		}
+	}
+
+	txn.Commit()
+	return nil
+}
+
+// reloadJobConfig returns a copy of job whose tasks have the reloadable
+// fields of the configuration of tasks. The configurations are copied, as
+// other copies of the job share them.
+func reloadJobConfig(job *models.Job, tasks []*models.Task) *models.Job {
+	copyJob := new(models.Job)
+	*copyJob = *job
+	copyJob.Tasks = make([]*models.Task, len(job.Tasks))
+	for i, t := range job.Tasks {
+		copyTask := new(models.Task)
+		*copyTask = *t
+		copyTask.ConfigLock = &sync.RWMutex{}
+		copyTask.Config = make(map[string]interface{}, len(t.Config))
+		if t.ConfigLock != nil {
+			t.ConfigLock.RLock()
+		}
+		for k, v := range t.Config {
+			copyTask.Config[k] = v
+		}
+		if t.ConfigLock != nil {
+			t.ConfigLock.RUnlock()
+		}
+		for _, update := range tasks {
+			if update.Type != t.Type {
+				continue
+			}
+			for _, k := range models.ReloadableConfig[t.Type] {
+				if v, ok := update.Config[k]; ok {
+					copyTask.Config[k] = v
+				} else {
+					delete(copyTask.Config, k)
+				}
+			}
+		}
+		copyJob.Tasks[i] = copyTask
+	}
+	return copyJob
+}
+
 // UpdateNodeStatus is used to update the status of a node
 func (s *StateStore) UpdateNodeStatus(index uint64, nodeID, status string) error {
 	txn := s.db.Txn(true)
@@ -592,6 +721,73 @@ func (s *StateStore) DeleteJob(index uint64, jobID string) error {
 		return fmt.Errorf("index update failed: %v", err)
 	}
 
+	// Delete the events of the job
+	if n, err := txn.DeleteAll("job_events", "id", jobID); err != nil {
+		return fmt.Errorf("job events delete failed: %v", err)
+	} else if n > 0 {
+		if err := txn.Insert("index", &IndexEntry{"job_events", index}); err != nil {
+			return fmt.Errorf("index update failed: %v", err)
+		}
+	}
+
+	txn.Commit()
+	return nil
+}
+
+// CancelJob marks the job jobID cancelled and its allocations which aren't
+// terminal to stop, for the clients running them to tear their tasks down.
+// Cancelling a job which doesn't exist or is already cancelled is harmless.
+func (s *StateStore) CancelJob(index uint64, jobID string) error {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := txn.First("jobs", "id", jobID)
+	if err != nil {
+		return fmt.Errorf("job lookup failed: %v", err)
+	}
+	if existing == nil {
+		return nil
+	}
+	if job := existing.(*models.Job); job.Status != models.JobStatusCancelled {
+		updated := job.Copy()
+		updated.Status = models.JobStatusCancelled
+		updated.ModifyIndex = index
+		if err := txn.Insert("jobs", updated); err != nil {
+			return fmt.Errorf("job insert failed: %v", err)
+		}
+		if err := txn.Insert("index", &IndexEntry{"jobs", index}); err != nil {
+			return fmt.Errorf("index update failed: %v", err)
+		}
+	}
+
+	iter, err := txn.Get("allocs", "job", jobID)
+	if err != nil {
+		return fmt.Errorf("failed to get allocs for job %q: %v", jobID, err)
+	}
+	var stopped []*models.Allocation
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		alloc := raw.(*models.Allocation)
+		if alloc.TerminalStatus() {
+			continue
+		}
+		stop := alloc.Copy()
+		stop.DesiredStatus = models.AllocDesiredStatusStop
+		stop.DesiredDescription = "job cancelled"
+		stop.ModifyIndex = index
+		stop.AllocModifyIndex = index
+		stopped = append(stopped, stop)
+	}
+	for _, alloc := range stopped {
+		if err := txn.Insert("allocs", alloc); err != nil {
+			return fmt.Errorf("alloc insert failed: %v", err)
+		}
+	}
+	if len(stopped) != 0 {
+		if err := txn.Insert("index", &IndexEntry{"allocs", index}); err != nil {
+			return fmt.Errorf("index update failed: %v", err)
+		}
+	}
+
 	txn.Commit()
 	return nil
 }
@@ -978,13 +1174,15 @@ func (s *StateStore) UpdateJobFromClient(index uint64, job *models.Job) error {
 // most things, some updates are authoritative from the client. Specifically,
 // the desired store comes from the schedulers, while the actual store comes
 // from clients.
-func (s *StateStore) UpdateAllocsFromClient(index uint64, allocs []*models.Allocation) error {
+// The events the clients report for the tasks are kept, up to
+// eventsRetention for each job.
+func (s *StateStore) UpdateAllocsFromClient(index uint64, allocs []*models.Allocation, eventsRetention int) error {
 	txn := s.db.Txn(true)
 	defer txn.Abort()
 
 	// Handle each of the updated allocations
 	for _, alloc := range allocs {
-		if err := s.nestedUpdateAllocFromClient(txn, index, alloc); err != nil {
+		if err := s.nestedUpdateAllocFromClient(txn, index, alloc, eventsRetention); err != nil {
 			return err
 		}
 	}
@@ -999,7 +1197,7 @@ func (s *StateStore) UpdateAllocsFromClient(index uint64, allocs []*models.Alloc
 }
 
 // nestedUpdateAllocFromClient is used to nest an update of an allocation with client status
-func (s *StateStore) nestedUpdateAllocFromClient(txn *memdb.Txn, index uint64, alloc *models.Allocation) error {
+func (s *StateStore) nestedUpdateAllocFromClient(txn *memdb.Txn, index uint64, alloc *models.Allocation, eventsRetention int) error {
 	// Look for existing alloc
 	existing, err := txn.First("allocs", "id", alloc.ID)
 	if err != nil {
@@ -1029,6 +1227,9 @@ func (s *StateStore) nestedUpdateAllocFromClient(txn *memdb.Txn, index uint64, a
 	if err := txn.Insert("allocs", copyAlloc); err != nil {
 		return fmt.Errorf("alloc insert failed: %v", err)
 	}
+	if err := s.appendJobEvents(txn, index, exist, alloc, eventsRetention); err != nil {
+		return err
+	}
 
 	// Set the job's status
 	forceStatus := ""
@@ -1039,6 +1240,8 @@ func (s *StateStore) nestedUpdateAllocFromClient(txn *memdb.Txn, index uint64, a
 		default:
 			forceStatus = models.JobStatusRunning
 		}
+	} else if copyAlloc.ClientStatus == models.AllocClientStatusFailed {
+		forceStatus = models.JobStatusFailed
 	} else {
 		forceStatus = models.JobStatusDead
 	}
@@ -1049,6 +1252,291 @@ func (s *StateStore) nestedUpdateAllocFromClient(txn *memdb.Txn, index uint64, a
 	return nil
 }
 
+// appendJobEvents appends the events the client reported for the tasks
+// of alloc since exist to those of its job, keeping the last retention
+// ones
+func (s *StateStore) appendJobEvents(txn *memdb.Txn, index uint64, exist, alloc *models.Allocation, retention int) error {
+	if retention <= 0 {
+		retention = models.DefaultJobEventsRetention
+	}
+
+	// Tasks are walked in order, for every server to keep the same events
+	names := make([]string, 0, len(alloc.TaskStates))
+	for name, state := range alloc.TaskStates {
+		if state != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var events []*models.JobEvent
+	for _, name := range names {
+		// The client reports the last events of the task, those
+		// after the ones it reported already are new
+		var last time.Time
+		if old := exist.TaskStates[name]; old != nil {
+			for _, e := range old.Events {
+				if e != nil && e.Time.After(last) {
+					last = e.Time
+				}
+			}
+		}
+		for _, e := range alloc.TaskStates[name].Events {
+			if e == nil || !e.Time.After(last) {
+				continue
+			}
+			events = append(events, &models.JobEvent{
+				AllocID:  exist.ID,
+				NodeID:   exist.NodeID,
+				TaskName: name,
+				Severity: e.Severity(),
+				Event:    e.Copy(),
+				Index:    index,
+			})
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Event.Time.Before(events[j].Event.Time) })
+
+	existing, err := txn.First("job_events", "id", exist.JobID)
+	if err != nil {
+		return fmt.Errorf("job events lookup failed: %v", err)
+	}
+	jobEvents := &models.JobEvents{JobID: exist.JobID, CreateIndex: index, ModifyIndex: index}
+	var kept []*models.JobEvent
+	if existing != nil {
+		jobEvents.CreateIndex = existing.(*models.JobEvents).CreateIndex
+		kept = existing.(*models.JobEvents).Events
+	}
+	// The events stored are never modified in place
+	jobEvents.Events = make([]*models.JobEvent, 0, len(kept)+len(events))
+	jobEvents.Events = append(append(jobEvents.Events, kept...), events...)
+	if len(jobEvents.Events) > retention {
+		jobEvents.Events = jobEvents.Events[len(jobEvents.Events)-retention:]
+	}
+
+	if err := txn.Insert("job_events", jobEvents); err != nil {
+		return fmt.Errorf("job events insert failed: %v", err)
+	}
+	if err := txn.Insert("index", &IndexEntry{"job_events", index}); err != nil {
+		return fmt.Errorf("index update failed: %v", err)
+	}
+	return nil
+}
+
+// JobEventsByID returns the events kept for the job, nil if there are none
+func (s *StateStore) JobEventsByID(ws memdb.WatchSet, jobID string) (*models.JobEvents, error) {
+	txn := s.db.Txn(false)
+
+	watchCh, existing, err := txn.FirstWatch("job_events", "id", jobID)
+	if err != nil {
+		return nil, fmt.Errorf("job events lookup failed: %v", err)
+	}
+	ws.Add(watchCh)
+
+	if existing != nil {
+		return existing.(*models.JobEvents), nil
+	}
+	return nil, nil
+}
+
+// JobEvents returns an iterator over the events of all the jobs
+func (s *StateStore) JobEvents(ws memdb.WatchSet) (memdb.ResultIterator, error) {
+	txn := s.db.Txn(false)
+
+	iter, err := txn.Get("job_events", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	ws.Add(iter.WatchCh())
+
+	return iter, nil
+}
+
+// ImportState inserts the jobs and orders of a chunk of a state import,
+// with the evaluations scheduling its jobs, which it returns. It fails if
+// the chunk is the first one and the store has jobs or orders, or if any
+// of the jobs or orders of the chunk exists.
+func (s *StateStore) ImportState(index uint64, req *models.StateImportApplyRequest) ([]*models.Evaluation, error) {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+
+	if req.First {
+		for _, table := range []string{"jobs", "orders"} {
+			iter, err := txn.Get(table, "id")
+			if err != nil {
+				return nil, fmt.Errorf("%s lookup failed: %v", table, err)
+			}
+			if iter.Next() != nil {
+				return nil, fmt.Errorf("the cluster already has %s, a state export is only imported into a fresh cluster", table)
+			}
+		}
+	}
+
+	for _, order := range req.Orders {
+		existing, err := txn.First("orders", "id", order.ID)
+		if err != nil {
+			return nil, fmt.Errorf("order lookup failed: %v", err)
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("order %q already exists", order.ID)
+		}
+		if err := txn.Insert("orders", order); err != nil {
+			return nil, fmt.Errorf("order insert failed: %v", err)
+		}
+	}
+	for _, job := range req.Jobs {
+		existing, err := txn.First("jobs", "id", job.ID)
+		if err != nil {
+			return nil, fmt.Errorf("job lookup failed: %v", err)
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("job %q already exists", job.ID)
+		}
+		job.CreateIndex = index
+		job.ModifyIndex = index
+		job.JobModifyIndex = index
+		if err := txn.Insert("jobs", job); err != nil {
+			return nil, fmt.Errorf("job insert failed: %v", err)
+		}
+	}
+
+	// The jobs being scheduled are pending until their evaluations placed
+	// them, the others keep their status
+	jobs := make(map[string]string, len(req.Evals))
+	for _, eval := range req.Evals {
+		eval.JobModifyIndex = index
+		if err := s.nestedUpsertEval(txn, index, eval); err != nil {
+			return nil, err
+		}
+		jobs[eval.JobID] = ""
+	}
+	if err := s.setJobStatuses(index, txn, jobs, false); err != nil {
+		return nil, fmt.Errorf("setting job status failed: %v", err)
+	}
+
+	if len(req.Orders) > 0 {
+		if err := txn.Insert("index", &IndexEntry{"orders", index}); err != nil {
+			return nil, fmt.Errorf("index update failed: %v", err)
+		}
+	}
+	if len(req.Jobs) > 0 {
+		if err := txn.Insert("index", &IndexEntry{"jobs", index}); err != nil {
+			return nil, fmt.Errorf("index update failed: %v", err)
+		}
+	}
+
+	txn.Commit()
+	return req.Evals, nil
+}
+
+// Maintenance returns the maintenance mode of the cluster, disabled if it
+// never entered it
+func (s *StateStore) Maintenance(ws memdb.WatchSet) (*models.MaintenanceMode, error) {
+	txn := s.db.Txn(false)
+
+	watchCh, existing, err := txn.FirstWatch("maintenance", "id")
+	if err != nil {
+		return nil, fmt.Errorf("maintenance lookup failed: %v", err)
+	}
+	ws.Add(watchCh)
+
+	if existing != nil {
+		return existing.(*models.MaintenanceMode), nil
+	}
+	return &models.MaintenanceMode{}, nil
+}
+
+// SetMaintenanceMode enters or leaves the maintenance mode. Entering it
+// pauses the jobs of req, leaving it resumes those it paused which are still
+// paused, in the same transaction as the evaluations of req for these jobs,
+// which it returns.
+func (s *StateStore) SetMaintenanceMode(index uint64, req *models.MaintenanceModeRequest) ([]*models.Evaluation, error) {
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+
+	evals := make(map[string]*models.Evaluation, len(req.Evals))
+	for _, eval := range req.Evals {
+		evals[eval.JobID] = eval
+	}
+	var changed []*models.Evaluation
+
+	mode := &models.MaintenanceMode{
+		Enabled:     req.Enabled,
+		Reason:      req.Reason,
+		Since:       req.Since,
+		Jobs:        req.Jobs,
+		ModifyIndex: index,
+	}
+	status := models.JobStatusPause
+	if !req.Enabled {
+		status = models.JobStatusRunning
+	}
+	for _, jobID := range req.Jobs {
+		existing, err := txn.First("jobs", "id", jobID)
+		if err != nil {
+			return nil, fmt.Errorf("job lookup failed: %v", err)
+		}
+		// The job may have been deleted or changed meanwhile
+		if existing == nil {
+			continue
+		}
+		job := existing.(*models.Job)
+		switch {
+		case req.Enabled && (job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending):
+		case !req.Enabled && job.Status == models.JobStatusPause:
+		default:
+			continue
+		}
+
+		copyJob := new(models.Job)
+		*copyJob = *job
+		copyJob.Status = status
+		copyJob.ModifyIndex = index
+		copyJob.JobModifyIndex = index
+		if err := txn.Insert("jobs", copyJob); err != nil {
+			return nil, fmt.Errorf("job insert failed: %v", err)
+		}
+
+		if eval, ok := evals[jobID]; ok {
+			eval.JobModifyIndex = index
+			if err := s.nestedUpsertEval(txn, index, eval); err != nil {
+				return nil, err
+			}
+			changed = append(changed, eval)
+		}
+	}
+	if len(req.Jobs) > 0 {
+		if err := txn.Insert("index", &IndexEntry{"jobs", index}); err != nil {
+			return nil, fmt.Errorf("index update failed: %v", err)
+		}
+	}
+
+	// Resumed jobs are pending until their evaluations placed them
+	jobs := make(map[string]string, len(changed))
+	for _, eval := range changed {
+		jobs[eval.JobID] = ""
+	}
+	if err := s.setJobStatuses(index, txn, jobs, false); err != nil {
+		return nil, fmt.Errorf("setting job status failed: %v", err)
+	}
+
+	if _, err := txn.DeleteAll("maintenance", "id"); err != nil {
+		return nil, fmt.Errorf("maintenance delete failed: %v", err)
+	}
+	if err := txn.Insert("maintenance", mode); err != nil {
+		return nil, fmt.Errorf("maintenance insert failed: %v", err)
+	}
+	if err := txn.Insert("index", &IndexEntry{"maintenance", index}); err != nil {
+		return nil, fmt.Errorf("index update failed: %v", err)
+	}
+
+	txn.Commit()
+	return changed, nil
+}
+
 // UpsertAllocs is used to evict a set of allocations
 // and allocate new ones at the same time.
 func (s *StateStore) UpsertAllocs(index uint64, allocs []*models.Allocation) error {
@@ -1372,6 +1860,22 @@ func (s *StateStore) Index(name string) (uint64, error) {
 	return out.(*IndexEntry).Value, nil
 }
 
+// IndexWatch returns the index of the named table like Index, and adds a
+// watch on it to ws so a blocking query wakes up once the table changes
+func (s *StateStore) IndexWatch(ws memdb.WatchSet, name string) (uint64, error) {
+	txn := s.db.Txn(false)
+
+	watchCh, out, err := txn.FirstWatch("index", "id", name)
+	if err != nil {
+		return 0, err
+	}
+	ws.Add(watchCh)
+	if out == nil {
+		return 0, nil
+	}
+	return out.(*IndexEntry).Value, nil
+}
+
 // RemoveIndex is a helper method to remove an index for testing purposes
 func (s *StateStore) RemoveIndex(name string) error {
 	txn := s.db.Txn(true)
@@ -1413,7 +1917,8 @@ func (s *StateStore) setJobStatuses(index uint64, txn *memdb.Txn,
 		}
 
 		exist := existing.(*models.Job)
-		if exist.Status == models.JobStatusPause || exist.Status == models.JobStatusDead {
+		if exist.Status == models.JobStatusPause || exist.Status == models.JobStatusDead ||
+			exist.Status == models.JobStatusFailed || exist.Status == models.JobStatusCancelled {
 			continue
 		}
 
@@ -1568,6 +2073,22 @@ func (r *StateRestore) AllocRestore(alloc *models.Allocation) error {
 	return nil
 }
 
+// JobEventsRestore is used to restore the events of a job
+func (r *StateRestore) JobEventsRestore(events *models.JobEvents) error {
+	if err := r.txn.Insert("job_events", events); err != nil {
+		return fmt.Errorf("job events insert failed: %v", err)
+	}
+	return nil
+}
+
+// MaintenanceRestore is used to restore the maintenance mode
+func (r *StateRestore) MaintenanceRestore(mode *models.MaintenanceMode) error {
+	if err := r.txn.Insert("maintenance", mode); err != nil {
+		return fmt.Errorf("maintenance insert failed: %v", err)
+	}
+	return nil
+}
+
 // IndexRestore is used to restore an index
 func (r *StateRestore) IndexRestore(idx *IndexEntry) error {
 	if err := r.txn.Insert("index", idx); err != nil {
@@ -15,6 +15,8 @@ import (
 	"strconv"
 
 	"github.com/hashicorp/serf/serf"
+
+	"github.com/actiontech/dtle/internal/models"
 )
 
 // ensurePath is used to make sure a path exists
@@ -34,6 +36,27 @@ type serverParts struct {
 	Bootstrap  bool
 	Expect     int
 	Addr       net.Addr
+
+	// Compression is set if the server accepts compressed connections
+	Compression bool
+
+	// Weight is the relative preference for forwarding RPCs to this
+	// server. Zero means no weight was advertised.
+	Weight int
+
+	// Checksum is set if the server accepts checksummed streams
+	Checksum bool
+
+	// NonVoter is set if the server replicates the state without taking
+	// part in elections. It only serves stale reads.
+	NonVoter bool
+
+	// SchemaVersion is the highest schema version of Raft messages the
+	// server decodes. Servers predating it advertise none.
+	SchemaVersion uint8
+
+	// Status is the serf status of the server
+	Status serf.MemberStatus
 }
 
 func (s *serverParts) String() string {
@@ -51,6 +74,9 @@ func isUdupServer(m serf.Member) (bool, *serverParts) {
 	region := m.Tags["region"]
 	datacenter := m.Tags["dc"]
 	_, bootstrap := m.Tags["bootstrap"]
+	_, compression := m.Tags["compress"]
+	_, nonVoter := m.Tags["nonvoter"]
+	_, checksum := m.Tags["checksum"]
 
 	expect := 0
 	expect_str, ok := m.Tags["expect"]
@@ -62,6 +88,21 @@ func isUdupServer(m serf.Member) (bool, *serverParts) {
 		}
 	}
 
+	// An invalid weight only loses the preference, not the server
+	weight := 0
+	if weight_str, ok := m.Tags["weight"]; ok {
+		if w, err := strconv.Atoi(weight_str); err == nil && w > 0 {
+			weight = w
+		}
+	}
+
+	schemaVersion := models.LegacySchemaVersion
+	if schema_str, ok := m.Tags["schema"]; ok {
+		if v, err := strconv.ParseUint(schema_str, 10, 8); err == nil {
+			schemaVersion = uint8(v)
+		}
+	}
+
 	port_str := m.Tags["port"]
 	port, err := strconv.Atoi(port_str)
 	if err != nil {
@@ -77,10 +118,34 @@ func isUdupServer(m serf.Member) (bool, *serverParts) {
 		Bootstrap:  bootstrap,
 		Expect:     expect,
 		Addr:       addr,
+
+		Compression: compression,
+		Weight:      weight,
+		NonVoter:    nonVoter,
+		Checksum:    checksum,
+
+		SchemaVersion: schemaVersion,
+		Status:        m.Status,
 	}
 	return true, parts
 }
 
+// serversSchemaVersion returns the highest schema version of Raft messages
+// every server of region decodes. Servers that left don't count.
+func serversSchemaVersion(members []serf.Member, region string) uint8 {
+	version := models.SchemaVersion
+	for _, member := range members {
+		valid, parts := isUdupServer(member)
+		if !valid || parts.Region != region || parts.Status == serf.StatusLeft {
+			continue
+		}
+		if parts.SchemaVersion < version {
+			version = parts.SchemaVersion
+		}
+	}
+	return version
+}
+
 // shuffleStrings randomly shuffles the list of strings
 func shuffleStrings(list []string) {
 	for i := range list {
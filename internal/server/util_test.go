@@ -7,11 +7,14 @@
 package server
 
 import (
+	"fmt"
 	"net"
 	"reflect"
 	"testing"
 
 	"github.com/hashicorp/serf/serf"
+
+	"github.com/actiontech/dtle/internal/models"
 )
 
 func Test_ensurePath(t *testing.T) {
@@ -80,7 +83,34 @@ func Test_isUdupServer(t *testing.T) {
 		want  bool
 		want1 *serverParts
 	}{
-		// TODO: Add test cases.
+		{
+			name: "client",
+			args: args{serf.Member{Name: "a", Tags: map[string]string{"role": "client"}}},
+		},
+		{
+			name: "voter",
+			args: args{serf.Member{Name: "a", Addr: net.ParseIP("127.0.0.1"),
+				Tags: map[string]string{"role": "server", "region": "global", "dc": "dc1", "port": "8191"}}},
+			want: true,
+			want1: &serverParts{Name: "a", Region: "global", Datacenter: "dc1", Port: 8191,
+				Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8191}},
+		},
+		{
+			name: "non-voter",
+			args: args{serf.Member{Name: "a", Addr: net.ParseIP("127.0.0.1"),
+				Tags: map[string]string{"role": "server", "region": "global", "dc": "dc1", "port": "8191", "nonvoter": "1"}}},
+			want: true,
+			want1: &serverParts{Name: "a", Region: "global", Datacenter: "dc1", Port: 8191,
+				Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8191}, NonVoter: true},
+		},
+		{
+			name: "schema version",
+			args: args{serf.Member{Name: "a", Addr: net.ParseIP("127.0.0.1"), Status: serf.StatusAlive,
+				Tags: map[string]string{"role": "server", "region": "global", "dc": "dc1", "port": "8191", "schema": "1"}}},
+			want: true,
+			want1: &serverParts{Name: "a", Region: "global", Datacenter: "dc1", Port: 8191,
+				Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8191}, SchemaVersion: 1, Status: serf.StatusAlive},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -95,6 +125,36 @@ func Test_isUdupServer(t *testing.T) {
 	}
 }
 
+func Test_serversSchemaVersion(t *testing.T) {
+	server := func(region, schema string, status serf.MemberStatus) serf.Member {
+		tags := map[string]string{"role": "server", "region": region, "port": "8191"}
+		if schema != "" {
+			tags["schema"] = schema
+		}
+		return serf.Member{Name: "s", Tags: tags, Status: status}
+	}
+	current := fmt.Sprintf("%d", models.SchemaVersion)
+	tests := []struct {
+		name    string
+		members []serf.Member
+		want    uint8
+	}{
+		{"upgraded", []serf.Member{server("global", current, serf.StatusAlive), server("global", current, serf.StatusAlive)}, models.SchemaVersion},
+		{"rolling upgrade", []serf.Member{server("global", current, serf.StatusAlive), server("global", "", serf.StatusAlive)}, models.LegacySchemaVersion},
+		{"failed old server", []serf.Member{server("global", current, serf.StatusAlive), server("global", "", serf.StatusFailed)}, models.LegacySchemaVersion},
+		{"old server left", []serf.Member{server("global", current, serf.StatusAlive), server("global", "", serf.StatusLeft)}, models.SchemaVersion},
+		{"old server of another region", []serf.Member{server("global", current, serf.StatusAlive), server("other", "", serf.StatusAlive)}, models.SchemaVersion},
+		{"old client", []serf.Member{server("global", current, serf.StatusAlive), {Name: "c", Tags: map[string]string{"role": "client"}}}, models.SchemaVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serversSchemaVersion(tt.members, "global"); got != tt.want {
+				t.Errorf("serversSchemaVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_shuffleStrings(t *testing.T) {
 	type args struct {
 		list []string
@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// The state store lives in memory, so what a new leader is missing are
+// the connections the previous leader had pooled to the servers of other
+// regions: the first RPCs forwarded there pay for the TCP and TLS
+// handshakes. Followers keep a digest of those connections and open them
+// as soon as they become the leader.
+
+// hotConn is a connection pooled by the leader, to addr in region
+type hotConn struct {
+	region string
+	addr   string
+}
+
+// warmStandby holds the digest of the connections pooled by the leader
+type warmStandby struct {
+	conns []hotConn
+	l     sync.Mutex
+}
+
+func (w *warmStandby) set(conns []hotConn) {
+	w.l.Lock()
+	defer w.l.Unlock()
+	w.conns = conns
+}
+
+func (w *warmStandby) get() []hotConn {
+	w.l.Lock()
+	defer w.l.Unlock()
+	return w.conns
+}
+
+// monitorWarmStandby periodically pulls the digest of the connections
+// pooled by the leader while this server is a follower
+func (s *Server) monitorWarmStandby() {
+	interval := s.config.WarmStandbyInterval
+	if interval <= 0 {
+		return
+	}
+	for {
+		select {
+		case <-time.After(interval):
+			if s.IsLeader() {
+				continue
+			}
+			if err := s.pullHotConns(); err != nil {
+				s.logger.Debugf("manager: failed to pull the leader's pooled connections: %v", err)
+			}
+
+		case <-s.shutdownCh:
+			return
+		}
+	}
+}
+
+// pullHotConns replaces the digest with the connections the leader has
+// pooled to servers other than this one
+func (s *Server) pullHotConns() error {
+	isLeader, leader := s.getLeader()
+	if isLeader {
+		return nil
+	}
+	if leader == nil {
+		return models.ErrNoLeader
+	}
+
+	var reply models.ConnPoolResponse
+	if err := s.forwardLeader(leader, "Status.ConnPool", &models.GenericRequest{}, &reply); err != nil {
+		return err
+	}
+	self := s.rpcAdvertise.String()
+	conns := make([]hotConn, 0, len(reply.Pools))
+	for _, stats := range reply.Pools {
+		if stats.Pooled && stats.Addr != self {
+			conns = append(conns, hotConn{region: stats.Region, addr: stats.Addr})
+		}
+	}
+	s.warmStandby.set(conns)
+	metrics.SetGauge([]string{"server", "warm_standby", "digest"}, float32(len(conns)))
+	return nil
+}
+
+// warmConns opens the connections of the digest that aren't pooled yet,
+// in the mode RPCs forwarded to their server would use, and returns how
+// many are pooled afterwards. Servers that left are skipped.
+func (s *Server) warmConns() int {
+	warmed := 0
+	for _, hot := range s.warmStandby.get() {
+		server := s.findPeer(hot.region, hot.addr)
+		if server == nil {
+			continue
+		}
+		conn, err := s.connPool.acquire(hot.region, server.Addr, s.forwardMode(server))
+		if err != nil {
+			s.logger.Debugf("manager: failed to warm the connection to %s in region %s: %v", hot.addr, hot.region, err)
+			continue
+		}
+		s.connPool.releaseConn(conn)
+		warmed++
+	}
+	metrics.IncrCounter([]string{"server", "warm_standby", "warmed"}, float32(warmed))
+	return warmed
+}
+
+// findPeer returns the known server of region at addr, if any
+func (s *Server) findPeer(region, addr string) *serverParts {
+	s.peerLock.RLock()
+	defer s.peerLock.RUnlock()
+	for _, server := range s.peers[region] {
+		if server.Addr.String() == addr {
+			return server
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+	ulog "github.com/actiontech/dtle/internal/logger"
+)
+
+func TestServer_warmConns(t *testing.T) {
+	// A remote server that accepts connections and holds them open
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	defer list.Close()
+	go func() {
+		for {
+			conn, err := list.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				ioutil.ReadAll(conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	remote := &serverParts{Name: "server-eu", Region: "eu", Addr: list.Addr()}
+	s := &Server{
+		config:   &uconf.ServerConfig{},
+		logger:   ulog.New(ioutil.Discard, ulog.ErrorLevel),
+		connPool: NewPool(ioutil.Discard, time.Minute, 1, nil),
+		peers:    map[string][]*serverParts{"eu": {remote}},
+	}
+	defer s.connPool.Shutdown()
+	s.warmStandby.set([]hotConn{
+		{region: "eu", addr: list.Addr().String()},
+		{region: "eu", addr: "127.0.0.1:1"}, // left the cluster
+	})
+
+	if warmed := s.warmConns(); warmed != 1 {
+		t.Fatalf("Server.warmConns() = %d, want 1", warmed)
+	}
+	stats, ok := s.connPool.Stats()[poolKey(list.Addr(), 0)]
+	if !ok || !stats.Pooled || stats.Active != 0 {
+		t.Fatalf("Server.warmConns() left pool stats %+v", stats)
+	}
+
+	// Warming again reuses the pooled connection
+	if warmed := s.warmConns(); warmed != 1 {
+		t.Fatalf("Server.warmConns() = %d, want 1", warmed)
+	}
+	if stats := s.connPool.Stats()[poolKey(list.Addr(), 0)]; stats.Created != 1 {
+		t.Errorf("Server.warmConns() created %d connections, want 1", stats.Created)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/actiontech/dtle/internal/models"
+)
+
+// maxOldestWatches is how many of the oldest blocking queries
+// Status.Watches lists
+const maxOldestWatches = 20
+
+// watchAgeBounds are the upper bounds of the ages Status.Watches counts
+// the blocking queries by, the last bucket holding the older ones
+var watchAgeBounds = []time.Duration{time.Second, 10 * time.Second, time.Minute, 5 * time.Minute}
+
+// watchTracker tracks the blocking queries being served, from when they
+// take a slot until they return. The zero value is ready to use.
+type watchTracker struct {
+	l       sync.Mutex
+	lastID  uint64
+	watches map[uint64]*activeWatch
+}
+
+type activeWatch struct {
+	table    string
+	minIndex uint64
+	start    time.Time
+}
+
+// add tracks a blocking query of table waiting for minIndex, and returns
+// the ID to remove it with
+func (t *watchTracker) add(table string, minIndex uint64) uint64 {
+	t.l.Lock()
+	defer t.l.Unlock()
+	if t.watches == nil {
+		t.watches = make(map[uint64]*activeWatch)
+	}
+	t.lastID++
+	t.watches[t.lastID] = &activeWatch{table: table, minIndex: minIndex, start: time.Now()}
+	return t.lastID
+}
+
+// remove stops tracking the blocking query id, once it returned
+func (t *watchTracker) remove(id uint64) {
+	t.l.Lock()
+	defer t.l.Unlock()
+	delete(t.watches, id)
+}
+
+// stats describes the blocking queries tracked at now
+func (t *watchTracker) stats(now time.Time) *models.WatchesResponse {
+	t.l.Lock()
+	watches := make([]*activeWatch, 0, len(t.watches))
+	for _, w := range t.watches {
+		watches = append(watches, w)
+	}
+	t.l.Unlock()
+
+	resp := &models.WatchesResponse{
+		Count:   len(watches),
+		ByTable: make(map[string]int),
+	}
+	for _, bound := range watchAgeBounds {
+		resp.Ages = append(resp.Ages, &models.WatchAgeBucket{Below: bound})
+	}
+	resp.Ages = append(resp.Ages, &models.WatchAgeBucket{})
+	sort.Slice(watches, func(i, j int) bool { return watches[i].start.Before(watches[j].start) })
+	for i, w := range watches {
+		age := now.Sub(w.start)
+		resp.ByTable[w.table]++
+		bucket := len(watchAgeBounds)
+		for b, bound := range watchAgeBounds {
+			if age < bound {
+				bucket = b
+				break
+			}
+		}
+		resp.Ages[bucket].Count++
+		if i < maxOldestWatches {
+			resp.Oldest = append(resp.Oldest, &models.WatchInfo{Table: w.table, MinQueryIndex: w.minIndex, Age: age})
+		}
+	}
+	return resp
+}
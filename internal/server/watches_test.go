@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2016-2018. ActionTech.
+ * Based on: github.com/hashicorp/nomad, github.com/github/gh-ost .
+ * License: MPL version 2: https://www.mozilla.org/en-US/MPL/2.0 .
+ */
+
+package server
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	memdb "github.com/hashicorp/go-memdb"
+	"github.com/hashicorp/raft"
+
+	uconf "github.com/actiontech/dtle/internal/config"
+	"github.com/actiontech/dtle/internal/models"
+	"github.com/actiontech/dtle/internal/server/store"
+)
+
+func TestStatus_Watches(t *testing.T) {
+	state, err := store.NewStateStore(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("store.NewStateStore() error = %v", err)
+	}
+	fsm := &udupFSM{state: state}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = "test"
+	conf.LogOutput = ioutil.Discard
+	logs := raft.NewInmemStore()
+	_, trans := raft.NewInmemTransport("")
+	r, err := raft.NewRaft(conf, fsm, logs, logs, raft.NewInmemSnapshotStore(), trans)
+	if err != nil {
+		t.Fatalf("raft.NewRaft() error = %v", err)
+	}
+	defer r.Shutdown()
+
+	s := &Server{
+		config:     &uconf.ServerConfig{},
+		raft:       r,
+		fsm:        fsm,
+		rpcDrainer: newRPCDrainer(),
+	}
+	status := &Status{srv: s}
+	if err := state.UpsertJob(5, &models.Job{ID: "a", Type: models.JobTypeSync}); err != nil {
+		t.Fatalf("StateStore.UpsertJob() error = %v", err)
+	}
+
+	// The query is tracked until it times out
+	doneCh := make(chan error, 1)
+	go func() {
+		opts := models.QueryOptions{MinQueryIndex: 5, MaxQueryTime: 200 * time.Millisecond}
+		var meta models.QueryMeta
+		doneCh <- s.queryBlocking(&opts, &meta, "jobs", func(ws memdb.WatchSet, state *store.StateStore) (uint64, error) {
+			return 0, nil
+		})
+	}()
+	var reply models.WatchesResponse
+	deadline := time.Now().Add(time.Second)
+	for reply.Count == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Status.Watches() didn't report the blocking query")
+		}
+		time.Sleep(time.Millisecond)
+		if err := status.Watches(&models.GenericRequest{}, &reply); err != nil {
+			t.Fatalf("Status.Watches() error = %v", err)
+		}
+	}
+	if reply.Count != 1 || reply.ByTable["jobs"] != 1 || len(reply.Oldest) != 1 || reply.Oldest[0].MinQueryIndex != 5 {
+		t.Errorf("Status.Watches() = %+v, want the query of jobs at index 5", reply)
+	}
+	if len(reply.Ages) != len(watchAgeBounds)+1 || reply.Ages[0].Below != time.Second || reply.Ages[0].Count != 1 {
+		t.Errorf("Status.Watches() Ages = %+v, want the query under a second", reply.Ages)
+	}
+
+	if err := <-doneCh; err != nil {
+		t.Fatalf("Server.queryBlocking() error = %v", err)
+	}
+	if err := status.Watches(&models.GenericRequest{}, &reply); err != nil || reply.Count != 0 || len(reply.Oldest) != 0 {
+		t.Errorf("Status.Watches() after the timeout = %+v, %v, want none", reply, err)
+	}
+}
+
+func Test_watchTracker_stats(t *testing.T) {
+	var tracker watchTracker
+	now := time.Now()
+	for i, age := range []time.Duration{0, 30 * time.Second, 10 * time.Minute} {
+		id := tracker.add("allocs", uint64(i))
+		tracker.watches[id].start = now.Add(-age)
+	}
+	tracker.remove(tracker.add("jobs", 9))
+
+	stats := tracker.stats(now)
+	if stats.Count != 3 || stats.ByTable["allocs"] != 3 || stats.ByTable["jobs"] != 0 {
+		t.Errorf("watchTracker.stats() = %+v, want the 3 queries of allocs", stats)
+	}
+	counts := make([]int, len(stats.Ages))
+	for i, bucket := range stats.Ages {
+		counts[i] = bucket.Count
+	}
+	if want := []int{1, 0, 1, 0, 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("watchTracker.stats() Ages = %v, want %v", counts, want)
+	}
+	if stats.Oldest[0].MinQueryIndex != 2 || stats.Oldest[2].MinQueryIndex != 0 {
+		t.Errorf("watchTracker.stats() Oldest = %+v, want the oldest first", stats.Oldest)
+	}
+}
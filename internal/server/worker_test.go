@@ -48,7 +48,6 @@ func TestWorker_SetPause(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -71,7 +70,6 @@ func TestWorker_SetPause(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -88,7 +86,6 @@ func TestWorker_checkPaused(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -107,7 +104,6 @@ func TestWorker_checkPaused(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -124,7 +120,6 @@ func TestWorker_run(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -143,7 +138,6 @@ func TestWorker_run(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -160,7 +154,6 @@ func TestWorker_dequeueEvaluation(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -186,7 +179,6 @@ func TestWorker_dequeueEvaluation(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -212,7 +204,6 @@ func TestWorker_sendAck(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -237,7 +228,6 @@ func TestWorker_sendAck(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -254,7 +244,6 @@ func TestWorker_waitForIndex(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -279,7 +268,6 @@ func TestWorker_waitForIndex(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -298,7 +286,6 @@ func TestWorker_invokeScheduler(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -323,7 +310,6 @@ func TestWorker_invokeScheduler(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -342,7 +328,6 @@ func TestWorker_SubmitPlan(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -368,7 +353,6 @@ func TestWorker_SubmitPlan(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -395,7 +379,6 @@ func TestWorker_UpdateEval(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -419,7 +402,6 @@ func TestWorker_UpdateEval(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -438,7 +420,6 @@ func TestWorker_CreateEval(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -462,7 +443,6 @@ func TestWorker_CreateEval(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -481,7 +461,6 @@ func TestWorker_ReblockEval(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -505,7 +484,6 @@ func TestWorker_ReblockEval(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -524,7 +502,6 @@ func TestWorker_shouldResubmit(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -548,7 +525,6 @@ func TestWorker_shouldResubmit(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -567,7 +543,6 @@ func TestWorker_backoffErr(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -592,7 +567,6 @@ func TestWorker_backoffErr(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,
@@ -611,7 +585,6 @@ func TestWorker_backoffReset(t *testing.T) {
 		logger        *log.Logger
 		start         time.Time
 		paused        bool
-		pauseLock     sync.Mutex
 		pauseCond     *sync.Cond
 		failures      uint
 		evalToken     string
@@ -630,7 +603,6 @@ func TestWorker_backoffReset(t *testing.T) {
 				logger:        tt.fields.logger,
 				start:         tt.fields.start,
 				paused:        tt.fields.paused,
-				pauseLock:     tt.fields.pauseLock,
 				pauseCond:     tt.fields.pauseCond,
 				failures:      tt.fields.failures,
 				evalToken:     tt.fields.evalToken,